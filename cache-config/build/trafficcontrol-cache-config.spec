@@ -83,6 +83,22 @@ go_toupd_dir="$ccpath"/t3c-update
 	cp "$TC_DIR"/"$ccdir"/t3c-update/t3c-update.1 .
 ) || { echo "Could not copy go program at $(pwd): $!"; exit 1; }
 
+# copy t3c-daemon binary
+go_t3c_daemon_dir="$ccpath"/t3c-daemon
+( mkdir -p "$go_t3c_daemon_dir" && \
+	cd "$go_t3c_daemon_dir" && \
+	cp "$TC_DIR"/"$ccdir"/t3c-daemon/t3c-daemon .
+	cp "$TC_DIR"/"$ccdir"/t3c-daemon/t3c-daemon.1 .
+) || { echo "Could not copy go program at $(pwd): $!"; exit 1; }
+
+# copy t3c-proxy binary
+go_t3c_proxy_dir="$ccpath"/t3c-proxy
+( mkdir -p "$go_t3c_proxy_dir" && \
+	cd "$go_t3c_proxy_dir" && \
+	cp "$TC_DIR"/"$ccdir"/t3c-proxy/t3c-proxy .
+	cp "$TC_DIR"/"$ccdir"/t3c-proxy/t3c-proxy.1 .
+) || { echo "Could not copy go program at $(pwd): $!"; exit 1; }
+
 # copy t3c-check binary
 go_t3c_check_dir="$ccpath"/t3c-check
 ( mkdir -p "$go_t3c_check_dir" && \
@@ -91,6 +107,14 @@ go_t3c_check_dir="$ccpath"/t3c-check
 	cp "$TC_DIR"/"$ccdir"/t3c-check/t3c-check.1 .
 ) || { echo "Could not copy go program at $(pwd): $!"; exit 1; }
 
+# copy t3c-check-config binary
+go_t3c_check_config_dir="$ccpath"/t3c-check-config
+( mkdir -p "$go_t3c_check_config_dir" && \
+	cd "$go_t3c_check_config_dir" && \
+	cp "$TC_DIR"/"$ccdir"/t3c-check-config/t3c-check-config .
+	cp "$TC_DIR"/"$ccdir"/t3c-check-config/t3c-check-config.1 .
+) || { echo "Could not copy go program at $(pwd): $!"; exit 1; }
+
 # copy t3c-check-refs binary
 go_t3c_check_refs_dir="$ccpath"/t3c-check-refs
 ( mkdir -p "$go_t3c_check_refs_dir" && \
@@ -162,6 +186,10 @@ to_upd_src=src/github.com/apache/trafficcontrol/"$ccdir"/t3c-update
 cp -p "$to_upd_src"/t3c-update ${RPM_BUILD_ROOT}/"$installdir"
 gzip -c -9 "$src"/t3c-update/t3c-update.1 > ${RPM_BUILD_ROOT}/"$mandir"/"$man1dir"/t3c-update.1.gz
 
+t3c_daemon_src=src/github.com/apache/trafficcontrol/"$ccdir"/t3c-daemon
+cp -p "$t3c_daemon_src"/t3c-daemon ${RPM_BUILD_ROOT}/"$installdir"
+gzip -c -9 "$src"/t3c-daemon/t3c-daemon.1 > ${RPM_BUILD_ROOT}/"$mandir"/"$man1dir"/t3c-daemon.1.gz
+
 t3c_diff_src=src/github.com/apache/trafficcontrol/"$ccdir"/t3c-diff
 cp -p "$t3c_diff_src"/t3c-diff ${RPM_BUILD_ROOT}/"$installdir"
 gzip -c -9 "$src"/t3c-diff/t3c-diff.1 > ${RPM_BUILD_ROOT}/"$mandir"/"$man1dir"/t3c-diff.1.gz
@@ -170,6 +198,10 @@ t3c_check_src=src/github.com/apache/trafficcontrol/"$ccdir"/t3c-check
 cp -p "$t3c_check_src"/t3c-check ${RPM_BUILD_ROOT}/"$installdir"
 gzip -c -9 "$src"/t3c-check/t3c-check.1 > ${RPM_BUILD_ROOT}/"$mandir"/"$man1dir"/t3c-check.1.gz
 
+t3c_check_config_src=src/github.com/apache/trafficcontrol/"$ccdir"/t3c-check-config
+cp -p "$t3c_check_config_src"/t3c-check-config ${RPM_BUILD_ROOT}/"$installdir"
+gzip -c -9 "$src"/t3c-check-config/t3c-check-config.1 > ${RPM_BUILD_ROOT}/"$mandir"/"$man1dir"/t3c-check-config.1.gz
+
 t3c_check_refs_src=src/github.com/apache/trafficcontrol/"$ccdir"/t3c-check-refs
 cp -p "$t3c_check_refs_src"/t3c-check-refs ${RPM_BUILD_ROOT}/"$installdir"
 gzip -c -9 "$src"/t3c-check-refs/t3c-check-refs.1 > ${RPM_BUILD_ROOT}/"$mandir"/"$man1dir"/t3c-check-refs.1.gz
@@ -178,6 +210,10 @@ t3c_check_reload_src=src/github.com/apache/trafficcontrol/"$ccdir"/t3c-check-rel
 cp -p "$t3c_check_reload_src"/t3c-check-reload ${RPM_BUILD_ROOT}/"$installdir"
 gzip -c -9 "$src"/t3c-check-reload/t3c-check-reload.1 > ${RPM_BUILD_ROOT}/"$mandir"/"$man1dir"/t3c-check-reload.1.gz
 
+t3c_proxy_src=src/github.com/apache/trafficcontrol/"$ccdir"/t3c-proxy
+cp -p "$t3c_proxy_src"/t3c-proxy ${RPM_BUILD_ROOT}/"$installdir"
+gzip -c -9 "$src"/t3c-proxy/t3c-proxy.1 > ${RPM_BUILD_ROOT}/"$mandir"/"$man1dir"/t3c-proxy.1.gz
+
 t3c_preprocess_src=src/github.com/apache/trafficcontrol/"$ccdir"/t3c-preprocess
 cp -p "$t3c_preprocess_src"/t3c-preprocess ${RPM_BUILD_ROOT}/"$installdir"
 gzip -c -9 "$src"/t3c-preprocess/t3c-preprocess.1 > ${RPM_BUILD_ROOT}/"$mandir"/"$man1dir"/t3c-preprocess.1.gz
@@ -219,21 +255,27 @@ fi
 /usr/bin/t3c
 /usr/bin/t3c-apply
 /usr/bin/t3c-check
+/usr/bin/t3c-check-config
 /usr/bin/t3c-check-refs
 /usr/bin/t3c-check-reload
+/usr/bin/t3c-daemon
 /usr/bin/t3c-diff
 /usr/bin/t3c-generate
 /usr/bin/t3c-preprocess
+/usr/bin/t3c-proxy
 /usr/bin/t3c-request
 /usr/bin/t3c-update
 /usr/share/man/man1/t3c.1.gz
 /usr/share/man/man1/t3c-apply.1.gz
 /usr/share/man/man1/t3c-check.1.gz
+/usr/share/man/man1/t3c-check-config.1.gz
 /usr/share/man/man1/t3c-check-refs.1.gz
 /usr/share/man/man1/t3c-check-reload.1.gz
+/usr/share/man/man1/t3c-daemon.1.gz
 /usr/share/man/man1/t3c-diff.1.gz
 /usr/share/man/man1/t3c-generate.1.gz
 /usr/share/man/man1/t3c-preprocess.1.gz
+/usr/share/man/man1/t3c-proxy.1.gz
 /usr/share/man/man1/t3c-request.1.gz
 /usr/share/man/man1/t3c-update.1.gz
 
@@ -88,6 +88,7 @@ type Cfg struct {
 	TOUser              string
 	TOPass              string
 	TOURL               string
+	TOProxyURL          string
 	DNSLocalBind        bool
 	WaitForParents      WaitForParentsFlag
 	YumOptions          string
@@ -105,6 +106,20 @@ type Cfg struct {
 	MaxMindLocation string
 	TsHome          string
 	TsConfigDir     string
+	// HealthCheckURL is a URL requested after config changes are applied, which must return a non-error response code for the config to be healthy.
+	// If empty, no URL is checked.
+	HealthCheckURL string
+	// HealthCheckCommand is a shell command run after config changes are applied, which must exit 0 for the config to be healthy.
+	// If empty, no command is run.
+	HealthCheckCommand string
+	// HealthCheckDelay is how long to wait after config changes are applied before running the health check, to give ATS time to load the new config.
+	HealthCheckDelay time.Duration
+	// HealthCheckTimeout is how long the health check is retried before the config is considered unhealthy.
+	HealthCheckTimeout time.Duration
+	// Rollback is whether to restore the previous config from the git repo, if an ATS reload or the health check fails.
+	Rollback bool
+	// OmitReport is whether to omit sending the report of the run to Traffic Ops.
+	OmitReport bool
 }
 
 type UseGitFlag string
@@ -215,6 +230,7 @@ func GetCfg() (Cfg, error) {
 	retriesPtr := getopt.IntLong("num-retries", 'r', 3, "[number] retry connection to Traffic Ops URL [number] times, default is 3")
 	revalWaitTimePtr := getopt.IntLong("reval-wait-time", 'T', 60, "[seconds] wait a random number of seconds between 0 and [seconds] before revlidation, default is 60")
 	reverseProxyDisablePtr := getopt.BoolLong("reverse-proxy-disable", 'p', "[false | true] bypass the reverse proxy even if one has been configured default is false")
+	toProxyURLPtr := getopt.StringLong("traffic-ops-proxy-url", 'x', "", "URL of a Traffic Ops proxy to get config data from, such as a t3c-proxy in the cache's cachegroup, instead of the GLOBAL Traffic Ops proxy parameter. If the proxy fails, Traffic Ops is used directly")
 	runModePtr := getopt.StringLong("run-mode", 'm', "report", "[badass | report | revalidate | syncds] run mode, default is 'report'")
 	skipOSCheckPtr := getopt.BoolLong("skip-os-check", 'O', "[false | true] skip os check, default is false")
 	toInsecurePtr := getopt.BoolLong("traffic-ops-insecure", 'I', "[true | false] ignore certificate errors from Traffic Ops")
@@ -233,6 +249,12 @@ func GetCfg() (Cfg, error) {
 	defaultEnableH2 := getopt.BoolLong("default-client-enable-h2", '2', "Whether to enable HTTP/2 on Delivery Services by default, if they have no explicit Parameter. This is irrelevant if ATS records.config is not serving H2. If omitted, H2 is disabled.")
 	defaultClientTLSVersions := getopt.StringLong("default-client-tls-versions", 'V', "", "Comma-delimited list of default TLS versions for Delivery Services with no Parameter, e.g. --default-tls-versions='1.1,1.2,1.3'. If omitted, all versions are enabled.")
 	maxmindLocationPtr := getopt.StringLong("maxmind-location", 'M', "", "URL of a maxmind gzipped database file, to be installed into the trafficserver etc directory.")
+	healthCheckURLPtr := getopt.StringLong("health-check-url", 'k', "", "URL to request after config changes are applied, such as a local ATS health or astats URL. If the response code isn't a success or redirect, the config is unhealthy. If omitted, no URL is checked.")
+	healthCheckCommandPtr := getopt.StringLong("health-check-command", 'K', "", "Shell command to run after config changes are applied, such as '/opt/trafficserver/bin/traffic_ctl server status'. If it doesn't exit 0, the config is unhealthy. If omitted, no command is run.")
+	healthCheckDelayPtr := getopt.IntLong("health-check-delay", 'y', 5, "[seconds] wait after config changes are applied before running the health check, to let ATS load the new config, default is 5")
+	healthCheckTimeoutPtr := getopt.IntLong("health-check-timeout", 'Y', 30, "[seconds] retry the health check until it succeeds or [seconds] have passed, default is 30")
+	omitReportPtr := getopt.BoolLong("omit-report", 'n', "Whether to omit sending a report of the run to Traffic Ops, with the config files and packages changed, whether ATS was reloaded or restarted, and any warnings and errors. Default false.")
+	rollbackPtr := getopt.BoolLong("rollback", 'z', "Whether to restore the previous config from the git repo in the config directory and reload again, if the ATS reload or health check fails. Requires git. Default false.")
 	verbosePtr := getopt.CounterLong("verbose", 'v', `Log verbosity. Logging is output to stderr. By default, errors are logged. To log warnings, pass '-v'. To log info, pass '-vv'. To omit error logging, see '-s'`)
 	silentPtr := getopt.BoolLong("silent", 's', `Silent. Errors are not logged, and the 'verbose' flag is ignored. If a fatal error occurs, the return code will be non-zero but no text will be output to stderr`)
 
@@ -300,6 +322,10 @@ func GetCfg() (Cfg, error) {
 		return Cfg{}, nil
 	}
 
+	if *rollbackPtr && useGit == UseGitNo {
+		return Cfg{}, errors.New("The rollback flag requires git, but the git flag is 'no'. Valid git options with rollback are yes and auto.")
+	}
+
 	runMode := t3cutil.StrToMode(*runModePtr)
 	if runMode == t3cutil.ModeInvalid {
 		return Cfg{}, errors.New(*runModePtr + " is an invalid mode.")
@@ -384,6 +410,7 @@ func GetCfg() (Cfg, error) {
 		Retries:                     retries,
 		RevalWaitTime:               revalWaitTime,
 		ReverseProxyDisable:         reverseProxyDisable,
+		TOProxyURL:                  *toProxyURLPtr,
 		RunMode:                     runMode,
 		SkipOSCheck:                 skipOsCheck,
 		TOInsecure:                  toInsecure,
@@ -403,6 +430,12 @@ func GetCfg() (Cfg, error) {
 		MaxMindLocation:             maxmindLocation,
 		TsHome:                      TSHome,
 		TsConfigDir:                 TSConfigDir,
+		HealthCheckURL:              *healthCheckURLPtr,
+		HealthCheckCommand:          *healthCheckCommandPtr,
+		HealthCheckDelay:            time.Second * time.Duration(*healthCheckDelayPtr),
+		HealthCheckTimeout:          time.Second * time.Duration(*healthCheckTimeoutPtr),
+		Rollback:                    *rollbackPtr,
+		OmitReport:                  *omitReportPtr,
 	}
 
 	if err = log.InitCfg(cfg); err != nil {
@@ -465,6 +498,7 @@ func printConfig(cfg Cfg) {
 	log.Debugf("Retries: %d\n", cfg.Retries)
 	log.Debugf("RevalWaitTime: %d\n", cfg.RevalWaitTime)
 	log.Debugf("ReverseProxyDisable: %t\n", cfg.ReverseProxyDisable)
+	log.Debugf("TOProxyURL: %s\n", cfg.TOProxyURL)
 	log.Debugf("RunMode: %s\n", cfg.RunMode)
 	log.Debugf("SkipOSCheck: %t\n", cfg.SkipOSCheck)
 	log.Debugf("TOInsecure: %t\n", cfg.TOInsecure)
@@ -476,6 +510,12 @@ func printConfig(cfg Cfg) {
 	log.Debugf("WaitForParents: %v\n", cfg.WaitForParents)
 	log.Debugf("YumOptions: %s\n", cfg.YumOptions)
 	log.Debugf("MaxmindLocation: %s\n", cfg.MaxMindLocation)
+	log.Debugf("HealthCheckURL: %s\n", cfg.HealthCheckURL)
+	log.Debugf("HealthCheckCommand: %s\n", cfg.HealthCheckCommand)
+	log.Debugf("HealthCheckDelay: %d\n", cfg.HealthCheckDelay)
+	log.Debugf("HealthCheckTimeout: %d\n", cfg.HealthCheckTimeout)
+	log.Debugf("Rollback: %t\n", cfg.Rollback)
+	log.Debugf("OmitReport: %t\n", cfg.OmitReport)
 }
 
 func Usage() {
@@ -43,6 +43,7 @@ const (
 	ServicesError     = 138
 	SyncDSError       = 139
 	UserCheckError    = 140
+	HealthCheckError  = 141
 )
 
 func runSysctl(cfg config.Cfg) {
@@ -120,19 +121,18 @@ func main() {
 	// necessary to continue
 	if cfg.RunMode == t3cutil.ModeRevalidate {
 		syncdsUpdate, err = trops.CheckRevalidateState(false)
-		if err != nil || syncdsUpdate == torequest.UpdateTropsNotNeeded {
-			if err != nil {
-				log.Errorln("Checking revalidate state: " + err.Error())
-			} else {
-				log.Infoln("Checking revalidate state: returned UpdateTropsNotNeeded")
-			}
+		if err != nil {
+			trops.ReportErrorf("Checking revalidate state: %s", err)
+			ReportAndExit(RevalidationError, trops, cfg)
+		} else if syncdsUpdate == torequest.UpdateTropsNotNeeded {
+			log.Infoln("Checking revalidate state: returned UpdateTropsNotNeeded")
 			GitCommitAndExit(RevalidationError, cfg)
 		}
 	} else {
 		syncdsUpdate, err = trops.CheckSyncDSState()
 		if err != nil {
-			log.Errorln(err)
-			GitCommitAndExit(SyncDSError, cfg)
+			trops.ReportErrorf("%s", err)
+			ReportAndExit(SyncDSError, trops, cfg)
 		}
 		if cfg.RunMode == t3cutil.ModeSyncDS && syncdsUpdate == torequest.UpdateTropsNotNeeded {
 			// check for maxmind db updates even if we have no other updates
@@ -147,34 +147,44 @@ func main() {
 		log.Infoln("======== Start processing packages  ========")
 		err = trops.ProcessPackages()
 		if err != nil {
-			log.Errorf("Error processing packages: %s\n", err)
-			GitCommitAndExit(PackagingError, cfg)
+			trops.ReportErrorf("Error processing packages: %s", err)
+			ReportAndExit(PackagingError, trops, cfg)
 		}
 
 		// check and make sure packages are enabled for startup
 		err = trops.CheckSystemServices()
 		if err != nil {
-			log.Errorf("Error verifying system services: %s\n", err.Error())
-			GitCommitAndExit(ServicesError, cfg)
+			trops.ReportErrorf("Error verifying system services: %s", err)
+			ReportAndExit(ServicesError, trops, cfg)
 		}
 	}
 
 	log.Debugf("Preparing to fetch the config files for %s, cfg.RunMode: %s, syncdsUpdate: %s\n", cfg.CacheHostName, cfg.RunMode, syncdsUpdate)
 	err = trops.GetConfigFileList()
 	if err != nil {
-		log.Errorf("Unable to continue: %s\n", err)
-		GitCommitAndExit(ConfigFilesError, cfg)
+		trops.ReportErrorf("Unable to continue: %s", err)
+		ReportAndExit(ConfigFilesError, trops, cfg)
 	}
+
+	// the commit of the config before any changes are applied, to roll back to if applying them fails.
+	rollbackCommit := ""
+	if cfg.Rollback && cfg.RunMode != t3cutil.ModeReport {
+		rollbackCommit, err = util.GetGitHead(config.TSConfigDir)
+		if err != nil {
+			trops.ReportErrorf("getting git commit of config directory '%s', config changes will not be rolled back on failure! : %s", config.TSConfigDir, err)
+		}
+	}
+
 	syncdsUpdate, err = trops.ProcessConfigFiles()
 	if err != nil {
-		log.Errorf("Error while processing config files: %s\n", err.Error())
+		trops.ReportErrorf("Error while processing config files: %s", err)
 	}
 
 	if trops.RemapConfigReload == true {
 		cfg, ok := trops.GetConfigFile("remap.config")
 		_, rc, err := util.ExecCommand("/usr/bin/touch", cfg.Path)
 		if err != nil {
-			log.Errorf("failed to update the remap.config for reloading: %s\n", err.Error())
+			trops.ReportErrorf("failed to update the remap.config for reloading: %s", err)
 		} else if rc == 0 && ok == true {
 			log.Infoln("updated the remap.config for reloading.")
 		}
@@ -184,8 +194,13 @@ func main() {
 	CheckMaxmindUpdate(cfg)
 
 	if err := trops.StartServices(&syncdsUpdate); err != nil {
-		log.Errorln("failed to start services: " + err.Error())
-		GitCommitAndExit(ServicesError, cfg)
+		trops.ReportErrorf("failed to start services: %s", err)
+		RollbackAndExit(ServicesError, rollbackCommit, trops, cfg)
+	}
+
+	if err := trops.CheckHealth(); err != nil {
+		trops.ReportErrorf("health check failed after applying config: %s", err)
+		RollbackAndExit(HealthCheckError, rollbackCommit, trops, cfg)
 	}
 
 	// start 'teakd' if installed.
@@ -213,12 +228,12 @@ func main() {
 	// update Traffic Ops
 	result, err := trops.UpdateTrafficOps(&syncdsUpdate)
 	if err != nil {
-		log.Errorf("failed to update Traffic Ops: %s\n", err.Error())
+		trops.ReportErrorf("failed to update Traffic Ops: %s", err)
 	} else if result {
 		log.Infoln("Traffic Ops has been updated.")
 	}
 
-	GitCommitAndExit(Success, cfg)
+	ReportAndExit(Success, trops, cfg)
 }
 
 // TODO change code to always create git commits, if the dir is a repo
@@ -236,6 +251,43 @@ func GitCommitAndExit(exitCode int, cfg config.Cfg) {
 	os.Exit(exitCode)
 }
 
+// ReportAndExit sends the report of the run to Traffic Ops, logs any error, and calls GitCommitAndExit with the given code.
+// The run is reported as successful if the exit code is Success.
+func ReportAndExit(exitCode int, trops *torequest.TrafficOpsReq, cfg config.Cfg) {
+	if err := trops.SendReport(exitCode == Success); err != nil {
+		log.Errorln("failed to send the run report to Traffic Ops: " + err.Error())
+	}
+	GitCommitAndExit(exitCode, cfg)
+}
+
+// RollbackAndExit restores the config directory to the given git commit and reloads or restarts ATS again,
+// then calls ReportAndExit with the given code.
+// Traffic Ops is not updated, so the server's update and revalidate pending flags stay set, and the next run will try to apply the update again.
+// If the commit is empty, because rollback is disabled or the commit couldn't be found, nothing is rolled back.
+func RollbackAndExit(exitCode int, commit string, trops *torequest.TrafficOpsReq, cfg config.Cfg) {
+	if commit == "" {
+		trops.ReportErrorf("not rolling back config, Traffic Ops update and revalidate pending flags will not be cleared")
+		ReportAndExit(exitCode, trops, cfg)
+	}
+
+	trops.ReportErrorf("rolling back config directory '%s' to git commit '%s'", config.TSConfigDir, commit)
+	if err := util.MakeGitRollback(config.TSConfigDir, commit, cfg.RunMode); err != nil {
+		trops.ReportErrorf("rolling back config failed, config may be broken! : %s", err)
+		ReportAndExit(exitCode, trops, cfg)
+	}
+
+	// The rolled back files are the same files that were changed, so they need the same reload or restart.
+	rollbackUpdate := torequest.UpdateTropsNotNeeded
+	if err := trops.StartServices(&rollbackUpdate); err != nil {
+		trops.ReportErrorf("failed to start services after rolling back config: %s", err)
+	} else if err := trops.CheckHealth(); err != nil {
+		trops.ReportErrorf("health check failed after rolling back config: %s", err)
+	} else {
+		log.Infoln("rolled back config successfully, Traffic Ops update and revalidate pending flags will not be cleared")
+	}
+	ReportAndExit(exitCode, trops, cfg)
+}
+
 // CheckMaxmindUpdate will (if a url is set) check for a db on disk.
 // If it exists, issue an IMS to determine if it needs to update the db.
 // If no file or if an update is needed to be done it is downloaded and unpacked.
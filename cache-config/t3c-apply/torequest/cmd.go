@@ -252,13 +252,58 @@ func sendUpdate(cfg config.Cfg, updateStatus bool, revalStatus bool) error {
 	return nil
 }
 
-// diff calls t3c-diff to diff the given new file and the file on disk. Returns whether they're different.
+// sendReport calls t3c-update to send the given run report to Traffic Ops.
+func sendReport(cfg config.Cfg, report tc.ServerConfigReportRequest) error {
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return errors.New("marshalling report: " + err.Error())
+	}
+
+	args := []string{
+		"--traffic-ops-timeout-milliseconds=" + strconv.FormatInt(int64(cfg.TOTimeoutMS), 10),
+		"--traffic-ops-insecure=" + strconv.FormatBool(cfg.TOInsecure),
+		"--cache-host-name=" + cfg.CacheHostName,
+		"--send-report",
+	}
+
+	if cfg.LogLocationErr == log.LogLocationNull {
+		args = append(args, "-s")
+	}
+	if cfg.LogLocationWarn != log.LogLocationNull {
+		args = append(args, "-v")
+	}
+	if cfg.LogLocationInfo != log.LogLocationNull {
+		args = append(args, "-v")
+	}
+
+	if _, used := os.LookupEnv("TO_USER"); !used {
+		args = append(args, "--traffic-ops-user="+cfg.TOUser)
+	}
+	if _, used := os.LookupEnv("TO_PASS"); !used {
+		args = append(args, "--traffic-ops-password="+cfg.TOPass)
+	}
+	if _, used := os.LookupEnv("TO_URL"); !used {
+		args = append(args, "--traffic-ops-url="+cfg.TOURL)
+	}
+	stdOut, stdErr, code := t3cutil.DoInput(reportJSON, `t3c-update`, args...)
+	if code != 0 {
+		return fmt.Errorf("t3c-update returned non-zero exit code %v stdout '%v' stderr '%v'", code, string(stdOut), string(stdErr))
+	}
+	if len(bytes.TrimSpace(stdErr)) > 0 {
+		log.Warnf("t3c-update returned code 0 but stderr '%v'", string(stdErr)) // usually warnings
+	}
+	return nil
+}
+
+// diff calls t3c-diff to diff the given new file and the file on disk. Returns whether they're different, and the difference text.
 // Logs the difference.
 // If the file on disk doesn't exist, returns true and logs the entire file as a diff.
-func diff(cfg config.Cfg, newFile []byte, fileLocation string) (bool, error) {
+//
+// The diff is semantic for the file type, e.g. reordered records.config records aren't a diff, so such files aren't replaced and don't cause reloads.
+func diff(cfg config.Cfg, newFile []byte, fileLocation string) (bool, string, error) {
 	stdOut, stdErr, code := t3cutil.DoInput(newFile, `t3c-diff`, `stdin`, fileLocation)
 	if code > 1 {
-		return false, fmt.Errorf("t3c-diff returned error code %v stdout '%v' stderr '%v'", code, string(stdOut), string(stdErr))
+		return false, "", fmt.Errorf("t3c-diff returned error code %v stdout '%v' stderr '%v'", code, string(stdOut), string(stdErr))
 	}
 	if len(bytes.TrimSpace(stdErr)) > 0 {
 		log.Warnf("t3c-diff returned non-error code %v but stderr '%v'", code, string(stdErr))
@@ -266,7 +311,7 @@ func diff(cfg config.Cfg, newFile []byte, fileLocation string) (bool, error) {
 
 	if code == 0 {
 		log.Infof("All lines match TrOps for config file: %s\n", fileLocation)
-		return false, nil // 0 is only returned if there's no diff
+		return false, "", nil // 0 is only returned if there's no diff
 	}
 	// code 1 means a diff, difference text will be on stdout
 
@@ -277,7 +322,7 @@ func diff(cfg config.Cfg, newFile []byte, fileLocation string) (bool, error) {
 	}
 	log.Infoln("file '" + fileLocation + "' changes end")
 
-	return true, nil
+	return true, string(stdOut), nil
 }
 
 // checkRefs calls t3c-check-refs to verify the given cfgFile.
@@ -319,6 +364,65 @@ func checkRefs(cfg config.Cfg, cfgFile []byte, filesAdding []string) error {
 	return nil
 }
 
+// configProblem is a problem found in a config file by t3c-check-config.
+type configProblem struct {
+	// File is the name of the config file.
+	File string
+	// IsError is whether the problem is an error, which would make ATS reject or ignore the file, rather than a warning.
+	IsError bool
+	// Text is the full problem text, as output by t3c-check-config, including the file and line.
+	Text string
+}
+
+// checkConfig calls t3c-check-config to check the given config files for syntax and schema errors.
+// The files should be all the config files being applied, so references between them can be checked.
+// Returns the problems found, or an error if t3c-check-config failed to check the files.
+func checkConfig(cfg config.Cfg, files []t3cutil.ATSConfigFile) ([]configProblem, error) {
+	filesJSON, err := json.Marshal(files)
+	if err != nil {
+		return nil, errors.New("marshalling config files: " + err.Error())
+	}
+
+	args := []string{`check`, `config`, "--trafficserver-config-dir=" + cfg.TsConfigDir}
+	if cfg.LogLocationErr == log.LogLocationNull {
+		args = append(args, "-s")
+	}
+	if cfg.LogLocationWarn != log.LogLocationNull {
+		args = append(args, "-v")
+	}
+	if cfg.LogLocationInfo != log.LogLocationNull {
+		args = append(args, "-v")
+	}
+
+	stdOut, stdErr, code := t3cutil.DoInput(filesJSON, `t3c`, args...)
+	if code != 0 && code != 1 { // 1 means problems were found, which are on stdout
+		return nil, fmt.Errorf("t3c-check-config returned error code %v stdout '%v' stderr '%v'", code, string(stdOut), string(stdErr))
+	}
+
+	problems := []configProblem{}
+	for _, line := range strings.Split(string(stdOut), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// lines are 'file:line: severity: message', or 'file: severity: message' if the problem isn't on a line.
+		fields := strings.SplitN(line, ": ", 3)
+		if len(fields) != 3 {
+			log.Warnf("t3c-check-config returned malformed problem '%v'", line)
+			continue
+		}
+		problems = append(problems, configProblem{
+			File:    strings.SplitN(fields[0], ":", 2)[0],
+			IsError: fields[1] == "error",
+			Text:    line,
+		})
+	}
+	if code == 1 && len(problems) == 0 {
+		return nil, fmt.Errorf("t3c-check-config returned error code %v but no problems, stderr '%v'", code, string(stdErr))
+	}
+	return problems, nil
+}
+
 // checkReload is a helper for the sub-command t3c-check-reload.
 func checkReload(mode t3cutil.Mode, pluginPackagesInstalled []string, changedConfigFiles []string) (t3cutil.ServiceNeeds, error) {
 	log.Infof("t3c-check-reload calling with mode '%v' pluginPackagesInstalled '%v' changedConfigFiles '%v'\n", mode, pluginPackagesInstalled, changedConfigFiles)
@@ -373,6 +477,15 @@ func request(cfg config.Cfg, command string) ([]byte, error) {
 		`--get-data=` + command,
 	}
 
+	if command == "config" {
+		if cfg.ReverseProxyDisable {
+			args = append(args, "--traffic-ops-disable-proxy")
+		}
+		if cfg.TOProxyURL != "" {
+			args = append(args, "--traffic-ops-proxy-url="+cfg.TOProxyURL)
+		}
+	}
+
 	if cfg.LogLocationErr == log.LogLocationNull {
 		args = append(args, "-s")
 	}
@@ -22,11 +22,14 @@ package torequest
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -70,6 +73,13 @@ type TrafficOpsReq struct {
 	TrafficServerRestart bool   // a trafficserver restart is required
 	RemapConfigReload    bool   // remap.config should be reloaded
 	unixTimeStr          string // unix time string at program startup.
+
+	startTime      time.Time                      // time at program startup.
+	reloaded       bool                           // trafficserver was reloaded
+	restarted      bool                           // trafficserver was restarted or started
+	reportPkgs     []tc.ServerConfigReportPackage // packages installed or removed, for the run report
+	reportWarnings []string                       // warnings for the run report
+	reportErrors   []string                       // errors for the run report
 }
 
 type ConfigFile struct {
@@ -86,6 +96,7 @@ type ConfigFile struct {
 	PreReqFailed      bool   // failed plugin prerequiste check
 	RemapPluginConfig bool   // file is a remap plugin config file
 	Body              []byte
+	Diff              string      // start of the diff of the file on disk and the new file, for the run report
 	Perm              os.FileMode // default file permissions
 	Uid               int         // owner uid, default is 0
 	Gid               int         // owner gid, default is 0
@@ -168,7 +179,8 @@ func (r *TrafficOpsReq) DumpConfigFiles() {
 
 // NewTrafficOpsReq returns a new TrafficOpsReq object.
 func NewTrafficOpsReq(cfg config.Cfg) *TrafficOpsReq {
-	unixTimeString := strconv.FormatInt(time.Now().Unix(), 10)
+	startTime := time.Now()
+	unixTimeString := strconv.FormatInt(startTime.Unix(), 10)
 
 	return &TrafficOpsReq{
 		Cfg:           cfg,
@@ -178,6 +190,7 @@ func NewTrafficOpsReq(cfg config.Cfg) *TrafficOpsReq {
 		installedPkgs: map[string]struct{}{},
 		pluginPkgs:    map[string]struct{}{},
 		unixTimeStr:   unixTimeString,
+		startTime:     startTime,
 	}
 }
 
@@ -218,11 +231,12 @@ func (r *TrafficOpsReq) checkConfigFile(cfg *ConfigFile, filesAdding []string) e
 		log.Infoln("Successfully verified plugins used by '" + cfg.Name + "'")
 	}
 
-	changeNeeded, err := diff(r.Cfg, cfg.Body, cfg.Path)
+	changeNeeded, diffStr, err := diff(r.Cfg, cfg.Body, cfg.Path)
 	if err != nil {
 		return errors.New("getting diff: " + err.Error())
 	}
 	cfg.ChangeNeeded = changeNeeded
+	cfg.Diff = shortDiff(diffStr)
 	cfg.AuditComplete = true
 
 	if cfg.Name == "50-ats.rules" {
@@ -830,6 +844,44 @@ func (r *TrafficOpsReq) CheckSyncDSState() (UpdateStatus, error) {
 	return updateStatus, nil
 }
 
+// checkConfigFiles checks the syntax of the config files with t3c-check-config,
+// and marks changed files with errors as failing their audit, so they aren't applied.
+// Returns whether any changed file has errors, in which case the update failed.
+// Problems in files which aren't changing are only logged, because they're already on disk.
+// If t3c-check-config fails to run, files are applied without being checked.
+func (r *TrafficOpsReq) checkConfigFiles() bool {
+	files := []t3cutil.ATSConfigFile{}
+	for _, cfg := range r.configFiles {
+		files = append(files, t3cutil.ATSConfigFile{Name: cfg.Name, Path: cfg.Dir, Text: string(cfg.Body)})
+	}
+	sort.Sort(t3cutil.ATSConfigFiles(files))
+
+	problems, err := checkConfig(r.Cfg, files)
+	if err != nil {
+		r.ReportErrorf("checking config files, applying without checking: %s", err)
+		return false
+	}
+	failed := false
+	for _, problem := range problems {
+		cfg, ok := r.configFiles[problem.File]
+		if !ok || !cfg.ChangeNeeded {
+			log.Infof("config check of unchanged file: %s\n", problem.Text)
+			continue
+		}
+		if !problem.IsError {
+			r.ReportWarnf("config check: %s", problem.Text)
+			continue
+		}
+		r.ReportErrorf("config check: %s", problem.Text)
+		failed = true
+		if !cfg.AuditFailed {
+			cfg.AuditFailed = true
+			r.ReportErrorf("%s has errors, not replacing it", cfg.Name)
+		}
+	}
+	return failed
+}
+
 // ProcessConfigFiles processes all config files retrieved from Traffic Ops.
 func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 	var updateStatus UpdateStatus = UpdateTropsNotNeeded
@@ -846,7 +898,7 @@ func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 		if strings.Contains(cfg.Path, "/opt/trafficserver/") || strings.Contains(cfg.Dir, "udev") {
 			cfg.Service = "trafficserver"
 			if r.Cfg.RunMode == t3cutil.ModeSyncDS && !r.IsPackageInstalled("trafficserver") {
-				log.Errorln("In syncds mode, but trafficserver isn't installed. Continuing.")
+				r.ReportErrorf("In syncds mode, but trafficserver isn't installed. Continuing.")
 			}
 		} else if strings.Contains(cfg.Path, "/opt/ort") && strings.Contains(cfg.Name, "12M_facts") {
 			cfg.Service = "puppet"
@@ -862,10 +914,14 @@ func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 
 		err := r.checkConfigFile(cfg, filesAdding)
 		if err != nil {
-			log.Errorln(err)
+			r.ReportErrorf("%s", err)
 		}
 	}
 
+	if r.checkConfigFiles() {
+		updateStatus = UpdateTropsFailed
+	}
+
 	changesRequired := 0
 
 	for _, cfg := range r.configFiles {
@@ -876,22 +932,22 @@ func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 			!cfg.AuditFailed {
 
 			changesRequired++
-			if cfg.Name == "plugin.config" && r.configFiles["remap.config"].PreReqFailed == true {
+			if cfg.Name == "plugin.config" && (r.configFiles["remap.config"].PreReqFailed || r.configFiles["remap.config"].AuditFailed) {
 				updateStatus = UpdateTropsFailed
-				log.Errorln("plugin.config changed however, prereqs failed for remap.config so I am skipping updates for plugin.config")
+				r.ReportErrorf("plugin.config changed however, prereqs or audit failed for remap.config so I am skipping updates for plugin.config")
 				continue
-			} else if cfg.Name == "remap.config" && r.configFiles["plugin.config"].PreReqFailed == true {
+			} else if cfg.Name == "remap.config" && (r.configFiles["plugin.config"].PreReqFailed || r.configFiles["plugin.config"].AuditFailed) {
 				updateStatus = UpdateTropsFailed
-				log.Errorln("remap.config changed however, prereqs failed for plugin.config so I am skipping updates for remap.config")
+				r.ReportErrorf("remap.config changed however, prereqs or audit failed for plugin.config so I am skipping updates for remap.config")
 				continue
 			} else if cfg.Name == "ip_allow.config" && !r.Cfg.SyncDSUpdatesIPAllow && r.Cfg.RunMode == t3cutil.ModeSyncDS {
-				log.Warnln("ip_allow.config changed, not updating! Run with --mode=badass or --syncds-updates-ipallow=true to update!")
+				r.ReportWarnf("ip_allow.config changed, not updating! Run with --mode=badass or --syncds-updates-ipallow=true to update!")
 				continue
 			} else {
 				log.Debugf("All Prereqs passed for replacing %s on disk with that in Traffic Ops.\n", cfg.Name)
 				err := r.replaceCfgFile(cfg)
 				if err != nil {
-					log.Errorf("failed to replace the config file, '%s',  on disk with data in Traffic Ops.\n", cfg.Name)
+					r.ReportErrorf("failed to replace the config file, '%s',  on disk with data in Traffic Ops: %s", cfg.Name, err)
 				}
 			}
 		}
@@ -1017,10 +1073,11 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 			if len(install) > 0 && r.Cfg.RunMode == t3cutil.ModeBadAss {
 				for jj := range uninstall {
 					log.Infof("Uninstalling %s\n", install[jj])
-					r, err := util.PackageAction("remove", uninstall[jj])
+					result, err := util.PackageAction("remove", uninstall[jj])
 					if err != nil {
 						return errors.New("Unable to uninstall " + uninstall[jj] + " : " + err.Error())
-					} else if r == true {
+					} else if result == true {
+						r.reportPkgs = append(r.reportPkgs, tc.ServerConfigReportPackage{Name: uninstall[jj], Action: tc.ServerConfigReportPackageRemoved})
 						log.Infof("Package %s was uninstalled\n", uninstall[jj])
 					}
 				}
@@ -1035,6 +1092,7 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 					} else if result == true {
 						r.pkgs[pkg] = true
 						r.installedPkgs[pkg] = struct{}{}
+						r.reportPkgs = append(r.reportPkgs, tc.ServerConfigReportPackage{Name: pkg, Action: tc.ServerConfigReportPackageInstalled})
 						log.Infof("Package %s was installed\n", pkg)
 					}
 				}
@@ -1113,6 +1171,7 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 		if _, err := util.ServiceStart("trafficserver", startStr); err != nil {
 			return errors.New("failed to restart trafficserver")
 		}
+		r.restarted = true
 		log.Infoln("trafficserver has been " + startStr + "ed")
 		if *syncdsUpdate == UpdateTropsNeeded {
 			*syncdsUpdate = UpdateTropsSuccessful
@@ -1144,6 +1203,7 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 			if *syncdsUpdate == UpdateTropsNeeded {
 				*syncdsUpdate = UpdateTropsSuccessful
 			}
+			r.reloaded = true
 			log.Infoln("ATS 'traffic_ctl config reload' was successful")
 		}
 		if *syncdsUpdate == UpdateTropsNeeded {
@@ -1154,6 +1214,66 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 	return errors.New("Unknown run mode '" + r.Cfg.RunMode.String() + "'! Not reloading or restarting!") // should never happen
 }
 
+// healthCheckInterval is how long to wait between retries of a failed health check.
+const healthCheckInterval = time.Second
+
+// CheckHealth runs the configured health check URL and command after config changes were applied.
+// The health check is retried until it succeeds, or the configured health check timeout passes.
+// Returns nil if the health check succeeded, or if no config files were changed or no health check is configured.
+func (r *TrafficOpsReq) CheckHealth() error {
+	if r.Cfg.HealthCheckURL == "" && r.Cfg.HealthCheckCommand == "" {
+		return nil
+	}
+	if len(r.changedFiles) == 0 {
+		log.Infoln("no config files were changed, not running health check")
+		return nil
+	}
+
+	log.Infof("waiting %v for ATS to load the new config before running health check\n", r.Cfg.HealthCheckDelay)
+	time.Sleep(r.Cfg.HealthCheckDelay)
+
+	deadline := time.Now().Add(r.Cfg.HealthCheckTimeout)
+	for {
+		err := checkHealth(r.Cfg)
+		if err == nil {
+			log.Infoln("health check succeeded")
+			return nil
+		}
+		if time.Now().Add(healthCheckInterval).After(deadline) {
+			return err
+		}
+		log.Warnln("health check failed, retrying: " + err.Error())
+		time.Sleep(healthCheckInterval)
+	}
+}
+
+// checkHealth runs the health check URL and command once, returning nil if both succeeded.
+func checkHealth(cfg config.Cfg) error {
+	if cfg.HealthCheckURL != "" {
+		client := &http.Client{Timeout: cfg.HealthCheckTimeout}
+		resp, err := client.Get(cfg.HealthCheckURL)
+		if err != nil {
+			return errors.New("requesting health check URL '" + cfg.HealthCheckURL + "': " + err.Error())
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 399 {
+			return errors.New("health check URL '" + cfg.HealthCheckURL + "' returned code " + strconv.Itoa(resp.StatusCode))
+		}
+	}
+	if cfg.HealthCheckCommand != "" {
+		output, rc, err := util.ExecCommand("/bin/sh", "-c", cfg.HealthCheckCommand)
+		if err != nil || rc != 0 {
+			errStr := ""
+			if err != nil {
+				errStr = ": " + err.Error()
+			}
+			return errors.New("health check command '" + cfg.HealthCheckCommand + "' returned code " + strconv.Itoa(rc) + " output '" + strings.TrimSpace(string(output)) + "'" + errStr)
+		}
+	}
+	return nil
+}
+
 func (r *TrafficOpsReq) getPluginPackagesInstalled() []string {
 	installedPluginPkgs := []string{}
 	for pluginPkg, _ := range r.pluginPkgs {
@@ -1217,3 +1337,91 @@ func (r *TrafficOpsReq) UpdateTrafficOps(syncdsUpdate *UpdateStatus) (bool, erro
 	log.Errorln("Traffic Ops has been updated.")
 	return true, nil
 }
+
+// reportDiffMaxLines is the maximum number of lines of each config file diff included in the run report.
+const reportDiffMaxLines = 40
+
+// reportDiffMaxBytes is the maximum size of each config file diff included in the run report.
+const reportDiffMaxBytes = 4096
+
+// shortDiff returns the start of the given diff, truncated to fit in the run report.
+func shortDiff(diff string) string {
+	lines := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	truncated := false
+	if len(lines) > reportDiffMaxLines {
+		lines = lines[:reportDiffMaxLines]
+		truncated = true
+	}
+	short := strings.Join(lines, "\n")
+	if len(short) > reportDiffMaxBytes {
+		short = short[:reportDiffMaxBytes]
+		truncated = true
+	}
+	if truncated {
+		short += "\n... (truncated)"
+	}
+	return short
+}
+
+// ReportErrorf logs the given error, and adds it to the run report.
+func (r *TrafficOpsReq) ReportErrorf(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	log.Errorln(msg)
+	r.reportErrors = append(r.reportErrors, msg)
+}
+
+// ReportWarnf logs the given warning, and adds it to the run report.
+func (r *TrafficOpsReq) ReportWarnf(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	log.Warnln(msg)
+	r.reportWarnings = append(r.reportWarnings, msg)
+}
+
+// Report returns the report of this run, to be sent to Traffic Ops.
+// The success is whether the run succeeded, which is determined by the caller.
+func (r *TrafficOpsReq) Report(success bool) tc.ServerConfigReportRequest {
+	files := []tc.ServerConfigReportFile{}
+	for _, cfg := range r.configFiles {
+		if !cfg.ChangeNeeded {
+			continue
+		}
+		files = append(files, tc.ServerConfigReportFile{
+			Name:    cfg.Name,
+			Path:    cfg.Path,
+			Applied: cfg.ChangeApplied,
+			Diff:    cfg.Diff,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	pkgs := append([]tc.ServerConfigReportPackage{}, r.reportPkgs...)
+	warnings := append([]string{}, r.reportWarnings...)
+	errs := append([]string{}, r.reportErrors...)
+
+	return tc.ServerConfigReportRequest{
+		HostName:   r.Cfg.CacheHostName,
+		Mode:       r.Cfg.RunMode.String(),
+		Success:    success,
+		StartTime:  r.startTime,
+		DurationMS: int64(time.Since(r.startTime) / time.Millisecond),
+		Reloaded:   r.reloaded,
+		Restarted:  r.restarted,
+		Files:      files,
+		Packages:   pkgs,
+		Warnings:   warnings,
+		Errors:     errs,
+	}
+}
+
+// SendReport sends the report of this run to Traffic Ops, unless reports are disabled.
+func (r *TrafficOpsReq) SendReport(success bool) error {
+	if r.Cfg.OmitReport {
+		log.Infoln("omit-report is set, not sending the run report to Traffic Ops")
+		return nil
+	}
+	if err := sendReport(r.Cfg, r.Report(success)); err != nil {
+		return errors.New("sending report: " + err.Error())
+	}
+	log.Infoln("sent the run report to Traffic Ops")
+	return nil
+}
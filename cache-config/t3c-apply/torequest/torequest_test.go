@@ -20,10 +20,14 @@ package torequest
  */
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
 	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-tc"
 )
 
 var testCfg config.Cfg = config.Cfg{
@@ -141,3 +145,124 @@ func TestGetConfigFile(t *testing.T) {
 		t.Errorf("GetConfigFile('remap.config') failed, expected 'remap.config' got '" + cfg.Name + "'.")
 	}
 }
+
+func TestCheckHealth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthy" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	trops := NewTrafficOpsReq(testCfg)
+	trops.Cfg.HealthCheckURL = srv.URL + "/unhealthy"
+	if err := trops.CheckHealth(); err != nil {
+		t.Errorf("CheckHealth() with no changed files expected nil, actual '%v'", err)
+	}
+
+	trops.changedFiles = []string{"/tmp/trafficserver/remap.config"}
+
+	tests := []struct {
+		url     string
+		command string
+		healthy bool
+	}{
+		{url: srv.URL + "/healthy", healthy: true},
+		{url: srv.URL + "/unhealthy", healthy: false},
+		{command: "exit 0", healthy: true},
+		{command: "exit 1", healthy: false},
+		{url: srv.URL + "/healthy", command: "exit 1", healthy: false},
+	}
+	for _, test := range tests {
+		trops.Cfg.HealthCheckURL = test.url
+		trops.Cfg.HealthCheckCommand = test.command
+		err := trops.CheckHealth()
+		if test.healthy && err != nil {
+			t.Errorf("CheckHealth() url '%v' command '%v' expected healthy, actual '%v'", test.url, test.command, err)
+		} else if !test.healthy && err == nil {
+			t.Errorf("CheckHealth() url '%v' command '%v' expected unhealthy, actual healthy", test.url, test.command)
+		}
+	}
+}
+
+func TestShortDiff(t *testing.T) {
+	diff := "-foo\n+bar\n"
+	if short := shortDiff(diff); short != "-foo\n+bar" {
+		t.Errorf("shortDiff() of short diff expected '-foo\\n+bar', actual '%v'", short)
+	}
+
+	longDiff := strings.Repeat("+line\n", reportDiffMaxLines+10)
+	short := shortDiff(longDiff)
+	if lines := strings.Split(short, "\n"); len(lines) != reportDiffMaxLines+1 {
+		t.Errorf("shortDiff() of long diff expected %v lines and a truncated line, actual %v lines", reportDiffMaxLines, len(lines))
+	}
+	if !strings.HasSuffix(short, "(truncated)") {
+		t.Errorf("shortDiff() of long diff expected truncated suffix, actual '%v'", short)
+	}
+
+	wideDiff := "+" + strings.Repeat("x", reportDiffMaxBytes*2)
+	if short := shortDiff(wideDiff); len(short) > reportDiffMaxBytes+len("\n... (truncated)") {
+		t.Errorf("shortDiff() of wide diff expected at most %v bytes, actual %v", reportDiffMaxBytes, len(short))
+	}
+}
+
+func TestReport(t *testing.T) {
+	trops := NewTrafficOpsReq(testCfg)
+	trops.configFiles["remap.config"] = &ConfigFile{
+		Name:          "remap.config",
+		Path:          "/opt/trafficserver/etc/trafficserver/remap.config",
+		ChangeNeeded:  true,
+		ChangeApplied: true,
+		Diff:          "+map http://foo/ http://bar/",
+	}
+	trops.configFiles["ip_allow.config"] = &ConfigFile{
+		Name:         "ip_allow.config",
+		Path:         "/opt/trafficserver/etc/trafficserver/ip_allow.config",
+		ChangeNeeded: true,
+		Diff:         "+src_ip=127.0.0.1 action=ip_allow method=ALL",
+	}
+	trops.configFiles["records.config"] = &ConfigFile{
+		Name: "records.config",
+		Path: "/opt/trafficserver/etc/trafficserver/records.config",
+	}
+	trops.reportPkgs = append(trops.reportPkgs, tc.ServerConfigReportPackage{Name: "trafficserver-9.0.0", Action: tc.ServerConfigReportPackageInstalled})
+	trops.reloaded = true
+	trops.ReportWarnf("warning %d", 1)
+	trops.ReportErrorf("error %d", 1)
+
+	report := trops.Report(true)
+	if report.HostName != testCfg.CacheHostName {
+		t.Errorf("Report() expected host name '%v', actual '%v'", testCfg.CacheHostName, report.HostName)
+	}
+	if report.Mode != testCfg.RunMode.String() {
+		t.Errorf("Report() expected mode '%v', actual '%v'", testCfg.RunMode.String(), report.Mode)
+	}
+	if !report.Success || !report.Reloaded || report.Restarted {
+		t.Errorf("Report() expected success and reloaded and not restarted, actual success %v reloaded %v restarted %v", report.Success, report.Reloaded, report.Restarted)
+	}
+	if err := report.Validate(nil); err != nil {
+		t.Errorf("Report() expected valid report, actual '%v'", err)
+	}
+
+	if len(report.Files) != 2 {
+		t.Fatalf("Report() expected 2 changed files, actual %+v", report.Files)
+	}
+	if report.Files[0].Name != "ip_allow.config" || report.Files[0].Applied {
+		t.Errorf("Report() expected first file ip_allow.config not applied, actual %+v", report.Files[0])
+	}
+	if report.Files[1].Name != "remap.config" || !report.Files[1].Applied || report.Files[1].Diff != "+map http://foo/ http://bar/" {
+		t.Errorf("Report() expected second file remap.config applied with diff, actual %+v", report.Files[1])
+	}
+
+	if len(report.Packages) != 1 || report.Packages[0].Name != "trafficserver-9.0.0" {
+		t.Errorf("Report() expected installed package trafficserver-9.0.0, actual %+v", report.Packages)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0] != "warning 1" {
+		t.Errorf("Report() expected warning 'warning 1', actual %+v", report.Warnings)
+	}
+	if len(report.Errors) != 1 || report.Errors[0] != "error 1" {
+		t.Errorf("Report() expected error 'error 1', actual %+v", report.Errors)
+	}
+}
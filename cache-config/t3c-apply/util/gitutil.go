@@ -134,6 +134,43 @@ const GitChangeNotSelf = false
 
 // makeGitCommitAll makes a git commit of all changes in atsConfigDir, including untracked files.
 func MakeGitCommitAll(atsConfigDir string, self bool, mode t3cutil.Mode, success bool) error {
+	now := time.Now() // TODO get a single consistent time when ORT starts?
+	return makeGitCommitAllMsg(atsConfigDir, makeGitCommitMsg(now, self, mode, success))
+}
+
+// GetGitHead returns the commit hash of the HEAD of the git repo in atsConfigDir.
+func GetGitHead(atsConfigDir string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--verify", "HEAD")
+	cmd.Dir = atsConfigDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse error: in config dir '%v' returned err %v msg '%v'", atsConfigDir, err, string(output))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// MakeGitRollback restores all files in atsConfigDir to the given commit, and commits the rollback.
+// Any uncommitted changes are committed as a failure first, so the config being rolled back is kept in the git history.
+// Files which didn't exist in the given commit are removed.
+func MakeGitRollback(atsConfigDir string, commit string, mode t3cutil.Mode) error {
+	if err := MakeGitCommitAll(atsConfigDir, GitChangeIsSelf, mode, false); err != nil {
+		return errors.New("committing failed config: " + err.Error())
+	}
+
+	{
+		cmd := exec.Command("git", "read-tree", "-u", "--reset", commit)
+		cmd.Dir = atsConfigDir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git read-tree error: in config dir '%v' returned err %v msg '%v'", atsConfigDir, err, string(output))
+		}
+	}
+
+	now := time.Now()
+	return makeGitCommitAllMsg(atsConfigDir, makeGitRollbackMsg(now, mode))
+}
+
+// makeGitCommitAllMsg makes a git commit with the given message of all changes in atsConfigDir, including untracked files.
+func makeGitCommitAllMsg(atsConfigDir string, msg string) error {
 	{
 		// if there are no changes, don't do anything
 		cmd := exec.Command("git", "status", "--porcelain")
@@ -156,9 +193,6 @@ func MakeGitCommitAll(atsConfigDir string, self bool, mode t3cutil.Mode, success
 		}
 	}
 
-	now := time.Now() // TODO get a single consistent time when ORT starts?
-	msg := makeGitCommitMsg(now, self, mode, success)
-
 	{
 		cmd := exec.Command("git", "commit", "--message", msg)
 		cmd.Dir = atsConfigDir
@@ -171,17 +205,26 @@ func MakeGitCommitAll(atsConfigDir string, self bool, mode t3cutil.Mode, success
 }
 
 func makeGitCommitMsg(now time.Time, self bool, mode t3cutil.Mode, success bool) string {
-	const appStr = "t3c"
 	selfStr := "other"
 	if self {
 		selfStr = "self"
 	}
-	timeStr := now.UTC().Format(time.RFC3339)
-	modeStr := strings.ToLower(mode.String())
 	successStr := "fail"
 	if success {
 		successStr = "success"
 	}
+	return joinGitCommitMsg(now, selfStr, mode, successStr)
+}
+
+// makeGitRollbackMsg returns the commit message of a rollback, which is always made by t3c itself.
+func makeGitRollbackMsg(now time.Time, mode t3cutil.Mode) string {
+	return joinGitCommitMsg(now, "self", mode, "rollback")
+}
+
+func joinGitCommitMsg(now time.Time, selfStr string, mode t3cutil.Mode, resultStr string) string {
+	const appStr = "t3c"
+	timeStr := now.UTC().Format(time.RFC3339)
+	modeStr := strings.ToLower(mode.String())
 	const sep = " "
-	return strings.Join([]string{appStr, selfStr, modeStr, successStr, timeStr}, sep)
+	return strings.Join([]string{appStr, selfStr, modeStr, resultStr, timeStr}, sep)
 }
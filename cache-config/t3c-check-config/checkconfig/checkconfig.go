@@ -0,0 +1,257 @@
+// Package checkconfig statically checks ATS config files for errors, such as invalid syntax, unknown values, and references to things which don't exist.
+package checkconfig
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+// Severity is how serious a Problem is.
+type Severity string
+
+const (
+	// SeverityError is a problem which makes ATS reject or ignore some or all of the file.
+	SeverityError Severity = "error"
+	// SeverityWarning is a problem which may be intended, such as a record name unknown to the checker.
+	SeverityWarning Severity = "warning"
+)
+
+// Problem is a single problem found in a config file.
+type Problem struct {
+	File string
+	// Line is the line number of the problem in the file, starting at 1. If 0, the problem isn't on a particular line.
+	Line     int
+	Severity Severity
+	Msg      string
+}
+
+// String returns the problem as 'file:line: severity: message', the format of compilers and other linters.
+func (p Problem) String() string {
+	loc := p.File
+	if p.Line > 0 {
+		loc += ":" + strconv.Itoa(p.Line)
+	}
+	return loc + ": " + string(p.Severity) + ": " + p.Msg
+}
+
+// Checker checks config files.
+type Checker struct {
+	// ConfigDir is the ATS config directory, which relative paths in config files are relative to.
+	ConfigDir string
+	// FileExists returns whether a file exists on disk. Files which are being checked are considered to exist regardless.
+	FileExists func(path string) bool
+	// ReadFile reads a file on disk, for files which are needed to check others but aren't being checked themselves.
+	ReadFile func(path string) ([]byte, error)
+}
+
+// New creates a Checker of files in the given ATS config directory, which checks references against the files on disk.
+func New(configDir string) *Checker {
+	return &Checker{
+		ConfigDir:  configDir,
+		FileExists: fileExists,
+		ReadFile:   ioutil.ReadFile,
+	}
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// checkFunc checks a single config file. The files are all the files being checked, for checks which need other files.
+type checkFunc func(c *Checker, file t3cutil.ATSConfigFile, files *fileSet) []Problem
+
+var checkFuncs = map[string]checkFunc{
+	"records.config":       checkRecords,
+	"remap.config":         checkRemap,
+	"parent.config":        checkParent,
+	"ssl_multicert.config": checkSSLMultiCert,
+	"hosting.config":       checkHosting,
+	"volume.config":        checkVolume,
+	"ip_allow.yaml":        checkIPAllowYAML,
+	"sni.yaml":             checkSNIYAML,
+	"logging.yaml":         checkLoggingYAML,
+}
+
+// CheckedFileNames returns the names of the files which are checked. Other files are ignored by Check.
+func CheckedFileNames() []string {
+	names := []string{}
+	for name := range checkFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check checks the given files, and returns the problems found, in the order of files, then lines.
+// Files without checks are ignored.
+func (c *Checker) Check(files []t3cutil.ATSConfigFile) []Problem {
+	fs := newFileSet(files)
+	problems := []Problem{}
+	for _, file := range files {
+		check, ok := checkFuncs[file.Name]
+		if !ok {
+			continue
+		}
+		fileProblems := check(c, file, fs)
+		sort.SliceStable(fileProblems, func(i, j int) bool { return fileProblems[i].Line < fileProblems[j].Line })
+		problems = append(problems, fileProblems...)
+	}
+	return problems
+}
+
+// HasErrors returns whether any of the problems are errors, rather than warnings.
+func HasErrors(problems []Problem) bool {
+	for _, problem := range problems {
+		if problem.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// fileSet is the set of files being checked, by name and by full path.
+type fileSet struct {
+	byName map[string]t3cutil.ATSConfigFile
+	byPath map[string]t3cutil.ATSConfigFile
+}
+
+func newFileSet(files []t3cutil.ATSConfigFile) *fileSet {
+	fs := &fileSet{byName: map[string]t3cutil.ATSConfigFile{}, byPath: map[string]t3cutil.ATSConfigFile{}}
+	for _, file := range files {
+		fs.byName[file.Name] = file
+		fs.byPath[filepath.Join(file.Path, file.Name)] = file
+	}
+	return fs
+}
+
+// text returns the text of the config file with the given name, from the files being checked if it's one of them, otherwise from disk.
+// Returns false if the file is neither being checked nor on disk.
+func (c *Checker) text(fs *fileSet, name string) (string, bool) {
+	if file, ok := fs.byName[name]; ok {
+		return file.Text, true
+	}
+	bts, err := c.ReadFile(filepath.Join(c.ConfigDir, name))
+	if err != nil {
+		return "", false
+	}
+	return string(bts), true
+}
+
+// exists returns whether the file at path is being checked or exists on disk. Relative paths are relative to the config directory.
+func (c *Checker) exists(fs *fileSet, path string) bool {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.ConfigDir, path)
+	}
+	if _, ok := fs.byPath[path]; ok {
+		return true
+	}
+	return c.FileExists(path)
+}
+
+// line is a line of a config file, without comments or surrounding whitespace.
+type line struct {
+	Num  int
+	Text string
+}
+
+// configLines returns the non-empty, non-comment lines of a config file.
+func configLines(text string) []line {
+	lines := []line{}
+	for i, txt := range strings.Split(text, "\n") {
+		txt = strings.TrimSpace(txt)
+		if txt == "" || strings.HasPrefix(txt, "#") {
+			continue
+		}
+		lines = append(lines, line{Num: i + 1, Text: txt})
+	}
+	return lines
+}
+
+// field is a name=value field, as in parent.config and ssl_multicert.config.
+type field struct {
+	Name  string
+	Value string
+}
+
+// parseFields parses a line of whitespace-separated name=value fields. Values may be double-quoted, to contain whitespace.
+// The quotes are removed from returned values.
+func parseFields(txt string) ([]field, error) {
+	fields := []field{}
+	for txt = strings.TrimSpace(txt); txt != ""; txt = strings.TrimSpace(txt) {
+		eq := strings.IndexAny(txt, "= \t")
+		if eq < 0 || txt[eq] != '=' {
+			end := strings.IndexAny(txt, " \t")
+			if end < 0 {
+				end = len(txt)
+			}
+			return nil, errors.New("field '" + txt[:end] + "' is not name=value")
+		}
+		name := txt[:eq]
+		if name == "" {
+			return nil, errors.New("field with no name")
+		}
+		txt = txt[eq+1:]
+		val := ""
+		if strings.HasPrefix(txt, `"`) {
+			end := strings.Index(txt[1:], `"`)
+			if end < 0 {
+				return nil, errors.New("field '" + name + "' has an unterminated quote")
+			}
+			val = txt[1 : end+1]
+			txt = txt[end+2:]
+		} else {
+			end := strings.IndexAny(txt, " \t")
+			if end < 0 {
+				end = len(txt)
+			}
+			val = txt[:end]
+			txt = txt[end:]
+		}
+		fields = append(fields, field{Name: name, Value: val})
+	}
+	return fields, nil
+}
+
+// problems builds the Problems of a single file.
+type problems struct {
+	file string
+	list []Problem
+}
+
+func newProblems(file string) *problems { return &problems{file: file} }
+
+func (ps *problems) Errorf(lineNum int, format string, v ...interface{}) {
+	ps.list = append(ps.list, Problem{File: ps.file, Line: lineNum, Severity: SeverityError, Msg: fmt.Sprintf(format, v...)})
+}
+
+func (ps *problems) Warnf(lineNum int, format string, v ...interface{}) {
+	ps.list = append(ps.list, Problem{File: ps.file, Line: lineNum, Severity: SeverityWarning, Msg: fmt.Sprintf(format, v...)})
+}
@@ -0,0 +1,423 @@
+// Package checkconfig statically checks ATS config files for errors, such as invalid syntax, unknown values, and references to things which don't exist.
+package checkconfig
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+)
+
+// testChecker returns a Checker whose disk has only the given files, by full path.
+func testChecker(disk map[string]string) *Checker {
+	return &Checker{
+		ConfigDir: "/etc/trafficserver",
+		FileExists: func(path string) bool {
+			_, ok := disk[path]
+			return ok
+		},
+		ReadFile: func(path string) ([]byte, error) {
+			if text, ok := disk[path]; ok {
+				return []byte(text), nil
+			}
+			return nil, errors.New("not found")
+		},
+	}
+}
+
+func problemStrs(problems []Problem) string {
+	strs := []string{}
+	for _, problem := range problems {
+		strs = append(strs, problem.String())
+	}
+	return strings.Join(strs, "\n")
+}
+
+func TestCheck(t *testing.T) {
+	type testCase struct {
+		name  string
+		files map[string]string
+		disk  map[string]string
+		exp   []string
+	}
+	testCases := []testCase{
+		{
+			name: "records valid",
+			files: map[string]string{"records.config": `
+# comment
+CONFIG proxy.config.http.cache.http INT 1
+CONFIG proxy.config.cache.ram_cache.size INT 16G
+CONFIG proxy.config.exec_thread.autoconfig.scale FLOAT 1.5
+CONFIG proxy.config.proxy_name STRING my cache
+LOCAL proxy.local.cluster.type INT 3
+`},
+		},
+		{
+			name: "records invalid",
+			files: map[string]string{"records.config": `CONFIG proxy.config.http.cache.http INT yes
+CONFIG proxy.config.proxy_name INT 1
+BOGUS proxy.config.http.cache.http INT 1
+CONFIG proxy.config.not.a.record INT 1
+CONFIG proxy.config.exec_thread.autoconfig.scale FLOAT abc
+CONFIG proxy.config.http.cache.http INT 0
+`},
+			exp: []string{
+				"records.config:1: error: record 'proxy.config.http.cache.http' is type INT, but value 'yes' isn't an integer",
+				"records.config:2: error: record 'proxy.config.proxy_name' must be type STRING, not INT",
+				"records.config:3: error: record 'proxy.config.http.cache.http' scope 'BOGUS' must be CONFIG or LOCAL",
+				"records.config:3: warning: record 'proxy.config.http.cache.http' is also set on line 1, ATS uses the last one",
+				"records.config:4: warning: unknown record 'proxy.config.not.a.record', it may be misspelled, a plugin record, or not in this version of ATS",
+				"records.config:5: error: record 'proxy.config.exec_thread.autoconfig.scale' is type FLOAT, but value 'abc' isn't a number",
+				"records.config:6: warning: record 'proxy.config.http.cache.http' is also set on line 3, ATS uses the last one",
+			},
+		},
+		{
+			name: "remap duplicate from",
+			files: map[string]string{"remap.config": `map http://a.example/ http://origin.example/ \
+  @plugin=header_rewrite.so
+.definefilter disable_delete @action=deny @method=delete
+map http://b.example/ http://origin.example/
+remap http://c.example/ http://origin.example/
+map http://a.example/ http://origin2.example/
+reverse_map http://a.example/ http://origin2.example/
+map http://d.example/
+`},
+			exp: []string{
+				"remap.config:5: error: unknown remap rule type 'remap'",
+				"remap.config:6: error: duplicate map from-URL 'http://a.example/', already mapped on line 1",
+				"remap.config:8: error: remap rule must have a from-URL and a to-URL",
+			},
+		},
+		{
+			name: "parent",
+			files: map[string]string{"parent.config": `dest_domain=. parent="p1.example:80|1.0;p2.example:80|0.5" round_robin=consistent_hash go_direct=false
+dest_domain=a.example parent="p1.example:80|0" go_direct=false
+dest_domain=b.example parent="p1.example|1.0" round_robin=sometimes
+dest_domain=c.example dest_host=c.example go_direct=true
+dest_domain=d.example go_direct=false bogus=1
+dest_domain=e.example parent="p1.example:99999|1.0&hashstr" max_simple_retries=-1
+`},
+			exp: []string{
+				"parent.config:2: error: parent 'p1.example:80|0': weight '0' must be greater than 0",
+				"parent.config:3: error: field 'round_robin' value 'sometimes' must be one of true, strict, false, consistent_hash, latched",
+				"parent.config:3: error: parent 'p1.example|1.0': must be host:port",
+				"parent.config:4: error: line must have exactly one of dest_domain, dest_host, dest_ip, url_regex, or host_regex, but has 2",
+				"parent.config:5: warning: unknown field 'bogus'",
+				"parent.config:5: error: line has no parent, and go_direct isn't true",
+				"parent.config:6: error: field 'max_simple_retries' value '-1' must be a non-negative integer",
+				"parent.config:6: error: parent 'p1.example:99999|1.0&hashstr': port '99999' must be an integer from 1 to 65535",
+			},
+		},
+		{
+			name: "ssl_multicert certs",
+			files: map[string]string{
+				"records.config":       "CONFIG proxy.config.ssl.server.cert.path STRING /etc/trafficserver/ssl\n",
+				"ssl_multicert.config": "ssl_cert_name=a.cert ssl_key_name=a.key\nssl_cert_name=b.cert ssl_key_name=b.key\ndest_ip=* action=tunnel\ndest_ip=*\n",
+			},
+			disk: map[string]string{"/etc/trafficserver/ssl/a.cert": "", "/etc/trafficserver/ssl/a.key": ""},
+			exp: []string{
+				"ssl_multicert.config:2: error: certificate 'b.cert' doesn't exist",
+				"ssl_multicert.config:2: error: key 'b.key' doesn't exist",
+				"ssl_multicert.config:4: error: line has no ssl_cert_name",
+			},
+		},
+		{
+			name: "hosting and volume",
+			files: map[string]string{
+				"volume.config":  "volume=1 scheme=http size=60%\nvolume=2 scheme=http size=50%\nvolume=2 scheme=rtmp size=big\n",
+				"hosting.config": "hostname=* volume=1,2\ndomain=a.example volume=3\nhostname=b.example domain=b.example volume=1\n",
+			},
+			exp: []string{
+				"volume.config: error: volume sizes add up to 110%, which is more than 100%",
+				"volume.config:3: error: volume 2 is already defined on line 2",
+				"volume.config:3: error: scheme 'rtmp' must be http",
+				"volume.config:3: error: size 'big' must be a percentage or a positive number of megabytes",
+				"hosting.config:2: error: volume 3 isn't defined in volume.config",
+				"hosting.config:3: error: line must have exactly one of hostname or domain",
+			},
+		},
+		{
+			name:  "hosting without volumes",
+			files: map[string]string{"hosting.config": "hostname=* volume=1\n"},
+			exp:   []string{"hosting.config:1: warning: volume 1 isn't defined, there is no volume.config"},
+		},
+		{
+			name:  "hosting volumes on disk",
+			files: map[string]string{"hosting.config": "hostname=* volume=1\n"},
+			disk:  map[string]string{"/etc/trafficserver/volume.config": "volume=1 scheme=http size=100%\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files := []t3cutil.ATSConfigFile{}
+			for _, name := range []string{"records.config", "volume.config", "hosting.config", "remap.config", "parent.config", "ssl_multicert.config"} {
+				if text, ok := tc.files[name]; ok {
+					files = append(files, t3cutil.ATSConfigFile{Name: name, Path: "/etc/trafficserver", Text: text})
+				}
+			}
+			actual := problemStrs(testChecker(tc.disk).Check(files))
+			if exp := strings.Join(tc.exp, "\n"); actual != exp {
+				t.Errorf("expected problems:\n%s\nactual:\n%s", exp, actual)
+			}
+		})
+	}
+}
+
+func TestCheckYAML(t *testing.T) {
+	type testCase struct {
+		name string
+		file string
+		text string
+		exp  []string
+	}
+	testCases := []testCase{
+		{
+			name: "ip_allow valid",
+			file: "ip_allow.yaml",
+			text: `ip_allow:
+  - apply: in
+    ip_addrs: [127.0.0.1, '::1', 10.0.0.0/8]
+    action: allow
+  - apply: in
+    ip_addrs: 0.0.0.0-255.255.255.255
+    action: deny
+    methods: [PUSH, PURGE]
+`,
+		},
+		{
+			name: "ip_allow invalid",
+			file: "ip_allow.yaml",
+			text: `ip_allow:
+  - apply: sideways
+    ip_addrs: not-an-ip
+    action: allow
+  - apply: in
+    ip_addrs: 127.0.0.1
+    action: maybe
+`,
+			exp: []string{
+				"ip_allow.yaml:2: error: ip_allow rule 0 apply 'sideways' must be in or out",
+				"ip_allow.yaml:3: error: ip_allow rule 0 address 'not-an-ip' must be an IP, CIDR, or range of IPs",
+				"ip_allow.yaml:7: error: ip_allow rule 1 action 'maybe' must be allow, deny, set_allow, or set_deny",
+			},
+		},
+		{
+			name: "sni duplicate fqdn",
+			file: "sni.yaml",
+			text: `sni:
+- fqdn: a.example
+  disable_h2: true
+- fqdn: A.example
+  valid_tls_versions_in: [TLSv1_2, TLSv1_4]
+`,
+			exp: []string{
+				"sni.yaml:4: error: sni entry 1 fqdn 'A.example' is the same as entry 0, ATS only uses the first",
+				"sni.yaml:5: error: sni entry 1 TLS version 'TLSv1_4' must be one of TLSv1, TLSv1_1, TLSv1_2, TLSv1_3",
+			},
+		},
+		{
+			name: "logging undefined format",
+			file: "logging.yaml",
+			text: `logging:
+  formats:
+  - name: custom
+    format: '%<cqtq>'
+  logs:
+  - filename: custom
+    format: custom
+  - filename: other
+    format: missing
+  - filename: squid
+    format: squid
+`,
+			exp: []string{"logging.yaml:8: error: log 'other' format 'missing' isn't defined"},
+		},
+		{
+			name: "yaml syntax",
+			file: "sni.yaml",
+			text: "sni:\n- fqdn: a.example\n  bad: [\n",
+			exp:  []string{"sni.yaml:3: error: did not find expected node content"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files := []t3cutil.ATSConfigFile{{Name: tc.file, Path: "/etc/trafficserver", Text: tc.text}}
+			actual := problemStrs(testChecker(nil).Check(files))
+			if exp := strings.Join(tc.exp, "\n"); actual != exp {
+				t.Errorf("expected problems:\n%s\nactual:\n%s", exp, actual)
+			}
+		})
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := parseFields(`dest_domain=a.example parent="p1:80|1.0; p2:80|1.0"  go_direct=false`)
+	if err != nil {
+		t.Fatalf("expected no error, actual: %v", err)
+	}
+	exp := []field{{"dest_domain", "a.example"}, {"parent", "p1:80|1.0; p2:80|1.0"}, {"go_direct", "false"}}
+	if len(fields) != len(exp) {
+		t.Fatalf("expected fields %+v, actual: %+v", exp, fields)
+	}
+	for i := range exp {
+		if fields[i] != exp[i] {
+			t.Errorf("expected field %d %+v, actual: %+v", i, exp[i], fields[i])
+		}
+	}
+
+	if _, err := parseFields(`dest_domain=a.example parent="p1:80`); err == nil {
+		t.Error("expected unterminated quote error, actual: nil")
+	}
+	if _, err := parseFields(`dest_domain=a.example go_direct`); err == nil {
+		t.Error("expected missing value error, actual: nil")
+	}
+}
+
+// TestCheckGenerated checks config files generated by lib/go-atscfg, which t3c-apply always checks, have no problems.
+func TestCheckGenerated(t *testing.T) {
+	const hdr = "DO NOT EDIT - Generated for edge by t3c-check-config test"
+
+	edge := makeTestServer("edge", 1, "EDGE", "edgeCG", 100)
+	mid := makeTestServer("mid", 2, "MID", "midCG", 200)
+	servers := []atscfg.Server{*edge, *mid}
+
+	ds := atscfg.DeliveryService{}
+	ds.ID = util.IntPtr(10)
+	ds.XMLID = util.StrPtr("ds1")
+	ds.Active = util.BoolPtr(true)
+	dsType := tc.DSTypeHTTP
+	ds.Type = &dsType
+	ds.Protocol = util.IntPtr(int(tc.DSProtocolHTTPAndHTTPS))
+	ds.OrgServerFQDN = util.StrPtr("http://origin.example.net")
+	ds.QStringIgnore = util.IntPtr(int(tc.QStringIgnoreUseInCacheKeyAndPassUp))
+	ds.MultiSiteOrigin = util.BoolPtr(false)
+	ds.DSCP = util.IntPtr(0)
+	ds.RangeRequestHandling = util.IntPtr(tc.RangeRequestHandlingBackgroundFetch)
+	ds.CDNName = util.StrPtr("myCDN")
+	ds.CDNID = util.IntPtr(43)
+	ds.ExampleURLs = []string{"https://ds1.mycdn.example.net"}
+	dses := []atscfg.DeliveryService{ds}
+
+	dss := []atscfg.DeliveryServiceServer{{Server: *edge.ID, DeliveryService: *ds.ID}}
+	dsRegexes := []tc.DeliveryServiceRegexes{{
+		DSName:  *ds.XMLID,
+		Regexes: []tc.DeliveryServiceRegex{{Type: string(tc.DSMatchTypeHostRegex), SetNumber: 0, Pattern: `.*\.ds1\..*`}},
+	}}
+	cdn := &tc.CDN{Name: "myCDN", DomainName: "mycdn.example.net"}
+	cacheGroups := []tc.CacheGroupNullable{
+		{Name: util.StrPtr("edgeCG"), ID: util.IntPtr(100), Type: util.StrPtr(tc.CacheGroupEdgeTypeName), ParentName: util.StrPtr("midCG")},
+		{Name: util.StrPtr("midCG"), ID: util.IntPtr(200), Type: util.StrPtr(tc.CacheGroupMidTypeName)},
+	}
+	params := []tc.Parameter{
+		{Name: "CONFIG proxy.config.http.cache.http", ConfigFile: "records.config", Value: "INT 1", Profiles: []byte(`["edgeProfile"]`)},
+		{Name: "CONFIG proxy.config.ssl.server.cert.path", ConfigFile: "records.config", Value: "STRING /etc/trafficserver/ssl", Profiles: []byte(`["edgeProfile"]`)},
+		{Name: "CONFIG proxy.config.ssl.server.private_key.path", ConfigFile: "records.config", Value: "STRING /etc/trafficserver/ssl", Profiles: []byte(`["edgeProfile"]`)},
+		{Name: "Drive_Prefix", ConfigFile: "storage.config", Value: "/dev/sd", Profiles: []byte(`["edgeProfile"]`)},
+		{Name: "Drive_Letters", ConfigFile: "storage.config", Value: "a,b", Profiles: []byte(`["edgeProfile"]`)},
+		{Name: "purge_allow_ip", ConfigFile: "ip_allow.config", Value: "192.0.2.1", Profiles: []byte(`["edgeProfile"]`)},
+	}
+	dsReqCaps := map[int]map[atscfg.ServerCapability]struct{}{}
+	serverCaps := map[int]map[atscfg.ServerCapability]struct{}{}
+
+	generated := map[string]func() (atscfg.Cfg, error){
+		"records.config": func() (atscfg.Cfg, error) {
+			return atscfg.MakeRecordsDotConfig(edge, params, hdr, atscfg.RecordsConfigOpts{})
+		},
+		"remap.config": func() (atscfg.Cfg, error) {
+			return atscfg.MakeRemapDotConfig(edge, dses, dss, dsRegexes, params, cdn, nil, nil, cacheGroups, serverCaps, dsReqCaps, hdr)
+		},
+		"parent.config": func() (atscfg.Cfg, error) {
+			return atscfg.MakeParentDotConfig(dses, edge, servers, nil, params, nil, serverCaps, dsReqCaps, cacheGroups, dss, cdn, atscfg.ParentConfigOpts{HdrComment: hdr})
+		},
+		"ssl_multicert.config": func() (atscfg.Cfg, error) {
+			return atscfg.MakeSSLMultiCertDotConfig(edge, dses, hdr)
+		},
+		"hosting.config": func() (atscfg.Cfg, error) {
+			return atscfg.MakeHostingDotConfig(edge, servers, params, dses, dss, nil, hdr)
+		},
+		"volume.config": func() (atscfg.Cfg, error) {
+			return atscfg.MakeVolumeDotConfig(edge, params, hdr)
+		},
+		"ip_allow.yaml": func() (atscfg.Cfg, error) {
+			return atscfg.MakeIPAllowDotYAML(params, edge, servers, cacheGroups, nil, hdr)
+		},
+		"sni.yaml": func() (atscfg.Cfg, error) {
+			return atscfg.MakeSNIDotYAML(edge, dses, dss, dsRegexes, params, cdn, nil, cacheGroups, serverCaps, dsReqCaps, atscfg.SNIDotYAMLOpts{HdrComment: hdr})
+		},
+		"logging.yaml": func() (atscfg.Cfg, error) {
+			return atscfg.MakeLoggingDotYAML(edge, params, hdr)
+		},
+	}
+
+	files := []t3cutil.ATSConfigFile{}
+	for _, name := range CheckedFileNames() {
+		generate, ok := generated[name]
+		if !ok {
+			t.Fatalf("expected checked file '%v' to be generated, but the test doesn't generate it", name)
+		}
+		cfg, err := generate()
+		if err != nil {
+			t.Fatalf("generating %v: %v", name, err)
+		}
+		files = append(files, t3cutil.ATSConfigFile{Name: name, Path: "/etc/trafficserver", Text: cfg.Text})
+	}
+	// ssl_multicert.config references the generated certificates, which t3c-apply writes with the config files
+	files = append(files,
+		t3cutil.ATSConfigFile{Name: "ds1_mycdn_example_net_cert.cer", Path: "/etc/trafficserver/ssl", Text: "cert"},
+		t3cutil.ATSConfigFile{Name: "ds1.mycdn.example.net.key", Path: "/etc/trafficserver/ssl", Text: "key"},
+	)
+
+	if problems := testChecker(nil).Check(files); len(problems) != 0 {
+		t.Errorf("expected no problems in generated files, actual:\n%v", problemStrs(problems))
+	}
+}
+
+func makeTestServer(hostName string, id int, serverType string, cacheGroup string, cacheGroupID int) *atscfg.Server {
+	sv := &atscfg.Server{}
+	sv.ID = util.IntPtr(id)
+	sv.HostName = util.StrPtr(hostName)
+	sv.DomainName = util.StrPtr("mydomain.example.net")
+	sv.CDNName = util.StrPtr("myCDN")
+	sv.CDNID = util.IntPtr(43)
+	sv.Cachegroup = util.StrPtr(cacheGroup)
+	sv.CachegroupID = util.IntPtr(cacheGroupID)
+	sv.Profile = util.StrPtr(strings.ToLower(serverType) + "Profile")
+	sv.ProfileID = util.IntPtr(id)
+	sv.TCPPort = util.IntPtr(80)
+	sv.HTTPSPort = util.IntPtr(443)
+	sv.Type = serverType
+	sv.TypeID = util.IntPtr(id)
+	sv.Status = util.StrPtr(string(tc.CacheStatusReported))
+	sv.StatusID = util.IntPtr(1)
+	sv.Interfaces = []tc.ServerInterfaceInfo{{
+		Name:        "eth0",
+		IPAddresses: []tc.ServerIPAddress{{Address: "192.0.2." + strconv.Itoa(id), ServiceAddress: true}},
+	}}
+	return sv
+}
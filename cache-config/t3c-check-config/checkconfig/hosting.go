@@ -0,0 +1,158 @@
+package checkconfig
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+const maxVolume = 255
+
+// checkVolume checks volume.config lines have a unique volume number, the http scheme, and a size,
+// and that the percentage sizes don't add up to more than 100%.
+func checkVolume(c *Checker, file t3cutil.ATSConfigFile, fs *fileSet) []Problem {
+	ps := newProblems(file.Name)
+	volumeLines := map[int]int{}
+	totalPercent := 0
+	for _, ln := range configLines(file.Text) {
+		fields, err := parseFields(ln.Text)
+		if err != nil {
+			ps.Errorf(ln.Num, "malformed line: %s", err.Error())
+			continue
+		}
+		vals := map[string]string{}
+		for _, fd := range fields {
+			switch fd.Name {
+			case "volume", "scheme", "size", "ramcache":
+			default:
+				ps.Warnf(ln.Num, "unknown field '%s'", fd.Name)
+			}
+			vals[fd.Name] = fd.Value
+		}
+
+		volume, err := strconv.Atoi(vals["volume"])
+		if err != nil || volume < 1 || volume > maxVolume {
+			ps.Errorf(ln.Num, "volume '%s' must be an integer from 1 to %d", vals["volume"], maxVolume)
+		} else if prevLine, ok := volumeLines[volume]; ok {
+			ps.Errorf(ln.Num, "volume %d is already defined on line %d", volume, prevLine)
+		} else {
+			volumeLines[volume] = ln.Num
+		}
+
+		if scheme := vals["scheme"]; scheme != "http" {
+			ps.Errorf(ln.Num, "scheme '%s' must be http", scheme)
+		}
+
+		size := vals["size"]
+		if strings.HasSuffix(size, "%") {
+			percent, err := strconv.Atoi(strings.TrimSuffix(size, "%"))
+			if err != nil || percent < 1 || percent > 100 {
+				ps.Errorf(ln.Num, "size '%s' must be a percentage from 1%% to 100%%", size)
+			} else {
+				totalPercent += percent
+			}
+		} else if mb, err := strconv.Atoi(size); err != nil || mb < 1 {
+			ps.Errorf(ln.Num, "size '%s' must be a percentage or a positive number of megabytes", size)
+		}
+
+		if ramcache, ok := vals["ramcache"]; ok && ramcache != "true" && ramcache != "false" {
+			ps.Errorf(ln.Num, "ramcache '%s' must be true or false", ramcache)
+		}
+	}
+	if totalPercent > 100 {
+		ps.Errorf(0, "volume sizes add up to %d%%, which is more than 100%%", totalPercent)
+	}
+	return ps.list
+}
+
+// checkHosting checks hosting.config lines have a hostname or domain and volumes,
+// and that every volume is defined in volume.config, which is read from disk if it isn't being checked.
+func checkHosting(c *Checker, file t3cutil.ATSConfigFile, fs *fileSet) []Problem {
+	ps := newProblems(file.Name)
+	volumes := map[int]struct{}{}
+	volumeText, hasVolumeConfig := c.text(fs, "volume.config")
+	for _, ln := range configLines(volumeText) {
+		fields, err := parseFields(ln.Text)
+		if err != nil {
+			continue // reported by checkVolume
+		}
+		for _, fd := range fields {
+			if fd.Name != "volume" {
+				continue
+			}
+			if volume, err := strconv.Atoi(fd.Value); err == nil {
+				volumes[volume] = struct{}{}
+			}
+		}
+	}
+
+	for _, ln := range configLines(file.Text) {
+		fields, err := parseFields(ln.Text)
+		if err != nil {
+			ps.Errorf(ln.Num, "malformed line: %s", err.Error())
+			continue
+		}
+		vals := map[string]string{}
+		for _, fd := range fields {
+			switch fd.Name {
+			case "hostname", "domain", "volume":
+			default:
+				ps.Warnf(ln.Num, "unknown field '%s'", fd.Name)
+			}
+			vals[fd.Name] = fd.Value
+		}
+
+		_, hasHost := vals["hostname"]
+		_, hasDomain := vals["domain"]
+		if hasHost == hasDomain {
+			ps.Errorf(ln.Num, "line must have exactly one of hostname or domain")
+		}
+
+		volumeList, ok := vals["volume"]
+		if !ok {
+			ps.Errorf(ln.Num, "line has no volume")
+			continue
+		}
+		for _, volumeStr := range strings.Split(volumeList, ",") {
+			volume, err := strconv.Atoi(strings.TrimSpace(volumeStr))
+			if err != nil || volume < 1 || volume > maxVolume {
+				ps.Errorf(ln.Num, "volume '%s' must be an integer from 1 to %d", volumeStr, maxVolume)
+				continue
+			}
+			if _, ok := volumes[volume]; ok {
+				continue
+			}
+			if len(volumes) == 0 {
+				// Without volumes, ATS uses the whole cache as one volume, so this is likely a default rather than a mistake.
+				if hasVolumeConfig {
+					ps.Warnf(ln.Num, "volume %d isn't defined, volume.config has no volumes", volume)
+				} else {
+					ps.Warnf(ln.Num, "volume %d isn't defined, there is no volume.config", volume)
+				}
+				continue
+			}
+			ps.Errorf(ln.Num, "volume %d isn't defined in volume.config", volume)
+		}
+	}
+	return ps.list
+}
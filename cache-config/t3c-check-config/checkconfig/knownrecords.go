@@ -0,0 +1,290 @@
+package checkconfig
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// knownRecords are the records.config records known to the checker, and their types.
+// This isn't every ATS record. Records not in it are warned about rather than errors, and should be added as they're used.
+var knownRecords = map[string]string{
+	"proxy.config.accept_threads":                                    recordTypeInt,
+	"proxy.config.admin.autoconf_port":                               recordTypeInt,
+	"proxy.config.admin.cli_path":                                    recordTypeString,
+	"proxy.config.admin.number_config_bak":                           recordTypeInt,
+	"proxy.config.admin.user_id":                                     recordTypeString,
+	"proxy.config.alarm.abs_path":                                    recordTypeString,
+	"proxy.config.alarm.bin":                                         recordTypeString,
+	"proxy.config.alarm_email":                                       recordTypeString,
+	"proxy.config.allocator.debug_filter":                            recordTypeInt,
+	"proxy.config.allocator.enable_reclaim":                          recordTypeInt,
+	"proxy.config.allocator.hugepages":                               recordTypeInt,
+	"proxy.config.allocator.max_overage":                             recordTypeInt,
+	"proxy.config.allocator.thread_freelist_size":                    recordTypeInt,
+	"proxy.config.bin_path":                                          recordTypeString,
+	"proxy.config.body_factory.enable_customizations":                recordTypeInt,
+	"proxy.config.body_factory.enable_logging":                       recordTypeInt,
+	"proxy.config.body_factory.response_suppression_mode":            recordTypeInt,
+	"proxy.config.body_factory.template_sets_dir":                    recordTypeString,
+	"proxy.config.cache.agg_write_backlog":                           recordTypeInt,
+	"proxy.config.cache.control.filename":                            recordTypeString,
+	"proxy.config.cache.enable_read_while_writer":                    recordTypeInt,
+	"proxy.config.cache.hostdb.sync_frequency":                       recordTypeInt,
+	"proxy.config.cache.hosting_filename":                            recordTypeString,
+	"proxy.config.cache.ip_allow.filename":                           recordTypeString,
+	"proxy.config.cache.limits.http.max_alts":                        recordTypeInt,
+	"proxy.config.cache.max_doc_size":                                recordTypeInt,
+	"proxy.config.cache.min_average_object_size":                     recordTypeInt,
+	"proxy.config.cache.mutex_retry_delay":                           recordTypeInt,
+	"proxy.config.cache.permit.pinning":                              recordTypeInt,
+	"proxy.config.cache.ram_cache.algorithm":                         recordTypeInt,
+	"proxy.config.cache.ram_cache.compress":                          recordTypeInt,
+	"proxy.config.cache.ram_cache.size":                              recordTypeInt,
+	"proxy.config.cache.ram_cache.use_seen_filter":                   recordTypeInt,
+	"proxy.config.cache.ram_cache_cutoff":                            recordTypeInt,
+	"proxy.config.cache.storage_filename":                            recordTypeString,
+	"proxy.config.cache.target_fragment_size":                        recordTypeInt,
+	"proxy.config.cache.threads_per_disk":                            recordTypeInt,
+	"proxy.config.cache.volume_filename":                             recordTypeString,
+	"proxy.config.config_dir":                                        recordTypeString,
+	"proxy.config.core_limit":                                        recordTypeInt,
+	"proxy.config.crash_log_helper":                                  recordTypeString,
+	"proxy.config.diags.debug.enabled":                               recordTypeInt,
+	"proxy.config.diags.debug.tags":                                  recordTypeString,
+	"proxy.config.diags.output.debug":                                recordTypeString,
+	"proxy.config.diags.output.diag":                                 recordTypeString,
+	"proxy.config.diags.output.error":                                recordTypeString,
+	"proxy.config.diags.output.status":                               recordTypeString,
+	"proxy.config.diags.output.warning":                              recordTypeString,
+	"proxy.config.diags.show_location":                               recordTypeInt,
+	"proxy.config.dns.dedicated_thread":                              recordTypeInt,
+	"proxy.config.dns.local_ipv4":                                    recordTypeString,
+	"proxy.config.dns.local_ipv6":                                    recordTypeString,
+	"proxy.config.dns.lookup_timeout":                                recordTypeInt,
+	"proxy.config.dns.max_dns_in_flight":                             recordTypeInt,
+	"proxy.config.dns.nameservers":                                   recordTypeString,
+	"proxy.config.dns.resolv_conf":                                   recordTypeString,
+	"proxy.config.dns.retries":                                       recordTypeInt,
+	"proxy.config.dns.round_robin_nameservers":                       recordTypeInt,
+	"proxy.config.dns.search_default_domains":                        recordTypeInt,
+	"proxy.config.dns.splitDNS.enabled":                              recordTypeInt,
+	"proxy.config.dns.validate_query_name":                           recordTypeInt,
+	"proxy.config.env_prep":                                          recordTypeString,
+	"proxy.config.exec_thread.affinity":                              recordTypeInt,
+	"proxy.config.exec_thread.autoconfig":                            recordTypeInt,
+	"proxy.config.exec_thread.autoconfig.scale":                      recordTypeFloat,
+	"proxy.config.exec_thread.limit":                                 recordTypeInt,
+	"proxy.config.hostdb.host_file.path":                             recordTypeString,
+	"proxy.config.hostdb.ip_resolve":                                 recordTypeString,
+	"proxy.config.hostdb.lookup_timeout":                             recordTypeInt,
+	"proxy.config.hostdb.re_dns_on_reload":                           recordTypeInt,
+	"proxy.config.hostdb.serve_stale_for":                            recordTypeInt,
+	"proxy.config.hostdb.size":                                       recordTypeInt,
+	"proxy.config.hostdb.storage_size":                               recordTypeInt,
+	"proxy.config.hostdb.strict_round_robin":                         recordTypeInt,
+	"proxy.config.hostdb.timeout":                                    recordTypeInt,
+	"proxy.config.hostdb.ttl_mode":                                   recordTypeInt,
+	"proxy.config.http.accept_no_activity_timeout":                   recordTypeInt,
+	"proxy.config.http.allow_half_open":                              recordTypeInt,
+	"proxy.config.http.background_fill_active_timeout":               recordTypeInt,
+	"proxy.config.http.background_fill_completed_threshold":          recordTypeFloat,
+	"proxy.config.http.cache.allow_empty_doc":                        recordTypeInt,
+	"proxy.config.http.cache.cache_responses_to_cookies":             recordTypeInt,
+	"proxy.config.http.cache.cache_urls_that_look_dynamic":           recordTypeInt,
+	"proxy.config.http.cache.enable_default_vary_headers":            recordTypeInt,
+	"proxy.config.http.cache.guaranteed_max_lifetime":                recordTypeInt,
+	"proxy.config.http.cache.guaranteed_min_lifetime":                recordTypeInt,
+	"proxy.config.http.cache.heuristic_lm_factor":                    recordTypeFloat,
+	"proxy.config.http.cache.heuristic_max_lifetime":                 recordTypeInt,
+	"proxy.config.http.cache.heuristic_min_lifetime":                 recordTypeInt,
+	"proxy.config.http.cache.http":                                   recordTypeInt,
+	"proxy.config.http.cache.ignore_authentication":                  recordTypeInt,
+	"proxy.config.http.cache.ignore_client_cc_max_age":               recordTypeInt,
+	"proxy.config.http.cache.ignore_client_no_cache":                 recordTypeInt,
+	"proxy.config.http.cache.ignore_server_no_cache":                 recordTypeInt,
+	"proxy.config.http.cache.ims_on_client_no_cache":                 recordTypeInt,
+	"proxy.config.http.cache.max_open_read_retries":                  recordTypeInt,
+	"proxy.config.http.cache.max_open_write_retries":                 recordTypeInt,
+	"proxy.config.http.cache.max_stale_age":                          recordTypeInt,
+	"proxy.config.http.cache.open_read_retry_time":                   recordTypeInt,
+	"proxy.config.http.cache.open_write_fail_action":                 recordTypeInt,
+	"proxy.config.http.cache.post_method":                            recordTypeInt,
+	"proxy.config.http.cache.range.lookup":                           recordTypeInt,
+	"proxy.config.http.cache.range.write":                            recordTypeInt,
+	"proxy.config.http.cache.required_headers":                       recordTypeInt,
+	"proxy.config.http.cache.when_to_revalidate":                     recordTypeInt,
+	"proxy.config.http.chunking_enabled":                             recordTypeInt,
+	"proxy.config.http.connect_attempts_max_retries":                 recordTypeInt,
+	"proxy.config.http.connect_attempts_max_retries_dead_server":     recordTypeInt,
+	"proxy.config.http.connect_attempts_rr_retries":                  recordTypeInt,
+	"proxy.config.http.connect_attempts_timeout":                     recordTypeInt,
+	"proxy.config.http.connect_ports":                                recordTypeString,
+	"proxy.config.http.down_server.cache_time":                       recordTypeInt,
+	"proxy.config.http.enable_http_stats":                            recordTypeInt,
+	"proxy.config.http.forward.proxy_auth_to_parent":                 recordTypeInt,
+	"proxy.config.http.global_user_agent_header":                     recordTypeString,
+	"proxy.config.http.insert_age_in_response":                       recordTypeInt,
+	"proxy.config.http.insert_request_via_str":                       recordTypeInt,
+	"proxy.config.http.insert_response_via_str":                      recordTypeInt,
+	"proxy.config.http.keep_alive_enabled_in":                        recordTypeInt,
+	"proxy.config.http.keep_alive_enabled_out":                       recordTypeInt,
+	"proxy.config.http.keep_alive_no_activity_timeout_in":            recordTypeInt,
+	"proxy.config.http.keep_alive_no_activity_timeout_out":           recordTypeInt,
+	"proxy.config.http.negative_caching_enabled":                     recordTypeInt,
+	"proxy.config.http.negative_caching_lifetime":                    recordTypeInt,
+	"proxy.config.http.negative_revalidating_enabled":                recordTypeInt,
+	"proxy.config.http.negative_revalidating_lifetime":               recordTypeInt,
+	"proxy.config.http.no_dns_just_forward_to_parent":                recordTypeInt,
+	"proxy.config.http.normalize_ae":                                 recordTypeInt,
+	"proxy.config.http.number_of_redirections":                       recordTypeInt,
+	"proxy.config.http.origin_max_connections":                       recordTypeInt,
+	"proxy.config.http.parent_proxy.connect_attempts_timeout":        recordTypeInt,
+	"proxy.config.http.parent_proxy.fail_threshold":                  recordTypeInt,
+	"proxy.config.http.parent_proxy.mark_down_hostdb":                recordTypeInt,
+	"proxy.config.http.parent_proxy.per_parent_connect_attempts":     recordTypeInt,
+	"proxy.config.http.parent_proxy.retry_time":                      recordTypeInt,
+	"proxy.config.http.parent_proxy.self_detect":                     recordTypeInt,
+	"proxy.config.http.parent_proxy.total_connect_attempts":          recordTypeInt,
+	"proxy.config.http.parent_proxy_routing_enable":                  recordTypeInt,
+	"proxy.config.http.per_server.connection.max":                    recordTypeInt,
+	"proxy.config.http.post_connect_attempts_timeout":                recordTypeInt,
+	"proxy.config.http.push_method_enabled":                          recordTypeInt,
+	"proxy.config.http.redirect_use_orig_cache_key":                  recordTypeInt,
+	"proxy.config.http.request_via_str":                              recordTypeString,
+	"proxy.config.http.response_server_enabled":                      recordTypeInt,
+	"proxy.config.http.response_via_str":                             recordTypeString,
+	"proxy.config.http.send_http11_requests":                         recordTypeInt,
+	"proxy.config.http.server_ports":                                 recordTypeString,
+	"proxy.config.http.server_session_sharing.match":                 recordTypeString,
+	"proxy.config.http.server_session_sharing.pool":                  recordTypeString,
+	"proxy.config.http.slow.log.threshold":                           recordTypeInt,
+	"proxy.config.http.transaction_active_timeout_in":                recordTypeInt,
+	"proxy.config.http.transaction_active_timeout_out":               recordTypeInt,
+	"proxy.config.http.transaction_no_activity_timeout_in":           recordTypeInt,
+	"proxy.config.http.transaction_no_activity_timeout_out":          recordTypeInt,
+	"proxy.config.http.uncacheable_requests_bypass_parent":           recordTypeInt,
+	"proxy.config.http.wait_for_cache":                               recordTypeInt,
+	"proxy.config.http2.accept_no_activity_timeout":                  recordTypeInt,
+	"proxy.config.http2.active_timeout_in":                           recordTypeInt,
+	"proxy.config.http2.header_table_size":                           recordTypeInt,
+	"proxy.config.http2.initial_window_size_in":                      recordTypeInt,
+	"proxy.config.http2.max_concurrent_streams_in":                   recordTypeInt,
+	"proxy.config.http2.max_frame_size":                              recordTypeInt,
+	"proxy.config.http2.max_header_list_size":                        recordTypeInt,
+	"proxy.config.http2.no_activity_timeout_in":                      recordTypeInt,
+	"proxy.config.http2.push_diary_size":                             recordTypeInt,
+	"proxy.config.http2.stream_priority_enabled":                     recordTypeInt,
+	"proxy.config.http2.zombie_debug_timeout_in":                     recordTypeInt,
+	"proxy.config.http_ui_enabled":                                   recordTypeInt,
+	"proxy.config.local_state_dir":                                   recordTypeString,
+	"proxy.config.log.ascii_buffer_size":                             recordTypeInt,
+	"proxy.config.log.auto_delete_rolled_files":                      recordTypeInt,
+	"proxy.config.log.config.filename":                               recordTypeString,
+	"proxy.config.log.file_stat_frequency":                           recordTypeInt,
+	"proxy.config.log.hostname":                                      recordTypeString,
+	"proxy.config.log.log_buffer_size":                               recordTypeInt,
+	"proxy.config.log.logfile_dir":                                   recordTypeString,
+	"proxy.config.log.logfile_perm":                                  recordTypeString,
+	"proxy.config.log.logging_enabled":                               recordTypeInt,
+	"proxy.config.log.max_line_size":                                 recordTypeInt,
+	"proxy.config.log.max_secs_per_buffer":                           recordTypeInt,
+	"proxy.config.log.max_space_mb_for_logs":                         recordTypeInt,
+	"proxy.config.log.max_space_mb_for_orphan_logs":                  recordTypeInt,
+	"proxy.config.log.max_space_mb_headroom":                         recordTypeInt,
+	"proxy.config.log.periodic_tasks_interval":                       recordTypeInt,
+	"proxy.config.log.rolling_enabled":                               recordTypeInt,
+	"proxy.config.log.rolling_interval_sec":                          recordTypeInt,
+	"proxy.config.log.rolling_offset_hr":                             recordTypeInt,
+	"proxy.config.log.rolling_size_mb":                               recordTypeInt,
+	"proxy.config.log.sampling_frequency":                            recordTypeInt,
+	"proxy.config.log.space_used_frequency":                          recordTypeInt,
+	"proxy.config.memory.max_usage":                                  recordTypeInt,
+	"proxy.config.mlock_enabled":                                     recordTypeInt,
+	"proxy.config.net.connections_throttle":                          recordTypeInt,
+	"proxy.config.net.default_inactivity_timeout":                    recordTypeInt,
+	"proxy.config.net.defer_accept":                                  recordTypeInt,
+	"proxy.config.net.inactivity_check_frequency":                    recordTypeInt,
+	"proxy.config.net.max_active_connections_in":                     recordTypeInt,
+	"proxy.config.net.max_connections_in":                            recordTypeInt,
+	"proxy.config.net.poll_timeout":                                  recordTypeInt,
+	"proxy.config.net.sock_option_flag_in":                           recordTypeInt,
+	"proxy.config.net.sock_option_flag_out":                          recordTypeInt,
+	"proxy.config.net.sock_recv_buffer_size_in":                      recordTypeInt,
+	"proxy.config.net.sock_recv_buffer_size_out":                     recordTypeInt,
+	"proxy.config.net.sock_send_buffer_size_in":                      recordTypeInt,
+	"proxy.config.net.sock_send_buffer_size_out":                     recordTypeInt,
+	"proxy.config.output.logfile":                                    recordTypeString,
+	"proxy.config.output.logfile.rolling_enabled":                    recordTypeInt,
+	"proxy.config.output.logfile.rolling_interval_sec":               recordTypeInt,
+	"proxy.config.output.logfile.rolling_min_count":                  recordTypeInt,
+	"proxy.config.output.logfile.rolling_size_mb":                    recordTypeInt,
+	"proxy.config.plugin.plugin_dir":                                 recordTypeString,
+	"proxy.config.process_manager.mgmt_port":                         recordTypeInt,
+	"proxy.config.proxy_name":                                        recordTypeString,
+	"proxy.config.restart.active_client_threshold":                   recordTypeInt,
+	"proxy.config.restart.stop_listening":                            recordTypeInt,
+	"proxy.config.reverse_proxy.enabled":                             recordTypeInt,
+	"proxy.config.socks.socks_needed":                                recordTypeInt,
+	"proxy.config.srv_enabled":                                       recordTypeInt,
+	"proxy.config.ssl.CA.cert.filename":                              recordTypeString,
+	"proxy.config.ssl.CA.cert.path":                                  recordTypeString,
+	"proxy.config.ssl.TLSv1":                                         recordTypeInt,
+	"proxy.config.ssl.TLSv1_1":                                       recordTypeInt,
+	"proxy.config.ssl.TLSv1_2":                                       recordTypeInt,
+	"proxy.config.ssl.TLSv1_3":                                       recordTypeInt,
+	"proxy.config.ssl.client.CA.cert.filename":                       recordTypeString,
+	"proxy.config.ssl.client.CA.cert.path":                           recordTypeString,
+	"proxy.config.ssl.client.cert.path":                              recordTypeString,
+	"proxy.config.ssl.client.private_key.path":                       recordTypeString,
+	"proxy.config.ssl.client.verify.server":                          recordTypeInt,
+	"proxy.config.ssl.client.verify.server.policy":                   recordTypeString,
+	"proxy.config.ssl.client.verify.server.properties":               recordTypeString,
+	"proxy.config.ssl.compression":                                   recordTypeInt,
+	"proxy.config.ssl.handshake_timeout_in":                          recordTypeInt,
+	"proxy.config.ssl.number.threads":                                recordTypeInt,
+	"proxy.config.ssl.ocsp.enabled":                                  recordTypeInt,
+	"proxy.config.ssl.server.TLSv1_3.cipher_suites":                  recordTypeString,
+	"proxy.config.ssl.server.cert.path":                              recordTypeString,
+	"proxy.config.ssl.server.cipher_suite":                           recordTypeString,
+	"proxy.config.ssl.server.dhparams_file":                          recordTypeString,
+	"proxy.config.ssl.server.honor_cipher_order":                     recordTypeInt,
+	"proxy.config.ssl.server.multicert.filename":                     recordTypeString,
+	"proxy.config.ssl.server.private_key.path":                       recordTypeString,
+	"proxy.config.ssl.server.session_ticket.enable":                  recordTypeInt,
+	"proxy.config.ssl.server.ticket_key.filename":                    recordTypeString,
+	"proxy.config.ssl.servername.filename":                           recordTypeString,
+	"proxy.config.ssl.session_cache":                                 recordTypeInt,
+	"proxy.config.ssl.session_cache.num_buckets":                     recordTypeInt,
+	"proxy.config.ssl.session_cache.size":                            recordTypeInt,
+	"proxy.config.ssl.session_cache.skip_cache_on_bucket_contention": recordTypeInt,
+	"proxy.config.ssl.session_cache.timeout":                         recordTypeInt,
+	"proxy.config.stack_dump_enabled":                                recordTypeInt,
+	"proxy.config.syslog_facility":                                   recordTypeString,
+	"proxy.config.task_threads":                                      recordTypeInt,
+	"proxy.config.thread.default.stacksize":                          recordTypeInt,
+	"proxy.config.update.concurrent_updates":                         recordTypeInt,
+	"proxy.config.update.enabled":                                    recordTypeInt,
+	"proxy.config.update.force":                                      recordTypeInt,
+	"proxy.config.update.retry_count":                                recordTypeInt,
+	"proxy.config.update.retry_interval":                             recordTypeInt,
+	"proxy.config.url_remap.filename":                                recordTypeString,
+	"proxy.config.url_remap.pristine_host_hdr":                       recordTypeInt,
+	"proxy.config.url_remap.remap_required":                          recordTypeInt,
+	"proxy.local.cluster.type":                                       recordTypeInt,
+	"proxy.local.incoming_ip_to_bind":                                recordTypeString,
+	"proxy.local.outgoing_ip_to_bind":                                recordTypeString,
+}
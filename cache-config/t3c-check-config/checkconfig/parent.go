@@ -0,0 +1,172 @@
+package checkconfig
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+// parentDestinations are the parent.config primary destination fields. Every line must have exactly one.
+var parentDestinations = map[string]struct{}{
+	"dest_domain": {},
+	"dest_host":   {},
+	"dest_ip":     {},
+	"url_regex":   {},
+	"host_regex":  {},
+}
+
+// parentFieldValues are the valid values of parent.config fields with a fixed set of values.
+var parentFieldValues = map[string][]string{
+	"round_robin":     {"true", "strict", "false", "consistent_hash", "latched"},
+	"go_direct":       {"true", "false"},
+	"parent_is_proxy": {"true", "false"},
+	"qstring":         {"consider", "ignore"},
+	"parent_retry":    {"simple_retry", "unavailable_server_retry", "both"},
+	"secondary_mode":  {"1", "2", "3"},
+	"scheme":          {"http", "https"},
+	"internal":        {"true", "false"},
+}
+
+// parentIntFields are parent.config fields whose values must be non-negative integers.
+var parentIntFields = map[string]struct{}{
+	"port":                           {},
+	"max_simple_retries":             {},
+	"max_unavailable_server_retries": {},
+}
+
+// parentOtherFields are the parent.config fields which aren't destinations and don't have fixed or integer values.
+var parentOtherFields = map[string]struct{}{
+	"parent":                             {},
+	"secondary_parent":                   {},
+	"prefix":                             {},
+	"suffix":                             {},
+	"method":                             {},
+	"time":                               {},
+	"src_ip":                             {},
+	"simple_server_retry_responses":      {},
+	"unavailable_server_retry_responses": {},
+}
+
+// checkParent checks parent.config lines have valid name=value fields, exactly one destination,
+// and parent lists of 'host:port|weight' entries with valid ports and positive weights.
+func checkParent(c *Checker, file t3cutil.ATSConfigFile, fs *fileSet) []Problem {
+	ps := newProblems(file.Name)
+	for _, ln := range configLines(file.Text) {
+		fields, err := parseFields(ln.Text)
+		if err != nil {
+			ps.Errorf(ln.Num, "malformed line: %s", err.Error())
+			continue
+		}
+
+		vals := map[string]string{}
+		dests := []string{}
+		for _, fd := range fields {
+			name := strings.ToLower(fd.Name)
+			if _, ok := vals[name]; ok {
+				ps.Errorf(ln.Num, "field '%s' is set more than once", name)
+			}
+			vals[name] = fd.Value
+
+			if _, ok := parentDestinations[name]; ok {
+				dests = append(dests, name)
+				if fd.Value == "" {
+					ps.Errorf(ln.Num, "destination '%s' is empty", name)
+				}
+			} else if valid, ok := parentFieldValues[name]; ok {
+				if !containsStr(valid, strings.ToLower(fd.Value)) {
+					ps.Errorf(ln.Num, "field '%s' value '%s' must be one of %s", name, fd.Value, strings.Join(valid, ", "))
+				}
+			} else if _, ok := parentIntFields[name]; ok {
+				if i, err := strconv.Atoi(fd.Value); err != nil || i < 0 {
+					ps.Errorf(ln.Num, "field '%s' value '%s' must be a non-negative integer", name, fd.Value)
+				}
+			} else if _, ok := parentOtherFields[name]; !ok {
+				ps.Warnf(ln.Num, "unknown field '%s'", fd.Name)
+			}
+		}
+
+		if len(dests) != 1 {
+			ps.Errorf(ln.Num, "line must have exactly one of dest_domain, dest_host, dest_ip, url_regex, or host_regex, but has %d", len(dests))
+		}
+
+		for _, name := range []string{"parent", "secondary_parent"} {
+			val, ok := vals[name]
+			if !ok {
+				continue
+			}
+			for _, entry := range strings.Split(val, ";") {
+				if entry = strings.TrimSpace(entry); entry == "" {
+					continue
+				}
+				if err := checkParentEntry(entry); err != nil {
+					ps.Errorf(ln.Num, "%s '%s': %s", name, entry, err.Error())
+				}
+			}
+		}
+
+		if _, ok := vals["parent"]; !ok && strings.ToLower(vals["go_direct"]) != "true" {
+			ps.Errorf(ln.Num, "line has no parent, and go_direct isn't true")
+		}
+	}
+	return ps.list
+}
+
+// checkParentEntry checks an entry of a parent list, which is 'host:port', optionally followed by '|weight' and '&hash-string'.
+func checkParentEntry(entry string) error {
+	if i := strings.Index(entry, "&"); i >= 0 {
+		entry = entry[:i]
+	}
+	hostPort := entry
+	if i := strings.Index(entry, "|"); i >= 0 {
+		hostPort = entry[:i]
+		weight, err := strconv.ParseFloat(entry[i+1:], 64)
+		if err != nil {
+			return errors.New("weight '" + entry[i+1:] + "' isn't a number")
+		}
+		if weight <= 0 {
+			return errors.New("weight '" + entry[i+1:] + "' must be greater than 0")
+		}
+	}
+	colon := strings.LastIndex(hostPort, ":")
+	if colon < 0 {
+		return errors.New("must be host:port")
+	}
+	if colon == 0 {
+		return errors.New("host is empty")
+	}
+	port, err := strconv.Atoi(hostPort[colon+1:])
+	if err != nil || port < 1 || port > 65535 {
+		return errors.New("port '" + hostPort[colon+1:] + "' must be an integer from 1 to 65535")
+	}
+	return nil
+}
+
+func containsStr(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package checkconfig
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+const (
+	recordTypeInt     = "INT"
+	recordTypeFloat   = "FLOAT"
+	recordTypeString  = "STRING"
+	recordTypeCounter = "COUNTER"
+)
+
+// recordIntRegex matches ATS integer record values, which may be hex, and may have a K, M, G, or T multiplier suffix.
+var recordIntRegex = regexp.MustCompile(`^-?(0[xX][0-9a-fA-F]+|[0-9]+)[KMGTkmgt]?$`)
+
+// checkRecords checks records.config lines are 'CONFIG|LOCAL name TYPE value', with a value of the type,
+// and that known records have the right type.
+func checkRecords(c *Checker, file t3cutil.ATSConfigFile, fs *fileSet) []Problem {
+	ps := newProblems(file.Name)
+	seen := map[string]int{}
+	for _, ln := range configLines(file.Text) {
+		fields := strings.Fields(ln.Text)
+		if len(fields) < 3 {
+			ps.Errorf(ln.Num, "record line '%s' must be 'CONFIG name TYPE value'", ln.Text)
+			continue
+		}
+		scope, name, typ := fields[0], fields[1], fields[2]
+		val := strings.Join(fields[3:], " ")
+
+		if scope != "CONFIG" && scope != "LOCAL" {
+			ps.Errorf(ln.Num, "record '%s' scope '%s' must be CONFIG or LOCAL", name, scope)
+		}
+		if prevLine, ok := seen[name]; ok {
+			ps.Warnf(ln.Num, "record '%s' is also set on line %d, ATS uses the last one", name, prevLine)
+		}
+		seen[name] = ln.Num
+
+		switch typ {
+		case recordTypeInt, recordTypeCounter:
+			if !recordIntRegex.MatchString(val) {
+				ps.Errorf(ln.Num, "record '%s' is type %s, but value '%s' isn't an integer", name, typ, val)
+			}
+		case recordTypeFloat:
+			if _, err := strconv.ParseFloat(val, 64); err != nil {
+				ps.Errorf(ln.Num, "record '%s' is type %s, but value '%s' isn't a number", name, typ, val)
+			}
+		case recordTypeString:
+			// any value is a valid string, including none
+		default:
+			ps.Errorf(ln.Num, "record '%s' type '%s' must be one of INT, FLOAT, STRING, COUNTER", name, typ)
+			continue
+		}
+
+		knownType, ok := knownRecords[name]
+		if !ok {
+			if strings.HasPrefix(name, "proxy.config.") || strings.HasPrefix(name, "proxy.local.") {
+				ps.Warnf(ln.Num, "unknown record '%s', it may be misspelled, a plugin record, or not in this version of ATS", name)
+			}
+			continue
+		}
+		if typ != knownType {
+			ps.Errorf(ln.Num, "record '%s' must be type %s, not %s", name, knownType, typ)
+		}
+	}
+	return ps.list
+}
+
+// recordValue returns the value of the record with the given name in records.config, and whether it was set.
+// If the record is set more than once, the last value is returned, as ATS does.
+func recordValue(recordsText string, name string) (string, bool) {
+	val, found := "", false
+	for _, ln := range configLines(recordsText) {
+		fields := strings.Fields(ln.Text)
+		if len(fields) < 3 || fields[1] != name {
+			continue
+		}
+		val, found = strings.Join(fields[3:], " "), true
+	}
+	return val, found
+}
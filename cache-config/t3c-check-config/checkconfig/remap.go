@@ -0,0 +1,92 @@
+package checkconfig
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strings"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+var remapRuleTypes = map[string]struct{}{
+	"map":                      {},
+	"map_with_recv_port":       {},
+	"map_with_referer":         {},
+	"reverse_map":              {},
+	"redirect":                 {},
+	"redirect_temporary":       {},
+	"regex_map":                {},
+	"regex_map_with_recv_port": {},
+	"regex_map_with_referer":   {},
+	"regex_redirect":           {},
+	"regex_redirect_temporary": {},
+}
+
+// checkRemap checks remap.config rules have a known type, a from-URL and a to-URL,
+// and that no two rules of the same type have the same from-URL, in which case ATS only ever uses the first.
+//
+// Plugin and plugin config file references are checked by t3c-check-refs.
+func checkRemap(c *Checker, file t3cutil.ATSConfigFile, fs *fileSet) []Problem {
+	ps := newProblems(file.Name)
+	fromLines := map[string]int{}
+	for _, ln := range joinContinuations(configLines(file.Text)) {
+		if strings.HasPrefix(ln.Text, ".") {
+			continue // directive, e.g. .definefilter or .include
+		}
+		fields := strings.Fields(ln.Text)
+		if _, ok := remapRuleTypes[fields[0]]; !ok {
+			ps.Errorf(ln.Num, "unknown remap rule type '%s'", fields[0])
+			continue
+		}
+		if len(fields) < 3 {
+			ps.Errorf(ln.Num, "remap rule must have a from-URL and a to-URL")
+			continue
+		}
+		key := fields[0] + " " + fields[1]
+		if prevLine, ok := fromLines[key]; ok {
+			ps.Errorf(ln.Num, "duplicate %s from-URL '%s', already mapped on line %d", fields[0], fields[1], prevLine)
+			continue
+		}
+		fromLines[key] = ln.Num
+	}
+	return ps.list
+}
+
+// joinContinuations joins lines ending in a backslash with the lines after them.
+// The joined line has the number of its first line.
+func joinContinuations(lines []line) []line {
+	joined := []line{}
+	cont := (*line)(nil)
+	for _, ln := range lines {
+		if cont != nil {
+			ln = line{Num: cont.Num, Text: cont.Text + " " + ln.Text}
+		}
+		if strings.HasSuffix(ln.Text, `\`) {
+			cont = &line{Num: ln.Num, Text: strings.TrimSpace(strings.TrimSuffix(ln.Text, `\`))}
+			continue
+		}
+		cont = nil
+		joined = append(joined, ln)
+	}
+	if cont != nil {
+		joined = append(joined, *cont)
+	}
+	return joined
+}
@@ -0,0 +1,119 @@
+package checkconfig
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+var sslMultiCertFields = map[string]struct{}{
+	"ssl_cert_name":      {},
+	"ssl_key_name":       {},
+	"ssl_ca_name":        {},
+	"ssl_ocsp_name":      {},
+	"ssl_key_dialog":     {},
+	"ssl_ticket_enabled": {},
+	"ssl_ticket_number":  {},
+	"dest_ip":            {},
+	"dest_fqdn":          {},
+	"action":             {},
+}
+
+// checkSSLMultiCert checks ssl_multicert.config lines have valid name=value fields and a certificate,
+// and that the certificate and key files exist, either on disk or as config files being created.
+//
+// Cert and key paths are relative to the records.config proxy.config.ssl.server.cert.path and proxy.config.ssl.server.private_key.path.
+func checkSSLMultiCert(c *Checker, file t3cutil.ATSConfigFile, fs *fileSet) []Problem {
+	ps := newProblems(file.Name)
+
+	recordsText, _ := c.text(fs, "records.config")
+	certDir := recordPath(recordsText, "proxy.config.ssl.server.cert.path")
+	keyDir := recordPath(recordsText, "proxy.config.ssl.server.private_key.path")
+	if keyDir == "" {
+		keyDir = certDir
+	}
+
+	for _, ln := range configLines(file.Text) {
+		fields, err := parseFields(ln.Text)
+		if err != nil {
+			ps.Errorf(ln.Num, "malformed line: %s", err.Error())
+			continue
+		}
+		vals := map[string]string{}
+		for _, fd := range fields {
+			if _, ok := sslMultiCertFields[fd.Name]; !ok {
+				ps.Warnf(ln.Num, "unknown field '%s'", fd.Name)
+			}
+			vals[fd.Name] = fd.Value
+		}
+
+		certs, ok := vals["ssl_cert_name"]
+		if !ok {
+			if vals["action"] != "tunnel" {
+				ps.Errorf(ln.Num, "line has no ssl_cert_name")
+			}
+			continue
+		}
+		for _, cert := range strings.Split(certs, ",") {
+			if !c.sslFileExists(fs, certDir, strings.TrimSpace(cert)) {
+				ps.Errorf(ln.Num, "certificate '%s' doesn't exist", cert)
+			}
+		}
+		if keys, ok := vals["ssl_key_name"]; ok {
+			for _, key := range strings.Split(keys, ",") {
+				if !c.sslFileExists(fs, keyDir, strings.TrimSpace(key)) {
+					ps.Errorf(ln.Num, "key '%s' doesn't exist", key)
+				}
+			}
+		}
+	}
+	return ps.list
+}
+
+// recordPath returns the absolute path in the given record, or the empty string if the record isn't set or isn't an absolute path.
+func recordPath(recordsText string, name string) string {
+	val, ok := recordValue(recordsText, name)
+	if !ok {
+		return ""
+	}
+	val = strings.TrimSpace(val)
+	if !filepath.IsAbs(val) {
+		return "" // relative paths are relative to the ATS install, which isn't known
+	}
+	return val
+}
+
+// sslFileExists returns whether the cert or key file name exists in dir.
+// If dir is empty, because the records.config path isn't known, a config file being created with the file's name, in any directory, is considered to be it.
+func (c *Checker) sslFileExists(fs *fileSet, dir string, name string) bool {
+	if filepath.IsAbs(name) {
+		return c.exists(fs, name)
+	}
+	if dir != "" {
+		return c.exists(fs, filepath.Join(dir, name))
+	}
+	if _, ok := fs.byName[filepath.Base(name)]; ok {
+		return true
+	}
+	return c.exists(fs, name)
+}
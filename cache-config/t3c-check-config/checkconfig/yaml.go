@@ -0,0 +1,373 @@
+package checkconfig
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// yamlStrings is a YAML value which may be a single string or a list of strings, as many ATS YAML fields may be.
+type yamlStrings []string
+
+func (s *yamlStrings) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	str := ""
+	if err := unmarshal(&str); err == nil {
+		*s = yamlStrings{str}
+		return nil
+	}
+	strs := []string{}
+	if err := unmarshal(&strs); err != nil {
+		return errors.New("must be a string or a list of strings")
+	}
+	*s = strs
+	return nil
+}
+
+var yamlErrLineRegex = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+var yamlErrFieldRegex = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+
+// unmarshalYAML strictly unmarshals the YAML text into obj, adding any errors to ps with their line numbers.
+// Returns whether unmarshalling succeeded.
+func unmarshalYAML(ps *problems, text string, obj interface{}) bool {
+	err := yaml.UnmarshalStrict([]byte(text), obj)
+	if err == nil {
+		return true
+	}
+	msgs := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		msgs = typeErr.Errors
+	}
+	for _, msg := range msgs {
+		lineNum := 0
+		if match := yamlErrLineRegex.FindStringSubmatch(msg); match != nil {
+			lineNum, _ = strconv.Atoi(match[1])
+			msg = match[2]
+		}
+		if match := yamlErrFieldRegex.FindStringSubmatch(msg); match != nil {
+			msg = "unknown field '" + match[1] + "'"
+		}
+		ps.Errorf(lineNum, "%s", strings.TrimPrefix(msg, "yaml: "))
+	}
+	return false
+}
+
+// findLine returns the number of the first line of text with the YAML key and value, or 0 if there is none.
+// If key is empty, it returns the first line containing the value, e.g. for values in lists.
+// It's used to give line numbers to problems found after unmarshalling, which loses them.
+func findLine(text string, key string, val string) int {
+	return findNthLine(text, key, val, 0)
+}
+
+// findNthLine is like findLine, but returns the line of the nth occurrence, starting at 0.
+func findNthLine(text string, key string, val string, n int) int {
+	re := regexp.MustCompile(regexp.QuoteMeta(val))
+	if key != "" {
+		re = regexp.MustCompile(`(^|[\s{,-])` + regexp.QuoteMeta(key) + `\s*:\s*['"]?` + regexp.QuoteMeta(val))
+	}
+	for i, ln := range strings.Split(text, "\n") {
+		if !re.MatchString(ln) {
+			continue
+		}
+		if n == 0 {
+			return i + 1
+		}
+		n--
+	}
+	return 0
+}
+
+type ipAllowYAML struct {
+	IPAllow []ipAllowYAMLRule `yaml:"ip_allow"`
+}
+
+type ipAllowYAMLRule struct {
+	Apply   string      `yaml:"apply"`
+	IPAddrs yamlStrings `yaml:"ip_addrs"`
+	Action  string      `yaml:"action"`
+	Methods yamlStrings `yaml:"methods"`
+}
+
+// checkIPAllowYAML checks ip_allow.yaml rules have only known fields, an apply of in or out, a valid action,
+// and addresses which are IPs, CIDRs, or IP ranges.
+func checkIPAllowYAML(c *Checker, file t3cutil.ATSConfigFile, fs *fileSet) []Problem {
+	ps := newProblems(file.Name)
+	doc := ipAllowYAML{}
+	if !unmarshalYAML(ps, file.Text, &doc) {
+		return ps.list
+	}
+	for i, rule := range doc.IPAllow {
+		if rule.Apply != "in" && rule.Apply != "out" {
+			ps.Errorf(findLine(file.Text, "apply", rule.Apply), "ip_allow rule %d apply '%s' must be in or out", i, rule.Apply)
+		}
+		switch rule.Action {
+		case "allow", "deny", "set_allow", "set_deny":
+		default:
+			ps.Errorf(findLine(file.Text, "action", rule.Action), "ip_allow rule %d action '%s' must be allow, deny, set_allow, or set_deny", i, rule.Action)
+		}
+		if len(rule.IPAddrs) == 0 {
+			ps.Errorf(0, "ip_allow rule %d has no ip_addrs", i)
+		}
+		for _, addr := range rule.IPAddrs {
+			if !validIPAllowAddr(addr) {
+				ps.Errorf(findLine(file.Text, "", addr), "ip_allow rule %d address '%s' must be an IP, CIDR, or range of IPs", i, addr)
+			}
+		}
+	}
+	return ps.list
+}
+
+// validIPAllowAddr returns whether addr is an IP, a CIDR, or a range of two IPs separated by a dash.
+func validIPAllowAddr(addr string) bool {
+	addr = strings.TrimSpace(addr)
+	if net.ParseIP(addr) != nil {
+		return true
+	}
+	if _, _, err := net.ParseCIDR(addr); err == nil {
+		return true
+	}
+	ips := strings.Split(addr, "-")
+	return len(ips) == 2 && net.ParseIP(strings.TrimSpace(ips[0])) != nil && net.ParseIP(strings.TrimSpace(ips[1])) != nil
+}
+
+type sniYAML struct {
+	SNI []map[string]interface{} `yaml:"sni"`
+}
+
+// sniFieldValues are the sni.yaml fields with a fixed set of values. A nil list is any value of the field's type.
+var sniFieldValues = map[string][]string{
+	"fqdn":                            nil,
+	"ip_allow":                        nil,
+	"verify_server_policy":            {"DISABLED", "PERMISSIVE", "ENFORCED"},
+	"verify_server_properties":        {"NONE", "SIGNATURE", "NAME", "ALL"},
+	"verify_client":                   {"NONE", "MODERATE", "STRICT"},
+	"verify_client_ca_certs":          nil,
+	"host_sni_policy":                 {"DISABLED", "PERMISSIVE", "ENFORCED"},
+	"valid_tls_versions_in":           nil,
+	"valid_tls_version_min_in":        nil,
+	"valid_tls_version_max_in":        nil,
+	"client_cert":                     nil,
+	"client_key":                      nil,
+	"client_sni_policy":               nil,
+	"disable_h2":                      nil,
+	"http2":                           nil,
+	"tunnel_route":                    nil,
+	"forward_route":                   nil,
+	"partial_blind_route":             nil,
+	"tunnel_alpn":                     nil,
+	"tunnel_prewarm":                  nil,
+	"tunnel_prewarm_min":              nil,
+	"tunnel_prewarm_max":              nil,
+	"tunnel_prewarm_rate":             nil,
+	"tunnel_prewarm_connect_timeout":  nil,
+	"tunnel_prewarm_inactive_timeout": nil,
+	"tunnel_prewarm_srv":              nil,
+}
+
+var sniTLSVersions = []string{"TLSv1", "TLSv1_1", "TLSv1_2", "TLSv1_3"}
+
+// checkSNIYAML checks sni.yaml entries have a unique fqdn, known fields, and valid policies and TLS versions.
+func checkSNIYAML(c *Checker, file t3cutil.ATSConfigFile, fs *fileSet) []Problem {
+	ps := newProblems(file.Name)
+	doc := sniYAML{}
+	if !unmarshalYAML(ps, file.Text, &doc) {
+		return ps.list
+	}
+	fqdnEntries := map[string]int{}
+	fqdnCounts := map[string]int{} // for the line number of duplicates
+	for i, entry := range doc.SNI {
+		fqdn, ok := entry["fqdn"].(string)
+		if !ok || fqdn == "" {
+			ps.Errorf(0, "sni entry %d has no fqdn", i)
+		} else if prev, ok := fqdnEntries[strings.ToLower(fqdn)]; ok {
+			ps.Errorf(findNthLine(file.Text, "fqdn", fqdn, fqdnCounts[fqdn]), "sni entry %d fqdn '%s' is the same as entry %d, ATS only uses the first", i, fqdn, prev)
+		} else {
+			fqdnEntries[strings.ToLower(fqdn)] = i
+		}
+		fqdnCounts[fqdn]++
+
+		keys := make([]string, 0, len(entry))
+		for key := range entry {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			val := entry[key]
+			valid, ok := sniFieldValues[key]
+			if !ok {
+				ps.Warnf(findLine(file.Text, key, ""), "sni entry %d has unknown field '%s'", i, key)
+				continue
+			}
+			if valid != nil {
+				if str, _ := val.(string); !containsStr(valid, str) {
+					ps.Errorf(findLine(file.Text, key, str), "sni entry %d %s '%v' must be one of %s", i, key, val, strings.Join(valid, ", "))
+				}
+			}
+		}
+
+		if val, ok := entry["disable_h2"]; ok {
+			if _, isBool := val.(bool); !isBool {
+				ps.Errorf(findLine(file.Text, "disable_h2", ""), "sni entry %d disable_h2 '%v' must be true or false", i, val)
+			}
+		}
+		if val, ok := entry["valid_tls_versions_in"]; ok {
+			versions, isList := val.([]interface{})
+			if !isList {
+				ps.Errorf(findLine(file.Text, "valid_tls_versions_in", ""), "sni entry %d valid_tls_versions_in must be a list", i)
+			}
+			for _, version := range versions {
+				if str, _ := version.(string); !containsStr(sniTLSVersions, str) {
+					ps.Errorf(findLine(file.Text, "valid_tls_versions_in", ""), "sni entry %d TLS version '%v' must be one of %s", i, version, strings.Join(sniTLSVersions, ", "))
+				}
+			}
+		}
+	}
+	return ps.list
+}
+
+// loggingYAML is logging.yaml. ATS 9 puts the formats, filters, and logs in a 'logging' object, earlier versions at the top level.
+type loggingYAML struct {
+	Logging *loggingYAMLSpec `yaml:"logging"`
+	Spec    loggingYAMLSpec  `yaml:",inline"`
+}
+
+type loggingYAMLSpec struct {
+	Formats []loggingYAMLFormat `yaml:"formats"`
+	Filters []loggingYAMLFilter `yaml:"filters"`
+	Logs    []loggingYAMLLog    `yaml:"logs"`
+}
+
+type loggingYAMLFormat struct {
+	Name     string `yaml:"name"`
+	Format   string `yaml:"format"`
+	Interval int    `yaml:"interval"`
+}
+
+type loggingYAMLFilter struct {
+	Name      string `yaml:"name"`
+	Action    string `yaml:"action"`
+	Condition string `yaml:"condition"`
+}
+
+type loggingYAMLLog struct {
+	Filename           string      `yaml:"filename"`
+	Format             string      `yaml:"format"`
+	Mode               string      `yaml:"mode"`
+	Header             string      `yaml:"header"`
+	RollingEnabled     interface{} `yaml:"rolling_enabled"`
+	RollingIntervalSec int         `yaml:"rolling_interval_sec"`
+	RollingOffsetHr    int         `yaml:"rolling_offset_hr"`
+	RollingSizeMB      int         `yaml:"rolling_size_mb"`
+	RollingMaxCount    int         `yaml:"rolling_max_count"`
+	RollingAllowEmpty  int         `yaml:"rolling_allow_empty"`
+	PipeBufferSize     int         `yaml:"pipe_buffer_size"`
+	Filters            []string    `yaml:"filters"`
+}
+
+// loggingPredefinedFormats are the formats ATS defines, which logs may use without defining them.
+var loggingPredefinedFormats = map[string]struct{}{
+	"squid":     {},
+	"common":    {},
+	"extended":  {},
+	"extended2": {},
+}
+
+// checkLoggingYAML checks logging.yaml has only known fields, formats and filters with unique names,
+// valid filter actions and log modes, and logs which only use defined formats and filters.
+func checkLoggingYAML(c *Checker, file t3cutil.ATSConfigFile, fs *fileSet) []Problem {
+	ps := newProblems(file.Name)
+	doc := loggingYAML{}
+	if !unmarshalYAML(ps, file.Text, &doc) {
+		return ps.list
+	}
+	spec := doc.Spec
+	if doc.Logging != nil {
+		spec = *doc.Logging
+	}
+
+	formats := map[string]struct{}{}
+	for _, format := range spec.Formats {
+		if format.Name == "" {
+			ps.Errorf(0, "format has no name")
+			continue
+		}
+		if _, ok := formats[format.Name]; ok {
+			ps.Errorf(findLine(file.Text, "name", format.Name), "format '%s' is defined more than once", format.Name)
+		}
+		formats[format.Name] = struct{}{}
+		if strings.TrimSpace(format.Format) == "" {
+			ps.Errorf(findLine(file.Text, "name", format.Name), "format '%s' has an empty format", format.Name)
+		}
+	}
+
+	filters := map[string]struct{}{}
+	for _, filter := range spec.Filters {
+		if filter.Name == "" {
+			ps.Errorf(0, "filter has no name")
+			continue
+		}
+		if _, ok := filters[filter.Name]; ok {
+			ps.Errorf(findLine(file.Text, "name", filter.Name), "filter '%s' is defined more than once", filter.Name)
+		}
+		filters[filter.Name] = struct{}{}
+		switch filter.Action {
+		case "accept", "reject", "wipe_field_value":
+		default:
+			ps.Errorf(findLine(file.Text, "action", filter.Action), "filter '%s' action '%s' must be accept, reject, or wipe_field_value", filter.Name, filter.Action)
+		}
+		if strings.TrimSpace(filter.Condition) == "" {
+			ps.Errorf(findLine(file.Text, "name", filter.Name), "filter '%s' has an empty condition", filter.Name)
+		}
+	}
+
+	for _, lg := range spec.Logs {
+		if lg.Filename == "" {
+			ps.Errorf(0, "log has no filename")
+			continue
+		}
+		lineNum := findLine(file.Text, "filename", lg.Filename)
+		if lg.Format != "" {
+			_, defined := formats[lg.Format]
+			_, predefined := loggingPredefinedFormats[lg.Format]
+			if !defined && !predefined {
+				ps.Errorf(lineNum, "log '%s' format '%s' isn't defined", lg.Filename, lg.Format)
+			}
+		}
+		switch lg.Mode {
+		case "", "ascii", "binary", "ascii_pipe":
+		default:
+			ps.Errorf(lineNum, "log '%s' mode '%s' must be ascii, binary, or ascii_pipe", lg.Filename, lg.Mode)
+		}
+		for _, filter := range lg.Filters {
+			if _, ok := filters[filter]; !ok {
+				ps.Errorf(lineNum, "log '%s' filter '%s' isn't defined", lg.Filename, filter)
+			}
+		}
+	}
+	return ps.list
+}
@@ -0,0 +1,100 @@
+package config
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"os"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/pborman/getopt/v2"
+)
+
+type Cfg struct {
+	CommandArgs            []string
+	LogLocationDebug       string
+	LogLocationWarn        string
+	LogLocationError       string
+	LogLocationInfo        string
+	TrafficServerConfigDir string
+}
+
+var defaultATSConfigDir = "/opt/trafficserver/etc/trafficserver"
+
+func (cfg Cfg) DebugLog() log.LogLocation   { return log.LogLocation(cfg.LogLocationDebug) }
+func (cfg Cfg) ErrorLog() log.LogLocation   { return log.LogLocation(cfg.LogLocationError) }
+func (cfg Cfg) InfoLog() log.LogLocation    { return log.LogLocation(cfg.LogLocationInfo) }
+func (cfg Cfg) WarningLog() log.LogLocation { return log.LogLocation(cfg.LogLocationWarn) }
+func (cfg Cfg) EventLog() log.LogLocation   { return log.LogLocation(log.LogLocationNull) } // event logging is not used.
+
+// Usage() writes command line options and usage to 'stderr'
+func Usage() {
+	getopt.PrintUsage(os.Stderr)
+	os.Exit(0)
+}
+
+// InitConfig() intializes the configuration variables and loggers.
+func InitConfig() (Cfg, error) {
+	atsConfigDirPtr := getopt.StringLong("trafficserver-config-dir", 'c', defaultATSConfigDir, "directory where ATS config files are stored.")
+	helpPtr := getopt.BoolLong("help", 'h', "Print usage information and exit")
+	verbosePtr := getopt.CounterLong("verbose", 'v', `Log verbosity. Logging is output to stderr. By default, errors are logged. To log warnings, pass '-v'. To log info, pass '-vv'. To omit error logging, see '-s'`)
+	silentPtr := getopt.BoolLong("silent", 's', `Silent. Errors are not logged, and the 'verbose' flag is ignored. If a fatal error occurs, the return code will be non-zero but no text will be output to stderr`)
+
+	getopt.Parse()
+
+	if *helpPtr == true {
+		Usage()
+	}
+
+	logLocationError := log.LogLocationStderr
+	logLocationWarn := log.LogLocationNull
+	logLocationInfo := log.LogLocationNull
+	logLocationDebug := log.LogLocationNull
+	if *silentPtr {
+		logLocationError = log.LogLocationNull
+	} else {
+		if *verbosePtr >= 1 {
+			logLocationWarn = log.LogLocationStderr
+		}
+		if *verbosePtr >= 2 {
+			logLocationInfo = log.LogLocationStderr
+			logLocationDebug = log.LogLocationStderr // t3c only has 3 verbosity options: none (-s), error (default or --verbose=0), warning (-v), and info (-vv). Any code calling log.Debug is treated as Info.
+		}
+	}
+
+	if *verbosePtr > 2 {
+		return Cfg{}, errors.New("Too many verbose options. The maximum log verbosity level is 2 (-vv or --verbose=2) for errors (0), warnings (1), and info (2)")
+	}
+
+	cfg := Cfg{
+		CommandArgs:            getopt.Args(),
+		LogLocationDebug:       logLocationDebug,
+		LogLocationError:       logLocationError,
+		LogLocationInfo:        logLocationInfo,
+		LogLocationWarn:        logLocationWarn,
+		TrafficServerConfigDir: *atsConfigDirPtr,
+	}
+
+	if err := log.InitCfg(cfg); err != nil {
+		return Cfg{}, errors.New("initializing loggers: " + err.Error())
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-check-config/checkconfig"
+	"github.com/apache/trafficcontrol/cache-config/t3c-check-config/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+const (
+	ExitCodeSuccess     = 0
+	ExitCodeProblems    = 1
+	ExitCodeConfigError = 2
+	ExitCodeInputError  = 3
+)
+
+func main() {
+	cfg, err := config.InitConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+		os.Exit(ExitCodeConfigError)
+	}
+
+	files, err := readFiles(cfg.CommandArgs)
+	if err != nil {
+		log.Errorln("reading config files: " + err.Error())
+		os.Exit(ExitCodeInputError)
+	}
+
+	problems := checkconfig.New(cfg.TrafficServerConfigDir).Check(files)
+	for _, problem := range problems {
+		fmt.Println(problem.String())
+	}
+
+	if checkconfig.HasErrors(problems) {
+		log.Errorf("config files have errors\n")
+		os.Exit(ExitCodeProblems)
+	}
+	log.Infof("checked %d config files, %d warnings\n", len(files), len(problems))
+	os.Exit(ExitCodeSuccess)
+}
+
+// readFiles reads the files at the given paths, or if there are no paths,
+// a JSON array of t3cutil.ATSConfigFile objects from stdin, as output by t3c-generate.
+func readFiles(paths []string) ([]t3cutil.ATSConfigFile, error) {
+	if len(paths) == 0 {
+		files := []t3cutil.ATSConfigFile{}
+		if err := json.NewDecoder(os.Stdin).Decode(&files); err != nil {
+			return nil, errors.New("decoding stdin: " + err.Error())
+		}
+		return files, nil
+	}
+
+	files := []t3cutil.ATSConfigFile{}
+	for _, path := range paths {
+		bts, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.New("reading '" + path + "': " + err.Error())
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, errors.New("getting absolute path of '" + path + "': " + err.Error())
+		}
+		files = append(files, t3cutil.ATSConfigFile{
+			Name: filepath.Base(absPath),
+			Path: filepath.Dir(absPath),
+			Text: string(bts),
+		})
+	}
+	return files, nil
+}
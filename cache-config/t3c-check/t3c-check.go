@@ -29,6 +29,7 @@ import (
 )
 
 var commands = map[string]struct{}{
+	"config": {},
 	"refs":   {},
 	"reload": {},
 }
@@ -89,6 +90,7 @@ For the arguments of a command, see 't3c-check <command> --help'.
 
 These are the available commands:
 
+  config  if config files are valid
   reload  if a reload or restart is needed
   refs    if a config file's referenced plugins and files are valid
 `
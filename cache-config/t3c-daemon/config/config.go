@@ -0,0 +1,192 @@
+package config
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	applyconfig "github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/pborman/getopt/v2"
+)
+
+const AppName = "t3c-daemon"
+const Version = "0.1"
+const UserAgent = AppName + "/" + Version
+
+const DefaultStatusSocket = "/var/run/t3c-daemon.sock"
+
+type Cfg struct {
+	LogLocationDebug string
+	LogLocationError string
+	LogLocationInfo  string
+	LogLocationWarn  string
+
+	// PollInterval is the time between requests for the server's update status.
+	PollInterval time.Duration
+	// PollJitter is the maximum random time added to each PollInterval, to spread the load of many caches on Traffic Ops.
+	PollJitter time.Duration
+	// WaitForParents is whether to wait for parents to apply updates, with the same meaning as t3c-apply.
+	WaitForParents applyconfig.WaitForParentsFlag
+	// StatusSocket is the path of the unix socket to serve the daemon status on. If empty, no status socket is served.
+	StatusSocket string
+	// ApplyArgs are the extra arguments passed to every t3c-apply run.
+	ApplyArgs []string
+
+	t3cutil.TCCfg
+}
+
+func (cfg Cfg) DebugLog() log.LogLocation   { return log.LogLocation(cfg.LogLocationDebug) }
+func (cfg Cfg) ErrorLog() log.LogLocation   { return log.LogLocation(cfg.LogLocationError) }
+func (cfg Cfg) InfoLog() log.LogLocation    { return log.LogLocation(cfg.LogLocationInfo) }
+func (cfg Cfg) WarningLog() log.LogLocation { return log.LogLocation(cfg.LogLocationWarn) }
+func (cfg Cfg) EventLog() log.LogLocation   { return log.LogLocation(log.LogLocationNull) } // event logging is not used.
+
+// Usage() writes command line options and usage to 'stderr'
+func Usage() {
+	getopt.PrintUsage(os.Stderr)
+	os.Exit(0)
+}
+
+// InitConfig() intializes the configuration variables and loggers.
+func InitConfig() (Cfg, error) {
+	cacheHostNamePtr := getopt.StringLong("cache-host-name", 'H', "", "Host name of the cache to generate config for. Must be the server host name in Traffic Ops, not a URL, and not the FQDN")
+	pollIntervalPtr := getopt.IntLong("poll-interval", 'i', 60, "[seconds] time between requests for the server's update status, default is 60")
+	pollJitterPtr := getopt.IntLong("poll-jitter", 'j', 30, "[seconds] wait a random number of seconds between 0 and [seconds] in addition to the poll interval, to spread the load on Traffic Ops, default is 30")
+	waitForParentsPtr := getopt.StringLong("wait-for-parents", 'W', "reval", "[true | false | reval] do not apply updates while parents have pending updates, with the same meaning as t3c-apply. default is reval")
+	statusSocketPtr := getopt.StringLong("status-socket", 'S', DefaultStatusSocket, "Path of the unix socket to serve the daemon status on. If empty, no status socket is served. Default is "+DefaultStatusSocket)
+	toInsecurePtr := getopt.BoolLong("traffic-ops-insecure", 'I', "[true | false] ignore certificate errors from Traffic Ops")
+	toTimeoutMSPtr := getopt.IntLong("traffic-ops-timeout-milliseconds", 't', 30000, "Timeout in milli-seconds for Traffic Ops requests, default is 30000")
+	toURLPtr := getopt.StringLong("traffic-ops-url", 'u', "", "Traffic Ops URL. Must be the full URL, including the scheme. Required. May also be set with the environment variable TO_URL")
+	toUserPtr := getopt.StringLong("traffic-ops-user", 'U', "", "Traffic Ops username. Required. May also be set with the environment variable TO_USER")
+	toPassPtr := getopt.StringLong("traffic-ops-password", 'P', "", "Traffic Ops password. Required. May also be set with the environment variable TO_PASS")
+	helpPtr := getopt.BoolLong("help", 'h', "Print usage information and exit")
+	versionPtr := getopt.BoolLong("version", 'V', "Print the version")
+	verbosePtr := getopt.CounterLong("verbose", 'v', `Log verbosity. Logging is output to stderr. By default, errors are logged. To log warnings, pass '-v'. To log info, pass '-vv'. To omit error logging, see '-s'`)
+	silentPtr := getopt.BoolLong("silent", 's', `Silent. Errors are not logged, and the 'verbose' flag is ignored. If a fatal error occurs, the return code will be non-zero but no text will be output to stderr`)
+
+	getopt.Parse()
+
+	if *helpPtr == true {
+		Usage()
+	}
+	if *versionPtr == true {
+		fmt.Println(AppName + " v" + Version)
+		os.Exit(0)
+	}
+
+	logLocationError := log.LogLocationStderr
+	logLocationWarn := log.LogLocationNull
+	logLocationInfo := log.LogLocationNull
+	logLocationDebug := log.LogLocationNull
+	if *silentPtr {
+		logLocationError = log.LogLocationNull
+	} else {
+		if *verbosePtr >= 1 {
+			logLocationWarn = log.LogLocationStderr
+		}
+		if *verbosePtr >= 2 {
+			logLocationInfo = log.LogLocationStderr
+			logLocationDebug = log.LogLocationStderr // t3c only has 3 verbosity options: none (-s), error (default or --verbose=0), warning (-v), and info (-vv). Any code calling log.Debug is treated as Info.
+		}
+	}
+
+	if *verbosePtr > 2 {
+		return Cfg{}, errors.New("Too many verbose options. The maximum log verbosity level is 2 (-vv or --verbose=2) for errors (0), warnings (1), and info (2)")
+	}
+
+	if *pollIntervalPtr < 1 {
+		return Cfg{}, errors.New("poll-interval must be at least 1 second")
+	}
+	if *pollJitterPtr < 0 {
+		return Cfg{}, errors.New("poll-jitter must not be negative")
+	}
+
+	waitForParents := applyconfig.StrToWaitForParentsFlag(*waitForParentsPtr)
+	if waitForParents == applyconfig.WaitForParentsInvalid {
+		return Cfg{}, errors.New("invalid wait-for-parents value '" + *waitForParentsPtr + "' valid options are true, false, reval")
+	}
+
+	toTimeoutMS := time.Millisecond * time.Duration(*toTimeoutMSPtr)
+	toURL := *toURLPtr
+	toUser := *toUserPtr
+	toPass := *toPassPtr
+
+	urlSourceStr := "argument" // for error messages
+	if toURL == "" {
+		urlSourceStr = "environment variable"
+		toURL = os.Getenv("TO_URL")
+	}
+	if toUser == "" {
+		toUser = os.Getenv("TO_USER")
+	}
+	if *toPassPtr == "" {
+		toPass = os.Getenv("TO_PASS")
+	}
+
+	toURLParsed, err := url.Parse(toURL)
+	if err != nil {
+		return Cfg{}, errors.New("parsing Traffic Ops URL from " + urlSourceStr + " '" + toURL + "': " + err.Error())
+	} else if err := t3cutil.ValidateURL(toURLParsed); err != nil {
+		return Cfg{}, errors.New("invalid Traffic Ops URL from " + urlSourceStr + " '" + toURL + "': " + err.Error())
+	}
+
+	var cacheHostName string
+	if len(*cacheHostNamePtr) > 0 {
+		cacheHostName = *cacheHostNamePtr
+	} else {
+		cacheHostName, err = os.Hostname()
+		if err != nil {
+			return Cfg{}, errors.New("could not get the OS hostname, please supply a hostname: " + err.Error())
+		}
+	}
+
+	cfg := Cfg{
+		LogLocationDebug: logLocationDebug,
+		LogLocationError: logLocationError,
+		LogLocationInfo:  logLocationInfo,
+		LogLocationWarn:  logLocationWarn,
+		PollInterval:     time.Second * time.Duration(*pollIntervalPtr),
+		PollJitter:       time.Second * time.Duration(*pollJitterPtr),
+		WaitForParents:   waitForParents,
+		StatusSocket:     *statusSocketPtr,
+		ApplyArgs:        getopt.Args(),
+		TCCfg: t3cutil.TCCfg{
+			CacheHostName: cacheHostName,
+			TOInsecure:    *toInsecurePtr,
+			TOTimeoutMS:   toTimeoutMS,
+			TOUser:        toUser,
+			TOPass:        toPass,
+			TOURL:         toURLParsed,
+			UserAgent:     UserAgent,
+		},
+	}
+
+	if err := log.InitCfg(cfg); err != nil {
+		return Cfg{}, errors.New("initializing loggers: " + err.Error())
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,302 @@
+package daemon
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	applyconfig "github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/cache-config/t3c-daemon/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// State is what the daemon is currently doing.
+type State string
+
+const (
+	StateStarting          State = "starting"
+	StateIdle              State = "idle"
+	StateWaitingForParents State = "waiting-for-parents"
+	StateApplying          State = "applying"
+)
+
+// Status is the state of the daemon, as served on the status socket.
+type Status struct {
+	HostName  string    `json:"hostName"`
+	State     State     `json:"state"`
+	StartTime time.Time `json:"startTime"`
+
+	// UpdateStatus is the latest update status of the server received from Traffic Ops.
+	UpdateStatus *tc.ServerUpdateStatus `json:"updateStatus"`
+	// LastModified is the Last-Modified of the latest update status, sent as the If-Modified-Since of the next poll.
+	LastModified  string    `json:"lastModified"`
+	LastPoll      time.Time `json:"lastPoll"`
+	LastPollError string    `json:"lastPollError"`
+	NextPoll      time.Time `json:"nextPoll"`
+	Polls         uint64    `json:"polls"`
+	PollErrors    uint64    `json:"pollErrors"`
+	// NotModified is the number of polls to which Traffic Ops returned 304 Not Modified.
+	NotModified uint64 `json:"notModified"`
+
+	LastApply     *ApplyResult `json:"lastApply"`
+	Applies       uint64       `json:"applies"`
+	ApplyFailures uint64       `json:"applyFailures"`
+}
+
+// ApplyResult is the result of a single t3c-apply run.
+type ApplyResult struct {
+	Mode       t3cutil.Mode `json:"mode"`
+	StartTime  time.Time    `json:"startTime"`
+	DurationMS int64        `json:"durationMs"`
+	ExitCode   int          `json:"exitCode"`
+}
+
+// Daemon polls Traffic Ops for the update status of a cache server, and runs t3c-apply when it has updates to apply.
+type Daemon struct {
+	cfg   config.Cfg
+	tccfg *t3cutil.TCCfg
+
+	// getUpdateStatus and apply are funcs so tests can replace the requests to Traffic Ops and the t3c-apply runs.
+	getUpdateStatus func(lastModified string) (*tc.ServerUpdateStatus, string, error)
+	apply           func(mode t3cutil.Mode) int
+
+	statusMutex sync.Mutex
+	status      Status
+}
+
+// New creates a new Daemon. The daemon doesn't log in to Traffic Ops until it's started with Run.
+func New(cfg config.Cfg) *Daemon {
+	d := &Daemon{
+		cfg: cfg,
+		status: Status{
+			HostName:  cfg.CacheHostName,
+			State:     StateStarting,
+			StartTime: time.Now(),
+		},
+	}
+	d.getUpdateStatus = d.requestUpdateStatus
+	d.apply = d.runApply
+	return d
+}
+
+// Status returns a copy of the daemon's current status.
+func (d *Daemon) Status() Status {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	return d.status
+}
+
+func (d *Daemon) setStatus(f func(st *Status)) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	f(&d.status)
+}
+
+// Run polls Traffic Ops and applies updates until stop is closed.
+// If an update is being applied when stop is closed, Run waits for t3c-apply to finish before returning.
+func (d *Daemon) Run(stop <-chan struct{}) {
+	// wait a random time before the first poll, so restarting many caches at once doesn't make them all poll together.
+	wait := jitter(d.cfg.PollJitter)
+	for {
+		d.setStatus(func(st *Status) { st.NextPoll = time.Now().Add(wait) })
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+		d.poll()
+		wait = d.cfg.PollInterval + jitter(d.cfg.PollJitter)
+	}
+}
+
+// poll requests the update status from Traffic Ops once, and runs t3c-apply if there are updates to apply.
+func (d *Daemon) poll() {
+	prev := d.Status()
+	updateStatus, lastModified, err := d.getUpdateStatus(prev.LastModified)
+	now := time.Now()
+	if err != nil {
+		log.Errorln("polling update status: " + err.Error())
+		d.setStatus(func(st *Status) {
+			st.LastPoll = now
+			st.LastPollError = err.Error()
+			st.Polls++
+			st.PollErrors++
+		})
+		return
+	}
+
+	notModified := updateStatus == nil
+	if notModified {
+		log.Infoln("update status not modified")
+		updateStatus = prev.UpdateStatus
+	} else {
+		log.Infof("update status: %+v\n", *updateStatus)
+	}
+	d.setStatus(func(st *Status) {
+		st.LastPoll = now
+		st.LastPollError = ""
+		st.Polls++
+		if notModified {
+			st.NotModified++
+		}
+		st.UpdateStatus = updateStatus
+		st.LastModified = lastModified
+	})
+	if updateStatus == nil {
+		// Traffic Ops returned Not Modified to the first poll. This should never happen, because the first poll's If-Modified-Since is the epoch.
+		d.setStatus(func(st *Status) { st.State = StateIdle; st.LastModified = "" })
+		return
+	}
+
+	mode, waitingForParents := NextMode(*updateStatus, d.cfg.WaitForParents)
+	if mode == t3cutil.ModeInvalid {
+		state := StateIdle
+		if waitingForParents {
+			log.Infoln("updates are pending, waiting for parents")
+			state = StateWaitingForParents
+		}
+		d.setStatus(func(st *Status) { st.State = state })
+		return
+	}
+
+	log.Infoln("running t3c-apply in " + mode.String() + " mode")
+	d.setStatus(func(st *Status) { st.State = StateApplying })
+	start := time.Now()
+	code := d.apply(mode)
+	result := &ApplyResult{
+		Mode:       mode,
+		StartTime:  start,
+		DurationMS: int64(time.Since(start) / time.Millisecond),
+		ExitCode:   code,
+	}
+	if code != 0 {
+		log.Errorf("t3c-apply in %s mode failed with exit code %d, retrying at the next poll\n", mode, code)
+	} else {
+		log.Infoln("t3c-apply in " + mode.String() + " mode succeeded")
+	}
+	d.setStatus(func(st *Status) {
+		st.State = StateIdle
+		st.LastApply = result
+		st.Applies++
+		if code != 0 {
+			st.ApplyFailures++
+		}
+	})
+}
+
+// NextMode returns the t3c-apply mode to run for the given update status, and ModeInvalid if there is nothing to apply.
+// The returned bool is whether updates are pending but are being held back because parents still have pending updates.
+//
+// This mirrors the wait-for-parents logic of t3c-apply, so t3c-apply isn't run only to find its parents aren't ready.
+func NextMode(status tc.ServerUpdateStatus, waitForParents applyconfig.WaitForParentsFlag) (t3cutil.Mode, bool) {
+	waiting := false
+	if status.UpdatePending {
+		parentsBlock := status.ParentPending &&
+			(waitForParents == applyconfig.WaitForParentsTrue ||
+				(waitForParents == applyconfig.WaitForParentsReval && !status.UseRevalPending))
+		if !parentsBlock {
+			return t3cutil.ModeSyncDS, false
+		}
+		waiting = true
+	}
+	if status.UseRevalPending && status.RevalPending {
+		parentsBlock := status.ParentRevalPending &&
+			(waitForParents == applyconfig.WaitForParentsTrue || waitForParents == applyconfig.WaitForParentsReval)
+		if !parentsBlock {
+			return t3cutil.ModeRevalidate, false
+		}
+		waiting = true
+	}
+	return t3cutil.ModeInvalid, waiting
+}
+
+// requestUpdateStatus gets the update status from Traffic Ops, logging in if necessary.
+// The same session is used for every poll, until Traffic Ops rejects it.
+func (d *Daemon) requestUpdateStatus(lastModified string) (*tc.ServerUpdateStatus, string, error) {
+	if d.tccfg == nil {
+		tccfg := d.cfg.TCCfg
+		connected, err := t3cutil.TOConnect(&tccfg)
+		if err != nil {
+			return nil, "", err
+		}
+		d.tccfg = connected
+	}
+
+	status, newLastModified, err := t3cutil.GetServerUpdateStatusIfModified(*d.tccfg, lastModified)
+	statusErr := (*t3cutil.TOStatusError)(nil)
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden) {
+		// the session expired, log in again at the next poll
+		d.tccfg = nil
+	}
+	return status, newLastModified, err
+}
+
+// runApply runs t3c-apply in the given mode, and returns its exit code.
+// The daemon already waited for updates and parents, so t3c-apply is told not to sleep.
+func (d *Daemon) runApply(mode t3cutil.Mode) int {
+	args := []string{
+		"--run-mode=" + mode.String(),
+		"--dispersion=0",
+		"--reval-wait-time=0",
+		"--wait-for-parents=" + string(d.cfg.WaitForParents),
+		"--cache-host-name=" + d.cfg.CacheHostName,
+		"--traffic-ops-timeout-milliseconds=" + strconv.FormatInt(int64(d.cfg.TOTimeoutMS/time.Millisecond), 10),
+	}
+	if d.cfg.TOInsecure {
+		args = append(args, "--traffic-ops-insecure")
+	}
+	args = append(args, d.cfg.ApplyArgs...)
+
+	cmd := exec.Command("t3c-apply", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// The credentials are passed in the environment rather than arguments, so they aren't visible in the process list.
+	cmd.Env = append(os.Environ(),
+		"TO_URL="+d.cfg.TOURL.String(),
+		"TO_USER="+d.cfg.TOUser,
+		"TO_PASS="+d.cfg.TOPass,
+	)
+	if err := cmd.Run(); err != nil {
+		exitErr := (*exec.ExitError)(nil)
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		log.Errorln("running t3c-apply: " + err.Error())
+		return -1
+	}
+	return 0
+}
+
+// jitter returns a random duration between 0 and max.
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
@@ -0,0 +1,222 @@
+package daemon
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	applyconfig "github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/cache-config/t3c-daemon/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+func TestNextMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  tc.ServerUpdateStatus
+		wait    applyconfig.WaitForParentsFlag
+		mode    t3cutil.Mode
+		waiting bool
+	}{
+		{
+			name:   "nothing pending",
+			status: tc.ServerUpdateStatus{UseRevalPending: true},
+			wait:   applyconfig.WaitForParentsTrue,
+			mode:   t3cutil.ModeInvalid,
+		},
+		{
+			name:   "update pending",
+			status: tc.ServerUpdateStatus{UseRevalPending: true, UpdatePending: true},
+			wait:   applyconfig.WaitForParentsTrue,
+			mode:   t3cutil.ModeSyncDS,
+		},
+		{
+			name:    "update pending, parents pending, wait",
+			status:  tc.ServerUpdateStatus{UseRevalPending: true, UpdatePending: true, ParentPending: true},
+			wait:    applyconfig.WaitForParentsTrue,
+			mode:    t3cutil.ModeInvalid,
+			waiting: true,
+		},
+		{
+			name:   "update pending, parents pending, wait reval",
+			status: tc.ServerUpdateStatus{UseRevalPending: true, UpdatePending: true, ParentPending: true},
+			wait:   applyconfig.WaitForParentsReval,
+			mode:   t3cutil.ModeSyncDS,
+		},
+		{
+			name:    "update pending, parents pending, wait reval, no separate reval",
+			status:  tc.ServerUpdateStatus{UseRevalPending: false, UpdatePending: true, ParentPending: true},
+			wait:    applyconfig.WaitForParentsReval,
+			mode:    t3cutil.ModeInvalid,
+			waiting: true,
+		},
+		{
+			name:   "update pending, parents pending, don't wait",
+			status: tc.ServerUpdateStatus{UseRevalPending: false, UpdatePending: true, ParentPending: true},
+			wait:   applyconfig.WaitForParentsFalse,
+			mode:   t3cutil.ModeSyncDS,
+		},
+		{
+			name:   "reval pending",
+			status: tc.ServerUpdateStatus{UseRevalPending: true, RevalPending: true},
+			wait:   applyconfig.WaitForParentsReval,
+			mode:   t3cutil.ModeRevalidate,
+		},
+		{
+			name:   "reval pending, no separate reval",
+			status: tc.ServerUpdateStatus{UseRevalPending: false, RevalPending: true},
+			wait:   applyconfig.WaitForParentsReval,
+			mode:   t3cutil.ModeInvalid,
+		},
+		{
+			name:    "reval pending, parents reval pending, wait reval",
+			status:  tc.ServerUpdateStatus{UseRevalPending: true, RevalPending: true, ParentRevalPending: true},
+			wait:    applyconfig.WaitForParentsReval,
+			mode:    t3cutil.ModeInvalid,
+			waiting: true,
+		},
+		{
+			name:   "update blocked by parents, reval not blocked",
+			status: tc.ServerUpdateStatus{UseRevalPending: true, UpdatePending: true, ParentPending: true, RevalPending: true},
+			wait:   applyconfig.WaitForParentsTrue,
+			mode:   t3cutil.ModeRevalidate,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mode, waiting := NextMode(test.status, test.wait)
+			if mode != test.mode {
+				t.Errorf("expected mode '%s', actual '%s'", test.mode, mode)
+			}
+			if waiting != test.waiting {
+				t.Errorf("expected waiting %v, actual %v", test.waiting, waiting)
+			}
+		})
+	}
+}
+
+func TestPoll(t *testing.T) {
+	d := New(config.Cfg{WaitForParents: applyconfig.WaitForParentsReval})
+
+	statuses := []*tc.ServerUpdateStatus{
+		&tc.ServerUpdateStatus{UseRevalPending: true, UpdatePending: true},
+		nil, // not modified, the failed apply should be retried
+		&tc.ServerUpdateStatus{UseRevalPending: true},
+	}
+	lastModifieds := []string{}
+	d.getUpdateStatus = func(lastModified string) (*tc.ServerUpdateStatus, string, error) {
+		lastModifieds = append(lastModifieds, lastModified)
+		status := statuses[0]
+		statuses = statuses[1:]
+		return status, "Mon, 21 Jun 2021 19:17:53 GMT", nil
+	}
+	applies := []t3cutil.Mode{}
+	d.apply = func(mode t3cutil.Mode) int {
+		applies = append(applies, mode)
+		if len(applies) == 1 {
+			return 1
+		}
+		return 0
+	}
+
+	d.poll()
+	st := d.Status()
+	if st.Applies != 1 || st.ApplyFailures != 1 || st.LastApply == nil || st.LastApply.ExitCode != 1 {
+		t.Errorf("expected 1 failed apply, actual status %+v", st)
+	}
+
+	d.poll()
+	st = d.Status()
+	if st.NotModified != 1 {
+		t.Errorf("expected 1 not modified poll, actual %v", st.NotModified)
+	}
+	if st.Applies != 2 || st.ApplyFailures != 1 {
+		t.Errorf("expected failed apply to be retried when not modified, actual status %+v", st)
+	}
+
+	d.poll()
+	st = d.Status()
+	if st.Applies != 2 {
+		t.Errorf("expected no apply when nothing is pending, actual %v applies", st.Applies)
+	}
+	if st.State != StateIdle {
+		t.Errorf("expected state '%s', actual '%s'", StateIdle, st.State)
+	}
+	if st.Polls != 3 {
+		t.Errorf("expected 3 polls, actual %v", st.Polls)
+	}
+
+	if len(applies) != 2 || applies[0] != t3cutil.ModeSyncDS || applies[1] != t3cutil.ModeSyncDS {
+		t.Errorf("expected 2 syncds applies, actual %v", applies)
+	}
+	if len(lastModifieds) != 3 || lastModifieds[0] != "" || lastModifieds[1] != "Mon, 21 Jun 2021 19:17:53 GMT" {
+		t.Errorf("expected polls to send the previous Last-Modified, actual %v", lastModifieds)
+	}
+}
+
+func TestPollError(t *testing.T) {
+	d := New(config.Cfg{WaitForParents: applyconfig.WaitForParentsReval})
+	d.getUpdateStatus = func(lastModified string) (*tc.ServerUpdateStatus, string, error) {
+		return nil, "", errors.New("connection refused")
+	}
+	d.apply = func(mode t3cutil.Mode) int {
+		t.Errorf("expected no apply after poll error, actual apply in mode %s", mode)
+		return 0
+	}
+
+	d.poll()
+	st := d.Status()
+	if st.PollErrors != 1 || st.LastPollError != "connection refused" {
+		t.Errorf("expected poll error, actual status %+v", st)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	d := New(config.Cfg{TCCfg: t3cutil.TCCfg{CacheHostName: "edge"}})
+	d.setStatus(func(st *Status) {
+		st.State = StateWaitingForParents
+		st.LastPoll = time.Date(2021, 6, 21, 19, 17, 53, 0, time.UTC)
+	})
+
+	w := httptest.NewRecorder()
+	d.statusHandler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected code %v, actual %v", http.StatusOK, w.Code)
+	}
+	st := Status{}
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+		t.Fatalf("unmarshalling status: %v", err)
+	}
+	if st.HostName != "edge" || st.State != StateWaitingForParents || !st.LastPoll.Equal(d.Status().LastPoll) {
+		t.Errorf("expected served status to match daemon status, actual %+v", st)
+	}
+
+	w = httptest.NewRecorder()
+	d.statusHandler(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected code %v for POST, actual %v", http.StatusMethodNotAllowed, w.Code)
+	}
+}
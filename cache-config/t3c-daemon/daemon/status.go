@@ -0,0 +1,67 @@
+package daemon
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// ServeStatus serves the daemon status as JSON over HTTP on the unix socket at path.
+// Any existing file at path is removed first, which is usually a socket left by a previous daemon which didn't exit cleanly.
+//
+// The returned listener must be closed when the daemon exits, which also removes the socket.
+func (d *Daemon) ServeStatus(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, errors.New("removing old status socket '" + path + "': " + err.Error())
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.New("listening on status socket '" + path + "': " + err.Error())
+	}
+	go func() {
+		if err := http.Serve(listener, http.HandlerFunc(d.statusHandler)); err != nil {
+			log.Infoln("status socket closed: " + err.Error())
+		}
+	}()
+	return listener, nil
+}
+
+func (d *Daemon) statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	bts, err := json.MarshalIndent(d.Status(), "", "  ")
+	if err != nil {
+		log.Errorln("marshalling status: " + err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+	w.Write(append(bts, '\n'))
+}
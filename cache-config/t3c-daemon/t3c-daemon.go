@@ -0,0 +1,72 @@
+package main
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-daemon/config"
+	"github.com/apache/trafficcontrol/cache-config/t3c-daemon/daemon"
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+const ExitCodeSuccess = 0
+const ExitCodeConfigError = 1
+const ExitCodeStatusSocketError = 2
+
+func main() {
+	cfg, err := config.InitConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+		os.Exit(ExitCodeConfigError)
+	}
+	log.Infoln("configuration initialized")
+
+	rand.Seed(time.Now().UnixNano())
+
+	d := daemon.New(cfg)
+
+	if cfg.StatusSocket != "" {
+		listener, err := d.ServeStatus(cfg.StatusSocket)
+		if err != nil {
+			log.Errorln(err.Error())
+			os.Exit(ExitCodeStatusSocketError)
+		}
+		defer listener.Close()
+		log.Infoln("serving status on '" + cfg.StatusSocket + "'")
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Infoln("received signal '" + sig.String() + "', stopping")
+		close(stop)
+	}()
+
+	d.Run(stop)
+	log.Infoln("stopped")
+}
@@ -0,0 +1,203 @@
+package filediff
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"sort"
+	"strings"
+)
+
+// recordsLines keys records.config lines by their record name.
+// ATS uses the last line of a record, so earlier lines of the same record are ignored.
+// Lines which aren't records are keyed by the entire line.
+func recordsLines(lines []string) []keyedLine {
+	keyed := []keyedLine{}
+	keyIndex := map[string]int{}
+	for _, line := range lines {
+		key := line
+		if fields := strings.Fields(line); len(fields) >= 4 && (fields[0] == "CONFIG" || fields[0] == "LOCAL") {
+			key = fields[1]
+		}
+		kl := keyedLine{Key: key, Line: line, Cmp: line}
+		if i, ok := keyIndex[key]; ok {
+			keyed[i] = kl
+			continue
+		}
+		keyIndex[key] = len(keyed)
+		keyed = append(keyed, kl)
+	}
+	return keyed
+}
+
+// diffRemap compares remap.config rules keyed by their type and from-URL.
+//
+// Filter directives such as .activatefilter apply to the rules after them, so if either file has directives,
+// the order of rules matters, and the files are compared as text.
+func diffRemap(a string, b string) []string {
+	aLines := joinContinuations(textLines(a))
+	bLines := joinContinuations(textLines(b))
+	if hasRemapDirective(aLines) || hasRemapDirective(bLines) {
+		return diffText(a, b)
+	}
+	return diffKeyed(remapLines(aLines), remapLines(bLines))
+}
+
+// joinContinuations joins lines ending in a backslash with the line after them.
+func joinContinuations(lines []string) []string {
+	joined := []string{}
+	cont := ""
+	for _, line := range lines {
+		if strings.HasSuffix(line, `\`) {
+			cont += strings.TrimSpace(strings.TrimSuffix(line, `\`)) + " "
+			continue
+		}
+		joined = append(joined, cont+line)
+		cont = ""
+	}
+	if cont != "" {
+		joined = append(joined, strings.TrimSpace(cont))
+	}
+	return joined
+}
+
+func hasRemapDirective(lines []string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// remapLines keys remap.config rules by their type and from-URL.
+// Plugin and parameter order is significant, so the rest of the rule is compared as-is.
+//
+// ATS uses the first rule which matches a request, so the order of rules which can match the same request is significant:
+// regex_map rules, and map rules of the same host where one path is a prefix of the other.
+// ATS ranks regex and non-regex rules of the same table together by line, so a regex_map and a map rule overlap too.
+// Each rule is compared along with the keys of the earlier rules it overlaps, so reordering them is a diff.
+func remapLines(lines []string) []keyedLine {
+	keyed := make([]keyedLine, 0, len(lines))
+	rules := []remapRule{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			keyed = append(keyed, keyedLine{Key: line, Line: line, Cmp: line})
+			continue
+		}
+		rule := makeRemapRule(fields[0], fields[1])
+		cmp := line
+		for _, earlier := range rules {
+			if rule.overlaps(earlier) {
+				cmp += "\n after " + earlier.key
+			}
+		}
+		rules = append(rules, rule)
+		keyed = append(keyed, keyedLine{Key: rule.key, Line: line, Cmp: cmp})
+	}
+	return keyed
+}
+
+// remapRule is the part of a remap.config rule which determines the requests it matches.
+type remapRule struct {
+	key string
+	// table is the ATS mapping table the rule is in, e.g. map and regex_map rules are both in the forward mapping table.
+	table string
+	regex bool
+	// host is the scheme and host of the from-URL, and path is the rest.
+	host string
+	path string
+}
+
+func makeRemapRule(typ string, from string) remapRule {
+	rule := remapRule{key: typ + " " + from, table: remapTable(typ), regex: strings.HasPrefix(typ, "regex_")}
+	hostStart := 0
+	if i := strings.Index(from, "://"); i >= 0 {
+		hostStart = i + len("://")
+	}
+	rule.host = from
+	if i := strings.Index(from[hostStart:], "/"); i >= 0 {
+		rule.host = from[:hostStart+i]
+		rule.path = from[hostStart+i:]
+	}
+	return rule
+}
+
+// remapTable returns the ATS mapping table rules of the given type are in.
+// Rules in different tables never match the same request, e.g. reverse_map rules only rewrite responses.
+func remapTable(typ string) string {
+	typ = strings.TrimPrefix(typ, "regex_")
+	if typ == "map_with_referer" {
+		return "map"
+	}
+	return typ
+}
+
+// overlaps returns whether the rules may match the same request, so their order is significant.
+func (rule remapRule) overlaps(other remapRule) bool {
+	if rule.table != other.table {
+		return false
+	}
+	if rule.regex || other.regex {
+		return true // regexes may match any host
+	}
+	return rule.host == other.host && (strings.HasPrefix(rule.path, other.path) || strings.HasPrefix(other.path, rule.path))
+}
+
+// parentSpecifiers are the parent.config fields which select the requests a line applies to.
+// Every other field is an action.
+var parentSpecifiers = map[string]struct{}{
+	"dest_domain": struct{}{},
+	"dest_host":   struct{}{},
+	"dest_ip":     struct{}{},
+	"host_regex":  struct{}{},
+	"url_regex":   struct{}{},
+	"port":        struct{}{},
+	"scheme":      struct{}{},
+	"prefix":      struct{}{},
+	"suffix":      struct{}{},
+	"method":      struct{}{},
+	"time":        struct{}{},
+	"src_ip":      struct{}{},
+	"internal":    struct{}{},
+}
+
+// parentLines keys parent.config lines by their destination and other specifiers.
+// The order of the fields in a line isn't significant, but the order of values within a field is, e.g. the order of parents.
+func parentLines(lines []string) []keyedLine {
+	keyed := make([]keyedLine, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		sort.Strings(fields)
+		specifiers := []string{}
+		for _, field := range fields {
+			name := strings.ToLower(strings.SplitN(field, "=", 2)[0])
+			if _, ok := parentSpecifiers[name]; ok {
+				specifiers = append(specifiers, field)
+			}
+		}
+		key := line
+		if len(specifiers) > 0 {
+			key = strings.Join(specifiers, " ")
+		}
+		keyed = append(keyed, keyedLine{Key: key, Line: line, Cmp: strings.Join(fields, " ")})
+	}
+	return keyed
+}
@@ -0,0 +1,181 @@
+// Package filediff compares ATS config files semantically, by the structure of each file type.
+package filediff
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// FileType is the kind of comparison done for a config file.
+type FileType string
+
+const (
+	FileTypeText    FileType = "text"
+	FileTypeRecords FileType = "records.config"
+	FileTypeRemap   FileType = "remap.config"
+	FileTypeParent  FileType = "parent.config"
+	FileTypeYAML    FileType = "yaml"
+	FileTypeInvalid FileType = ""
+)
+
+// FileTypes are the valid file types, in the order they're listed in usage text.
+var FileTypes = []FileType{FileTypeRecords, FileTypeRemap, FileTypeParent, FileTypeYAML, FileTypeText}
+
+// StrToFileType returns the FileType of s, or FileTypeInvalid if s isn't a valid FileType.
+func StrToFileType(s string) FileType {
+	for _, ft := range FileTypes {
+		if strings.ToLower(s) == string(ft) {
+			return ft
+		}
+	}
+	return FileTypeInvalid
+}
+
+// TypeOf returns the FileType to compare the file with the given name or path as.
+// Files without a semantic comparison are FileTypeText.
+func TypeOf(fileName string) FileType {
+	name := filepath.Base(fileName)
+	switch {
+	case name == string(FileTypeRecords):
+		return FileTypeRecords
+	case name == string(FileTypeRemap):
+		return FileTypeRemap
+	case name == string(FileTypeParent):
+		return FileTypeParent
+	case strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml"):
+		return FileTypeYAML
+	}
+	return FileTypeText
+}
+
+// Diff returns the semantic differences between the config files a and b of the given type.
+// Each line of the returned diff starts with '-' if it's only in a, or '+' if it's only in b.
+// Returns an empty diff if the files are semantically identical.
+//
+// If a file can't be parsed as its type, for example a YAML syntax error, the files are compared as text.
+func Diff(fileType FileType, a string, b string) []string {
+	switch fileType {
+	case FileTypeRecords:
+		return diffKeyed(recordsLines(textLines(a)), recordsLines(textLines(b)))
+	case FileTypeRemap:
+		return diffRemap(a, b)
+	case FileTypeParent:
+		return diffKeyed(parentLines(textLines(a)), parentLines(textLines(b)))
+	case FileTypeYAML:
+		return diffYAML(a, b)
+	}
+	return diffText(a, b)
+}
+
+// textLines returns the lines of the config file, with comments, blank lines, and redundant whitespace removed.
+func textLines(file string) []string {
+	lines := strings.Split(file, "\n")
+	lines = t3cutil.UnencodeFilter(lines)
+	lines = t3cutil.CommentsFilter(lines)
+	nonEmpty := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		nonEmpty = append(nonEmpty, line)
+	}
+	return nonEmpty
+}
+
+var diffChangeRegex = regexp.MustCompile(`(?m)^\+.*|^-.*`)
+
+// diffText compares the files as lines, ignoring only comments and whitespace.
+func diffText(a string, b string) []string {
+	a = t3cutil.NewLineFilter(strings.Join(t3cutil.CommentsFilter(t3cutil.UnencodeFilter(strings.Split(a, "\n"))), "\n"))
+	b = t3cutil.NewLineFilter(strings.Join(t3cutil.CommentsFilter(t3cutil.UnencodeFilter(strings.Split(b, "\n"))), "\n"))
+	if a == b {
+		return nil
+	}
+	return diffChangeRegex.FindAllString(diff.Diff(a, b), -1)
+}
+
+// keyedLine is a config line, and the key which identifies what it configures.
+// Lines with the same key are compared to each other, regardless of where they are in the file.
+type keyedLine struct {
+	Key string
+	// Line is the line, as it's printed in the diff.
+	Line string
+	// Cmp is the line as it's compared. Lines which differ only in ways that aren't semantic, such as the order of unordered fields, have the same Cmp.
+	Cmp string
+}
+
+// diffKeyed compares lines with the same key. Lines with the same key are compared in order.
+// The diff is ordered by the first appearance of each key in b, followed by the keys only in a.
+func diffKeyed(a []keyedLine, b []keyedLine) []string {
+	aKeys, aLines := groupKeyed(a)
+	bKeys, bLines := groupKeyed(b)
+
+	keys := bKeys
+	for _, key := range aKeys {
+		if _, ok := bLines[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	changes := []string{}
+	for _, key := range keys {
+		if keyedEqual(aLines[key], bLines[key]) {
+			continue
+		}
+		for _, line := range aLines[key] {
+			changes = append(changes, "-"+line.Line)
+		}
+		for _, line := range bLines[key] {
+			changes = append(changes, "+"+line.Line)
+		}
+	}
+	return changes
+}
+
+// groupKeyed returns the keys of lines in the order they first appear, and the lines of each key.
+func groupKeyed(lines []keyedLine) ([]string, map[string][]keyedLine) {
+	keys := []string{}
+	keyLines := map[string][]keyedLine{}
+	for _, line := range lines {
+		if _, ok := keyLines[line.Key]; !ok {
+			keys = append(keys, line.Key)
+		}
+		keyLines[line.Key] = append(keyLines[line.Key], line)
+	}
+	return keys, keyLines
+}
+
+func keyedEqual(a []keyedLine, b []keyedLine) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Cmp != b[i].Cmp {
+			return false
+		}
+	}
+	return true
+}
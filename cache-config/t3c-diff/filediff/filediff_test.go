@@ -0,0 +1,216 @@
+package filediff
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTypeOf(t *testing.T) {
+	expected := map[string]FileType{
+		"/opt/trafficserver/etc/trafficserver/records.config": FileTypeRecords,
+		"remap.config":           FileTypeRemap,
+		"etc/parent.config":      FileTypeParent,
+		"/etc/ip_allow.yaml":     FileTypeYAML,
+		"sni.yml":                FileTypeYAML,
+		"hosting.config":         FileTypeText,
+		"uri_signing_foo.config": FileTypeText,
+	}
+	for name, expectedType := range expected {
+		if actual := TypeOf(name); actual != expectedType {
+			t.Errorf("TypeOf(%s) expected '%s', actual '%s'", name, expectedType, actual)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileType FileType
+		a        string
+		b        string
+		expected []string
+	}{
+		{
+			name:     "records reordered",
+			fileType: FileTypeRecords,
+			a:        "# generated\nCONFIG proxy.config.a INT 1\nCONFIG proxy.config.b STRING foo\n",
+			b:        "CONFIG proxy.config.b  STRING foo\n# generated later\nCONFIG proxy.config.a INT 1\n",
+		},
+		{
+			name:     "records changed, added, and removed",
+			fileType: FileTypeRecords,
+			a:        "CONFIG proxy.config.a INT 1\nCONFIG proxy.config.b STRING foo\n",
+			b:        "CONFIG proxy.config.c INT 3\nCONFIG proxy.config.a INT 2\n",
+			expected: []string{
+				"+CONFIG proxy.config.c INT 3",
+				"-CONFIG proxy.config.a INT 1",
+				"+CONFIG proxy.config.a INT 2",
+				"-CONFIG proxy.config.b STRING foo",
+			},
+		},
+		{
+			name:     "records last line of a record is used",
+			fileType: FileTypeRecords,
+			a:        "CONFIG proxy.config.a INT 1\nCONFIG proxy.config.a INT 2\n",
+			b:        "CONFIG proxy.config.a INT 2\n",
+		},
+		{
+			name:     "remap reordered",
+			fileType: FileTypeRemap,
+			a:        "map http://a.example/ http://origin-a.example/ @plugin=foo.so\nmap http://b.example/ http://origin-b.example/\n",
+			b:        "map http://b.example/ http://origin-b.example/\nmap http://a.example/ \\\n  http://origin-a.example/ @plugin=foo.so\n",
+		},
+		{
+			name:     "remap changed",
+			fileType: FileTypeRemap,
+			a:        "map http://a.example/ http://origin-a.example/ @plugin=foo.so @plugin=bar.so\nmap http://b.example/ http://origin-b.example/\n",
+			b:        "map http://b.example/ http://origin-b.example/\nmap http://a.example/ http://origin-a.example/ @plugin=bar.so @plugin=foo.so\n",
+			expected: []string{
+				"-map http://a.example/ http://origin-a.example/ @plugin=foo.so @plugin=bar.so",
+				"+map http://a.example/ http://origin-a.example/ @plugin=bar.so @plugin=foo.so",
+			},
+		},
+		{
+			name:     "remap overlapping paths reordered",
+			fileType: FileTypeRemap,
+			a:        "map http://a.example/foo/ http://origin-foo.example/\nmap http://b.example/ http://origin-b.example/\nmap http://a.example/ http://origin-a.example/\n",
+			b:        "map http://a.example/ http://origin-a.example/\nmap http://a.example/foo/ http://origin-foo.example/\nmap http://b.example/ http://origin-b.example/\n",
+			expected: []string{
+				"-map http://a.example/ http://origin-a.example/",
+				"+map http://a.example/ http://origin-a.example/",
+				"-map http://a.example/foo/ http://origin-foo.example/",
+				"+map http://a.example/foo/ http://origin-foo.example/",
+			},
+		},
+		{
+			name:     "remap non-overlapping paths reordered",
+			fileType: FileTypeRemap,
+			a:        "map http://a.example/foo/ http://origin-foo.example/\nmap http://a.example/bar/ http://origin-bar.example/\n",
+			b:        "map http://a.example/bar/ http://origin-bar.example/\nmap http://a.example/foo/ http://origin-foo.example/\n",
+		},
+		{
+			name:     "remap regex reordered",
+			fileType: FileTypeRemap,
+			a:        "regex_map http://.*\\.a\\.example/ http://origin-a.example/\nmap http://b.example/ http://origin-b.example/\nregex_map http://c\\..*/ http://origin-c.example/\n",
+			b:        "regex_map http://c\\..*/ http://origin-c.example/\nregex_map http://.*\\.a\\.example/ http://origin-a.example/\nmap http://b.example/ http://origin-b.example/\n",
+			expected: []string{
+				"-regex_map http://c\\..*/ http://origin-c.example/",
+				"+regex_map http://c\\..*/ http://origin-c.example/",
+				"-regex_map http://.*\\.a\\.example/ http://origin-a.example/",
+				"+regex_map http://.*\\.a\\.example/ http://origin-a.example/",
+				"-map http://b.example/ http://origin-b.example/",
+				"+map http://b.example/ http://origin-b.example/",
+			},
+		},
+		{
+			name:     "remap map and regex_map reordered",
+			fileType: FileTypeRemap,
+			a:        "map http://a.example/ http://origin-a.example/\nregex_map http://.*\\.example/ http://origin.example/\n",
+			b:        "regex_map http://.*\\.example/ http://origin.example/\nmap http://a.example/ http://origin-a.example/\n",
+			expected: []string{
+				"-regex_map http://.*\\.example/ http://origin.example/",
+				"+regex_map http://.*\\.example/ http://origin.example/",
+				"-map http://a.example/ http://origin-a.example/",
+				"+map http://a.example/ http://origin-a.example/",
+			},
+		},
+		{
+			name:     "remap map and reverse_map reordered",
+			fileType: FileTypeRemap,
+			a:        "map http://a.example/ http://origin-a.example/\nreverse_map http://origin-a.example/ http://a.example/\n",
+			b:        "reverse_map http://origin-a.example/ http://a.example/\nmap http://a.example/ http://origin-a.example/\n",
+			expected: nil,
+		},
+		{
+			name:     "remap with filters is ordered",
+			fileType: FileTypeRemap,
+			a:        ".activatefilter foo\nmap http://a.example/ http://origin-a.example/\n.deactivatefilter foo\nmap http://b.example/ http://origin-b.example/\n",
+			b:        ".activatefilter foo\nmap http://b.example/ http://origin-b.example/\n.deactivatefilter foo\nmap http://a.example/ http://origin-a.example/\n",
+			expected: []string{
+				"-map http://a.example/ http://origin-a.example/",
+				"-.deactivatefilter foo",
+				"+.deactivatefilter foo",
+				"+map http://a.example/ http://origin-a.example/",
+			},
+		},
+		{
+			name:     "parent reordered lines and fields",
+			fileType: FileTypeParent,
+			a:        "dest_domain=a.example port=80 parent=\"p0:80|0.999;p1:80|0.999\" round_robin=consistent_hash\ndest_domain=. go_direct=true\n",
+			b:        "dest_domain=. go_direct=true\nport=80 dest_domain=a.example round_robin=consistent_hash parent=\"p0:80|0.999;p1:80|0.999\"\n",
+		},
+		{
+			name:     "parent order changed",
+			fileType: FileTypeParent,
+			a:        "dest_domain=a.example port=80 parent=\"p0:80|0.999;p1:80|0.999\"\ndest_domain=a.example port=443 parent=\"p0:443|0.999\"\n",
+			b:        "dest_domain=a.example port=443 parent=\"p0:443|0.999\"\ndest_domain=a.example port=80 parent=\"p1:80|0.999;p0:80|0.999\"\n",
+			expected: []string{
+				"-dest_domain=a.example port=80 parent=\"p0:80|0.999;p1:80|0.999\"",
+				"+dest_domain=a.example port=80 parent=\"p1:80|0.999;p0:80|0.999\"",
+			},
+		},
+		{
+			name:     "yaml reformatted",
+			fileType: FileTypeYAML,
+			a:        "ip_allow:\n  - apply: in\n    ip_addrs: 127.0.0.1\n    action: allow\n    methods: ALL\n",
+			b:        "# comment\nip_allow:\n- {action: allow, apply: in, methods: ALL, ip_addrs: 127.0.0.1}\n",
+		},
+		{
+			name:     "yaml list reordered",
+			fileType: FileTypeYAML,
+			a:        "sni:\n- fqdn: a.example\n  verify_client: NONE\n- fqdn: b.example\n",
+			b:        "sni:\n- fqdn: b.example\n- fqdn: a.example\n  verify_client: NONE\n",
+			expected: []string{
+				`-sni[0].fqdn: "a.example"`,
+				`+sni[0].fqdn: "b.example"`,
+				`-sni[1].fqdn: "b.example"`,
+				`+sni[1].fqdn: "a.example"`,
+				`+sni[1].verify_client: "NONE"`,
+				`-sni[0].verify_client: "NONE"`,
+			},
+		},
+		{
+			name:     "yaml invalid is compared as text",
+			fileType: FileTypeYAML,
+			a:        "a: [\n",
+			b:        "a: [ \n",
+		},
+		{
+			name:     "text reordered",
+			fileType: FileTypeText,
+			a:        "a\nb\n",
+			b:        "b\na\n",
+			expected: []string{"-a", "+a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := Diff(test.fileType, test.a, test.b)
+			if len(actual) == 0 && len(test.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(test.expected, actual) {
+				t.Errorf("expected diff %q, actual %q", test.expected, actual)
+			}
+		})
+	}
+}
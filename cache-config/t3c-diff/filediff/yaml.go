@@ -0,0 +1,115 @@
+package filediff
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// diffYAML compares YAML documents by their structure, ignoring formatting, comments, and the order of map keys.
+// The order of lists is significant, because ATS matches rules such as ip_allow.yaml and sni.yaml entries in order.
+//
+// Each value is printed as its path in the document, e.g. 'ip_allow[0].action: "allow"'.
+func diffYAML(a string, b string) []string {
+	aDoc, err := parseYAML(a)
+	if err != nil {
+		return diffText(a, b)
+	}
+	bDoc, err := parseYAML(b)
+	if err != nil {
+		return diffText(a, b)
+	}
+	return diffKeyed(yamlLines("", aDoc, nil), yamlLines("", bDoc, nil))
+}
+
+// parseYAML parses all the documents in file. If there's a single document, it's returned,
+// otherwise a list of the documents is returned.
+func parseYAML(file string) (interface{}, error) {
+	docs := []interface{}{}
+	decoder := yaml.NewDecoder(strings.NewReader(file))
+	for {
+		doc := interface{}(nil)
+		if err := decoder.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	switch len(docs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return docs[0], nil
+	}
+	return docs, nil
+}
+
+// yamlLines appends a line for each scalar, empty map, and empty list in val to lines, keyed by its path.
+func yamlLines(path string, val interface{}, lines []keyedLine) []keyedLine {
+	switch v := val.(type) {
+	case nil:
+		if path == "" {
+			return lines // an empty document
+		}
+	case map[interface{}]interface{}:
+		if len(v) == 0 {
+			return appendYAMLLine(lines, path, "{}")
+		}
+		keys := make([]string, 0, len(v))
+		vals := make(map[string]interface{}, len(v))
+		for key, keyVal := range v {
+			keyStr := fmt.Sprint(key)
+			keys = append(keys, keyStr)
+			vals[keyStr] = keyVal
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			lines = yamlLines(keyPath, vals[key], lines)
+		}
+		return lines
+	case []interface{}:
+		if len(v) == 0 {
+			return appendYAMLLine(lines, path, "[]")
+		}
+		for i, elem := range v {
+			lines = yamlLines(path+"["+strconv.Itoa(i)+"]", elem, lines)
+		}
+		return lines
+	case string:
+		return appendYAMLLine(lines, path, strconv.Quote(v))
+	}
+	return appendYAMLLine(lines, path, fmt.Sprint(val))
+}
+
+func appendYAMLLine(lines []keyedLine, path string, val string) []keyedLine {
+	line := path + ": " + val
+	return append(lines, keyedLine{Key: path, Line: line, Cmp: line})
+}
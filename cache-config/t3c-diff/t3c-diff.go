@@ -24,35 +24,47 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"regexp"
 	"strings"
 
-	"github.com/apache/trafficcontrol/cache-config/t3cutil"
-	"github.com/kylelemons/godebug/diff"
+	"github.com/apache/trafficcontrol/cache-config/t3c-diff/filediff"
 	"github.com/pborman/getopt/v2"
 )
 
 func main() {
 	help := getopt.BoolLong("help", 'h', "Print usage info and exit")
+	fileTypeStr := getopt.StringLong("file-type", 'f', "", "The type of config file to compare as, one of "+fileTypesStr()+". Default is to detect the type from the file name")
 	getopt.ParseV2()
 	if *help {
 		fmt.Println(usageStr)
 		os.Exit(0)
 	}
 
-	if len(os.Args) < 3 {
+	args := getopt.Args()
+	if len(args) < 2 {
 		fmt.Println(usageStr)
 		os.Exit(3)
 	}
 
-	fileNameA := strings.TrimSpace(os.Args[1])
-	fileNameB := strings.TrimSpace(os.Args[2])
+	fileNameA := strings.TrimSpace(args[0])
+	fileNameB := strings.TrimSpace(args[1])
 
 	if len(fileNameA) == 0 || len(fileNameB) == 0 {
 		fmt.Println(usageStr)
 		os.Exit(4)
 	}
 
+	fileType := filediff.TypeOf(fileNameB)
+	if strings.ToLower(fileNameB) == "stdin" {
+		fileType = filediff.TypeOf(fileNameA)
+	}
+	if *fileTypeStr != "" {
+		fileType = filediff.StrToFileType(*fileTypeStr)
+		if fileType == filediff.FileTypeInvalid {
+			fmt.Fprintln(os.Stderr, "invalid file type '"+*fileTypeStr+"', valid types are "+fileTypesStr())
+			os.Exit(7)
+		}
+	}
+
 	fileA, fileAExisted, err := readFileOrStdin(fileNameA)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error reading first: "+err.Error())
@@ -64,22 +76,8 @@ func main() {
 		os.Exit(6)
 	}
 
-	fileALines := strings.Split(string(fileA), "\n")
-	fileALines = t3cutil.UnencodeFilter(fileALines)
-	fileALines = t3cutil.CommentsFilter(fileALines)
-	fileA = strings.Join(fileALines, "\n")
-	fileA = t3cutil.NewLineFilter(fileA)
-
-	fileBLines := strings.Split(string(fileB), "\n")
-	fileBLines = t3cutil.UnencodeFilter(fileBLines)
-	fileBLines = t3cutil.CommentsFilter(fileBLines)
-	fileB = strings.Join(fileBLines, "\n")
-	fileB = t3cutil.NewLineFilter(fileB)
-
-	if fileA != fileB {
-		match := regexp.MustCompile(`(?m)^\+.*|^-.*`)
-		changes := diff.Diff(fileA, fileB)
-		for _, change := range match.FindAllString(changes, -1) {
+	if changes := filediff.Diff(fileType, fileA, fileB); len(changes) > 0 {
+		for _, change := range changes {
 			fmt.Println(change)
 		}
 		os.Exit(1)
@@ -91,12 +89,26 @@ func main() {
 
 }
 
-const usageStr = `usage: t3c-diff [--help]
+func fileTypesStr() string {
+	strs := []string{}
+	for _, ft := range filediff.FileTypes {
+		strs = append(strs, string(ft))
+	}
+	return strings.Join(strs, ", ")
+}
+
+const usageStr = `usage: t3c-diff [--help] [--file-type=type]
        <file-a> <file-b>
 
 Either file may be 'stdin', in which case that file is read from stdin.
 Either file may not exist.
 
+Files are compared by their structure, so reordered records.config records,
+remap.config rules, parent.config lines, and YAML map keys aren't a diff.
+The type is detected from the name of the file which isn't stdin, or may be
+set with --file-type to one of records.config, remap.config, parent.config,
+yaml, or text. Files of other types, and text, are compared as lines.
+
 Prints the diff to stdout, and returns the exit code 0 if there was no diff, 1 if there was a diff.
 If one file exists but the other doesn't, it will always be a diff.
 
@@ -42,6 +42,9 @@ func GetAllConfigs(
 	if toData.Server.HostName == nil {
 		return nil, errors.New("server hostname is nil")
 	}
+	if cfg.Cache != "" && cfg.Cache != config.CacheATS {
+		return getBackendConfigs(toData, appVersion, cfg)
+	}
 
 	configFiles, warnings, err := MakeConfigFilesList(toData, cfg.Dir)
 	logWarnings("generating config files list: ", warnings)
@@ -69,7 +72,7 @@ func GetAllConfigs(
 	}
 
 	if hasSSLMultiCertConfig {
-		sslConfigs, err := GetSSLCertsAndKeyFiles(toData)
+		sslConfigs, err := GetSSLCertsAndKeyFiles(toData, ATSSSLDir)
 		if err != nil {
 			return nil, errors.New("getting ssl key and cert config files: " + err.Error())
 		}
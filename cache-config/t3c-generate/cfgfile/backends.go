@@ -0,0 +1,144 @@
+package cfgfile
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-generate/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-nginxcfg"
+	"github.com/apache/trafficcontrol/lib/go-varnishcfg"
+)
+
+// DefaultNginxDir is the nginx config directory, if no --dir is given.
+const DefaultNginxDir = "/etc/nginx/"
+
+// DefaultVarnishDir is the Varnish config directory, if no --dir is given.
+const DefaultVarnishDir = "/etc/varnish/"
+
+// BackendFunc generates the config files of a cache other than ATS.
+// The cacheDSes are the Delivery Services the server serves, from atscfg.MakeCacheDSes.
+type BackendFunc func(toData *t3cutil.ConfigData, cacheDSes []atscfg.CacheDS, hdrCommentTxt string, cfg config.Cfg) ([]t3cutil.ATSConfigFile, error)
+
+// Backends is the config generators of caches other than ATS, by their config.Cache name.
+var Backends = map[string]BackendFunc{
+	config.CacheNginx:   MakeNginxConfigs,
+	config.CacheVarnish: MakeVarnishConfigs,
+}
+
+// getBackendConfigs gets all config files for the cache cfg.Cache, which must not be ATS.
+func getBackendConfigs(
+	toData *t3cutil.ConfigData,
+	appVersion string,
+	cfg config.Cfg,
+) ([]t3cutil.ATSConfigFile, error) {
+	backend, ok := Backends[cfg.Cache]
+	if !ok {
+		return nil, errors.New("unknown cache '" + cfg.Cache + "'")
+	}
+	if cfg.RevalOnly {
+		log.Warnln("revalidate only, but cache '" + cfg.Cache + "' has no revalidate config, generating no files")
+		return []t3cutil.ATSConfigFile{}, nil
+	}
+
+	cacheDSes, warnings, err := atscfg.MakeCacheDSes(
+		toData.Server,
+		toData.DeliveryServices,
+		toData.DeliveryServiceServers,
+		toData.DeliveryServiceRegexes,
+		toData.Servers,
+		toData.Topologies,
+		toData.ServerParams,
+		toData.ParentConfigParams,
+		toData.ServerCapabilities,
+		toData.DSRequiredCapabilities,
+		toData.CacheGroups,
+		toData.CDN,
+	)
+	logWarnings("generating "+cfg.Cache+" delivery services: ", warnings)
+	if err != nil {
+		return nil, errors.New("making delivery services: " + err.Error())
+	}
+
+	hdrCommentTxt := makeHeaderComment(*toData.Server.HostName, appVersion, toData.TrafficOpsURL, toData.TrafficOpsAddresses, time.Now())
+	return backend(toData, cacheDSes, hdrCommentTxt, cfg)
+}
+
+// MakeNginxConfigs generates the nginx config file, and the certificate and key files of the HTTPS Delivery Services.
+func MakeNginxConfigs(toData *t3cutil.ConfigData, cacheDSes []atscfg.CacheDS, hdrCommentTxt string, cfg config.Cfg) ([]t3cutil.ATSConfigFile, error) {
+	dir := backendDir(cfg.Dir, DefaultNginxDir)
+	sslDir := filepath.Join(dir, "ssl") + "/"
+
+	conf, err := nginxcfg.MakeConf(toData.Server, cacheDSes, toData.SSLKeys, nginxcfg.ConfOpts{HdrComment: hdrCommentTxt, SSLDir: sslDir})
+	logWarnings("generating "+nginxcfg.ConfFileName+": ", conf.Warnings)
+	if err != nil {
+		return nil, errors.New("generating " + nginxcfg.ConfFileName + ": " + err.Error())
+	}
+
+	configs := []t3cutil.ATSConfigFile{{
+		Name:        nginxcfg.ConfFileName,
+		Path:        filepath.Join(dir, "conf.d") + "/",
+		Text:        conf.Text,
+		ContentType: conf.ContentType,
+		LineComment: conf.LineComment,
+	}}
+
+	sslConfigs, err := GetSSLCertsAndKeyFiles(toData, sslDir)
+	if err != nil {
+		return nil, errors.New("getting ssl key and cert config files: " + err.Error())
+	}
+	return append(configs, sslConfigs...), nil
+}
+
+// MakeVarnishConfigs generates the Varnish VCL file.
+func MakeVarnishConfigs(toData *t3cutil.ConfigData, cacheDSes []atscfg.CacheDS, hdrCommentTxt string, cfg config.Cfg) ([]t3cutil.ATSConfigFile, error) {
+	dir := backendDir(cfg.Dir, DefaultVarnishDir)
+
+	vcl, err := varnishcfg.MakeDefaultDotVCL(toData.Server, cacheDSes, varnishcfg.VCLOpts{HdrComment: hdrCommentTxt})
+	logWarnings("generating "+varnishcfg.VCLFileName+": ", vcl.Warnings)
+	if err != nil {
+		return nil, errors.New("generating " + varnishcfg.VCLFileName + ": " + err.Error())
+	}
+
+	return []t3cutil.ATSConfigFile{{
+		Name:        varnishcfg.VCLFileName,
+		Path:        dir,
+		Text:        vcl.Text,
+		ContentType: vcl.ContentType,
+		LineComment: vcl.LineComment,
+	}}, nil
+}
+
+// backendDir returns the config directory, with a trailing slash, or defaultDir if dir is empty.
+func backendDir(dir string, defaultDir string) string {
+	if dir == "" {
+		return defaultDir
+	}
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	return dir
+}
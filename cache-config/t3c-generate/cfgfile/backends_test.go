@@ -0,0 +1,66 @@
+package cfgfile
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"testing"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-generate/config"
+	"github.com/apache/trafficcontrol/lib/go-nginxcfg"
+	"github.com/apache/trafficcontrol/lib/go-varnishcfg"
+)
+
+func TestGetAllConfigsBackends(t *testing.T) {
+	type testCase struct {
+		cache string
+		dir   string
+		path  string
+		name  string
+	}
+	testCases := []testCase{
+		{cache: config.CacheNginx, dir: "", path: "/etc/nginx/conf.d/", name: nginxcfg.ConfFileName},
+		{cache: config.CacheNginx, dir: "/usr/local/nginx", path: "/usr/local/nginx/conf.d/", name: nginxcfg.ConfFileName},
+		{cache: config.CacheVarnish, dir: "", path: "/etc/varnish/", name: varnishcfg.VCLFileName},
+	}
+	for _, tc := range testCases {
+		toData := MakeFakeTOData()
+		cfg := config.Cfg{Cache: tc.cache, Dir: tc.dir}
+
+		configs, err := GetAllConfigs(toData, "", cfg)
+		if err != nil {
+			t.Fatalf("cache '%v' error getting configs: %v", tc.cache, err)
+		}
+		if len(configs) != 1 {
+			t.Fatalf("cache '%v' expected 1 config file, actual %+v", tc.cache, configs)
+		}
+		if configs[0].Name != tc.name || configs[0].Path != tc.path {
+			t.Errorf("cache '%v' expected config file '%v' in '%v', actual '%v' in '%v'", tc.cache, tc.name, tc.path, configs[0].Name, configs[0].Path)
+		}
+
+		cfg.RevalOnly = true
+		configs, err = GetAllConfigs(toData, "", cfg)
+		if err != nil {
+			t.Fatalf("cache '%v' revalidate only error getting configs: %v", tc.cache, err)
+		}
+		if len(configs) != 0 {
+			t.Errorf("cache '%v' revalidate only expected no config files, actual %+v", tc.cache, configs)
+		}
+	}
+}
@@ -100,6 +100,7 @@ var configFileLiteralFuncs = []ConfigFileLiteralFunc{
 	{"ssl_server_name.yaml", MakeSSLServerNameYAML},
 	{"sni.yaml", MakeSNIDotYAML},
 	{"storage.config", MakeStorageDotConfig},
+	{"strategies.yaml", MakeStrategiesDotYAML},
 	{"sysctl.conf", MakeSysCtlDotConf},
 	{"volume.config", MakeVolumeDotConfig},
 }
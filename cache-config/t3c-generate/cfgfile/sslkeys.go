@@ -28,7 +28,11 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-tc"
 )
 
-func GetSSLCertsAndKeyFiles(toData *t3cutil.ConfigData) ([]t3cutil.ATSConfigFile, error) {
+// ATSSSLDir is the directory of ATS Delivery Service certificate and key files.
+const ATSSSLDir = "/opt/trafficserver/etc/trafficserver/ssl/" // TODO read config, don't hard code
+
+// GetSSLCertsAndKeyFiles returns the certificate and key files of the Delivery Services, in the directory dir.
+func GetSSLCertsAndKeyFiles(toData *t3cutil.ConfigData, dir string) ([]t3cutil.ATSConfigFile, error) {
 	dses, dsWarns := atscfg.DeliveryServicesToSSLMultiCertDSes(toData.DeliveryServices)
 	logWarnings("Getting SSL files: Making SSL MultiCert DSes: ", dsWarns)
 	dses = atscfg.GetSSLMultiCertDotConfigDeliveryServices(dses)
@@ -63,13 +67,13 @@ func GetSSLCertsAndKeyFiles(toData *t3cutil.ConfigData) ([]t3cutil.ATSConfigFile
 
 		keyFile := t3cutil.ATSConfigFile{}
 		keyFile.Name = keyName
-		keyFile.Path = "/opt/trafficserver/etc/trafficserver/ssl/" // TODO read config, don't hard code
+		keyFile.Path = dir
 		keyFile.Text = string(key)
 		configs = append(configs, keyFile)
 
 		certFile := t3cutil.ATSConfigFile{}
 		certFile.Name = certName
-		certFile.Path = "/opt/trafficserver/etc/trafficserver/ssl/" // TODO read config, don't hard code
+		certFile.Path = dir
 		certFile.Text = string(cert)
 		configs = append(configs, certFile)
 	}
@@ -225,6 +225,26 @@ func MakeStorageDotConfig(toData *t3cutil.ConfigData, fileName string, hdrCommen
 	return atscfg.MakeStorageDotConfig(toData.Server, toData.ServerParams, hdrCommentTxt)
 }
 
+func MakeStrategiesDotYAML(toData *t3cutil.ConfigData, fileName string, hdrCommentTxt string, cfg config.Cfg) (atscfg.Cfg, error) {
+	return atscfg.MakeStrategiesDotYAML(
+		toData.DeliveryServices,
+		toData.Server,
+		toData.Servers,
+		toData.Topologies,
+		toData.ServerParams,
+		toData.ParentConfigParams,
+		toData.ServerCapabilities,
+		toData.DSRequiredCapabilities,
+		toData.CacheGroups,
+		toData.DeliveryServiceServers,
+		toData.CDN,
+		atscfg.StrategiesYAMLOpts{
+			HdrComment:  hdrCommentTxt,
+			AddComments: cfg.ParentComments,
+		},
+	)
+}
+
 func MakeSysCtlDotConf(toData *t3cutil.ConfigData, fileName string, hdrCommentTxt string, cfg config.Cfg) (atscfg.Cfg, error) {
 	return atscfg.MakeSysCtlDotConf(toData.Server, toData.ServerParams, hdrCommentTxt)
 }
@@ -25,6 +25,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-atscfg"
 	"github.com/apache/trafficcontrol/lib/go-log"
@@ -37,6 +38,19 @@ const AppName = "t3c-generate"
 const Version = "0.3"
 const AppVersion = AppName + "/" + Version
 
+// DefaultPluginDir is the default directory of executable plugins.
+const DefaultPluginDir = "/etc/trafficcontrol-cache-config/t3c-generate/plugins"
+
+// The Cache constants are the --cache names of the cache software config can be generated for.
+const (
+	CacheATS     = "ats"
+	CacheNginx   = "nginx"
+	CacheVarnish = "varnish"
+)
+
+// Caches is the cache software config can be generated for, in the order they're listed in usage.
+var Caches = []string{CacheATS, CacheNginx, CacheVarnish}
+
 const ExitCodeSuccess = 0
 const ExitCodeErrGeneric = 1
 const ExitCodeNotFound = 104
@@ -58,6 +72,9 @@ type Cfg struct {
 	ParentComments     bool
 	DefaultEnableH2    bool
 	DefaultTLSVersions []atscfg.TLSVersion
+	PluginDir          string
+	PluginTimeout      time.Duration
+	Cache              string
 }
 
 func (cfg Cfg) ErrorLog() log.LogLocation   { return log.LogLocation(cfg.LogLocationErr) }
@@ -78,6 +95,9 @@ func GetCfg() (Cfg, error) {
 	disableParentConfigComments := getopt.BoolLong("disable-parent-config-comments", 'c', "Disable adding a comments to parent.config individual lines")
 	defaultEnableH2 := getopt.BoolLong("default-client-enable-h2", '2', "Whether to enable HTTP/2 on Delivery Services by default, if they have no explicit Parameter. This is irrelevant if ATS records.config is not serving H2. If omitted, H2 is disabled.")
 	defaultTLSVersionsStr := getopt.StringLong("default-client-tls-versions", 'T', "", "Comma-delimited list of default TLS versions for Delivery Services with no Parameter, e.g. '--default-tls-versions=1.1,1.2,1.3'. If omitted, all versions are enabled.")
+	pluginDir := getopt.StringLong("plugin-dir", 'p', DefaultPluginDir, "Directory of executable plugins, which are run to modify and add config files. If the directory doesn't exist, no executable plugins are run.")
+	pluginTimeoutMS := getopt.IntLong("plugin-timeout-milliseconds", 't', 30000, "Timeout in milli-seconds for each executable plugin, default is 30000")
+	cache := getopt.StringLong("cache", 'C', CacheATS, "Cache software to generate config for, one of '"+strings.Join(Caches, "', '")+"'. Config for caches other than ATS serves the same Delivery Services, without the features the cache doesn't support. Default is 'ats'")
 	verbosePtr := getopt.CounterLong("verbose", 'v', `Log verbosity. Logging is output to stderr. By default, errors are logged. To log warnings, pass '-v'. To log info, pass '-vv'. To omit error logging, see '-s'`)
 	silentPtr := getopt.BoolLong("silent", 's', `Silent. Errors are not logged, and the 'verbose' flag is ignored. If a fatal error occurs, the return code will be non-zero but no text will be output to stderr`)
 
@@ -90,7 +110,7 @@ func GetCfg() (Cfg, error) {
 		getopt.PrintUsage(os.Stdout)
 		os.Exit(0)
 	} else if *listPlugins {
-		return Cfg{ListPlugins: true}, nil
+		return Cfg{ListPlugins: true, PluginDir: *pluginDir}, nil
 	}
 
 	logLocationError := log.LogLocationStderr
@@ -129,6 +149,10 @@ func GetCfg() (Cfg, error) {
 		}
 	}
 
+	if !isCache(*cache) {
+		return Cfg{}, errors.New("unknown cache '" + *cache + "', must be one of '" + strings.Join(Caches, "', '") + "'")
+	}
+
 	cfg := Cfg{
 		LogLocationErr:     logLocationError,
 		LogLocationWarn:    logLocationWarn,
@@ -142,6 +166,9 @@ func GetCfg() (Cfg, error) {
 		ParentComments:     !(*disableParentConfigComments),
 		DefaultEnableH2:    *defaultEnableH2,
 		DefaultTLSVersions: defaultTLSVersions,
+		PluginDir:          *pluginDir,
+		PluginTimeout:      time.Duration(*pluginTimeoutMS) * time.Millisecond,
+		Cache:              *cache,
 	}
 	if err := log.InitCfg(cfg); err != nil {
 		return Cfg{}, errors.New("Initializing loggers: " + err.Error() + "\n")
@@ -149,6 +176,16 @@ func GetCfg() (Cfg, error) {
 	return cfg, nil
 }
 
+// isCache returns whether cache is one of Caches.
+func isCache(cache string) bool {
+	for _, c := range Caches {
+		if c == cache {
+			return true
+		}
+	}
+	return false
+}
+
 func ValidateURL(u *url.URL) error {
 	if u == nil {
 		return errors.New("nil url")
@@ -0,0 +1,209 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// DefaultExecPriority is the priority of executable plugins whose file names don't start with a priority.
+// It's the same as the base priority of plugins included with Traffic Control.
+const DefaultExecPriority = 10000
+
+// ExecInput is the JSON object written to the stdin of executable plugins.
+type ExecInput struct {
+	ConfigData *t3cutil.ConfigData     `json:"config_data"`
+	Files      []t3cutil.ATSConfigFile `json:"files"`
+}
+
+// execPriorityRe matches the priority prefix of executable plugin file names, e.g. '500-my-plugin'.
+var execPriorityRe = regexp.MustCompile(`^(\d+)-`)
+
+// ListExec returns the names of the executable plugins in dir, in the order they're called.
+func ListExec(dir string) ([]string, error) {
+	ps, err := getExec(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, p := range ps {
+		names = append(names, p.name)
+	}
+	return names, nil
+}
+
+// getExec returns the executable plugins in dir. If dir doesn't exist, there are no executable plugins.
+//
+// Hidden files, directories, and files which aren't executable are ignored.
+// Files writable by group or other are ignored with a warning, because anyone who can write them could run code as t3c.
+func getExec(dir string, timeout time.Duration) (pluginsSlice, error) {
+	ps := pluginsSlice{}
+	if dir == "" {
+		return ps, nil
+	}
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Infoln("plugin directory '" + dir + "' doesn't exist, not loading executable plugins")
+			return ps, nil
+		}
+		return nil, errors.New("reading plugin directory '" + dir + "': " + err.Error())
+	}
+	for _, fi := range fileInfos {
+		name := fi.Name()
+		if strings.HasPrefix(name, ".") || !fi.Mode().IsRegular() {
+			continue
+		}
+		if fi.Mode().Perm()&0111 == 0 {
+			log.Infoln("plugin directory file '" + name + "' isn't executable, skipping")
+			continue
+		}
+		if fi.Mode().Perm()&0022 != 0 {
+			log.Warnln("plugin '" + name + "' is writable by group or other, skipping")
+			continue
+		}
+
+		priority := uint64(DefaultExecPriority)
+		if match := execPriorityRe.FindStringSubmatch(name); match != nil {
+			priority, err = strconv.ParseUint(match[1], 10, 64)
+			if err != nil {
+				return nil, errors.New("plugin '" + name + "' priority: " + err.Error())
+			}
+		}
+
+		p := execPlugin{path: filepath.Join(dir, name), timeout: timeout}
+		ps = append(ps, pluginObj{funcs: Funcs{modifyFilesErr: p.modifyFiles}, priority: priority, name: name})
+	}
+	return ps, nil
+}
+
+// execPlugin is a plugin which is an executable, rather than compiled into t3c-generate.
+type execPlugin struct {
+	path    string
+	timeout time.Duration
+}
+
+// modifyFiles runs the plugin executable with an ExecInput of the data and files on stdin.
+//
+// The plugin must write a JSON array of files to stdout, which replace the files with the same path and name, or are added if there are none.
+// Files the plugin doesn't write are unchanged. If the plugin has nothing to change, it may write an empty array or nothing.
+// If the plugin exits non-zero, times out, or writes invalid files, an error is returned.
+func (p execPlugin) modifyFiles(d ModifyFilesData) ([]t3cutil.ATSConfigFile, error) {
+	input, err := json.Marshal(ExecInput{ConfigData: d.TOData, Files: d.Files})
+	if err != nil {
+		return nil, errors.New("marshalling input: " + err.Error())
+	}
+
+	stdOut := bytes.Buffer{}
+	stdErr := bytes.Buffer{}
+	cmd := exec.Command(p.path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdOut
+	cmd.Stderr = &stdErr
+	// Run the plugin in its own process group, so a timeout kills any processes it started, which would otherwise hold stdout open.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.New("starting: " + err.Error())
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	timeout := (<-chan time.Time)(nil)
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err = <-done:
+	case <-timeout:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return nil, errors.New("timed out after " + p.timeout.String())
+	}
+	if errStr := strings.TrimSpace(stdErr.String()); errStr != "" {
+		log.Warnln("plugin '" + p.path + "' stderr: " + errStr)
+	}
+	if err != nil {
+		return nil, errors.New("running: " + err.Error())
+	}
+
+	if len(bytes.TrimSpace(stdOut.Bytes())) == 0 {
+		return d.Files, nil
+	}
+	outFiles := []t3cutil.ATSConfigFile{}
+	if err := json.Unmarshal(stdOut.Bytes(), &outFiles); err != nil {
+		return nil, errors.New("output isn't a JSON array of files: " + err.Error())
+	}
+	if err := validateExecFiles(outFiles); err != nil {
+		return nil, errors.New("invalid output: " + err.Error())
+	}
+	return mergeFiles(d.Files, outFiles), nil
+}
+
+// validateExecFiles returns an error if any file has an empty name, a name with a directory, or a relative path,
+// or if any two files have the same path and name.
+func validateExecFiles(files []t3cutil.ATSConfigFile) error {
+	seen := map[string]struct{}{}
+	for i, fi := range files {
+		if fi.Name == "" {
+			return errors.New("file " + strconv.Itoa(i) + " has no name")
+		}
+		if fi.Name != filepath.Base(fi.Name) || fi.Name == "." || fi.Name == ".." {
+			return errors.New("file '" + fi.Name + "' name must not have a directory, use path")
+		}
+		if !filepath.IsAbs(fi.Path) {
+			return errors.New("file '" + fi.Name + "' path '" + fi.Path + "' must be absolute")
+		}
+		key := filepath.Join(fi.Path, fi.Name)
+		if _, ok := seen[key]; ok {
+			return errors.New("file '" + key + "' is in the output more than once")
+		}
+		seen[key] = struct{}{}
+	}
+	return nil
+}
+
+// mergeFiles returns files, with each file in newFiles replacing the file with the same path and name, or added if there is none.
+func mergeFiles(files []t3cutil.ATSConfigFile, newFiles []t3cutil.ATSConfigFile) []t3cutil.ATSConfigFile {
+	fileIdxs := map[string]int{}
+	merged := make([]t3cutil.ATSConfigFile, 0, len(files)+len(newFiles))
+	for _, fi := range files {
+		fileIdxs[filepath.Join(fi.Path, fi.Name)] = len(merged)
+		merged = append(merged, fi)
+	}
+	for _, fi := range newFiles {
+		if idx, ok := fileIdxs[filepath.Join(fi.Path, fi.Name)]; ok {
+			merged[idx] = fi
+			continue
+		}
+		merged = append(merged, fi)
+	}
+	return merged
+}
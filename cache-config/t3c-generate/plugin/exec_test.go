@@ -0,0 +1,140 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-generate/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+func writeExecPlugin(t *testing.T, dir string, name string, script string, perm os.FileMode) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), perm); err != nil {
+		t.Fatalf("writing plugin '%s': %v", name, err)
+	}
+	if err := os.Chmod(filepath.Join(dir, name), perm); err != nil { // WriteFile perms are masked by the umask
+		t.Fatalf("setting plugin '%s' permissions: %v", name, err)
+	}
+}
+
+func TestExecPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t3c-generate-plugins")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// replaces remap.config, which the later plugin then appends to
+	writeExecPlugin(t, dir, "100-replace", `cat > /dev/null
+printf '%s' '[{"name":"remap.config","path":"/etc/trafficserver","text":"map a b\n"}]'
+`, 0755)
+	writeExecPlugin(t, dir, "add", `cat > /dev/null
+printf '%s' '[{"name":"site.config","path":"/etc/trafficserver","text":"site\n"}]'
+`, 0755)
+	writeExecPlugin(t, dir, "200-noop", "cat > /dev/null\n", 0755)
+	writeExecPlugin(t, dir, "not-executable", "exit 1\n", 0644)
+	writeExecPlugin(t, dir, "writable", "exit 1\n", 0777)
+	writeExecPlugin(t, dir, ".hidden", "exit 1\n", 0755)
+
+	names, err := ListExec(dir)
+	if err != nil {
+		t.Fatalf("listing plugins: %v", err)
+	}
+	if actual, exp := strings.Join(names, ","), "100-replace,200-noop,add"; actual != exp {
+		t.Errorf("expected plugins '%s', actual '%s'", exp, actual)
+	}
+
+	plugins, err := Get(config.Cfg{PluginDir: dir, PluginTimeout: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("getting plugins: %v", err)
+	}
+	files, err := plugins.ModifyFiles(ModifyFilesData{
+		TOData: &t3cutil.ConfigData{},
+		Files: []t3cutil.ATSConfigFile{
+			{Name: "records.config", Path: "/etc/trafficserver", Text: "records\n"},
+			{Name: "remap.config", Path: "/etc/trafficserver", Text: "map x y\n"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("modifying files: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, actual %+v", files)
+	}
+	if files[0].Text != "records\n" {
+		t.Errorf("expected unmodified records.config, actual '%s'", files[0].Text)
+	}
+	if files[1].Name != "remap.config" || files[1].Text != "map a b\n" {
+		t.Errorf("expected replaced remap.config, actual %+v", files[1])
+	}
+	if files[2].Name != "site.config" {
+		t.Errorf("expected added site.config, actual %+v", files[2])
+	}
+}
+
+func TestExecPluginErrors(t *testing.T) {
+	type testCase struct {
+		name   string
+		script string
+		expErr string
+	}
+	testCases := []testCase{
+		{name: "exit", script: "exit 3\n", expErr: "exit status 3"},
+		{name: "timeout", script: "sleep 5; echo []\n", expErr: "timed out"},
+		{name: "not json", script: "echo 'map a b'\n", expErr: "isn't a JSON array of files"},
+		{name: "no name", script: `echo '[{"path":"/etc/trafficserver"}]'` + "\n", expErr: "has no name"},
+		{name: "name dir", script: `echo '[{"name":"a/b.config","path":"/etc/trafficserver"}]'` + "\n", expErr: "must not have a directory"},
+		{name: "relative path", script: `echo '[{"name":"b.config","path":"etc"}]'` + "\n", expErr: "must be absolute"},
+		{name: "duplicate", script: `echo '[{"name":"b.config","path":"/etc"},{"name":"b.config","path":"/etc/"}]'` + "\n", expErr: "more than once"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "t3c-generate-plugins")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			writeExecPlugin(t, dir, "fail", "cat > /dev/null\n"+tc.script, 0755)
+
+			plugins, err := Get(config.Cfg{PluginDir: dir, PluginTimeout: 200 * time.Millisecond})
+			if err != nil {
+				t.Fatalf("getting plugins: %v", err)
+			}
+			_, err = plugins.ModifyFiles(ModifyFilesData{TOData: &t3cutil.ConfigData{}})
+			if err == nil {
+				t.Fatalf("expected error containing '%s', actual nil", tc.expErr)
+			}
+			if !strings.Contains(err.Error(), tc.expErr) {
+				t.Errorf("expected error containing '%s', actual '%v'", tc.expErr, err)
+			}
+		})
+	}
+}
+
+func TestExecPluginsNoDir(t *testing.T) {
+	names, err := ListExec("/nonexistent/t3c-generate/plugins")
+	if err != nil {
+		t.Fatalf("expected a nonexistent plugin dir to have no plugins, actual error: %v", err)
+	}
+	if len(names) != 0 {
+		t.Errorf("expected a nonexistent plugin dir to have no plugins, actual: %+v", names)
+	}
+}
@@ -15,6 +15,7 @@ package plugin
 */
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -37,23 +38,29 @@ func List() []string {
 	return l
 }
 
-func Get(appCfg config.Cfg) Plugins {
-	pluginSlice := getAll()
-	return plugins{slice: pluginSlice}
+// Get returns the plugins compiled into the calling executable, and the executable plugins in the config's plugin directory.
+func Get(appCfg config.Cfg) (Plugins, error) {
+	execPlugins, err := getExec(appCfg.PluginDir, appCfg.PluginTimeout)
+	if err != nil {
+		return nil, errors.New("getting executable plugins: " + err.Error())
+	}
+	pluginSlice := getAll(execPlugins)
+	return plugins{slice: pluginSlice}, nil
 }
 
-func getAll() pluginsSlice {
+func getAll(execPlugins pluginsSlice) pluginsSlice {
 	enabledPlugins := pluginsSlice{}
 	for _, plugin := range initPlugins {
 		enabledPlugins = append(enabledPlugins, plugin)
 	}
-	sort.Sort(enabledPlugins)
+	enabledPlugins = append(enabledPlugins, execPlugins...)
+	sort.Stable(enabledPlugins)
 	return enabledPlugins
 }
 
 type Plugins interface {
 	OnStartup(d StartupData)
-	ModifyFiles(d ModifyFilesData) []t3cutil.ATSConfigFile
+	ModifyFiles(d ModifyFilesData) ([]t3cutil.ATSConfigFile, error)
 }
 
 func AddPlugin(priority uint64, funcs Funcs) {
@@ -71,6 +78,8 @@ func AddPlugin(priority uint64, funcs Funcs) {
 type Funcs struct {
 	onStartup   StartupFunc
 	modifyFiles ModifyFilesFunc
+	// modifyFilesErr is modifyFiles for plugins which can fail, such as executable plugins.
+	modifyFilesErr ModifyFilesErrFunc
 }
 
 type StartupData struct {
@@ -92,6 +101,7 @@ const (
 
 type StartupFunc func(d StartupData)
 type ModifyFilesFunc func(d ModifyFilesData) []t3cutil.ATSConfigFile
+type ModifyFilesErrFunc func(d ModifyFilesData) ([]t3cutil.ATSConfigFile, error)
 
 type pluginObj struct {
 	funcs    Funcs
@@ -107,9 +117,14 @@ type plugins struct {
 
 type pluginsSlice []pluginObj
 
-func (p pluginsSlice) Len() int           { return len(p) }
-func (p pluginsSlice) Less(i, j int) bool { return p[i].priority < p[j].priority }
-func (p pluginsSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p pluginsSlice) Len() int { return len(p) }
+func (p pluginsSlice) Less(i, j int) bool {
+	if p[i].priority != p[j].priority {
+		return p[i].priority < p[j].priority
+	}
+	return p[i].name < p[j].name
+}
+func (p pluginsSlice) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
 
 // initPlugins is where plugins are registered via their init functions.
 var initPlugins = pluginsSlice{}
@@ -124,9 +139,19 @@ func (ps plugins) OnStartup(d StartupData) {
 }
 
 // ModifyFiles returns a slice of config files to use. May return d.Files unmodified, or may add, remove, or modify files in d.Files.
-func (ps plugins) ModifyFiles(d ModifyFilesData) []t3cutil.ATSConfigFile {
+// Returns an error if any plugin fails, in which case the files must not be used.
+func (ps plugins) ModifyFiles(d ModifyFilesData) ([]t3cutil.ATSConfigFile, error) {
 	log.Infof("plugins.ModifyFiles calling %+v plugins\n", len(ps.slice))
 	for _, p := range ps.slice {
+		if p.funcs.modifyFilesErr != nil {
+			log.Infoln("plugins.ModifyFiles plugging " + p.name)
+			files, err := p.funcs.modifyFilesErr(d)
+			if err != nil {
+				return nil, errors.New("plugin '" + p.name + "': " + err.Error())
+			}
+			d.Files = files
+			continue
+		}
 		if p.funcs.modifyFiles == nil {
 			log.Infoln("plugins.ModifyFiles plugging " + p.name + " - no modifyFiles func")
 			continue
@@ -134,5 +159,5 @@ func (ps plugins) ModifyFiles(d ModifyFilesData) []t3cutil.ATSConfigFile {
 		log.Infoln("plugins.ModifyFiles plugging " + p.name)
 		d.Files = p.funcs.modifyFiles(d)
 	}
-	return d.Files
+	return d.Files, nil
 }
@@ -61,7 +61,10 @@ func TestPlugin(t *testing.T) {
 	}
 
 	cfg := config.Cfg{}
-	plugins := Get(cfg)
+	plugins, err := Get(cfg)
+	if err != nil {
+		t.Fatalf("getting plugins: %v", err)
+	}
 
 	modifyFilesData := ModifyFilesData{
 		Cfg:    cfg,
@@ -69,7 +72,10 @@ func TestPlugin(t *testing.T) {
 		TOData: &t3cutil.ConfigData{},
 	}
 
-	newFiles := plugins.ModifyFiles(modifyFilesData)
+	newFiles, err := plugins.ModifyFiles(modifyFilesData)
+	if err != nil {
+		t.Fatalf("modifying files: %v", err)
+	}
 	if len(newFiles) > 0 {
 		t.Error("Expected server '' to be unhandled by a plugin, actual: handled")
 	}
@@ -78,7 +84,10 @@ func TestPlugin(t *testing.T) {
 		modifyFilesData.TOData.Server = &atscfg.Server{}
 	}
 	modifyFilesData.TOData.Server.HostName = util.StrPtr("testplugin")
-	newFiles = plugins.ModifyFiles(modifyFilesData)
+	newFiles, err = plugins.ModifyFiles(modifyFilesData)
+	if err != nil {
+		t.Fatalf("modifying files: %v", err)
+	}
 	if len(newFiles) == 0 {
 		t.Error("Expected server 'testplugin' to be handled by plugin, actual: unhandled")
 	}
@@ -43,7 +43,12 @@ func main() {
 	}
 
 	if cfg.ListPlugins {
-		fmt.Println(strings.Join(plugin.List(), "\n"))
+		execPlugins, err := plugin.ListExec(cfg.PluginDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Listing executable plugins: "+err.Error()+"\n")
+			os.Exit(config.ExitCodeErrGeneric)
+		}
+		fmt.Println(strings.Join(append(plugin.List(), execPlugins...), "\n"))
 		os.Exit(0)
 	}
 
@@ -58,7 +63,11 @@ func main() {
 		log.Infoln(startMsg)
 	}
 
-	plugins := plugin.Get(cfg)
+	plugins, err := plugin.Get(cfg)
+	if err != nil {
+		log.Errorln("getting plugins: " + err.Error())
+		os.Exit(config.ExitCodeErrGeneric)
+	}
 	plugins.OnStartup(plugin.StartupData{Cfg: cfg})
 
 	log.Infoln("reading Traffic Ops data from stdin")
@@ -87,7 +96,11 @@ func main() {
 	}
 
 	modifyFilesData := plugin.ModifyFilesData{Cfg: cfg, TOData: toData, Files: configs}
-	configs = plugins.ModifyFiles(modifyFilesData)
+	configs, err = plugins.ModifyFiles(modifyFilesData)
+	if err != nil {
+		log.Errorln("running plugins for '" + *toData.Server.HostName + "': " + err.Error())
+		os.Exit(config.ExitCodeErrGeneric)
+	}
 
 	sort.Sort(t3cutil.ATSConfigFiles(configs))
 
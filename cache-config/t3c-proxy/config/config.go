@@ -0,0 +1,184 @@
+package config
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/pborman/getopt/v2"
+)
+
+const AppName = "t3c-proxy"
+const Version = "0.1"
+const UserAgent = AppName + "/" + Version
+
+const DefaultListen = ":8043"
+
+type Cfg struct {
+	LogLocationDebug string
+	LogLocationError string
+	LogLocationInfo  string
+	LogLocationWarn  string
+
+	// Listen is the address to serve the proxy on, as given to net/http.
+	Listen string
+	// TLSCertFile and TLSKeyFile are the certificate and key to serve HTTPS with. If they're empty, HTTP is served.
+	TLSCertFile string
+	TLSKeyFile  string
+	// EvictTime is how long a cached Traffic Ops response is kept after it was last requested.
+	EvictTime time.Duration
+	// MaxCacheEntries is the most Traffic Ops responses to cache. When the cache is full, the least recently requested response is evicted.
+	MaxCacheEntries int
+	// AuthCacheTime is how long a client's Traffic Ops cookie is trusted after it was checked with Traffic Ops.
+	AuthCacheTime time.Duration
+
+	t3cutil.TCCfg
+}
+
+func (cfg Cfg) DebugLog() log.LogLocation   { return log.LogLocation(cfg.LogLocationDebug) }
+func (cfg Cfg) ErrorLog() log.LogLocation   { return log.LogLocation(cfg.LogLocationError) }
+func (cfg Cfg) InfoLog() log.LogLocation    { return log.LogLocation(cfg.LogLocationInfo) }
+func (cfg Cfg) WarningLog() log.LogLocation { return log.LogLocation(cfg.LogLocationWarn) }
+func (cfg Cfg) EventLog() log.LogLocation   { return log.LogLocation(log.LogLocationNull) } // event logging is not used.
+
+// Usage() writes command line options and usage to 'stderr'
+func Usage() {
+	getopt.PrintUsage(os.Stderr)
+	os.Exit(0)
+}
+
+// InitConfig() intializes the configuration variables and loggers.
+func InitConfig() (Cfg, error) {
+	listenPtr := getopt.StringLong("listen", 'l', DefaultListen, "Address to serve the proxy on, default is "+DefaultListen)
+	tlsCertFilePtr := getopt.StringLong("tls-cert-file", 'c', "", "Certificate file to serve HTTPS with. If this and tls-key-file are empty, HTTP is served")
+	tlsKeyFilePtr := getopt.StringLong("tls-key-file", 'k', "", "Key file to serve HTTPS with. If this and tls-cert-file are empty, HTTP is served")
+	evictTimePtr := getopt.IntLong("evict-time", 'e', 3600, "[seconds] evict cached Traffic Ops responses which haven't been requested for [seconds], default is 3600")
+	maxCacheEntriesPtr := getopt.IntLong("max-cache-entries", 'n', 10000, "Maximum number of Traffic Ops responses to cache. When the cache is full, the least recently requested response is evicted, default is 10000")
+	authCacheTimePtr := getopt.IntLong("auth-cache-time", 'a', 300, "[seconds] trust a client's Traffic Ops cookie for [seconds] after checking it with Traffic Ops, default is 300")
+	toInsecurePtr := getopt.BoolLong("traffic-ops-insecure", 'I', "[true | false] ignore certificate errors from Traffic Ops")
+	toTimeoutMSPtr := getopt.IntLong("traffic-ops-timeout-milliseconds", 't', 30000, "Timeout in milli-seconds for Traffic Ops requests, default is 30000")
+	toURLPtr := getopt.StringLong("traffic-ops-url", 'u', "", "Traffic Ops URL. Must be the full URL, including the scheme. Required. May also be set with the environment variable TO_URL")
+	toUserPtr := getopt.StringLong("traffic-ops-user", 'U', "", "Traffic Ops username. Required. May also be set with the environment variable TO_USER")
+	toPassPtr := getopt.StringLong("traffic-ops-password", 'P', "", "Traffic Ops password. Required. May also be set with the environment variable TO_PASS")
+	helpPtr := getopt.BoolLong("help", 'h', "Print usage information and exit")
+	versionPtr := getopt.BoolLong("version", 'V', "Print the version")
+	verbosePtr := getopt.CounterLong("verbose", 'v', `Log verbosity. Logging is output to stderr. By default, errors are logged. To log warnings, pass '-v'. To log info, pass '-vv'. To omit error logging, see '-s'`)
+	silentPtr := getopt.BoolLong("silent", 's', `Silent. Errors are not logged, and the 'verbose' flag is ignored. If a fatal error occurs, the return code will be non-zero but no text will be output to stderr`)
+
+	getopt.Parse()
+
+	if *helpPtr == true {
+		Usage()
+	}
+	if *versionPtr == true {
+		fmt.Println(AppName + " v" + Version)
+		os.Exit(0)
+	}
+
+	logLocationError := log.LogLocationStderr
+	logLocationWarn := log.LogLocationNull
+	logLocationInfo := log.LogLocationNull
+	logLocationDebug := log.LogLocationNull
+	if *silentPtr {
+		logLocationError = log.LogLocationNull
+	} else {
+		if *verbosePtr >= 1 {
+			logLocationWarn = log.LogLocationStderr
+		}
+		if *verbosePtr >= 2 {
+			logLocationInfo = log.LogLocationStderr
+			logLocationDebug = log.LogLocationStderr // t3c only has 3 verbosity options: none (-s), error (default or --verbose=0), warning (-v), and info (-vv). Any code calling log.Debug is treated as Info.
+		}
+	}
+
+	if *verbosePtr > 2 {
+		return Cfg{}, errors.New("Too many verbose options. The maximum log verbosity level is 2 (-vv or --verbose=2) for errors (0), warnings (1), and info (2)")
+	}
+
+	if (*tlsCertFilePtr == "") != (*tlsKeyFilePtr == "") {
+		return Cfg{}, errors.New("tls-cert-file and tls-key-file must be given together")
+	}
+	if *evictTimePtr < 0 {
+		return Cfg{}, errors.New("evict-time must not be negative")
+	}
+	if *maxCacheEntriesPtr < 1 {
+		return Cfg{}, errors.New("max-cache-entries must be positive")
+	}
+	if *authCacheTimePtr < 0 {
+		return Cfg{}, errors.New("auth-cache-time must not be negative")
+	}
+
+	toTimeoutMS := time.Millisecond * time.Duration(*toTimeoutMSPtr)
+	toURL := *toURLPtr
+	toUser := *toUserPtr
+	toPass := *toPassPtr
+
+	urlSourceStr := "argument" // for error messages
+	if toURL == "" {
+		urlSourceStr = "environment variable"
+		toURL = os.Getenv("TO_URL")
+	}
+	if toUser == "" {
+		toUser = os.Getenv("TO_USER")
+	}
+	if *toPassPtr == "" {
+		toPass = os.Getenv("TO_PASS")
+	}
+
+	toURLParsed, err := url.Parse(toURL)
+	if err != nil {
+		return Cfg{}, errors.New("parsing Traffic Ops URL from " + urlSourceStr + " '" + toURL + "': " + err.Error())
+	} else if err := t3cutil.ValidateURL(toURLParsed); err != nil {
+		return Cfg{}, errors.New("invalid Traffic Ops URL from " + urlSourceStr + " '" + toURL + "': " + err.Error())
+	}
+
+	cfg := Cfg{
+		LogLocationDebug: logLocationDebug,
+		LogLocationError: logLocationError,
+		LogLocationInfo:  logLocationInfo,
+		LogLocationWarn:  logLocationWarn,
+		Listen:           *listenPtr,
+		TLSCertFile:      *tlsCertFilePtr,
+		TLSKeyFile:       *tlsKeyFilePtr,
+		EvictTime:        time.Second * time.Duration(*evictTimePtr),
+		MaxCacheEntries:  *maxCacheEntriesPtr,
+		AuthCacheTime:    time.Second * time.Duration(*authCacheTimePtr),
+		TCCfg: t3cutil.TCCfg{
+			TOInsecure:  *toInsecurePtr,
+			TOTimeoutMS: toTimeoutMS,
+			TOUser:      toUser,
+			TOPass:      toPass,
+			TOURL:       toURLParsed,
+			UserAgent:   UserAgent,
+		},
+	}
+
+	if err := log.InitCfg(cfg); err != nil {
+		return Cfg{}, errors.New("initializing loggers: " + err.Error())
+	}
+
+	return cfg, nil
+}
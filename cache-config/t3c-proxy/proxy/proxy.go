@@ -0,0 +1,413 @@
+package proxy
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-generate/torequtil"
+	"github.com/apache/trafficcontrol/cache-config/t3c-proxy/config"
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
+	toclient "github.com/apache/trafficcontrol/traffic_ops/v3-client"
+)
+
+// CacheStatusHeader is the response header which says how the proxy served the request, one of the CacheStatus values.
+const CacheStatusHeader = "X-Cache"
+
+const (
+	// CacheStatusMiss is a response which was not cached, or was modified, and was fetched from Traffic Ops.
+	CacheStatusMiss = "MISS"
+	// CacheStatusRevalidated is a cached response which Traffic Ops said was not modified.
+	CacheStatusRevalidated = "REVALIDATED"
+)
+
+// Proxy is a caching proxy of the Traffic Ops API, for the GET requests t3c makes to get config data.
+//
+// The proxy makes all requests to Traffic Ops with its own session, and caches the responses. Every request revalidates the cached response with If-Modified-Since, so when many caches request the same data, Traffic Ops is only asked whether it changed, and clients never get data older than Traffic Ops has. If Traffic Ops can't be reached, requests fail, rather than applying stale config.
+//
+// Clients must log in to Traffic Ops as the same user as the proxy, and send the proxy their Traffic Ops cookie. This ensures the proxy never serves clients data they couldn't get from Traffic Ops.
+type Proxy struct {
+	cfg config.Cfg
+
+	// upstream requests the path from Traffic Ops with the proxy's session, and checkAuth returns the user name of the Traffic Ops session with the given cookie, or the empty string if it isn't logged in.
+	// They're funcs so tests can replace Traffic Ops.
+	upstream  func(path string, hdr http.Header) (*http.Response, error)
+	checkAuth func(apiVersion string, cookie string) (string, error)
+
+	sessionMutex sync.Mutex
+	session      *toclient.Session
+	// authClient checks client cookies. It's separate from the session, so the session's cookie is never sent with a client's cookie.
+	authClient *http.Client
+
+	cacheMutex sync.Mutex
+	cache      map[string]*cacheEntry
+	fetches    map[string]*fetch
+
+	authMutex sync.Mutex
+	auth      map[string]time.Time
+}
+
+// cacheEntry is a cached 200 OK response from Traffic Ops.
+type cacheEntry struct {
+	body         []byte
+	contentType  string
+	lastModified string
+	// fetched is the time the response was last fetched or revalidated. Because every request revalidates, it's also the last time the response was requested, which eviction uses.
+	fetched time.Time
+}
+
+// response is a response to serve to a client.
+type response struct {
+	code         int
+	body         []byte
+	contentType  string
+	lastModified string
+	cacheStatus  string
+}
+
+// fetch is a request to Traffic Ops in progress, which concurrent client requests for the same path wait for, rather than making their own.
+type fetch struct {
+	done chan struct{}
+	resp *response
+	err  error
+	// waiting is the number of requests waiting for the fetch, besides the one making it.
+	waiting int
+}
+
+func (entry *cacheEntry) response(cacheStatus string) *response {
+	return &response{
+		code:         http.StatusOK,
+		body:         entry.body,
+		contentType:  entry.contentType,
+		lastModified: entry.lastModified,
+		cacheStatus:  cacheStatus,
+	}
+}
+
+// New creates a new Proxy. The proxy doesn't log in to Traffic Ops until it receives its first request.
+func New(cfg config.Cfg) *Proxy {
+	p := &Proxy{
+		cfg: cfg,
+		authClient: &http.Client{
+			Timeout:   cfg.TOTimeoutMS,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.TOInsecure}},
+		},
+		cache:   map[string]*cacheEntry{},
+		fetches: map[string]*fetch{},
+		auth:    map[string]time.Time{},
+	}
+	p.upstream = p.requestTO
+	p.checkAuth = p.requestCurrentUser
+	return p
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeErr(w, http.StatusMethodNotAllowed, "only GET requests are proxied")
+		return
+	}
+	apiVersion, ok := apiVersionFromPath(r.URL.Path)
+	if !ok {
+		writeErr(w, http.StatusNotFound, "only Traffic Ops API requests are proxied")
+		return
+	}
+
+	authorized, err := p.authorized(apiVersion, r.Header.Get("Cookie"))
+	if err != nil {
+		log.Errorln("checking client '" + r.RemoteAddr + "' authentication: " + err.Error())
+		writeErr(w, http.StatusBadGateway, "checking authentication with Traffic Ops failed")
+		return
+	} else if !authorized {
+		writeErr(w, http.StatusUnauthorized, "Unauthorized, please log in.")
+		return
+	}
+
+	resp, err := p.get(r.URL.RequestURI())
+	if err != nil {
+		log.Errorln("proxying '" + r.URL.RequestURI() + "': " + err.Error())
+		writeErr(w, http.StatusBadGateway, "requesting Traffic Ops failed")
+		return
+	}
+
+	if resp.contentType != "" {
+		w.Header().Set(rfc.ContentType, resp.contentType)
+	}
+	if resp.lastModified != "" {
+		w.Header().Set(rfc.LastModified, resp.lastModified)
+	}
+	w.Header().Set(CacheStatusHeader, resp.cacheStatus)
+	w.WriteHeader(resp.code)
+	w.Write(resp.body)
+}
+
+// get returns the response for the path from Traffic Ops, revalidating the cached response if there is one.
+// Cached responses are never served without asking Traffic Ops, because t3c must apply the current config.
+// Concurrent requests for the same path make a single request to Traffic Ops.
+func (p *Proxy) get(path string) (*response, error) {
+	p.cacheMutex.Lock()
+	if f, ok := p.fetches[path]; ok {
+		f.waiting++
+		p.cacheMutex.Unlock()
+		<-f.done
+		return f.resp, f.err
+	}
+	entry := p.cache[path]
+	f := &fetch{done: make(chan struct{})}
+	p.fetches[path] = f
+	p.cacheMutex.Unlock()
+
+	f.resp, f.err = p.fetch(path, entry)
+
+	p.cacheMutex.Lock()
+	delete(p.fetches, path)
+	waiting := f.waiting
+	p.cacheMutex.Unlock()
+	close(f.done)
+	if waiting > 0 {
+		log.Debugf("fetched '%v' for %v waiting requests\n", path, waiting)
+	}
+	return f.resp, f.err
+}
+
+// fetch requests the path from Traffic Ops, revalidating the old entry if it isn't nil, and caches a successful response.
+// If Traffic Ops can't be reached or returns a server error, an error is returned, and the old entry is never served stale.
+func (p *Proxy) fetch(path string, old *cacheEntry) (*response, error) {
+	hdr := http.Header{}
+	if old != nil && old.lastModified != "" {
+		hdr.Set(rfc.IfModifiedSince, old.lastModified)
+	} else {
+		// Traffic Ops only computes the Last-Modified for requests with an If-Modified-Since, so the first request asks for anything since the epoch.
+		hdr.Set(rfc.IfModifiedSince, rfc.FormatHTTPDate(time.Unix(0, 0)))
+	}
+
+	resp, err := p.upstream(path, hdr)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.New("reading Traffic Ops response body: " + err.Error())
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && old != nil:
+		entry := &cacheEntry{
+			body:         old.body,
+			contentType:  old.contentType,
+			lastModified: old.lastModified,
+			fetched:      time.Now(),
+		}
+		p.store(path, entry)
+		return entry.response(CacheStatusRevalidated), nil
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, errors.New("Traffic Ops returned 304 Not Modified, but there was no cached response")
+	case resp.StatusCode == http.StatusOK:
+		entry := &cacheEntry{
+			body:         body,
+			contentType:  resp.Header.Get(rfc.ContentType),
+			lastModified: resp.Header.Get(rfc.LastModified),
+			fetched:      time.Now(),
+		}
+		p.store(path, entry)
+		return entry.response(CacheStatusMiss), nil
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, errors.New("Traffic Ops returned " + resp.Status)
+	default:
+		// client errors such as 404 are passed through, but not cached
+		return &response{
+			code:        resp.StatusCode,
+			body:        body,
+			contentType: resp.Header.Get(rfc.ContentType),
+			cacheStatus: CacheStatusMiss,
+		}, nil
+	}
+}
+
+// store caches the entry. Entries which haven't been requested for the evict time are evicted, and if the cache has more than the max entries, the least recently requested entry is evicted.
+func (p *Proxy) store(path string, entry *cacheEntry) {
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+	p.cache[path] = entry
+	oldest := ""
+	for oldPath, oldEntry := range p.cache {
+		if entry.fetched.Sub(oldEntry.fetched) > p.cfg.EvictTime {
+			delete(p.cache, oldPath)
+			continue
+		}
+		if oldPath != path && (oldest == "" || oldEntry.fetched.Before(p.cache[oldest].fetched)) {
+			oldest = oldPath
+		}
+	}
+	if len(p.cache) > p.cfg.MaxCacheEntries {
+		delete(p.cache, oldest)
+	}
+}
+
+// authorized returns whether the client with the given cookie is logged in to Traffic Ops as the proxy's user.
+// Successful checks are cached for the configured auth cache time, so clients don't make a Traffic Ops request for every proxied request.
+func (p *Proxy) authorized(apiVersion string, cookie string) (bool, error) {
+	if cookie == "" {
+		return false, nil
+	}
+	now := time.Now()
+	p.authMutex.Lock()
+	expires, ok := p.auth[cookie]
+	p.authMutex.Unlock()
+	if ok && now.Before(expires) {
+		return true, nil
+	}
+
+	userName, err := p.checkAuth(apiVersion, cookie)
+	if err != nil {
+		return false, err
+	}
+	if userName != p.cfg.TOUser {
+		if userName != "" {
+			log.Warnln("client logged in as Traffic Ops user '" + userName + "', but only '" + p.cfg.TOUser + "' is served, rejecting")
+		}
+		return false, nil
+	}
+
+	p.authMutex.Lock()
+	defer p.authMutex.Unlock()
+	for oldCookie, oldExpires := range p.auth {
+		if now.After(oldExpires) {
+			delete(p.auth, oldCookie)
+		}
+	}
+	p.auth[cookie] = now.Add(p.cfg.AuthCacheTime)
+	return true, nil
+}
+
+// requestCurrentUser returns the user name of the Traffic Ops session with the given cookie, or the empty string if Traffic Ops says it isn't logged in.
+func (p *Proxy) requestCurrentUser(apiVersion string, cookie string) (string, error) {
+	toURL := p.cfg.TOURL.Scheme + "://" + p.cfg.TOURL.Host + "/api/" + apiVersion + "/user/current"
+	req, err := http.NewRequest(http.MethodGet, toURL, nil)
+	if err != nil {
+		return "", errors.New("creating request: " + err.Error())
+	}
+	req.Header.Set("Cookie", cookie)
+	req.Header.Set("User-Agent", p.cfg.UserAgent)
+	resp, err := p.authClient.Do(req)
+	if err != nil {
+		return "", errors.New("requesting current user: " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("requesting current user: Traffic Ops returned " + resp.Status)
+	}
+	user := tc.UserCurrentResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return "", errors.New("decoding current user: " + err.Error())
+	}
+	if user.Response.UserName == nil {
+		return "", errors.New("Traffic Ops returned a current user with no username")
+	}
+	return *user.Response.UserName, nil
+}
+
+// requestTO requests the path from Traffic Ops with the proxy's session, logging in again if the session expired.
+func (p *Proxy) requestTO(path string, hdr http.Header) (*http.Response, error) {
+	session, err := p.getSession(false)
+	if err != nil {
+		return nil, err
+	}
+	resp, toAddr, err := session.RawRequestWithHdr(http.MethodGet, path, nil, hdr)
+	if err != nil {
+		return nil, errors.New("requesting Traffic Ops '" + torequtil.MaybeIPStr(toAddr) + "': " + err.Error())
+	}
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	log.Warnln("Traffic Ops returned " + resp.Status + ", logging in again")
+	if session, err = p.getSession(true); err != nil {
+		return nil, err
+	}
+	resp, toAddr, err = session.RawRequestWithHdr(http.MethodGet, path, nil, hdr)
+	if err != nil {
+		return nil, errors.New("requesting Traffic Ops '" + torequtil.MaybeIPStr(toAddr) + "': " + err.Error())
+	}
+	return resp, nil
+}
+
+// getSession returns the proxy's Traffic Ops session, logging in if there isn't one, or if relogin is true.
+func (p *Proxy) getSession(relogin bool) (*toclient.Session, error) {
+	p.sessionMutex.Lock()
+	defer p.sessionMutex.Unlock()
+	if p.session != nil && !relogin {
+		return p.session, nil
+	}
+	opts := toclient.ClientOpts{ClientOpts: toclientlib.ClientOpts{
+		Insecure:       p.cfg.TOInsecure,
+		UserAgent:      p.cfg.UserAgent,
+		RequestTimeout: p.cfg.TOTimeoutMS,
+	}}
+	toURL := p.cfg.TOURL.Scheme + "://" + p.cfg.TOURL.Host
+	session, inf, err := toclient.Login(toURL, p.cfg.TOUser, p.cfg.TOPass, opts)
+	if err != nil {
+		return nil, errors.New("logging in to Traffic Ops '" + torequtil.MaybeIPStr(inf.RemoteAddr) + "': " + err.Error())
+	}
+	log.Infoln("logged in to Traffic Ops '" + torequtil.MaybeIPStr(inf.RemoteAddr) + "'")
+	p.session = session
+	return session, nil
+}
+
+// apiVersionFromPath returns the API version of a Traffic Ops API path, such as "3.0" for "/api/3.0/servers", and false if it isn't an API path.
+func apiVersionFromPath(path string) (string, bool) {
+	const prefix = "/api/"
+	if !strings.HasPrefix(path, prefix) {
+		return "", false
+	}
+	parts := strings.SplitN(path[len(prefix):], "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// writeErr writes the error as Traffic Ops error alerts, so clients can parse it like a Traffic Ops error.
+func writeErr(w http.ResponseWriter, code int, msg string) {
+	bts, err := json.Marshal(tc.CreateErrorAlerts(errors.New(msg)))
+	if err != nil {
+		log.Errorln("marshalling error alerts: " + err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+	w.WriteHeader(code)
+	w.Write(bts)
+}
@@ -0,0 +1,297 @@
+package proxy
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-proxy/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+const testLastModified = "Mon, 21 Jun 2021 19:17:53 GMT"
+
+func newTestProxy() *Proxy {
+	p := New(config.Cfg{
+		EvictTime:       time.Hour,
+		MaxCacheEntries: 100,
+		AuthCacheTime:   time.Minute,
+		TCCfg:           t3cutil.TCCfg{TOUser: "t3c"},
+	})
+	p.checkAuth = func(apiVersion string, cookie string) (string, error) {
+		if cookie == "mojolicious=good" {
+			return "t3c", nil
+		}
+		return "", nil
+	}
+	return p
+}
+
+func testResp(code int, body string) *http.Response {
+	resp := &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+	}
+	resp.Header.Set(rfc.ContentType, rfc.ApplicationJSON)
+	if code == http.StatusOK {
+		resp.Header.Set(rfc.LastModified, testLastModified)
+	}
+	return resp
+}
+
+func doTestReq(p *Proxy, method string, path string, cookie string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if cookie != "" {
+		req.Header.Set("Cookie", cookie)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	return w
+}
+
+func TestProxyCaching(t *testing.T) {
+	p := newTestProxy()
+	imses := []string{}
+	p.upstream = func(path string, hdr http.Header) (*http.Response, error) {
+		imses = append(imses, hdr.Get(rfc.IfModifiedSince))
+		if len(imses) == 1 {
+			return testResp(http.StatusOK, `{"response":[]}`), nil
+		}
+		return testResp(http.StatusNotModified, ``), nil
+	}
+
+	w := doTestReq(p, http.MethodGet, "/api/3.0/servers", "mojolicious=good")
+	if w.Code != http.StatusOK || w.Body.String() != `{"response":[]}` || w.Header().Get(CacheStatusHeader) != CacheStatusMiss {
+		t.Fatalf("expected first request to be a 200 miss, actual %v %v '%v'", w.Code, w.Header().Get(CacheStatusHeader), w.Body.String())
+	}
+	if w.Header().Get(rfc.LastModified) != testLastModified {
+		t.Errorf("expected Last-Modified '%v', actual '%v'", testLastModified, w.Header().Get(rfc.LastModified))
+	}
+
+	w = doTestReq(p, http.MethodGet, "/api/3.0/servers", "mojolicious=good")
+	if w.Code != http.StatusOK || w.Body.String() != `{"response":[]}` || w.Header().Get(CacheStatusHeader) != CacheStatusRevalidated {
+		t.Fatalf("expected second request to be a 200 revalidated, actual %v %v '%v'", w.Code, w.Header().Get(CacheStatusHeader), w.Body.String())
+	}
+	if len(imses) != 2 {
+		t.Fatalf("expected every request to revalidate with Traffic Ops, actual %v Traffic Ops requests", len(imses))
+	}
+	if imses[0] != rfc.FormatHTTPDate(time.Unix(0, 0)) {
+		t.Errorf("expected first request If-Modified-Since to be the epoch, actual '%v'", imses[0])
+	}
+	if imses[1] != testLastModified {
+		t.Errorf("expected revalidation If-Modified-Since '%v', actual '%v'", testLastModified, imses[1])
+	}
+}
+
+func TestProxyNeverStale(t *testing.T) {
+	p := newTestProxy()
+	var failResp *http.Response
+	var failErr error
+	p.upstream = func(path string, hdr http.Header) (*http.Response, error) {
+		if failResp != nil || failErr != nil {
+			return failResp, failErr
+		}
+		return testResp(http.StatusOK, `{"response":[]}`), nil
+	}
+
+	w := doTestReq(p, http.MethodGet, "/api/3.0/cdns", "mojolicious=good")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected code %v, actual %v", http.StatusOK, w.Code)
+	}
+	failErr = errors.New("connection refused")
+	w = doTestReq(p, http.MethodGet, "/api/3.0/cdns", "mojolicious=good")
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected code %v and not a stale response when Traffic Ops can't be reached, actual %v", http.StatusBadGateway, w.Code)
+	}
+	failResp, failErr = testResp(http.StatusServiceUnavailable, ``), nil
+	w = doTestReq(p, http.MethodGet, "/api/3.0/cdns", "mojolicious=good")
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected code %v and not a stale response when Traffic Ops returns a server error, actual %v", http.StatusBadGateway, w.Code)
+	}
+	failResp, failErr = nil, errors.New("connection refused")
+	w = doTestReq(p, http.MethodGet, "/api/3.0/topologies", "mojolicious=good")
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected code %v when Traffic Ops fails with nothing cached, actual %v", http.StatusBadGateway, w.Code)
+	}
+}
+
+func TestProxyNotFoundNotCached(t *testing.T) {
+	p := newTestProxy()
+	requests := 0
+	p.upstream = func(path string, hdr http.Header) (*http.Response, error) {
+		requests++
+		return testResp(http.StatusNotFound, `{"alerts":[{"level":"error","text":"not found"}]}`), nil
+	}
+	for i := 0; i < 2; i++ {
+		w := doTestReq(p, http.MethodGet, "/api/3.0/cdns/name/foo", "mojolicious=good")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected code %v, actual %v", http.StatusNotFound, w.Code)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("expected errors to not be cached, actual %v requests", requests)
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	p := newTestProxy()
+	checks := 0
+	checkAuth := p.checkAuth
+	p.checkAuth = func(apiVersion string, cookie string) (string, error) {
+		checks++
+		if cookie == "mojolicious=otheruser" {
+			return "admin", nil
+		}
+		return checkAuth(apiVersion, cookie)
+	}
+	p.upstream = func(path string, hdr http.Header) (*http.Response, error) {
+		return testResp(http.StatusOK, `{"response":[]}`), nil
+	}
+
+	if w := doTestReq(p, http.MethodGet, "/api/3.0/cdns", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected code %v with no cookie, actual %v", http.StatusUnauthorized, w.Code)
+	}
+	if w := doTestReq(p, http.MethodGet, "/api/3.0/cdns", "mojolicious=bad"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected code %v with a bad cookie, actual %v", http.StatusUnauthorized, w.Code)
+	}
+	if w := doTestReq(p, http.MethodGet, "/api/3.0/cdns", "mojolicious=otheruser"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected code %v for a different user than the proxy, actual %v", http.StatusUnauthorized, w.Code)
+	}
+	for i := 0; i < 3; i++ {
+		if w := doTestReq(p, http.MethodGet, "/api/3.0/cdns", "mojolicious=good"); w.Code != http.StatusOK {
+			t.Errorf("expected code %v with a good cookie, actual %v", http.StatusOK, w.Code)
+		}
+	}
+	if checks != 3 {
+		t.Errorf("expected the good cookie to be checked once and cached, actual %v total checks", checks)
+	}
+}
+
+func TestProxyRejectsNonAPI(t *testing.T) {
+	p := newTestProxy()
+	p.upstream = func(path string, hdr http.Header) (*http.Response, error) {
+		t.Errorf("expected no Traffic Ops request, actual request for '%v'", path)
+		return testResp(http.StatusOK, ``), nil
+	}
+	if w := doTestReq(p, http.MethodPost, "/api/3.0/servers", "mojolicious=good"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected code %v for POST, actual %v", http.StatusMethodNotAllowed, w.Code)
+	}
+	if w := doTestReq(p, http.MethodGet, "/update/edge", "mojolicious=good"); w.Code != http.StatusNotFound {
+		t.Errorf("expected code %v for a non-API path, actual %v", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestProxyCoalescing(t *testing.T) {
+	p := newTestProxy()
+	requests := int32(0)
+	release := make(chan struct{})
+	p.upstream = func(path string, hdr http.Header) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		return testResp(http.StatusOK, `{"response":[]}`), nil
+	}
+
+	const clients = 10
+	wg := sync.WaitGroup{}
+	codes := make(chan int, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- doTestReq(p, http.MethodGet, "/api/3.0/deliveryservices", "mojolicious=good").Code
+		}()
+	}
+	// wait for the first request to reach Traffic Ops, and the others to wait for it
+	for !fetchWaiting(p, "/api/3.0/deliveryservices", clients-1) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("expected code %v, actual %v", http.StatusOK, code)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected concurrent requests to make 1 Traffic Ops request, actual %v", requests)
+	}
+}
+
+// fetchWaiting returns whether a fetch of the path is in progress with the given number of requests waiting for it.
+func fetchWaiting(p *Proxy, path string, waiting int) bool {
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+	f, ok := p.fetches[path]
+	return ok && f.waiting == waiting
+}
+
+func TestProxyEviction(t *testing.T) {
+	p := newTestProxy()
+	p.cfg.MaxCacheEntries = 2
+
+	now := time.Now()
+	p.store("/api/3.0/old", &cacheEntry{fetched: now.Add(-2 * time.Hour)})
+	p.store("/api/3.0/a", &cacheEntry{fetched: now.Add(-2 * time.Minute)})
+	if _, ok := p.cache["/api/3.0/old"]; ok {
+		t.Errorf("expected entry not requested for longer than the evict time to be evicted")
+	}
+	p.store("/api/3.0/b", &cacheEntry{fetched: now.Add(-time.Minute)})
+	p.store("/api/3.0/c", &cacheEntry{fetched: now})
+	if len(p.cache) != 2 {
+		t.Fatalf("expected %v cached entries, actual %v", 2, len(p.cache))
+	}
+	if _, ok := p.cache["/api/3.0/a"]; ok {
+		t.Errorf("expected least recently requested entry to be evicted when the cache is full")
+	}
+	for _, path := range []string{"/api/3.0/b", "/api/3.0/c"} {
+		if _, ok := p.cache[path]; !ok {
+			t.Errorf("expected entry '%v' to be cached", path)
+		}
+	}
+}
+
+func TestAPIVersionFromPath(t *testing.T) {
+	tests := map[string]string{
+		"/api/3.0/servers":          "3.0",
+		"/api/4.0/servers/x/status": "4.0",
+		"/api/3.0/":                 "",
+		"/api/":                     "",
+		"/update/edge":              "",
+	}
+	for path, expected := range tests {
+		actual, ok := apiVersionFromPath(path)
+		if actual != expected || ok != (expected != "") {
+			t.Errorf("path '%v' expected version '%v', actual '%v' %v", path, expected, actual, ok)
+		}
+	}
+}
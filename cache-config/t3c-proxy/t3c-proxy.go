@@ -0,0 +1,82 @@
+package main
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-proxy/config"
+	"github.com/apache/trafficcontrol/cache-config/t3c-proxy/proxy"
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+const ExitCodeSuccess = 0
+const ExitCodeConfigError = 1
+const ExitCodeServeError = 2
+
+// ShutdownTimeout is how long to wait for requests in progress to finish when stopping.
+const ShutdownTimeout = 30 * time.Second
+
+func main() {
+	cfg, err := config.InitConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+		os.Exit(ExitCodeConfigError)
+	}
+	log.Infoln("configuration initialized")
+
+	server := &http.Server{
+		Addr:    cfg.Listen,
+		Handler: proxy.New(cfg),
+	}
+
+	stopped := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer close(stopped)
+		sig := <-signals
+		log.Infoln("received signal '" + sig.String() + "', stopping")
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Errorln("stopping server: " + err.Error())
+		}
+	}()
+
+	log.Infoln("serving on '" + cfg.Listen + "'")
+	if cfg.TLSCertFile != "" {
+		err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Errorln("serving: " + err.Error())
+		os.Exit(ExitCodeServeError)
+	}
+	<-stopped // ListenAndServe returns as soon as Shutdown is called, before requests in progress finish
+	log.Infoln("stopped")
+}
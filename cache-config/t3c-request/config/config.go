@@ -68,6 +68,7 @@ func InitConfig() (Cfg, error) {
 	toUserPtr := getopt.StringLong("traffic-ops-user", 'U', "", "Traffic Ops username. Required. May also be set with the environment variable TO_USER")
 	revalOnlyPtr := getopt.BoolLong("reval-only", 'r', "[true | false] whether to only fetch data needed to revalidate, versus all config data. Only used if get-data is config")
 	disableProxyPtr := getopt.BoolLong("traffic-ops-disable-proxy", 'p', "[true | false] whether to not use any configure Traffic Ops proxy parameter. Only used if get-data is config")
+	proxyURLPtr := getopt.StringLong("traffic-ops-proxy-url", 'x', "", "URL of a Traffic Ops proxy to get config data from, such as a t3c-proxy in the cache's cachegroup, instead of the GLOBAL Traffic Ops proxy parameter. If the proxy fails, Traffic Ops is used directly. Only used if get-data is config")
 	toPassPtr := getopt.StringLong("traffic-ops-password", 'P', "", "Traffic Ops password. Required. May also be set with the environment variable TO_PASS    ")
 	helpPtr := getopt.BoolLong("help", 'h', "Print usage information and exit")
 	versionPtr := getopt.BoolLong("version", 'V', "Print the app version")
@@ -157,6 +158,7 @@ func InitConfig() (Cfg, error) {
 			UserAgent:      UserAgent,
 			RevalOnly:      *revalOnlyPtr,
 			TODisableProxy: *disableProxyPtr,
+			TOProxyURL:     *proxyURLPtr,
 		},
 	}
 
@@ -47,6 +47,10 @@ type Cfg struct {
 	GetData          string
 	UpdatePending    bool
 	RevalPending     bool
+	// SetStatuses is whether to set the update and reval statuses. It is only false when sending a report without statuses.
+	SetStatuses bool
+	// SendReport is whether to read a t3c-apply run report from stdin and send it to Traffic Ops.
+	SendReport bool
 	t3cutil.TCCfg
 }
 
@@ -68,8 +72,9 @@ func InitConfig() (Cfg, error) {
 	cacheHostNamePtr := getopt.StringLong("cache-host-name", 'H', "", "Host name of the cache to generate config for. Must be the server host name in Traffic Ops, not a URL, and not the FQDN")
 	var updatePendingPtr bool
 	var revalPendingPtr bool
-	getopt.FlagLong(&updatePendingPtr, "set-update-status", 'q', "[true | false] sets the servers update status").Mandatory()
-	getopt.FlagLong(&revalPendingPtr, "set-reval-status", 'a', "[true | false] sets the servers revalidate status").Mandatory()
+	getopt.FlagLong(&updatePendingPtr, "set-update-status", 'q', "[true | false] sets the servers update status. Required unless --send-report is given")
+	getopt.FlagLong(&revalPendingPtr, "set-reval-status", 'a', "[true | false] sets the servers revalidate status. Required unless --send-report is given")
+	sendReportPtr := getopt.BoolLong("send-report", 'r', "Read a JSON t3c-apply run report from stdin, and send it to Traffic Ops as a server config report")
 	toInsecurePtr := getopt.BoolLong("traffic-ops-insecure", 'I', "[true | false] ignore certificate errors from Traffic Ops")
 	toTimeoutMSPtr := getopt.IntLong("traffic-ops-timeout-milliseconds", 't', 30000, "Timeout in milli-seconds for Traffic Ops requests, default is 30000")
 	toURLPtr := getopt.StringLong("traffic-ops-url", 'u', "", "Traffic Ops URL. Must be the full URL, including the scheme. Required. May also be set with     the environment variable TO_URL")
@@ -105,6 +110,14 @@ func InitConfig() (Cfg, error) {
 		}
 	}
 
+	setStatuses := getopt.IsSet("set-update-status") || getopt.IsSet("set-reval-status")
+	if setStatuses && (!getopt.IsSet("set-update-status") || !getopt.IsSet("set-reval-status")) {
+		return Cfg{}, errors.New("--set-update-status and --set-reval-status must be given together")
+	}
+	if !setStatuses && !*sendReportPtr {
+		return Cfg{}, errors.New("--set-update-status and --set-reval-status are required, unless --send-report is given")
+	}
+
 	if *verbosePtr > 2 {
 		return Cfg{}, errors.New("Too many verbose options. The maximum log verbosity level is 2 (-vv or --verbose=2) for errors (0), warnings (1), and info (2)")
 	}
@@ -153,6 +166,8 @@ func InitConfig() (Cfg, error) {
 		LoginDispersion:  dispersion,
 		UpdatePending:    updatePendingPtr,
 		RevalPending:     revalPendingPtr,
+		SetStatuses:      setStatuses,
+		SendReport:       *sendReportPtr,
 		TCCfg: t3cutil.TCCfg{
 			CacheHostName: cacheHostName,
 			GetData:       "update-status",
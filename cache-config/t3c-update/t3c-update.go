@@ -20,12 +20,14 @@ package main
  */
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 
 	"github.com/apache/trafficcontrol/cache-config/t3c-update/config"
 	"github.com/apache/trafficcontrol/cache-config/t3cutil"
 	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
 )
 
 var (
@@ -50,6 +52,23 @@ func main() {
 		os.Exit(2)
 	}
 
+	if cfg.SendReport {
+		report := tc.ServerConfigReportRequest{}
+		if err := json.NewDecoder(os.Stdin).Decode(&report); err != nil {
+			log.Errorf("reading report from stdin: %s\n", err)
+			os.Exit(5)
+		}
+		if err := t3cutil.SendServerConfigReport(*tccfg, report); err != nil {
+			log.Errorf("%s, %s\n", err, cfg.TCCfg.CacheHostName)
+			os.Exit(6)
+		}
+		log.Infoln("Report successfully sent")
+	}
+
+	if !cfg.SetStatuses {
+		return
+	}
+
 	err = t3cutil.SetUpdateStatus(*tccfg, cfg.TCCfg.CacheHostName, cfg.UpdatePending, cfg.RevalPending)
 	if err != nil {
 		log.Errorf("%s, %s\n", err, cfg.TCCfg.CacheHostName)
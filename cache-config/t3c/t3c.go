@@ -31,9 +31,11 @@ import (
 var commands = map[string]struct{}{
 	"apply":      struct{}{},
 	"check":      struct{}{},
+	"daemon":     struct{}{},
 	"diff":       struct{}{},
 	"generate":   struct{}{},
 	"preprocess": struct{}{},
+	"proxy":      struct{}{},
 	"request":    struct{}{},
 	"update":     struct{}{},
 }
@@ -93,9 +95,11 @@ These are the available commands:
   apply      generate and apply configuration
 
   check      check that new config can be applied
+  daemon     poll Traffic Ops and apply updates as soon as they're queued
   diff       diff config files, with logic like ignoring comments
   generate   generate configuration from Traffic Ops data
   preprocess preprocess generated config files
+  proxy      serve cached Traffic Ops config data to caches
   request    request Traffic Ops data
   update     update a cache's queue and reval status in Traffic Ops
 `
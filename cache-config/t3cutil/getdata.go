@@ -34,6 +34,7 @@ import (
 	"github.com/apache/trafficcontrol/cache-config/t3c-generate/torequtil"
 	"github.com/apache/trafficcontrol/lib/go-atscfg"
 	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
 	"github.com/apache/trafficcontrol/lib/go-tc"
 )
 
@@ -52,6 +53,10 @@ type TCCfg struct {
 	// This is only used by WriteConfig, which is the only command that makes enough requests to matter.
 	TODisableProxy bool
 
+	// TOProxyURL is the URL of a Traffic Ops proxy to use, such as a t3c-proxy in the cache's cachegroup, instead of the GLOBAL Parameter TrafficOpsProxyParameterName.
+	// This is only used by WriteConfig.
+	TOProxyURL string
+
 	// RevalOnly is whether to only fetch config data necessary to revalidate, versus all data necessary to generate config. This is only used by WriteConfig
 	RevalOnly bool
 }
@@ -75,6 +80,64 @@ func GetServerUpdateStatus(cfg TCCfg) (*tc.ServerUpdateStatus, error) {
 	return &status, nil
 }
 
+// GetServerUpdateStatusIfModified gets the update status of cfg.CacheHostName, if it was modified since lastModified.
+//
+// The lastModified is the Last-Modified of a previous response, and the Last-Modified of this response is returned, to be passed to the next call.
+// If lastModified is empty, the status is always returned.
+// If Traffic Ops returns 304 Not Modified, the returned status is nil, and the returned Last-Modified is the given lastModified.
+//
+// If Traffic Ops doesn't support the latest API, this falls back to requesting the status every time, and the returned Last-Modified is always empty.
+func GetServerUpdateStatusIfModified(cfg TCCfg, lastModified string) (*tc.ServerUpdateStatus, string, error) {
+	if cfg.TOClient.FellBack() {
+		status, err := GetServerUpdateStatus(cfg)
+		return status, "", err
+	}
+
+	hdr := http.Header{}
+	if lastModified != "" {
+		hdr.Set(rfc.IfModifiedSince, lastModified)
+	} else {
+		// Traffic Ops only computes the Last-Modified for requests with an If-Modified-Since, so the first request asks for anything since the epoch.
+		hdr.Set(rfc.IfModifiedSince, rfc.FormatHTTPDate(time.Unix(0, 0)))
+	}
+
+	// The client doesn't return response headers, so the path is requested directly to get the Last-Modified.
+	path := `/api/3.0/servers/` + url.PathEscape(cfg.CacheHostName) + `/update_status`
+	resp, toAddr, err := cfg.TOClient.C.RawRequestWithHdr(http.MethodGet, path, nil, hdr)
+	if err != nil {
+		return nil, "", errors.New("getting server '" + cfg.CacheHostName + "' update status (Traffic Ops '" + torequtil.MaybeIPStr(toAddr) + "'): " + err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, lastModified, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		bodyBts, err := ioutil.ReadAll(resp.Body)
+		if err == nil {
+			return nil, "", &TOStatusError{StatusCode: resp.StatusCode, Err: fmt.Errorf("Traffic Ops '%s' returned %v %v", torequtil.MaybeIPStr(toAddr), resp.StatusCode, string(bodyBts))}
+		}
+		return nil, "", &TOStatusError{StatusCode: resp.StatusCode, Err: fmt.Errorf("Traffic Ops '%s' returned %v (error reading body)", torequtil.MaybeIPStr(toAddr), resp.StatusCode)}
+	}
+
+	statuses := []tc.ServerUpdateStatus{}
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		return nil, "", errors.New("decoding server '" + cfg.CacheHostName + "' update status: " + err.Error())
+	}
+	if len(statuses) == 0 {
+		return nil, "", errors.New("getting server '" + cfg.CacheHostName + "' update status: Traffic Ops returned no update statuses for that server")
+	}
+	return &statuses[0], resp.Header.Get(rfc.LastModified), nil
+}
+
+// TOStatusError is an error from a Traffic Ops request which returned an unexpected HTTP status code.
+type TOStatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (err *TOStatusError) Error() string { return err.Err.Error() }
+
 func WriteData(cfg TCCfg) error {
 	log.Infoln("Getting data '" + cfg.GetData + "'")
 	dataF, ok := GetDataFuncs()[cfg.GetData]
@@ -241,6 +304,32 @@ func setUpdateStatusLegacy(cfg TCCfg, serverName tc.CacheName, queue bool, reval
 	return nil
 }
 
+// SendServerConfigReport sends the report of a t3c-apply run to Traffic Ops.
+func SendServerConfigReport(cfg TCCfg, report tc.ServerConfigReportRequest) error {
+	if cfg.TOClient.FellBack() {
+		return errors.New("Traffic Ops does not support the latest API version, server config reports require 4.0 or newer")
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return errors.New("marshalling report: " + err.Error())
+	}
+	// Server config reports only exist in API 4.0 and newer, but the client is still 3.x, so the path is requested directly.
+	// TODO change to the v4-client func when the client is changed to v4.
+	resp, toAddr, err := cfg.TOClient.C.RawRequest(http.MethodPost, `/api/4.0/server_config_reports`, body)
+	if err != nil {
+		return errors.New("sending server config report (Traffic Ops '" + torequtil.MaybeIPStr(toAddr) + "'): " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		bodyBts, err := ioutil.ReadAll(resp.Body)
+		if err == nil {
+			return fmt.Errorf("Traffic Ops '%s' returned %v %v", torequtil.MaybeIPStr(toAddr), resp.StatusCode, string(bodyBts))
+		}
+		return fmt.Errorf("Traffic Ops '%s' returned %v (error reading body)", torequtil.MaybeIPStr(toAddr), resp.StatusCode)
+	}
+	return nil
+}
+
 func jsonBoolStr(b bool) string {
 	if b {
 		return `true`
@@ -250,7 +339,7 @@ func jsonBoolStr(b bool) string {
 
 // WriteConfig writes the Traffic Ops data necessary to generate config to output.
 func WriteConfig(cfg TCCfg, output io.Writer) error {
-	cfgData, err := GetConfigData(cfg.TOClient, cfg.TODisableProxy, cfg.CacheHostName, cfg.RevalOnly)
+	cfgData, err := GetConfigData(cfg.TOClient, cfg.TODisableProxy, cfg.TOProxyURL, cfg.CacheHostName, cfg.RevalOnly)
 	if err != nil {
 		return errors.New("getting statuses: " + err.Error())
 	}
@@ -22,6 +22,7 @@ package t3cutil
 import (
 	"errors"
 	"net"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -105,48 +106,93 @@ type ConfigData struct {
 //
 // The toClient is the Traffic Ops client, which should already be initialized and connected.
 //
-// The disableProxy arg is whether to disable using any Traffic Ops proxy configured via the global TrafficOpsProxyParameterName. If the Parameter exists, this will connect to Traffic Ops to get the global parameters, get the Parameter, and then change the toClient to use it.
+// The disableProxy arg is whether to disable using any Traffic Ops proxy, either proxyURL or the global TrafficOpsProxyParameterName. If the Parameter exists, this will connect to Traffic Ops to get the global parameters, get the Parameter, and then change the toClient to use it.
+//
+// The proxyURL is the URL of a Traffic Ops proxy to use, such as a t3c-proxy in the cache's cachegroup. If it's empty, the global TrafficOpsProxyParameterName is used, if it exists. If getting data from the proxy fails, the data is requested from Traffic Ops directly.
 //
 // The cacheHostName is the hostname of the cache to get config generation data for.
 //
 // The revalOnly arg is whether to only get data necessary to revalidate, versus all data necessary to generate cache config.
-func GetConfigData(toClient *toreq.TOClient, disableProxy bool, cacheHostName string, revalOnly bool) (*ConfigData, error) {
+func GetConfigData(toClient *toreq.TOClient, disableProxy bool, proxyURL string, cacheHostName string, revalOnly bool) (*ConfigData, error) {
 	start := time.Now()
 	defer func() { log.Infof("GetTOData took %v\n", time.Since(start)) }()
 
-	toIPs := &sync.Map{} // each Traffic Ops request could get a different IP, so track them all
-	toData := &ConfigData{}
-
 	globalParams, toAddr, err := toClient.GetGlobalParameters()
 	if err != nil {
 		return nil, errors.New("getting global parameters: " + err.Error())
 	}
-	toIPs.Store(toAddr, nil)
-	toData.GlobalParams = globalParams
 
+	realTOURL := "" // the real Traffic Ops URL, if a proxy is being used
 	if !disableProxy {
-		toProxyURLStr := ""
-		for _, param := range globalParams {
-			if param.Name == TrafficOpsProxyParameterName {
-				toProxyURLStr = param.Value
-				break
+		toProxyURLStr := proxyURL
+		if toProxyURLStr == "" {
+			for _, param := range globalParams {
+				if param.Name == TrafficOpsProxyParameterName {
+					toProxyURLStr = param.Value
+					break
+				}
 			}
 		}
-		if toProxyURLStr != "" {
-			realTOURL := toClient.C.URL
-			toClient.C.URL = toProxyURLStr
-			log.Infoln("using Traffic Ops proxy '" + toProxyURLStr + "'")
-			if _, _, err := toClient.C.GetCDNs(); err != nil {
-				log.Warnln("Traffic Ops proxy '" + toProxyURLStr + "' failed to get CDNs, falling back to real Traffic Ops")
-				toClient.C.URL = realTOURL
-			}
-		} else {
+		if toProxyURLStr == "" {
 			log.Infoln("Traffic Ops proxy enabled, but GLOBAL Parameter '" + TrafficOpsProxyParameterName + "' missing or empty, not using proxy")
+		} else if toClient.FellBack() {
+			log.Warnln("Traffic Ops proxy '" + toProxyURLStr + "' configured, but Traffic Ops does not support the latest API version, not using proxy")
+		} else {
+			realTOURL = toClient.C.URL
+			if !useTOProxy(toClient, toProxyURLStr) {
+				realTOURL = ""
+			}
 		}
 	} else {
 		log.Infoln("Traffic Ops proxy is disabled, not checking or using GLOBAL Parameter '" + TrafficOpsProxyParameterName)
 	}
 
+	toData, err := getConfigData(toClient, globalParams, toAddr, cacheHostName, revalOnly)
+	if err != nil && realTOURL != "" {
+		log.Warnln("getting config data from Traffic Ops proxy '" + toClient.C.URL + "' failed, falling back to real Traffic Ops: " + err.Error())
+		toClient.C.URL = realTOURL
+		toData, err = getConfigData(toClient, globalParams, toAddr, cacheHostName, revalOnly)
+	}
+	return toData, err
+}
+
+// useTOProxy changes the toClient to use the Traffic Ops proxy at proxyURL, and returns whether it did.
+// The client's Traffic Ops cookies are copied to the proxy, which must be able to authenticate the client.
+// If the proxy fails a request, it isn't used and the client is unchanged.
+func useTOProxy(toClient *toreq.TOClient, proxyURL string) bool {
+	realTOURL := toClient.C.URL
+	realTOURLParsed, err := url.Parse(realTOURL)
+	if err != nil {
+		log.Warnln("parsing Traffic Ops URL '" + realTOURL + "': " + err.Error() + ", not using proxy")
+		return false
+	}
+	proxyURLParsed, err := url.Parse(proxyURL)
+	if err != nil {
+		log.Warnln("parsing Traffic Ops proxy URL '" + proxyURL + "': " + err.Error() + ", not using proxy")
+		return false
+	}
+	if jar := toClient.C.Client.Jar; jar != nil {
+		jar.SetCookies(proxyURLParsed, jar.Cookies(realTOURLParsed))
+	}
+
+	toClient.C.URL = proxyURL
+	log.Infoln("using Traffic Ops proxy '" + proxyURL + "'")
+	if _, _, err := toClient.C.GetCDNs(); err != nil {
+		log.Warnln("Traffic Ops proxy '" + proxyURL + "' failed to get CDNs, falling back to real Traffic Ops")
+		toClient.C.URL = realTOURL
+		return false
+	}
+	return true
+}
+
+// getConfigData gets all the data needed to generate config, except the global parameters, which were already requested from globalParamsAddr.
+func getConfigData(toClient *toreq.TOClient, globalParams []tc.Parameter, globalParamsAddr net.Addr, cacheHostName string, revalOnly bool) (*ConfigData, error) {
+	toIPs := &sync.Map{} // each Traffic Ops request could get a different IP, so track them all
+	toData := &ConfigData{}
+
+	toIPs.Store(globalParamsAddr, nil)
+	toData.GlobalParams = globalParams
+
 	serversF := func() error {
 		defer func(start time.Time) { log.Infof("serversF took %v\n", time.Since(start)) }(time.Now())
 		// TODO TOAPI add /servers?cdn=1 query param
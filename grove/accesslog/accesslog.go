@@ -0,0 +1,184 @@
+package accesslog
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/config"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// DefaultBufferSize is the number of lines buffered for a sink, if the config doesn't specify one.
+const DefaultBufferSize = 10000
+
+// Record is the data about a response which may be logged.
+type Record struct {
+	// Time is when the response was finished.
+	Time time.Time
+	// ReqTime is when the request was received.
+	ReqTime  time.Time
+	ClientIP string
+	Req      *http.Request
+	// Hostname, Port, and Scheme are this server's.
+	Hostname  string
+	Port      string
+	Scheme    string
+	RemapRule string
+	// ToFQDN is the host of the parent or origin the request was remapped to.
+	ToFQDN           string
+	RespCode         int
+	BytesSent        uint64
+	RespSuccess      bool
+	CacheHit         bool
+	Reuse            rfc.Reuse
+	OriginCode       int
+	OriginBytes      uint64
+	OriginReqSuccess bool
+	// OriginConnectFailed is whether no parent could be connected to.
+	OriginConnectFailed bool
+	// ProxyStr is the parent the object was requested from, or empty if it was requested directly from the origin.
+	ProxyStr string
+	// Retries is the number of parent requests retried after a failure.
+	Retries   uint64
+	RequestID uint64
+}
+
+// Stats are the counts of lines of an access log.
+type Stats struct {
+	Name string
+	// Written is the number of lines successfully written to the sink.
+	Written uint64
+	// Dropped is the number of lines dropped because the buffer was full.
+	Dropped uint64
+	// Failed is the number of lines the sink failed to write.
+	Failed uint64
+}
+
+// Logger is a single access log, which formats records and writes them to its sink.
+type Logger struct {
+	name   string
+	format Format
+	sink   *asyncSink
+}
+
+// Logs is the set of access logs. It's safe for concurrent use, and may be reloaded while requests are being logged.
+type Logs struct {
+	loggers atomic.Value // []*Logger
+	cfgs    []config.AccessLog
+	loadM   sync.Mutex
+}
+
+// New returns a new empty set of access logs. Logs is a no-op until Load is called with a non-empty config.
+func New() *Logs {
+	l := &Logs{}
+	l.loggers.Store([]*Logger{})
+	return l
+}
+
+// Load replaces the access logs with the given config. If the config didn't change, the existing logs are kept. If any log is invalid, an error is returned, and the existing logs are kept.
+func (l *Logs) Load(cfgs []config.AccessLog) error {
+	l.loadM.Lock()
+	defer l.loadM.Unlock()
+	if reflect.DeepEqual(cfgs, l.cfgs) {
+		return nil
+	}
+
+	loggers := []*Logger{}
+	for i, cfg := range cfgs {
+		logger, err := newLogger(i, cfg)
+		if err != nil {
+			for _, logger := range loggers {
+				logger.sink.Close()
+			}
+			return errors.New("access log " + logName(i, cfg) + ": " + err.Error())
+		}
+		loggers = append(loggers, logger)
+	}
+
+	oldLoggers := l.loggers.Load().([]*Logger)
+	l.loggers.Store(loggers)
+	l.cfgs = cfgs
+	for _, logger := range oldLoggers {
+		logger.sink.Close()
+	}
+	return nil
+}
+
+// Log formats the given record and buffers it for each access log. It never blocks on a sink.
+func (l *Logs) Log(r *Record) {
+	if l == nil {
+		return
+	}
+	for _, logger := range l.loggers.Load().([]*Logger) {
+		logger.sink.Write(logger.format.Format(r))
+	}
+}
+
+// Stats returns the line counts of each access log.
+func (l *Logs) Stats() []Stats {
+	if l == nil {
+		return nil
+	}
+	stats := []Stats{}
+	for _, logger := range l.loggers.Load().([]*Logger) {
+		stats = append(stats, Stats{
+			Name:    logger.name,
+			Written: atomic.LoadUint64(&logger.sink.written),
+			Dropped: atomic.LoadUint64(&logger.sink.dropped),
+			Failed:  atomic.LoadUint64(&logger.sink.failed),
+		})
+	}
+	return stats
+}
+
+// Close writes all buffered lines, and closes the sinks.
+func (l *Logs) Close() {
+	l.loadM.Lock()
+	defer l.loadM.Unlock()
+	for _, logger := range l.loggers.Load().([]*Logger) {
+		logger.sink.Close()
+	}
+	l.loggers.Store([]*Logger{})
+	l.cfgs = nil
+}
+
+func logName(i int, cfg config.AccessLog) string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return strconv.Itoa(i)
+}
+
+func newLogger(i int, cfg config.AccessLog) (*Logger, error) {
+	format, err := NewFormat(cfg)
+	if err != nil {
+		return nil, errors.New("format: " + err.Error())
+	}
+	sink, err := newSink(cfg)
+	if err != nil {
+		return nil, errors.New("sink: " + err.Error())
+	}
+	log.Infof("access log %v: %v format, %v sink\n", logName(i, cfg), cfg.Format, cfg.Sink)
+	return &Logger{name: logName(i, cfg), format: format, sink: sink}, nil
+}
@@ -0,0 +1,362 @@
+package accesslog
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/config"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+func testRecord() *Record {
+	reqTime := time.Unix(1505408269, 11*int64(time.Millisecond))
+	req := &http.Request{
+		Method: http.MethodGet,
+		Host:   "edge.example.net",
+		URL:    &url.URL{Path: "/a/b.ts", RawQuery: "x=1"},
+		Proto:  "HTTP/1.1",
+		Header: http.Header{"User-Agent": {`Go "client"`}},
+	}
+	return &Record{
+		Time:             reqTime.Add(42 * time.Millisecond),
+		ReqTime:          reqTime,
+		ClientIP:         "192.0.2.1",
+		Req:              req,
+		Hostname:         "grove01",
+		Port:             "80",
+		Scheme:           "http",
+		RemapRule:        "ds1",
+		ToFQDN:           "origin.example.net",
+		RespCode:         http.StatusOK,
+		BytesSent:        1778,
+		RespSuccess:      true,
+		Reuse:            rfc.ReuseCannot,
+		OriginCode:       http.StatusOK,
+		OriginBytes:      1700,
+		OriginReqSuccess: true,
+		ProxyStr:         "mid01.example.net:80",
+		Retries:          1,
+		RequestID:        7,
+	}
+}
+
+func TestFormatATS(t *testing.T) {
+	format, err := NewFormat(config.AccessLog{Format: FormatATS, ATSFormat: `%<cqtq> %<chi> "%<cqhm> %<cquuc> %<cqhv>" %<pssc> %<crc>:%<phr>/%<pqsn> %<{User-Agent}cqh> %<{Referer}cqh> %<retries>`})
+	if err != nil {
+		t.Fatalf("NewFormat expected nil error, actual %v", err)
+	}
+	expected := `1505408269.011 192.0.2.1 "GET http://edge.example.net/a/b.ts?x=1 HTTP/1.1" 200 TCP_MISS:PARENT_HIT/mid01.example.net Go "client" - 1`
+	if actual := string(format.Format(testRecord())); actual != expected {
+		t.Errorf("ats format expected '%v', actual '%v'", expected, actual)
+	}
+
+	if _, err := NewFormat(config.AccessLog{Format: FormatATS}); err != nil {
+		t.Errorf("NewFormat default ATS format expected nil error, actual %v", err)
+	}
+	for _, invalid := range []string{"%<nope>", "%<chi", "%<{}cqh>"} {
+		if _, err := NewFormat(config.AccessLog{Format: FormatATS, ATSFormat: invalid}); err == nil {
+			t.Errorf("NewFormat '%v' expected error, actual nil", invalid)
+		}
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	format, err := NewFormat(config.AccessLog{Format: FormatJSON, Fields: []string{"chi", "pssc", "crc", "retries", "{User-Agent}cqh"}})
+	if err != nil {
+		t.Fatalf("NewFormat expected nil error, actual %v", err)
+	}
+	line := format.Format(testRecord())
+	actual := map[string]interface{}{}
+	if err := json.Unmarshal(line, &actual); err != nil {
+		t.Fatalf("json format expected valid JSON, actual '%s': %v", line, err)
+	}
+	expected := map[string]interface{}{"chi": "192.0.2.1", "pssc": float64(200), "crc": "TCP_MISS", "retries": float64(1), "{User-Agent}cqh": `Go "client"`}
+	for k, v := range expected {
+		if actual[k] != v {
+			t.Errorf("json format field '%v' expected %#v, actual %#v", k, v, actual[k])
+		}
+	}
+	if len(actual) != len(expected) {
+		t.Errorf("json format expected %v fields, actual %v", len(expected), len(actual))
+	}
+
+	format, err = NewFormat(config.AccessLog{Format: FormatJSON})
+	if err != nil {
+		t.Fatalf("NewFormat all fields expected nil error, actual %v", err)
+	}
+	all := map[string]interface{}{}
+	if err := json.Unmarshal(format.Format(testRecord()), &all); err != nil || len(all) != len(FieldNames) {
+		t.Errorf("json format all fields expected %v fields, actual %v error %v", len(FieldNames), len(all), err)
+	}
+}
+
+func TestFormatCSV(t *testing.T) {
+	format, err := NewFormat(config.AccessLog{Format: FormatCSV, Fields: []string{"chi", "cqhm", "{User-Agent}cqh", "sscl"}})
+	if err != nil {
+		t.Fatalf("NewFormat expected nil error, actual %v", err)
+	}
+	expected := `192.0.2.1,GET,"Go ""client""",1700`
+	if actual := string(format.Format(testRecord())); actual != expected {
+		t.Errorf("csv format expected '%v', actual '%v'", expected, actual)
+	}
+}
+
+func TestCacheResult(t *testing.T) {
+	r := testRecord()
+	for _, test := range []struct {
+		reuse         rfc.Reuse
+		hit           bool
+		connectFailed bool
+		expected      string
+	}{
+		{rfc.ReuseCan, true, false, "TCP_HIT"},
+		{rfc.ReuseMustRevalidate, true, false, "TCP_REFRESH_HIT"},
+		{rfc.ReuseMustRevalidateCanStale, false, false, "TCP_REFRESH_MISS"},
+		{rfc.ReuseCannot, false, false, "TCP_MISS"},
+		{rfc.ReuseCannot, false, true, "ERR_CONNECT_FAIL"},
+	} {
+		r.Reuse, r.CacheHit, r.OriginConnectFailed = test.reuse, test.hit, test.connectFailed
+		if actual := cacheResult(r); actual != test.expected {
+			t.Errorf("cacheResult %v hit %v connect failed %v expected %v, actual %v", test.reuse, test.hit, test.connectFailed, test.expected, actual)
+		}
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grove-accesslog-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	w := &fileWriter{path: path, maxSize: 10, maxBackups: 2}
+	for _, line := range []string{"aaaaaaa", "bbbbbbb", "ccccccc", "ddddddd"} {
+		if err := w.write([][]byte{[]byte(line)}); err != nil {
+			t.Fatalf("write expected nil error, actual %v", err)
+		}
+	}
+	w.close()
+
+	for file, expected := range map[string]string{path: "ddddddd\n", path + ".1": "ccccccc\n", path + ".2": "bbbbbbb\n"} {
+		actual, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Errorf("reading %v: %v", file, err)
+		} else if string(actual) != expected {
+			t.Errorf("file %v expected '%v', actual '%v'", file, expected, string(actual))
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected backups beyond max to be removed, actual %v exists", path+".3")
+	}
+}
+
+func TestFileSinkRotationNoBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grove-accesslog-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	w := &fileWriter{path: path, maxSize: 10, maxBackups: 0}
+	if err := w.write([][]byte{[]byte("aaaaaaa")}); err != nil {
+		t.Fatalf("write expected nil error, actual %v", err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.write([][]byte{[]byte("bbbbbbb")}); err != nil {
+		t.Fatalf("write expected nil error, actual %v", err)
+	}
+	w.close()
+
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Errorf("expected rotation without backups to truncate the file in place, actual file replaced")
+	}
+	if actual, err := ioutil.ReadFile(path); err != nil {
+		t.Errorf("reading %v: %v", path, err)
+	} else if string(actual) != "bbbbbbb\n" {
+		t.Errorf("file %v expected '%v', actual '%v'", path, "bbbbbbb\n", string(actual))
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("expected no backups, actual %v exists", path+".1")
+	}
+}
+
+// blockingWriter is a sinkWriter which blocks until unblocked, and records the lines written.
+type blockingWriter struct {
+	unblock chan struct{}
+	linesM  sync.Mutex
+	lines   []string
+}
+
+func (w *blockingWriter) write(lines [][]byte) error {
+	<-w.unblock
+	w.linesM.Lock()
+	defer w.linesM.Unlock()
+	for _, line := range lines {
+		w.lines = append(w.lines, string(line))
+	}
+	return nil
+}
+
+func (w *blockingWriter) close() error { return nil }
+
+func TestAsyncSinkDrops(t *testing.T) {
+	w := &blockingWriter{unblock: make(chan struct{})}
+	s := &asyncSink{w: w, ch: make(chan []byte, 2), batchSize: 2, done: make(chan struct{})}
+	go s.run()
+
+	// up to 2 lines may be read into a batch before the writer blocks, and the buffer holds 2, so the rest are dropped without blocking.
+	written := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			s.Write([]byte("line"))
+		}
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Write blocked on a full buffer")
+	}
+	dropped := atomic.LoadUint64(&s.dropped)
+	if dropped < 6 || dropped > 8 {
+		t.Errorf("asyncSink expected 6 to 8 dropped lines, actual %v", dropped)
+	}
+
+	close(w.unblock)
+	s.Close()
+	if len(w.lines)+int(dropped) != 10 || s.written != uint64(len(w.lines)) {
+		t.Errorf("asyncSink expected buffered lines written on close, actual %v written %v dropped", len(w.lines), dropped)
+	}
+	s.Write([]byte("after close"))
+	if atomic.LoadUint64(&s.dropped) != dropped+1 {
+		t.Errorf("asyncSink expected line written after close to be dropped")
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	bodies := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- r.Header.Get("Content-Type") + " " + string(body)
+	}))
+	defer srv.Close()
+
+	logs := New()
+	if err := logs.Load([]config.AccessLog{{Name: "batch", Format: FormatCSV, Fields: []string{"chi", "pssc"}, Sink: SinkHTTP, HTTPURL: srv.URL, HTTPBatchSize: 2, HTTPBatchIntervalMS: 60000}}); err != nil {
+		t.Fatalf("Load expected nil error, actual %v", err)
+	}
+	logs.Log(testRecord())
+	logs.Log(testRecord())
+	logs.Log(testRecord())
+
+	select {
+	case body := <-bodies:
+		if expected := "text/csv 192.0.2.1,200\n192.0.2.1,200\n"; body != expected {
+			t.Errorf("http sink expected full batch '%v', actual '%v'", expected, body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("http sink expected full batch to be posted, actual none")
+	}
+
+	logs.Close() // the partial batch is posted on close
+	select {
+	case body := <-bodies:
+		if expected := "text/csv 192.0.2.1,200\n"; body != expected {
+			t.Errorf("http sink expected partial batch on close '%v', actual '%v'", expected, body)
+		}
+	default:
+		t.Errorf("http sink expected partial batch to be posted on close, actual none")
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logs := New()
+	if err := logs.Load([]config.AccessLog{{Format: FormatATS, ATSFormat: "%<chi> %<pssc>", Sink: SinkSyslog, SyslogNetwork: "udp", SyslogAddress: conn.LocalAddr().String(), SyslogFacility: "local1", SyslogTag: "test"}}); err != nil {
+		t.Fatalf("Load expected nil error, actual %v", err)
+	}
+	defer logs.Close()
+	logs.Log(testRecord())
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("reading syslog message: %v", err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<142>1 ") { // local1 (17) * 8 + info (6)
+		t.Errorf("syslog message expected priority 142, actual '%v'", msg)
+	}
+	if !strings.Contains(msg, " test ") || !strings.HasSuffix(msg, " - - 192.0.2.1 200") {
+		t.Errorf("syslog message expected tag and line, actual '%v'", msg)
+	}
+
+	if stats := logs.Stats(); len(stats) != 1 || stats[0].Name != "0" {
+		t.Errorf("Stats expected one log named by its index, actual %+v", stats)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	logs := New()
+	valid := []config.AccessLog{{Name: "file", Sink: SinkFile, FilePath: filepath.Join(os.TempDir(), "grove-accesslog-test-unused.log")}}
+	if err := logs.Load(valid); err != nil {
+		t.Fatalf("Load expected nil error, actual %v", err)
+	}
+	defer logs.Close()
+	for _, invalid := range []config.AccessLog{
+		{Sink: "kafka"},
+		{Format: "xml", Sink: SinkFile, FilePath: "x"},
+		{Sink: SinkFile},
+		{Sink: SinkSyslog, SyslogNetwork: "unix", SyslogAddress: "x"},
+		{Sink: SinkSyslog, SyslogNetwork: "udp", SyslogAddress: "x", SyslogFacility: "nope"},
+		{Sink: SinkHTTP},
+	} {
+		if err := logs.Load([]config.AccessLog{invalid}); err == nil {
+			t.Errorf("Load %+v expected error, actual nil", invalid)
+		}
+	}
+	if stats := logs.Stats(); len(stats) != 1 || stats[0].Name != "file" {
+		t.Errorf("Load invalid expected existing logs to be kept, actual %+v", stats)
+	}
+}
@@ -0,0 +1,284 @@
+package accesslog
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/config"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+const FormatATS = "ats"
+const FormatJSON = "json"
+const FormatCSV = "csv"
+
+// DefaultATSFormat is the format of the ats_log plugin, an ATS custom log format similar to the squid format.
+const DefaultATSFormat = `%<cqtq> chi=%<chi> phn=%<phn> php=%<php> shn=%<shn> url=%<cquuc> cqhm=%<cqhm> cqhv=%<cqhv> pssc=%<pssc> ttms=%<ttms> b=%<pscl> sssc=%<sssc> sscl=%<sscl> cfsc=%<cfsc> pfsc=%<pfsc> crc=%<crc> phr=%<phr> pqsn=%<pqsn> uas="%<{User-Agent}cqh>" xmt="%<{X-Money-Trace}cqh>" reqid=%<reqid>`
+
+// Format formats a record as a single line, without a trailing newline.
+type Format interface {
+	Format(r *Record) []byte
+}
+
+// field is a loggable value of a record. Numeric fields are logged as JSON numbers.
+type field struct {
+	name    string
+	value   func(r *Record) string
+	numeric bool
+}
+
+// FieldNames are the names of the fields which may be logged, in the order they're logged if a JSON or CSV log doesn't specify its fields. The names are those of the ATS custom log fields, where ATS has an equivalent field.
+// Additionally, any client request header may be logged with the ATS field `{Header-Name}cqh`.
+var FieldNames = []string{
+	"cqtq", "cqts", "chi", "phn", "php", "shn", "cquuc", "cqup", "cqhm", "cqhv", "pssc", "ttms", "pscl", "sssc", "sscl", "cfsc", "pfsc", "crc", "phr", "pqsn", "retries", "rule", "reqid",
+}
+
+var fields = map[string]field{
+	// cqtq is the client request time, in Unix seconds with milliseconds.
+	"cqtq": {value: func(r *Record) string { return formatUnixMS(r.ReqTime) }, numeric: true},
+	// cqts is the client request time, in Unix seconds.
+	"cqts": {value: func(r *Record) string { return strconv.FormatInt(r.ReqTime.Unix(), 10) }, numeric: true},
+	"chi":  {value: func(r *Record) string { return r.ClientIP }},
+	"phn":  {value: func(r *Record) string { return r.Hostname }},
+	"php":  {value: func(r *Record) string { return r.Port }},
+	"shn":  {value: func(r *Record) string { return r.ToFQDN }},
+	"cquuc": {value: func(r *Record) string {
+		return r.Scheme + "://" + r.Req.Host + r.Req.URL.String()
+	}},
+	"cqup": {value: func(r *Record) string { return r.Req.URL.Path }},
+	"cqhm": {value: func(r *Record) string { return r.Req.Method }},
+	"cqhv": {value: func(r *Record) string { return r.Req.Proto }},
+	"pssc": {value: func(r *Record) string { return strconv.Itoa(r.RespCode) }, numeric: true},
+	// ttms is the time to serve the response, in milliseconds.
+	"ttms": {value: func(r *Record) string { return strconv.FormatInt(int64(r.Time.Sub(r.ReqTime)/time.Millisecond), 10) }, numeric: true},
+	"pscl": {value: func(r *Record) string { return strconv.FormatUint(r.BytesSent, 10) }, numeric: true},
+	"sssc": {value: func(r *Record) string { return strconv.Itoa(r.OriginCode) }, numeric: true},
+	"sscl": {value: func(r *Record) string { return strconv.FormatUint(r.OriginBytes, 10) }, numeric: true},
+	"cfsc": {value: func(r *Record) string { return finStr(r.RespSuccess) }},
+	"pfsc": {value: func(r *Record) string { return finStr(r.OriginReqSuccess) }},
+	"crc":  {value: cacheResult},
+	"phr":  {value: func(r *Record) string { phr, _ := parentStrings(r); return phr }},
+	"pqsn": {value: func(r *Record) string { _, pqsn := parentStrings(r); return pqsn }},
+	// retries is the number of parent requests retried after a failure. It isn't an ATS field.
+	"retries": {value: func(r *Record) string { return strconv.FormatUint(r.Retries, 10) }, numeric: true},
+	// rule is the remap rule the request matched. It isn't an ATS field.
+	"rule": {value: func(r *Record) string { return r.RemapRule }},
+	// reqid is the Grove request ID, for correlating with the error and debug logs. It isn't an ATS field.
+	"reqid": {value: func(r *Record) string { return strconv.FormatUint(r.RequestID, 10) }, numeric: true},
+}
+
+// getField returns the field of the given name, which may be a known field, or a `{Header-Name}cqh` client request header.
+func getField(name string) (field, error) {
+	if f, ok := fields[name]; ok {
+		f.name = name
+		return f, nil
+	}
+	if strings.HasPrefix(name, "{") && strings.HasSuffix(name, "}cqh") {
+		hdr := http.CanonicalHeaderKey(strings.TrimSuffix(strings.TrimPrefix(name, "{"), "}cqh"))
+		if hdr == "" {
+			return field{}, errors.New("empty header name in field '" + name + "'")
+		}
+		return field{name: name, value: func(r *Record) string { return r.Req.Header.Get(hdr) }}, nil
+	}
+	return field{}, errors.New("unknown field '" + name + "'")
+}
+
+func getFields(names []string) ([]field, error) {
+	if len(names) == 0 {
+		names = FieldNames
+	}
+	fs := []field{}
+	for _, name := range names {
+		f, err := getField(name)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+// NewFormat returns the format of the given access log config.
+func NewFormat(cfg config.AccessLog) (Format, error) {
+	switch cfg.Format {
+	case FormatATS, "":
+		atsFormat := cfg.ATSFormat
+		if atsFormat == "" {
+			atsFormat = DefaultATSFormat
+		}
+		return parseATSFormat(atsFormat)
+	case FormatJSON:
+		fs, err := getFields(cfg.Fields)
+		if err != nil {
+			return nil, err
+		}
+		return jsonFormat(fs), nil
+	case FormatCSV:
+		fs, err := getFields(cfg.Fields)
+		if err != nil {
+			return nil, err
+		}
+		return csvFormat(fs), nil
+	}
+	return nil, errors.New("unknown format '" + cfg.Format + "', must be " + FormatATS + ", " + FormatJSON + ", or " + FormatCSV)
+}
+
+// atsFormat is an ATS custom log format, a sequence of literal text and fields.
+type atsFormat []atsFormatPart
+
+type atsFormatPart struct {
+	literal string
+	field   *field
+}
+
+// parseATSFormat parses an ATS custom log format, such as `%<chi> %<cqhm> %<{User-Agent}cqh>`. Fields with no value are logged as "-", like ATS.
+func parseATSFormat(s string) (atsFormat, error) {
+	format := atsFormat{}
+	for s != "" {
+		start := strings.Index(s, "%<")
+		if start < 0 {
+			format = append(format, atsFormatPart{literal: s})
+			break
+		}
+		if start > 0 {
+			format = append(format, atsFormatPart{literal: s[:start]})
+		}
+		s = s[start+len("%<"):]
+		end := strings.Index(s, ">")
+		if end < 0 {
+			return nil, errors.New("unterminated field '%<" + s + "'")
+		}
+		f, err := getField(s[:end])
+		if err != nil {
+			return nil, err
+		}
+		format = append(format, atsFormatPart{field: &f})
+		s = s[end+len(">"):]
+	}
+	return format, nil
+}
+
+func (f atsFormat) Format(r *Record) []byte {
+	buf := bytes.Buffer{}
+	for _, part := range f {
+		if part.field == nil {
+			buf.WriteString(part.literal)
+			continue
+		}
+		val := part.field.value(r)
+		if val == "" {
+			val = "-"
+		}
+		buf.WriteString(val)
+	}
+	return buf.Bytes()
+}
+
+// jsonFormat formats records as JSON objects, with a key for each field.
+type jsonFormat []field
+
+func (f jsonFormat) Format(r *Record) []byte {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, fld := range f {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(fld.name)
+		buf.Write(name)
+		buf.WriteByte(':')
+		val := fld.value(r)
+		if fld.numeric {
+			buf.WriteString(val)
+			continue
+		}
+		valJSON, _ := json.Marshal(val) // marshalling a string never fails
+		buf.Write(valJSON)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// csvFormat formats records as RFC 4180 CSV rows, with a column for each field.
+type csvFormat []field
+
+func (f csvFormat) Format(r *Record) []byte {
+	row := make([]string, len(f))
+	for i, fld := range f {
+		row[i] = fld.value(r)
+	}
+	buf := bytes.Buffer{}
+	w := csv.NewWriter(&buf)
+	w.Write(row) // writing to a bytes.Buffer never fails
+	w.Flush()
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// formatUnixMS formats the time as Unix seconds with three decimal places, like the ATS logs.
+func formatUnixMS(t time.Time) string {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	frac := strconv.FormatInt(ms%1000, 10)
+	for len(frac) < 3 {
+		frac = "0" + frac
+	}
+	return strconv.FormatInt(ms/1000, 10) + "." + frac
+}
+
+func finStr(success bool) string {
+	if success {
+		return "FIN"
+	}
+	return "INTR"
+}
+
+// cacheResult returns the ATS cache result code of the record.
+func cacheResult(r *Record) string {
+	if r.OriginConnectFailed {
+		return "ERR_CONNECT_FAIL"
+	}
+	revalidated := r.Reuse == rfc.ReuseMustRevalidate || r.Reuse == rfc.ReuseMustRevalidateCanStale
+	switch {
+	case r.CacheHit && revalidated:
+		return "TCP_REFRESH_HIT"
+	case r.CacheHit:
+		return "TCP_HIT"
+	case revalidated:
+		return "TCP_REFRESH_MISS"
+	}
+	return "TCP_MISS"
+}
+
+// parentStrings returns the ATS phr and pqsn fields of the record, the proxy hierarchy route and the parent used.
+func parentStrings(r *Record) (string, string) {
+	if r.CacheHit {
+		return "NONE", "-"
+	}
+	if r.RespCode >= 200 {
+		if r.ProxyStr != "" && r.ProxyStr != "-" {
+			return "PARENT_HIT", strings.Split(r.ProxyStr, ":")[0]
+		}
+		return "DIRECT", r.ToFQDN
+	}
+	return "EMPTY", "-"
+}
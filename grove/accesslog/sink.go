@@ -0,0 +1,390 @@
+package accesslog
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/config"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+const SinkFile = "file"
+const SinkSyslog = "syslog"
+const SinkHTTP = "http"
+
+const DefaultSyslogFacility = "local0"
+const DefaultSyslogTag = "grove"
+const SyslogDialTimeout = 10 * time.Second
+const DefaultHTTPBatchSize = 1000
+const DefaultHTTPBatchInterval = time.Second
+const DefaultHTTPTimeout = 10 * time.Second
+
+// SyslogFacilities are the RFC 5424 syslog facility codes, by name.
+var SyslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSeverityInfo is the RFC 5424 severity of access log messages, Informational.
+const syslogSeverityInfo = 6
+
+// sinkWriter writes batches of lines to a sink. It's only called from a single goroutine.
+type sinkWriter interface {
+	write(lines [][]byte) error
+	close() error
+}
+
+// asyncSink buffers lines, and writes them to a sinkWriter in a separate goroutine, so logging never blocks requests. Lines written while the buffer is full are dropped.
+type asyncSink struct {
+	w  sinkWriter
+	ch chan []byte
+	// batchSize is the maximum number of lines written at once.
+	batchSize int
+	// batchInterval, if nonzero, is how long lines are held waiting for a full batch. If zero, lines are written as soon as the buffer is empty.
+	batchInterval time.Duration
+	done          chan struct{}
+	// closed is guarded by closeM, so lines aren't written to the channel after it's closed.
+	closed  bool
+	closeM  sync.RWMutex
+	written uint64 // Atomic - DO NOT access or modify without atomic operations
+	dropped uint64 // Atomic - DO NOT access or modify without atomic operations
+	failed  uint64 // Atomic - DO NOT access or modify without atomic operations
+}
+
+func newSink(cfg config.AccessLog) (*asyncSink, error) {
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+
+	w := sinkWriter(nil)
+	batchSize, batchInterval := bufferSize, time.Duration(0)
+	switch cfg.Sink {
+	case SinkFile:
+		if cfg.FilePath == "" {
+			return nil, errors.New("file sink missing file_path")
+		}
+		w = &fileWriter{path: cfg.FilePath, maxSize: cfg.FileMaxSizeBytes, maxBackups: cfg.FileMaxBackups}
+	case SinkSyslog:
+		sw, err := newSyslogWriter(cfg)
+		if err != nil {
+			return nil, err
+		}
+		w = sw
+	case SinkHTTP:
+		if cfg.HTTPURL == "" {
+			return nil, errors.New("http sink missing http_url")
+		}
+		timeout := time.Duration(cfg.HTTPTimeoutMS) * time.Millisecond
+		if timeout <= 0 {
+			timeout = DefaultHTTPTimeout
+		}
+		contentType := "text/plain"
+		if cfg.Format == FormatJSON {
+			contentType = "application/x-ndjson"
+		} else if cfg.Format == FormatCSV {
+			contentType = "text/csv"
+		}
+		w = &httpWriter{url: cfg.HTTPURL, contentType: contentType, client: &http.Client{Timeout: timeout}}
+		batchSize, batchInterval = cfg.HTTPBatchSize, time.Duration(cfg.HTTPBatchIntervalMS)*time.Millisecond
+		if batchSize <= 0 {
+			batchSize = DefaultHTTPBatchSize
+		}
+		if batchInterval <= 0 {
+			batchInterval = DefaultHTTPBatchInterval
+		}
+	default:
+		return nil, errors.New("unknown sink '" + cfg.Sink + "', must be " + SinkFile + ", " + SinkSyslog + ", or " + SinkHTTP)
+	}
+
+	s := &asyncSink{w: w, ch: make(chan []byte, bufferSize), batchSize: batchSize, batchInterval: batchInterval, done: make(chan struct{})}
+	go s.run()
+	return s, nil
+}
+
+// Write buffers the line to be written. If the buffer is full, or the sink is closed, the line is dropped.
+func (s *asyncSink) Write(line []byte) {
+	s.closeM.RLock()
+	defer s.closeM.RUnlock()
+	if s.closed {
+		atomic.AddUint64(&s.dropped, 1)
+		return
+	}
+	select {
+	case s.ch <- line:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// Close writes the buffered lines, closes the sink, and waits for it to finish.
+func (s *asyncSink) Close() {
+	s.closeM.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+	s.closeM.Unlock()
+	<-s.done
+}
+
+func (s *asyncSink) run() {
+	defer close(s.done)
+	tick := (<-chan time.Time)(nil)
+	if s.batchInterval > 0 {
+		ticker := time.NewTicker(s.batchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	batch := make([][]byte, 0, s.batchSize)
+	failing := false
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.w.write(batch); err != nil {
+			atomic.AddUint64(&s.failed, uint64(len(batch)))
+			if !failing {
+				log.Errorln("access log writing, dropping lines until the sink recovers: " + err.Error())
+				failing = true
+			}
+		} else {
+			atomic.AddUint64(&s.written, uint64(len(batch)))
+			if failing {
+				log.Infoln("access log writing recovered")
+				failing = false
+			}
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case line, ok := <-s.ch:
+			if !ok {
+				flush()
+				if err := s.w.close(); err != nil {
+					log.Errorln("access log closing: " + err.Error())
+				}
+				return
+			}
+			batch = append(batch, line)
+			if len(batch) >= s.batchSize || (s.batchInterval == 0 && len(s.ch) == 0) {
+				flush()
+			}
+		case <-tick:
+			flush()
+		}
+	}
+}
+
+// fileWriter writes lines to a file, rotating it when it reaches maxSize.
+type fileWriter struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+func (w *fileWriter) write(lines [][]byte) error {
+	if w.f == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	buf := joinLines(lines)
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(buf)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return errors.New("rotating '" + w.path + "': " + err.Error())
+		}
+	}
+	n, err := w.f.Write(buf)
+	w.size += int64(n)
+	if err != nil {
+		return errors.New("writing '" + w.path + "': " + err.Error())
+	}
+	return nil
+}
+
+func (w *fileWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.New("opening '" + w.path + "': " + err.Error())
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.New("getting size of '" + w.path + "': " + err.Error())
+	}
+	w.f, w.size = f, fi.Size()
+	return nil
+}
+
+// rotate renames the file to path.1, and each older backup path.N to path.N+1, removing those beyond maxBackups, and opens a new file.
+// If maxBackups is 0, the file is truncated in place instead, so the live log is never removed out from under anything reading it.
+func (w *fileWriter) rotate() error {
+	if w.maxBackups <= 0 {
+		if err := w.f.Truncate(0); err != nil {
+			return err
+		}
+		w.size = 0
+		return nil
+	}
+	if err := w.f.Close(); err != nil {
+		log.Errorln("access log closing '" + w.path + "' for rotation: " + err.Error())
+	}
+	w.f = nil
+	os.Remove(w.path + "." + strconv.Itoa(w.maxBackups)) // may not exist
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(w.path+"."+strconv.Itoa(i), w.path+"."+strconv.Itoa(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(w.path, w.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return w.open()
+}
+
+func (w *fileWriter) close() error {
+	if w.f == nil {
+		return nil
+	}
+	return w.f.Close()
+}
+
+// syslogWriter writes lines as RFC 5424 syslog messages. UDP messages are one per datagram, and TCP messages are newline-terminated, per RFC 6587 non-transparent framing.
+type syslogWriter struct {
+	network  string
+	address  string
+	priority int
+	hostname string
+	tag      string
+	conn     net.Conn
+}
+
+func newSyslogWriter(cfg config.AccessLog) (*syslogWriter, error) {
+	if cfg.SyslogNetwork != "udp" && cfg.SyslogNetwork != "tcp" {
+		return nil, errors.New("syslog sink network '" + cfg.SyslogNetwork + "' must be udp or tcp")
+	}
+	if cfg.SyslogAddress == "" {
+		return nil, errors.New("syslog sink missing syslog_address")
+	}
+	facilityName := cfg.SyslogFacility
+	if facilityName == "" {
+		facilityName = DefaultSyslogFacility
+	}
+	facility, ok := SyslogFacilities[facilityName]
+	if !ok {
+		return nil, errors.New("unknown syslog facility '" + facilityName + "'")
+	}
+	tag := cfg.SyslogTag
+	if tag == "" {
+		tag = DefaultSyslogTag
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &syslogWriter{network: cfg.SyslogNetwork, address: cfg.SyslogAddress, priority: facility*8 + syslogSeverityInfo, hostname: hostname, tag: tag}, nil
+}
+
+func (w *syslogWriter) write(lines [][]byte) error {
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.address, SyslogDialTimeout)
+		if err != nil {
+			return errors.New("connecting to syslog " + w.address + ": " + err.Error())
+		}
+		w.conn = conn
+	}
+	for _, line := range lines {
+		msg := w.message(line, time.Now())
+		if w.network == "tcp" {
+			msg = append(msg, '\n')
+		}
+		if _, err := w.conn.Write(msg); err != nil {
+			w.conn.Close()
+			w.conn = nil // reconnect on the next write
+			return errors.New("writing to syslog " + w.address + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// message returns the RFC 5424 message of the line: `<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG`.
+func (w *syslogWriter) message(line []byte, now time.Time) []byte {
+	msg := []byte("<" + strconv.Itoa(w.priority) + ">1 " + now.UTC().Format(time.RFC3339Nano) + " " + w.hostname + " " + w.tag + " " + strconv.Itoa(os.Getpid()) + " - - ")
+	return append(msg, line...)
+}
+
+func (w *syslogWriter) close() error {
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
+
+// httpWriter POSTs batches of newline-terminated lines to a URL.
+type httpWriter struct {
+	url         string
+	contentType string
+	client      *http.Client
+}
+
+func (w *httpWriter) write(lines [][]byte) error {
+	resp, err := w.client.Post(w.url, w.contentType, bytes.NewReader(joinLines(lines)))
+	if err != nil {
+		return errors.New("posting to " + w.url + ": " + err.Error())
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body) // read the body, so the connection can be reused
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("posting to " + w.url + ": returned " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
+
+func (w *httpWriter) close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// joinLines returns the lines, each terminated by a newline.
+func joinLines(lines [][]byte) []byte {
+	size := 0
+	for _, line := range lines {
+		size += len(line) + 1
+	}
+	buf := make([]byte, 0, size)
+	for _, line := range lines {
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
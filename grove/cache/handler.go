@@ -15,17 +15,23 @@ package cache
 */
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
+	"github.com/apache/trafficcontrol/grove/accesslog"
 	"github.com/apache/trafficcontrol/grove/cachedata"
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 	"github.com/apache/trafficcontrol/grove/plugin"
 
 	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/revalidate"
 	"github.com/apache/trafficcontrol/grove/stat"
 	"github.com/apache/trafficcontrol/grove/thread"
 	"github.com/apache/trafficcontrol/grove/web"
@@ -69,7 +75,13 @@ type Handler struct {
 	httpConns       *web.ConnMap
 	httpsConns      *web.ConnMap
 	interfaceName   string
+	revalidations   *revalidate.Rules
+	parents         *parenthealth.Parents
+	accessLogs      *accesslog.Logs
 	requestID       uint64 // Atomic - DO NOT access or modify without atomic operations
+	// backgroundRevals is the set of cache keys being revalidated in the background, for stale-while-revalidate.
+	backgroundRevals  map[string]struct{}
+	backgroundRevalsM sync.Mutex
 	// keyThrottlers     Throttlers
 	// nocacheThrottlers Throttlers
 }
@@ -112,6 +124,10 @@ func NewHandler(
 	httpConns *web.ConnMap,
 	httpsConns *web.ConnMap,
 	interfaceName string,
+	revalidations *revalidate.Rules,
+	parents *parenthealth.Parents,
+	accessLogs *accesslog.Logs,
+	getter thread.Getter,
 ) *Handler {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -119,21 +135,25 @@ func NewHandler(
 	}
 
 	return &Handler{
-		remapper:        remapper,
-		getter:          thread.NewGetter(),
-		ruleThrottlers:  makeRuleThrottlers(remapper, ruleLimit),
-		strictRFC:       strictRFC,
-		scheme:          scheme,
-		port:            port,
-		hostname:        hostname,
-		stats:           stats,
-		conns:           conns,
-		connectionClose: connectionClose,
-		plugins:         plugins,
-		pluginContext:   pluginContext,
-		httpConns:       httpConns,
-		httpsConns:      httpsConns,
-		interfaceName:   interfaceName,
+		remapper:         remapper,
+		getter:           getter,
+		ruleThrottlers:   makeRuleThrottlers(remapper, ruleLimit),
+		strictRFC:        strictRFC,
+		scheme:           scheme,
+		port:             port,
+		hostname:         hostname,
+		stats:            stats,
+		conns:            conns,
+		connectionClose:  connectionClose,
+		plugins:          plugins,
+		pluginContext:    pluginContext,
+		httpConns:        httpConns,
+		httpsConns:       httpsConns,
+		interfaceName:    interfaceName,
+		revalidations:    revalidations,
+		parents:          parents,
+		accessLogs:       accessLogs,
+		backgroundRevals: map[string]struct{}{},
 		// keyThrottlers:     NewThrottlers(keyLimit),
 		// nocacheThrottlers: NewThrottlers(nocacheLimit),
 	}
@@ -166,7 +186,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	reqID := atomic.AddUint64(&h.requestID, 1)
 	pluginContext := copyPluginContext(h.pluginContext) // must give each request a copy, because they can modify in parallel
 	srvrData := cachedata.SrvrData{Hostname: h.hostname, Port: h.port, Scheme: h.scheme}
-	onReqData := plugin.OnRequestData{W: w, R: r, Stats: h.stats, StatRules: h.remapper.StatRules(), HTTPConns: h.httpConns, HTTPSConns: h.httpsConns, InterfaceName: h.interfaceName, SrvrData: srvrData, RequestID: reqID}
+	onReqData := plugin.OnRequestData{W: w, R: r, Stats: h.stats, StatRules: h.remapper.StatRules(), HTTPConns: h.httpConns, HTTPSConns: h.httpsConns, InterfaceName: h.interfaceName, SrvrData: srvrData, RequestID: reqID, Revalidations: h.revalidations, Parents: h.parents, AccessLogs: h.accessLogs, Getter: h.getter}
 	stop := h.plugins.OnRequest(h.remapper.PluginCfg(), pluginContext, onReqData)
 	if stop {
 		return
@@ -189,18 +209,20 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	reqHeader := web.CopyHeader(r.Header) // copy request header, because it's not guaranteed valid after actually issuing the request
 	clientIP, _ := web.GetClientIPPort(r)
 
 	toFQDN := ""
+	ruleName := ""
 	pluginCfg := map[string]interface{}{}
 	if remappingProducer != nil {
 		toFQDN = remappingProducer.FirstFQDN()
+		ruleName = remappingProducer.Name()
 		pluginCfg = remappingProducer.PluginCfg()
 	}
 
-	reqData := cachedata.ReqData{Req: r, Conn: conn, ClientIP: clientIP, ReqTime: reqTime, ToFQDN: toFQDN}
+	reqData := cachedata.ReqData{Req: r, Conn: conn, ClientIP: clientIP, ReqTime: reqTime, ToFQDN: toFQDN, RemapRule: ruleName}
 	responder := NewResponder(w, pluginCfg, pluginContext, srvrData, reqData, h.plugins, h.stats, reqID)
+	responder.AccessLogs = h.accessLogs
 
 	if err != nil {
 		switch err {
@@ -218,25 +240,50 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	remappedURI := r.RequestURI
+	onRemapData := plugin.OnRemapData{W: w, R: r, RemapRule: remappingProducer.Name(), RequestID: reqID, SrvrData: srvrData}
+	if stop := h.plugins.OnRemap(remappingProducer.PluginCfg(), pluginContext, onRemapData); stop {
+		return
+	}
+	if r.RequestURI != remappedURI {
+		if err := remappingProducer.SetURI(remap.RequestURI(r, h.scheme)); err != nil {
+			log.Errorf("plugin changed request URI '%v' to '%v': %v (reqid %v)\n", remappedURI, r.RequestURI, err, reqID)
+			*responder.ResponseCode = http.StatusInternalServerError
+			responder.Do()
+			return
+		}
+	}
+
+	reqHeader := web.CopyHeader(r.Header) // copy request header, because it's not guaranteed valid after actually issuing the request
 	reqCacheControl := rfc.ParseCacheControl(reqHeader)
 	log.Debugf("Serve got Cache-Control %+v (reqid %v)\n", reqCacheControl, reqID)
 
 	connectionClose := h.connectionClose || remappingProducer.ConnectionClose()
 
-	beforeCacheLookUpData := plugin.BeforeCacheLookUpData{Req: r, DefaultCacheKey: remappingProducer.CacheKey(), CacheKeyOverrideFunc: remappingProducer.OverrideCacheKey}
+	cache := remappingProducer.Cache()
+
+	beforeCacheLookUpData := plugin.BeforeCacheLookUpData{Req: r, DefaultCacheKey: remappingProducer.CacheKey(), CacheKeyOverrideFunc: remappingProducer.OverrideCacheKey, Cache: cache}
 	h.plugins.OnBeforeCacheLookup(remappingProducer.PluginCfg(), pluginContext, beforeCacheLookUpData)
 
 	cacheKey := remappingProducer.CacheKey()
 	retrier := NewRetrier(h, reqHeader, reqTime, reqCacheControl, remappingProducer, reqID)
-
-	cache := remappingProducer.Cache()
+	responder.Retrier = retrier
 
 	var reqHost *string
 	cacheObj, ok := cache.Get(cacheKey)
+	revalidation := revalidate.TypeNone
+	if ok {
+		revalidation = h.revalidations.Check(cacheKey, cacheObj, reqTime)
+	}
+	if revalidation == revalidate.TypeMiss {
+		log.Debugf("cache.Handler.ServeHTTP: '%v' purged by revalidation rule (reqid %v)\n", cacheKey, reqID)
+		ok = false
+	}
 	if !ok {
 		log.Debugf("cache.Handler.ServeHTTP: '%v' not in cache (reqid %v)\n", cacheKey, reqID)
 		beforeParentRequestData := plugin.BeforeParentRequestData{Req: r, RemapRule: remappingProducer.Name()}
 		h.plugins.OnBeforeParentRequest(remappingProducer.PluginCfg(), pluginContext, beforeParentRequestData)
+		retrier.Stream = h.newStreamer(w, r, reqHeader, responder, remappingProducer, pluginContext, connectionClose)
 		cacheObj, reqHost, err = retrier.Get(r, nil)
 		if err != nil {
 			log.Errorf("retrying get error (in uncached): %v (reqid %v)\n", err, reqID)
@@ -250,15 +297,29 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		responder.OriginCode = cacheObj.OriginCode
-		// create new pointers, so plugins don't modify the cacheObj
-		codePtr, hdrsPtr, bodyPtr := cacheObj.Code, cacheObj.RespHeaders, cacheObj.Body
-		responder.SetResponse(&codePtr, &hdrsPtr, &bodyPtr, connectionClose)
 		responder.OriginReqSuccess = true
 		responder.ProxyStr = cacheObj.ProxyURL
 		if reqHost != nil {
 			responder.ToFQDN = *reqHost
 		}
-		beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: cacheObj, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name()}
+		if cacheObj.BodyReader != nil {
+			retrier.Stream.start(cacheObj)
+		}
+		if retrier.Stream.started() {
+			finishStream(responder, retrier.Stream, cacheObj)
+			return
+		}
+		bodyPtr, err := respBody(cacheObj, reqHeader)
+		if err != nil {
+			log.Errorf("reading chunked body: %v (reqid %v)\n", err, reqID)
+			*responder.ResponseCode = http.StatusInternalServerError
+			responder.Do()
+			return
+		}
+		// create new pointers, so plugins don't modify the cacheObj
+		codePtr, hdrsPtr := cacheObj.Code, cacheObj.RespHeaders
+		responder.SetObjResponse(&codePtr, &hdrsPtr, &bodyPtr, cacheObj, connectionClose)
+		beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: cacheObj, Cache: cache, CacheKey: cacheKey, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name()}
 		h.plugins.OnBeforeRespond(remappingProducer.PluginCfg(), pluginContext, beforeRespData)
 		responder.Do()
 		return
@@ -266,6 +327,10 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	reqHeaders := r.Header
 	canReuseStored := rfc.CanReuseStored(reqHeaders, cacheObj.RespHeaders, reqCacheControl, cacheObj.RespCacheControl, cacheObj.ReqHeaders, cacheObj.ReqRespTime, cacheObj.RespRespTime, h.strictRFC)
+	if revalidation == revalidate.TypeStale && canReuseStored != rfc.ReuseCannot {
+		log.Debugf("cache.Handler.ServeHTTP: '%v' made stale by revalidation rule (reqid %v)\n", cacheKey, reqID)
+		canReuseStored = rfc.ReuseMustRevalidate
+	}
 
 	if canReuseStored != rfc.ReuseCan { // run the BeforeParentRequest hook for revalidations / ReuseCannot
 		beforeParentRequestData := plugin.BeforeParentRequestData{Req: r, RemapRule: remappingProducer.Name()}
@@ -277,12 +342,26 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Debugf("cache.Handler.ServeHTTP: '%v' cache hit! (reqid %v)\n", cacheKey, reqID)
 	case rfc.ReuseCannot:
 		log.Debugf("cache.Handler.ServeHTTP: '%v' can't reuse (reqid %v)\n", cacheKey, reqID)
+		retrier.Stream = h.newStreamer(w, r, reqHeader, responder, remappingProducer, pluginContext, connectionClose)
 		cacheObj, reqHost, err = retrier.Get(r, nil)
 		if err != nil {
 			log.Errorf("retrying get error (in reuse-cannot): %v (reqid %v)\n", err, reqID)
 			responder.Do()
 			return
 		}
+		if cacheObj.BodyReader != nil {
+			retrier.Stream.start(cacheObj)
+		}
+		if retrier.Stream.started() {
+			responder.OriginReqSuccess = true
+			responder.OriginCode = cacheObj.OriginCode
+			responder.ProxyStr = cacheObj.ProxyURL
+			if reqHost != nil {
+				responder.ToFQDN = *reqHost
+			}
+			finishStream(responder, retrier.Stream, cacheObj)
+			return
+		}
 	case rfc.ReuseMustRevalidate:
 		log.Debugf("cache.Handler.ServeHTTP: '%v' must revalidate (reqid %v)\n", cacheKey, reqID)
 		cacheObj, reqHost, err = retrier.Get(r, cacheObj)
@@ -292,19 +371,41 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	case rfc.ReuseMustRevalidateCanStale:
+		stale := staleness(cacheObj)
+		if swr := staleWhileRevalidate(remappingProducer, cacheObj); swr > 0 && stale <= swr {
+			log.Debugf("cache.Handler.ServeHTTP: '%v' stale for %v, within stale-while-revalidate %v, serving stale and revalidating in the background (reqid %v)\n", cacheKey, stale, swr, reqID)
+			h.revalidateInBackground(r, retrier, cacheObj, cacheKey, reqID)
+			break
+		}
 		log.Debugf("cache.Handler.ServeHTTP: '%v' must revalidate (but allowed stale) (reqid %v)\n", cacheKey, reqID)
 		oldCacheObj := cacheObj
 		cacheObj, reqHost, err = retrier.Get(r, cacheObj)
-		if err != nil {
+		sie, sieLimited := staleIfError(remappingProducer, reqCacheControl, oldCacheObj)
+		if canServeStaleOnError(err, cacheObj, stale, sie, sieLimited) {
+			if err == nil {
+				err = errors.New("parent returned " + strconv.Itoa(cacheObj.Code))
+			}
 			log.Errorf("retrying get error - serving stale as allowed: %v (reqid %v)\n", err, reqID)
 			cacheObj = oldCacheObj
+			reqHost = nil
+		} else if err != nil {
+			log.Errorf("retrying get error - stale for %v, beyond stale-if-error %v: %v (reqid %v)\n", stale, sie, err, reqID)
+			responder.Do()
+			return
 		}
 	}
 	log.Debugf("cache.Handler.ServeHTTP: '%v' responding with %v (reqid %v)\n", cacheKey, cacheObj.Code, reqID)
 
+	bodyPtr, err := respBody(cacheObj, reqHeader)
+	if err != nil {
+		log.Errorf("reading chunked body: %v (reqid %v)\n", err, reqID)
+		*responder.ResponseCode = http.StatusInternalServerError
+		responder.Do()
+		return
+	}
 	// create new pointers, so plugins don't modify the cacheObj
-	codePtr, hdrsPtr, bodyPtr := cacheObj.Code, cacheObj.RespHeaders, cacheObj.Body
-	responder.SetResponse(&codePtr, &hdrsPtr, &bodyPtr, connectionClose)
+	codePtr, hdrsPtr := cacheObj.Code, cacheObj.RespHeaders
+	responder.SetObjResponse(&codePtr, &hdrsPtr, &bodyPtr, cacheObj, connectionClose)
 	responder.OriginReqSuccess = true
 	responder.Reuse = canReuseStored
 	responder.OriginCode = cacheObj.OriginCode
@@ -313,7 +414,56 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if reqHost != nil {
 		responder.ToFQDN = *reqHost
 	}
-	beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: cacheObj, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name()}
+	beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: cacheObj, Cache: cache, CacheKey: cacheKey, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name()}
 	h.plugins.OnBeforeRespond(remappingProducer.PluginCfg(), pluginContext, beforeRespData)
 	responder.Do()
 }
+
+// newStreamer returns a Streamer to stream a large object to the client as it's fetched, or nil if the request can't be streamed.
+// Requests with a Range aren't streamed, because the range plugin needs the whole body to build the response.
+func (h *Handler) newStreamer(
+	w http.ResponseWriter,
+	r *http.Request,
+	reqHeader http.Header,
+	responder *Responder,
+	remappingProducer *remap.RemappingProducer,
+	pluginContext map[string]*interface{},
+	connectionClose bool,
+) *Streamer {
+	if reqHeader.Get("Range") != "" || r.Method == http.MethodHead {
+		return nil
+	}
+	start := func(obj *cacheobj.CacheObj) bool {
+		// create new pointers, so plugins don't modify the cacheObj
+		codePtr, hdrsPtr, bodyPtr := obj.Code, obj.RespHeaders, []byte(nil)
+		responder.SetResponse(&codePtr, &hdrsPtr, &bodyPtr, connectionClose)
+		beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: obj, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name()}
+		h.plugins.OnBeforeRespond(remappingProducer.PluginCfg(), pluginContext, beforeRespData)
+		if bodyPtr != nil || codePtr != obj.Code {
+			return false // a plugin replaced the response, which the responder will send when the object is complete
+		}
+		web.RespondHeader(w, codePtr, hdrsPtr, connectionClose)
+		return true
+	}
+	return &Streamer{W: w, Start: start}
+}
+
+// finishStream finishes the response for a request whose object was fetched with the given started Streamer. If the body is streaming, it finishes writing it, and logs and stats the bytes written; otherwise, it sends the response set when the stream was started.
+// If the streamed body is incomplete, the client connection is aborted.
+func finishStream(responder *Responder, stream *Streamer, obj *cacheobj.CacheObj) {
+	if stream.Streaming {
+		responder.F = func() (uint64, error) { return stream.finish(obj) }
+		responder.AbortOnErr = true
+	} else if obj.BodyReader != nil {
+		obj.BodyReader.Close()
+	}
+	responder.Do()
+}
+
+// respBody returns the body of the given object to give to plugins. Chunked bodies are nil, and written to the client from the chunks, unless the request has a Range, because the range plugin needs the whole body.
+func respBody(obj *cacheobj.CacheObj, reqHeader http.Header) ([]byte, error) {
+	if !obj.Chunked || reqHeader.Get("Range") == "" {
+		return obj.Body, nil
+	}
+	return obj.ReadBody()
+}
@@ -16,8 +16,11 @@ package cache
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/apache/trafficcontrol/grove/accesslog"
 	"github.com/apache/trafficcontrol/grove/cachedata"
+	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/plugin"
 	"github.com/apache/trafficcontrol/grove/stat"
 	"github.com/apache/trafficcontrol/grove/web"
@@ -36,6 +39,12 @@ type Responder struct {
 	Stats         stat.Stats
 	F             RespondFunc
 	ResponseCode  *int
+	// AbortOnErr is whether to abort the client connection if F returns an error, because the body may have been partially written, and the client must not mistake it for a complete response.
+	AbortOnErr bool
+	// AccessLogs are the access logs the response is written to. It may be nil.
+	AccessLogs *accesslog.Logs
+	// Retrier is the retrier of the request's parent requests, whose retries are logged. It may be nil.
+	Retrier *Retrier
 	cachedata.ParentRespData
 	cachedata.SrvrData
 	cachedata.ReqData
@@ -88,6 +97,20 @@ func (r *Responder) SetResponse(code *int, hdrs *http.Header, body *[]byte, conn
 	}
 }
 
+// SetObjResponse is like SetResponse, but for a response from the given cache object. If the object is chunked and the body is nil, the body is written from the object's chunks, unless the code was changed, e.g. to a 304 by a plugin.
+func (r *Responder) SetObjResponse(code *int, hdrs *http.Header, body *[]byte, obj *cacheobj.CacheObj, connectionClose bool) {
+	r.ResponseCode = code
+	r.F = func() (uint64, error) {
+		if r.Req.Method == http.MethodHead {
+			*body = nil
+		} else if obj.Chunked && *body == nil && *code == obj.Code {
+			return web.RespondStream(r.W, *code, *hdrs, obj.WriteBody, connectionClose)
+		}
+		return web.Respond(r.W, *code, *hdrs, *body, connectionClose)
+	}
+	r.AbortOnErr = obj.Chunked
+}
+
 // Do responds to the client, according to the data in r, with the given code, headers, and body. It additionally writes to the event log, and adds statistics about this request. This should always be called for the final response to a client, in order to properly log, stat, and other final operations.
 // For cache misses, reuse should be ReuseCannot.
 // For parent connect failures, originCode should be 0.
@@ -100,9 +123,44 @@ func (r *Responder) Do() {
 	web.TryFlush(r.W) // TODO remove? Let plugins do it, if they need to?
 
 	respSuccess := err != nil
+	if r.Retrier != nil {
+		r.Retries = r.Retrier.Retries()
+	}
 	respData := cachedata.RespData{RespCode: *r.ResponseCode, BytesWritten: bytesSent, RespSuccess: respSuccess, CacheHit: isCacheHit(r.Reuse, r.OriginCode)}
 	arData := plugin.AfterRespondData{W: r.W, Stats: r.Stats, ReqData: r.ReqData, SrvrData: r.SrvrData, ParentRespData: r.ParentRespData, RespData: respData, RequestID: r.RequestID}
 	r.Plugins.OnAfterRespond(r.PluginCfg, r.PluginContext, arData)
+	r.AccessLogs.Log(r.accessLogRecord(respData))
+
+	if err != nil && r.AbortOnErr {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// accessLogRecord returns the access log record of the response.
+func (r *Responder) accessLogRecord(respData cachedata.RespData) *accesslog.Record {
+	return &accesslog.Record{
+		Time:                time.Now(),
+		ReqTime:             r.ReqTime,
+		ClientIP:            r.ClientIP,
+		Req:                 r.Req,
+		Hostname:            r.Hostname,
+		Port:                r.Port,
+		Scheme:              r.Scheme,
+		RemapRule:           r.RemapRule,
+		ToFQDN:              r.ToFQDN,
+		RespCode:            respData.RespCode,
+		BytesSent:           web.TryGetBytesWritten(r.W, r.Conn, respData.BytesWritten),
+		RespSuccess:         respData.RespSuccess,
+		CacheHit:            respData.CacheHit,
+		Reuse:               r.Reuse,
+		OriginCode:          r.OriginCode,
+		OriginBytes:         r.OriginBytes,
+		OriginReqSuccess:    r.OriginReqSuccess,
+		OriginConnectFailed: r.OriginConnectFailed,
+		ProxyStr:            r.ProxyStr,
+		Retries:             r.Retries,
+		RequestID:           r.RequestID,
+	}
 }
 
 func isCacheHit(reuse rfc.Reuse, originCode int) bool {
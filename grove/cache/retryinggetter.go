@@ -16,8 +16,11 @@ package cache
 
 import (
 	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
@@ -39,6 +42,9 @@ type Retrier struct {
 	ReqCacheControl   rfc.CacheControlMap
 	RemappingProducer *remap.RemappingProducer
 	ReqID             uint64
+	// Stream, if not nil, streams objects fetched without a cached object to the client as they're received.
+	Stream  *Streamer
+	retries uint64 // Atomic - DO NOT access or modify without atomic operations
 }
 
 func NewRetrier(h *Handler, reqHdr http.Header, reqTime time.Time, reqCacheControl rfc.CacheControlMap, remappingProducer *remap.RemappingProducer, reqID uint64) *Retrier {
@@ -54,15 +60,27 @@ func NewRetrier(h *Handler, reqHdr http.Header, reqTime time.Time, reqCacheContr
 // Get takes the HTTP request and the cached object if there is one, and makes a new request, retrying according to its RemappingProducer. If no cached object exists, pass a nil obj.
 // Along with the cacheobj.CacheObj, a string pointer to the request hostname used to fetch the cacheobj.CacheObj is returned.
 func (r *Retrier) Get(req *http.Request, obj *cacheobj.CacheObj) (*cacheobj.CacheObj, *string, error) {
+	attempts := uint64(0)
 	retryGetFunc := func(remapping remap.Remapping, retryFailures bool, obj *cacheobj.CacheObj) *cacheobj.CacheObj {
+		attempts++
 		// return true for Revalidate, and issue revalidate requests separately.
 		canReuse := func(cacheObj *cacheobj.CacheObj) bool {
+			if cacheObj.BodyReader != nil {
+				return false // the rest of the body can only be read by the request which fetched it
+			}
 			return cacheobj.CanReuse(r.ReqHdr, r.ReqCacheControl, cacheObj, r.H.strictRFC, true)
 		}
 		getAndCache := func() *cacheobj.CacheObj {
-			return GetAndCache(remapping.Request, remapping.ProxyURL, remapping.CacheKey, remapping.Name, remapping.Request.Header, r.ReqTime, r.H.strictRFC, remapping.Cache, r.H.ruleThrottlers[remapping.Name], obj, remapping.Timeout, retryFailures, remapping.RetryNum, remapping.RetryCodes, remapping.Transport, r.ReqID)
+			return GetAndCache(remapping.Request, remapping.ProxyURL, remapping.CacheKey, remapping.Name, remapping.Request.Header, r.ReqTime, r.H.strictRFC, remapping.Cache, r.H.ruleThrottlers[remapping.Name], obj, remapping.Timeout, retryFailures, remapping.RetryNum, remapping.RetryCodes, remapping.Transport, r.ReqID, r.Stream)
+		}
+		gotObj, getReqID := r.H.getter.Get(remapping.CacheKey, getAndCache, canReuse, r.ReqID, r.RemappingProducer.CoalesceTimeout())
+		if getReqID == r.ReqID { // only the request which actually requested the parent reports its health, not requests given its object
+			if isParentFailure(gotObj) {
+				remapping.Health.Failure(time.Now())
+			} else {
+				remapping.Health.Success()
+			}
 		}
-		gotObj, getReqID := r.H.getter.Get(remapping.CacheKey, getAndCache, canReuse, r.ReqID)
 
 		req := remapping.Request
 		log.Debugf("Retrier.Get Y URI %v %v %v remapping.CacheKey %v rule %v parent %v code %v headers %+v len(body) %v getterid %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), remapping.CacheKey, remapping.Name, remapping.ProxyURL, gotObj.Code, gotObj.RespHeaders, len(gotObj.Body), getReqID, r.ReqID)
@@ -70,13 +88,23 @@ func (r *Retrier) Get(req *http.Request, obj *cacheobj.CacheObj) (*cacheobj.Cach
 		return gotObj
 	}
 
-	return retryingGet(retryGetFunc, req, r.RemappingProducer, obj)
+	gotObj, reqHost, err := retryingGet(retryGetFunc, req, r.RemappingProducer, obj, r.Stream)
+	if attempts > 1 {
+		atomic.AddUint64(&r.retries, attempts-1)
+	}
+	return gotObj, reqHost, err
+}
+
+// Retries returns the number of parent requests retried after a failure, by all calls to Get.
+func (r *Retrier) Retries() uint64 {
+	return atomic.LoadUint64(&r.retries)
 }
 
 // retryingGet takes a function, and retries failures up to the RemappingProducer RetryNum limit. On failure, it creates a new remapping. The func f should use `remapping` to make its request. If it hits failures up to the limit, it returns the last received cacheobj.CacheObj
+// Failures aren't retried once the given stream has started, because the client response may already have begun.
 // Along with the cacheobj.CacheObj, a string pointer to the request hostname used to fetch the cacheobj.CacheObj is returned.
 // TODO refactor to not close variables - it's awkward and confusing.
-func retryingGet(getCacheObj func(remapping remap.Remapping, retryFailures bool, obj *cacheobj.CacheObj) *cacheobj.CacheObj, request *http.Request, remappingProducer *remap.RemappingProducer, cachedObj *cacheobj.CacheObj) (*cacheobj.CacheObj, *string, error) {
+func retryingGet(getCacheObj func(remapping remap.Remapping, retryFailures bool, obj *cacheobj.CacheObj) *cacheobj.CacheObj, request *http.Request, remappingProducer *remap.RemappingProducer, cachedObj *cacheobj.CacheObj, stream *Streamer) (*cacheobj.CacheObj, *string, error) {
 	obj := (*cacheobj.CacheObj)(nil)
 	for {
 		remapping, retryAllowed, err := remappingProducer.GetNext(request)
@@ -89,7 +117,7 @@ func retryingGet(getCacheObj func(remapping remap.Remapping, retryFailures bool,
 			return nil, nil, err
 		}
 		obj = getCacheObj(remapping, retryAllowed, cachedObj)
-		if !isFailure(obj, remapping.RetryCodes) {
+		if !isFailure(obj, remapping.RetryCodes) || stream.started() {
 			return obj, &remapping.Request.URL.Host, nil
 		}
 	}
@@ -100,10 +128,23 @@ func isFailure(o *cacheobj.CacheObj, retryCodes map[int]struct{}) bool {
 	return failureCode || o.Code == CodeConnectFailure
 }
 
+// isParentFailure returns whether the given object indicates the parent is unhealthy, because it couldn't be reached, or returned a gateway error. Other failures, such as a 500 or 404, are likely specific to the object, and don't indicate the parent is down.
+func isParentFailure(o *cacheobj.CacheObj) bool {
+	switch o.Code {
+	case CodeConnectFailure, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
 const ModifiedSinceHdr = "If-Modified-Since"
 
 // GetAndCache makes a client request for the given `http.Request` and caches it if `CanCache`.
 // THe `ruleThrottler` may be nil, in which case the request will be unthrottled.
+//
+// Bodies larger than cacheobj.ChunkSize are received and cached in chunks. If the `stream` isn't nil, and this isn't a revalidation, each chunk is also queued to be written to the client as it's received. If the origin fails mid-transfer, the chunks already cached are removed, and a CodeConnectFailure object is returned.
+//
+// If the `stream` isn't nil and a large response can't be cached, it isn't received here, holding the throttler and requests waiting for the object until it's complete. Instead, the object is returned with the rest of its body in BodyReader, for the stream to write to the client.
 func GetAndCache(
 	req *http.Request,
 	proxyURL *url.URL,
@@ -121,7 +162,11 @@ func GetAndCache(
 	retryCodes map[int]struct{},
 	transport *http.Transport,
 	reqID uint64,
+	stream *Streamer,
 ) *cacheobj.CacheObj {
+	if revalidateObj != nil {
+		stream = nil
+	}
 	// TODO this is awkward, with 'revalidateObj' indicating whether the request is a Revalidate. Should Getting and Caching be split up? How?
 	get := func() *cacheobj.CacheObj {
 		// TODO figure out why respReqTime isn't used by rules
@@ -136,7 +181,21 @@ func GetAndCache(
 		} else {
 			req.Header.Del(ModifiedSinceHdr)
 		}
-		respCode, respHeader, respBody, reqTime, reqRespTime, err := web.Request(transport, req)
+		resp, reqTime, reqRespTime, err := web.RequestStream(transport, req)
+		respCode, respHeader, respBody, lastChunk := 0, http.Header(nil), []byte(nil), true
+		keepBody := false // whether the response body is returned in the object's BodyReader, to be closed by the caller
+		if err == nil {
+			defer func() {
+				if !keepBody {
+					resp.Body.Close()
+				}
+			}()
+			respCode, respHeader = resp.StatusCode, resp.Header
+			respBody, lastChunk, err = readChunk(resp.Body)
+			if err != nil {
+				err = errors.New("reading response body: " + err.Error())
+			}
+		}
 		log.Debugf("GetAndCache web.Request URI %v %v %v cacheKey %v rule %v parent %v error %v reval %v code %v len(body) %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), cacheKey, remapName, proxyURLStr, err, revalidateObj != nil, respCode, len(respBody), reqID)
 
 		if err != nil {
@@ -146,6 +205,15 @@ func GetAndCache(
 			return cacheobj.New(reqHeader, body, code, code, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{})
 		}
 		if _, ok := retryCodes[respCode]; ok && !cacheFailure {
+			if !lastChunk {
+				rest, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					log.Errorf("Parent error reading body for URI %v %v %v cacheKey %v rule %v parent %v error %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), cacheKey, remapName, proxyURLStr, err, reqID)
+					code := CodeConnectFailure
+					return cacheobj.New(reqHeader, []byte(http.StatusText(code)), code, code, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{})
+				}
+				respBody = append(respBody, rest...)
+			}
 			return cacheobj.New(reqHeader, respBody, respCode, respCode, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{})
 		}
 
@@ -167,7 +235,20 @@ func GetAndCache(
 		if revalidateObj == nil || respCode != http.StatusNotModified {
 			log.Debugf("GetAndCache new %v (reqid %v)\n", cacheKey, reqID)
 			obj = cacheobj.New(reqHeader, respBody, respCode, respCode, proxyURLStr, respHeader, reqTime, reqRespTime, respRespTime, lastModified)
-			if !rfc.CanCache(req.Method, reqHeader, respCode, respHeader, strictRFC) {
+			canCache := rfc.CanCache(req.Method, reqHeader, respCode, respHeader, strictRFC)
+			if !lastChunk && !canCache && stream != nil {
+				keepBody = true
+				obj.BodyReader = resp.Body
+				return obj // return without receiving the rest of the body, or caching
+			}
+			if !lastChunk {
+				if err := getChunks(obj, resp.Body, cacheKey, cache, canCache, stream); err != nil {
+					log.Errorf("Parent error mid-transfer for URI %v %v %v cacheKey %v rule %v parent %v error %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), cacheKey, remapName, proxyURLStr, err, reqID)
+					code := CodeConnectFailure
+					return cacheobj.New(reqHeader, []byte(http.StatusText(code)), code, code, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{})
+				}
+			}
+			if !canCache {
 				return obj // return without caching
 			}
 		} else {
@@ -189,6 +270,10 @@ func GetAndCache(
 				LastModified:     revalidateObj.LastModified,
 				Size:             revalidateObj.Size,
 				HitCount:         revalidateObj.HitCount, // no need to +1 here, the cache Get did that
+				Chunked:          revalidateObj.Chunked,
+				ChunkID:          revalidateObj.ChunkID, // the same ChunkID, so caches keep the existing chunks
+				Chunks:           revalidateObj.Chunks,
+				ChunkSource:      revalidateObj.ChunkSource,
 			}
 		}
 		cache.Add(cacheKey, obj) // TODO store pointer?
@@ -203,3 +288,57 @@ func GetAndCache(
 	ruleThrottler.Throttle(func() { c = get() })
 	return c
 }
+
+// getChunks receives the body of the given object from body, after its first chunk, which must be in obj.Body. The object is made chunked, and each chunk is queued to be written to the stream as it's received.
+//
+// If canCache and the cache is an icache.ChunkWriter, each chunk is written to the cache as it's received, and not held in memory. Otherwise, the chunks are held in obj.Chunks. Either way, the object itself isn't added to the cache.
+//
+// If the body can't be completely received, any chunks written to the cache are removed, and an error is returned.
+func getChunks(obj *cacheobj.CacheObj, body io.Reader, cacheKey string, cache icache.Cache, canCache bool, stream *Streamer) error {
+	obj.Chunked = true
+	obj.ChunkID = cacheobj.NewChunkID()
+	chunk := obj.Body
+	obj.Body = nil
+
+	chunkWriter, writeChunks := cache.(icache.ChunkWriter)
+	writeChunks = writeChunks && canCache
+
+	stream.start(obj)
+
+	size := uint64(0)
+	numChunks := 0
+	fail := func(err error) error {
+		if writeChunks {
+			chunkWriter.AbortChunks(cacheKey, obj.ChunkID, numChunks)
+		}
+		stream.fail(err)
+		return err
+	}
+
+	for lastChunk := false; len(chunk) > 0; {
+		if writeChunks {
+			if err := chunkWriter.AddChunk(cacheKey, obj.ChunkID, numChunks, chunk); err != nil {
+				return fail(errors.New("writing chunk to cache: " + err.Error()))
+			}
+		} else {
+			obj.Chunks = append(obj.Chunks, chunk)
+		}
+		numChunks++
+		size += uint64(len(chunk))
+		stream.write(chunk)
+
+		if lastChunk {
+			break
+		}
+		err := error(nil)
+		if chunk, lastChunk, err = readChunk(body); err != nil {
+			return fail(errors.New("reading response body: " + err.Error()))
+		}
+	}
+
+	obj.Size = size
+	if writeChunks {
+		obj.ChunkSource = chunkWriter.ChunkSource(cacheKey, obj.ChunkID)
+	}
+	return nil
+}
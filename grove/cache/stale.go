@@ -0,0 +1,90 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/remap"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// staleness returns how long the given object has been stale. If the object is fresh, it's negative.
+func staleness(obj *cacheobj.CacheObj) time.Duration {
+	return -rfc.FreshFor(obj.RespHeaders, obj.RespCacheControl, obj.ReqRespTime, obj.RespRespTime)
+}
+
+// staleWhileRevalidate returns how long the given object may be served stale, while it's revalidated in the background, per RFC5861§3. The remap rule's override takes precedence over the object's Cache-Control.
+func staleWhileRevalidate(remappingProducer *remap.RemappingProducer, obj *cacheobj.CacheObj) time.Duration {
+	if swr, ok := remappingProducer.StaleWhileRevalidate(); ok {
+		return swr
+	}
+	swr, _ := rfc.StaleWhileRevalidate(obj.RespCacheControl)
+	return swr
+}
+
+// staleIfError returns how long the given object may be served stale when revalidating it fails, per RFC5861§4, and whether there is a limit. The remap rule's override takes precedence over the request and object Cache-Control. If both the request and object have the directive, the smaller is used.
+func staleIfError(remappingProducer *remap.RemappingProducer, reqCC rfc.CacheControlMap, obj *cacheobj.CacheObj) (time.Duration, bool) {
+	if sie, ok := remappingProducer.StaleIfError(); ok {
+		return sie, true
+	}
+	reqSIE, reqOK := rfc.StaleIfError(reqCC)
+	respSIE, respOK := rfc.StaleIfError(obj.RespCacheControl)
+	if reqOK && (!respOK || reqSIE < respSIE) {
+		return reqSIE, true
+	}
+	return respSIE, respOK
+}
+
+// canServeStaleOnError returns whether a stale object may be served instead of the result of revalidating it. The err and newObj are the result of revalidating, and stale is how long the object has been stale.
+// Connection failures may serve the stale object unless it's beyond the stale-if-error limit, as they always have. Server errors may only serve the stale object within an explicit stale-if-error limit.
+func canServeStaleOnError(err error, newObj *cacheobj.CacheObj, stale time.Duration, staleIfError time.Duration, limited bool) bool {
+	if err != nil {
+		return !limited || stale <= staleIfError
+	}
+	return newObj.Code >= http.StatusInternalServerError && limited && stale <= staleIfError
+}
+
+// revalidateInBackground revalidates the given object with the origin in a new goroutine, so a stale object can be served without waiting. Only one background revalidation per cache key runs at a time; if one is already running, this does nothing and returns false.
+func (h *Handler) revalidateInBackground(r *http.Request, retrier *Retrier, obj *cacheobj.CacheObj, cacheKey string, reqID uint64) bool {
+	h.backgroundRevalsM.Lock()
+	if _, ok := h.backgroundRevals[cacheKey]; ok {
+		h.backgroundRevalsM.Unlock()
+		return false
+	}
+	h.backgroundRevals[cacheKey] = struct{}{}
+	h.backgroundRevalsM.Unlock()
+
+	req := r.Clone(context.Background()) // the client request will be finished before the revalidation
+	go func() {
+		defer func() {
+			h.backgroundRevalsM.Lock()
+			delete(h.backgroundRevals, cacheKey)
+			h.backgroundRevalsM.Unlock()
+		}()
+		newObj, _, err := retrier.Get(req, obj)
+		if err != nil {
+			log.Errorf("background revalidation of '%v' error: %v (reqid %v)\n", cacheKey, err, reqID)
+			return
+		}
+		log.Debugf("background revalidation of '%v' got %v (reqid %v)\n", cacheKey, newObj.OriginCode, reqID)
+	}()
+	return true
+}
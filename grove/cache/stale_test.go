@@ -0,0 +1,62 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+)
+
+func TestCanServeStaleOnError(t *testing.T) {
+	connErr := errors.New("connection refused")
+	ok := &cacheobj.CacheObj{Code: http.StatusOK}
+	serverErr := &cacheobj.CacheObj{Code: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name     string
+		err      error
+		obj      *cacheobj.CacheObj
+		stale    time.Duration
+		sie      time.Duration
+		limited  bool
+		expected bool
+	}{
+		{"connection failure without limit", connErr, nil, time.Hour, 0, false, true},
+		{"connection failure within limit", connErr, nil, time.Minute, time.Hour, true, true},
+		{"connection failure beyond limit", connErr, nil, time.Hour, time.Minute, true, false},
+		{"server error without limit", nil, serverErr, time.Minute, 0, false, false},
+		{"server error within limit", nil, serverErr, time.Minute, time.Hour, true, true},
+		{"server error beyond limit", nil, serverErr, time.Hour, time.Minute, true, false},
+		{"success", nil, ok, time.Minute, time.Hour, true, false},
+	}
+	for _, test := range tests {
+		if actual := canServeStaleOnError(test.err, test.obj, test.stale, test.sie, test.limited); actual != test.expected {
+			t.Errorf("canServeStaleOnError %v expected %v actual %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestStaleness(t *testing.T) {
+	respTime := time.Now().Add(-time.Hour)
+	hdr := http.Header{"Cache-Control": {"max-age=60"}, "Date": {respTime.Format(http.TimeFormat)}}
+	obj := cacheobj.New(http.Header{}, nil, http.StatusOK, http.StatusOK, "", hdr, respTime, respTime, respTime, respTime)
+	if stale := staleness(obj); stale < 58*time.Minute || stale > 60*time.Minute {
+		t.Errorf("staleness of an object fresh for a minute an hour ago expected about 59m, actual %v", stale)
+	}
+}
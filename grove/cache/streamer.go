@@ -0,0 +1,207 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/web"
+)
+
+// streamQueueChunks is the number of chunks which may be waiting to be written to a client. If a client is slower than the origin, and falls this far behind, the object is received without waiting for the client, and the rest of the body is written to it from the object once it's complete. This keeps a slow client from holding the rule throttler, and from stalling the requests waiting for the same object.
+const streamQueueChunks = 4
+
+// Streamer writes a large object's body to the client as it's received from the origin, so the client doesn't have to wait for the whole object to be received and cached.
+//
+// Chunks are written to the client by a goroutine, so the request receiving the object never waits for the client. The response isn't complete until finish is called, after the object has been received.
+//
+// A Streamer is only used by the single request which fetches the object, and so is not threadsafe. A nil *Streamer is valid, and streams nothing.
+type Streamer struct {
+	W http.ResponseWriter
+	// Start is called with the object, before its body is received. If the body should be streamed, Start must write the response header to W, and return true. If it returns false, the body is not streamed, and the response must be written after the object is complete, for example because a plugin replaced the response.
+	Start func(obj *cacheobj.CacheObj) bool
+	// Started is whether Start was called. If so, the object must not be retried, because the client response may have begun.
+	Started bool
+	// Streaming is whether Start returned true, and the body is being written to W.
+	Streaming bool
+	// BytesWritten is the number of body bytes written to W. It isn't complete until finish returns.
+	BytesWritten uint64
+	// Err is the error writing to the client, or the origin error which prevented the body from being completed. It's set by finish. If it isn't nil after Streaming, the client received an incomplete body.
+	Err error
+
+	// queue is the chunks waiting to be written to the client by the writeQueue goroutine, which closes done when they've all been written, after queue is closed.
+	queue chan []byte
+	done  chan struct{}
+	// queued is the number of chunks sent to the queue.
+	queued int
+	// behind is whether the client fell behind, so chunks after the queued chunks must be written from the object by finish.
+	behind bool
+	// writeErr is the error writing to the client. It is only accessed by the writeQueue goroutine, until done is closed.
+	writeErr error
+	// originErr is the origin error which prevented the body from being completed.
+	originErr error
+}
+
+// started returns whether the given Streamer isn't nil, and has been started.
+func (s *Streamer) started() bool {
+	return s != nil && s.Started
+}
+
+func (s *Streamer) start(obj *cacheobj.CacheObj) {
+	if s == nil {
+		return
+	}
+	s.Started = true
+	s.Streaming = s.Start(obj)
+}
+
+// write queues the given chunk to be written to the client, if streaming. It never waits for the client: if the queue is full, the chunk and all chunks after it are left to finish.
+func (s *Streamer) write(chunk []byte) {
+	if s == nil || !s.Streaming || s.behind {
+		return
+	}
+	if s.queue == nil {
+		s.queue = make(chan []byte, streamQueueChunks)
+		s.done = make(chan struct{})
+		go s.writeQueue()
+	}
+	select {
+	case s.queue <- chunk:
+		s.queued++
+	default:
+		s.behind = true
+	}
+}
+
+// writeQueue writes the queued chunks to the client, until the queue is closed. Errors are stored in s.writeErr, and stop further writes.
+func (s *Streamer) writeQueue() {
+	defer close(s.done)
+	for chunk := range s.queue {
+		if s.writeErr == nil {
+			s.writeErr = s.writeChunk(chunk)
+		}
+	}
+}
+
+// writeChunk writes the given chunk to the client, and flushes it.
+func (s *Streamer) writeChunk(chunk []byte) error {
+	n, err := s.W.Write(chunk)
+	s.BytesWritten += uint64(n)
+	if err != nil {
+		return errors.New("writing to client: " + err.Error())
+	}
+	web.TryFlush(s.W)
+	return nil
+}
+
+// fail sets the error which prevented the body from being completed, if there isn't already an error.
+func (s *Streamer) fail(err error) {
+	if s == nil || s.originErr != nil {
+		return
+	}
+	s.originErr = err
+}
+
+// finish completes the streamed body of the given object, which must be the object the Streamer was started with. It must be called after the object has been received, and the request is no longer holding the rule throttler or other requests waiting for the object.
+//
+// It waits for the queued chunks to be written, and then writes the rest of the body from the object, if the client fell behind, or from obj.BodyReader, if the object is uncacheable and its body is still being received. It returns the body bytes written and any error, which are also set in BytesWritten and Err.
+func (s *Streamer) finish(obj *cacheobj.CacheObj) (uint64, error) {
+	if obj.BodyReader != nil {
+		defer obj.BodyReader.Close()
+	}
+	if s.queue != nil {
+		close(s.queue)
+		<-s.done
+	}
+	s.Err = s.writeErr
+	if s.Err == nil {
+		s.Err = s.originErr
+	}
+	if s.Err != nil {
+		return s.BytesWritten, s.Err
+	}
+
+	if obj.BodyReader != nil {
+		s.Err = s.writeReader(obj.Body, obj.BodyReader)
+		return s.BytesWritten, s.Err
+	}
+	if s.behind {
+		for i := s.queued; i < obj.NumChunks(); i++ {
+			chunk, err := obj.Chunk(i)
+			if err != nil {
+				s.Err = errors.New("reading chunk: " + err.Error())
+				break
+			}
+			if s.Err = s.writeChunk(chunk); s.Err != nil {
+				break
+			}
+		}
+	}
+	return s.BytesWritten, s.Err
+}
+
+// writeReader writes the given first chunk, and then the rest of the body from r, a chunk at a time, to the client.
+func (s *Streamer) writeReader(first []byte, r io.Reader) error {
+	if err := s.writeChunk(first); err != nil {
+		return err
+	}
+	for {
+		chunk, lastChunk, err := readChunk(r)
+		if err != nil {
+			return errors.New("reading response body: " + err.Error())
+		}
+		if len(chunk) > 0 {
+			if err := s.writeChunk(chunk); err != nil {
+				return err
+			}
+		}
+		if lastChunk {
+			return nil
+		}
+	}
+}
+
+// chunkBufs holds buffers of cacheobj.ChunkSize to read chunks into, so each chunk read doesn't allocate a whole chunk, which would be retained by bodies smaller than a chunk.
+var chunkBufs = sync.Pool{New: func() interface{} { return make([]byte, cacheobj.ChunkSize) }}
+
+// readChunk reads the next chunk of at most cacheobj.ChunkSize bytes from r. It returns the chunk, whether it was the last chunk, and any error.
+// The returned chunk is a new slice of exactly its length, so it can be retained without retaining a whole chunk's capacity.
+// Note this can't use io.ReadFull, because it returns io.ErrUnexpectedEOF both for a short final chunk and for an HTTP body truncated by the origin.
+func readChunk(r io.Reader) ([]byte, bool, error) {
+	buf := chunkBufs.Get().([]byte)
+	defer chunkBufs.Put(buf)
+	n := 0
+	for n < len(buf) {
+		read, err := r.Read(buf[n:])
+		n += read
+		if err == io.EOF {
+			return copyChunk(buf[:n]), true, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+	}
+	return copyChunk(buf), false, nil
+}
+
+// copyChunk returns a copy of the given chunk, with exactly its length and capacity.
+func copyChunk(buf []byte) []byte {
+	chunk := make([]byte, len(buf))
+	copy(chunk, buf)
+	return chunk
+}
@@ -0,0 +1,240 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/thread"
+	"github.com/apache/trafficcontrol/grove/web"
+)
+
+// testBody returns a body of the given size, which differs between chunks, so misordered chunks are detected.
+func testBody(size int) []byte {
+	body := make([]byte, size)
+	for i := range body {
+		body[i] = byte(i / 7)
+	}
+	return body
+}
+
+func getAndCacheStreamed(t *testing.T, url string, cache icache.Cache) (*cacheobj.CacheObj, *Streamer, *httptest.ResponseRecorder) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	stream := &Streamer{W: w, Start: func(obj *cacheobj.CacheObj) bool {
+		web.RespondHeader(w, obj.Code, obj.RespHeaders, false)
+		return true
+	}}
+	obj := GetAndCache(req, nil, url, "test", req.Header, time.Now(), false, cache, thread.NewNoThrottler(), nil, time.Second, false, 0, map[int]struct{}{}, &http.Transport{}, 1, stream)
+	if obj.BodyReader != nil {
+		stream.start(obj)
+	}
+	if stream.Streaming {
+		stream.finish(obj)
+	}
+	return obj, stream, w
+}
+
+func TestGetAndCacheStreamed(t *testing.T) {
+	body := testBody(2*cacheobj.ChunkSize + 12345)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}))
+	defer origin.Close()
+
+	cache := memcache.New(10 * cacheobj.ChunkSize)
+	obj, stream, w := getAndCacheStreamed(t, origin.URL, cache)
+
+	if obj.Code != http.StatusOK {
+		t.Fatalf("expected code %v, actual %v", http.StatusOK, obj.Code)
+	}
+	if !stream.Streaming || stream.Err != nil {
+		t.Errorf("expected body streamed without error, actual streaming %v error %v", stream.Streaming, stream.Err)
+	}
+	if !bytes.Equal(body, w.Body.Bytes()) {
+		t.Errorf("expected streamed body of %v bytes, actual %v bytes which differ", len(body), w.Body.Len())
+	}
+	if stream.BytesWritten != uint64(len(body)) {
+		t.Errorf("expected %v bytes written, actual %v", len(body), stream.BytesWritten)
+	}
+	if !obj.Chunked || obj.NumChunks() != 3 || obj.Size != uint64(len(body)) {
+		t.Errorf("expected object chunked in 3 chunks of %v bytes, actual chunked %v chunks %v size %v", len(body), obj.Chunked, obj.NumChunks(), obj.Size)
+	}
+
+	cached, ok := cache.Get(origin.URL)
+	if !ok {
+		t.Fatalf("expected streamed object to be cached, actual not found")
+	}
+	if cachedBody, err := cached.ReadBody(); err != nil || !bytes.Equal(body, cachedBody) {
+		t.Errorf("expected cached body of %v bytes, actual %v bytes error %v", len(body), len(cachedBody), err)
+	}
+}
+
+func TestGetAndCacheSmallNotChunked(t *testing.T) {
+	body := []byte("small body")
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write(body)
+	}))
+	defer origin.Close()
+
+	cache := memcache.New(10 * cacheobj.ChunkSize)
+	obj, stream, w := getAndCacheStreamed(t, origin.URL, cache)
+
+	if obj.Chunked || !bytes.Equal(body, obj.Body) {
+		t.Errorf("expected unchunked body '%v', actual chunked %v body '%v'", string(body), obj.Chunked, string(obj.Body))
+	}
+	if stream.Started || w.Body.Len() != 0 {
+		t.Errorf("expected small body not streamed, actual started %v wrote %v bytes", stream.Started, w.Body.Len())
+	}
+	if _, ok := cache.Get(origin.URL); !ok {
+		t.Errorf("expected object to be cached, actual not found")
+	}
+}
+
+func TestGetAndCacheOriginFailMidTransfer(t *testing.T) {
+	body := testBody(3 * cacheobj.ChunkSize)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body[:cacheobj.ChunkSize+cacheobj.ChunkSize/2])
+		web.TryFlush(w)
+		panic(http.ErrAbortHandler) // close the connection mid-transfer
+	}))
+	defer origin.Close()
+
+	cache := memcache.New(10 * cacheobj.ChunkSize)
+	obj, stream, _ := getAndCacheStreamed(t, origin.URL, cache)
+
+	if obj.Code != CodeConnectFailure {
+		t.Errorf("expected code %v for origin failure mid-transfer, actual %v", CodeConnectFailure, obj.Code)
+	}
+	if !stream.Streaming || stream.Err == nil {
+		t.Errorf("expected stream started with an error, actual streaming %v error %v", stream.Streaming, stream.Err)
+	}
+	if stream.BytesWritten != cacheobj.ChunkSize {
+		t.Errorf("expected the first complete chunk of %v bytes streamed, actual %v", cacheobj.ChunkSize, stream.BytesWritten)
+	}
+	if _, ok := cache.Get(origin.URL); ok {
+		t.Errorf("expected incomplete object not cached, actual found")
+	}
+}
+
+func TestGetAndCacheUncacheableStreamed(t *testing.T) {
+	body := testBody(2*cacheobj.ChunkSize + 12345)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}))
+	defer origin.Close()
+
+	cache := memcache.New(10 * cacheobj.ChunkSize)
+	obj, stream, w := getAndCacheStreamed(t, origin.URL, cache)
+
+	if obj.Chunked || obj.Chunks != nil || len(obj.Body) != cacheobj.ChunkSize {
+		t.Errorf("expected uncacheable object to hold only its first chunk, actual chunked %v chunks %v body %v bytes", obj.Chunked, len(obj.Chunks), len(obj.Body))
+	}
+	if !stream.Streaming || stream.Err != nil {
+		t.Errorf("expected body streamed without error, actual streaming %v error %v", stream.Streaming, stream.Err)
+	}
+	if !bytes.Equal(body, w.Body.Bytes()) {
+		t.Errorf("expected streamed body of %v bytes, actual %v bytes which differ", len(body), w.Body.Len())
+	}
+	if _, ok := cache.Get(origin.URL); ok {
+		t.Errorf("expected uncacheable object not cached, actual found")
+	}
+}
+
+// blockingWriter is an http.ResponseWriter whose body writes block until unblock is closed, like a slow client.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	unblock chan struct{}
+}
+
+func (w blockingWriter) Write(b []byte) (int, error) {
+	<-w.unblock
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestGetAndCacheSlowClient(t *testing.T) {
+	body := testBody((streamQueueChunks+3)*cacheobj.ChunkSize + 12345)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}))
+	defer origin.Close()
+
+	req, err := http.NewRequest(http.MethodGet, origin.URL, nil)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	w := blockingWriter{ResponseRecorder: httptest.NewRecorder(), unblock: make(chan struct{})}
+	stream := &Streamer{W: w, Start: func(obj *cacheobj.CacheObj) bool {
+		web.RespondHeader(w, obj.Code, obj.RespHeaders, false)
+		return true
+	}}
+	cache := memcache.New(20 * cacheobj.ChunkSize)
+
+	got := make(chan *cacheobj.CacheObj, 1)
+	go func() {
+		got <- GetAndCache(req, nil, origin.URL, "test", req.Header, time.Now(), false, cache, thread.NewNoThrottler(), nil, time.Second, false, 0, map[int]struct{}{}, &http.Transport{}, 1, stream)
+	}()
+	obj := (*cacheobj.CacheObj)(nil)
+	select {
+	case obj = <-got:
+	case <-time.After(5 * time.Second):
+		close(w.unblock)
+		t.Fatal("expected object received without waiting for a blocked client, actual still receiving")
+	}
+	if _, ok := cache.Get(origin.URL); !ok {
+		t.Errorf("expected object cached before the client received it, actual not found")
+	}
+
+	close(w.unblock)
+	if _, err := stream.finish(obj); err != nil {
+		t.Fatalf("finishing stream: %v", err)
+	}
+	if !bytes.Equal(body, w.Body.Bytes()) {
+		t.Errorf("expected streamed body of %v bytes, actual %v bytes which differ", len(body), w.Body.Len())
+	}
+	if stream.BytesWritten != uint64(len(body)) {
+		t.Errorf("expected %v bytes written, actual %v", len(body), stream.BytesWritten)
+	}
+}
+
+func TestReadChunkExactSize(t *testing.T) {
+	chunk, lastChunk, err := readChunk(bytes.NewReader([]byte("small body")))
+	if err != nil || !lastChunk {
+		t.Fatalf("expected last chunk without error, actual last %v error %v", lastChunk, err)
+	}
+	if string(chunk) != "small body" || cap(chunk) != len(chunk) {
+		t.Errorf("expected chunk 'small body' with capacity %v, actual '%v' with capacity %v", len("small body"), string(chunk), cap(chunk))
+	}
+}
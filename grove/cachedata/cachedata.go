@@ -33,6 +33,8 @@ type ParentRespData struct {
 	OriginConnectFailed bool
 	OriginBytes         uint64
 	ProxyStr            string
+	// Retries is the number of parent requests retried after a failure.
+	Retries uint64
 }
 
 // HandlerData contains data generally held by the Handler, and known as soon as the request is received.
@@ -48,6 +50,8 @@ type ReqData struct {
 	ClientIP string
 	ReqTime  time.Time
 	ToFQDN   string
+	// RemapRule is the name of the remap rule the request matched, or empty if it matched no rule.
+	RemapRule string
 }
 
 type RespData struct {
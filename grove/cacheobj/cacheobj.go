@@ -15,12 +15,19 @@ package cacheobj
 */
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-rfc"
 )
 
+// ChunkSize is the size of the chunks the bodies of large objects are stored in. Objects whose bodies are no larger than a single chunk are stored in Body, and not chunked.
+const ChunkSize = 1024 * 1024
+
 type CacheObj struct {
 	Body             []byte
 	ReqHeaders       http.Header
@@ -35,12 +42,104 @@ type CacheObj struct {
 	LastModified     time.Time // the origin LastModified if it exists, or Date if it doesn't
 	Size             uint64
 	HitCount         uint64 // the number of times this object was hit
+
+	// Chunked is whether the body is stored in chunks of ChunkSize, rather than in Body. If so, Body is nil, and the chunks are in Chunks, or must be read with ChunkSource.
+	Chunked bool
+	// ChunkID uniquely identifies the chunks of this object, so caches can store the chunks of a new object for a key while the old object's are still being read.
+	ChunkID string
+	// Chunks are the chunks of a chunked object held in memory. It is nil if the chunks are stored elsewhere, such as on disk.
+	Chunks [][]byte
+	// ChunkSource returns chunk i of a chunked object whose chunks aren't held in memory. It is set by the cache the object was read from, and not stored.
+	ChunkSource func(i int) ([]byte, error)
+
+	// BodyReader is the rest of the body after Body, of an uncacheable object larger than a chunk, which is still being received from the origin, so it can be streamed to the client without being held in memory. It may only be read by the request which fetched the object, which must close it. Objects with a BodyReader are never cached, nor given to other requests.
+	BodyReader io.ReadCloser
 }
 
 // ComputeSize computes the size of the given CacheObj. This computation is expensive, as the headers must be iterated over. Thus, the size should be computed once and stored, not computed on-the-fly for every new request for the cached object.
+// The size of a chunked object whose chunks aren't in memory can't be computed, so its Size is returned unchanged.
 func (c CacheObj) ComputeSize() uint64 {
 	// TODO include headers size
-	return uint64(len(c.Body))
+	if !c.Chunked {
+		return uint64(len(c.Body))
+	}
+	if c.Chunks == nil {
+		return c.Size
+	}
+	size := uint64(0)
+	for _, chunk := range c.Chunks {
+		size += uint64(len(chunk))
+	}
+	return size
+}
+
+var lastChunkID uint64
+
+// NewChunkID returns a new unique ChunkID.
+func NewChunkID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "." + strconv.FormatUint(atomic.AddUint64(&lastChunkID, 1), 36)
+}
+
+// NumChunks returns the number of chunks of the object's body. It is 0 if the object isn't chunked.
+func (c *CacheObj) NumChunks() int {
+	if !c.Chunked {
+		return 0
+	}
+	if c.Chunks != nil {
+		return len(c.Chunks)
+	}
+	return int((c.Size + ChunkSize - 1) / ChunkSize)
+}
+
+// Chunk returns chunk i of a chunked object.
+func (c *CacheObj) Chunk(i int) ([]byte, error) {
+	if c.Chunks != nil {
+		if i < 0 || i >= len(c.Chunks) {
+			return nil, errors.New("chunk " + strconv.Itoa(i) + " out of range")
+		}
+		return c.Chunks[i], nil
+	}
+	if c.ChunkSource == nil {
+		return nil, errors.New("chunked object has no chunks or chunk source")
+	}
+	return c.ChunkSource(i)
+}
+
+// WriteBody writes the object's body, whether it's chunked or not, to w. It returns the number of bytes written, and any error.
+func (c *CacheObj) WriteBody(w io.Writer) (uint64, error) {
+	if !c.Chunked {
+		n, err := w.Write(c.Body)
+		return uint64(n), err
+	}
+	written := uint64(0)
+	for i := 0; i < c.NumChunks(); i++ {
+		chunk, err := c.Chunk(i)
+		if err != nil {
+			return written, errors.New("reading chunk " + strconv.Itoa(i) + ": " + err.Error())
+		}
+		n, err := w.Write(chunk)
+		written += uint64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadBody returns the object's whole body, whether it's chunked or not. This copies a chunked body into memory, and should only be used when the whole body is required, such as by plugins which modify it.
+func (c *CacheObj) ReadBody() ([]byte, error) {
+	if !c.Chunked {
+		return c.Body, nil
+	}
+	body := make([]byte, 0, c.Size)
+	for i := 0; i < c.NumChunks(); i++ {
+		chunk, err := c.Chunk(i)
+		if err != nil {
+			return nil, errors.New("reading chunk " + strconv.Itoa(i) + ": " + err.Error())
+		}
+		body = append(body, chunk...)
+	}
+	return body, nil
 }
 
 func New(reqHeader http.Header, bytes []byte, code int, originCode int, proxyURL string, respHeader http.Header, reqTime time.Time, reqRespTime time.Time, respRespTime time.Time, lastModified time.Time) *CacheObj {
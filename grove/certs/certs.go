@@ -0,0 +1,386 @@
+package certs
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// certs holds the TLS certificates served by Grove, which may be reloaded without restarting the service or dropping connections.
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/crypto/ocsp"
+)
+
+// WatchDelay is how long after a certificate file changes to reload certificates. This lets the certificate and key both be written, before either is loaded.
+const WatchDelay = time.Second
+
+// OCSPTimeout is the timeout of requests to OCSP responders.
+const OCSPTimeout = 10 * time.Second
+
+// CertFile is a certificate and key file pair.
+type CertFile struct {
+	// Name is the name of the certificate, used in logs, e.g. the remap rule name.
+	Name     string
+	CertFile string
+	KeyFile  string
+}
+
+// Store is the TLS certificates served by Grove, looked up by the TLS Server Name Indication. It's safe for concurrent use, and certificates may be reloaded while serving, without dropping connections.
+type Store struct {
+	// set is the current *certSet. It's replaced, never modified, so handshakes never lock.
+	set atomic.Value
+	// loadM serializes loading certificates and swapping in stapled OCSP responses, which both replace the set. OCSP requests are made without it.
+	loadM   sync.Mutex
+	watcher *fsnotify.Watcher
+	// reload is signalled when a watched file changes.
+	reload chan struct{}
+	die    chan struct{}
+	// ocspInterval is how often OCSP responses are refreshed. If 0, OCSP responses aren't stapled.
+	ocspInterval time.Duration
+	ocspClient   *http.Client
+}
+
+// certSet is the certificates of a Store. It must not be modified after it's stored.
+type certSet struct {
+	files       []CertFile
+	defaultFile CertFile
+	// byFile is the certificates of each file, so a certificate which fails to reload keeps being served.
+	byFile map[CertFile]*tls.Certificate
+	// byName is the lowercase names of certificates, which may be wildcards like "*.example.net".
+	byName map[string]*tls.Certificate
+	dflt   *tls.Certificate
+}
+
+// New returns a new Store, with no certificates. If ocspInterval isn't 0, OCSP responses are requested for certificates with OCSP servers, stapled to handshakes, and refreshed every ocspInterval.
+func New(ocspInterval time.Duration) *Store {
+	s := &Store{
+		reload:       make(chan struct{}, 1),
+		die:          make(chan struct{}),
+		ocspInterval: ocspInterval,
+		ocspClient:   &http.Client{Timeout: OCSPTimeout},
+	}
+	s.set.Store(&certSet{byFile: map[CertFile]*tls.Certificate{}, byName: map[string]*tls.Certificate{}})
+	return s
+}
+
+// Load loads the given certificates, and the default certificate served to clients whose Server Name matches no certificate, replacing the existing certificates.
+// If a certificate fails to load, the error is logged, and the certificate previously loaded from the same files, if any, continues to be served. An error is only returned if there is no default certificate.
+func (s *Store) Load(files []CertFile, defaultFile CertFile) error {
+	s.loadM.Lock()
+	defer s.loadM.Unlock()
+	old := s.set.Load().(*certSet)
+
+	set := &certSet{
+		files:       files,
+		defaultFile: defaultFile,
+		byFile:      map[CertFile]*tls.Certificate{},
+		byName:      map[string]*tls.Certificate{},
+	}
+	for _, file := range append([]CertFile{defaultFile}, files...) {
+		if _, ok := set.byFile[file]; ok {
+			continue
+		}
+		cert, err := loadCert(file)
+		if err != nil {
+			oldCert, ok := old.byFile[file]
+			if !ok {
+				log.Errorln("loading certificate " + file.Name + ", not serving it: " + err.Error())
+				continue
+			}
+			log.Errorln("loading certificate " + file.Name + ", serving the previously loaded certificate: " + err.Error())
+			cert = oldCert
+		} else if oldCert, ok := old.byFile[file]; ok && sameCert(cert, oldCert) {
+			cert = oldCert // keep the stapled OCSP response
+		}
+		set.byFile[file] = cert
+	}
+
+	set.dflt = set.byFile[defaultFile]
+	if set.dflt == nil {
+		return errors.New("loading default certificate " + defaultFile.CertFile + " failed")
+	}
+	for _, file := range files {
+		cert, ok := set.byFile[file]
+		if !ok {
+			continue
+		}
+		for _, name := range certNames(cert.Leaf) {
+			set.byName[name] = cert
+		}
+	}
+	s.set.Store(set)
+	s.watch(set)
+	if s.ocspInterval != 0 {
+		go s.StapleOCSP()
+	}
+	return nil
+}
+
+// GetCertificate returns the certificate for the given TLS Client Hello. It returns the certificate matching the Server Name, or a wildcard certificate matching it, or else the default certificate. This is intended to be used as the tls.Config GetCertificate.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := s.set.Load().(*certSet)
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := set.byName[name]; ok {
+		return cert, nil
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		if cert, ok := set.byName["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	if set.dflt == nil {
+		return nil, errors.New("no certificate for server name '" + hello.ServerName + "'")
+	}
+	return set.dflt, nil
+}
+
+// Watch starts watching the certificate files, and reloads them when they change, until Close is called. New files given to Load are also watched.
+func (s *Store) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.New("creating watcher: " + err.Error())
+	}
+	s.loadM.Lock()
+	s.watcher = watcher
+	s.watch(s.set.Load().(*certSet))
+	s.loadM.Unlock()
+
+	go func() {
+		defer watcher.Close()
+		timer := (<-chan time.Time)(nil)
+		for {
+			select {
+			case event := <-watcher.Events:
+				if !s.watched(event.Name) {
+					continue
+				}
+				log.Debugf("certificate file %v changed: %v\n", event.Name, event.Op)
+				timer = time.After(WatchDelay)
+			case err := <-watcher.Errors:
+				log.Errorln("watching certificate files: " + err.Error())
+			case <-timer:
+				timer = nil
+				set := s.set.Load().(*certSet)
+				if err := s.Load(set.files, set.defaultFile); err != nil {
+					log.Errorln("reloading changed certificates: " + err.Error())
+					continue
+				}
+				log.Infoln("reloaded changed certificates")
+			case <-s.die:
+				return
+			}
+		}
+	}()
+
+	if s.ocspInterval != 0 {
+		go func() {
+			ticker := time.NewTicker(s.ocspInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					s.StapleOCSP()
+				case <-s.die:
+					return
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// Close stops watching the certificate files and refreshing OCSP responses. Certificates continue to be served.
+func (s *Store) Close() {
+	close(s.die)
+}
+
+// watch adds the directories of the given certificates to the watcher, if the Store is watching. Directories are watched rather than files, so files replaced by renaming are still watched. It must be called with loadM held.
+func (s *Store) watch(set *certSet) {
+	if s.watcher == nil {
+		return
+	}
+	dirs := map[string]struct{}{}
+	for file := range set.byFile {
+		dirs[filepath.Dir(file.CertFile)] = struct{}{}
+		dirs[filepath.Dir(file.KeyFile)] = struct{}{}
+	}
+	for dir := range dirs {
+		if err := s.watcher.Add(dir); err != nil {
+			log.Errorln("watching certificate directory " + dir + ": " + err.Error())
+		}
+	}
+}
+
+// watched returns whether the given path is one of the loaded certificate or key files.
+func (s *Store) watched(path string) bool {
+	path = filepath.Clean(path)
+	set := s.set.Load().(*certSet)
+	for file := range set.byFile {
+		if filepath.Clean(file.CertFile) == path || filepath.Clean(file.KeyFile) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// StapleOCSP requests OCSP responses for all certificates with OCSP servers, and staples good responses to their handshakes. Certificates whose OCSP requests fail keep their previous response, until it expires.
+// The OCSP requests are made without holding loadM, so certificates may be loaded meanwhile. Responses are only stapled to certificates still being served.
+func (s *Store) StapleOCSP() {
+	requested := s.set.Load().(*certSet)
+	staples := map[*tls.Certificate][]byte{}
+	for file, cert := range requested.byFile {
+		if _, ok := staples[cert]; ok {
+			continue
+		}
+		staple, err := s.requestOCSP(cert)
+		if err != nil {
+			log.Warnln("requesting certificate " + file.Name + " OCSP response: " + err.Error())
+			staple = cert.OCSPStaple
+			if resp, err := ocsp.ParseResponse(staple, nil); err == nil && !resp.NextUpdate.IsZero() && time.Now().After(resp.NextUpdate) {
+				staple = nil // don't staple expired responses
+			}
+		}
+		staples[cert] = staple
+	}
+
+	s.loadM.Lock()
+	defer s.loadM.Unlock()
+	old := s.set.Load().(*certSet)
+
+	stapled := map[*tls.Certificate]*tls.Certificate{}
+	staple := func(cert *tls.Certificate) *tls.Certificate {
+		if cert == nil {
+			return nil
+		}
+		if newCert, ok := stapled[cert]; ok {
+			return newCert
+		}
+		newCert := cert
+		if resp, ok := staples[cert]; ok && !bytes.Equal(resp, cert.OCSPStaple) {
+			newCert = new(tls.Certificate)
+			*newCert = *cert
+			newCert.OCSPStaple = resp
+		}
+		stapled[cert] = newCert
+		return newCert
+	}
+
+	set := &certSet{
+		files:       old.files,
+		defaultFile: old.defaultFile,
+		byFile:      map[CertFile]*tls.Certificate{},
+		byName:      map[string]*tls.Certificate{},
+		dflt:        staple(old.dflt),
+	}
+	for file, cert := range old.byFile {
+		set.byFile[file] = staple(cert)
+	}
+	for name, cert := range old.byName {
+		set.byName[name] = staple(cert)
+	}
+	s.set.Store(set)
+}
+
+// requestOCSP returns the OCSP response for the given certificate, or nil if it has no OCSP server or issuer. It returns an error if the request fails, or the certificate isn't good.
+func (s *Store) requestOCSP(cert *tls.Certificate) ([]byte, error) {
+	if len(cert.Leaf.OCSPServer) == 0 || len(cert.Certificate) < 2 {
+		return nil, nil
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, errors.New("parsing issuer: " + err.Error())
+	}
+	req, err := ocsp.CreateRequest(cert.Leaf, issuer, nil)
+	if err != nil {
+		return nil, errors.New("creating request: " + err.Error())
+	}
+	resp, err := s.ocspClient.Post(cert.Leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, errors.New("requesting " + cert.Leaf.OCSPServer[0] + ": " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("requesting " + cert.Leaf.OCSPServer[0] + ": response code " + resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.New("reading response: " + err.Error())
+	}
+	ocspResp, err := ocsp.ParseResponseForCert(body, cert.Leaf, issuer)
+	if err != nil {
+		return nil, errors.New("parsing response: " + err.Error())
+	}
+	if ocspResp.Status != ocsp.Good {
+		return nil, errors.New("certificate status is not good")
+	}
+	return body, nil
+}
+
+// loadCert loads the given certificate files, with the parsed leaf certificate.
+func loadCert(file CertFile) (*tls.Certificate, error) {
+	if file.CertFile == "" {
+		return nil, errors.New("has a key but no certificate")
+	}
+	if file.KeyFile == "" {
+		return nil, errors.New("has a certificate but no key")
+	}
+	cert, err := tls.LoadX509KeyPair(file.CertFile, file.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, errors.New("parsing certificate: " + err.Error())
+	}
+	return &cert, nil
+}
+
+// sameCert returns whether the given certificates are the same certificate chain.
+func sameCert(a *tls.Certificate, b *tls.Certificate) bool {
+	if len(a.Certificate) != len(b.Certificate) {
+		return false
+	}
+	for i := range a.Certificate {
+		if !bytes.Equal(a.Certificate[i], b.Certificate[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// certNames returns the lowercase names the given certificate is valid for. These are its DNS Subject Alternative Names, or its Common Name if it has none.
+func certNames(leaf *x509.Certificate) []string {
+	names := leaf.DNSNames
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = []string{leaf.Subject.CommonName}
+	}
+	lowerNames := make([]string, 0, len(names))
+	for _, name := range names {
+		lowerNames = append(lowerNames, strings.ToLower(name))
+	}
+	return lowerNames
+}
@@ -0,0 +1,326 @@
+package certs
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	der  []byte
+	key  crypto.Signer
+}
+
+// makeTestCert creates a certificate for the given names, signed by the given issuer, or self-signed if issuer is nil.
+func makeTestCert(t *testing.T, serial int64, names []string, issuer *testCert, ocspServer string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if ocspServer != "" {
+		tmpl.OCSPServer = []string{ocspServer}
+	}
+	parent, parentKey := tmpl, crypto.Signer(key)
+	if issuer == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		parent, parentKey = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, der: der, key: key}
+}
+
+// writeTestCert writes the certificate, followed by the chain, and its key, to the given files.
+func writeTestCert(t *testing.T, c *testCert, chain []*testCert, file CertFile) {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+	for _, chainCert := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chainCert.der})...)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(c.key.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file.CertFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func makeTestCertFile(dir string, name string) CertFile {
+	return CertFile{Name: name, CertFile: filepath.Join(dir, name+".crt"), KeyFile: filepath.Join(dir, name+".key")}
+}
+
+func getCertSerial(t *testing.T, s *Store, serverName string) int64 {
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatalf("GetCertificate '%v' expected nil error, actual %v", serverName, err)
+	}
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestStoreSNI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grove-certs-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defaultFile := makeTestCertFile(dir, "default")
+	exactFile := makeTestCertFile(dir, "exact")
+	wildFile := makeTestCertFile(dir, "wild")
+	writeTestCert(t, makeTestCert(t, 1, []string{"default.example.net"}, nil, ""), nil, defaultFile)
+	writeTestCert(t, makeTestCert(t, 2, []string{"ds.example.net"}, nil, ""), nil, exactFile)
+	writeTestCert(t, makeTestCert(t, 3, []string{"*.wild.example.net"}, nil, ""), nil, wildFile)
+
+	s := New(0)
+	if err := s.Load([]CertFile{exactFile, wildFile}, defaultFile); err != nil {
+		t.Fatalf("Load expected nil error, actual %v", err)
+	}
+
+	for name, expected := range map[string]int64{
+		"ds.example.net":       2,
+		"DS.example.net.":      2,
+		"foo.wild.example.net": 3,
+		"wild.example.net":     1,
+		"other.example.net":    1,
+		"":                     1,
+	} {
+		if actual := getCertSerial(t, s, name); actual != expected {
+			t.Errorf("GetCertificate '%v' expected certificate %v, actual %v", name, expected, actual)
+		}
+	}
+
+	// a certificate which fails to reload keeps serving the old certificate
+	if err := ioutil.WriteFile(exactFile.CertFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load([]CertFile{exactFile, wildFile}, defaultFile); err != nil {
+		t.Fatalf("Load with bad certificate expected nil error, actual %v", err)
+	}
+	if actual := getCertSerial(t, s, "ds.example.net"); actual != 2 {
+		t.Errorf("GetCertificate after failed reload expected old certificate 2, actual %v", actual)
+	}
+
+	if err := s.Load(nil, makeTestCertFile(dir, "nonexistent")); err == nil {
+		t.Errorf("Load with missing default certificate expected error, actual nil")
+	}
+}
+
+func TestStoreWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grove-certs-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defaultFile := makeTestCertFile(dir, "default")
+	dsFile := makeTestCertFile(dir, "ds")
+	writeTestCert(t, makeTestCert(t, 1, []string{"default.example.net"}, nil, ""), nil, defaultFile)
+	writeTestCert(t, makeTestCert(t, 2, []string{"ds.example.net"}, nil, ""), nil, dsFile)
+
+	s := New(0)
+	if err := s.Load([]CertFile{dsFile}, defaultFile); err != nil {
+		t.Fatalf("Load expected nil error, actual %v", err)
+	}
+	if err := s.Watch(); err != nil {
+		t.Fatalf("Watch expected nil error, actual %v", err)
+	}
+	defer s.Close()
+
+	writeTestCert(t, makeTestCert(t, 4, []string{"ds.example.net"}, nil, ""), nil, dsFile)
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if getCertSerial(t, s, "ds.example.net") == 4 {
+			return
+		}
+	}
+	t.Errorf("GetCertificate after renewing certificate file expected new certificate 4, actual %v", getCertSerial(t, s, "ds.example.net"))
+}
+
+func TestStoreStapleOCSP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grove-certs-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := (*testCert)(nil)
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now(),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}, ca.key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(resp)
+	}))
+	defer responder.Close()
+
+	ca = makeTestCert(t, 1, []string{"ca.example.net"}, nil, "")
+	defaultFile := makeTestCertFile(dir, "default")
+	writeTestCert(t, makeTestCert(t, 2, []string{"default.example.net"}, ca, responder.URL), []*testCert{ca}, defaultFile)
+
+	s := New(time.Hour)
+	if err := s.Load(nil, defaultFile); err != nil {
+		t.Fatalf("Load expected nil error, actual %v", err)
+	}
+	s.StapleOCSP()
+
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: "default.example.net"})
+	if err != nil {
+		t.Fatalf("GetCertificate expected nil error, actual %v", err)
+	}
+	if len(cert.OCSPStaple) == 0 {
+		t.Fatalf("GetCertificate after StapleOCSP expected stapled OCSP response, actual none")
+	}
+	resp, err := ocsp.ParseResponseForCert(cert.OCSPStaple, cert.Leaf, ca.cert)
+	if err != nil {
+		t.Fatalf("parsing stapled OCSP response expected nil error, actual %v", err)
+	}
+	if resp.Status != ocsp.Good {
+		t.Errorf("stapled OCSP response expected status good, actual %v", resp.Status)
+	}
+}
+
+func TestStoreStapleOCSPDoesNotBlockLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grove-certs-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := (*testCert)(nil)
+	requested := make(chan struct{}, 1)
+	release := make(chan struct{})
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requested <- struct{}{}
+		<-release
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now(),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}, ca.key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(resp)
+	}))
+	defer responder.Close()
+
+	ca = makeTestCert(t, 1, []string{"ca.example.net"}, nil, "")
+	defaultFile := makeTestCertFile(dir, "default")
+	writeTestCert(t, makeTestCert(t, 2, []string{"default.example.net"}, ca, responder.URL), []*testCert{ca}, defaultFile)
+
+	s := New(0) // staple manually, not on Load
+	if err := s.Load(nil, defaultFile); err != nil {
+		t.Fatalf("Load expected nil error, actual %v", err)
+	}
+
+	stapleDone := make(chan struct{})
+	go func() {
+		s.StapleOCSP()
+		close(stapleDone)
+	}()
+	<-requested
+
+	fooFile := makeTestCertFile(dir, "foo")
+	writeTestCert(t, makeTestCert(t, 3, []string{"foo.example.net"}, ca, ""), []*testCert{ca}, fooFile)
+	loadDone := make(chan error, 1)
+	go func() { loadDone <- s.Load([]CertFile{fooFile}, defaultFile) }()
+	select {
+	case err := <-loadDone:
+		if err != nil {
+			t.Fatalf("Load expected nil error, actual %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatalf("Load during OCSP request expected not to block")
+	}
+
+	close(release)
+	<-stapleDone
+
+	if serial := getCertSerial(t, s, "foo.example.net"); serial != 3 {
+		t.Errorf("GetCertificate after StapleOCSP expected certificate loaded during OCSP request serial 3, actual %v", serial)
+	}
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: "default.example.net"})
+	if err != nil {
+		t.Fatalf("GetCertificate expected nil error, actual %v", err)
+	}
+	if len(cert.OCSPStaple) == 0 {
+		t.Errorf("GetCertificate after StapleOCSP expected stapled OCSP response on certificate kept by Load, actual none")
+	}
+}
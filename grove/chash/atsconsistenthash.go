@@ -44,6 +44,8 @@ type ATSConsistentHash interface {
 	Lookup(name string) (OrderedMapUint64NodeIterator, bool, error)
 	LookupHash(hashVal uint64) (OrderedMapUint64NodeIterator, bool)
 	LookupIter(OrderedMapUint64NodeIterator) (OrderedMapUint64NodeIterator, bool)
+	// LookupDistinct calls visit with each distinct node, in the order ATS parent selection tries them, starting with the node for the given name, until visit returns false.
+	LookupDistinct(name string, visit func(node *ATSConsistentHashNode) bool) error
 	First() OrderedMapUint64NodeIterator // debug
 }
 
@@ -52,6 +54,8 @@ const DefaultSimpleATSConsistentHashReplicas = 1024
 type SimpleATSConsistentHash struct {
 	Replicas int
 	NodeMap  OrderedMapUint64Node
+	// nodes is the set of distinct nodes inserted, so LookupDistinct can stop once it has visited them all, rather than iterating every replica in the ring.
+	nodes map[*ATSConsistentHashNode]struct{}
 }
 
 func NewSimpleATSConsistentHash(replicas int) ATSConsistentHash {
@@ -85,6 +89,12 @@ func (h *SimpleATSConsistentHash) Insert(node *ATSConsistentHashNode, weight flo
 		vals[i] = node
 	}
 	err := h.NodeMap.InsertBulk(keys, vals)
+	if err == nil && numInserts > 0 {
+		if h.nodes == nil {
+			h.nodes = map[*ATSConsistentHashNode]struct{}{}
+		}
+		h.nodes[node] = struct{}{}
+	}
 	return err
 }
 
@@ -142,3 +152,28 @@ func (h *SimpleATSConsistentHash) LookupHash(hashVal uint64) (OrderedMapUint64No
 	}
 	return iter, wrapped
 }
+
+// LookupDistinct calls visit with each distinct node, in ring order starting with the node for the given name, until visit returns false or every node has been visited. This is the order ATS parent selection tries parents, skipping replicas of parents already tried.
+// It stops as soon as every distinct node has been visited, so when every parent is down, it doesn't iterate the rest of the ring's replicas.
+func (h *SimpleATSConsistentHash) LookupDistinct(name string, visit func(node *ATSConsistentHashNode) bool) error {
+	iter, _, err := h.Lookup(name)
+	if err != nil {
+		return err
+	}
+	visited := map[*ATSConsistentHashNode]struct{}{}
+	start := iter.Index()
+	for {
+		if _, ok := visited[iter.Val()]; !ok {
+			visited[iter.Val()] = struct{}{}
+			if !visit(iter.Val()) {
+				return nil
+			}
+			if h.nodes != nil && len(visited) >= len(h.nodes) {
+				return nil
+			}
+		}
+		if iter = iter.NextWrap(); iter.Index() == start {
+			return nil
+		}
+	}
+}
@@ -89,3 +89,63 @@ func TestSimpleATSConsistentHashLookup(t *testing.T) {
 	}
 
 }
+
+func TestSimpleATSConsistentHashLookupDistinct(t *testing.T) {
+	names := []string{"foo", "bar", "baz"}
+	h := NewSimpleATSConsistentHash(10)
+	for _, name := range names {
+		h.Insert(&ATSConsistentHashNode{Name: name}, 1.0)
+	}
+
+	i, _, err := h.Lookup("lookupasdf")
+	if err != nil {
+		t.Fatalf("ATSConsistentHash.Lookup expected nil error, actual %v", err)
+	}
+
+	visited := []string{}
+	err = h.LookupDistinct("lookupasdf", func(node *ATSConsistentHashNode) bool {
+		visited = append(visited, node.Name)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("ATSConsistentHash.LookupDistinct expected nil error, actual %v", err)
+	}
+	if len(visited) != len(names) {
+		t.Fatalf("ATSConsistentHash.LookupDistinct expected %v distinct nodes, actual %+v", len(names), visited)
+	}
+	if visited[0] != i.Val().Name {
+		t.Errorf("ATSConsistentHash.LookupDistinct expected first node %v actual %v", i.Val().Name, visited[0])
+	}
+
+	visited = []string{}
+	h.LookupDistinct("lookupasdf", func(node *ATSConsistentHashNode) bool {
+		visited = append(visited, node.Name)
+		return len(visited) < 2
+	})
+	if len(visited) != 2 {
+		t.Errorf("ATSConsistentHash.LookupDistinct expected to stop after 2 nodes, actual %+v", visited)
+	}
+}
+
+func TestSimpleATSConsistentHashLookupDistinctStopsWhenCovered(t *testing.T) {
+	names := []string{"foo", "bar", "baz"}
+	h := NewSimpleATSConsistentHash(1000)
+	for _, name := range names {
+		h.Insert(&ATSConsistentHashNode{Name: name}, 1.0)
+	}
+
+	visits := 0
+	err := h.LookupDistinct("lookupasdf", func(node *ATSConsistentHashNode) bool {
+		visits++
+		return true
+	})
+	if err != nil {
+		t.Fatalf("ATSConsistentHash.LookupDistinct expected nil error, actual %v", err)
+	}
+	if visits != len(names) {
+		t.Errorf("ATSConsistentHash.LookupDistinct expected %v visits, actual %v", len(names), visits)
+	}
+	if covered := h.(*SimpleATSConsistentHash).nodes; len(covered) != len(names) {
+		t.Errorf("ATSConsistentHash expected %v distinct nodes, actual %v", len(names), len(covered))
+	}
+}
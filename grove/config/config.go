@@ -35,10 +35,17 @@ type Config struct {
 	CacheSizeBytes int    `json:"cache_size_bytes"`
 	RemapRulesFile string `json:"remap_rules_file"`
 	// ConcurrentRuleRequests is the number of concurrent requests permitted to a remap rule, that is, to an origin. Note this is overridden by any per-rule settings in the remap rules.
-	ConcurrentRuleRequests int    `json:"concurrent_rule_requests"`
-	CertFile               string `json:"cert_file"`
-	KeyFile                string `json:"key_file"`
-	InterfaceName          string `json:"interface_name"`
+	ConcurrentRuleRequests int `json:"concurrent_rule_requests"`
+	// CertFile and KeyFile are the default certificate, served to HTTPS clients whose Server Name Indication matches no remap rule certificate.
+	CertFile      string `json:"cert_file"`
+	KeyFile       string `json:"key_file"`
+	InterfaceName string `json:"interface_name"`
+	// DisableCertWatch disables watching certificate files, and reloading them when they change. Certificates are still reloaded with the config. Note this can't be changed by a config reload.
+	DisableCertWatch bool `json:"disable_cert_watch"`
+	// DisableOCSPStapling disables requesting OCSP responses for certificates from their OCSP servers, and stapling them to TLS handshakes. Note this can't be changed by a config reload.
+	DisableOCSPStapling bool `json:"disable_ocsp_stapling"`
+	// OCSPRefreshIntervalMS is how often OCSP responses are requested, to keep stapled responses fresh. Note this can't be changed by a config reload.
+	OCSPRefreshIntervalMS int `json:"ocsp_refresh_interval_ms"`
 	// ConnectionClose determines whether to send a `Connection: close` header. This is primarily designed for maintenance, to drain the cache of incoming requestors. This overrides rule-specific `connection-close: false` configuration, under the assumption that draining a cache is a temporary maintenance operation, and if connectionClose is true on the service and false on some rules, those rules' configuration is probably a permament setting whereas the operator probably wants to drain all connections if the global setting is true. If it's necessary to leave connection close false on some rules, set all other rules' connectionClose to true and leave the global connectionClose unset.
 	ConnectionClose bool `json:"connection_close"`
 
@@ -61,6 +68,53 @@ type Config struct {
 	CacheFiles           map[string][]CacheFile `json:"cache_files"`
 	// FileMemBytes is the amount of memory to use as an LRU in front of each name in CacheFiles, that is, each named group of files. E.g. if there are 10 files, the amount of memory used will be 10*FileMemBytes+CacheSizeBytes.
 	FileMemBytes int `json:"file_mem_bytes"`
+	// RevalidateFile is the file revalidation rules added via the http_revalidate plugin are persisted to, so they still apply to cached objects after a restart. If empty, added rules are only kept in memory. Note this can't be changed by a config reload.
+	RevalidateFile string `json:"revalidate_file"`
+	// RevalidateToken is the bearer token required by the http_revalidate plugin endpoint. If empty, the endpoint refuses all requests.
+	RevalidateToken string `json:"revalidate_token"`
+	// AccessLogs are the access logs every response is written to, in addition to the event log. Access logs whose config didn't change keep their buffers and connections across config reloads.
+	AccessLogs []AccessLog `json:"access_logs"`
+}
+
+// AccessLog is the config of an access log, which formats every response and writes it to a sink asynchronously.
+type AccessLog struct {
+	// Name identifies the access log in stats. If empty, the log's index is used.
+	Name string `json:"name"`
+	// Format is the format of each line: "ats" for an ATS custom log format, "json" for JSON lines, or "csv".
+	Format string `json:"format"`
+	// ATSFormat is the ATS custom log format of the "ats" format, with fields such as `%<chi>`. If empty, the format of the ats_log plugin is used.
+	ATSFormat string `json:"ats_format"`
+	// Fields are the fields of the "json" and "csv" formats, in order. If empty, all fields are logged.
+	Fields []string `json:"fields"`
+	// Sink is where lines are written: "file", "syslog", or "http".
+	Sink string `json:"sink"`
+	// BufferSize is the number of lines buffered for the sink. Lines logged while the buffer is full are dropped, so logging never blocks requests.
+	BufferSize int `json:"buffer_size"`
+
+	// FilePath is the file of the "file" sink.
+	FilePath string `json:"file_path"`
+	// FileMaxSizeBytes is the size at which the file is rotated. If 0, the file is never rotated.
+	FileMaxSizeBytes int64 `json:"file_max_size_bytes"`
+	// FileMaxBackups is the number of rotated files kept, named FilePath.1 through FilePath.N. If 0, rotated files are removed.
+	FileMaxBackups int `json:"file_max_backups"`
+
+	// SyslogNetwork is the network of the "syslog" sink, "udp" or "tcp".
+	SyslogNetwork string `json:"syslog_network"`
+	// SyslogAddress is the host:port of the "syslog" sink.
+	SyslogAddress string `json:"syslog_address"`
+	// SyslogFacility is the syslog facility of messages, such as "local0", which is the default.
+	SyslogFacility string `json:"syslog_facility"`
+	// SyslogTag is the APP-NAME of messages. The default is "grove".
+	SyslogTag string `json:"syslog_tag"`
+
+	// HTTPURL is the URL the "http" sink POSTs batches of lines to, separated by newlines.
+	HTTPURL string `json:"http_url"`
+	// HTTPBatchSize is the maximum number of lines POSTed at once.
+	HTTPBatchSize int `json:"http_batch_size"`
+	// HTTPBatchIntervalMS is the longest lines are held before being POSTed, if fewer than HTTPBatchSize lines are buffered.
+	HTTPBatchIntervalMS int `json:"http_batch_interval_ms"`
+	// HTTPTimeoutMS is the timeout of each POST.
+	HTTPTimeoutMS int `json:"http_timeout_ms"`
 }
 
 type CacheFile struct {
@@ -109,6 +163,7 @@ var DefaultConfig = Config{
 	ServerWriteTimeoutMS:   3 * MSPerSec,
 	ServerReadTimeoutMS:    3 * MSPerSec,
 	FileMemBytes:           bytesPerMebibyte * 100,
+	OCSPRefreshIntervalMS:  60 * 60 * MSPerSec,
 }
 
 // LoadConfig loads the given config file. If an empty string is passed, the default config is returned.
@@ -18,6 +18,8 @@ import (
 	"bytes"
 	"encoding/gob"
 	"errors"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -38,6 +40,12 @@ type DiskCache struct {
 
 const BucketName = "b"
 
+// ChunkBucketName is the bucket the chunks of chunked objects are stored in, separately from the objects, so chunks can be written as they're received, and read one at a time.
+const ChunkBucketName = "c"
+
+// chunkKeySep separates the object key, chunk ID, and chunk index in chunk keys. It can't occur in a URL.
+const chunkKeySep = "\x00"
+
 func New(path string, cacheSizeBytes uint64) (*DiskCache, error) {
 	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
@@ -48,6 +56,9 @@ func New(path string, cacheSizeBytes uint64) (*DiskCache, error) {
 		if _, err := tx.CreateBucketIfNotExists([]byte(BucketName)); err != nil {
 			return errors.New("creating bucket: " + err.Error())
 		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(ChunkBucketName)); err != nil {
+			return errors.New("creating chunk bucket: " + err.Error())
+		}
 		return nil
 	})
 	if err != nil {
@@ -57,38 +68,144 @@ func New(path string, cacheSizeBytes uint64) (*DiskCache, error) {
 	return &DiskCache{db: db, maxSizeBytes: cacheSizeBytes, lru: lru.NewLRU(), sizeBytes: 0}, nil
 }
 
+// chunkKey returns the key of chunk i of the object with the given key and chunkID.
+func chunkKey(key string, chunkID string, i int) []byte {
+	return []byte(key + chunkKeySep + chunkID + chunkKeySep + strconv.Itoa(i))
+}
+
 // ResetAfterRestart rebuilds the LRU with an arbirtrary order and sets sizeBytes. This seems crazy, but it is better than doing nothing, sice gc is based on the LRU and sizeBytes. In the future, we may want to periodically sync the LRU to disk, but we'll still need to iterate over all keys in the disk DB to avoid orphaning objects.
+// It also removes the chunks of objects which were never completed, for example because Grove was stopped mid-transfer.
 // Note: this assumes the LRU is empty. Don't run twice
 func (c *DiskCache) ResetAfterRestart() {
-	go c.db.View(func(tx *bolt.Tx) error {
-		log.Infof("Starting cache recovery from disk for: %s... ", c.db.Path())
-		size := 0
-		b := tx.Bucket([]byte(BucketName))
+	go func() {
+		c.db.View(func(tx *bolt.Tx) error {
+			log.Infof("Starting cache recovery from disk for: %s... ", c.db.Path())
+			size := uint64(0)
+			b := tx.Bucket([]byte(BucketName))
 
-		cursor := b.Cursor()
+			cursor := b.Cursor()
 
-		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
-			c.lru.Add(string(k), uint64(len(v)))
-			size += len(v)
-		}
+			for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+				objSize := storedSize(v)
+				c.lru.Add(string(k), objSize)
+				size += objSize
+			}
 
-		atomic.AddUint64(&c.sizeBytes, uint64(size))
-		log.Infof("Cache recovery from disk for %s done (%d bytes). ", c.db.Path(), c.sizeBytes)
+			atomic.AddUint64(&c.sizeBytes, size)
+			log.Infof("Cache recovery from disk for %s done (%d bytes). ", c.db.Path(), c.sizeBytes)
+			return nil
+		})
+		c.removeOrphanChunks()
+	}()
+}
+
+// storedSize returns the size on disk of the given encoded object, including its chunks.
+func storedSize(valBytes []byte) uint64 {
+	size := uint64(len(valBytes))
+	val, err := decode(valBytes)
+	if err != nil {
+		return size
+	}
+	if val.Chunked {
+		size += val.Size
+	}
+	return size
+}
+
+// removeOrphanChunks removes all chunks which don't belong to a stored object.
+func (c *DiskCache) removeOrphanChunks() {
+	orphans := [][]byte{}
+	c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		chunkIDs := map[string]string{} // the chunk ID of each object key seen, so each object is only decoded once
+		cursor := tx.Bucket([]byte(ChunkBucketName)).Cursor()
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+			parts := strings.Split(string(k), chunkKeySep)
+			if len(parts) != 3 {
+				orphans = append(orphans, append([]byte(nil), k...))
+				continue
+			}
+			key, chunkID := parts[0], parts[1]
+			objChunkID, ok := chunkIDs[key]
+			if !ok {
+				if val, err := decode(b.Get([]byte(key))); err == nil {
+					objChunkID = val.ChunkID
+				}
+				chunkIDs[key] = objChunkID
+			}
+			if chunkID != objChunkID {
+				orphans = append(orphans, append([]byte(nil), k...))
+			}
+		}
 		return nil
 	})
+	if len(orphans) == 0 {
+		return
+	}
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		cb := tx.Bucket([]byte(ChunkBucketName))
+		for _, k := range orphans {
+			if err := cb.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorln("DiskCache removing orphaned chunks from " + c.db.Path() + ": " + err.Error())
+		return
+	}
+	log.Infof("DiskCache removed %d orphaned chunks from %s\n", len(orphans), c.db.Path())
+}
+
+func decode(valBytes []byte) (*cacheobj.CacheObj, error) {
+	if valBytes == nil {
+		return nil, errors.New("no object")
+	}
+	val := cacheobj.CacheObj{}
+	if err := gob.NewDecoder(bytes.NewBuffer(valBytes)).Decode(&val); err != nil {
+		return nil, err
+	}
+	return &val, nil
+}
+
+// deleteChunks deletes the chunks of the given encoded object, if it's chunked, except the given chunkID's.
+func deleteChunks(cb *bolt.Bucket, key string, valBytes []byte, exceptChunkID string) error {
+	if valBytes == nil {
+		return nil
+	}
+	val, err := decode(valBytes)
+	if err != nil {
+		log.Errorln("DiskCache decoding '" + key + "' to delete its chunks: " + err.Error())
+		return nil // the chunks will be removed as orphans on restart
+	}
+	if !val.Chunked || val.ChunkID == exceptChunkID {
+		return nil
+	}
+	for i := 0; i < val.NumChunks(); i++ {
+		if err := cb.Delete(chunkKey(key, val.ChunkID, i)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Add takes a key and value to add. Returns whether an eviction occurred
 // The size is taken to fulfill the Cache interface, but the DiskCache doesn't use it.
 // Instead, we compute size from the serialized bytes stored to disk.
 //
+// If the value is chunked and its chunks are in memory, they're stored separately from it. If its chunks aren't in memory, they must already have been written with AddChunk.
+//
 // Note DiskCache.Add does garbage collection in a goroutine, and thus it is not possible to determine eviction without impacting performance. This always returns false.
 func (c *DiskCache) Add(key string, val *cacheobj.CacheObj) bool {
 	log.Debugf("DiskCache Add CALLED key '%+v' size '%+v'\n", key, val.Size)
 	eviction := false
 
+	stored := *val
+	stored.Chunks = nil
+	stored.ChunkSource = nil
 	buf := bytes.Buffer{}
-	if err := gob.NewEncoder(&buf).Encode(val); err != nil {
+	if err := gob.NewEncoder(&buf).Encode(&stored); err != nil {
 		log.Errorln("DiskCache.Add encoding cache object: " + err.Error())
 		return eviction
 	}
@@ -96,9 +213,20 @@ func (c *DiskCache) Add(key string, val *cacheobj.CacheObj) bool {
 
 	err := c.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketName))
-		if b == nil {
+		cb := tx.Bucket([]byte(ChunkBucketName))
+		if b == nil || cb == nil {
 			return errors.New("bucket does not exist")
 		}
+		if err := deleteChunks(cb, key, b.Get([]byte(key)), val.ChunkID); err != nil {
+			return errors.New("deleting old chunks: " + err.Error())
+		}
+		if val.Chunked {
+			for i, chunk := range val.Chunks {
+				if err := cb.Put(chunkKey(key, val.ChunkID, i), chunk); err != nil {
+					return errors.New("inserting chunk " + strconv.Itoa(i) + ": " + err.Error())
+				}
+			}
+		}
 		return b.Put([]byte(key), valBytes)
 	})
 	if err != nil {
@@ -106,9 +234,13 @@ func (c *DiskCache) Add(key string, val *cacheobj.CacheObj) bool {
 		return eviction
 	}
 
-	c.lru.Add(key, uint64(len(valBytes)))
+	size := uint64(len(valBytes))
+	if val.Chunked {
+		size += val.Size
+	}
+	oldSize := c.lru.Add(key, size)
 
-	newSizeBytes := atomic.AddUint64(&c.sizeBytes, uint64(len(valBytes)))
+	newSizeBytes := atomic.AddUint64(&c.sizeBytes, size-oldSize)
 	if newSizeBytes > c.maxSizeBytes {
 		go c.gc(newSizeBytes)
 	}
@@ -117,6 +249,60 @@ func (c *DiskCache) Add(key string, val *cacheobj.CacheObj) bool {
 	return eviction
 }
 
+// AddChunk implements icache.ChunkWriter.
+func (c *DiskCache) AddChunk(key string, chunkID string, i int, chunk []byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		cb := tx.Bucket([]byte(ChunkBucketName))
+		if cb == nil {
+			return errors.New("chunk bucket does not exist")
+		}
+		return cb.Put(chunkKey(key, chunkID, i), chunk)
+	})
+}
+
+// AbortChunks implements icache.ChunkWriter.
+func (c *DiskCache) AbortChunks(key string, chunkID string, n int) {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		cb := tx.Bucket([]byte(ChunkBucketName))
+		if cb == nil {
+			return errors.New("chunk bucket does not exist")
+		}
+		for i := 0; i < n; i++ {
+			if err := cb.Delete(chunkKey(key, chunkID, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorln("DiskCache.AbortChunks removing chunks of '" + key + "': " + err.Error())
+	}
+}
+
+// ChunkSource implements icache.ChunkWriter.
+func (c *DiskCache) ChunkSource(key string, chunkID string) func(i int) ([]byte, error) {
+	return func(i int) ([]byte, error) {
+		chunk := []byte(nil)
+		err := c.db.View(func(tx *bolt.Tx) error {
+			cb := tx.Bucket([]byte(ChunkBucketName))
+			if cb == nil {
+				return errors.New("chunk bucket does not exist")
+			}
+			if v := cb.Get(chunkKey(key, chunkID, i)); v != nil {
+				chunk = append([]byte(nil), v...) // bolt values are only valid during the transaction
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if chunk == nil {
+			return nil, errors.New("chunk " + strconv.Itoa(i) + " of '" + key + "' not found") // the object was evicted or replaced while being read
+		}
+		return chunk, nil
+	}
+}
+
 // gc does garbage collection, deleting stored entries until the DiskCache's size is less than maxSizeBytes. This is threadsafe, and should be called in a goroutine to avoid blocking the caller.
 // The given cacheSizeBytes must be `c.Size()`; it's passed here, because gc should be called immediately after an insert updates the size, so it saves an atomic instruction to pass rather than calling Size() again.
 func (c *DiskCache) gc(cacheSizeBytes uint64) {
@@ -133,11 +319,13 @@ func (c *DiskCache) gc(cacheSizeBytes uint64) {
 		log.Debugf("DiskCache.gc deleting key '" + key + "'")
 		err := c.db.Update(func(tx *bolt.Tx) error {
 			b := tx.Bucket([]byte(BucketName))
-			if b == nil {
+			cb := tx.Bucket([]byte(ChunkBucketName))
+			if b == nil || cb == nil {
 				return errors.New("bucket does not exist")
 			}
-			b.Delete([]byte(key))
-
+			if err := deleteChunks(cb, key, b.Get([]byte(key)), ""); err != nil {
+				return errors.New("deleting chunks: " + err.Error())
+			}
 			return b.Delete([]byte(key))
 		})
 		if err != nil {
@@ -150,9 +338,9 @@ func (c *DiskCache) gc(cacheSizeBytes uint64) {
 
 // Get takes a key, and returns its value, and whether it was found, and updates the lru-ness and hitcount
 func (c *DiskCache) Get(key string) (*cacheobj.CacheObj, bool) {
-	val, found := c.Peek(key)
+	val, size, found := c.peek(key)
 	if found {
-		c.lru.Add(key, val.Size) // TODO directly call c.ll.MoveToFront
+		c.lru.Add(key, size) // TODO directly call c.ll.MoveToFront
 		log.Debugln("DiskCache.Get getting '" + key + "' from cache and updating LRU")
 		atomic.AddUint64(&val.HitCount, 1)
 		return val, true
@@ -163,6 +351,12 @@ func (c *DiskCache) Get(key string) (*cacheobj.CacheObj, bool) {
 
 // Peek takes a key, and returns its value, and whether it was found, without changing the lru-ness or hitcount
 func (c *DiskCache) Peek(key string) (*cacheobj.CacheObj, bool) {
+	val, _, found := c.peek(key)
+	return val, found
+}
+
+// peek returns the value of the given key, its size on disk, and whether it was found.
+func (c *DiskCache) peek(key string) (*cacheobj.CacheObj, uint64, bool) {
 	log.Debugln("DiskCache.Get key '" + key + "'")
 	valBytes := []byte(nil)
 
@@ -176,23 +370,28 @@ func (c *DiskCache) Peek(key string) (*cacheobj.CacheObj, bool) {
 	})
 	if err != nil {
 		log.Errorln("DiskCache.Peek getting '" + key + "' from cache: " + err.Error())
-		return nil, false
+		return nil, 0, false
 	}
 
 	if valBytes == nil {
 		log.Debugln("DiskCache.Peek key '" + key + "' CACHE MISS")
-		return nil, false
+		return nil, 0, false
 	}
 
-	buf := bytes.NewBuffer(valBytes)
-	val := cacheobj.CacheObj{}
-	if err := gob.NewDecoder(buf).Decode(&val); err != nil {
+	val, err := decode(valBytes)
+	if err != nil {
 		log.Errorln("DiskCache.Peek decoding '" + key + "' from cache: " + err.Error())
-		return nil, false
+		return nil, 0, false
+	}
+
+	size := uint64(len(valBytes))
+	if val.Chunked {
+		val.ChunkSource = c.ChunkSource(key, val.ChunkID)
+		size += val.Size
 	}
 
 	log.Debugln("DiskCache.Peek key '" + key + "' CACHE HIT")
-	return &val, true
+	return val, size, true
 }
 
 func (c *DiskCache) Size() uint64 {
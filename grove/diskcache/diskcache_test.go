@@ -0,0 +1,199 @@
+package diskcache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestCache(t *testing.T) (*DiskCache, func()) {
+	dir, err := ioutil.TempDir("", "grove-diskcache-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	c, err := New(filepath.Join(dir, "cache.db"), 100*cacheobj.ChunkSize)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("creating disk cache: %v", err)
+	}
+	return c, func() {
+		c.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func numChunksStored(t *testing.T, c *DiskCache) int {
+	n := 0
+	err := c.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket([]byte(ChunkBucketName)).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("counting chunks: %v", err)
+	}
+	return n
+}
+
+// addChunked writes the given body to the cache in chunks, and adds its chunked object, returning the object.
+func addChunked(t *testing.T, c *DiskCache, key string, body []byte) *cacheobj.CacheObj {
+	obj := &cacheobj.CacheObj{Code: 200, Chunked: true, ChunkID: cacheobj.NewChunkID(), Size: uint64(len(body))}
+	for i := 0; i*cacheobj.ChunkSize < len(body); i++ {
+		end := (i + 1) * cacheobj.ChunkSize
+		if end > len(body) {
+			end = len(body)
+		}
+		if err := c.AddChunk(key, obj.ChunkID, i, body[i*cacheobj.ChunkSize:end]); err != nil {
+			t.Fatalf("adding chunk %v: %v", i, err)
+		}
+	}
+	c.Add(key, obj)
+	return obj
+}
+
+func TestChunkedObject(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	key := "http://example.net/big"
+	body := bytes.Repeat([]byte("abcdefgh"), (2*cacheobj.ChunkSize+100)/8)
+	addChunked(t, c, key, body)
+
+	if n := numChunksStored(t, c); n != 3 {
+		t.Errorf("expected 3 chunks stored, actual %v", n)
+	}
+	if size := c.Size(); size <= uint64(len(body)) {
+		t.Errorf("expected cache size to include chunks of %v bytes, actual %v", len(body), size)
+	}
+
+	obj, ok := c.Get(key)
+	if !ok {
+		t.Fatalf("expected chunked object in cache, actual not found")
+	}
+	if obj.Body != nil {
+		t.Errorf("expected chunked object to have no Body, actual %v bytes", len(obj.Body))
+	}
+	if obj.NumChunks() != 3 {
+		t.Errorf("expected 3 chunks, actual %v", obj.NumChunks())
+	}
+	actual, err := obj.ReadBody()
+	if err != nil {
+		t.Fatalf("reading chunked body: %v", err)
+	}
+	if !bytes.Equal(body, actual) {
+		t.Errorf("expected body of %v bytes, actual %v bytes which differ", len(body), len(actual))
+	}
+
+	buf := &bytes.Buffer{}
+	if n, err := obj.WriteBody(buf); err != nil || n != uint64(len(body)) {
+		t.Errorf("expected WriteBody to write %v bytes, actual %v error %v", len(body), n, err)
+	}
+
+	// replacing the object must remove the old object's chunks
+	newBody := body[:cacheobj.ChunkSize+1]
+	addChunked(t, c, key, newBody)
+	if n := numChunksStored(t, c); n != 2 {
+		t.Errorf("expected 2 chunks stored after replacing object, actual %v", n)
+	}
+	obj, ok = c.Get(key)
+	if !ok {
+		t.Fatalf("expected replaced object in cache, actual not found")
+	}
+	if actual, err := obj.ReadBody(); err != nil || !bytes.Equal(newBody, actual) {
+		t.Errorf("expected replaced body of %v bytes, actual %v bytes error %v", len(newBody), len(actual), err)
+	}
+}
+
+func TestChunkedObjectInMemory(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	key := "http://example.net/mem"
+	chunks := [][]byte{bytes.Repeat([]byte("a"), cacheobj.ChunkSize), []byte("bcd")}
+	c.Add(key, &cacheobj.CacheObj{Code: 200, Chunked: true, ChunkID: cacheobj.NewChunkID(), Chunks: chunks, Size: cacheobj.ChunkSize + 3})
+
+	if n := numChunksStored(t, c); n != 2 {
+		t.Errorf("expected in-memory chunks to be stored, expected 2 actual %v", n)
+	}
+	obj, ok := c.Get(key)
+	if !ok {
+		t.Fatalf("expected object in cache, actual not found")
+	}
+	if obj.Chunks != nil {
+		t.Errorf("expected chunks read from disk, actual in memory")
+	}
+	if actual, err := obj.ReadBody(); err != nil || !bytes.Equal(actual, append(append([]byte{}, chunks[0]...), chunks[1]...)) {
+		t.Errorf("expected body of %v bytes, actual %v bytes error %v", cacheobj.ChunkSize+3, len(actual), err)
+	}
+}
+
+func TestAbortChunks(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	key := "http://example.net/aborted"
+	chunkID := cacheobj.NewChunkID()
+	for i := 0; i < 2; i++ {
+		if err := c.AddChunk(key, chunkID, i, []byte("chunk")); err != nil {
+			t.Fatalf("adding chunk %v: %v", i, err)
+		}
+	}
+	c.AbortChunks(key, chunkID, 2)
+
+	if n := numChunksStored(t, c); n != 0 {
+		t.Errorf("expected aborted chunks to be removed, actual %v chunks stored", n)
+	}
+	if _, ok := c.Get(key); ok {
+		t.Errorf("expected aborted object not in cache, actual found")
+	}
+}
+
+func TestRemoveOrphanChunks(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	key := "http://example.net/kept"
+	body := bytes.Repeat([]byte("z"), cacheobj.ChunkSize+1)
+	addChunked(t, c, key, body)
+
+	// chunks of an object never added, e.g. because Grove stopped mid-transfer
+	if err := c.AddChunk("http://example.net/orphan", cacheobj.NewChunkID(), 0, []byte("orphan")); err != nil {
+		t.Fatalf("adding chunk: %v", err)
+	}
+	// chunks of an object which isn't the stored object for the key
+	if err := c.AddChunk(key, cacheobj.NewChunkID(), 0, []byte("old")); err != nil {
+		t.Fatalf("adding chunk: %v", err)
+	}
+
+	c.removeOrphanChunks()
+
+	if n := numChunksStored(t, c); n != 2 {
+		t.Errorf("expected only the 2 chunks of the stored object to remain, actual %v chunks stored", n)
+	}
+	obj, ok := c.Get(key)
+	if !ok {
+		t.Fatalf("expected object in cache, actual not found")
+	}
+	if actual, err := obj.ReadBody(); err != nil || !bytes.Equal(body, actual) {
+		t.Errorf("expected body of %v bytes, actual %v bytes error %v", len(body), len(actual), err)
+	}
+}
@@ -66,6 +66,21 @@ func (c *MultiDiskCache) Peek(key string) (*cacheobj.CacheObj, bool) {
 	return (*c)[i].Peek(key)
 }
 
+// AddChunk implements icache.ChunkWriter.
+func (c *MultiDiskCache) AddChunk(key string, chunkID string, i int, chunk []byte) error {
+	return (*c)[c.keyIdx(key)].AddChunk(key, chunkID, i, chunk)
+}
+
+// AbortChunks implements icache.ChunkWriter.
+func (c *MultiDiskCache) AbortChunks(key string, chunkID string, n int) {
+	(*c)[c.keyIdx(key)].AbortChunks(key, chunkID, n)
+}
+
+// ChunkSource implements icache.ChunkWriter.
+func (c *MultiDiskCache) ChunkSource(key string, chunkID string) func(i int) ([]byte, error) {
+	return (*c)[c.keyIdx(key)].ChunkSource(key, chunkID)
+}
+
 func (c *MultiDiskCache) Size() uint64 {
 	sum := uint64(0)
 	for _, cache := range *c {
@@ -36,15 +36,20 @@ import (
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 
+	"github.com/apache/trafficcontrol/grove/accesslog"
 	"github.com/apache/trafficcontrol/grove/cache"
+	"github.com/apache/trafficcontrol/grove/certs"
 	"github.com/apache/trafficcontrol/grove/config"
 	"github.com/apache/trafficcontrol/grove/diskcache"
 	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 	"github.com/apache/trafficcontrol/grove/plugin"
 	"github.com/apache/trafficcontrol/grove/remap"
 	"github.com/apache/trafficcontrol/grove/remapdata"
+	"github.com/apache/trafficcontrol/grove/revalidate"
 	"github.com/apache/trafficcontrol/grove/stat"
+	"github.com/apache/trafficcontrol/grove/thread"
 	"github.com/apache/trafficcontrol/grove/tiercache"
 	"github.com/apache/trafficcontrol/grove/web"
 )
@@ -94,23 +99,41 @@ func main() {
 	baseTransport := remap.NewRemappingTransport(reqTimeout, reqKeepAlive, reqMaxIdleConns, reqIdleConnTimeout)
 
 	plugins := plugin.Get(cfg.Plugins)
-	remapper, err := remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport)
+	parents := parenthealth.NewParents()
+	remapper, err := remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport, parents)
 	if err != nil {
 		log.Errorf("starting service: loading remap rules: %v\n", err)
 		os.Exit(1)
 	}
 
-	certs, err := loadCerts(remapper.Rules())
+	revalidations, err := revalidate.New(cfg.RevalidateFile)
 	if err != nil {
-		log.Errorf("starting service: loading certificates: %v\n", err)
+		log.Errorf("starting service: loading revalidations: %v\n", err)
 		os.Exit(1)
 	}
-	defaultCert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
-	if err != nil {
-		log.Errorf("starting service: loading default certificate: %v\n", err)
+	revalidations.SetFileRules(remapper.Revalidations())
+
+	accessLogs := accesslog.New()
+	if err := accessLogs.Load(cfg.AccessLogs); err != nil {
+		log.Errorf("starting service: loading access logs: %v\n", err)
 		os.Exit(1)
 	}
-	certs = append(certs, defaultCert)
+
+	getter := thread.NewGetter()
+
+	certStore := certs.New(ocspInterval(cfg))
+	if cfg.CertFile != "" && cfg.KeyFile != "" {
+		if err := certStore.Load(ruleCertFiles(remapper.Rules()), defaultCertFile(cfg)); err != nil {
+			log.Errorf("starting service: loading certificates: %v\n", err)
+			os.Exit(1)
+		}
+		if !cfg.DisableCertWatch {
+			if err := certStore.Watch(); err != nil {
+				log.Errorf("starting service: watching certificates: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
 
 	httpListener, httpConns, httpConnStateCallback, err := web.InterceptListen("tcp", fmt.Sprintf(":%d", cfg.Port))
 	if err != nil {
@@ -124,7 +147,7 @@ func main() {
 	httpsConnStateCallback := (func(net.Conn, http.ConnState))(nil)
 	tlsConfig := (*tls.Config)(nil)
 	if cfg.CertFile != "" && cfg.KeyFile != "" {
-		if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certs, cfg.DisableHTTP2); err != nil {
+		if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certStore.GetCertificate, cfg.DisableHTTP2); err != nil {
 			log.Errorf("creating HTTPS listener %v: %v\n", cfg.HTTPSPort, err)
 			return
 		}
@@ -148,6 +171,10 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			revalidations,
+			parents,
+			accessLogs,
+			getter,
 		))
 	}
 
@@ -195,12 +222,17 @@ func main() {
 
 		plugins = plugin.Get(cfg.Plugins)
 		oldRemapper := remapper
-		remapper, err = remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport)
+		remapper, err = remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport, parents)
 		if err != nil {
 			log.Errorln("reloading config: failed to load remap rules, keeping existing rules: " + err.Error())
 			remapper = oldRemapper
 			return
 		}
+		revalidations.SetFileRules(remapper.Revalidations())
+
+		if err := accessLogs.Load(cfg.AccessLogs); err != nil {
+			log.Errorln("reloading config: loading access logs, keeping existing access logs: " + err.Error())
+		}
 
 		if cfg.Port != oldCfg.Port {
 			if httpListener, httpConns, httpConnStateCallback, err = web.InterceptListen("tcp", fmt.Sprintf(":%d", cfg.Port)); err != nil {
@@ -209,12 +241,15 @@ func main() {
 			}
 		}
 
-		if (cfg.CertFile != oldCfg.CertFile || cfg.KeyFile != oldCfg.KeyFile) && cfg.HTTPSPort != oldCfg.HTTPSPort {
-			log.Warnln("config certificate changed, but port did not. Cannot recreate listener on same port without stopping the service. Restart the service to load the new certificate.")
+		// Certificates are served by the store, so they're reloaded without recreating the listener or dropping connections.
+		if cfg.CertFile != "" && cfg.KeyFile != "" {
+			if err := certStore.Load(ruleCertFiles(remapper.Rules()), defaultCertFile(cfg)); err != nil {
+				log.Errorln("reloading config: loading certificates, keeping existing certificates: " + err.Error())
+			}
 		}
 
 		if cfg.HTTPSPort != oldCfg.HTTPSPort {
-			if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certs, cfg.DisableHTTP2); err != nil {
+			if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certStore.GetCertificate, cfg.DisableHTTP2); err != nil {
 				log.Errorf("creating HTTPS listener %v: %v\n", cfg.HTTPSPort, err)
 			}
 		}
@@ -235,6 +270,10 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			revalidations,
+			parents,
+			accessLogs,
+			getter,
 		)
 		httpHandler.Set(httpCacheHandler)
 
@@ -252,6 +291,10 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			revalidations,
+			parents,
+			accessLogs,
+			getter,
 		)
 		httpsHandler.Set(httpsCacheHandler)
 
@@ -358,26 +401,29 @@ func startServer(handler http.Handler, listener net.Listener, connState func(net
 	return server
 }
 
-func loadCerts(rules []remapdata.RemapRule) ([]tls.Certificate, error) {
-	certs := []tls.Certificate{}
+// ruleCertFiles returns the certificate files of the given remap rules which have certificates.
+func ruleCertFiles(rules []remapdata.RemapRule) []certs.CertFile {
+	files := []certs.CertFile{}
 	for _, rule := range rules {
 		if rule.CertificateFile == "" && rule.CertificateKeyFile == "" {
 			continue
 		}
-		if rule.CertificateFile == "" {
-			return nil, errors.New("rule " + rule.Name + " has a certificate but no key, using default certificate\n")
-		}
-		if rule.CertificateKeyFile == "" {
-			return nil, errors.New("rule " + rule.Name + " has a key but no certificate, using default certificate\n")
-		}
+		files = append(files, certs.CertFile{Name: "rule " + rule.Name, CertFile: rule.CertificateFile, KeyFile: rule.CertificateKeyFile})
+	}
+	return files
+}
 
-		cert, err := tls.LoadX509KeyPair(rule.CertificateFile, rule.CertificateKeyFile)
-		if err != nil {
-			return nil, errors.New("loading rule " + rule.Name + " certificate: " + err.Error() + "\n")
-		}
-		certs = append(certs, cert)
+// defaultCertFile returns the config default certificate files.
+func defaultCertFile(cfg config.Config) certs.CertFile {
+	return certs.CertFile{Name: "default", CertFile: cfg.CertFile, KeyFile: cfg.KeyFile}
+}
+
+// ocspInterval returns the OCSP response refresh interval from the config, or 0 if OCSP stapling is disabled.
+func ocspInterval(cfg config.Config) time.Duration {
+	if cfg.DisableOCSPStapling || cfg.OCSPRefreshIntervalMS <= 0 {
+		return 0
 	}
-	return certs, nil
+	return time.Duration(cfg.OCSPRefreshIntervalMS) * time.Millisecond
 }
 
 // createCaches creates the caches specified in the config. The nameFiles is the map of names to groups of files, nameMemBytes is the amount of memory to use for each named group, and memCacheBytes is the amount of memory to use for the default memory cache.
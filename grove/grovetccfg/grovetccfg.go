@@ -15,6 +15,7 @@ package main
 */
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
@@ -34,12 +35,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	to "github.com/apache/trafficcontrol/traffic_ops/v2-client"
+	to3 "github.com/apache/trafficcontrol/traffic_ops/v3-client"
 
 	"github.com/apache/trafficcontrol/grove/config"
+	"github.com/apache/trafficcontrol/grove/plugin"
 	"github.com/apache/trafficcontrol/grove/remap"
 	"github.com/apache/trafficcontrol/grove/remapdata"
+	"github.com/apache/trafficcontrol/grove/revalidate"
 	"github.com/apache/trafficcontrol/grove/web"
 )
 
@@ -156,6 +161,20 @@ func WriteAndBackup(path string, backupDirectory string, bts []byte) error {
 	return nil
 }
 
+// WriteIfChanged writes the given bytes to the given path, unless the file already contains them. The write is atomic on operating systems with atomic file rename (Linux is).
+func WriteIfChanged(path string, bts []byte) error {
+	if existing, err := ioutil.ReadFile(path); err == nil && bytes.Equal(existing, bts) {
+		return nil
+	}
+	if err := WriteNewFile(path, bts); err != nil {
+		return errors.New("writing new file: " + err.Error())
+	}
+	if err := os.Rename(NewFilename(path), path); err != nil {
+		return errors.New("copying new file to real location: " + err.Error())
+	}
+	return nil
+}
+
 // hasUpdatePending returns whether an update is pending, the revalPending status (which will be needed later in the clear update POST), and any error.
 func hasUpdatePending(toc *to.Session, hostname string) (bool, bool, error) {
 	upd, _, err := toc.GetServerByHostName(hostname)
@@ -224,7 +243,7 @@ func main() {
 			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error checking Traffic Ops update pending: " + err.Error())
 			os.Exit(ExitError)
 		}
-		if !needsUpdate {
+		if !needsUpdate && !revalPendingStatus {
 			os.Exit(ExitSuccess) // if no error and no update necessary, return success and print nothing
 		}
 	}
@@ -340,7 +359,7 @@ func main() {
 	}
 
 	if !*ignoreUpdateFlag {
-		if err := clearUpdatePending(toc, *host, revalPendingStatus); err != nil {
+		if err := clearUpdatePending(toc, *host, false); err != nil { // the rules include the current invalidation jobs, so a pending revalidation is also done
 			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error clearing update pending flag in Traffic Ops (but successfully updated config): " + err.Error())
 			os.Exit(ExitErrorClearingUpdateFlag)
 		}
@@ -449,6 +468,10 @@ func setConfigParameter(cfg *config.Config, name string, value string) error {
 		cfg.ServerReadTimeoutMS, err = strconv.Atoi(value)
 	case "file_mem_bytes":
 		cfg.FileMemBytes, err = strconv.Atoi(value)
+	case "revalidate_file":
+		cfg.RevalidateFile = value
+	case "revalidate_token":
+		cfg.RevalidateToken = value
 	default:
 		err = fmt.Errorf(time.Now().Format(time.RFC3339Nano) + "No such config parameter '" + name + "', parameter ignored")
 	}
@@ -522,7 +545,266 @@ func createRulesOldAPI(toc *to.Session, host string, certDir string, servers map
 	}
 	dsCerts := makeDSCertMap(cdnSSLKeys)
 
-	return createRulesOld(host, deliveryservices, parents, deliveryserviceRegexes, cdns, serverParameters, dsCerts, certDir)
+	topologyParents, topologyDSes, err := createTopologyParents(toc, hostServer)
+	if err != nil {
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting '" + host + "' topology parents: " + err.Error())
+		os.Exit(1)
+	}
+	deliveryservices = appendMissingDSes(deliveryservices, topologyDSes)
+	addMissingDSCerts(toc, deliveryservices, dsCerts)
+
+	signingPlugins, err := createSigningPlugins(toc, deliveryservices)
+	if err != nil {
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops Deliveryservice signing keys: " + err.Error())
+		os.Exit(1)
+	}
+
+	rules, err := createRulesOld(host, deliveryservices, parents, topologyParents, deliveryserviceRegexes, cdns, serverParameters, dsCerts, signingPlugins, certDir)
+	if err != nil {
+		return remap.RemapRules{}, err
+	}
+
+	jobs, _, err := toc.GetJobs(nil, nil)
+	if err != nil {
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops Jobs: " + err.Error())
+		os.Exit(1)
+	}
+	revalidations, warnings := createRevalidations(jobs, deliveryservices, time.Now())
+	for _, warning := range warnings {
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Warning: " + warning)
+	}
+	rules.Revalidations = revalidations
+	return rules, nil
+}
+
+// createSigningPlugins returns the url_sig and uri_signing plugin configs of the given delivery services which sign URLs, from their Traffic Ops keys. The returned map is delivery service xmlIDs to plugin names to configs.
+func createSigningPlugins(toc *to.Session, dses []tc.DeliveryServiceNullable) (map[string]map[string]interface{}, error) {
+	signingPlugins := map[string]map[string]interface{}{}
+	for _, ds := range dses {
+		if ds.XMLID == nil || ds.SigningAlgorithm == nil {
+			continue
+		}
+		switch *ds.SigningAlgorithm {
+		case tc.SigningAlgorithmURLSig:
+			keys, _, err := toc.GetDeliveryServiceURLSigKeys(*ds.XMLID)
+			if err != nil {
+				return nil, errors.New("getting deliveryservice '" + *ds.XMLID + "' URL sig keys: " + err.Error())
+			}
+			signingPlugins[*ds.XMLID] = map[string]interface{}{"url_sig": plugin.URLSigConfig{Keys: keys}}
+		case tc.SigningAlgorithmURISigning:
+			keysJSON, _, err := toc.GetDeliveryServiceURISigningKeys(*ds.XMLID)
+			if err != nil {
+				return nil, errors.New("getting deliveryservice '" + *ds.XMLID + "' URI signing keys: " + err.Error())
+			}
+			keys := map[string]plugin.URISigningKeys{}
+			if err := json.Unmarshal(keysJSON, &keys); err != nil {
+				return nil, errors.New("parsing deliveryservice '" + *ds.XMLID + "' URI signing keys: " + err.Error())
+			}
+			signingPlugins[*ds.XMLID] = map[string]interface{}{"uri_signing": plugin.URISigningConfig{Keys: keys}}
+		}
+	}
+	return signingPlugins, nil
+}
+
+// createTopologyParents returns the parents of the given server for each delivery service with a topology the server is in, keyed by xmlID, and those delivery services.
+// The parents are the same as lib/go-atscfg gives ATS caches in the same topology. If Traffic Ops doesn't support topologies, it warns and returns no parents.
+func createTopologyParents(toc *to.Session, hostServer tc.Server) (map[string]atscfg.TopologyParents, []tc.DeliveryServiceNullable, error) {
+	toc3 := to3.NewSession(toc.UserName, toc.Password, toc.URL, toc.UserAgentStr, toc.Client, false)
+
+	topologies, _, err := toc3.GetTopologies()
+	if err != nil {
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Warning: getting Traffic Ops Topologies, delivery services with topologies will not be created: " + err.Error())
+		return nil, nil, nil
+	}
+	if len(topologies) == 0 {
+		return nil, nil, nil
+	}
+
+	serversResp, _, err := toc3.GetServersWithHdr(nil, nil)
+	if err != nil {
+		return nil, nil, errors.New("getting servers: " + err.Error())
+	}
+	servers := []atscfg.Server{}
+	server := (*atscfg.Server)(nil)
+	for _, sv := range serversResp.Response {
+		servers = append(servers, atscfg.Server(sv))
+		if sv.ID != nil && *sv.ID == hostServer.ID {
+			server = &servers[len(servers)-1]
+		}
+	}
+	if server == nil {
+		return nil, nil, errors.New("server '" + hostServer.HostName + "' not in Traffic Ops servers")
+	}
+
+	dsParams := url.Values{}
+	dsParams.Set("cdn", strconv.Itoa(hostServer.CDNID))
+	tcDSes, _, err := toc3.GetDeliveryServicesV30WithHdr(nil, dsParams)
+	if err != nil {
+		return nil, nil, errors.New("getting delivery services: " + err.Error())
+	}
+	dses := []atscfg.DeliveryService{}
+	for _, ds := range tcDSes {
+		dses = append(dses, atscfg.DeliveryService(ds))
+	}
+
+	cacheGroups, _, err := toc3.GetCacheGroupsNullable()
+	if err != nil {
+		return nil, nil, errors.New("getting cachegroups: " + err.Error())
+	}
+
+	parentConfigParams, _, err := toc3.GetParameterByConfigFile(atscfg.ParentConfigFileName)
+	if err != nil {
+		return nil, nil, errors.New("getting parent.config parameters: " + err.Error())
+	}
+
+	tcServerCaps, _, err := toc3.GetServerServerCapabilities(nil, nil, nil)
+	if err != nil {
+		return nil, nil, errors.New("getting server capabilities: " + err.Error())
+	}
+	serverCaps := map[int]map[atscfg.ServerCapability]struct{}{}
+	for _, sc := range tcServerCaps {
+		if sc.ServerID == nil || sc.ServerCapability == nil {
+			continue
+		}
+		if _, ok := serverCaps[*sc.ServerID]; !ok {
+			serverCaps[*sc.ServerID] = map[atscfg.ServerCapability]struct{}{}
+		}
+		serverCaps[*sc.ServerID][atscfg.ServerCapability(*sc.ServerCapability)] = struct{}{}
+	}
+
+	tcDSCaps, _, err := toc3.GetDeliveryServicesRequiredCapabilities(nil, nil, nil)
+	if err != nil {
+		return nil, nil, errors.New("getting delivery service required capabilities: " + err.Error())
+	}
+	dsCaps := map[int]map[atscfg.ServerCapability]struct{}{}
+	for _, dc := range tcDSCaps {
+		if dc.DeliveryServiceID == nil || dc.RequiredCapability == nil {
+			continue
+		}
+		if _, ok := dsCaps[*dc.DeliveryServiceID]; !ok {
+			dsCaps[*dc.DeliveryServiceID] = map[atscfg.ServerCapability]struct{}{}
+		}
+		dsCaps[*dc.DeliveryServiceID][atscfg.ServerCapability(*dc.RequiredCapability)] = struct{}{}
+	}
+
+	const noLimit = 999999 // the delivery service servers endpoint has no "no limit" param
+	tcDSS, _, err := toc3.GetDeliveryServiceServersWithLimitsWithHdr(noLimit, nil, nil, nil)
+	if err != nil {
+		return nil, nil, errors.New("getting delivery service servers: " + err.Error())
+	}
+	dss := []atscfg.DeliveryServiceServer{}
+	for _, ds := range tcDSS.Response {
+		if ds.Server == nil || ds.DeliveryService == nil {
+			continue
+		}
+		dss = append(dss, atscfg.DeliveryServiceServer{Server: *ds.Server, DeliveryService: *ds.DeliveryService})
+	}
+
+	dsParents, warnings, err := atscfg.MakeTopologyParents(dses, server, servers, topologies, parentConfigParams, serverCaps, dsCaps, cacheGroups, dss)
+	for _, warning := range warnings {
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Warning: " + warning)
+	}
+	if err != nil {
+		return nil, nil, errors.New("making topology parents: " + err.Error())
+	}
+
+	parents := map[string]atscfg.TopologyParents{}
+	topologyDSes := []tc.DeliveryServiceNullable{}
+	for _, ds := range tcDSes {
+		if ds.XMLID == nil {
+			continue
+		}
+		topoParents, ok := dsParents[tc.DeliveryServiceName(*ds.XMLID)]
+		if !ok {
+			continue
+		}
+		parents[*ds.XMLID] = topoParents
+		topologyDSes = append(topologyDSes, tc.DeliveryServiceNullable(ds.DeliveryServiceNullableV15))
+	}
+	return parents, topologyDSes, nil
+}
+
+// appendMissingDSes returns dses with each of newDSes whose xmlID isn't already in dses appended.
+func appendMissingDSes(dses []tc.DeliveryServiceNullable, newDSes []tc.DeliveryServiceNullable) []tc.DeliveryServiceNullable {
+	xmlIDs := map[string]struct{}{}
+	for _, ds := range dses {
+		if ds.XMLID != nil {
+			xmlIDs[*ds.XMLID] = struct{}{}
+		}
+	}
+	for _, ds := range newDSes {
+		if _, ok := xmlIDs[*ds.XMLID]; ok {
+			continue
+		}
+		dses = append(dses, ds)
+	}
+	return dses
+}
+
+// createRevalidations returns the revalidation rules for the given invalidation jobs of the given delivery services, which haven't expired at the given time, and any warnings.
+// Jobs are filtered and their TTLs limited like the ATS regex_revalidate.config, except each rule starts at its job's start time, so only objects cached before the job are invalidated.
+func createRevalidations(jobs []tc.Job, dses []tc.DeliveryServiceNullable, now time.Time) ([]revalidate.Rule, []string) {
+	warnings := []string{}
+	dsNames := map[string]struct{}{}
+	for _, ds := range dses {
+		if ds.XMLID != nil {
+			dsNames[*ds.XMLID] = struct{}{}
+		}
+	}
+
+	maxTTL := time.Duration(atscfg.DefaultMaxRevalDurationDays) * 24 * time.Hour
+	rules := []revalidate.Rule{}
+	for _, job := range jobs {
+		if _, ok := dsNames[job.DeliveryService]; !ok || job.Keyword != atscfg.JobKeywordPurge {
+			continue
+		}
+		ttlHoursStr := job.Parameters
+		if !strings.HasPrefix(ttlHoursStr, "TTL:") || !strings.HasSuffix(ttlHoursStr, "h") {
+			continue
+		}
+		ttlHours, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(ttlHoursStr, "TTL:"), "h"))
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("job %v has malformed parameters '%v', skipping", job.ID, job.Parameters))
+			continue
+		}
+		ttl := time.Duration(ttlHours) * time.Hour
+		if ttl > maxTTL {
+			ttl = maxTTL
+		} else if ttl < atscfg.RegexRevalidateMinTTL {
+			ttl = atscfg.RegexRevalidateMinTTL
+		}
+		start, err := time.Parse(tc.JobTimeFormat, job.StartTime)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("job %v has malformed start time '%v', skipping", job.ID, job.StartTime))
+			continue
+		}
+		if !now.Before(start.Add(ttl)) {
+			continue // expired
+		}
+
+		assetURL := job.AssetURL
+		typ := revalidate.TypeStale
+		if strings.HasSuffix(assetURL, atscfg.RefetchSuffix) {
+			assetURL = strings.TrimSuffix(assetURL, atscfg.RefetchSuffix)
+			typ = revalidate.TypeMiss
+		} else {
+			assetURL = strings.TrimSuffix(assetURL, atscfg.RefreshSuffix)
+		}
+
+		rule, err := revalidate.RuleFromJSON(revalidate.RuleJSON{Regex: assetURL, Start: start, Expires: start.Add(ttl), Type: string(typ)}, now)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("job %v: %v, skipping", job.ID, err))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Regex.String() != rules[j].Regex.String() {
+			return rules[i].Regex.String() < rules[j].Regex.String()
+		}
+		return rules[i].Start.Before(rules[j].Start)
+	})
+	return rules, warnings
 }
 
 // func createRulesNewAPI(toc *to.Session, host string, certDir string) (remap.RemapRules, error) {
@@ -697,6 +979,31 @@ func makeDSCertMap(sslKeys []tc.CDNSSLKeys) map[string]tc.CDNSSLKeys {
 	return m
 }
 
+// addMissingDSCerts adds the certificates of the given HTTPS delivery services which aren't in dsCerts, from their delivery service SSL keys. This gets keys of any auth type, including self-signed, certificate authority, and ACME (Let's Encrypt) issued keys, which were added or renewed after the CDN keys were fetched.
+func addMissingDSCerts(toc *to.Session, dses []tc.DeliveryServiceNullable, dsCerts map[string]tc.CDNSSLKeys) {
+	for _, ds := range dses {
+		if ds.XMLID == nil || ds.Protocol == nil || *ds.Protocol == ProtocolHTTP {
+			continue
+		}
+		if _, ok := dsCerts[*ds.XMLID]; ok {
+			continue
+		}
+		keys, _, err := toc.GetDeliveryServiceSSLKeysByID(*ds.XMLID)
+		if err != nil {
+			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Warning: getting deliveryservice '" + *ds.XMLID + "' SSL keys: " + err.Error())
+			continue
+		}
+		if keys == nil || keys.Certificate.Crt == "" || keys.Certificate.Key == "" {
+			continue
+		}
+		dsCerts[*ds.XMLID] = tc.CDNSSLKeys{
+			DeliveryService: *ds.XMLID,
+			Hostname:        keys.Hostname,
+			Certificate:     tc.CDNSSLKeysCertificate{Crt: keys.Certificate.Crt, Key: keys.Certificate.Key},
+		}
+	}
+}
+
 func getParents(hostname string, servers map[string]tc.Server, cachegroups map[string]tc.CacheGroupNullable) ([]tc.Server, error) {
 	server, ok := servers[hostname]
 	if !ok {
@@ -782,6 +1089,118 @@ func buildTo(parentServer tc.Server, protocol string, originURI string, dsType s
 	return to, proxy
 }
 
+// buildTopologyTos returns the rule tos for the given topology parents of a delivery service with the given origin.
+// Caches which aren't the last cache tier proxy to their parent caches. The last cache tier requests its parents directly, which are the delivery service origin, or the multi-site origin servers.
+func buildTopologyTos(parents atscfg.TopologyParents, orgServerFQDN string, timeout time.Duration) ([]remapdata.RemapRuleTo, error) {
+	tos := []remapdata.RemapRuleTo{}
+	addTos := func(topoParents []atscfg.TopologyParent, secondary bool) error {
+		for _, parent := range topoParents {
+			if parent.Host == "" {
+				continue // not_a_parent secondary parent
+			}
+			weight := DefaultRuleWeight
+			if parent.Weight != "" {
+				if w, err := strconv.ParseFloat(parent.Weight, 64); err != nil {
+					fmt.Println(time.Now().Format(time.RFC3339Nano) + " Warning: parent '" + parent.Host + "' weight '" + parent.Weight + "' is not a number, using default")
+				} else {
+					weight = w
+				}
+			}
+			retryNum := DefaultRetryNum
+			to := remapdata.RemapRuleTo{
+				RemapRuleToBase: remapdata.RemapRuleToBase{
+					URL:       orgServerFQDN,
+					Weight:    &weight,
+					RetryNum:  &retryNum,
+					Secondary: secondary,
+				},
+				RetryCodes: DefaultRetryCodes(),
+				Timeout:    &timeout,
+			}
+
+			hostPort := net.JoinHostPort(parent.Host, parent.Port)
+			if !parents.IsLastCacheTier {
+				proxyURL, err := url.Parse("http://" + hostPort)
+				if err != nil {
+					return fmt.Errorf("parsing parent '%v' proxy url: %v", hostPort, err)
+				}
+				to.ProxyURL = proxyURL
+			} else if !parents.IsLastTier {
+				to.URL = parents.OriginURI.Scheme + "://" + hostPort // multi-site origin
+			}
+			tos = append(tos, to)
+		}
+		return nil
+	}
+	if err := addTos(parents.Parents, false); err != nil {
+		return nil, err
+	}
+	if err := addTos(parents.SecondaryParents, true); err != nil {
+		return nil, err
+	}
+	return tos, nil
+}
+
+// ParentRetryCodeSimple is the response code retried by the ATS parent.config parent_retry=simple.
+const ParentRetryCodeSimple = 404
+
+// ParentRetryCodeUnavailableServer is the response code retried by default by the ATS parent.config parent_retry=unavailable_server_retry.
+const ParentRetryCodeUnavailableServer = 503
+
+// topologyRetry returns the retry codes and number of retries for the given topology parents, like the ATS parent.config parent_retry, and any warnings.
+// Parents which aren't the last cache tier don't retry parent responses, and use the defaults.
+func topologyRetry(parents atscfg.TopologyParents) (map[int]struct{}, int, []string) {
+	warnings := []string{}
+	retryCodes := DefaultRetryCodes()
+	retryNum := DefaultRetryNum
+
+	parseRetryNum := func(name string, val string) int {
+		num, err := strconv.Atoi(val)
+		if err != nil {
+			warnings = append(warnings, name+" '"+val+"' is not an integer, using default")
+			return DefaultRetryNum
+		}
+		return num
+	}
+
+	simple := parents.ParentRetry == "simple" || parents.ParentRetry == "both"
+	unavailable := parents.ParentRetry == "unavailable_server_retry" || parents.ParentRetry == "both"
+	if !simple && !unavailable {
+		if parents.ParentRetry != "" {
+			warnings = append(warnings, "unknown parent retry '"+parents.ParentRetry+"', using defaults")
+		}
+		return retryCodes, retryNum, warnings
+	}
+
+	retryNum = 0
+	if simple {
+		retryCodes[ParentRetryCodeSimple] = struct{}{}
+		retryNum = parseRetryNum("max simple retries", parents.MaxSimpleRetries)
+	}
+	if unavailable {
+		codesStr := strings.Trim(parents.UnavailableServerRetryResponses, `"`)
+		if codesStr == "" {
+			retryCodes[ParentRetryCodeUnavailableServer] = struct{}{}
+		}
+		for _, codeStr := range strings.Split(codesStr, ",") {
+			codeStr = strings.TrimSpace(codeStr)
+			if codeStr == "" {
+				continue
+			}
+			code, err := strconv.Atoi(codeStr)
+			if err != nil {
+				warnings = append(warnings, "unavailable server retry response '"+codeStr+"' is not an integer, skipping")
+				continue
+			}
+			retryCodes[code] = struct{}{}
+		}
+		if num := parseRetryNum("max unavailable server retries", parents.MaxUnavailableServerRetries); num > retryNum {
+			retryNum = num
+		}
+	}
+	return retryCodes, retryNum, warnings
+}
+
 // // buildToNew returns the to URL, and the Proxy URL (if any)
 // func buildToNew(parent tc.CacheConfigParent, protocol string, originURI string, dsType string) (string, string) {
 // 	// TODO add port?
@@ -858,10 +1277,12 @@ func createRulesOld(
 	hostname string,
 	dses []tc.DeliveryServiceNullable,
 	parents []tc.Server,
+	topologyParents map[string]atscfg.TopologyParents,
 	dsRegexes map[string][]tc.DeliveryServiceRegex,
 	cdns map[string]tc.CDN,
 	hostParams []tc.Parameter,
 	dsCerts map[string]tc.CDNSSLKeys,
+	signingPlugins map[string]map[string]interface{},
 	certDir string,
 ) (remap.RemapRules, error) {
 	rules := []remapdata.RemapRule{}
@@ -954,9 +1375,40 @@ func createRulesOld(
 				}
 
 				rule.PluginsShared = map[string]json.RawMessage{}
-				// if the delivery service skips the mid's ie, http_no_cache, http_live, and dns_live
-				// only add the url rule to the origin.
-				if dsTypeSkipsMid(dsType) {
+				// if the delivery service has a topology, its parents come from the topology, regardless of type.
+				if topoParents, ok := topologyParents[*ds.XMLID]; ok {
+					tos, err := buildTopologyTos(topoParents, orgServerFQDN, timeout)
+					if err != nil {
+						return remap.RemapRules{}, fmt.Errorf("building deliveryservice '%v' topology parents: %v", *ds.XMLID, err)
+					}
+					if topoParents.RoundRobin != tc.AlgorithmConsistentHash {
+						fmt.Println(time.Now().Format(time.RFC3339Nano) + " Warning: deliveryservice '" + *ds.XMLID + "' parent selection '" + topoParents.RoundRobin + "' is not supported, using " + string(parentSelection))
+					}
+					retryCodes, retryNum, retryWarnings := topologyRetry(topoParents)
+					for _, warning := range retryWarnings {
+						fmt.Println(time.Now().Format(time.RFC3339Nano) + " Warning: deliveryservice '" + *ds.XMLID + "' " + warning)
+					}
+					rule.To = tos
+					rule.AlternateSecondary = !topoParents.TryAllPrimariesBeforeSecondary
+					rule.RetryNum = &retryNum
+					rule.Timeout = &timeout
+					rule.RetryCodes = retryCodes
+					rule.QueryString = queryStringRule
+					rule.DSCP = *ds.DSCP
+					rule.ConnectionClose = DefaultRuleConnectionClose
+					rule.ParentSelection = &parentSelection
+					rule.Allow = acl
+					rule.Plugins = map[string]interface{}{}
+					rule.Plugins["modify_headers"] = toClientHeaders
+					rule.Plugins["modify_parent_request_headers"] = toOriginHeaders
+					remapTextJSON, err := json.Marshal(dsRemap)
+					if err != nil {
+						return remap.RemapRules{}, fmt.Errorf("parsing deliveryservice '%v' remap text '%v' marshalling JSON: %v", *ds.XMLID, dsRemap, err)
+					}
+					rule.PluginsShared[web.RemapTextKey] = remapTextJSON
+				} else if dsTypeSkipsMid(dsType) {
+					// if the delivery service skips the mid's ie, http_no_cache, http_live, and dns_live
+					// only add the url rule to the origin.
 					var proxyURLStr = ""
 					proxyURL, err := url.Parse(proxyURLStr)
 					if err != nil {
@@ -1026,6 +1478,12 @@ func createRulesOld(
 						rule.PluginsShared[web.RemapTextKey] = remapTextJSON
 					}
 				}
+				for name, cfg := range signingPlugins[*ds.XMLID] {
+					if rule.Plugins == nil {
+						rule.Plugins = map[string]interface{}{}
+					}
+					rule.Plugins[name] = cfg
+				}
 				rules = append(rules, rule)
 			}
 		}
@@ -1063,18 +1521,20 @@ func createCertificateFiles(cert tc.CDNSSLKeys, dir string) error {
 	if err != nil {
 		return errors.New("base64decoding certificate file " + certFileName + ": " + err.Error())
 	}
-	if err := ioutil.WriteFile(certFileName, crt, 0644); err != nil {
-		return errors.New("writing certificate file " + certFileName + ": " + err.Error())
-	}
 
 	keyFileName := getCertKeyFileName(cert, dir)
 	key, err := base64.StdEncoding.DecodeString(cert.Certificate.Key)
 	if err != nil {
 		return errors.New("base64decoding certificate key " + keyFileName + ": " + err.Error())
 	}
-	if err := ioutil.WriteFile(keyFileName, key, 0644); err != nil {
+
+	// Grove reloads certificates when their files change, so the files are only written if they changed, and atomically, so a partial file is never loaded.
+	if err := WriteIfChanged(keyFileName, key); err != nil {
 		return errors.New("writing certificate key file " + keyFileName + ": " + err.Error())
 	}
+	if err := WriteIfChanged(certFileName, crt); err != nil {
+		return errors.New("writing certificate file " + certFileName + ": " + err.Error())
+	}
 	return nil
 }
 
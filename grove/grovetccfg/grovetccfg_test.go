@@ -0,0 +1,180 @@
+package main
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+)
+
+func TestBuildTopologyTosProxy(t *testing.T) {
+	parents := atscfg.TopologyParents{
+		OriginURI: &url.URL{Scheme: "http", Host: "origin.example.net:80"},
+		Parents: []atscfg.TopologyParent{
+			{Host: "mid0.example.net", Port: "80", Weight: "0.5"},
+		},
+		SecondaryParents: []atscfg.TopologyParent{
+			{Host: "mid1.example.net", Port: "8080", Weight: "notanumber"},
+			{}, // not_a_parent
+		},
+	}
+	timeout := time.Second
+	tos, err := buildTopologyTos(parents, "http://origin.example.net", timeout)
+	if err != nil {
+		t.Fatalf("expected no error, actual: %v", err)
+	}
+	if len(tos) != 2 {
+		t.Fatalf("expected 2 tos skipping the not_a_parent secondary parent, actual: %+v", tos)
+	}
+
+	if tos[0].URL != "http://origin.example.net" {
+		t.Errorf("expected primary url 'http://origin.example.net', actual: '%v'", tos[0].URL)
+	}
+	if tos[0].ProxyURL == nil || tos[0].ProxyURL.String() != "http://mid0.example.net:80" {
+		t.Errorf("expected primary proxy 'http://mid0.example.net:80', actual: %v", tos[0].ProxyURL)
+	}
+	if tos[0].Secondary {
+		t.Errorf("expected primary not to be secondary")
+	}
+	if *tos[0].Weight != 0.5 {
+		t.Errorf("expected primary weight 0.5, actual: %v", *tos[0].Weight)
+	}
+	if *tos[0].Timeout != timeout {
+		t.Errorf("expected primary timeout %v, actual: %v", timeout, *tos[0].Timeout)
+	}
+
+	if tos[1].ProxyURL == nil || tos[1].ProxyURL.String() != "http://mid1.example.net:8080" {
+		t.Errorf("expected secondary proxy 'http://mid1.example.net:8080', actual: %v", tos[1].ProxyURL)
+	}
+	if !tos[1].Secondary {
+		t.Errorf("expected secondary to be secondary")
+	}
+	if *tos[1].Weight != DefaultRuleWeight {
+		t.Errorf("expected secondary with malformed weight to have default weight %v, actual: %v", DefaultRuleWeight, *tos[1].Weight)
+	}
+}
+
+func TestBuildTopologyTosLastTier(t *testing.T) {
+	parents := atscfg.TopologyParents{
+		OriginURI:       &url.URL{Scheme: "http", Host: "origin.example.net:80"},
+		Parents:         []atscfg.TopologyParent{{Host: "origin.example.net", Port: "80"}},
+		IsLastCacheTier: true,
+		IsLastTier:      true,
+	}
+	tos, err := buildTopologyTos(parents, "http://origin.example.net", time.Second)
+	if err != nil {
+		t.Fatalf("expected no error, actual: %v", err)
+	}
+	if len(tos) != 1 {
+		t.Fatalf("expected 1 to, actual: %+v", tos)
+	}
+	if tos[0].URL != "http://origin.example.net" || tos[0].ProxyURL != nil {
+		t.Errorf("expected last tier to request the origin 'http://origin.example.net' directly, actual: '%v' proxy %v", tos[0].URL, tos[0].ProxyURL)
+	}
+}
+
+func TestBuildTopologyTosMSO(t *testing.T) {
+	parents := atscfg.TopologyParents{
+		OriginURI: &url.URL{Scheme: "https", Host: "origin.example.net:443"},
+		Parents: []atscfg.TopologyParent{
+			{Host: "origin0.example.net", Port: "443"},
+			{Host: "origin1.example.net", Port: "443"},
+		},
+		IsLastCacheTier: true,
+	}
+	tos, err := buildTopologyTos(parents, "https://origin.example.net", time.Second)
+	if err != nil {
+		t.Fatalf("expected no error, actual: %v", err)
+	}
+	if len(tos) != 2 {
+		t.Fatalf("expected 2 tos, actual: %+v", tos)
+	}
+	for i, expected := range []string{"https://origin0.example.net:443", "https://origin1.example.net:443"} {
+		if tos[i].URL != expected || tos[i].ProxyURL != nil {
+			t.Errorf("expected last cache tier to request multi-site origin '%v' directly, actual: '%v' proxy %v", expected, tos[i].URL, tos[i].ProxyURL)
+		}
+	}
+}
+
+func TestTopologyRetry(t *testing.T) {
+	type expected struct {
+		codes    []int
+		num      int
+		warnings int
+	}
+	tests := []struct {
+		name     string
+		parents  atscfg.TopologyParents
+		expected expected
+	}{
+		{
+			name:     "none",
+			parents:  atscfg.TopologyParents{},
+			expected: expected{num: DefaultRetryNum},
+		},
+		{
+			name:     "unknown",
+			parents:  atscfg.TopologyParents{ParentRetry: "bogus"},
+			expected: expected{num: DefaultRetryNum, warnings: 1},
+		},
+		{
+			name:     "simple",
+			parents:  atscfg.TopologyParents{ParentRetry: "simple", MaxSimpleRetries: "2"},
+			expected: expected{codes: []int{ParentRetryCodeSimple}, num: 2},
+		},
+		{
+			name:     "unavailable default codes",
+			parents:  atscfg.TopologyParents{ParentRetry: "unavailable_server_retry", MaxUnavailableServerRetries: "3"},
+			expected: expected{codes: []int{ParentRetryCodeUnavailableServer}, num: 3},
+		},
+		{
+			name:     "unavailable codes",
+			parents:  atscfg.TopologyParents{ParentRetry: "unavailable_server_retry", UnavailableServerRetryResponses: `"500, 502,x"`, MaxUnavailableServerRetries: "1"},
+			expected: expected{codes: []int{500, 502}, num: 1, warnings: 1},
+		},
+		{
+			name:     "both",
+			parents:  atscfg.TopologyParents{ParentRetry: "both", MaxSimpleRetries: "4", MaxUnavailableServerRetries: "2"},
+			expected: expected{codes: []int{ParentRetryCodeSimple, ParentRetryCodeUnavailableServer}, num: 4},
+		},
+		{
+			name:     "malformed num",
+			parents:  atscfg.TopologyParents{ParentRetry: "simple", MaxSimpleRetries: "many"},
+			expected: expected{codes: []int{ParentRetryCodeSimple}, num: DefaultRetryNum, warnings: 1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			codes, num, warnings := topologyRetry(test.parents)
+			if len(codes) != len(test.expected.codes) {
+				t.Errorf("expected retry codes %v, actual: %v", test.expected.codes, codes)
+			}
+			for _, code := range test.expected.codes {
+				if _, ok := codes[code]; !ok {
+					t.Errorf("expected retry codes %v, actual: %v", test.expected.codes, codes)
+				}
+			}
+			if num != test.expected.num {
+				t.Errorf("expected retry num %v, actual: %v", test.expected.num, num)
+			}
+			if len(warnings) != test.expected.warnings {
+				t.Errorf("expected %v warnings, actual: %v", test.expected.warnings, warnings)
+			}
+		})
+	}
+}
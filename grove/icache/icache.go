@@ -29,3 +29,15 @@ type Cache interface {
 	Size() uint64
 	Close()
 }
+
+// ChunkWriter is implemented by caches which store the chunks of chunked objects separately from the objects, so a large object's body can be written to the cache chunk by chunk as it's received from the origin, rather than held in memory until it's complete.
+//
+// The chunks written with AddChunk aren't visible until an object with the same ChunkID is Added for the key. If the object can't be completed, for example because the origin failed mid-transfer, AbortChunks must be called to remove the chunks already written.
+type ChunkWriter interface {
+	// AddChunk stores chunk i of the object being written for key with the given chunkID.
+	AddChunk(key string, chunkID string, i int, chunk []byte) error
+	// AbortChunks removes the first n chunks written for key with the given chunkID.
+	AbortChunks(key string, chunkID string, n int)
+	// ChunkSource returns a func which reads the chunks written for key with the given chunkID, to be used as the ChunkSource of the object.
+	ChunkSource(key string, chunkID string) func(i int) ([]byte, error)
+}
@@ -0,0 +1,386 @@
+package parenthealth
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// parenthealth tracks the health of remap rule parents, so requests skip parents which are down, like ATS parent.config.
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+const DefaultFailThreshold = 10
+const DefaultRetryTime = 10 * time.Second
+const DefaultMaxRetryTime = 5 * time.Minute
+const DefaultCheckInterval = 10 * time.Second
+const DefaultCheckTimeout = 5 * time.Second
+
+// ConfigJSON is the parent health configuration in the remap rules file, at the global or rule level.
+type ConfigJSON struct {
+	// FailThreshold is the number of consecutive failures after which a parent is marked down. If it's negative, parents are never marked down.
+	FailThreshold *int `json:"fail_threshold"`
+	// RetryTimeMS is how long after a parent is marked down a single request is sent to it again, to see if it's back up.
+	RetryTimeMS *int `json:"retry_time_ms"`
+	// MaxRetryTimeMS is the maximum retry time. Each time a retry fails, the retry time doubles, up to this maximum.
+	MaxRetryTimeMS *int `json:"max_retry_time_ms"`
+	// CheckPath is the path to request from each parent to actively check its health. If it's empty, parents are only checked passively, by the results of client requests.
+	CheckPath *string `json:"check_path"`
+	// CheckIntervalMS is how often to request the CheckPath.
+	CheckIntervalMS *int `json:"check_interval_ms"`
+	// CheckTimeoutMS is the timeout of CheckPath requests.
+	CheckTimeoutMS *int `json:"check_timeout_ms"`
+}
+
+// Config is the parent health configuration of a parent.
+type Config struct {
+	FailThreshold int
+	RetryTime     time.Duration
+	MaxRetryTime  time.Duration
+	CheckPath     string
+	CheckInterval time.Duration
+	CheckTimeout  time.Duration
+}
+
+// DefaultConfig returns the default Config, which tracks parents passively, without active checks.
+func DefaultConfig() Config {
+	return Config{
+		FailThreshold: DefaultFailThreshold,
+		RetryTime:     DefaultRetryTime,
+		MaxRetryTime:  DefaultMaxRetryTime,
+		CheckInterval: DefaultCheckInterval,
+		CheckTimeout:  DefaultCheckTimeout,
+	}
+}
+
+// Apply returns the given Config, with the fields set in the ConfigJSON overriding it. This allows rule configs to override global configs.
+func (j ConfigJSON) Apply(cfg Config) Config {
+	ms := func(i int) time.Duration { return time.Duration(i) * time.Millisecond }
+	if j.FailThreshold != nil {
+		cfg.FailThreshold = *j.FailThreshold
+	}
+	if j.RetryTimeMS != nil {
+		cfg.RetryTime = ms(*j.RetryTimeMS)
+	}
+	if j.MaxRetryTimeMS != nil {
+		cfg.MaxRetryTime = ms(*j.MaxRetryTimeMS)
+	}
+	if j.CheckPath != nil {
+		cfg.CheckPath = *j.CheckPath
+	}
+	if j.CheckIntervalMS != nil {
+		cfg.CheckInterval = ms(*j.CheckIntervalMS)
+	}
+	if j.CheckTimeoutMS != nil {
+		cfg.CheckTimeout = ms(*j.CheckTimeoutMS)
+	}
+	if cfg.MaxRetryTime < cfg.RetryTime {
+		cfg.MaxRetryTime = cfg.RetryTime
+	}
+	return cfg
+}
+
+// Validate returns an error if the Config is invalid.
+func (c Config) Validate() error {
+	if c.RetryTime < 0 || c.MaxRetryTime < 0 || c.CheckTimeout < 0 {
+		return errors.New("times must not be negative")
+	}
+	if c.CheckPath != "" && c.CheckInterval <= 0 {
+		return errors.New("check_interval_ms must be positive with a check_path")
+	}
+	return nil
+}
+
+// Status is the health of a parent, as served by the stats endpoint.
+type Status struct {
+	Name      string    `json:"name"`
+	Available bool      `json:"available"`
+	FailCount int       `json:"fail_count"`
+	DownSince time.Time `json:"down_since"`
+	RetryAt   time.Time `json:"retry_at"`
+}
+
+// Parent is the health of a single parent, shared by every remap rule with that parent. A nil *Parent is always available, and ignores results.
+type Parent struct {
+	name      string
+	m         sync.Mutex
+	cfg       Config
+	failCount int
+	down      bool
+	downSince time.Time
+	retryAt   time.Time
+	retryTime time.Duration
+	checkURL  string
+	transport *http.Transport
+	checkStop chan struct{}
+}
+
+// Available returns whether the parent may be requested at the given time. A parent which is down becomes available once its retry time has passed, for a single request; if that request fails, the retry time doubles.
+func (p *Parent) Available(now time.Time) bool {
+	if p == nil {
+		return true
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	if !p.down {
+		return true
+	}
+	if now.Before(p.retryAt) {
+		return false
+	}
+	p.retryAt = now.Add(p.retryTime) // only let one request retry the parent per retry time
+	return true
+}
+
+// Success records a successful request to the parent, marking it up.
+func (p *Parent) Success() {
+	if p == nil {
+		return
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.down {
+		log.Infof("parent '%v' marked up, after being down since %v\n", p.name, p.downSince.Format(time.RFC3339))
+	}
+	p.failCount = 0
+	p.down = false
+	p.downSince = time.Time{}
+	p.retryAt = time.Time{}
+	p.retryTime = 0
+}
+
+// Failure records a failed request to the parent at the given time. After the configured number of consecutive failures, the parent is marked down.
+func (p *Parent) Failure(now time.Time) {
+	if p == nil {
+		return
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.failCount++
+	if p.cfg.FailThreshold < 0 {
+		return
+	}
+	if !p.down {
+		if p.failCount < p.cfg.FailThreshold {
+			return
+		}
+		log.Warnf("parent '%v' marked down, after %v consecutive failures\n", p.name, p.failCount)
+		p.down = true
+		p.downSince = now
+		p.retryTime = p.cfg.RetryTime
+	} else if p.retryTime *= 2; p.retryTime > p.cfg.MaxRetryTime {
+		p.retryTime = p.cfg.MaxRetryTime
+	}
+	p.retryAt = now.Add(p.retryTime)
+}
+
+// Status returns the current health of the parent.
+func (p *Parent) Status() Status {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return Status{Name: p.name, Available: !p.down, FailCount: p.failCount, DownSince: p.downSince, RetryAt: p.retryAt}
+}
+
+// setConfig sets the parent's config, and starts or stops its active checks. It must be called with the lock held.
+func (p *Parent) setConfig(cfg Config, url string, transport *http.Transport) {
+	p.cfg = cfg
+	p.checkURL = strings.TrimSuffix(url, "/") + "/" + strings.TrimPrefix(cfg.CheckPath, "/")
+	p.transport = transport
+	if cfg.CheckPath == "" {
+		p.stopChecks()
+	} else if p.checkStop == nil {
+		p.checkStop = make(chan struct{})
+		go p.check(p.checkStop)
+	}
+}
+
+// stopChecks stops the parent's active checks, if any. It must be called with the lock held.
+func (p *Parent) stopChecks() {
+	if p.checkStop != nil {
+		close(p.checkStop)
+		p.checkStop = nil
+	}
+}
+
+// check requests the parent's check URL every check interval, recording the result, until stop is closed. Any 2xx response is a success.
+func (p *Parent) check(stop <-chan struct{}) {
+	for {
+		p.m.Lock()
+		interval, timeout, url, transport := p.cfg.CheckInterval, p.cfg.CheckTimeout, p.checkURL, p.transport
+		p.m.Unlock()
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+
+		client := &http.Client{Transport: transport, Timeout: timeout}
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = errors.New("returned " + strconv.Itoa(resp.StatusCode))
+			}
+		}
+		if err != nil {
+			log.Debugf("parent '%v' health check '%v' failed: %v\n", p.name, url, err)
+			p.Failure(time.Now())
+			continue
+		}
+		p.Success()
+	}
+}
+
+// Parents is the health of every parent in the remap rules. Parents are kept across remap rule reloads, so a reload doesn't forget which parents are down.
+type Parents struct {
+	parents map[string]*Parent
+	m       sync.Mutex
+}
+
+// NewParents creates a new, empty Parents.
+func NewParents() *Parents {
+	return &Parents{parents: map[string]*Parent{}}
+}
+
+// Get returns the Parent with the given name, creating it if it doesn't exist, and sets its config. If the config has a CheckPath, the parent is actively checked, by requesting the CheckPath from the given URL with the given transport. A nil *Parents returns a nil *Parent.
+func (ps *Parents) Get(name string, cfg Config, url string, transport *http.Transport) *Parent {
+	if ps == nil {
+		return nil
+	}
+	ps.m.Lock()
+	defer ps.m.Unlock()
+	p, ok := ps.parents[name]
+	if !ok {
+		p = &Parent{name: name}
+		ps.parents[name] = p
+	}
+	p.m.Lock()
+	p.setConfig(cfg, url, transport)
+	p.m.Unlock()
+	return p
+}
+
+// Retain removes the parents whose names aren't in the given set, stopping their active checks. This should be called after the remap rules are reloaded, with the names of their parents.
+func (ps *Parents) Retain(names map[string]struct{}) {
+	if ps == nil {
+		return
+	}
+	ps.m.Lock()
+	defer ps.m.Unlock()
+	for name, p := range ps.parents {
+		if _, ok := names[name]; ok {
+			continue
+		}
+		p.m.Lock()
+		p.stopChecks()
+		p.m.Unlock()
+		delete(ps.parents, name)
+	}
+}
+
+// Load stages the parents of a remap rules load, so a load which fails doesn't change the parents' configs or start their checks. Parents which already exist are shared with the load, so their health is kept, but nothing is changed until Commit.
+type Load struct {
+	ps      *Parents
+	parents map[string]*loadParent
+}
+
+type loadParent struct {
+	parent    *Parent
+	rule      string
+	cfg       Config
+	url       string
+	transport *http.Transport
+}
+
+// Load starts staging a remap rules load. A nil *Parents returns a nil *Load, whose parents are nil.
+func (ps *Parents) Load() *Load {
+	if ps == nil {
+		return nil
+	}
+	return &Load{ps: ps, parents: map[string]*loadParent{}}
+}
+
+// Get returns the Parent with the given name for the given rule, which is the existing Parent if there is one. Its config isn't set until Commit.
+// Parents are shared by every rule, so it returns an error if a previous rule in the load has the same parent with a different config.
+func (l *Load) Get(name string, rule string, cfg Config, url string, transport *http.Transport) (*Parent, error) {
+	if l == nil {
+		return nil, nil
+	}
+	if lp, ok := l.parents[name]; ok {
+		if lp.cfg != cfg {
+			return nil, errors.New("parent '" + name + "' has a different parent_health than in rule '" + lp.rule + "'; rules with the same parent must have the same parent_health")
+		}
+		return lp.parent, nil
+	}
+	l.ps.m.Lock()
+	p, ok := l.ps.parents[name]
+	l.ps.m.Unlock()
+	if !ok {
+		p = &Parent{name: name}
+	}
+	l.parents[name] = &loadParent{parent: p, rule: rule, cfg: cfg, url: url, transport: transport}
+	return p, nil
+}
+
+// Commit sets the configs of the loaded parents and starts their checks, and removes the parents which aren't in the load, stopping their checks. It must only be called once the load has succeeded.
+func (l *Load) Commit() {
+	if l == nil {
+		return
+	}
+	l.ps.m.Lock()
+	defer l.ps.m.Unlock()
+	for name, p := range l.ps.parents {
+		if lp, ok := l.parents[name]; ok && lp.parent == p {
+			continue
+		}
+		p.m.Lock()
+		p.stopChecks()
+		p.m.Unlock()
+		delete(l.ps.parents, name)
+	}
+	for name, lp := range l.parents {
+		l.ps.parents[name] = lp.parent
+		lp.parent.m.Lock()
+		lp.parent.setConfig(lp.cfg, lp.url, lp.transport)
+		lp.parent.m.Unlock()
+	}
+}
+
+// Status returns the health of every parent, sorted by name.
+func (ps *Parents) Status() []Status {
+	if ps == nil {
+		return nil
+	}
+	ps.m.Lock()
+	parents := make([]*Parent, 0, len(ps.parents))
+	for _, p := range ps.parents {
+		parents = append(parents, p)
+	}
+	ps.m.Unlock()
+
+	statuses := make([]Status, 0, len(parents))
+	for _, p := range parents {
+		statuses = append(statuses, p.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
@@ -0,0 +1,174 @@
+package parenthealth
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParentFailover(t *testing.T) {
+	threshold := 3
+	retryMS := 1000
+	maxRetryMS := 3000
+	cfg := ConfigJSON{FailThreshold: &threshold, RetryTimeMS: &retryMS, MaxRetryTimeMS: &maxRetryMS}.Apply(DefaultConfig())
+
+	parents := NewParents()
+	p := parents.Get("http://parent.example.net", cfg, "http://parent.example.net", nil)
+	now := time.Now()
+
+	for i := 0; i < threshold-1; i++ {
+		p.Failure(now)
+	}
+	if !p.Available(now) {
+		t.Fatalf("Available after %v failures with threshold %v expected true, actual false", threshold-1, threshold)
+	}
+	p.Failure(now)
+	if p.Available(now) {
+		t.Fatalf("Available after %v failures with threshold %v expected false, actual true", threshold, threshold)
+	}
+
+	retryAt := now.Add(time.Second)
+	if !p.Available(retryAt) {
+		t.Errorf("Available after retry time expected true, actual false")
+	}
+	if p.Available(retryAt) {
+		t.Errorf("Available after retry time for a second request expected false, actual true")
+	}
+
+	p.Failure(retryAt) // the retry failed, so the retry time doubles
+	if p.Available(retryAt.Add(time.Second)) {
+		t.Errorf("Available after failed retry, before doubled retry time expected false, actual true")
+	}
+	if !p.Available(retryAt.Add(2 * time.Second)) {
+		t.Errorf("Available after failed retry, after doubled retry time expected true, actual false")
+	}
+
+	p.Failure(retryAt)
+	p.Failure(retryAt)
+	if status := p.Status(); status.RetryAt != retryAt.Add(3*time.Second) {
+		t.Errorf("retry time expected capped at max %v, actual retry at %v", 3*time.Second, status.RetryAt.Sub(retryAt))
+	}
+
+	p.Success()
+	if status := p.Status(); !status.Available || status.FailCount != 0 || !status.DownSince.IsZero() {
+		t.Errorf("Status after success expected available with no failures, actual %+v", status)
+	}
+	if !p.Available(retryAt) {
+		t.Errorf("Available after success expected true, actual false")
+	}
+}
+
+func TestParentNil(t *testing.T) {
+	p := (*Parents)(nil).Get("foo", DefaultConfig(), "http://foo", nil)
+	p.Failure(time.Now())
+	p.Success()
+	if !p.Available(time.Now()) {
+		t.Errorf("nil Parent Available expected true, actual false")
+	}
+}
+
+func TestParentsRetain(t *testing.T) {
+	parents := NewParents()
+	parents.Get("foo", DefaultConfig(), "http://foo", nil)
+	parents.Get("bar", DefaultConfig(), "http://bar", nil)
+	parents.Retain(map[string]struct{}{"bar": {}})
+	statuses := parents.Status()
+	if len(statuses) != 1 || statuses[0].Name != "bar" {
+		t.Errorf("Status after Retain expected only 'bar', actual %+v", statuses)
+	}
+}
+
+func TestParentCheck(t *testing.T) {
+	healthy := int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	threshold := 1
+	path := "/health"
+	intervalMS := 5
+	cfg := ConfigJSON{FailThreshold: &threshold, CheckPath: &path, CheckIntervalMS: &intervalMS}.Apply(DefaultConfig())
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate expected nil error, actual %v", err)
+	}
+
+	parents := NewParents()
+	defer parents.Retain(nil)
+	p := parents.Get(srv.URL, cfg, srv.URL, &http.Transport{})
+
+	waitFor := func(available bool) {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if p.Status().Available == available {
+				return
+			}
+		}
+		t.Fatalf("health check expected parent available %v, actual %+v", available, p.Status())
+	}
+	waitFor(false)
+	atomic.StoreInt32(&healthy, 1)
+	waitFor(true)
+}
+
+func TestParentsLoad(t *testing.T) {
+	parents := NewParents()
+	old := parents.Get("foo", DefaultConfig(), "http://foo", nil)
+	old.Failure(time.Now())
+
+	path := "/health"
+	checkCfg := ConfigJSON{CheckPath: &path}.Apply(DefaultConfig())
+
+	failed := parents.Load()
+	if p, err := failed.Get("foo", "rule0", checkCfg, "http://foo", nil); err != nil || p != old {
+		t.Fatalf("Load.Get expected the existing parent, actual %p error %v", p, err)
+	}
+	if _, err := failed.Get("foo", "rule1", DefaultConfig(), "http://foo", nil); err == nil {
+		t.Errorf("Load.Get expected an error for a parent with a different config in another rule, actual nil")
+	}
+	if _, err := failed.Get("bar", "rule1", DefaultConfig(), "http://bar", nil); err != nil {
+		t.Fatalf("Load.Get expected nil error, actual %v", err)
+	}
+	// the load failed, so it isn't committed
+	if old.checkStop != nil || old.cfg.CheckPath != "" {
+		t.Errorf("expected an uncommitted load to not change the parent's config, actual %+v", old.cfg)
+	}
+	if statuses := parents.Status(); len(statuses) != 1 || statuses[0].Name != "foo" || statuses[0].FailCount != 1 {
+		t.Errorf("expected an uncommitted load to not change the parents, actual %+v", statuses)
+	}
+
+	load := parents.Load()
+	if _, err := load.Get("bar", "rule0", DefaultConfig(), "http://bar", nil); err != nil {
+		t.Fatalf("Load.Get expected nil error, actual %v", err)
+	}
+	if _, err := load.Get("bar", "rule1", DefaultConfig(), "http://bar", nil); err != nil {
+		t.Errorf("Load.Get expected nil error for a parent with the same config in another rule, actual %v", err)
+	}
+	load.Commit()
+	if statuses := parents.Status(); len(statuses) != 1 || statuses[0].Name != "bar" {
+		t.Errorf("expected a committed load to replace the parents, actual %+v", statuses)
+	}
+
+	if p, err := (*Parents)(nil).Load().Get("foo", "rule0", DefaultConfig(), "http://foo", nil); p != nil || err != nil {
+		t.Errorf("nil Parents Load.Get expected a nil parent and error, actual %p %v", p, err)
+	}
+}
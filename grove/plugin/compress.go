@@ -0,0 +1,335 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+
+	"github.com/andybalholm/brotli"
+)
+
+func init() {
+	AddPlugin(7000, Funcs{load: compressLoad, beforeCacheLookUp: compressCacheKey, beforeParentRequest: compressParentRequest, beforeRespond: compress})
+}
+
+const CompressAlgorithmBrotli = "br"
+const CompressAlgorithmGzip = "gzip"
+
+// CompressCacheKeySeparator separates the cache key of the identity object from the content encoding, in the cache keys of compressed variants.
+const CompressCacheKeySeparator = "#ce="
+
+// CompressDefaultMinSizeBytes is the default size below which bodies aren't compressed, because compressing them saves little or nothing.
+const CompressDefaultMinSizeBytes = 1024
+
+var CompressDefaultAlgorithms = []string{CompressAlgorithmBrotli, CompressAlgorithmGzip}
+
+var CompressDefaultMimeTypes = []string{"text/*", "application/javascript", "application/json", "application/xml", "image/svg+xml"}
+
+// CompressConfig is the compress plugin config, at the global or rule level.
+type CompressConfig struct {
+	// Algorithms is the content encodings to compress with, in order of preference, when the client accepts more than one with the same quality. The default is br, then gzip.
+	Algorithms []string `json:"algorithms"`
+	// MimeTypes is the Content-Types of responses to compress, which may be wildcards such as "text/*". The default is text, JavaScript, JSON, XML, and SVG.
+	MimeTypes []string `json:"mime_types"`
+	// MinSizeBytes is the size below which bodies aren't compressed. If omitted, CompressDefaultMinSizeBytes is used.
+	MinSizeBytes *int `json:"min_size_bytes"`
+}
+
+type compressConfig struct {
+	algorithms   []string
+	mimeTypes    []rfc.MimeType
+	minSizeBytes int
+}
+
+// compressLoad loads the compress config. If the config is invalid, it returns nil, so nothing is compressed.
+func compressLoad(b json.RawMessage) interface{} {
+	cfg := CompressConfig{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		log.Errorln("compress loading config, unmarshalling JSON: " + err.Error())
+		return nil
+	}
+	ccfg, err := makeCompressConfig(cfg)
+	if err != nil {
+		log.Errorln("compress loading config: " + err.Error())
+		return nil
+	}
+	log.Debugf("compress load success: %+v\n", ccfg)
+	return ccfg
+}
+
+func makeCompressConfig(cfg CompressConfig) (*compressConfig, error) {
+	ccfg := &compressConfig{algorithms: cfg.Algorithms, minSizeBytes: CompressDefaultMinSizeBytes}
+	if len(ccfg.algorithms) == 0 {
+		ccfg.algorithms = CompressDefaultAlgorithms
+	}
+	for _, alg := range ccfg.algorithms {
+		if alg != CompressAlgorithmBrotli && alg != CompressAlgorithmGzip {
+			return nil, errors.New("unknown algorithm '" + alg + "', must be " + CompressAlgorithmBrotli + " or " + CompressAlgorithmGzip)
+		}
+	}
+	mimeTypes := cfg.MimeTypes
+	if len(mimeTypes) == 0 {
+		mimeTypes = CompressDefaultMimeTypes
+	}
+	for _, mimeTypeStr := range mimeTypes {
+		mimeType, err := rfc.NewMimeType(mimeTypeStr)
+		if err != nil {
+			return nil, errors.New("parsing mime type '" + mimeTypeStr + "': " + err.Error())
+		}
+		ccfg.mimeTypes = append(ccfg.mimeTypes, mimeType)
+	}
+	if cfg.MinSizeBytes != nil {
+		if *cfg.MinSizeBytes < 0 {
+			return nil, errors.New("min_size_bytes must not be negative")
+		}
+		ccfg.minSizeBytes = *cfg.MinSizeBytes
+	}
+	return ccfg, nil
+}
+
+func getCompressConfig(icfg interface{}) (*compressConfig, bool) {
+	if icfg == nil {
+		return nil, false
+	}
+	cfg, ok := icfg.(*compressConfig)
+	if !ok {
+		// should never happen
+		log.Errorf("compress config '%v' type '%T' expected *compressConfig\n", icfg, icfg)
+		return nil, false
+	}
+	return cfg, true
+}
+
+// compressCacheKey caches the variant for the content encoding negotiated with the client separately from the identity object. Range requests always use the identity object, so ranges are of the same bytes for every client.
+// The cache key is only changed for objects which are compressed, so objects which aren't compressible aren't cached once per encoding. If the identity object is cached and compressible, its variant is compressed from it, unless the variant is already cached. If the identity object isn't cached, the cached variant is used if there is one, and otherwise the identity object is requested, and compressed for later requests.
+func compressCacheKey(icfg interface{}, d BeforeCacheLookUpData) {
+	cfg, ok := getCompressConfig(icfg)
+	if !ok {
+		return
+	}
+	if d.Req.Method != http.MethodGet || d.Req.Header.Get("Range") != "" || d.Cache == nil {
+		return
+	}
+	enc := negotiateEncoding(d.Req.Header.Get(rfc.AcceptEncoding), cfg.algorithms)
+	if enc == "" {
+		return
+	}
+	key := d.DefaultCacheKey + CompressCacheKeySeparator + enc
+	variant, variantOK := d.Cache.Peek(key)
+	variantOK = variantOK && variant.RespHeaders.Get(rfc.ContentEncoding) == enc
+
+	identity, ok := d.Cache.Peek(d.DefaultCacheKey)
+	if !ok {
+		if variantOK {
+			d.CacheKeyOverrideFunc(key)
+		}
+		return
+	}
+	if !cfg.compressibleObj(identity) {
+		return
+	}
+	if !variantOK {
+		body, err := compressBody(enc, identity.Body)
+		if err != nil {
+			log.Errorln("compress compressing '" + d.DefaultCacheKey + "': " + err.Error())
+			return
+		}
+		d.Cache.Add(key, compressedObj(identity, enc, body))
+	}
+	d.CacheKeyOverrideFunc(key)
+}
+
+// compressParentRequest removes the Accept-Encoding from parent requests, so the parent always sends the identity object, which this plugin compresses. Otherwise, a parent could send an encoding some of the clients of a variant don't accept.
+func compressParentRequest(icfg interface{}, d BeforeParentRequestData) {
+	if _, ok := getCompressConfig(icfg); !ok {
+		return
+	}
+	d.Req.Header.Del(rfc.AcceptEncoding)
+}
+
+// compress compresses the response body with the encoding of the cache key variant, and replaces the cached identity object of the variant with the compressed object, so it's only compressed once.
+func compress(icfg interface{}, d BeforeRespondData) {
+	cfg, ok := getCompressConfig(icfg)
+	if !ok {
+		return
+	}
+	if *d.Code != http.StatusOK || *d.Body == nil {
+		return // streamed bodies are nil, and aren't compressed
+	}
+	if (*d.Hdr).Get(rfc.ContentEncoding) != "" {
+		return // already compressed, or encoded by the parent
+	}
+	if !cfg.compressible((*d.Hdr).Get(rfc.ContentType)) {
+		return
+	}
+
+	// identity responses vary too, so downstream caches don't serve them to clients which accept compression
+	*d.Hdr = web.CopyHeader(*d.Hdr)
+	addVaryAcceptEncoding(*d.Hdr)
+
+	enc := ""
+	if i := strings.LastIndex(d.CacheKey, CompressCacheKeySeparator); i >= 0 {
+		enc = d.CacheKey[i+len(CompressCacheKeySeparator):]
+	}
+	if enc == "" || len(*d.Body) < cfg.minSizeBytes {
+		return
+	}
+
+	body, err := compressBody(enc, *d.Body)
+	if err != nil {
+		log.Errorln("compress rule " + d.RemapRule + " compressing '" + d.CacheKey + "': " + err.Error())
+		return
+	}
+	setCompressedHeaders(*d.Hdr, enc, len(body))
+	*d.Body = body
+
+	if d.Cache == nil || d.CacheObj == nil || d.CacheObj.Chunked {
+		return
+	}
+	// disk caches return a new object for every read, so the cached object is identified by its request time
+	if cached, ok := d.Cache.Peek(d.CacheKey); !ok || !cached.ReqRespTime.Equal(d.CacheObj.ReqRespTime) || cached.RespHeaders.Get(rfc.ContentEncoding) != "" {
+		return // the object wasn't cached, or was replaced since it was fetched
+	}
+	d.Cache.Add(d.CacheKey, compressedObj(d.CacheObj, enc, body))
+}
+
+// compressedObj returns a copy of the identity object, with the given body compressed with the given encoding.
+func compressedObj(identity *cacheobj.CacheObj, enc string, body []byte) *cacheobj.CacheObj {
+	obj := *identity
+	obj.Body = body
+	obj.RespHeaders = web.CopyHeader(identity.RespHeaders)
+	addVaryAcceptEncoding(obj.RespHeaders)
+	setCompressedHeaders(obj.RespHeaders, enc, len(body))
+	obj.Size = obj.ComputeSize()
+	return &obj
+}
+
+// compressibleObj returns whether the given cached identity object is compressed by the config. Chunked objects, whose bodies aren't in memory, aren't.
+func (cfg *compressConfig) compressibleObj(obj *cacheobj.CacheObj) bool {
+	return obj.Code == http.StatusOK &&
+		!obj.Chunked &&
+		obj.Body != nil &&
+		len(obj.Body) >= cfg.minSizeBytes &&
+		obj.RespHeaders.Get(rfc.ContentEncoding) == "" &&
+		cfg.compressible(obj.RespHeaders.Get(rfc.ContentType))
+}
+
+// compressible returns whether the given Content-Type is one of the config's MIME types.
+func (cfg *compressConfig) compressible(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mimeType, err := rfc.NewMimeType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range cfg.mimeTypes {
+		if mimeType.Satisfy(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding returns the algorithm the client accepts with the highest quality, preferring earlier algorithms for the same quality, or the empty string if the client accepts none of them.
+func negotiateEncoding(acceptEncoding string, algorithms []string) string {
+	qualities := map[string]float64{}
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(coding, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			pq, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+			if err != nil {
+				pq = 0
+			}
+			q = pq
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, alg := range algorithms {
+		q, ok := qualities[alg]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = alg, q
+		}
+	}
+	return best
+}
+
+func compressBody(enc string, body []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := io.WriteCloser(nil)
+	switch enc {
+	case CompressAlgorithmBrotli:
+		w = brotli.NewWriter(buf)
+	case CompressAlgorithmGzip:
+		w = gzip.NewWriter(buf)
+	default:
+		return nil, errors.New("unknown algorithm '" + enc + "'")
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, errors.New("writing: " + err.Error())
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.New("closing: " + err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// setCompressedHeaders sets the headers of a body compressed with the given encoding. Strong ETags are made weak, because the compressed body isn't byte-for-byte the origin's.
+func setCompressedHeaders(hdr http.Header, enc string, size int) {
+	hdr.Set(rfc.ContentEncoding, enc)
+	hdr.Set("Content-Length", strconv.Itoa(size))
+	if etag := hdr.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		hdr.Set("ETag", "W/"+etag)
+	}
+}
+
+func addVaryAcceptEncoding(hdr http.Header) {
+	for _, vary := range hdr[rfc.Vary] {
+		for _, name := range strings.Split(vary, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" || strings.EqualFold(name, rfc.AcceptEncoding) {
+				return
+			}
+		}
+	}
+	hdr.Add(rfc.Vary, rfc.AcceptEncoding)
+}
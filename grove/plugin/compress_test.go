@@ -0,0 +1,184 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/memcache"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	algorithms := []string{CompressAlgorithmBrotli, CompressAlgorithmGzip}
+	for acceptEncoding, expected := range map[string]string{
+		"":                           "",
+		"identity":                   "",
+		"gzip":                       "gzip",
+		"gzip, deflate, br":          "br",
+		"br;q=0.5, gzip":             "gzip",
+		"br;q=0, gzip;q=0":           "",
+		"GZIP":                       "gzip",
+		"*":                          "br",
+		"*;q=0.1, gzip;q=0.5":        "gzip",
+		"br;q=0.8, gzip;q=0.8":       "br",
+		"deflate, br;q=bad, gzip;q=": "",
+	} {
+		if actual := negotiateEncoding(acceptEncoding, algorithms); actual != expected {
+			t.Errorf("negotiateEncoding '%v' expected '%v', actual '%v'", acceptEncoding, expected, actual)
+		}
+	}
+}
+
+func TestCompressCacheKey(t *testing.T) {
+	icfg := compressLoad(json.RawMessage(`{"min_size_bytes": 100}`))
+	body := []byte(strings.Repeat("compress me ", 100))
+	textHdr := http.Header{"Content-Type": {"text/plain"}}
+	newObj := func(hdr http.Header, body []byte) *cacheobj.CacheObj {
+		return cacheobj.New(nil, body, http.StatusOK, http.StatusOK, "", hdr, time.Now(), time.Now(), time.Now(), time.Now())
+	}
+	chunked := newObj(textHdr, nil)
+	chunked.Chunked = true
+
+	for _, test := range []struct {
+		name     string
+		hdr      http.Header
+		cached   map[string]*cacheobj.CacheObj
+		expected string
+	}{
+		{"identity", http.Header{}, map[string]*cacheobj.CacheObj{"key": newObj(textHdr, body)}, "key"},
+		{"br", http.Header{"Accept-Encoding": {"gzip, br"}}, map[string]*cacheobj.CacheObj{"key": newObj(textHdr, body)}, "key#ce=br"},
+		{"gzip", http.Header{"Accept-Encoding": {"gzip"}}, map[string]*cacheobj.CacheObj{"key": newObj(textHdr, body)}, "key#ce=gzip"},
+		{"range", http.Header{"Accept-Encoding": {"gzip"}, "Range": {"bytes=0-10"}}, map[string]*cacheobj.CacheObj{"key": newObj(textHdr, body)}, "key"},
+		{"not cached", http.Header{"Accept-Encoding": {"gzip"}}, nil, "key"},
+		{"variant cached", http.Header{"Accept-Encoding": {"gzip"}}, map[string]*cacheobj.CacheObj{"key#ce=gzip": newObj(http.Header{"Content-Type": {"text/plain"}, "Content-Encoding": {"gzip"}}, body)}, "key#ce=gzip"},
+		{"uncompressed variant cached", http.Header{"Accept-Encoding": {"gzip"}}, map[string]*cacheobj.CacheObj{"key#ce=gzip": newObj(textHdr, body)}, "key"},
+		{"not allowed type", http.Header{"Accept-Encoding": {"gzip"}}, map[string]*cacheobj.CacheObj{"key": newObj(http.Header{"Content-Type": {"image/png"}}, body)}, "key"},
+		{"too small", http.Header{"Accept-Encoding": {"gzip"}}, map[string]*cacheobj.CacheObj{"key": newObj(textHdr, body[:99])}, "key"},
+		{"chunked", http.Header{"Accept-Encoding": {"gzip"}}, map[string]*cacheobj.CacheObj{"key": chunked}, "key"},
+	} {
+		cache := memcache.New(1024 * 1024)
+		for key, obj := range test.cached {
+			cache.Add(key, obj)
+		}
+		actual := "key"
+		req := &http.Request{Method: http.MethodGet, Header: test.hdr}
+		compressCacheKey(icfg, BeforeCacheLookUpData{Req: req, DefaultCacheKey: "key", CacheKeyOverrideFunc: func(key string) { actual = key }, Cache: cache})
+		if actual != test.expected {
+			t.Errorf("compressCacheKey %v expected key '%v', actual '%v'", test.name, test.expected, actual)
+			continue
+		}
+		if actual == "key" {
+			continue
+		}
+		if obj, ok := cache.Peek(actual); !ok || obj.RespHeaders.Get("Content-Encoding") == "" {
+			t.Errorf("compressCacheKey %v expected compressed variant cached, actual %+v", test.name, obj)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	icfg := compressLoad(json.RawMessage(`{"mime_types": ["text/*", "application/json"], "min_size_bytes": 100}`))
+	if icfg == nil {
+		t.Fatalf("compressLoad expected config, actual nil")
+	}
+	body := []byte(strings.Repeat("compress me ", 100))
+	hdr := http.Header{"Content-Type": {"text/plain; charset=utf-8"}, "Etag": {`"abc"`}}
+
+	// respond runs the plugin with an object for the given cache key, cached if cache isn't nil, returning the response headers and body.
+	respond := func(icfg interface{}, cache *memcache.MemCache, key string, code int, hdr http.Header, body []byte) (http.Header, []byte) {
+		obj := cacheobj.New(nil, body, code, code, "", hdr, time.Now(), time.Now(), time.Now(), time.Now())
+		d := BeforeRespondData{Req: &http.Request{Method: http.MethodGet}, CacheObj: obj, CacheKey: key}
+		if cache != nil {
+			cache.Add(key, obj)
+			d.Cache = cache
+		}
+		codePtr, hdrPtr, bodyPtr := obj.Code, obj.RespHeaders, obj.Body
+		d.Code, d.Hdr, d.Body = &codePtr, &hdrPtr, &bodyPtr
+		compress(icfg, d)
+		return hdrPtr, bodyPtr
+	}
+
+	cache := memcache.New(1024 * 1024)
+	respHdr, respBody := respond(icfg, cache, "key#ce=gzip", http.StatusOK, hdr, body)
+	if actual := respHdr.Get("Content-Encoding"); actual != "gzip" {
+		t.Fatalf("compress gzip expected Content-Encoding gzip, actual '%v'", actual)
+	}
+	if actual := respHdr.Get("Vary"); actual != "Accept-Encoding" {
+		t.Errorf("compress gzip expected Vary Accept-Encoding, actual '%v'", actual)
+	}
+	if actual := respHdr.Get("Etag"); actual != `W/"abc"` {
+		t.Errorf("compress gzip expected weak ETag, actual '%v'", actual)
+	}
+	if hdr.Get("Content-Encoding") != "" || hdr.Get("Vary") != "" {
+		t.Errorf("compress modified the object's headers")
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(respBody))
+	if err != nil {
+		t.Fatalf("compress gzip reading body: %v", err)
+	}
+	if decompressed, err := ioutil.ReadAll(gr); err != nil || !bytes.Equal(decompressed, body) {
+		t.Errorf("compress gzip expected body to decompress to the original, actual err %v", err)
+	}
+	cached, ok := cache.Get("key#ce=gzip")
+	if !ok || cached.RespHeaders.Get("Content-Encoding") != "gzip" || !bytes.Equal(cached.Body, respBody) {
+		t.Errorf("compress gzip expected the compressed variant to replace the cached object")
+	}
+
+	respHdr, respBody = respond(icfg, nil, "key#ce=br", http.StatusOK, hdr, body)
+	if actual := respHdr.Get("Content-Encoding"); actual != "br" {
+		t.Fatalf("compress br expected Content-Encoding br, actual '%v'", actual)
+	}
+	if decompressed, err := ioutil.ReadAll(brotli.NewReader(bytes.NewReader(respBody))); err != nil || !bytes.Equal(decompressed, body) {
+		t.Errorf("compress br expected body to decompress to the original, actual err %v", err)
+	}
+
+	for _, test := range []struct {
+		name string
+		key  string
+		code int
+		hdr  http.Header
+		body []byte
+		vary bool
+	}{
+		{"identity", "key", http.StatusOK, hdr, body, true},
+		{"too small", "key#ce=gzip", http.StatusOK, hdr, body[:99], true},
+		{"not allowed type", "key#ce=gzip", http.StatusOK, http.Header{"Content-Type": {"image/png"}}, body, false},
+		{"no type", "key#ce=gzip", http.StatusOK, http.Header{}, body, false},
+		{"error", "key#ce=gzip", http.StatusNotFound, hdr, body, false},
+		{"encoded", "key#ce=gzip", http.StatusOK, http.Header{"Content-Type": {"text/plain"}, "Content-Encoding": {"gzip"}}, body, false},
+	} {
+		respHdr, respBody := respond(icfg, nil, test.key, test.code, test.hdr, test.body)
+		if !bytes.Equal(respBody, test.body) {
+			t.Errorf("compress %v expected uncompressed body", test.name)
+		}
+		if actual := respHdr.Get("Vary") != ""; actual != test.vary {
+			t.Errorf("compress %v expected Vary %v, actual %v", test.name, test.vary, actual)
+		}
+	}
+
+	if icfg := compressLoad(json.RawMessage(`{"algorithms": ["deflate"]}`)); icfg != nil {
+		t.Errorf("compressLoad with unknown algorithm expected nil, actual %+v", icfg)
+	}
+}
@@ -0,0 +1,193 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/revalidate"
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+func init() {
+	AddPlugin(10000, Funcs{startup: revalidateStartup, onRequest: revalidateReq})
+}
+
+// RevalidateEndpoint is the path of the endpoint to list, add, and remove revalidation rules.
+const RevalidateEndpoint = "/_revalidate"
+
+// revalidateMaxBodyBytes is the maximum size of a request body, which is a single rule.
+const revalidateMaxBodyBytes = 1024 * 1024
+
+// RevalidateResponse is the response to a GET of the revalidate endpoint.
+type RevalidateResponse struct {
+	// File is the rules from the remap rules file, e.g. created by grovetccfg from Traffic Ops invalidation jobs.
+	File []revalidate.RuleJSON `json:"file"`
+	// Added is the rules added via this endpoint.
+	Added []revalidate.RuleJSON `json:"added"`
+}
+
+func revalidateStartup(icfg interface{}, d StartupData) {
+	*d.Context = d.Config.RevalidateToken
+}
+
+func revalidateReq(icfg interface{}, d OnRequestData) bool {
+	if !strings.HasPrefix(d.R.URL.Path, RevalidateEndpoint) {
+		log.Debugf("plugin onrequest http_revalidate returning, not in path '" + d.R.URL.Path + "'\n")
+		return false
+	}
+
+	log.Debugf("plugin onrequest http_revalidate calling\n")
+
+	w := d.W
+	req := d.R
+
+	ip, err := web.GetIP(req)
+	if err != nil {
+		code := http.StatusInternalServerError
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+		log.Errorln("revalidate failed to get IP: " + err.Error())
+		return true
+	}
+	if !d.StatRules.Allowed(ip) {
+		code := http.StatusForbidden
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+		log.Debugln("revalidate IP " + ip.String() + " FORBIDDEN")
+		return true
+	}
+
+	token := ""
+	if d.Context != nil {
+		token, _ = (*d.Context).(string)
+	}
+	if token == "" {
+		code := http.StatusForbidden
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+		log.Warnln("revalidate request from " + ip.String() + " refused: no revalidate_token is configured")
+		return true
+	}
+	if !revalidateAuthorized(req, token) {
+		code := http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+		log.Infoln("revalidate request from " + ip.String() + " UNAUTHORIZED")
+		return true
+	}
+
+	if d.Revalidations == nil {
+		code := http.StatusInternalServerError
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+		log.Errorln("revalidate request, but the handler has no revalidation rules")
+		return true
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		fileRules, addedRules := d.Revalidations.All(time.Now())
+		resp := RevalidateResponse{File: []revalidate.RuleJSON{}, Added: []revalidate.RuleJSON{}}
+		for _, rule := range fileRules {
+			resp.File = append(resp.File, rule.JSON())
+		}
+		for _, rule := range addedRules {
+			resp.Added = append(resp.Added, rule.JSON())
+		}
+		revalidateRespondJSON(w, http.StatusOK, resp)
+	case http.MethodPost:
+		ruleJSON := revalidate.RuleJSON{}
+		if err := json.NewDecoder(io.LimitReader(req.Body, revalidateMaxBodyBytes)).Decode(&ruleJSON); err != nil {
+			revalidateRespondErr(w, http.StatusBadRequest, "decoding rule: "+err.Error())
+			return true
+		}
+		rule, err := revalidate.RuleFromJSON(ruleJSON, time.Now())
+		if err != nil {
+			revalidateRespondErr(w, http.StatusBadRequest, err.Error())
+			return true
+		}
+		if err := d.Revalidations.Add(rule); err != nil {
+			log.Errorln("revalidate adding rule '" + rule.Regex.String() + "': " + err.Error())
+			revalidateRespondErr(w, http.StatusInternalServerError, "rule added, but not persisted: "+err.Error())
+			return true
+		}
+		log.Infoln("revalidate rule added by " + ip.String() + ": regex '" + rule.Regex.String() + "' type " + string(rule.Type) + " start " + rule.Start.Format(time.RFC3339) + " expires " + rule.Expires.Format(time.RFC3339))
+		revalidateRespondJSON(w, http.StatusOK, rule.JSON())
+	case http.MethodDelete:
+		regex := req.URL.Query().Get("regex")
+		if regex == "" {
+			revalidateRespondErr(w, http.StatusBadRequest, "missing regex query parameter")
+			return true
+		}
+		removed, err := d.Revalidations.Remove(regex)
+		if err != nil {
+			log.Errorln("revalidate removing rule '" + regex + "': " + err.Error())
+			revalidateRespondErr(w, http.StatusInternalServerError, "rule removed, but not persisted: "+err.Error())
+			return true
+		}
+		if removed == 0 {
+			revalidateRespondErr(w, http.StatusNotFound, "no added rule with regex '"+regex+"'")
+			return true
+		}
+		log.Infoln("revalidate " + strconv.Itoa(removed) + " rules removed by " + ip.String() + ": regex '" + regex + "'")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodDelete}, ", "))
+		code := http.StatusMethodNotAllowed
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+	}
+	return true
+}
+
+// revalidateAuthorized returns whether the request has an Authorization header with the given bearer token.
+func revalidateAuthorized(req *http.Request, token string) bool {
+	const prefix = "Bearer "
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, prefix)), []byte(token)) == 1
+}
+
+func revalidateRespondJSON(w http.ResponseWriter, code int, v interface{}) {
+	bts, err := json.Marshal(v)
+	if err != nil {
+		log.Errorln("revalidate marshalling response: " + err.Error())
+		code = http.StatusInternalServerError
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(bts)
+}
+
+func revalidateRespondErr(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(code)
+	w.Write([]byte(msg))
+}
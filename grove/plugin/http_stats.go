@@ -23,9 +23,13 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
+	"github.com/apache/trafficcontrol/grove/accesslog"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 	"github.com/apache/trafficcontrol/grove/stat"
+	"github.com/apache/trafficcontrol/grove/thread"
 	"github.com/apache/trafficcontrol/grove/web"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
@@ -70,6 +74,9 @@ func stats(icfg interface{}, d OnRequestData) bool {
 	ats := map[string]interface{}{"server": "6.2.1"}
 	if req.URL.Query().Get("application") != "system" {
 		ats = LoadRemapStats(d.Stats, d.HTTPConns, d.HTTPSConns)
+		LoadParentStats(d.Parents, ats)
+		LoadAccessLogStats(d.AccessLogs, ats)
+		LoadCoalesceStats(d.Getter, ats)
 	}
 	stats := stat.StatsJSON{System: system, ATS: ats}
 
@@ -130,6 +137,43 @@ func LoadRemapStats(stats stat.Stats, httpConns *web.ConnMap, httpsConns *web.Co
 	return jsonStats
 }
 
+// LoadParentStats adds the health of each parent to the given stats. Times are Unix seconds, and zero if the parent isn't down.
+func LoadParentStats(parents *parenthealth.Parents, jsonStats map[string]interface{}) {
+	unix := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.Unix()
+	}
+	for _, parent := range parents.Status() {
+		jsonStats["plugin.parent_health."+parent.Name+".available"] = parent.Available
+		jsonStats["plugin.parent_health."+parent.Name+".fail_count"] = parent.FailCount
+		jsonStats["plugin.parent_health."+parent.Name+".down_since"] = unix(parent.DownSince)
+		jsonStats["plugin.parent_health."+parent.Name+".retry_at"] = unix(parent.RetryAt)
+	}
+}
+
+// LoadAccessLogStats adds the line counts of each access log to the given stats.
+func LoadAccessLogStats(accessLogs *accesslog.Logs, jsonStats map[string]interface{}) {
+	for _, accessLog := range accessLogs.Stats() {
+		jsonStats["plugin.access_log."+accessLog.Name+".written"] = accessLog.Written
+		jsonStats["plugin.access_log."+accessLog.Name+".dropped"] = accessLog.Dropped
+		jsonStats["plugin.access_log."+accessLog.Name+".failed"] = accessLog.Failed
+	}
+}
+
+// LoadCoalesceStats adds the counts of parent requests coalesced by the getter to the given stats. The getter may be nil, in which case no stats are added.
+func LoadCoalesceStats(getter thread.Getter, jsonStats map[string]interface{}) {
+	if getter == nil {
+		return
+	}
+	stats := getter.Stats()
+	jsonStats["plugin.coalesce.leaders"] = stats.Leaders
+	jsonStats["plugin.coalesce.coalesced"] = stats.Coalesced
+	jsonStats["plugin.coalesce.timed_out"] = stats.TimedOut
+	jsonStats["plugin.coalesce.leader_failed"] = stats.LeaderFailed
+}
+
 func loadFileAndLog(filename string) string {
 	f, err := ioutil.ReadFile(filename)
 	if err != nil {
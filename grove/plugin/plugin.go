@@ -25,11 +25,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/apache/trafficcontrol/grove/accesslog"
 	"github.com/apache/trafficcontrol/grove/cachedata"
 	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/config"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 	"github.com/apache/trafficcontrol/grove/remapdata"
+	"github.com/apache/trafficcontrol/grove/revalidate"
 	"github.com/apache/trafficcontrol/grove/stat"
+	"github.com/apache/trafficcontrol/grove/thread"
 	"github.com/apache/trafficcontrol/grove/web"
 )
 
@@ -47,6 +52,7 @@ type Funcs struct {
 	load                LoadFunc
 	startup             StartupFunc
 	onRequest           OnRequestFunc
+	onRemap             OnRemapFunc
 	beforeCacheLookUp   BeforeCacheLookupFunc
 	beforeParentRequest BeforeParentRequestFunc
 	beforeRespond       BeforeRespondFunc
@@ -70,6 +76,24 @@ type OnRequestData struct {
 	HTTPSConns    *web.ConnMap
 	RequestID     uint64
 	Context       *interface{}
+	// Revalidations are the revalidation rules, which plugins may add to, e.g. to serve an endpoint to invalidate cached objects.
+	Revalidations *revalidate.Rules
+	// Parents is the health of the remap rules' parents, e.g. to serve in stats.
+	Parents *parenthealth.Parents
+	// AccessLogs are the access logs, e.g. to serve their dropped line counts in stats.
+	AccessLogs *accesslog.Logs
+	// Getter coalesces concurrent parent requests for the same cache key, e.g. to serve its counts in stats.
+	Getter thread.Getter
+	cachedata.SrvrData
+}
+
+// OnRemapData holds the data passed to plugins after the request is matched to a remap rule. Plugins may change the request's query string, and must then set R.RequestURI to match, e.g. to remove parameters which must not be cached on or sent to the parent.
+type OnRemapData struct {
+	W         http.ResponseWriter
+	R         *http.Request
+	RemapRule string
+	RequestID uint64
+	Context   *interface{}
 	cachedata.SrvrData
 }
 
@@ -84,9 +108,13 @@ type BeforeParentRequestData struct {
 type BeforeRespondData struct {
 	Req *http.Request
 	// CacheObj is the object to be cached, containing information about the origin request. The code, headers, and body should not be considered authoritative. Look at Code, Hdr, and Body instead, as the actual values about to be sent. Note CacheObj may be nil, if an error occurred (e.g. the Origin failed to respond).
-	CacheObj  *cacheobj.CacheObj
-	Code      *int
-	Hdr       *http.Header
+	CacheObj *cacheobj.CacheObj
+	// Cache is the cache the object is stored in, and CacheKey its key, which plugins may use to store a modified object in place of the CacheObj, e.g. to save recomputing it for every request. Note Cache is nil if the object isn't from the cache, e.g. if it's being streamed from the origin.
+	Cache    icache.Cache
+	CacheKey string
+	Code     *int
+	Hdr      *http.Header
+	// Body is the body about to be sent. It is nil for objects larger than cacheobj.ChunkSize, whose bodies are chunked, or streamed from the origin, and written to the client without being held in memory; a plugin which needs the body of a cached chunked object may read it with CacheObj.ReadBody, but the body of an object being streamed isn't available until it has been sent. Setting Body to a non-nil value replaces the chunked or streamed body.
 	Body      *[]byte
 	RemapRule string
 	Context   *interface{}
@@ -96,7 +124,9 @@ type BeforeCacheLookUpData struct {
 	Req                  *http.Request
 	CacheKeyOverrideFunc func(string)
 	DefaultCacheKey      string
-	Context              *interface{}
+	// Cache is the cache the object will be looked up in, which plugins may use to choose the cache key by the objects already cached.
+	Cache   icache.Cache
+	Context *interface{}
 }
 
 type AfterRespondData struct {
@@ -113,6 +143,7 @@ type AfterRespondData struct {
 type LoadFunc func(json.RawMessage) interface{}
 type StartupFunc func(icfg interface{}, d StartupData)
 type OnRequestFunc func(icfg interface{}, d OnRequestData) bool
+type OnRemapFunc func(icfg interface{}, d OnRemapData) bool
 type BeforeCacheLookupFunc func(icfg interface{}, d BeforeCacheLookUpData)
 type BeforeParentRequestFunc func(icfg interface{}, d BeforeParentRequestData)
 type BeforeRespondFunc func(icfg interface{}, d BeforeRespondData)
@@ -152,6 +183,7 @@ type Plugins interface {
 	LoadFuncs() map[string]LoadFunc
 	OnStartup(cfgs map[string]interface{}, context map[string]*interface{}, d StartupData)
 	OnRequest(cfgs map[string]interface{}, context map[string]*interface{}, d OnRequestData) bool
+	OnRemap(cfgs map[string]interface{}, context map[string]*interface{}, d OnRemapData) bool
 	OnBeforeCacheLookup(cfgs map[string]interface{}, context map[string]*interface{}, d BeforeCacheLookUpData)
 	OnBeforeParentRequest(cfgs map[string]interface{}, context map[string]*interface{}, d BeforeParentRequestData)
 	OnBeforeRespond(cfgs map[string]interface{}, context map[string]*interface{}, d BeforeRespondData)
@@ -196,6 +228,20 @@ func (ps pluginsSlice) OnRequest(cfgs map[string]interface{}, context map[string
 	return false
 }
 
+// OnRemap returns a boolean whether to immediately stop processing the request. If a plugin returns true, this is immediately returned with no further plugins processed.
+func (ps pluginsSlice) OnRemap(cfgs map[string]interface{}, context map[string]*interface{}, d OnRemapData) bool {
+	for _, p := range ps {
+		if p.funcs.onRemap == nil {
+			continue
+		}
+		d.Context = context[p.name]
+		if stop := p.funcs.onRemap(cfgs[p.name], d); stop {
+			return true
+		}
+	}
+	return false
+}
+
 func (ps pluginsSlice) OnBeforeCacheLookup(cfgs map[string]interface{}, context map[string]*interface{}, d BeforeCacheLookUpData) {
 	for _, p := range ps {
 		if p.funcs.beforeCacheLookUp == nil {
@@ -235,3 +281,37 @@ func (ps pluginsSlice) OnAfterRespond(cfgs map[string]interface{}, context map[s
 		p.funcs.afterRespond(cfgs[p.name], d)
 	}
 }
+
+// removeQueryParams removes the query parameters for whose names remove returns true from the given request's URL and RequestURI.
+func removeQueryParams(r *http.Request, remove func(name string) bool) {
+	if r.URL.RawQuery == "" {
+		return
+	}
+	query := []string{}
+	for _, param := range strings.Split(r.URL.RawQuery, "&") {
+		name := param
+		if i := strings.Index(param, "="); i >= 0 {
+			name = param[:i]
+		}
+		if param == "" || remove(name) {
+			continue
+		}
+		query = append(query, param)
+	}
+	r.URL.RawQuery = strings.Join(query, "&")
+	r.RequestURI = r.URL.RequestURI()
+}
+
+// removeCookie removes the cookie with the given name from the given request.
+func removeCookie(r *http.Request, name string) {
+	if _, err := r.Cookie(name); err != nil {
+		return
+	}
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			r.AddCookie(cookie)
+		}
+	}
+}
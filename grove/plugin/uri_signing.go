@@ -0,0 +1,338 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+func init() {
+	AddPlugin(10000, Funcs{load: uriSigningLoad, onRemap: uriSigning})
+}
+
+// URISigningDefaultPackageName is the default name of the query parameter or cookie containing the signed JWT, from the IETF CDNI URI Signing draft.
+const URISigningDefaultPackageName = "URISigningPackage"
+
+// URISigningVersion is the only supported cdniv claim.
+const URISigningVersion = 1
+
+// URISigningConfig is the uri_signing plugin config, at the global or rule level.
+type URISigningConfig struct {
+	// Keys is the URI signing keys, as served by Traffic Ops: a map of issuers to the JWKs which may sign their tokens. Tokens with a kid are verified with the issuer's key with that kid, and tokens without one with any of the issuer's keys, so keys may be rotated by adding the new key before signing with it.
+	Keys map[string]URISigningKeys `json:"keys"`
+	// PackageName is the name of the query parameter or cookie containing the signed JWT. The default is URISigningPackage.
+	PackageName string `json:"package_name"`
+}
+
+// URISigningKeys is an issuer's URI signing keys, as served by Traffic Ops.
+type URISigningKeys struct {
+	RenewalKID *string           `json:"renewal_kid"`
+	Keys       []json.RawMessage `json:"keys"`
+}
+
+type uriSigningCfg struct {
+	issuers     map[string][]jwk.Key
+	packageName string
+}
+
+// uriSigningLoad loads the uri_signing config. If the config is invalid, it returns no issuers, so all requests are rejected, rather than serving content which should be signed.
+func uriSigningLoad(b json.RawMessage) interface{} {
+	cfg := URISigningConfig{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		log.Errorln("uri_signing loading config, unmarshalling JSON, rejecting all requests: " + err.Error())
+		return &uriSigningCfg{issuers: map[string][]jwk.Key{}}
+	}
+	loaded := &uriSigningCfg{issuers: map[string][]jwk.Key{}, packageName: cfg.PackageName}
+	if loaded.packageName == "" {
+		loaded.packageName = URISigningDefaultPackageName
+	}
+	for issuer, keys := range cfg.Keys {
+		for _, keyJSON := range keys.Keys {
+			set, err := jwk.ParseBytes(keyJSON)
+			if err != nil {
+				log.Errorln("uri_signing loading config, parsing issuer '" + issuer + "' key, rejecting all requests: " + err.Error())
+				return &uriSigningCfg{issuers: map[string][]jwk.Key{}, packageName: loaded.packageName}
+			}
+			loaded.issuers[issuer] = append(loaded.issuers[issuer], set.Keys...)
+		}
+	}
+	log.Debugf("uri_signing load success: %v issuers\n", len(loaded.issuers))
+	return loaded
+}
+
+func uriSigning(icfg interface{}, d OnRemapData) bool {
+	if icfg == nil {
+		return false
+	}
+	cfg, ok := icfg.(*uriSigningCfg)
+	if !ok {
+		// should never happen
+		log.Errorf("uri_signing config '%v' type '%T' expected *uriSigningCfg\n", icfg, icfg)
+		return false
+	}
+
+	ip, err := web.GetIP(d.R)
+	if err == nil {
+		token, uri := uriSigningPackage(d.R, d.Scheme, cfg.packageName)
+		err = validateURISigning(cfg, token, uri, ip, time.Now())
+	}
+	if err != nil {
+		log.Debugf("uri_signing rule %v request %v FORBIDDEN: %v (reqid %v)\n", d.RemapRule, d.R.RequestURI, err, d.RequestID)
+		code := http.StatusForbidden
+		d.W.WriteHeader(code)
+		d.W.Write([]byte(http.StatusText(code)))
+		return true
+	}
+	// the JWT is unique to each client, so it must not be part of the cache key, and the parent needn't see it.
+	removeQueryParams(d.R, func(name string) bool { return name == cfg.packageName })
+	removeCookie(d.R, cfg.packageName)
+	return false
+}
+
+// uriSigningPackage returns the signed JWT from the request's query parameter or cookie with the given name, and the request URI without that query parameter, which the JWT's URI container claim must match.
+func uriSigningPackage(r *http.Request, scheme string, name string) (string, string) {
+	token := ""
+	query := []string{}
+	for _, param := range strings.Split(r.URL.RawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		if strings.HasPrefix(param, name+"=") {
+			token = strings.TrimPrefix(param, name+"=")
+			continue
+		}
+		query = append(query, param)
+	}
+	if token == "" {
+		if cookie, err := r.Cookie(name); err == nil {
+			token = cookie.Value
+		}
+	}
+	uri := scheme + "://" + r.Host + r.URL.EscapedPath()
+	if len(query) > 0 {
+		uri += "?" + strings.Join(query, "&")
+	}
+	return token, uri
+}
+
+// uriSigningClaims is the JWT claims understood by this plugin. Tokens whose cdnicrit claim names any other claim are rejected.
+var uriSigningClaims = map[string]struct{}{"iss": {}, "sub": {}, "aud": {}, "exp": {}, "nbf": {}, "iat": {}, "jti": {}, "cdniv": {}, "cdnicrit": {}, "cdniip": {}, "cdniuc": {}}
+
+// validateURISigning returns an error if the given JWT isn't signed by one of the config's issuers, or its claims don't allow the given URI to be requested by the given client at the given time.
+func validateURISigning(cfg *uriSigningCfg, token string, uri string, clientIP net.IP, now time.Time) error {
+	if token == "" {
+		return errors.New("missing URI signing package")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed JWT: expected 3 parts, actual " + strconv.Itoa(len(parts)))
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return errors.New("malformed JWT header: " + err.Error())
+	}
+	claims := map[string]interface{}{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return errors.New("malformed JWT claims: " + err.Error())
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("malformed JWT signature: " + err.Error())
+	}
+
+	issuer, _ := claims["iss"].(string)
+	keys, ok := cfg.issuers[issuer]
+	if !ok {
+		return errors.New("unknown issuer '" + issuer + "'")
+	}
+	verified := false
+	for _, key := range keys {
+		if header.Kid != "" && key.KeyID() != header.Kid {
+			continue
+		}
+		if err := verifyJWS(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err == nil {
+			verified = true
+			break
+		} else {
+			log.Debugf("uri_signing issuer '%v' key '%v' failed to verify: %v\n", issuer, key.KeyID(), err)
+		}
+	}
+	if !verified {
+		return errors.New("signature not verified by any issuer '" + issuer + "' key")
+	}
+
+	return validateURISigningClaims(claims, uri, clientIP, now)
+}
+
+// validateURISigningClaims returns an error if the given verified JWT claims don't allow the given URI to be requested by the given client at the given time.
+func validateURISigningClaims(claims map[string]interface{}, uri string, clientIP net.IP, now time.Time) error {
+	if crit, ok := claims["cdnicrit"]; ok {
+		critStr, _ := crit.(string)
+		for _, claim := range strings.Split(critStr, ",") {
+			if _, ok := uriSigningClaims[strings.TrimSpace(claim)]; !ok {
+				return errors.New("unsupported critical claim '" + claim + "'")
+			}
+		}
+	}
+	if version, ok := claims["cdniv"]; ok {
+		if v, ok := version.(float64); !ok || v != URISigningVersion {
+			return errors.New("unsupported version")
+		}
+	}
+	if exp, ok := claims["exp"]; ok {
+		if expSec, ok := exp.(float64); !ok || now.Unix() >= int64(expSec) {
+			return errors.New("expired")
+		}
+	}
+	if nbf, ok := claims["nbf"]; ok {
+		if nbfSec, ok := nbf.(float64); !ok || now.Unix() < int64(nbfSec) {
+			return errors.New("not yet valid")
+		}
+	}
+	if cdniip, ok := claims["cdniip"]; ok {
+		ipStr, _ := cdniip.(string)
+		if ip := net.ParseIP(ipStr); ip == nil || !ip.Equal(clientIP) {
+			return errors.New("client IP " + clientIP.String() + " doesn't match signed client '" + ipStr + "'")
+		}
+	}
+	if cdniuc, ok := claims["cdniuc"]; ok {
+		container, _ := cdniuc.(string)
+		if err := matchURIContainer(container, uri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchURIContainer returns an error if the given URI doesn't match the given cdniuc URI container, which may be "uri:" for an exact match, or "regex:" or "uri-regex:" for a regular expression.
+func matchURIContainer(container string, uri string) error {
+	switch {
+	case strings.HasPrefix(container, "uri:"):
+		if strings.TrimPrefix(container, "uri:") != uri {
+			return errors.New("URI '" + uri + "' doesn't match signed URI container '" + container + "'")
+		}
+	case strings.HasPrefix(container, "regex:") || strings.HasPrefix(container, "uri-regex:"):
+		pattern := container[strings.Index(container, ":")+1:]
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return errors.New("malformed URI container regex '" + pattern + "': " + err.Error())
+		}
+		if !re.MatchString(uri) {
+			return errors.New("URI '" + uri + "' doesn't match signed URI container '" + container + "'")
+		}
+	default:
+		return errors.New("unsupported URI container '" + container + "'")
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verifyJWS returns an error if the given signature of the given input isn't valid for the given JWS algorithm and key. The HS, RS, and ES algorithms are supported.
+func verifyJWS(alg string, key jwk.Key, input []byte, sig []byte) error {
+	hashes := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+	if len(alg) != 5 {
+		return errors.New("unsupported algorithm '" + alg + "'")
+	}
+	hashAlg, ok := hashes[alg[2:]]
+	if !ok || !hashAlg.Available() {
+		return errors.New("unsupported algorithm '" + alg + "'")
+	}
+	if keyAlg := key.Algorithm(); keyAlg != "" && keyAlg != alg {
+		return errors.New("key algorithm '" + keyAlg + "' doesn't match JWT algorithm '" + alg + "'")
+	}
+	rawKey, err := key.Materialize()
+	if err != nil {
+		return errors.New("materializing key: " + err.Error())
+	}
+
+	switch alg[:2] {
+	case "HS":
+		secret, ok := rawKey.([]byte)
+		if !ok {
+			return errors.New("algorithm '" + alg + "' requires a symmetric key")
+		}
+		mac := hmac.New(hashAlg.New, secret)
+		mac.Write(input)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case "RS":
+		pub := (*rsa.PublicKey)(nil)
+		switch k := rawKey.(type) {
+		case *rsa.PublicKey:
+			pub = k
+		case *rsa.PrivateKey:
+			pub = &k.PublicKey
+		default:
+			return errors.New("algorithm '" + alg + "' requires an RSA key")
+		}
+		h := hashAlg.New()
+		h.Write(input)
+		return rsa.VerifyPKCS1v15(pub, hashAlg, h.Sum(nil), sig)
+	case "ES":
+		pub := (*ecdsa.PublicKey)(nil)
+		switch k := rawKey.(type) {
+		case *ecdsa.PublicKey:
+			pub = k
+		case *ecdsa.PrivateKey:
+			pub = &k.PublicKey
+		default:
+			return errors.New("algorithm '" + alg + "' requires an EC key")
+		}
+		if len(sig)%2 != 0 {
+			return errors.New("malformed signature")
+		}
+		h := hashAlg.New()
+		h.Write(input)
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return errors.New("unsupported algorithm '" + alg + "'")
+}
@@ -0,0 +1,154 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+func TestValidateURISigning(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating EC key: %v", err)
+	}
+	ecJWK, err := jwk.New(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatalf("creating EC JWK: %v", err)
+	}
+	ecJWK.Set(jwk.KeyIDKey, "ec")
+	ecJSON, err := json.Marshal(ecJWK)
+	if err != nil {
+		t.Fatalf("marshalling EC JWK: %v", err)
+	}
+
+	oldSecret, newSecret := []byte("old-secret"), []byte("new-secret")
+	b64 := base64.RawURLEncoding.EncodeToString
+	cfgJSON := `{"keys": {"issuer": {"renewal_kid": "new", "keys": [
+		{"kty": "oct", "kid": "old", "alg": "HS256", "k": "` + b64(oldSecret) + `"},
+		{"kty": "oct", "kid": "new", "alg": "HS256", "k": "` + b64(newSecret) + `"},
+		` + string(ecJSON) + `
+	]}}}`
+	cfg, ok := uriSigningLoad(json.RawMessage(cfgJSON)).(*uriSigningCfg)
+	if !ok {
+		t.Fatalf("uriSigningLoad expected *uriSigningCfg")
+	}
+
+	signHS256 := func(kid string, secret []byte, claims map[string]interface{}) string {
+		claimsJSON, _ := json.Marshal(claims)
+		input := b64([]byte(`{"alg":"HS256","kid":"`+kid+`"}`)) + "." + b64(claimsJSON)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(input))
+		return input + "." + b64(mac.Sum(nil))
+	}
+	signES256 := func(claims map[string]interface{}) string {
+		claimsJSON, _ := json.Marshal(claims)
+		input := b64([]byte(`{"alg":"ES256","kid":"ec"}`)) + "." + b64(claimsJSON)
+		h := crypto.SHA256.New()
+		h.Write([]byte(input))
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, h.Sum(nil))
+		if err != nil {
+			t.Fatalf("signing ES256: %v", err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return input + "." + b64(sig)
+	}
+
+	now := time.Now()
+	uri := "http://ds.example.net/a/b.ts?foo=bar"
+	clientIP := net.ParseIP("192.0.2.1")
+	claims := func(mod map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": "issuer", "exp": now.Add(time.Hour).Unix(), "cdniv": 1, "cdniuc": "regex:^http://ds\\.example\\.net/a/.*", "cdniip": clientIP.String()}
+		for k, v := range mod {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"new key", signHS256("new", newSecret, claims(nil)), true},
+		{"rotated key", signHS256("old", oldSecret, claims(nil)), true},
+		{"no kid", signHS256("", newSecret, claims(nil)), true},
+		{"ES256", signES256(claims(nil)), true},
+		{"exact URI", signHS256("new", newSecret, claims(map[string]interface{}{"cdniuc": "uri:" + uri})), true},
+		{"wrong key", signHS256("new", oldSecret, claims(nil)), false},
+		{"unknown kid", signHS256("unknown", newSecret, claims(nil)), false},
+		{"unknown issuer", signHS256("new", newSecret, claims(map[string]interface{}{"iss": "other"})), false},
+		{"expired", signHS256("new", newSecret, claims(map[string]interface{}{"exp": now.Add(-time.Second).Unix()})), false},
+		{"not yet valid", signHS256("new", newSecret, claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()})), false},
+		{"wrong URI", signHS256("new", newSecret, claims(map[string]interface{}{"cdniuc": "regex:^http://ds\\.example\\.net/c/.*"})), false},
+		{"wrong client", signHS256("new", newSecret, claims(map[string]interface{}{"cdniip": "192.0.2.2"})), false},
+		{"unknown critical claim", signHS256("new", newSecret, claims(map[string]interface{}{"cdnicrit": "exp,cdnistt"})), false},
+		{"missing", "", false},
+	}
+	for _, test := range tests {
+		if err := validateURISigning(cfg, test.token, uri, clientIP, now); (err == nil) != test.valid {
+			t.Errorf("validateURISigning %v expected valid %v, actual error %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestURISigningPackage(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://ds.example.net/a/b.ts?foo=bar&URISigningPackage=token&baz=1", nil)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	token, uri := uriSigningPackage(r, "http", URISigningDefaultPackageName)
+	if token != "token" {
+		t.Errorf("uriSigningPackage token expected 'token', actual '%v'", token)
+	}
+	if expected := "http://ds.example.net/a/b.ts?foo=bar&baz=1"; uri != expected {
+		t.Errorf("uriSigningPackage URI expected '%v', actual '%v'", expected, uri)
+	}
+}
+
+func TestURISigningRemovePackage(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://ds.example.net/a/b.ts?foo=bar&URISigningPackage=token&baz=1", nil)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	r.Header.Set("Cookie", "a=1; URISigningPackage=token; b=2")
+
+	removeQueryParams(r, func(name string) bool { return name == URISigningDefaultPackageName })
+	removeCookie(r, URISigningDefaultPackageName)
+
+	if expected := "foo=bar&baz=1"; r.URL.RawQuery != expected || r.RequestURI != "/a/b.ts?"+expected {
+		t.Errorf("expected query '%v', actual query '%v' request URI '%v'", expected, r.URL.RawQuery, r.RequestURI)
+	}
+	if _, err := r.Cookie(URISigningDefaultPackageName); err == nil {
+		t.Errorf("expected package cookie removed, actual %v", r.Header.Get("Cookie"))
+	}
+	if len(r.Cookies()) != 2 {
+		t.Errorf("expected other cookies kept, actual %v", r.Header.Get("Cookie"))
+	}
+}
@@ -0,0 +1,200 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+func init() {
+	AddPlugin(10000, Funcs{load: urlSigLoad, onRemap: urlSig})
+}
+
+// URLSigMaxKeys is the number of URL signing keys a delivery service has, named "key0" through "key15", like the ATS url_sig plugin.
+const URLSigMaxKeys = 16
+
+const URLSigAlgorithmHMACSHA1 = "1"
+const URLSigAlgorithmHMACMD5 = "2"
+
+// URLSigConfig is the url_sig plugin config, at the global or rule level.
+type URLSigConfig struct {
+	// Keys is the URL signing keys, as served by Traffic Ops, a map of "key0" through "key15" to key values. Signers may sign with any key, so keys may be rotated one at a time.
+	Keys map[string]string `json:"keys"`
+}
+
+// urlSigParams are the query parameters of a signed URL. They're removed from valid requests, so they aren't part of the cache key, and aren't sent to the parent.
+var urlSigParams = map[string]struct{}{"C": {}, "E": {}, "A": {}, "K": {}, "P": {}, "S": {}}
+
+// urlSigKeys is the URL signing keys, indexed by their number.
+type urlSigKeys [URLSigMaxKeys]string
+
+// urlSigLoad loads the url_sig config. If the config is invalid, it returns no keys, so all requests are rejected, rather than serving content which should be signed.
+func urlSigLoad(b json.RawMessage) interface{} {
+	cfg := URLSigConfig{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		log.Errorln("url_sig loading config, unmarshalling JSON, rejecting all requests: " + err.Error())
+		return &urlSigKeys{}
+	}
+	keys := urlSigKeys{}
+	for name, key := range cfg.Keys {
+		i, err := strconv.Atoi(strings.TrimPrefix(name, "key"))
+		if !strings.HasPrefix(name, "key") || err != nil || i < 0 || i >= URLSigMaxKeys {
+			log.Errorln("url_sig loading config, key name '" + name + "' must be key0 through key" + strconv.Itoa(URLSigMaxKeys-1) + ", rejecting all requests")
+			return &urlSigKeys{}
+		}
+		keys[i] = key
+	}
+	log.Debugf("url_sig load success: %v keys\n", len(cfg.Keys))
+	return &keys
+}
+
+func urlSig(icfg interface{}, d OnRemapData) bool {
+	if icfg == nil {
+		return false
+	}
+	keys, ok := icfg.(*urlSigKeys)
+	if !ok {
+		// should never happen
+		log.Errorf("url_sig config '%v' type '%T' expected *urlSigKeys\n", icfg, icfg)
+		return false
+	}
+
+	ip, err := web.GetIP(d.R)
+	if err == nil {
+		err = validateURLSig(keys, d.R.Host+d.R.URL.RequestURI(), ip, time.Now())
+	}
+	if err != nil {
+		log.Debugf("url_sig rule %v request %v FORBIDDEN: %v (reqid %v)\n", d.RemapRule, d.R.RequestURI, err, d.RequestID)
+		code := http.StatusForbidden
+		d.W.WriteHeader(code)
+		d.W.Write([]byte(http.StatusText(code)))
+		return true
+	}
+	removeQueryParams(d.R, func(name string) bool {
+		_, ok := urlSigParams[name]
+		return ok
+	})
+	return false
+}
+
+// validateURLSig returns an error if the given URI, without a scheme, isn't signed with one of the given keys, like the ATS url_sig plugin.
+// The query parameters are C, the client IP (optional); E, the expiration in Unix seconds; A, the algorithm, 1 for HMAC-SHA1 or 2 for HMAC-MD5; K, the key number; P, the parts of the URI which are signed; and S, the hex signature, which must be last.
+// The signature is of the signed parts joined with '/', and the query string up to and including "S=". The first part is the host, and P is a string of 1s and 0s for whether each part is signed, whose last digit is repeated for any further parts.
+func validateURLSig(keys *urlSigKeys, uri string, clientIP net.IP, now time.Time) error {
+	queryStart := strings.Index(uri, "?")
+	if queryStart < 0 {
+		return errors.New("no query string")
+	}
+	path, query := uri[:queryStart], uri[queryStart+1:]
+
+	sigStart := -1
+	if strings.HasPrefix(query, "S=") {
+		sigStart = 0
+	} else if i := strings.LastIndex(query, "&S="); i >= 0 {
+		sigStart = i + 1
+	}
+	if sigStart < 0 {
+		return errors.New("missing signature")
+	}
+	if strings.Contains(query[sigStart:], "&") {
+		return errors.New("signature must be the last query parameter")
+	}
+	signedQuery := query[:sigStart+len("S=")]
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return errors.New("malformed query string: " + err.Error())
+	}
+
+	if clientStr := params.Get("C"); clientStr != "" {
+		if client := net.ParseIP(clientStr); client == nil || !client.Equal(clientIP) {
+			return errors.New("client IP " + clientIP.String() + " doesn't match signed client " + clientStr)
+		}
+	}
+
+	expiration, err := strconv.ParseInt(params.Get("E"), 10, 64)
+	if err != nil {
+		return errors.New("malformed expiration '" + params.Get("E") + "'")
+	}
+	if now.Unix() > expiration {
+		return errors.New("expired at " + time.Unix(expiration, 0).Format(time.RFC3339))
+	}
+
+	newHash := (func() hash.Hash)(nil)
+	switch params.Get("A") {
+	case URLSigAlgorithmHMACSHA1:
+		newHash = sha1.New
+	case URLSigAlgorithmHMACMD5:
+		newHash = md5.New
+	default:
+		return errors.New("unknown algorithm '" + params.Get("A") + "'")
+	}
+
+	keyIdx, err := strconv.Atoi(params.Get("K"))
+	if err != nil || keyIdx < 0 || keyIdx >= URLSigMaxKeys {
+		return errors.New("malformed key number '" + params.Get("K") + "'")
+	}
+	key := keys[keyIdx]
+	if key == "" {
+		return errors.New("key " + strconv.Itoa(keyIdx) + " doesn't exist")
+	}
+
+	parts := params.Get("P")
+	if parts == "" || strings.Trim(parts, "01") != "" {
+		return errors.New("malformed parts '" + parts + "'")
+	}
+
+	signed := ""
+	partIdx := 0
+	for _, part := range strings.Split(path, "/") {
+		if part == "" {
+			continue
+		}
+		if parts[partIdx] == '1' {
+			signed += part + "/"
+		}
+		if partIdx < len(parts)-1 {
+			partIdx++
+		}
+	}
+	signed = strings.TrimSuffix(signed, "/") + "?" + signedQuery
+
+	sig, err := hex.DecodeString(params.Get("S"))
+	if err != nil {
+		return errors.New("malformed signature: " + err.Error())
+	}
+	mac := hmac.New(newHash, []byte(key))
+	mac.Write([]byte(signed))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestValidateURLSig(t *testing.T) {
+	icfg := urlSigLoad(json.RawMessage(`{"keys": {"key0": "old", "key3": "new"}}`))
+	keys, ok := icfg.(*urlSigKeys)
+	if !ok {
+		t.Fatalf("urlSigLoad expected *urlSigKeys, actual %T", icfg)
+	}
+
+	now := time.Now()
+	clientIP := net.ParseIP("192.0.2.1")
+	// sign returns the URI signed with HMAC-SHA1 like the ATS url_sig_sign.pl script, where signedPath is the signed parts of the URI.
+	sign := func(uri string, signedPath string, key string, keyIdx int, parts string, expires time.Time) string {
+		query := "C=" + clientIP.String() + "&E=" + strconv.FormatInt(expires.Unix(), 10) + "&A=1&K=" + strconv.Itoa(keyIdx) + "&P=" + parts + "&S="
+		mac := hmac.New(sha1.New, []byte(key))
+		mac.Write([]byte(signedPath + "?" + query))
+		return uri + "?" + query + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name     string
+		uri      string
+		clientIP net.IP
+		valid    bool
+	}{
+		{"all parts", sign("ds.example.net/a/b.ts", "ds.example.net/a/b.ts", "new", 3, "1", now.Add(time.Hour)), clientIP, true},
+		{"rotated key", sign("ds.example.net/a/b.ts", "ds.example.net/a/b.ts", "old", 0, "1", now.Add(time.Hour)), clientIP, true},
+		{"host not signed", sign("other.example.net/a/b.ts", "a/b.ts", "new", 3, "01", now.Add(time.Hour)), clientIP, true},
+		{"last part not signed", sign("ds.example.net/a/b.ts", "ds.example.net/a", "new", 3, "110", now.Add(time.Hour)), clientIP, true},
+		{"wrong key", sign("ds.example.net/a/b.ts", "ds.example.net/a/b.ts", "old", 3, "1", now.Add(time.Hour)), clientIP, false},
+		{"missing key", sign("ds.example.net/a/b.ts", "ds.example.net/a/b.ts", "", 1, "1", now.Add(time.Hour)), clientIP, false},
+		{"modified path", sign("ds.example.net/a/c.ts", "ds.example.net/a/b.ts", "new", 3, "1", now.Add(time.Hour)), clientIP, false},
+		{"expired", sign("ds.example.net/a/b.ts", "ds.example.net/a/b.ts", "new", 3, "1", now.Add(-time.Second)), clientIP, false},
+		{"wrong client", sign("ds.example.net/a/b.ts", "ds.example.net/a/b.ts", "new", 3, "1", now.Add(time.Hour)), net.ParseIP("192.0.2.2"), false},
+		{"unsigned", "ds.example.net/a/b.ts", clientIP, false},
+		{"signature not last", sign("ds.example.net/a/b.ts", "ds.example.net/a/b.ts", "new", 3, "1", now.Add(time.Hour)) + "&foo=bar", clientIP, false},
+	}
+	for _, test := range tests {
+		if err := validateURLSig(keys, test.uri, test.clientIP, now); (err == nil) != test.valid {
+			t.Errorf("validateURLSig %v expected valid %v, actual error %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestURLSigRemovesParams(t *testing.T) {
+	icfg := urlSigLoad(json.RawMessage(`{"keys": {"key0": "secret"}}`))
+	query := "foo=bar&E=" + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + "&A=1&K=0&P=1&S="
+	mac := hmac.New(sha1.New, []byte("secret"))
+	mac.Write([]byte("ds.example.net/a/b.ts?" + query))
+	r := httptest.NewRequest(http.MethodGet, "http://ds.example.net/a/b.ts?"+query+hex.EncodeToString(mac.Sum(nil)), nil)
+	w := httptest.NewRecorder()
+
+	if stop := urlSig(icfg, OnRemapData{W: w, R: r, RemapRule: "rule"}); stop {
+		t.Fatalf("urlSig expected a valid signature, actual rejected with %v", w.Code)
+	}
+	if r.URL.RawQuery != "foo=bar" || r.RequestURI != "/a/b.ts?foo=bar" {
+		t.Errorf("urlSig expected signing parameters removed, actual query '%v' request URI '%v'", r.URL.RawQuery, r.RequestURI)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "http://ds.example.net/a/b.ts?foo=bar", nil)
+	if stop := urlSig(icfg, OnRemapData{W: httptest.NewRecorder(), R: r, RemapRule: "rule"}); !stop {
+		t.Errorf("urlSig expected an unsigned request rejected, actual allowed")
+	}
+}
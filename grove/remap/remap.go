@@ -27,8 +27,10 @@ import (
 
 	"github.com/apache/trafficcontrol/grove/chash"
 	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 	"github.com/apache/trafficcontrol/grove/plugin"
 	"github.com/apache/trafficcontrol/grove/remapdata"
+	"github.com/apache/trafficcontrol/grove/revalidate"
 	"github.com/apache/trafficcontrol/grove/web"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
@@ -44,6 +46,8 @@ type HTTPRequestRemapper interface {
 	PluginCfg() map[string]interface{} // global plugins, outside the individual remap rules
 	// PluginSharedCfg returns the plugins_shared, for every remap rule. This gives plugins a chance on startup to precompute data for each remap rule, store it in the Context, and save computation during requests.
 	PluginSharedCfg() map[string]map[string]json.RawMessage
+	// Revalidations returns the revalidation rules, which mark matching cached objects stale or purged.
+	Revalidations() []revalidate.Rule
 }
 
 type simpleHTTPRequestRemapper struct {
@@ -59,6 +63,9 @@ func (hr simpleHTTPRequestRemapper) PluginCfg() map[string]interface{} {
 func (hr simpleHTTPRequestRemapper) PluginSharedCfg() map[string]map[string]json.RawMessage {
 	return hr.remapper.PluginSharedCfg()
 }
+func (hr simpleHTTPRequestRemapper) Revalidations() []revalidate.Rule {
+	return hr.remapper.Revalidations()
+}
 
 // getFQDN returns the FQDN. It tries to get the FQDN from a Remap Rule. Remap Rules should always begin with the scheme, e.g. `http://`. If the given rule does not begin with a valid scheme, behavior is undefined.
 // TODO test
@@ -108,15 +115,20 @@ type Remapping struct {
 	RetryCodes      map[int]struct{}
 	Cache           icache.Cache
 	Transport       *http.Transport
+	// Health is the health of the parent being requested, which should be given the result of the request. It may be nil.
+	Health *parenthealth.Parent
 }
 
 // RemappingProducer takes an HTTP Request and returns a Remapping to be used for that request.
 // TODO rename? interface?
 type RemappingProducer struct {
 	oldURI   string
+	method   string
 	rule     remapdata.RemapRule
 	cacheKey string
 	failures int
+	// tried is the set of indexes in the rule's To of parents which have been tried for this request.
+	tried map[int]struct{}
 }
 
 func (p *RemappingProducer) CacheKey() string                  { return p.cacheKey }
@@ -126,6 +138,41 @@ func (p *RemappingProducer) Name() string                      { return p.rule.N
 func (p *RemappingProducer) DSCP() int                         { return p.rule.DSCP }
 func (p *RemappingProducer) PluginCfg() map[string]interface{} { return p.rule.Plugins }
 func (p *RemappingProducer) Cache() icache.Cache               { return p.rule.Cache }
+
+// StaleWhileRevalidate returns the rule's override of the stale-while-revalidate Cache-Control directive, and whether the rule has one.
+func (p *RemappingProducer) StaleWhileRevalidate() (time.Duration, bool) {
+	if p.rule.StaleWhileRevalidate == nil {
+		return 0, false
+	}
+	return *p.rule.StaleWhileRevalidate, true
+}
+
+// StaleIfError returns the rule's override of the stale-if-error Cache-Control directive, and whether the rule has one.
+func (p *RemappingProducer) StaleIfError() (time.Duration, bool) {
+	if p.rule.StaleIfError == nil {
+		return 0, false
+	}
+	return *p.rule.StaleIfError, true
+}
+
+// CoalesceTimeout returns how long to wait for a concurrent parent request for the same cache key, before making a new one. Zero waits indefinitely.
+func (p *RemappingProducer) CoalesceTimeout() time.Duration {
+	if p.rule.CoalesceTimeout == nil {
+		return 0
+	}
+	return *p.rule.CoalesceTimeout
+}
+
+// SetURI sets the request URI the remapping is made from, and the cache key, e.g. after a plugin removed query parameters which must not be sent to the parent or cached on. The URI must still match the rule.
+func (p *RemappingProducer) SetURI(uri string) error {
+	if !strings.HasPrefix(uri, p.rule.From) {
+		return errors.New("URI doesn't match rule " + p.rule.Name)
+	}
+	p.oldURI = uri
+	p.cacheKey = p.rule.CacheKey(p.method, uri)
+	return nil
+}
+
 func (p *RemappingProducer) FirstFQDN() string {
 	// TODO verify To is not allowed to be constructed with < 1 element
 	return strings.TrimPrefix(strings.TrimPrefix(p.rule.To[0].URL, "http://"), "https://")
@@ -165,7 +212,9 @@ func (hr simpleHTTPRequestRemapper) RemappingProducer(r *http.Request, scheme st
 	return &RemappingProducer{
 		rule:     rule,
 		oldURI:   uri,
+		method:   r.Method,
 		cacheKey: cacheKey,
+		tried:    map[int]struct{}{},
 	}, nil
 }
 
@@ -175,7 +224,8 @@ func (p *RemappingProducer) GetNext(r *http.Request) (Remapping, bool, error) {
 		return Remapping{}, false, ErrNoMoreRetries
 	}
 
-	newURI, proxyURL, transport := p.rule.URI(p.oldURI, r.URL.Path, r.URL.RawQuery, p.failures)
+	newURI, proxyURL, transport, toIdx := p.rule.URI(p.oldURI, r.URL.Path, r.URL.RawQuery, p.tried)
+	p.tried[toIdx] = struct{}{}
 	p.failures++
 	newReq, err := http.NewRequest(r.Method, newURI, nil)
 	if err != nil {
@@ -201,6 +251,7 @@ func (p *RemappingProducer) GetNext(r *http.Request) (Remapping, bool, error) {
 		RetryCodes:      p.rule.RetryCodes,
 		Cache:           p.rule.Cache,
 		Transport:       transport,
+		Health:          p.rule.To[toIdx].Health,
 	}, retryAllowed, nil
 }
 
@@ -208,8 +259,8 @@ func RemapperToHTTP(r Remapper, statRules *remapdata.RemapRulesStats) HTTPReques
 	return simpleHTTPRequestRemapper{remapper: r, stats: statRules}
 }
 
-func NewHTTPRequestRemapper(remap []remapdata.RemapRule, plugins map[string]interface{}, statRules *remapdata.RemapRulesStats) HTTPRequestRemapper {
-	return RemapperToHTTP(NewLiteralPrefixRemapper(remap, plugins), statRules)
+func NewHTTPRequestRemapper(remap []remapdata.RemapRule, plugins map[string]interface{}, statRules *remapdata.RemapRulesStats, revalidations []revalidate.Rule) HTTPRequestRemapper {
+	return RemapperToHTTP(NewLiteralPrefixRemapper(remap, plugins, revalidations), statRules)
 }
 
 // Remapper provides a function which takes strings and maps them to other strings. This is designed for URL prefix remapping, for a reverse proxy.
@@ -221,15 +272,19 @@ type Remapper interface {
 	// PluginCfg returns the global plugins, outside the individual remap rules
 	PluginCfg() map[string]interface{}
 	PluginSharedCfg() map[string]map[string]json.RawMessage
+	// Revalidations returns the revalidation rules from the remap rules file.
+	Revalidations() []revalidate.Rule
 }
 
 // TODO change to use a prefix tree, for speed
 type literalPrefixRemapper struct {
-	remap   []remapdata.RemapRule
-	plugins map[string]interface{}
+	remap         []remapdata.RemapRule
+	plugins       map[string]interface{}
+	revalidations []revalidate.Rule
 }
 
 func (r literalPrefixRemapper) PluginCfg() map[string]interface{} { return r.plugins }
+func (r literalPrefixRemapper) Revalidations() []revalidate.Rule  { return r.revalidations }
 
 // PluginSharedCfg returns a map of remap rule names, to a map of keys to arbitrary JSON values.
 // For example, if a JSON rule object with the name "foo" contains the key and value `"plugins_shared": {"bar": "baz"}`, the returned map will contain m["foo"]["bar"]"baz". The value may be any JSON type.
@@ -260,8 +315,8 @@ func (r literalPrefixRemapper) Rules() []remapdata.RemapRule {
 	return rules
 }
 
-func NewLiteralPrefixRemapper(remap []remapdata.RemapRule, plugins map[string]interface{}) Remapper {
-	return literalPrefixRemapper{remap: remap, plugins: plugins}
+func NewLiteralPrefixRemapper(remap []remapdata.RemapRule, plugins map[string]interface{}, revalidations []revalidate.Rule) Remapper {
+	return literalPrefixRemapper{remap: remap, plugins: plugins, revalidations: revalidations}
 }
 
 type RemapRulesStatsJSON struct {
@@ -272,27 +327,40 @@ type RemapRulesStatsJSON struct {
 type RemapRulesBase struct {
 	RetryNum      *int                       `json:"retry_num"`
 	PluginsShared map[string]json.RawMessage `json:"plugins_shared"`
+	// ParentHealth is the parent health config, for rules which don't override it.
+	ParentHealth *parenthealth.ConfigJSON `json:"parent_health"`
 }
 
 type RemapRulesJSON struct {
 	RemapRulesBase
-	Rules           []RemapRuleJSON            `json:"rules"`
-	RetryCodes      *[]int                     `json:"retry_codes"`
-	TimeoutMS       *int                       `json:"timeout_ms"`
-	ParentSelection *string                    `json:"parent_selection"`
-	Stats           RemapRulesStatsJSON        `json:"stats"`
-	Plugins         map[string]json.RawMessage `json:"plugins"`
+	Rules           []RemapRuleJSON     `json:"rules"`
+	RetryCodes      *[]int              `json:"retry_codes"`
+	TimeoutMS       *int                `json:"timeout_ms"`
+	ParentSelection *string             `json:"parent_selection"`
+	Stats           RemapRulesStatsJSON `json:"stats"`
+	// StaleWhileRevalidateMS overrides the RFC5861 stale-while-revalidate Cache-Control directive of responses, for rules which don't set it.
+	StaleWhileRevalidateMS *int `json:"stale_while_revalidate_ms"`
+	// StaleIfErrorMS overrides the RFC5861 stale-if-error Cache-Control directive of requests and responses, for rules which don't set it.
+	StaleIfErrorMS *int `json:"stale_if_error_ms"`
+	// CoalesceTimeoutMS is how long requests wait for a concurrent parent request for the same cache key, before making their own, for rules which don't set it.
+	CoalesceTimeoutMS *int                       `json:"coalesce_timeout_ms"`
+	Plugins           map[string]json.RawMessage `json:"plugins"`
+	Revalidations     []revalidate.RuleJSON      `json:"revalidations"`
 }
 
 type RemapRules struct {
 	RemapRulesBase
-	Rules           []remapdata.RemapRule
-	RetryCodes      map[int]struct{}
-	Timeout         *time.Duration
-	ParentSelection *remapdata.ParentSelectionType
-	Stats           remapdata.RemapRulesStats
-	Plugins         map[string]interface{}
-	Cache           icache.Cache
+	Rules                []remapdata.RemapRule
+	RetryCodes           map[int]struct{}
+	Timeout              *time.Duration
+	ParentSelection      *remapdata.ParentSelectionType
+	Stats                remapdata.RemapRulesStats
+	StaleWhileRevalidate *time.Duration
+	StaleIfError         *time.Duration
+	CoalesceTimeout      *time.Duration
+	Plugins              map[string]interface{}
+	Cache                icache.Cache
+	Revalidations        []revalidate.Rule
 }
 
 type RemapRuleToJSON struct {
@@ -316,23 +384,30 @@ type RemapRuleJSON struct {
 	RetryCodes      *[]int                     `json:"retry_codes"`
 	CacheName       *string                    `json:"cache_name"`
 	Plugins         map[string]json.RawMessage `json:"plugins"`
+	// StaleWhileRevalidateMS overrides the RFC5861 stale-while-revalidate Cache-Control directive of responses for this rule.
+	StaleWhileRevalidateMS *int `json:"stale_while_revalidate_ms"`
+	// StaleIfErrorMS overrides the RFC5861 stale-if-error Cache-Control directive of requests and responses for this rule.
+	StaleIfErrorMS *int `json:"stale_if_error_ms"`
+	// CoalesceTimeoutMS is how long requests for this rule wait for a concurrent parent request for the same cache key, before making their own.
+	CoalesceTimeoutMS *int `json:"coalesce_timeout_ms"`
 }
 
 // LoadRemapRules returns the loaded rules, the global plugins, the Stats remap rules, and any error
-func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport) ([]remapdata.RemapRule, map[string]interface{}, *remapdata.RemapRulesStats, error) {
+// The parents track the health of the rules' parents, and parents no longer in the rules are removed from it, only if the rules load successfully. It may be nil, in which case parent health isn't tracked.
+func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport, parents *parenthealth.Parents) ([]remapdata.RemapRule, map[string]interface{}, *remapdata.RemapRulesStats, []revalidate.Rule, error) {
 	fmt.Println(time.Now().Format(time.RFC3339Nano) + " Loading Remap Rules")
 	defer func() {
 		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Loaded Remap Rules")
 	}()
 	file, err := os.Open(path)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 	defer file.Close()
 
 	remapRulesJSON := RemapRulesJSON{}
 	if err := json.NewDecoder(file).Decode(&remapRulesJSON); err != nil {
-		return nil, nil, nil, fmt.Errorf("decoding JSON: %s", err)
+		return nil, nil, nil, nil, fmt.Errorf("decoding JSON: %s", err)
 	}
 
 	remapRules := RemapRules{RemapRulesBase: remapRulesJSON.RemapRulesBase}
@@ -341,7 +416,7 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 		remapRules.RetryCodes = make(map[int]struct{}, len(*remapRulesJSON.RetryCodes))
 		for _, code := range *remapRulesJSON.RetryCodes {
 			if _, ok := rfc.ValidHTTPCodes[code]; !ok {
-				return nil, nil, nil, fmt.Errorf("error parsing rules: retry code invalid: %v", code)
+				return nil, nil, nil, nil, fmt.Errorf("error parsing rules: retry code invalid: %v", code)
 			}
 			remapRules.RetryCodes[code] = struct{}{}
 		}
@@ -349,26 +424,48 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 	if remapRulesJSON.TimeoutMS != nil {
 		t := time.Duration(*remapRulesJSON.TimeoutMS) * time.Millisecond
 		if remapRules.Timeout = &t; *remapRules.Timeout < 0 {
-			return nil, nil, nil, fmt.Errorf("error parsing rules: timeout must be positive: %v", remapRules.Timeout)
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rules: timeout must be positive: %v", remapRules.Timeout)
 		}
 	}
+	if remapRules.StaleWhileRevalidate, err = msToDuration(remapRulesJSON.StaleWhileRevalidateMS); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("error parsing rules: stale_while_revalidate_ms %v", err)
+	}
+	if remapRules.StaleIfError, err = msToDuration(remapRulesJSON.StaleIfErrorMS); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("error parsing rules: stale_if_error_ms %v", err)
+	}
+	if remapRules.CoalesceTimeout, err = msToDuration(remapRulesJSON.CoalesceTimeoutMS); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("error parsing rules: coalesce_timeout_ms %v", err)
+	}
 	if remapRulesJSON.ParentSelection != nil {
 		ps := remapdata.ParentSelectionTypeFromString(*remapRulesJSON.ParentSelection)
 		if remapRules.ParentSelection = &ps; *remapRules.ParentSelection == remapdata.ParentSelectionTypeInvalid {
-			return nil, nil, nil, fmt.Errorf("error parsing rules: parent selection invalid: '%v'", remapRulesJSON.ParentSelection)
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rules: parent selection invalid: '%v'", remapRulesJSON.ParentSelection)
 		}
 	}
 	if remapRulesJSON.Stats.Allow != nil {
 		if remapRules.Stats.Allow, err = makeIPNets(remapRulesJSON.Stats.Allow); err != nil {
-			return nil, nil, nil, fmt.Errorf("error parsing rules allows: %v", err)
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rules allows: %v", err)
 		}
 	}
 	if remapRulesJSON.Stats.Deny != nil {
 		if remapRules.Stats.Deny, err = makeIPNets(remapRulesJSON.Stats.Deny); err != nil {
-			return nil, nil, nil, fmt.Errorf("error parsing rules denys: %v", err)
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rules denys: %v", err)
 		}
 	}
 
+	if remapRules.Revalidations, err = revalidate.RulesFromJSON(remapRulesJSON.Revalidations, time.Now()); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("error parsing rules revalidations: %v", err)
+	}
+
+	healthCfg := parenthealth.DefaultConfig()
+	parentsLoad := parents.Load()
+	if remapRules.ParentHealth != nil {
+		healthCfg = remapRules.ParentHealth.Apply(healthCfg)
+	}
+	if err := healthCfg.Validate(); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("error parsing rules parent_health: %v", err)
+	}
+
 	remapRules.Plugins = make(map[string]interface{}, len(remapRulesJSON.Plugins))
 	for name, b := range remapRulesJSON.Plugins {
 		if loadF := pluginConfigLoaders[name]; loadF != nil {
@@ -397,7 +494,7 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 			rule.RetryCodes = make(map[int]struct{}, len(*jsonRule.RetryCodes))
 			for _, code := range *jsonRule.RetryCodes {
 				if _, ok := rfc.ValidHTTPCodes[code]; !ok {
-					return nil, nil, nil, fmt.Errorf("error parsing rule %v retry code invalid: %v", rule.Name, code)
+					return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v retry code invalid: %v", rule.Name, code)
 				}
 				rule.RetryCodes[code] = struct{}{}
 			}
@@ -408,7 +505,7 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 		if jsonRule.TimeoutMS != nil {
 			t := time.Duration(*jsonRule.TimeoutMS) * time.Millisecond
 			if rule.Timeout = &t; *rule.Timeout < 0 {
-				return nil, nil, nil, fmt.Errorf("error parsing rule %v timeout must be positive: %v", rule.Name, rule.Timeout)
+				return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v timeout must be positive: %v", rule.Name, rule.Timeout)
 			}
 		} else {
 			rule.Timeout = remapRules.Timeout
@@ -418,6 +515,22 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 			rule.RetryNum = remapRules.RetryNum
 		}
 
+		if rule.StaleWhileRevalidate, err = msToDuration(jsonRule.StaleWhileRevalidateMS); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v stale_while_revalidate_ms %v", rule.Name, err)
+		} else if rule.StaleWhileRevalidate == nil {
+			rule.StaleWhileRevalidate = remapRules.StaleWhileRevalidate
+		}
+		if rule.StaleIfError, err = msToDuration(jsonRule.StaleIfErrorMS); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v stale_if_error_ms %v", rule.Name, err)
+		} else if rule.StaleIfError == nil {
+			rule.StaleIfError = remapRules.StaleIfError
+		}
+		if rule.CoalesceTimeout, err = msToDuration(jsonRule.CoalesceTimeoutMS); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v coalesce_timeout_ms %v", rule.Name, err)
+		} else if rule.CoalesceTimeout == nil {
+			rule.CoalesceTimeout = remapRules.CoalesceTimeout
+		}
+
 		if rule.PluginsShared == nil {
 			rule.PluginsShared = remapRules.PluginsShared
 		}
@@ -428,33 +541,40 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 		}
 		ok := false
 		if rule.Cache, ok = caches[cacheName]; !ok {
-			return nil, nil, nil, fmt.Errorf("error parsing rule %v: cache name %v not found", rule.Name, cacheName)
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v: cache name %v not found", rule.Name, cacheName)
 		}
 
 		if rule.Allow, err = makeIPNets(jsonRule.Allow); err != nil {
-			return nil, nil, nil, fmt.Errorf("error parsing rule %v allows: %v", rule.Name, err)
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v allows: %v", rule.Name, err)
 		}
 		if rule.Deny, err = makeIPNets(jsonRule.Deny); err != nil {
-			return nil, nil, nil, fmt.Errorf("error parsing rule %v denys: %v", rule.Name, err)
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v denys: %v", rule.Name, err)
+		}
+		ruleHealthCfg := healthCfg
+		if rule.ParentHealth != nil {
+			ruleHealthCfg = rule.ParentHealth.Apply(ruleHealthCfg)
 		}
-		if rule.To, err = makeTo(jsonRule.To, rule, baseTransport); err != nil {
-			return nil, nil, nil, fmt.Errorf("error parsing rule %v to: %v", rule.Name, err)
+		if err := ruleHealthCfg.Validate(); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v parent_health: %v", rule.Name, err)
+		}
+		if rule.To, err = makeTo(jsonRule.To, rule, baseTransport, parentsLoad, ruleHealthCfg); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v to: %v", rule.Name, err)
 		}
 		if jsonRule.ParentSelection != nil {
 			ps := remapdata.ParentSelectionTypeFromString(*jsonRule.ParentSelection)
 			if rule.ParentSelection = &ps; *rule.ParentSelection == remapdata.ParentSelectionTypeInvalid {
-				return nil, nil, nil, fmt.Errorf("error parsing rule %v parent selection invalid: '%v'", rule.Name, jsonRule.ParentSelection)
+				return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v parent selection invalid: '%v'", rule.Name, jsonRule.ParentSelection)
 			}
 		} else {
 			rule.ParentSelection = remapRules.ParentSelection
 		}
 
 		if rule.ParentSelection == nil {
-			return nil, nil, nil, fmt.Errorf("error parsing rule %v - no parent_selection - must be set at rules or rule level", rule.Name)
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v - no parent_selection - must be set at rules or rule level", rule.Name)
 		}
 
 		if len(rule.To) == 0 {
-			return nil, nil, nil, fmt.Errorf("error parsing rule %v - no to - must have at least one parent", rule.Name)
+			return nil, nil, nil, nil, fmt.Errorf("error parsing rule %v - no to - must have at least one parent", rule.Name)
 		}
 
 		if *rule.ParentSelection == remapdata.ParentSelectionTypeConsistentHash {
@@ -464,15 +584,38 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 		rules[i] = rule
 	}
 
-	return rules, remapRules.Plugins, &remapRules.Stats, nil
+	parentsLoad.Commit()
+
+	return rules, remapRules.Plugins, &remapRules.Stats, remapRules.Revalidations, nil
+}
+
+// msToDuration returns the given milliseconds as a Duration, or nil if ms is nil, or an error if it's negative.
+func msToDuration(ms *int) (*time.Duration, error) {
+	if ms == nil {
+		return nil, nil
+	}
+	if *ms < 0 {
+		return nil, fmt.Errorf("must be positive: %v", *ms)
+	}
+	d := time.Duration(*ms) * time.Millisecond
+	return &d, nil
+}
+
+// durationToMS returns the given Duration as milliseconds, or nil if d is nil.
+func durationToMS(d *time.Duration) *int {
+	if d == nil {
+		return nil
+	}
+	ms := int(*d / time.Millisecond)
+	return &ms
 }
 
 const DefaultReplicas = 1024
 
 func makeRuleHash(rule remapdata.RemapRule) chash.ATSConsistentHash {
 	h := chash.NewSimpleATSConsistentHash(DefaultReplicas)
-	for _, to := range rule.To {
-		h.Insert(&chash.ATSConsistentHashNode{Name: to.URL, ProxyURL: to.ProxyURL, Transport: to.Transport}, *to.Weight)
+	for i, to := range rule.To {
+		h.Insert(&chash.ATSConsistentHashNode{Name: to.URL, ProxyURL: to.ProxyURL, Transport: to.Transport, Index: i}, *to.Weight)
 	}
 	if h.First() == nil {
 		fmt.Println(time.Now().Format(time.RFC3339Nano) + " ERROR  makeRuleHash " + rule.Name + " NodeMap empty!")
@@ -481,7 +624,15 @@ func makeRuleHash(rule remapdata.RemapRule) chash.ATSConsistentHash {
 	return h
 }
 
-func makeTo(tosJSON []RemapRuleToJSON, rule remapdata.RemapRule, baseTransport *http.Transport) ([]remapdata.RemapRuleTo, error) {
+// parentName returns the name the given parent's health is tracked by. This is the proxy, if the parent has one, because that's the host actually requested.
+func parentName(to remapdata.RemapRuleTo) string {
+	if to.ProxyURL != nil && to.ProxyURL.Host != "" {
+		return to.ProxyURL.String()
+	}
+	return to.URL
+}
+
+func makeTo(tosJSON []RemapRuleToJSON, rule remapdata.RemapRule, baseTransport *http.Transport, parents *parenthealth.Load, healthCfg parenthealth.Config) ([]remapdata.RemapRuleTo, error) {
 	tos := make([]remapdata.RemapRuleTo, len(tosJSON))
 	for i, toJSON := range tosJSON {
 		if toJSON.Weight == nil {
@@ -534,6 +685,11 @@ func makeTo(tosJSON []RemapRuleToJSON, rule remapdata.RemapRule, baseTransport *
 		} else if to.RetryCodes == nil {
 			return nil, fmt.Errorf("error parsing to %v - no retry_codes - must be set at rules, rule, or to level", to.URL)
 		}
+		health, err := parents.Get(parentName(to), rule.Name, healthCfg, to.URL, to.Transport)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing to %v: %v", to.URL, err)
+		}
+		to.Health = health
 		tos[i] = to
 	}
 	return tos, nil
@@ -563,12 +719,12 @@ func makeIPNet(cidr string) (*net.IPNet, error) {
 	return cidrnet, nil
 }
 
-func LoadRemapper(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport) (HTTPRequestRemapper, error) {
-	rules, plugins, statRules, err := LoadRemapRules(path, pluginConfigLoaders, caches, baseTransport)
+func LoadRemapper(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport, parents *parenthealth.Parents) (HTTPRequestRemapper, error) {
+	rules, plugins, statRules, revalidations, err := LoadRemapRules(path, pluginConfigLoaders, caches, baseTransport, parents)
 	if err != nil {
 		return nil, err
 	}
-	return NewHTTPRequestRemapper(rules, plugins, statRules), nil
+	return NewHTTPRequestRemapper(rules, plugins, statRules, revalidations), nil
 }
 
 func RemapRulesToJSON(r RemapRules) (RemapRulesJSON, error) {
@@ -590,6 +746,9 @@ func RemapRulesToJSON(r RemapRules) (RemapRulesJSON, error) {
 		j.ParentSelection = &s
 		*j.ParentSelection = string(*r.ParentSelection)
 	}
+	j.StaleWhileRevalidateMS = durationToMS(r.StaleWhileRevalidate)
+	j.StaleIfErrorMS = durationToMS(r.StaleIfError)
+	j.CoalesceTimeoutMS = durationToMS(r.CoalesceTimeout)
 	for _, deny := range r.Stats.Deny {
 		j.Stats.Deny = append(j.Stats.Deny, deny.String())
 	}
@@ -600,6 +759,9 @@ func RemapRulesToJSON(r RemapRules) (RemapRulesJSON, error) {
 	for _, rule := range r.Rules {
 		j.Rules = append(j.Rules, buildRemapRuleToJSON(rule))
 	}
+	for _, rule := range r.Revalidations {
+		j.Revalidations = append(j.Revalidations, rule.JSON())
+	}
 	j.Plugins = make(map[string]json.RawMessage)
 	for name, plugin := range r.Plugins {
 		bts, err := json.Marshal(plugin)
@@ -623,6 +785,9 @@ func buildRemapRuleToJSON(r remapdata.RemapRule) RemapRuleJSON {
 		j.ParentSelection = &ps
 		*j.ParentSelection = string(*r.ParentSelection)
 	}
+	j.StaleWhileRevalidateMS = durationToMS(r.StaleWhileRevalidate)
+	j.StaleIfErrorMS = durationToMS(r.StaleIfError)
+	j.CoalesceTimeoutMS = durationToMS(r.CoalesceTimeout)
 	for _, to := range r.To {
 		j.To = append(j.To, RemapRuleToToJSON(to))
 	}
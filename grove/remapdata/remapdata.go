@@ -26,6 +26,7 @@ import (
 
 	"github.com/apache/trafficcontrol/grove/chash"
 	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 )
@@ -98,6 +99,10 @@ type RemapRuleBase struct {
 	RetryNum               *int                       `json:"retry_num"`
 	DSCP                   int                        `json:"dscp"`
 	PluginsShared          map[string]json.RawMessage `json:"plugins_shared"`
+	// ParentHealth overrides the global parent health config for this rule's parents.
+	ParentHealth *parenthealth.ConfigJSON `json:"parent_health"`
+	// AlternateSecondary is whether secondary parents are requested alternately with primary parents, like the ATS parent.config secondary_mode=1, rather than after every primary parent.
+	AlternateSecondary bool `json:"alternate_secondary"`
 }
 
 type RemapRule struct {
@@ -111,6 +116,12 @@ type RemapRule struct {
 	ConsistentHash  chash.ATSConsistentHash
 	Cache           icache.Cache
 	Plugins         map[string]interface{}
+	// StaleWhileRevalidate, if not nil, overrides the RFC5861 stale-while-revalidate Cache-Control directive of responses.
+	StaleWhileRevalidate *time.Duration
+	// StaleIfError, if not nil, overrides the RFC5861 stale-if-error Cache-Control directive of requests and responses.
+	StaleIfError *time.Duration
+	// CoalesceTimeout, if not nil, is how long requests wait for a concurrent parent request for the same cache key, before making their own. Zero waits indefinitely.
+	CoalesceTimeout *time.Duration
 }
 
 func (r *RemapRule) Allowed(ip net.IP) bool {
@@ -133,59 +144,126 @@ func (r *RemapRule) Allowed(ip net.IP) bool {
 	return false
 }
 
-// URI takes a request URI and maps it to the real URI to proxy-and-cache. The `failures` parameter indicates how many parents have tried and failed, indicating to skip to the nth hashed parent. Returns the URI to request, and the proxy URL (if any)
-func (r RemapRule) URI(fromURI string, path string, query string, failures int) (string, *url.URL, *http.Transport) {
+// URI takes a request URI and maps it to the real URI to proxy-and-cache. The `tried` parameter is the set of indexes in To of parents which have already been tried and failed for this request, which are skipped until every parent has been tried. Parents which are down are also skipped, unless every untried parent is down. Returns the URI to request, the proxy URL (if any), the transport, and the index in To of the parent.
+func (r RemapRule) URI(fromURI string, path string, query string, tried map[int]struct{}) (string, *url.URL, *http.Transport, int) {
 	fromHash := path
 	if r.QueryString.Remap && query != "" {
 		fromHash += "?" + query
 	}
 
 	// fmt.Println("RemapRule.URI fromURI " + fromHash)
-	to, proxyURI, transport := r.uriGetTo(fromHash, failures)
-	uri := to + fromURI[len(r.From):]
+	toIdx := r.selectTo(fromHash, tried)
+	to := r.To[toIdx]
+	uri := to.URL + fromURI[len(r.From):]
 	if !r.QueryString.Remap {
 		if i := strings.Index(uri, "?"); i != -1 {
 			uri = uri[:i]
 		}
 	}
-	return uri, proxyURI, transport
+	return uri, to.ProxyURL, to.Transport, toIdx
 }
 
-// uriGetTo is a helper func for URI. It returns the To URL, based on the Parent Selection type. In the event of failure, it logs the error and returns the first parent. Also returns the URL's Proxy URI (if any).
-func (r RemapRule) uriGetTo(fromURI string, failures int) (string, *url.URL, *http.Transport) {
-	switch *r.ParentSelection {
-	case ParentSelectionTypeConsistentHash:
-		return r.uriGetToConsistentHash(fromURI, failures)
-	default:
-		log.Errorf("RemapRule.URI: Rule '%v': Unknown Parent Selection type %v - using first URI in rule\n", r.Name, r.ParentSelection)
-		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport
+// selectTo returns the index in To of the parent to request. This is the first parent, in Parent Selection order, which hasn't been tried and is available. If every untried parent is down, the first untried parent is used anyway, and if every parent has been tried, the first parent.
+func (r RemapRule) selectTo(fromHash string, tried map[int]struct{}) int {
+	now := time.Now()
+	first, untried, available := -1, -1, -1
+	r.visitTo(fromHash, func(i int) bool {
+		if first == -1 {
+			first = i
+		}
+		if _, ok := tried[i]; ok {
+			return true
+		}
+		if untried == -1 {
+			untried = i
+		}
+		if r.To[i].Health.Available(now) {
+			available = i
+			return false
+		}
+		return true
+	})
+	if available != -1 {
+		return available
+	}
+	if untried != -1 {
+		return untried
 	}
+	if first != -1 {
+		return first
+	}
+	return 0
 }
 
-// uriGetToConsistentHash is a helper func for URI, uriGetTo. It returns the To URL using Consistent Hashing. In the event of failure, it logs the error and returns the first parent. Also returns the Proxy URI (if any).
-func (r RemapRule) uriGetToConsistentHash(fromURI string, failures int) (string, *url.URL, *http.Transport) {
-	// fmt.Printf("DEBUGL uriGetToConsistentHash RemapRule %+v\n", r)
-	if r.ConsistentHash == nil {
-		log.Errorf("RemapRule.URI: Rule '%v': Parent Selection Type ConsistentHash, but rule.ConsistentHash is nil! Using first parent\n", r.Name)
-		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport
+// visitTo calls visit with the index in To of each parent, in Parent Selection order, until visit returns false. Every primary parent is visited before any secondary parent, like the ATS parent.config secondary_mode=2, unless the rule is AlternateSecondary.
+func (r RemapRule) visitTo(fromHash string, visit func(i int) bool) {
+	if r.AlternateSecondary {
+		r.visitToAlternate(fromHash, visit)
+		return
 	}
-
-	// fmt.Printf("DEBUGL uriGetToConsistentHash\n")
-	iter, _, err := r.ConsistentHash.Lookup(fromURI)
-	if err != nil {
-		// if r.ConsistentHash.First() == nil {
-		// 	fmt.Printf("DEBUGL uriGetToConsistentHash NodeMap empty!\n")
-		// }
-		// fmt.Printf("DEBUGL uriGetToConsistentHash fromURI '%v' err %v returning '%v'\n", fromURI, err, r.To[0].URL)
-		log.Errorf("RemapRule.URI: Rule '%v': Error looking up Consistent Hash! Using first parent\n", r.Name)
-		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport
+	secondaries := []int{}
+	stopped := false
+	r.visitToSelection(fromHash, func(i int) bool {
+		if r.To[i].Secondary {
+			secondaries = append(secondaries, i)
+			return true
+		}
+		stopped = !visit(i)
+		return !stopped
+	})
+	if stopped {
+		return
 	}
+	for _, i := range secondaries {
+		if !visit(i) {
+			return
+		}
+	}
+}
 
-	for i := 0; i < failures; i++ {
-		iter = iter.NextWrap()
+// visitToAlternate calls visit with the index in To of each parent until visit returns false, alternating between primary and secondary parents in Parent Selection order, like the ATS parent.config secondary_mode=1. Once either is exhausted, the rest of the other are visited.
+func (r RemapRule) visitToAlternate(fromHash string, visit func(i int) bool) {
+	primaries := []int{}
+	secondaries := []int{}
+	r.visitToSelection(fromHash, func(i int) bool {
+		if r.To[i].Secondary {
+			secondaries = append(secondaries, i)
+		} else {
+			primaries = append(primaries, i)
+		}
+		return true
+	})
+	for j := 0; j < len(primaries) || j < len(secondaries); j++ {
+		if j < len(primaries) && !visit(primaries[j]) {
+			return
+		}
+		if j < len(secondaries) && !visit(secondaries[j]) {
+			return
+		}
 	}
+}
 
-	return iter.Val().Name, iter.Val().ProxyURL, iter.Val().Transport
+// visitToSelection calls visit with the index in To of each parent, primary or secondary, in Parent Selection order, until visit returns false. In the event of failure, it logs the error and uses the order of To.
+func (r RemapRule) visitToSelection(fromHash string, visit func(i int) bool) {
+	switch *r.ParentSelection {
+	case ParentSelectionTypeConsistentHash:
+		if r.ConsistentHash == nil {
+			log.Errorf("RemapRule.URI: Rule '%v': Parent Selection Type ConsistentHash, but rule.ConsistentHash is nil! Using parents in order\n", r.Name)
+			break
+		}
+		err := r.ConsistentHash.LookupDistinct(fromHash, func(node *chash.ATSConsistentHashNode) bool { return visit(node.Index) })
+		if err == nil {
+			return
+		}
+		log.Errorf("RemapRule.URI: Rule '%v': Error looking up Consistent Hash! Using parents in order\n", r.Name)
+	default:
+		log.Errorf("RemapRule.URI: Rule '%v': Unknown Parent Selection type %v - using parents in order\n", r.Name, r.ParentSelection)
+	}
+	for i := range r.To {
+		if !visit(i) {
+			return
+		}
+	}
 }
 
 func (r RemapRule) CacheKey(method string, fromURI string) string {
@@ -209,6 +287,8 @@ type RemapRuleToBase struct {
 	URL      string   `json:"url"`
 	Weight   *float64 `json:"weight"`
 	RetryNum *int     `json:"retry_num"`
+	// Secondary is whether this is a secondary parent, which is only requested after every primary parent has been tried or is down.
+	Secondary bool `json:"secondary"`
 }
 
 type RemapRuleTo struct {
@@ -217,6 +297,8 @@ type RemapRuleTo struct {
 	Timeout    *time.Duration
 	RetryCodes map[int]struct{}
 	Transport  *http.Transport
+	// Health is the health of the parent, shared by every rule with the same parent. It may be nil, in which case the parent is always available.
+	Health *parenthealth.Parent
 }
 
 type QueryStringRule struct {
@@ -0,0 +1,96 @@
+package remapdata
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"testing"
+
+	"github.com/apache/trafficcontrol/grove/chash"
+)
+
+func TestSelectToSecondary(t *testing.T) {
+	weight := 1.0
+	names := []string{"primary0", "primary1", "secondary0", "secondary1"}
+	rule := RemapRule{}
+	rule.Name = "rule"
+	selection := ParentSelectionTypeConsistentHash
+	rule.ParentSelection = &selection
+	rule.ConsistentHash = chash.NewSimpleATSConsistentHash(128)
+	for i, name := range names {
+		to := RemapRuleTo{RemapRuleToBase: RemapRuleToBase{URL: "http://" + name, Weight: &weight, Secondary: i >= 2}}
+		rule.To = append(rule.To, to)
+		rule.ConsistentHash.Insert(&chash.ATSConsistentHashNode{Name: to.URL, Index: i}, weight)
+	}
+
+	for _, fromHash := range []string{"/foo", "/bar", "/baz"} {
+		order := []int{}
+		rule.visitTo(fromHash, func(i int) bool {
+			order = append(order, i)
+			return true
+		})
+		if len(order) != len(names) {
+			t.Fatalf("visitTo '%v' expected %v parents, actual %v", fromHash, len(names), order)
+		}
+		for j, i := range order {
+			if secondary := j >= 2; rule.To[i].Secondary != secondary {
+				t.Errorf("visitTo '%v' expected primaries before secondaries, actual %v", fromHash, order)
+				break
+			}
+		}
+
+		tried := map[int]struct{}{order[0]: {}, order[1]: {}}
+		if i := rule.selectTo(fromHash, tried); i != order[2] {
+			t.Errorf("selectTo '%v' with primaries tried expected secondary %v, actual %v", fromHash, order[2], i)
+		}
+	}
+}
+
+func TestSelectToAlternateSecondary(t *testing.T) {
+	weight := 1.0
+	names := []string{"primary0", "primary1", "secondary0", "secondary1", "secondary2"}
+	rule := RemapRule{}
+	rule.Name = "rule"
+	rule.AlternateSecondary = true
+	selection := ParentSelectionTypeConsistentHash
+	rule.ParentSelection = &selection
+	rule.ConsistentHash = chash.NewSimpleATSConsistentHash(128)
+	for i, name := range names {
+		to := RemapRuleTo{RemapRuleToBase: RemapRuleToBase{URL: "http://" + name, Weight: &weight, Secondary: i >= 2}}
+		rule.To = append(rule.To, to)
+		rule.ConsistentHash.Insert(&chash.ATSConsistentHashNode{Name: to.URL, Index: i}, weight)
+	}
+
+	for _, fromHash := range []string{"/foo", "/bar", "/baz"} {
+		order := []int{}
+		rule.visitTo(fromHash, func(i int) bool {
+			order = append(order, i)
+			return true
+		})
+		if len(order) != len(names) {
+			t.Fatalf("visitTo '%v' expected %v parents, actual %v", fromHash, len(names), order)
+		}
+		for j, i := range order {
+			if secondary := j%2 == 1 || j >= 4; rule.To[i].Secondary != secondary {
+				t.Errorf("visitTo '%v' expected primaries alternating with secondaries, actual %v", fromHash, order)
+				break
+			}
+		}
+
+		tried := map[int]struct{}{order[0]: {}}
+		if i := rule.selectTo(fromHash, tried); i != order[1] {
+			t.Errorf("selectTo '%v' with a primary tried expected secondary %v, actual %v", fromHash, order[1], i)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package revalidate
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// Type is what to do with a cached object matched by a revalidation Rule.
+type Type string
+
+const (
+	// TypeNone means no rule matched, and the object may be used as usual.
+	TypeNone = Type("")
+	// TypeStale means the object is considered stale, and must be revalidated with the origin before it's used.
+	TypeStale = Type("STALE")
+	// TypeMiss means the object is considered purged, and must be fetched from the origin as if it weren't cached.
+	TypeMiss = Type("MISS")
+)
+
+// DefaultTTL is how long a rule without an expiration is in effect.
+const DefaultTTL = 24 * time.Hour
+
+// TypeFromString returns the Type of the given string, which is case-insensitive. The empty string is TypeStale, the default. An unknown type returns false.
+func TypeFromString(s string) (Type, bool) {
+	switch t := Type(strings.ToUpper(s)); t {
+	case TypeStale, TypeMiss:
+		return t, true
+	case TypeNone:
+		return TypeStale, true
+	}
+	return TypeNone, false
+}
+
+// Rule marks cached objects whose URL matches Regex, and which were cached before Start, as stale or purged, from Start until Expires.
+//
+// Rules are evaluated when objects are looked up, so adding a rule doesn't walk the cache. Once an object has been revalidated or fetched after Start, the rule no longer matches it.
+type Rule struct {
+	Regex   *regexp.Regexp
+	Start   time.Time
+	Expires time.Time
+	Type    Type
+}
+
+// RuleJSON is the JSON representation of a Rule, in the remap rules file, the revalidate file, and the revalidate plugin endpoint.
+type RuleJSON struct {
+	Regex   string    `json:"regex"`
+	Start   time.Time `json:"start"`
+	Expires time.Time `json:"expires"`
+	Type    string    `json:"type"`
+}
+
+// RuleFromJSON creates a Rule from the given RuleJSON. A zero Start is now, and a zero Expires is Start plus DefaultTTL.
+func RuleFromJSON(j RuleJSON, now time.Time) (Rule, error) {
+	if j.Regex == "" {
+		return Rule{}, errors.New("missing regex")
+	}
+	re, err := regexp.Compile(j.Regex)
+	if err != nil {
+		return Rule{}, errors.New("compiling regex '" + j.Regex + "': " + err.Error())
+	}
+	typ, ok := TypeFromString(j.Type)
+	if !ok {
+		return Rule{}, errors.New("unknown type '" + j.Type + "', must be '" + string(TypeStale) + "' or '" + string(TypeMiss) + "'")
+	}
+	rule := Rule{Regex: re, Start: j.Start, Expires: j.Expires, Type: typ}
+	if rule.Start.IsZero() {
+		rule.Start = now
+	}
+	if rule.Expires.IsZero() {
+		rule.Expires = rule.Start.Add(DefaultTTL)
+	}
+	if !rule.Expires.After(rule.Start) {
+		return Rule{}, errors.New("expires must be after start")
+	}
+	return rule, nil
+}
+
+// RulesFromJSON creates Rules from the given RuleJSONs, returning an error if any is invalid.
+func RulesFromJSON(js []RuleJSON, now time.Time) ([]Rule, error) {
+	rules := make([]Rule, 0, len(js))
+	for _, j := range js {
+		rule, err := RuleFromJSON(j, now)
+		if err != nil {
+			return nil, errors.New("revalidation rule '" + j.Regex + "': " + err.Error())
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// JSON returns the RuleJSON of the rule.
+func (r Rule) JSON() RuleJSON {
+	return RuleJSON{Regex: r.Regex.String(), Start: r.Start, Expires: r.Expires, Type: string(r.Type)}
+}
+
+// Matches returns what to do with the given cached object with the given key, at the given time, according to this rule.
+func (r Rule) Matches(key string, obj *cacheobj.CacheObj, now time.Time) Type {
+	if now.Before(r.Start) || !now.Before(r.Expires) || !obj.ReqRespTime.Before(r.Start) {
+		return TypeNone
+	}
+	if !r.Regex.MatchString(KeyURL(key)) {
+		return TypeNone
+	}
+	return r.Type
+}
+
+// KeyURL returns the URL of the given cache key, which is the method, a colon, and the origin URL. Rules match the URL, so they apply to all methods, like regex_revalidate in ATS.
+func KeyURL(key string) string {
+	if i := strings.Index(key, ":"); i != -1 && !strings.HasPrefix(key[i:], "://") {
+		return key[i+1:]
+	}
+	return key
+}
+
+// Rules is a threadsafe set of revalidation rules. It holds the rules from the remap rules file, which are replaced whenever it's reloaded, and rules added via the revalidate plugin endpoint, which are kept until they expire, and persisted to a file if one is given.
+type Rules struct {
+	fileRules []Rule
+	apiRules  []Rule
+	m         sync.RWMutex
+	path      string
+}
+
+// New creates a new Rules. If path isn't empty, rules added with Add are persisted to it, and any unexpired rules already in it are loaded.
+func New(path string) (*Rules, error) {
+	r := &Rules{path: path}
+	if path == "" {
+		return r, nil
+	}
+	bts, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, errors.New("reading revalidate file '" + path + "': " + err.Error())
+	}
+	js := []RuleJSON{}
+	if err := json.Unmarshal(bts, &js); err != nil {
+		return nil, errors.New("decoding revalidate file '" + path + "': " + err.Error())
+	}
+	rules, err := RulesFromJSON(js, time.Now())
+	if err != nil {
+		return nil, errors.New("loading revalidate file '" + path + "': " + err.Error())
+	}
+	r.apiRules = unexpired(rules, time.Now())
+	return r, nil
+}
+
+// SetFileRules replaces the rules from the remap rules file.
+func (r *Rules) SetFileRules(rules []Rule) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.fileRules = rules
+}
+
+// Add adds the given rule, and persists the added rules if Rules has a file. The rule is added even if persisting fails, in which case the error is returned.
+func (r *Rules) Add(rule Rule) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.apiRules = append(unexpired(r.apiRules, time.Now()), rule)
+	return r.write()
+}
+
+// Remove removes the added rules with the given regex, returning the number removed, and persists the remaining rules if Rules has a file. Rules from the remap rules file can't be removed.
+func (r *Rules) Remove(regex string) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	kept := []Rule{}
+	for _, rule := range r.apiRules {
+		if rule.Regex.String() != regex {
+			kept = append(kept, rule)
+		}
+	}
+	removed := len(r.apiRules) - len(kept)
+	r.apiRules = kept
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, r.write()
+}
+
+// All returns the rules from the remap rules file, and the added rules, which haven't expired.
+func (r *Rules) All(now time.Time) ([]Rule, []Rule) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return unexpired(r.fileRules, now), unexpired(r.apiRules, now)
+}
+
+// Check returns what to do with the given cached object with the given key, at the given time. If rules of both types match, the object is a miss. A nil Rules matches nothing.
+func (r *Rules) Check(key string, obj *cacheobj.CacheObj, now time.Time) Type {
+	if r == nil {
+		return TypeNone
+	}
+	r.m.RLock()
+	defer r.m.RUnlock()
+	typ := TypeNone
+	for _, rules := range [][]Rule{r.fileRules, r.apiRules} {
+		for _, rule := range rules {
+			switch rule.Matches(key, obj, now) {
+			case TypeMiss:
+				return TypeMiss
+			case TypeStale:
+				typ = TypeStale
+			}
+		}
+	}
+	return typ
+}
+
+// write writes the added rules to the file, if any. It must be called with the write lock held.
+func (r *Rules) write() error {
+	if r.path == "" {
+		return nil
+	}
+	js := make([]RuleJSON, 0, len(r.apiRules))
+	for _, rule := range r.apiRules {
+		js = append(js, rule.JSON())
+	}
+	bts, err := json.Marshal(js)
+	if err != nil {
+		return errors.New("encoding revalidate rules: " + err.Error())
+	}
+	tmpPath := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, bts, 0600); err != nil {
+		return errors.New("writing revalidate file '" + tmpPath + "': " + err.Error())
+	}
+	if err := os.Rename(tmpPath, r.path); err != nil {
+		return errors.New("renaming revalidate file '" + tmpPath + "': " + err.Error())
+	}
+	log.Infof("revalidate wrote %v rules to '%v'\n", len(js), r.path)
+	return nil
+}
+
+// unexpired returns the rules which haven't expired at the given time.
+func unexpired(rules []Rule, now time.Time) []Rule {
+	kept := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		if now.Before(rule.Expires) {
+			kept = append(kept, rule)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,143 @@
+package revalidate
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+)
+
+func TestKeyURL(t *testing.T) {
+	tests := map[string]string{
+		"GET:http://origin.example.net/foo": "http://origin.example.net/foo",
+		"HEAD:https://origin.example.net/":  "https://origin.example.net/",
+		"http://origin.example.net/foo":     "http://origin.example.net/foo",
+		"nocolon":                           "nocolon",
+	}
+	for key, expected := range tests {
+		if actual := KeyURL(key); actual != expected {
+			t.Errorf("KeyURL(%v) expected %v actual %v", key, expected, actual)
+		}
+	}
+}
+
+func TestRuleFromJSON(t *testing.T) {
+	now := time.Now()
+	rule, err := RuleFromJSON(RuleJSON{Regex: "http://origin/.*"}, now)
+	if err != nil {
+		t.Fatalf("RuleFromJSON expected nil error, actual %v", err)
+	}
+	if rule.Type != TypeStale {
+		t.Errorf("RuleFromJSON default type expected %v actual %v", TypeStale, rule.Type)
+	}
+	if !rule.Start.Equal(now) {
+		t.Errorf("RuleFromJSON default start expected %v actual %v", now, rule.Start)
+	}
+	if !rule.Expires.Equal(now.Add(DefaultTTL)) {
+		t.Errorf("RuleFromJSON default expires expected %v actual %v", now.Add(DefaultTTL), rule.Expires)
+	}
+
+	invalid := []RuleJSON{
+		{},
+		{Regex: "("},
+		{Regex: "foo", Type: "bar"},
+		{Regex: "foo", Start: now, Expires: now.Add(-time.Hour)},
+	}
+	for _, j := range invalid {
+		if _, err := RuleFromJSON(j, now); err == nil {
+			t.Errorf("RuleFromJSON(%+v) expected error, actual nil", j)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-time.Minute)
+	oldObj := &cacheobj.CacheObj{ReqRespTime: start.Add(-time.Hour)}
+	newObj := &cacheobj.CacheObj{ReqRespTime: start.Add(time.Second)}
+
+	stale, _ := RuleFromJSON(RuleJSON{Regex: `^http://origin/foo/`, Start: start}, now)
+	miss, _ := RuleFromJSON(RuleJSON{Regex: `\.jpg$`, Start: start, Type: "miss"}, now)
+	future, _ := RuleFromJSON(RuleJSON{Regex: `.*`, Start: now.Add(time.Hour), Expires: now.Add(2 * time.Hour)}, now)
+
+	r, _ := New("")
+	r.SetFileRules([]Rule{stale, future})
+	if err := r.Add(miss); err != nil {
+		t.Fatalf("Add expected nil error, actual %v", err)
+	}
+
+	tests := []struct {
+		key      string
+		obj      *cacheobj.CacheObj
+		expected Type
+	}{
+		{"GET:http://origin/foo/a.txt", oldObj, TypeStale},
+		{"GET:http://origin/foo/a.jpg", oldObj, TypeMiss},
+		{"GET:http://origin/bar/a.txt", oldObj, TypeNone},
+		{"GET:http://origin/foo/a.jpg", newObj, TypeNone},
+	}
+	for _, test := range tests {
+		if actual := r.Check(test.key, test.obj, now); actual != test.expected {
+			t.Errorf("Check(%v) expected %v actual %v", test.key, test.expected, actual)
+		}
+	}
+	if actual := r.Check("GET:http://origin/foo/a.txt", oldObj, stale.Expires); actual != TypeNone {
+		t.Errorf("Check after expiration expected %v actual %v", TypeNone, actual)
+	}
+	if actual := (*Rules)(nil).Check("GET:http://origin/foo/a.txt", oldObj, now); actual != TypeNone {
+		t.Errorf("nil Check expected %v actual %v", TypeNone, actual)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revalidate")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "revalidate.json")
+
+	r, err := New(path)
+	if err != nil {
+		t.Fatalf("New expected nil error, actual %v", err)
+	}
+	now := time.Now()
+	for _, regex := range []string{"foo", "bar", "foo"} {
+		rule, _ := RuleFromJSON(RuleJSON{Regex: regex}, now)
+		if err := r.Add(rule); err != nil {
+			t.Fatalf("Add expected nil error, actual %v", err)
+		}
+	}
+	if removed, err := r.Remove("foo"); err != nil || removed != 2 {
+		t.Errorf("Remove expected 2 nil, actual %v %v", removed, err)
+	}
+	if removed, err := r.Remove("baz"); err != nil || removed != 0 {
+		t.Errorf("Remove nonexistent expected 0 nil, actual %v %v", removed, err)
+	}
+
+	loaded, err := New(path)
+	if err != nil {
+		t.Fatalf("New existing file expected nil error, actual %v", err)
+	}
+	_, added := loaded.All(now)
+	if len(added) != 1 || added[0].Regex.String() != "bar" {
+		t.Errorf("New existing file expected rule 'bar', actual %+v", added)
+	}
+}
@@ -16,12 +16,17 @@ package thread
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	cacheobj "github.com/apache/trafficcontrol/grove/cacheobj"
 )
 
 type Getter interface {
-	Get(key string, actualGet func() *cacheobj.CacheObj, canUse func(*cacheobj.CacheObj) bool, reqID uint64) (*cacheobj.CacheObj, uint64)
+	// Get returns the object for the key, calling actualGet only if no other request for the key is in progress. If another request is in progress, Get waits for its object, up to timeout, and calls actualGet itself if it times out or canUse returns false for the object. A timeout of 0 waits indefinitely.
+	// The returned reqID is the ID of the request which called actualGet.
+	Get(key string, actualGet func() *cacheobj.CacheObj, canUse func(*cacheobj.CacheObj) bool, reqID uint64, timeout time.Duration) (*cacheobj.CacheObj, uint64)
+	Stats() GetterStats
 }
 
 type GetterResp struct {
@@ -29,6 +34,18 @@ type GetterResp struct {
 	GetReqID uint64
 }
 
+// GetterStats are the counts of requests made through a Getter.
+type GetterStats struct {
+	// Leaders is the number of requests which called actualGet because no other request for the key was in progress.
+	Leaders uint64
+	// Coalesced is the number of requests given the object of a concurrent request for the same key.
+	Coalesced uint64
+	// TimedOut is the number of requests which timed out waiting for a concurrent request, and made their own request.
+	TimedOut uint64
+	// LeaderFailed is the number of requests which waited for a concurrent request whose object couldn't be used, and made their own request.
+	LeaderFailed uint64
+}
+
 func NewGetter() Getter {
 	return &getter{waiters: map[string][]chan GetterResp{}}
 }
@@ -43,13 +60,20 @@ func NewGetter() Getter {
 // If the Author response can't be used, all Waiters make their own requests.
 // Note this assumes an uncacheable response for one request is likely uncacheable for all, and it's faster and less load on the origin if so.
 // If it's likely the author request is uncacheable, but a different waiter is cacheable for all other waiters, this will be more network, more origin load, and more work. If that's the case for you, consider creating another type that fulfills the Getter interface, and making the Getter configurable.
+//
+// If a Waiter times out, it makes its own request, but remains in the waiters list, so the Author's send doesn't block and is simply discarded.
 type getter struct {
 	// waiters is a map of cache keys to chans for getters.
 	waiters  map[string][]chan GetterResp
 	waitersM sync.Mutex
+
+	leaders      uint64 // Atomic - DO NOT access or modify without atomic operations
+	coalesced    uint64 // Atomic - DO NOT access or modify without atomic operations
+	timedOut     uint64 // Atomic - DO NOT access or modify without atomic operations
+	leaderFailed uint64 // Atomic - DO NOT access or modify without atomic operations
 }
 
-func (g *getter) Get(key string, actualGet func() *cacheobj.CacheObj, canUse func(*cacheobj.CacheObj) bool, reqID uint64) (*cacheobj.CacheObj, uint64) {
+func (g *getter) Get(key string, actualGet func() *cacheobj.CacheObj, canUse func(*cacheobj.CacheObj) bool, reqID uint64, timeout time.Duration) (*cacheobj.CacheObj, uint64) {
 	isAuthor := false
 	// Buffered for performance, so the author can iterate over all wait chans without blocking.
 	// Note this is unused if isAuthor becomes true.
@@ -65,23 +89,60 @@ func (g *getter) Get(key string, actualGet func() *cacheobj.CacheObj, canUse fun
 	g.waitersM.Unlock()
 
 	if isAuthor {
-		obj := actualGet()
-		waitResp := GetterResp{CacheObj: obj, GetReqID: reqID}
+		atomic.AddUint64(&g.leaders, 1)
+		return g.getAuthor(key, actualGet, reqID), reqID
+	}
 
+	waitResp, ok := g.wait(getChan, timeout)
+	if !ok {
+		atomic.AddUint64(&g.timedOut, 1)
+		return actualGet(), reqID
+	}
+	if waitResp.CacheObj == nil || !canUse(waitResp.CacheObj) {
+		// if the Author response can't be used, all Waiters make their own requests
+		atomic.AddUint64(&g.leaderFailed, 1)
+		return actualGet(), reqID
+	}
+	atomic.AddUint64(&g.coalesced, 1)
+	return waitResp.CacheObj, waitResp.GetReqID
+}
+
+// getAuthor calls actualGet, and sends its object to all Waiters. The Waiters are always released, even if actualGet panics, in which case they're sent a nil object and make their own requests.
+func (g *getter) getAuthor(key string, actualGet func() *cacheobj.CacheObj, reqID uint64) *cacheobj.CacheObj {
+	obj := (*cacheobj.CacheObj)(nil)
+	defer func() {
+		waitResp := GetterResp{CacheObj: obj, GetReqID: reqID}
 		g.waitersM.Lock()
 		for _, waitChan := range g.waiters[key] {
 			waitChan <- waitResp
 		}
 		delete(g.waiters, key)
 		g.waitersM.Unlock()
+	}()
+	obj = actualGet()
+	return obj
+}
 
-		return obj, reqID
+// wait waits for the Author's response on the given chan, up to the given timeout. A timeout of 0 waits indefinitely. Returns false if the wait timed out.
+func (g *getter) wait(getChan <-chan GetterResp, timeout time.Duration) (GetterResp, bool) {
+	if timeout <= 0 {
+		return <-getChan, true
 	}
-
-	if waitResp := <-getChan; canUse(waitResp.CacheObj) {
-		return waitResp.CacheObj, waitResp.GetReqID
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case waitResp := <-getChan:
+		return waitResp, true
+	case <-timer.C:
+		return GetterResp{}, false
 	}
+}
 
-	// if the Author response can't be used, all Waiters make their own requests
-	return actualGet(), reqID
+func (g *getter) Stats() GetterStats {
+	return GetterStats{
+		Leaders:      atomic.LoadUint64(&g.leaders),
+		Coalesced:    atomic.LoadUint64(&g.coalesced),
+		TimedOut:     atomic.LoadUint64(&g.timedOut),
+		LeaderFailed: atomic.LoadUint64(&g.leaderFailed),
+	}
 }
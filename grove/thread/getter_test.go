@@ -0,0 +1,173 @@
+package thread
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+)
+
+// getConcurrent starts a leader Get for the key, which blocks until release is closed, then n waiter Gets. It returns once all waiters have been added, and a func to wait for all Gets to return their objects.
+func getConcurrent(g *getter, key string, n int, actualGet func() *cacheobj.CacheObj, canUse func(*cacheobj.CacheObj) bool, timeout time.Duration, release chan struct{}) func() []*cacheobj.CacheObj {
+	objs := make([]*cacheobj.CacheObj, n+1)
+	wg := sync.WaitGroup{}
+	wg.Add(n + 1)
+	go func() {
+		defer wg.Done()
+		objs[0], _ = g.Get(key, func() *cacheobj.CacheObj { <-release; return actualGet() }, canUse, 0, timeout)
+	}()
+	for {
+		g.waitersM.Lock()
+		_, started := g.waiters[key]
+		g.waitersM.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i <= n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			objs[i], _ = g.Get(key, actualGet, canUse, uint64(i), timeout)
+		}(i)
+	}
+	for {
+		g.waitersM.Lock()
+		waiting := len(g.waiters[key])
+		g.waitersM.Unlock()
+		if waiting == n {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return func() []*cacheobj.CacheObj {
+		wg.Wait()
+		return objs
+	}
+}
+
+func TestGetterCoalesces(t *testing.T) {
+	g := NewGetter().(*getter)
+	gets := uint64(0)
+	obj := &cacheobj.CacheObj{Code: 200}
+	actualGet := func() *cacheobj.CacheObj { atomic.AddUint64(&gets, 1); return obj }
+	canUse := func(*cacheobj.CacheObj) bool { return true }
+
+	release := make(chan struct{})
+	wait := getConcurrent(g, "key", 10, actualGet, canUse, 0, release)
+	close(release)
+	for i, o := range wait() {
+		if o != obj {
+			t.Errorf("getter request %v expected leader's object, actual %+v", i, o)
+		}
+	}
+	if actual := atomic.LoadUint64(&gets); actual != 1 {
+		t.Errorf("getter expected 1 parent request, actual %v", actual)
+	}
+	expected := GetterStats{Leaders: 1, Coalesced: 10}
+	if actual := g.Stats(); actual != expected {
+		t.Errorf("getter stats expected %+v, actual %+v", expected, actual)
+	}
+	if len(g.waiters) != 0 {
+		t.Errorf("getter expected no waiters after leader returned, actual %v", len(g.waiters))
+	}
+}
+
+func TestGetterTimeout(t *testing.T) {
+	g := NewGetter().(*getter)
+	gets := uint64(0)
+	actualGet := func() *cacheobj.CacheObj { atomic.AddUint64(&gets, 1); return &cacheobj.CacheObj{Code: 200} }
+	canUse := func(*cacheobj.CacheObj) bool { return true }
+
+	release := make(chan struct{})
+	wait := getConcurrent(g, "key", 5, actualGet, canUse, 10*time.Millisecond, release)
+	for atomic.LoadUint64(&gets) < 5 {
+		time.Sleep(time.Millisecond) // the waiters time out and make their own requests while the leader is blocked
+	}
+	close(release)
+	wait()
+	if actual := atomic.LoadUint64(&gets); actual != 6 {
+		t.Errorf("getter expected 6 parent requests, actual %v", actual)
+	}
+	expected := GetterStats{Leaders: 1, TimedOut: 5}
+	if actual := g.Stats(); actual != expected {
+		t.Errorf("getter stats expected %+v, actual %+v", expected, actual)
+	}
+}
+
+func TestGetterLeaderFailed(t *testing.T) {
+	g := NewGetter().(*getter)
+	gets := uint64(0)
+	actualGet := func() *cacheobj.CacheObj { atomic.AddUint64(&gets, 1); return &cacheobj.CacheObj{Code: 502} }
+	canUse := func(o *cacheobj.CacheObj) bool { return o.Code == 200 }
+
+	release := make(chan struct{})
+	wait := getConcurrent(g, "key", 3, actualGet, canUse, time.Minute, release)
+	close(release)
+	wait()
+	if actual := atomic.LoadUint64(&gets); actual != 4 {
+		t.Errorf("getter expected 4 parent requests, actual %v", actual)
+	}
+	expected := GetterStats{Leaders: 1, LeaderFailed: 3}
+	if actual := g.Stats(); actual != expected {
+		t.Errorf("getter stats expected %+v, actual %+v", expected, actual)
+	}
+}
+
+func TestGetterLeaderPanic(t *testing.T) {
+	g := NewGetter().(*getter)
+	obj := &cacheobj.CacheObj{Code: 200}
+	canUse := func(*cacheobj.CacheObj) bool { return true }
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		defer func() { recover() }()
+		g.Get("key", func() *cacheobj.CacheObj { close(started); <-release; panic("leader panic") }, canUse, 0, 0)
+	}()
+	<-started
+
+	done := make(chan *cacheobj.CacheObj)
+	go func() {
+		o, _ := g.Get("key", func() *cacheobj.CacheObj { return obj }, canUse, 1, 0)
+		done <- o
+	}()
+	for {
+		g.waitersM.Lock()
+		waiting := len(g.waiters["key"])
+		g.waitersM.Unlock()
+		if waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	select {
+	case o := <-done:
+		if o != obj {
+			t.Errorf("getter waiter expected its own object after leader panic, actual %+v", o)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("getter waiter wasn't released after leader panic")
+	}
+	if expected, actual := (GetterStats{Leaders: 1, LeaderFailed: 1}), g.Stats(); actual != expected {
+		t.Errorf("getter stats expected %+v, actual %+v", expected, actual)
+	}
+}
@@ -15,6 +15,8 @@ package tiercache
 */
 
 import (
+	"errors"
+
 	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/icache"
 
@@ -43,8 +45,9 @@ func (c *TierCache) Get(key string) (*cacheobj.CacheObj, bool) {
 	log.Debugf("TierCache.Get '"+key+"' FOUND FIRST: %+v\n", ok)
 	if !ok {
 		v, ok = c.second.Get(key)
-		if ok {
+		if ok && (!v.Chunked || v.Chunks != nil) {
 			// if it was in second but not first, add back to first (LRU behavior)
+			// Chunked objects whose chunks are read from the second cache aren't, because the first wouldn't hold their bodies, only refer to the second.
 			c.first.Add(key, v)
 		}
 		log.Debugf("TierCache.Get '"+key+"' FOUND SECOND: %+v\n", ok)
@@ -63,7 +66,11 @@ func (c *TierCache) Peek(key string) (*cacheobj.CacheObj, bool) {
 }
 
 // Add adds to both internal caches. Returns whether either reported an eviction.
+// Chunked objects whose chunks aren't in memory are only added to the second cache, which their chunks were written to with AddChunk.
 func (c *TierCache) Add(key string, val *cacheobj.CacheObj) bool {
+	if val.Chunked && val.Chunks == nil {
+		return c.second.Add(key, val)
+	}
 	aevict := c.first.Add(key, val)
 	bevict := c.second.Add(key, val)
 	return aevict || bevict
@@ -88,3 +95,27 @@ func (c *TierCache) Keys() []string {
 
 // Capacity returns the maximum size in bytes of the cache
 func (c *TierCache) Capacity() uint64 { return c.second.Capacity() }
+
+// AddChunk implements icache.ChunkWriter, writing chunks to the second cache, so large objects are stored there without being held in the first. If the second cache isn't an icache.ChunkWriter, it returns an error.
+func (c *TierCache) AddChunk(key string, chunkID string, i int, chunk []byte) error {
+	cw, ok := c.second.(icache.ChunkWriter)
+	if !ok {
+		return errors.New("second cache doesn't store chunks")
+	}
+	return cw.AddChunk(key, chunkID, i, chunk)
+}
+
+// AbortChunks implements icache.ChunkWriter.
+func (c *TierCache) AbortChunks(key string, chunkID string, n int) {
+	if cw, ok := c.second.(icache.ChunkWriter); ok {
+		cw.AbortChunks(key, chunkID, n)
+	}
+}
+
+// ChunkSource implements icache.ChunkWriter.
+func (c *TierCache) ChunkSource(key string, chunkID string) func(i int) ([]byte, error) {
+	if cw, ok := c.second.(icache.ChunkWriter); ok {
+		return cw.ChunkSource(key, chunkID)
+	}
+	return func(i int) ([]byte, error) { return nil, errors.New("second cache doesn't store chunks") }
+}
@@ -16,6 +16,7 @@ package web
 
 import (
 	"errors"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -109,14 +110,9 @@ func TryFlush(w http.ResponseWriter) {
 
 // request makes the given request and returns its response code, headers, body, the request time, response time, and any error.
 func Request(transport *http.Transport, r *http.Request) (int, http.Header, []byte, time.Time, time.Time, error) {
-	log.Debugf("request requesting %v headers %v\n", r.RequestURI, r.Header)
-	rr := r
-
-	reqTime := time.Now()
-	resp, err := transport.RoundTrip(rr)
-	respTime := time.Now()
+	resp, reqTime, respTime, err := RequestStream(transport, r)
 	if err != nil {
-		return 0, nil, nil, reqTime, respTime, errors.New("request error: " + err.Error())
+		return 0, nil, nil, reqTime, respTime, err
 	}
 	defer resp.Body.Close()
 
@@ -130,8 +126,37 @@ func Request(transport *http.Transport, r *http.Request) (int, http.Header, []by
 	return resp.StatusCode, resp.Header, body, reqTime, respTime, nil
 }
 
+// RequestStream makes the given request and returns the response without reading its body, the request time, response time, and any error. If the error is nil, the caller must close the response body.
+func RequestStream(transport *http.Transport, r *http.Request) (*http.Response, time.Time, time.Time, error) {
+	log.Debugf("request requesting %v headers %v\n", r.RequestURI, r.Header)
+	rr := r
+
+	reqTime := time.Now()
+	resp, err := transport.RoundTrip(rr)
+	respTime := time.Now()
+	if err != nil {
+		return nil, reqTime, respTime, errors.New("request error: " + err.Error())
+	}
+	return resp, reqTime, respTime, nil
+}
+
 // Respond writes the given code, header, and body to the ResponseWriter. If connectionClose, a Connection: Close header is also written. Returns the bytes written, and any error.
 func Respond(w http.ResponseWriter, code int, header http.Header, body []byte, connectionClose bool) (uint64, error) {
+	RespondHeader(w, code, header, connectionClose)
+	bytesWritten, err := w.Write(body) // get the less-accurate body bytes written, in case we can't get the more accurate intercepted data
+
+	// bytesWritten = int(WriteStats(stats, w, conn, reqFQDN, remoteAddr, code, uint64(bytesWritten))) // TODO write err to stats?
+	return uint64(bytesWritten), err
+}
+
+// RespondStream is like Respond, but writes the body with the given writeBody func, so the whole body needn't be in memory. The writeBody func must return the bytes it wrote, and any error.
+func RespondStream(w http.ResponseWriter, code int, header http.Header, writeBody func(w io.Writer) (uint64, error), connectionClose bool) (uint64, error) {
+	RespondHeader(w, code, header, connectionClose)
+	return writeBody(w)
+}
+
+// RespondHeader writes the given code and header to the ResponseWriter, without a body. If connectionClose, a Connection: Close header is also written.
+func RespondHeader(w http.ResponseWriter, code int, header http.Header, connectionClose bool) {
 	// TODO move connectionClose to modhdr plugin
 	dH := w.Header()
 	CopyHeaderTo(header, &dH)
@@ -139,10 +164,6 @@ func Respond(w http.ResponseWriter, code int, header http.Header, body []byte, c
 		dH.Add("Connection", "close")
 	}
 	w.WriteHeader(code)
-	bytesWritten, err := w.Write(body) // get the less-accurate body bytes written, in case we can't get the more accurate intercepted data
-
-	// bytesWritten = int(WriteStats(stats, w, conn, reqFQDN, remoteAddr, code, uint64(bytesWritten))) // TODO write err to stats?
-	return uint64(bytesWritten), err
 }
 
 // ServeReqErr writes the appropriate response to the client, via given writer, for a generic request error. Returns the code sent, the body bytes written, and any write error.
@@ -0,0 +1,268 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// CacheDS is a Delivery Service served by a cache, with the request host names and parents its ATS remap.config and
+// parent.config would have. This allows config for caches other than ATS to be generated from the same Traffic Ops
+// data, serving the same Delivery Services with the same parents.
+type CacheDS struct {
+	// DS is the Delivery Service. It's guaranteed to have a non-nil XMLID, Type, DSCP, ID, Active, Topology,
+	// OrgServerFQDN, and header rewrites, which may be empty.
+	DS DeliveryService
+	// RequestFQDNs is the host names clients request the Delivery Service with. For mids, this is the origin's.
+	// It's empty for ANY_MAP Delivery Services, whose remap text is only meaningful to ATS.
+	RequestFQDNs []string
+	// HTTP and HTTPS are whether the cache serves the Delivery Service over HTTP and HTTPS.
+	HTTP  bool
+	HTTPS bool
+	// Origin is the Delivery Service's origin, with its port. It's nil for ANY_MAP Delivery Services.
+	Origin *url.URL
+	// Parents is the parentage of the Delivery Service. If it has no Parents, the cache requests the Origin directly.
+	Parents CacheDSParents
+}
+
+// CacheDSParents is the parentage of a CacheDS. It's the same parentage as the Delivery Service's strategies.yaml
+// strategy.
+type CacheDSParents struct {
+	// Parents is the primary parents.
+	Parents []TopologyParent
+	// SecondaryParents is the parents requested if the primary parents fail.
+	SecondaryParents []TopologyParent
+	// TryAllPrimariesBeforeSecondary is whether every primary parent should be tried before any secondary parent.
+	TryAllPrimariesBeforeSecondary bool
+	// Scheme is the scheme of requests to the parents.
+	Scheme string
+	// Policy is the parent selection policy, one of the StrategyPolicy constants.
+	Policy string
+	// HashKey is the part of the request used by the consistent hash, "path" or "path+query". It's empty unless
+	// Policy is StrategyPolicyConsistentHash.
+	HashKey string
+	// GoDirect is whether the origin may be requested directly if the parents fail.
+	GoDirect bool
+	// ParentIsProxy is whether the parents are caches, rather than origins.
+	ParentIsProxy bool
+}
+
+// MakeCacheDSes returns the Delivery Services served by the given server, sorted by name, and any warnings.
+// These are the Delivery Services MakeRemapDotConfig creates remap rules for, with the parents MakeParentDotConfig
+// gives them.
+func MakeCacheDSes(
+	server *Server,
+	unfilteredDSes []DeliveryService,
+	dss []DeliveryServiceServer,
+	dsRegexArr []tc.DeliveryServiceRegexes,
+	servers []Server,
+	topologies []tc.Topology,
+	tcServerParams []tc.Parameter,
+	tcParentConfigParams []tc.Parameter,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	cacheGroupArr []tc.CacheGroupNullable,
+	cdn *tc.CDN,
+) ([]CacheDS, []string, error) {
+	warnings := []string{}
+	if server.HostName == nil {
+		return nil, warnings, errors.New("server HostName missing")
+	} else if server.ID == nil {
+		return nil, warnings, errors.New("server ID missing")
+	} else if server.Cachegroup == nil {
+		return nil, warnings, errors.New("server Cachegroup missing")
+	} else if cdn == nil {
+		return nil, warnings, errors.New("cdn missing")
+	}
+
+	data, dataWarns, err := makeParentConfigData(unfilteredDSes, server, servers, topologies, tcServerParams, tcParentConfigParams, serverCapabilities, cacheGroupArr, dss, cdn)
+	warnings = append(warnings, dataWarns...)
+	if err != nil {
+		return nil, warnings, errors.New("making parent data: " + err.Error())
+	}
+
+	isMid := tc.CacheTypeFromString(server.Type) == tc.CacheTypeMid
+	dsRegexes := makeDSRegexMap(dsRegexArr)
+	dses, dsWarns := remapFilterDSes(server, dss, unfilteredDSes, nil)
+	warnings = append(warnings, dsWarns...)
+	sort.Sort(dsesSortByName(dses))
+
+	cacheDSes := []CacheDS{}
+	for _, ds := range dses {
+		if !hasRequiredCapabilities(serverCapabilities[*server.ID], dsRequiredCapabilities[*ds.ID]) {
+			continue
+		}
+		topology, hasTopology := data.NameTopologies[TopologyName(*ds.Topology)]
+		if *ds.Topology != "" && hasTopology {
+			topoIncludesServer, err := topologyIncludesServerNullable(topology, server)
+			if err != nil {
+				return nil, warnings, errors.New("getting Topology Server inclusion: " + err.Error())
+			}
+			if !topoIncludesServer {
+				continue
+			}
+		}
+
+		if *ds.Type == tc.DSTypeAnyMap {
+			if !isMid {
+				cacheDSes = append(cacheDSes, CacheDS{DS: ds})
+			}
+			continue
+		}
+		if isMid && !ds.Type.UsesMidCache() && (!hasTopology || *ds.Topology == "") {
+			continue // Live local delivery services skip mids (except Topologies ignore DS types)
+		}
+		if *ds.OrgServerFQDN == "" {
+			warnings = append(warnings, "ds '"+*ds.XMLID+"' has no origin fqdn, skipping!")
+			continue
+		}
+		if ds.Protocol == nil {
+			warnings = append(warnings, "ds '"+*ds.XMLID+"' has no protocol, skipping!")
+			continue
+		}
+
+		orgURI, orgWarns, err := getOriginURI(*ds.OrgServerFQDN)
+		warnings = append(warnings, orgWarns...)
+		if err != nil {
+			warnings = append(warnings, "ds '"+*ds.XMLID+"' has malformed origin URI '"+*ds.OrgServerFQDN+"', skipping! "+err.Error())
+			continue
+		}
+
+		cacheDS := CacheDS{DS: ds, Origin: orgURI}
+		if isMid {
+			// mids receive the requests of their children, which have already been remapped to the origin.
+			cacheDS.RequestFQDNs = []string{orgURI.Hostname()}
+			cacheDS.HTTP = true
+		} else {
+			cacheDS.RequestFQDNs, err = getDSRequestFQDNs(&ds, dsRegexes[tc.DeliveryServiceName(*ds.XMLID)], server, cdn.DomainName)
+			if err != nil {
+				warnings = append(warnings, "error getting ds '"+*ds.XMLID+"' request fqdns, skipping! Error: "+err.Error())
+				continue
+			}
+			cacheDS.HTTP = *ds.Protocol == tc.DSProtocolHTTP || *ds.Protocol == tc.DSProtocolHTTPAndHTTPS || *ds.Protocol == tc.DSProtocolHTTPToHTTPS
+			cacheDS.HTTPS = *ds.Protocol == tc.DSProtocolHTTPS || *ds.Protocol == tc.DSProtocolHTTPToHTTPS || *ds.Protocol == tc.DSProtocolHTTPAndHTTPS
+		}
+
+		if dsUsesStrategy(&ds, data.CacheIsTopLevel, data.ParentServerDSes[*server.ID]) {
+			st, stOK, stWarns, err := makeDSStrategy(server, servers, &ds, data, serverCapabilities, dsRequiredCapabilities)
+			warnings = append(warnings, stWarns...)
+			if err != nil {
+				warnings = append(warnings, "ds '"+*ds.XMLID+"' parents: "+err.Error()+" skipping!")
+				continue
+			}
+			if stOK {
+				cacheDS.Parents = CacheDSParents{
+					Parents:                        st.Parents,
+					SecondaryParents:               st.SecondaryParents,
+					TryAllPrimariesBeforeSecondary: st.RingMode == StrategyRingModeExhaust,
+					Scheme:                         st.Scheme,
+					Policy:                         st.Policy,
+					HashKey:                        st.HashKey,
+					GoDirect:                       st.GoDirect,
+					ParentIsProxy:                  st.ParentIsProxy,
+				}
+			}
+		}
+		cacheDSes = append(cacheDSes, cacheDS)
+	}
+	return cacheDSes, warnings, nil
+}
+
+// CacheDSFeature is a feature of a Delivery Service which a cache's config may or may not support.
+// Config backends for caches other than ATS use these to warn about Delivery Services they can't fully serve.
+type CacheDSFeature string
+
+const (
+	CacheDSFeatureHTTPS                = CacheDSFeature("HTTPS")
+	CacheDSFeatureHTTPToHTTPS          = CacheDSFeature("HTTP to HTTPS redirect")
+	CacheDSFeatureParents              = CacheDSFeature("parents")
+	CacheDSFeatureSecondaryParents     = CacheDSFeature("secondary parents")
+	CacheDSFeatureGoDirect             = CacheDSFeature("go direct to origin")
+	CacheDSFeatureHTTPSOrigin          = CacheDSFeature("HTTPS origin")
+	CacheDSFeatureQStringIgnore        = CacheDSFeature("query string ignored in cache key")
+	CacheDSFeatureQStringDrop          = CacheDSFeature("query string dropped at edge")
+	CacheDSFeatureMaxOriginConnections = CacheDSFeature("max origin connections")
+	CacheDSFeatureHeaderRewrite        = CacheDSFeature("header rewrite")
+	CacheDSFeatureRegexRemap           = CacheDSFeature("regex remap")
+	CacheDSFeatureCacheURL             = CacheDSFeature("cache URL")
+	CacheDSFeatureURLSig               = CacheDSFeature("URL signing")
+	CacheDSFeatureURISigning           = CacheDSFeature("URI signing")
+	CacheDSFeatureRangeBackgroundFetch = CacheDSFeature("range request background fetch")
+	CacheDSFeatureRangeCache           = CacheDSFeature("range request caching")
+	CacheDSFeatureRangeSlice           = CacheDSFeature("range request slicing")
+	CacheDSFeatureDSCP                 = CacheDSFeature("DSCP")
+	CacheDSFeatureFQPacing             = CacheDSFeature("fair queuing pacing rate")
+	CacheDSFeatureAnyMap               = CacheDSFeature("ANY_MAP remap text")
+)
+
+// Features returns the features the Delivery Service uses on the cache.
+func (cds CacheDS) Features() []CacheDSFeature {
+	ds := cds.DS
+	features := []CacheDSFeature{}
+	add := func(use bool, feature CacheDSFeature) {
+		if use {
+			features = append(features, feature)
+		}
+	}
+	notEmpty := func(s *string) bool { return s != nil && *s != "" }
+	positive := func(i *int) bool { return i != nil && *i > 0 }
+
+	if ds.Type != nil && *ds.Type == tc.DSTypeAnyMap {
+		return []CacheDSFeature{CacheDSFeatureAnyMap}
+	}
+	add(cds.HTTPS, CacheDSFeatureHTTPS)
+	add(ds.Protocol != nil && *ds.Protocol == tc.DSProtocolHTTPToHTTPS && cds.HTTP, CacheDSFeatureHTTPToHTTPS)
+	add(len(cds.Parents.Parents) > 0, CacheDSFeatureParents)
+	add(len(cds.Parents.SecondaryParents) > 0, CacheDSFeatureSecondaryParents)
+	add(cds.Parents.GoDirect, CacheDSFeatureGoDirect)
+	add(cds.Origin != nil && cds.Origin.Scheme == "https" && (len(cds.Parents.Parents) == 0 || !cds.Parents.ParentIsProxy || cds.Parents.GoDirect), CacheDSFeatureHTTPSOrigin)
+	add(ds.QStringIgnore != nil && *ds.QStringIgnore == tc.QueryStringIgnoreIgnoreInCacheKeyAndPassUp, CacheDSFeatureQStringIgnore)
+	add(ds.QStringIgnore != nil && *ds.QStringIgnore == tc.QueryStringIgnoreDropAtEdge, CacheDSFeatureQStringDrop)
+	add(positive(ds.MaxOriginConnections), CacheDSFeatureMaxOriginConnections)
+	add(notEmpty(ds.EdgeHeaderRewrite) || notEmpty(ds.MidHeaderRewrite) || notEmpty(ds.FirstHeaderRewrite) || notEmpty(ds.InnerHeaderRewrite) || notEmpty(ds.LastHeaderRewrite), CacheDSFeatureHeaderRewrite)
+	add(notEmpty(ds.RegexRemap), CacheDSFeatureRegexRemap)
+	add(notEmpty(ds.CacheURL), CacheDSFeatureCacheURL)
+	add(ds.SigningAlgorithm != nil && *ds.SigningAlgorithm == tc.SigningAlgorithmURLSig, CacheDSFeatureURLSig)
+	add(ds.SigningAlgorithm != nil && *ds.SigningAlgorithm == tc.SigningAlgorithmURISigning, CacheDSFeatureURISigning)
+	if ds.RangeRequestHandling != nil {
+		add(*ds.RangeRequestHandling == tc.RangeRequestHandlingBackgroundFetch, CacheDSFeatureRangeBackgroundFetch)
+		add(*ds.RangeRequestHandling == tc.RangeRequestHandlingCacheRangeRequest, CacheDSFeatureRangeCache)
+		add(*ds.RangeRequestHandling == tc.RangeRequestHandlingSlice, CacheDSFeatureRangeSlice)
+	}
+	add(positive(ds.DSCP), CacheDSFeatureDSCP)
+	add(positive(ds.FQPacingRate), CacheDSFeatureFQPacing)
+	return features
+}
+
+// UnsupportedFeatureWarnings returns a warning for each feature the Delivery Service uses which isn't in supported.
+// The software is the name of the cache software, for the warning text.
+func (cds CacheDS) UnsupportedFeatureWarnings(software string, supported map[CacheDSFeature]struct{}) []string {
+	warnings := []string{}
+	for _, feature := range cds.Features() {
+		if _, ok := supported[feature]; !ok {
+			warnings = append(warnings, "ds '"+*cds.DS.XMLID+"' uses "+string(feature)+", which "+software+" config doesn't support, ignoring!")
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,207 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+)
+
+func makeCacheDSesDS(id int, name string, dsType tc.DSType, protocol int, origin string) DeliveryService {
+	ds := makeParentDS()
+	ds.ID = util.IntPtr(id)
+	ds.XMLID = util.StrPtr(name)
+	ds.Type = &dsType
+	ds.Protocol = util.IntPtr(protocol)
+	ds.OrgServerFQDN = util.StrPtr(origin)
+	ds.RoutingName = util.StrPtr("cdn")
+	ds.Active = util.BoolPtr(true)
+	ds.DSCP = util.IntPtr(0)
+	return *ds
+}
+
+func TestMakeCacheDSes(t *testing.T) {
+	// secondary parents, HTTP to HTTPS
+	ds0 := makeCacheDSesDS(42, "ds0", tc.DSTypeHTTP, tc.DSProtocolHTTPToHTTPS, "http://ds0.example.net")
+	ds0.ProfileName = util.StrPtr("ds0Profile")
+	ds0.ProfileID = util.IntPtr(994)
+	// topology, HTTPS origin
+	ds1 := makeCacheDSesDS(43, "ds1", tc.DSTypeDNS, tc.DSProtocolHTTP, "https://ds1.example.net:8443")
+	ds1.Topology = util.StrPtr("t0")
+	// live local, which goes directly to the origin
+	ds2 := makeCacheDSesDS(44, "ds2", tc.DSTypeHTTPLive, tc.DSProtocolHTTPS, "http://ds2.example.net")
+	// any map, which has no request hosts or origin
+	ds3 := makeCacheDSesDS(45, "ds3", tc.DSTypeAnyMap, tc.DSProtocolHTTP, "")
+	// not assigned to the server
+	ds4 := makeCacheDSesDS(46, "ds4", tc.DSTypeHTTP, tc.DSProtocolHTTP, "http://ds4.example.net")
+
+	dses := []DeliveryService{ds4, ds3, ds2, ds1, ds0}
+
+	dsRegexes := []tc.DeliveryServiceRegexes{}
+	for _, ds := range dses {
+		dsRegexes = append(dsRegexes, tc.DeliveryServiceRegexes{
+			DSName:  *ds.XMLID,
+			Regexes: []tc.DeliveryServiceRegex{{Type: string(tc.DSMatchTypeHostRegex), Pattern: `.*\.` + *ds.XMLID + `\..*`}},
+		})
+	}
+
+	mCG0 := makeStrategiesCG("midCG0", 500, tc.CacheGroupMidTypeName, nil, nil)
+	mCG1 := makeStrategiesCG("midCG1", 501, tc.CacheGroupMidTypeName, nil, nil)
+	eCG := makeStrategiesCG("edgeCG", 400, tc.CacheGroupEdgeTypeName, &mCG0, &mCG1)
+	cgs := []tc.CacheGroupNullable{eCG, mCG0, mCG1}
+
+	server := makeStrategiesServer("myedge", 44, eCG, "EDGE", "192.168.2.1")
+	mid0 := makeStrategiesServer("mymid0", 45, mCG0, "MID", "192.168.2.2")
+	servers := []Server{
+		server,
+		mid0,
+		makeStrategiesServer("mymid1", 46, mCG1, "MID", "192.168.2.3"),
+	}
+
+	topologies := []tc.Topology{
+		tc.Topology{
+			Name: "t0",
+			Nodes: []tc.TopologyNode{
+				tc.TopologyNode{Cachegroup: "edgeCG", Parents: []int{1}},
+				tc.TopologyNode{Cachegroup: "midCG1"},
+			},
+		},
+	}
+
+	dss := []DeliveryServiceServer{
+		DeliveryServiceServer{Server: *server.ID, DeliveryService: *ds0.ID},
+		DeliveryServiceServer{Server: *server.ID, DeliveryService: *ds2.ID},
+		DeliveryServiceServer{Server: *server.ID, DeliveryService: *ds3.ID},
+		DeliveryServiceServer{Server: *mid0.ID, DeliveryService: *ds0.ID},
+		DeliveryServiceServer{Server: *mid0.ID, DeliveryService: *ds3.ID},
+	}
+	cdn := &tc.CDN{DomainName: "cdndomain.example", Name: "my-cdn-name"}
+
+	serverParams := makeStrategiesParams("9")
+	parentConfigParams := []tc.Parameter{
+		tc.Parameter{
+			Name:       ParentConfigParamSecondaryMode,
+			ConfigFile: "parent.config",
+			Value:      "",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+	}
+
+	cacheDSes, warnings, err := MakeCacheDSes(&server, dses, dss, dsRegexes, servers, topologies, serverParams, parentConfigParams, nil, nil, cgs, cdn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("expected no warnings, actual: %+v", warnings)
+	}
+
+	names := []string{}
+	for _, cds := range cacheDSes {
+		names = append(names, *cds.DS.XMLID)
+	}
+	if expected := []string{"ds0", "ds1", "ds2", "ds3"}; !reflect.DeepEqual(expected, names) {
+		t.Fatalf("expected edge cache dses %+v, actual %+v", expected, names)
+	}
+	ds0CDS, ds1CDS, ds2CDS, ds3CDS := cacheDSes[0], cacheDSes[1], cacheDSes[2], cacheDSes[3]
+
+	if expected := []string{"myedge.ds0.cdndomain.example"}; !reflect.DeepEqual(expected, ds0CDS.RequestFQDNs) {
+		t.Errorf("expected ds0 request fqdns %+v, actual %+v", expected, ds0CDS.RequestFQDNs)
+	}
+	if !ds0CDS.HTTP || !ds0CDS.HTTPS {
+		t.Errorf("expected HTTP to HTTPS ds0 to be HTTP and HTTPS, actual HTTP %v HTTPS %v", ds0CDS.HTTP, ds0CDS.HTTPS)
+	}
+	if len(ds0CDS.Parents.Parents) != 1 || ds0CDS.Parents.Parents[0].Host != "mymid0.mydomain.example.net" {
+		t.Errorf("expected ds0 parent mymid0, actual %+v", ds0CDS.Parents.Parents)
+	}
+	if len(ds0CDS.Parents.SecondaryParents) != 1 || ds0CDS.Parents.SecondaryParents[0].Host != "mymid1.mydomain.example.net" {
+		t.Errorf("expected ds0 secondary parent mymid1, actual %+v", ds0CDS.Parents.SecondaryParents)
+	}
+	if !ds0CDS.Parents.ParentIsProxy {
+		t.Errorf("expected ds0 parents to be proxies")
+	}
+
+	if expected := []string{"cdn.ds1.cdndomain.example"}; !reflect.DeepEqual(expected, ds1CDS.RequestFQDNs) {
+		t.Errorf("expected dns ds1 request fqdns %+v, actual %+v", expected, ds1CDS.RequestFQDNs)
+	}
+	if ds1CDS.Origin == nil || ds1CDS.Origin.Scheme != "https" || ds1CDS.Origin.Port() != "8443" {
+		t.Errorf("expected ds1 origin https port 8443, actual %+v", ds1CDS.Origin)
+	}
+	if len(ds1CDS.Parents.Parents) != 1 || ds1CDS.Parents.Parents[0].Host != "mymid1.mydomain.example.net" {
+		t.Errorf("expected ds1 topology parent mymid1, actual %+v", ds1CDS.Parents.Parents)
+	}
+
+	if ds2CDS.HTTP || !ds2CDS.HTTPS {
+		t.Errorf("expected HTTPS ds2 to be only HTTPS, actual HTTP %v HTTPS %v", ds2CDS.HTTP, ds2CDS.HTTPS)
+	}
+	if len(ds2CDS.Parents.Parents) != 0 {
+		t.Errorf("expected live local ds2 to go directly to the origin, actual parents %+v", ds2CDS.Parents.Parents)
+	}
+
+	if ds3CDS.Origin != nil || len(ds3CDS.RequestFQDNs) != 0 {
+		t.Errorf("expected any map ds3 to have no origin or request fqdns, actual %+v %+v", ds3CDS.Origin, ds3CDS.RequestFQDNs)
+	}
+
+	midCacheDSes, warnings, err := MakeCacheDSes(&mid0, dses, dss, dsRegexes, servers, topologies, serverParams, parentConfigParams, nil, nil, cgs, cdn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("expected no warnings, actual: %+v", warnings)
+	}
+	if len(midCacheDSes) != 1 || *midCacheDSes[0].DS.XMLID != "ds0" {
+		t.Fatalf("expected mid cache dses to be only ds0, actual %+v", midCacheDSes)
+	}
+	if expected := []string{"ds0.example.net"}; !reflect.DeepEqual(expected, midCacheDSes[0].RequestFQDNs) {
+		t.Errorf("expected mid ds0 request fqdns to be the origin %+v, actual %+v", expected, midCacheDSes[0].RequestFQDNs)
+	}
+	if !midCacheDSes[0].HTTP || midCacheDSes[0].HTTPS {
+		t.Errorf("expected mid ds0 to be only HTTP, actual HTTP %v HTTPS %v", midCacheDSes[0].HTTP, midCacheDSes[0].HTTPS)
+	}
+}
+
+func TestCacheDSUnsupportedFeatureWarnings(t *testing.T) {
+	ds := makeCacheDSesDS(42, "ds0", tc.DSTypeHTTP, tc.DSProtocolHTTPToHTTPS, "http://ds0.example.net")
+	ds.RegexRemap = util.StrPtr("foo")
+	ds.DSCP = util.IntPtr(8)
+	cds := CacheDS{DS: ds, HTTP: true, HTTPS: true}
+
+	expected := []CacheDSFeature{CacheDSFeatureHTTPS, CacheDSFeatureHTTPToHTTPS, CacheDSFeatureQStringDrop, CacheDSFeatureRegexRemap, CacheDSFeatureDSCP}
+	if actual := cds.Features(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected features %+v, actual %+v", expected, actual)
+	}
+
+	supported := map[CacheDSFeature]struct{}{
+		CacheDSFeatureHTTPS:       {},
+		CacheDSFeatureHTTPToHTTPS: {},
+		CacheDSFeatureQStringDrop: {},
+	}
+	warnings := cds.UnsupportedFeatureWarnings("mycache", supported)
+	expectedWarnings := []string{
+		"ds 'ds0' uses regex remap, which mycache config doesn't support, ignoring!",
+		"ds 'ds0' uses DSCP, which mycache config doesn't support, ignoring!",
+	}
+	if !reflect.DeepEqual(expectedWarnings, warnings) {
+		t.Errorf("expected warnings %+v, actual %+v", expectedWarnings, warnings)
+	}
+}
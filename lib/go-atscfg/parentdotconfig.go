@@ -23,6 +23,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"regexp"
 	"sort"
@@ -97,31 +98,22 @@ func MakeParentDotConfig(
 ) (Cfg, error) {
 	warnings := []string{}
 
-	if server.HostName == nil || *server.HostName == "" {
-		return Cfg{}, makeErr(warnings, "server HostName missing")
-	} else if server.CDNName == nil || *server.CDNName == "" {
-		return Cfg{}, makeErr(warnings, "server CDNName missing")
-	} else if server.Cachegroup == nil || *server.Cachegroup == "" {
-		return Cfg{}, makeErr(warnings, "server Cachegroup missing")
-	} else if server.Profile == nil || *server.Profile == "" {
-		return Cfg{}, makeErr(warnings, "server Profile missing")
-	} else if server.TCPPort == nil {
-		return Cfg{}, makeErr(warnings, "server TCPPort missing")
-	}
-
-	atsMajorVer, verWarns := getATSMajorVersion(tcServerParams)
-	warnings = append(warnings, verWarns...)
-
-	cacheGroups, err := makeCGMap(cacheGroupArr)
+	data, dataWarns, err := makeParentConfigData(dses, server, servers, topologies, tcServerParams, tcParentConfigParams, serverCapabilities, cacheGroupArr, dss, cdn)
+	warnings = append(warnings, dataWarns...)
 	if err != nil {
-		return Cfg{}, makeErr(warnings, "making CacheGroup map: "+err.Error())
-	}
-	serverParentCGData, err := getParentCacheGroupData(server, cacheGroups)
-	if err != nil {
-		return Cfg{}, makeErr(warnings, "getting server parent cachegroup data: "+err.Error())
-	}
-	cacheIsTopLevel := isTopLevelCache(serverParentCGData)
-	serverCDNDomain := cdn.DomainName
+		return Cfg{}, makeErr(warnings, err.Error())
+	}
+	atsMajorVer := data.ATSMajorVer
+	cacheGroups := data.CacheGroups
+	serverParentCGData := data.ServerParentCGData
+	cacheIsTopLevel := data.CacheIsTopLevel
+	parentConfigParams := data.ParentConfigParams
+	profileParentConfigParams := data.ProfileParentConfigParams
+	serverParams := data.ServerParams
+	nameTopologies := data.NameTopologies
+	parentServerDSes := data.ParentServerDSes
+	parentInfos := data.ParentInfos
+	dsOrigins := data.DSOrigins
 
 	sort.Sort(dsesSortByName(dses))
 
@@ -133,135 +125,6 @@ func MakeParentDotConfig(
 	textArr := []string{}
 	processedOriginsToDSNames := map[string]tc.DeliveryServiceName{}
 
-	parentConfigParamsWithProfiles, err := tcParamsToParamsWithProfiles(tcParentConfigParams)
-	if err != nil {
-		warnings = append(warnings, "error getting profiles from Traffic Ops Parameters, Parameters will not be considered for generation! : "+err.Error())
-		parentConfigParamsWithProfiles = []parameterWithProfiles{}
-	}
-	parentConfigParams := parameterWithProfilesToMap(parentConfigParamsWithProfiles)
-
-	// this is an optimization, to avoid looping over all params, for every DS. Instead, we loop over all params only once, and put them in a profile map.
-	profileParentConfigParams := map[string]map[string]string{} // map[profileName][paramName]paramVal
-	for _, param := range parentConfigParamsWithProfiles {
-		for _, profile := range param.ProfileNames {
-			if _, ok := profileParentConfigParams[profile]; !ok {
-				profileParentConfigParams[profile] = map[string]string{}
-			}
-			profileParentConfigParams[profile][param.Name] = param.Value
-		}
-	}
-
-	// We only need parent.config params, don't need all the params on the server
-	serverParams := map[string]string{}
-	if server.Profile == nil || *server.Profile != "" { // TODO warn/error if false? Servers requires profiles
-		for name, val := range profileParentConfigParams[*server.Profile] {
-			if name == ParentConfigParamQStringHandling ||
-				name == ParentConfigParamAlgorithm ||
-				name == ParentConfigParamQString {
-				serverParams[name] = val
-			}
-		}
-	}
-
-	parentCacheGroups := map[string]struct{}{}
-	if cacheIsTopLevel {
-		for _, cg := range cacheGroups {
-			if cg.Type == nil {
-				return Cfg{}, makeErr(warnings, "cachegroup type is nil!")
-			}
-			if cg.Name == nil {
-				return Cfg{}, makeErr(warnings, "cachegroup name is nil!")
-			}
-
-			if *cg.Type != tc.CacheGroupOriginTypeName {
-				continue
-			}
-			parentCacheGroups[*cg.Name] = struct{}{}
-		}
-	} else {
-		for _, cg := range cacheGroups {
-			if cg.Type == nil {
-				return Cfg{}, makeErr(warnings, "cachegroup type is nil!")
-			}
-			if cg.Name == nil {
-				return Cfg{}, makeErr(warnings, "cachegroup name is nil!")
-			}
-
-			if *cg.Name == *server.Cachegroup {
-				if cg.ParentName != nil && *cg.ParentName != "" {
-					parentCacheGroups[*cg.ParentName] = struct{}{}
-				}
-				if cg.SecondaryParentName != nil && *cg.SecondaryParentName != "" {
-					parentCacheGroups[*cg.SecondaryParentName] = struct{}{}
-				}
-				break
-			}
-		}
-	}
-
-	nameTopologies := makeTopologyNameMap(topologies)
-
-	cgServers := map[int]Server{} // map[serverID]server
-	for _, sv := range servers {
-		if sv.ID == nil {
-			warnings = append(warnings, "TO servers had server with missing ID, skipping!")
-			continue
-		} else if sv.CDNName == nil {
-			warnings = append(warnings, "TO servers had server with missing CDNName, skipping!")
-			continue
-		} else if sv.Cachegroup == nil || *sv.Cachegroup == "" {
-			warnings = append(warnings, "TO servers had server with missing Cachegroup, skipping!")
-			continue
-		} else if sv.Status == nil || *sv.Status == "" {
-			warnings = append(warnings, "TO servers had server with missing Status, skipping!")
-			continue
-		} else if sv.Type == "" {
-			warnings = append(warnings, "TO servers had server with missing Type, skipping!")
-			continue
-		}
-		if *sv.CDNName != *server.CDNName {
-			continue
-		}
-		if _, ok := parentCacheGroups[*sv.Cachegroup]; !ok {
-			continue
-		}
-		if sv.Type != tc.OriginTypeName &&
-			!strings.HasPrefix(sv.Type, tc.EdgeTypePrefix) &&
-			!strings.HasPrefix(sv.Type, tc.MidTypePrefix) {
-			continue
-		}
-		if *sv.Status != string(tc.CacheStatusReported) && *sv.Status != string(tc.CacheStatusOnline) {
-			continue
-		}
-		cgServers[*sv.ID] = sv
-	}
-
-	cgServerIDs := map[int]struct{}{}
-	for serverID, _ := range cgServers {
-		cgServerIDs[serverID] = struct{}{}
-	}
-	cgServerIDs[*server.ID] = struct{}{}
-
-	cgDSServers := filterDSS(dss, nil, cgServerIDs)
-	parentServerDSes := map[int]map[int]struct{}{} // map[serverID][dsID]
-	for _, dss := range cgDSServers {
-		if parentServerDSes[dss.Server] == nil {
-			parentServerDSes[dss.Server] = map[int]struct{}{}
-		}
-		parentServerDSes[dss.Server][dss.DeliveryService] = struct{}{}
-	}
-
-	originServers, profileCaches, orgProfWarns, err := getOriginServersAndProfileCaches(cgServers, parentServerDSes, profileParentConfigParams, dses, serverCapabilities)
-	warnings = append(warnings, orgProfWarns...)
-	if err != nil {
-		return Cfg{}, makeErr(warnings, "getting origin servers and profile caches: "+err.Error())
-	}
-
-	parentInfos := makeParentInfo(serverParentCGData, serverCDNDomain, profileCaches, originServers)
-
-	dsOrigins, dsOriginWarns := makeDSOrigins(dss, dses, servers)
-	warnings = append(warnings, dsOriginWarns...)
-
 	for _, ds := range dses {
 		if ds.XMLID == nil || *ds.XMLID == "" {
 			warnings = append(warnings, "got ds with missing XMLID, skipping!")
@@ -452,6 +315,213 @@ func MakeParentDotConfig(
 	}, nil
 }
 
+// parentConfigData is the data used to create the parent.config and strategies.yaml parentage of a server.
+type parentConfigData struct {
+	ATSMajorVer               int
+	CacheGroups               map[tc.CacheGroupName]tc.CacheGroupNullable
+	ServerParentCGData        serverParentCacheGroupData
+	CacheIsTopLevel           bool
+	ParentConfigParams        []parameterWithProfilesMap
+	ProfileParentConfigParams map[string]map[string]string
+	ServerParams              map[string]string
+	NameTopologies            map[TopologyName]tc.Topology
+	ParentServerDSes          map[int]map[int]struct{} // map[serverID][dsID]
+	ParentInfos               map[OriginHost][]parentInfo
+	DSOrigins                 map[DeliveryServiceID]map[ServerID]struct{}
+}
+
+// makeParentConfigData returns the data used to create the parentage of the given server, any warnings, and any error.
+func makeParentConfigData(
+	dses []DeliveryService,
+	server *Server,
+	servers []Server,
+	topologies []tc.Topology,
+	tcServerParams []tc.Parameter,
+	tcParentConfigParams []tc.Parameter,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	cacheGroupArr []tc.CacheGroupNullable,
+	dss []DeliveryServiceServer,
+	cdn *tc.CDN,
+) (parentConfigData, []string, error) {
+	warnings := []string{}
+
+	if server.HostName == nil || *server.HostName == "" {
+		return parentConfigData{}, warnings, errors.New("server HostName missing")
+	} else if server.CDNName == nil || *server.CDNName == "" {
+		return parentConfigData{}, warnings, errors.New("server CDNName missing")
+	} else if server.Cachegroup == nil || *server.Cachegroup == "" {
+		return parentConfigData{}, warnings, errors.New("server Cachegroup missing")
+	} else if server.Profile == nil || *server.Profile == "" {
+		return parentConfigData{}, warnings, errors.New("server Profile missing")
+	} else if server.TCPPort == nil {
+		return parentConfigData{}, warnings, errors.New("server TCPPort missing")
+	}
+
+	atsMajorVer, verWarns := getATSMajorVersion(tcServerParams)
+	warnings = append(warnings, verWarns...)
+
+	cacheGroups, err := makeCGMap(cacheGroupArr)
+	if err != nil {
+		return parentConfigData{}, warnings, errors.New("making CacheGroup map: " + err.Error())
+	}
+	serverParentCGData, err := getParentCacheGroupData(server, cacheGroups)
+	if err != nil {
+		return parentConfigData{}, warnings, errors.New("getting server parent cachegroup data: " + err.Error())
+	}
+	cacheIsTopLevel := isTopLevelCache(serverParentCGData)
+
+	parentConfigParams, profileParentConfigParams, serverParams, paramWarns := makeParentConfigParams(server, tcParentConfigParams)
+	warnings = append(warnings, paramWarns...)
+
+	parentCacheGroups := map[string]struct{}{}
+	if cacheIsTopLevel {
+		for _, cg := range cacheGroups {
+			if cg.Type == nil {
+				return parentConfigData{}, warnings, errors.New("cachegroup type is nil!")
+			}
+			if cg.Name == nil {
+				return parentConfigData{}, warnings, errors.New("cachegroup name is nil!")
+			}
+
+			if *cg.Type != tc.CacheGroupOriginTypeName {
+				continue
+			}
+			parentCacheGroups[*cg.Name] = struct{}{}
+		}
+	} else {
+		for _, cg := range cacheGroups {
+			if cg.Type == nil {
+				return parentConfigData{}, warnings, errors.New("cachegroup type is nil!")
+			}
+			if cg.Name == nil {
+				return parentConfigData{}, warnings, errors.New("cachegroup name is nil!")
+			}
+
+			if *cg.Name == *server.Cachegroup {
+				if cg.ParentName != nil && *cg.ParentName != "" {
+					parentCacheGroups[*cg.ParentName] = struct{}{}
+				}
+				if cg.SecondaryParentName != nil && *cg.SecondaryParentName != "" {
+					parentCacheGroups[*cg.SecondaryParentName] = struct{}{}
+				}
+				break
+			}
+		}
+	}
+
+	nameTopologies := makeTopologyNameMap(topologies)
+
+	cgServers := map[int]Server{} // map[serverID]server
+	for _, sv := range servers {
+		if sv.ID == nil {
+			warnings = append(warnings, "TO servers had server with missing ID, skipping!")
+			continue
+		} else if sv.CDNName == nil {
+			warnings = append(warnings, "TO servers had server with missing CDNName, skipping!")
+			continue
+		} else if sv.Cachegroup == nil || *sv.Cachegroup == "" {
+			warnings = append(warnings, "TO servers had server with missing Cachegroup, skipping!")
+			continue
+		} else if sv.Status == nil || *sv.Status == "" {
+			warnings = append(warnings, "TO servers had server with missing Status, skipping!")
+			continue
+		} else if sv.Type == "" {
+			warnings = append(warnings, "TO servers had server with missing Type, skipping!")
+			continue
+		}
+		if *sv.CDNName != *server.CDNName {
+			continue
+		}
+		if _, ok := parentCacheGroups[*sv.Cachegroup]; !ok {
+			continue
+		}
+		if sv.Type != tc.OriginTypeName &&
+			!strings.HasPrefix(sv.Type, tc.EdgeTypePrefix) &&
+			!strings.HasPrefix(sv.Type, tc.MidTypePrefix) {
+			continue
+		}
+		if *sv.Status != string(tc.CacheStatusReported) && *sv.Status != string(tc.CacheStatusOnline) {
+			continue
+		}
+		cgServers[*sv.ID] = sv
+	}
+
+	cgServerIDs := map[int]struct{}{}
+	for serverID, _ := range cgServers {
+		cgServerIDs[serverID] = struct{}{}
+	}
+	cgServerIDs[*server.ID] = struct{}{}
+
+	cgDSServers := filterDSS(dss, nil, cgServerIDs)
+	parentServerDSes := map[int]map[int]struct{}{} // map[serverID][dsID]
+	for _, dss := range cgDSServers {
+		if parentServerDSes[dss.Server] == nil {
+			parentServerDSes[dss.Server] = map[int]struct{}{}
+		}
+		parentServerDSes[dss.Server][dss.DeliveryService] = struct{}{}
+	}
+
+	originServers, profileCaches, orgProfWarns, err := getOriginServersAndProfileCaches(cgServers, parentServerDSes, profileParentConfigParams, dses, serverCapabilities)
+	warnings = append(warnings, orgProfWarns...)
+	if err != nil {
+		return parentConfigData{}, warnings, errors.New("getting origin servers and profile caches: " + err.Error())
+	}
+
+	parentInfos := makeParentInfo(serverParentCGData, cdn.DomainName, profileCaches, originServers)
+
+	dsOrigins, dsOriginWarns := makeDSOrigins(dss, dses, servers)
+	warnings = append(warnings, dsOriginWarns...)
+
+	return parentConfigData{
+		ATSMajorVer:               atsMajorVer,
+		CacheGroups:               cacheGroups,
+		ServerParentCGData:        serverParentCGData,
+		CacheIsTopLevel:           cacheIsTopLevel,
+		ParentConfigParams:        parentConfigParams,
+		ProfileParentConfigParams: profileParentConfigParams,
+		ServerParams:              serverParams,
+		NameTopologies:            nameTopologies,
+		ParentServerDSes:          parentServerDSes,
+		ParentInfos:               parentInfos,
+		DSOrigins:                 dsOrigins,
+	}, warnings, nil
+}
+
+// makeParentConfigParams returns the parent.config Parameters with their Profiles, a map of Profile names to the parent.config Parameters on them, the given server's Parameters used by parent.config lines, and any warnings.
+func makeParentConfigParams(server *Server, tcParentConfigParams []tc.Parameter) ([]parameterWithProfilesMap, map[string]map[string]string, map[string]string, []string) {
+	warnings := []string{}
+	parentConfigParamsWithProfiles, err := tcParamsToParamsWithProfiles(tcParentConfigParams)
+	if err != nil {
+		warnings = append(warnings, "error getting profiles from Traffic Ops Parameters, Parameters will not be considered for generation! : "+err.Error())
+		parentConfigParamsWithProfiles = []parameterWithProfiles{}
+	}
+	parentConfigParams := parameterWithProfilesToMap(parentConfigParamsWithProfiles)
+
+	// this is an optimization, to avoid looping over all params, for every DS. Instead, we loop over all params only once, and put them in a profile map.
+	profileParentConfigParams := map[string]map[string]string{} // map[profileName][paramName]paramVal
+	for _, param := range parentConfigParamsWithProfiles {
+		for _, profile := range param.ProfileNames {
+			if _, ok := profileParentConfigParams[profile]; !ok {
+				profileParentConfigParams[profile] = map[string]string{}
+			}
+			profileParentConfigParams[profile][param.Name] = param.Value
+		}
+	}
+
+	// We only need parent.config params, don't need all the params on the server
+	serverParams := map[string]string{}
+	if server.Profile == nil || *server.Profile != "" { // TODO warn/error if false? Servers requires profiles
+		for name, val := range profileParentConfigParams[*server.Profile] {
+			if name == ParentConfigParamQStringHandling ||
+				name == ParentConfigParamAlgorithm ||
+				name == ParentConfigParamQString {
+				serverParams[name] = val
+			}
+		}
+	}
+	return parentConfigParams, profileParentConfigParams, serverParams, warnings
+}
+
 // makeParentComment creates the parent line comment and returns it.
 // If addComments is false, returns the empty string. This exists for composability.
 // Either dsName or topology may be the empty string.
@@ -731,8 +801,138 @@ func getParentDSParams(ds DeliveryService, profileParentConfigParams map[string]
 	return params, warnings
 }
 
-// getTopologyParentConfigLine returns the topology parent.config line, any warnings, and any error
-func getTopologyParentConfigLine(
+// TopologyParent is a parent of a cache for a Topology Delivery Service.
+type TopologyParent struct {
+	// Host is the parent's FQDN, or its IP address if its Profile has the use_ip_address Parameter.
+	Host string
+	// Port is the parent's port. It may be empty if the parent is an origin with an unknown scheme and no port.
+	Port string
+	// Weight is the parent's consistent hash weight. It's empty if the parent is the Delivery Service's origin.
+	Weight string
+}
+
+// Format returns the parent in the parent.config parent list format, host:port|weight.
+func (p TopologyParent) Format() string {
+	str := p.Host
+	if p.Port != "" {
+		str = net.JoinHostPort(p.Host, p.Port)
+	}
+	if p.Weight != "" {
+		str += "|" + p.Weight
+	}
+	return str
+}
+
+// TopologyParents is the parentage of a cache for a Topology Delivery Service, from which its parent.config line is created.
+// This allows caches other than ATS to be configured with the same parents as ATS caches in the same Topology.
+type TopologyParents struct {
+	// OriginURI is the Delivery Service's origin, with its port.
+	OriginURI *url.URL
+	// Parents is the primary parents. If IsLastTier, this is the origin.
+	Parents []TopologyParent
+	// SecondaryParents is the secondary parents, which are requested if the primary parents fail.
+	// Secondary parents which are not_a_parent are included with an empty Host, as parent.config has always listed them, and should be skipped by other caches.
+	SecondaryParents []TopologyParent
+	// TryAllPrimariesBeforeSecondary is whether every primary parent should be tried before any secondary parent.
+	TryAllPrimariesBeforeSecondary bool
+	// RoundRobin is the parent selection algorithm, as in the parent.config round_robin directive, e.g. consistent_hash.
+	RoundRobin string
+	// GoDirect is whether the origin may be requested directly.
+	GoDirect bool
+	// QueryString is whether the query string is used in parent selection, "consider" or "ignore".
+	QueryString string
+	// IsLastCacheTier is whether the cache is the last cache tier, whose parents are origins rather than proxies.
+	IsLastCacheTier bool
+	// IsLastTier is whether the cache's parent is the Delivery Service origin itself.
+	IsLastTier bool
+	// ParentRetry is the parent.config parent_retry, which is "simple", "unavailable_server_retry", "both", or empty for no retries on parent responses.
+	// The retry fields only apply to the last cache tier, and are empty otherwise.
+	ParentRetry                     string
+	UnavailableServerRetryResponses string
+	MaxSimpleRetries                string
+	MaxUnavailableServerRetries     string
+}
+
+// MakeTopologyParents returns the parentage of the given server for each of the given Topology Delivery Services it's in, keyed by XMLID, and any warnings.
+// This is the same parentage MakeParentDotConfig uses to create the Delivery Services' parent.config lines.
+// Delivery Services without a Topology, or whose Topology the server isn't in or lacks the Required Capabilities of, aren't included.
+func MakeTopologyParents(
+	dses []DeliveryService,
+	server *Server,
+	servers []Server,
+	topologies []tc.Topology,
+	tcParentConfigParams []tc.Parameter,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	cacheGroupArr []tc.CacheGroupNullable,
+	dss []DeliveryServiceServer,
+) (map[tc.DeliveryServiceName]TopologyParents, []string, error) {
+	warnings := []string{}
+
+	if server.ID == nil {
+		return nil, warnings, errors.New("server ID missing")
+	} else if server.HostName == nil || *server.HostName == "" {
+		return nil, warnings, errors.New("server HostName missing")
+	} else if server.CDNName == nil || *server.CDNName == "" {
+		return nil, warnings, errors.New("server CDNName missing")
+	} else if server.Cachegroup == nil || *server.Cachegroup == "" {
+		return nil, warnings, errors.New("server Cachegroup missing")
+	} else if server.Profile == nil || *server.Profile == "" {
+		return nil, warnings, errors.New("server Profile missing")
+	}
+
+	cacheGroups, err := makeCGMap(cacheGroupArr)
+	if err != nil {
+		return nil, warnings, errors.New("making CacheGroup map: " + err.Error())
+	}
+
+	parentConfigParams, profileParentConfigParams, serverParams, paramWarns := makeParentConfigParams(server, tcParentConfigParams)
+	warnings = append(warnings, paramWarns...)
+
+	nameTopologies := makeTopologyNameMap(topologies)
+	dsOrigins, dsOriginWarns := makeDSOrigins(dss, dses, servers)
+	warnings = append(warnings, dsOriginWarns...)
+
+	dsParents := map[tc.DeliveryServiceName]TopologyParents{}
+	for _, ds := range dses {
+		if ds.Topology == nil || *ds.Topology == "" {
+			continue
+		}
+		if ds.XMLID == nil || *ds.XMLID == "" {
+			warnings = append(warnings, "got ds with missing XMLID, skipping!")
+			continue
+		} else if ds.ID == nil {
+			warnings = append(warnings, "got ds with missing ID, skipping!")
+			continue
+		} else if ds.Type == nil {
+			warnings = append(warnings, "got ds with missing Type, skipping!")
+			continue
+		} else if ds.OrgServerFQDN == nil || *ds.OrgServerFQDN == "" {
+			warnings = append(warnings, "DS '"+*ds.XMLID+"' has no origin server! Skipping!")
+			continue
+		}
+		if !ds.Type.IsHTTP() && !ds.Type.IsDNS() {
+			continue // skip ANY_MAP, STEERING, etc
+		}
+
+		dsParams, dsParamsWarnings := getParentDSParams(ds, profileParentConfigParams)
+		warnings = append(warnings, dsParamsWarnings...)
+
+		parents, inTopology, topoWarnings, err := makeTopologyParents(server, servers, &ds, serverParams, parentConfigParams, nameTopologies, serverCapabilities, dsRequiredCapabilities, cacheGroups, dsParams, dsOrigins[DeliveryServiceID(*ds.ID)])
+		warnings = append(warnings, topoWarnings...)
+		if err != nil {
+			warnings = append(warnings, err.Error()) // we don't want to fail generation with an error if one ds is malformed
+			continue
+		}
+		if inTopology {
+			dsParents[tc.DeliveryServiceName(*ds.XMLID)] = parents
+		}
+	}
+	return dsParents, warnings, nil
+}
+
+// makeTopologyParents returns the parentage of the server for the Topology Delivery Service, whether the server is in the Topology and has its Required Capabilities, any warnings, and any error.
+func makeTopologyParents(
 	server *Server,
 	servers []Server,
 	ds *DeliveryService,
@@ -743,67 +943,118 @@ func getTopologyParentConfigLine(
 	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
 	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
 	dsParams parentDSParams,
-	atsMajorVer int,
 	dsOrigins map[ServerID]struct{},
-	addComments bool,
-) (string, []string, error) {
+) (TopologyParents, bool, []string, error) {
 	warnings := []string{}
-	txt := ""
 
 	if !hasRequiredCapabilities(serverCapabilities[*server.ID], dsRequiredCapabilities[*ds.ID]) {
-		return "", warnings, nil
+		return TopologyParents{}, false, warnings, nil
 	}
 
 	orgURI, orgWarns, err := getOriginURI(*ds.OrgServerFQDN)
 	warnings = append(warnings, orgWarns...)
 	if err != nil {
-		return "", warnings, errors.New("DS '" + *ds.XMLID + "' has malformed origin URI: '" + *ds.OrgServerFQDN + "': skipping!" + err.Error())
+		return TopologyParents{}, false, warnings, errors.New("DS '" + *ds.XMLID + "' has malformed origin URI: '" + *ds.OrgServerFQDN + "': skipping!" + err.Error())
 	}
 
 	topology := nameTopologies[TopologyName(*ds.Topology)]
 	if topology.Name == "" {
-		return "", warnings, errors.New("DS " + *ds.XMLID + " topology '" + *ds.Topology + "' not found in Topologies!")
+		return TopologyParents{}, false, warnings, errors.New("DS " + *ds.XMLID + " topology '" + *ds.Topology + "' not found in Topologies!")
 	}
 
-	txt += makeParentComment(addComments, *ds.XMLID, *ds.Topology)
-	txt += "dest_domain=" + orgURI.Hostname() + " port=" + orgURI.Port()
-
 	serverPlacement, err := getTopologyPlacement(tc.CacheGroupName(*server.Cachegroup), topology, cacheGroups, ds)
 	if err != nil {
-		return "", warnings, errors.New("getting topology placement: " + err.Error())
+		return TopologyParents{}, false, warnings, errors.New("getting topology placement: " + err.Error())
 	}
 	if !serverPlacement.InTopology {
-		return "", warnings, nil // server isn't in topology, no error
+		return TopologyParents{}, false, warnings, nil // server isn't in topology, no error
 	}
-	// TODO add Topology/Capabilities to remap.config
 
 	parents, secondaryParents, parentWarnings, err := getTopologyParents(server, ds, servers, parentConfigParams, topology, serverPlacement.IsLastTier, serverCapabilities, dsRequiredCapabilities, dsOrigins)
 	warnings = append(warnings, parentWarnings...)
 	if err != nil {
-		return "", warnings, errors.New("getting topology parents for '" + *ds.XMLID + "': skipping! " + err.Error())
+		return TopologyParents{}, false, warnings, errors.New("getting topology parents for '" + *ds.XMLID + "': skipping! " + err.Error())
 	}
 	if len(parents) == 0 {
-		return "", warnings, errors.New("getting topology parents for '" + *ds.XMLID + "': no parents found! skipping! (Does your Topology have a CacheGroup with no servers in it?)")
+		return TopologyParents{}, false, warnings, errors.New("getting topology parents for '" + *ds.XMLID + "': no parents found! skipping! (Does your Topology have a CacheGroup with no servers in it?)")
 	}
 
-	txt += ` parent="` + strings.Join(parents, `;`) + `"`
-	if len(secondaryParents) > 0 {
-		txt += ` secondary_parent="` + strings.Join(secondaryParents, `;`) + `"`
+	topoParents := TopologyParents{
+		OriginURI:                      orgURI,
+		Parents:                        parents,
+		SecondaryParents:               secondaryParents,
+		TryAllPrimariesBeforeSecondary: dsParams.TryAllPrimariesBeforeSecondary,
+		RoundRobin:                     getTopologyRoundRobin(ds, serverParams, serverPlacement.IsLastCacheTier, dsParams.Algorithm),
+		GoDirect:                       getTopologyGoDirect(ds, serverPlacement.IsLastTier) == "true",
+		QueryString:                    getTopologyQueryString(ds, serverParams, serverPlacement.IsLastCacheTier, dsParams.Algorithm, dsParams.QueryStringHandling),
+		IsLastCacheTier:                serverPlacement.IsLastCacheTier,
+		IsLastTier:                     serverPlacement.IsLastTier,
+	}
+	if serverPlacement.IsLastCacheTier && dsParams.ParentRetry != "" {
+		topoParents.ParentRetry = dsParams.ParentRetry
+		topoParents.UnavailableServerRetryResponses = dsParams.UnavailableServerRetryResponses
+		topoParents.MaxSimpleRetries = dsParams.MaxSimpleRetries
+		if topoParents.MaxSimpleRetries == "" {
+			topoParents.MaxSimpleRetries = ParentConfigDSParamDefaultMaxSimpleRetries
+		}
+		topoParents.MaxUnavailableServerRetries = dsParams.MaxUnavailableServerRetries
+		if topoParents.MaxUnavailableServerRetries == "" {
+			topoParents.MaxUnavailableServerRetries = ParentConfigDSParamDefaultMaxUnavailableServerRetries
+		}
+	}
+	return topoParents, true, warnings, nil
+}
+
+// getTopologyParentConfigLine returns the topology parent.config line, any warnings, and any error
+func getTopologyParentConfigLine(
+	server *Server,
+	servers []Server,
+	ds *DeliveryService,
+	serverParams map[string]string,
+	parentConfigParams []parameterWithProfilesMap, // all params with configFile parent.config
+	nameTopologies map[TopologyName]tc.Topology,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
+	dsParams parentDSParams,
+	atsMajorVer int,
+	dsOrigins map[ServerID]struct{},
+	addComments bool,
+) (string, []string, error) {
+	parents, inTopology, warnings, err := makeTopologyParents(server, servers, ds, serverParams, parentConfigParams, nameTopologies, serverCapabilities, dsRequiredCapabilities, cacheGroups, dsParams, dsOrigins)
+	if err != nil || !inTopology {
+		return "", warnings, err
+	}
 
-		secondaryModeStr, secondaryModeWarnings := getSecondaryModeStr(dsParams.TryAllPrimariesBeforeSecondary, atsMajorVer, tc.DeliveryServiceName(*ds.XMLID))
+	txt := makeParentComment(addComments, *ds.XMLID, *ds.Topology)
+	txt += "dest_domain=" + parents.OriginURI.Hostname() + " port=" + parents.OriginURI.Port()
+	txt += ` parent="` + formatTopologyParents(parents.Parents) + `"`
+	if len(parents.SecondaryParents) > 0 {
+		txt += ` secondary_parent="` + formatTopologyParents(parents.SecondaryParents) + `"`
+
+		secondaryModeStr, secondaryModeWarnings := getSecondaryModeStr(parents.TryAllPrimariesBeforeSecondary, atsMajorVer, tc.DeliveryServiceName(*ds.XMLID))
 		warnings = append(warnings, secondaryModeWarnings...)
 		txt += secondaryModeStr
 	}
-	txt += ` round_robin=` + getTopologyRoundRobin(ds, serverParams, serverPlacement.IsLastCacheTier, dsParams.Algorithm)
-	txt += ` go_direct=` + getTopologyGoDirect(ds, serverPlacement.IsLastTier)
-	txt += ` qstring=` + getTopologyQueryString(ds, serverParams, serverPlacement.IsLastCacheTier, dsParams.Algorithm, dsParams.QueryStringHandling)
-	txt += getTopologyParentIsProxyStr(serverPlacement.IsLastCacheTier)
-	txt += getParentRetryStr(serverPlacement.IsLastCacheTier, atsMajorVer, dsParams.ParentRetry, dsParams.UnavailableServerRetryResponses, dsParams.MaxSimpleRetries, dsParams.MaxUnavailableServerRetries)
+	txt += ` round_robin=` + parents.RoundRobin
+	txt += ` go_direct=` + strconv.FormatBool(parents.GoDirect)
+	txt += ` qstring=` + parents.QueryString
+	txt += getTopologyParentIsProxyStr(parents.IsLastCacheTier)
+	txt += getParentRetryStr(parents.IsLastCacheTier, atsMajorVer, parents.ParentRetry, parents.UnavailableServerRetryResponses, parents.MaxSimpleRetries, parents.MaxUnavailableServerRetries)
 	txt += "\n"
 
 	return txt, warnings, nil
 }
 
+// formatTopologyParents returns the parents in the parent.config parent list format.
+func formatTopologyParents(parents []TopologyParent) string {
+	strs := make([]string, 0, len(parents))
+	for _, parent := range parents {
+		strs = append(strs, parent.Format())
+	}
+	return strings.Join(strs, `;`)
+}
+
 // getParentRetryStr builds the parent retry directive(s).
 // If atsMajorVer < 6, "" is returned (ATS 5 and below don't support retry directives).
 // If isLastCacheTier is false, "" is returned. This argument exists to simplify usage.
@@ -948,22 +1199,23 @@ func serverParentageParams(sv *Server, params []parameterWithProfilesMap) (profi
 	return profileCache, warnings
 }
 
-func serverParentStr(sv *Server, svParams profileCache) (string, error) {
+// serverParent returns the server as a parent, whether it's a parent (false if its Profile has the not_a_parent Parameter), and any error.
+func serverParent(sv *Server, svParams profileCache) (TopologyParent, bool, error) {
 	if svParams.NotAParent {
-		return "", nil
+		return TopologyParent{}, false, nil
 	}
 	host := ""
 	if svParams.UseIP {
 		// TODO get service interface here
 		ip := getServerIPAddress(sv)
 		if ip == nil {
-			return "", errors.New("server params Use IP, but has no valid IPv4 Service Address")
+			return TopologyParent{}, false, errors.New("server params Use IP, but has no valid IPv4 Service Address")
 		}
 		host = ip.String()
 	} else {
 		host = *sv.HostName + "." + *sv.DomainName
 	}
-	return host + ":" + strconv.Itoa(svParams.Port) + "|" + svParams.Weight, nil
+	return TopologyParent{Host: host, Port: strconv.Itoa(svParams.Port), Weight: svParams.Weight}, true, nil
 }
 
 // GetTopologyParents returns the parents, secondary parents, any warnings, and any error.
@@ -977,7 +1229,7 @@ func getTopologyParents(
 	serverCapabilities map[int]map[ServerCapability]struct{},
 	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
 	dsOrigins map[ServerID]struct{}, // for Topology DSes, MSO still needs DeliveryServiceServer assignments.
-) ([]string, []string, []string, error) {
+) ([]TopologyParent, []TopologyParent, []string, error) {
 	warnings := []string{}
 	// If it's the last tier, then the parent is the origin.
 	// Note this doesn't include MSO, whose final tier cachegroup points to the origin cachegroup.
@@ -987,7 +1239,7 @@ func getTopologyParents(
 		if err != nil {
 			return nil, nil, warnings, err
 		}
-		return []string{orgURI.Host}, nil, warnings, nil
+		return []TopologyParent{{Host: orgURI.Hostname(), Port: orgURI.Port()}}, nil, warnings, nil
 	}
 
 	svNode := tc.TopologyNode{}
@@ -1024,8 +1276,8 @@ func getTopologyParents(
 		return nil, nil, warnings, errors.New("Server '" + *server.HostName + "' DS " + *ds.XMLID + " topology '" + *ds.Topology + "' cachegroup '" + *server.Cachegroup + "' topology node parent " + strconv.Itoa(svNode.Parents[0]) + " is not in the topology!")
 	}
 
-	parentStrs := []string{}
-	secondaryParentStrs := []string{}
+	parents := []TopologyParent{}
+	secondaryParents := []TopologyParent{}
 
 	serversWithParams := []serverWithParams{}
 	for _, sv := range servers {
@@ -1069,25 +1321,22 @@ func getTopologyParents(
 		if sv.Type != tc.OriginTypeName && !hasRequiredCapabilities(serverCapabilities[*sv.ID], dsRequiredCapabilities[*ds.ID]) {
 			continue
 		}
-		if *sv.Cachegroup == parentCG {
-			parentStr, err := serverParentStr(&sv.Server, sv.Params)
-			if err != nil {
-				return nil, nil, warnings, errors.New("getting server parent string: " + err.Error())
-			}
-			if parentStr != "" { // will be empty if server is not_a_parent (possibly other reasons)
-				parentStrs = append(parentStrs, parentStr)
-			}
+		if *sv.Cachegroup != parentCG && *sv.Cachegroup != secondaryParentCG {
+			continue
+		}
+		parent, isParent, err := serverParent(&sv.Server, sv.Params)
+		if err != nil {
+			return nil, nil, warnings, errors.New("getting server parent: " + err.Error())
+		}
+		if *sv.Cachegroup == parentCG && isParent { // server is not a parent if it's not_a_parent (possibly other reasons)
+			parents = append(parents, parent)
 		}
 		if *sv.Cachegroup == secondaryParentCG {
-			parentStr, err := serverParentStr(&sv.Server, sv.Params)
-			if err != nil {
-				return nil, nil, warnings, errors.New("getting server parent string: " + err.Error())
-			}
-			secondaryParentStrs = append(secondaryParentStrs, parentStr)
+			secondaryParents = append(secondaryParents, parent) // empty if server is not_a_parent, as parent.config has always had
 		}
 	}
 
-	return parentStrs, secondaryParentStrs, warnings, nil
+	return parents, secondaryParents, warnings, nil
 }
 
 // getOriginURI returns the URL, any warnings, and any error.
@@ -1118,9 +1367,20 @@ func getParentStrs(
 	atsMajorVer int,
 	tryAllPrimariesBeforeSecondary bool,
 ) (string, string, []string) {
-	warnings := []string{}
-	parentInfo := []string{}
-	secondaryParentInfo := []string{}
+	parentInfo, secondaryParentInfo := selectParents(ds, dsRequiredCapabilities, parentInfos, atsMajorVer)
+	return formatParentStrs(ds, parentInfo, secondaryParentInfo, atsMajorVer, tryAllPrimariesBeforeSecondary)
+}
+
+// selectParents returns the primary and secondary parents of the Delivery Service, from the server's parent CacheGroups.
+// If the ATS version doesn't support secondary parents, they're appended to the primary parents, and no secondary parents are returned.
+func selectParents(
+	ds *DeliveryService,
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	parentInfos []parentInfo,
+	atsMajorVer int,
+) ([]parentInfo, []parentInfo) {
+	primaryParents := []parentInfo{}
+	secondaryParents := []parentInfo{}
 
 	sort.Sort(parentInfoSortByRank(parentInfos))
 
@@ -1129,43 +1389,27 @@ func getParentStrs(
 			continue
 		}
 
-		pTxt := parent.Format()
 		if parent.PrimaryParent {
-			parentInfo = append(parentInfo, pTxt)
+			primaryParents = append(primaryParents, parent)
 		} else if parent.SecondaryParent {
-			secondaryParentInfo = append(secondaryParentInfo, pTxt)
+			secondaryParents = append(secondaryParents, parent)
 		}
 	}
 
-	if len(parentInfo) == 0 {
-		parentInfo = secondaryParentInfo
-		secondaryParentInfo = []string{}
+	if len(primaryParents) == 0 {
+		primaryParents = secondaryParents
+		secondaryParents = []parentInfo{}
 	}
 
 	// TODO remove duplicate code with top level if block
 	seen := map[string]struct{}{} // TODO change to host+port? host isn't unique
-	parentInfo, seen = util.RemoveStrDuplicates(parentInfo, seen)
-	secondaryParentInfo, seen = util.RemoveStrDuplicates(secondaryParentInfo, seen)
-
-	dsName := tc.DeliveryServiceName("")
-	if ds != nil && ds.XMLID != nil {
-		dsName = tc.DeliveryServiceName(*ds.XMLID)
-	}
-
-	parents := ""
-	secondaryParents := "" // "secparents" in Perl
+	primaryParents = removeParentDuplicates(primaryParents, seen)
+	secondaryParents = removeParentDuplicates(secondaryParents, seen)
 
-	if atsMajorVer >= 6 && len(secondaryParentInfo) > 0 {
-		parents = `parent="` + strings.Join(parentInfo, "") + `"`
-		secondaryParents = ` secondary_parent="` + strings.Join(secondaryParentInfo, "") + `"`
-		secondaryModeStr, secondaryModeWarnings := getSecondaryModeStr(tryAllPrimariesBeforeSecondary, atsMajorVer, dsName)
-		warnings = append(warnings, secondaryModeWarnings...)
-		secondaryParents += secondaryModeStr
-	} else {
-		parents = `parent="` + strings.Join(parentInfo, "") + strings.Join(secondaryParentInfo, "") + `"`
+	if atsMajorVer < 6 {
+		return append(primaryParents, secondaryParents...), []parentInfo{}
 	}
-
-	return parents, secondaryParents, warnings
+	return primaryParents, secondaryParents
 }
 
 // getMSOParentStrs returns the parents= and secondary_parents= strings for ATS parent.config lines for MSO, and any warnings.
@@ -1176,65 +1420,119 @@ func getMSOParentStrs(
 	msoAlgorithm string,
 	tryAllPrimariesBeforeSecondary bool,
 ) (string, string, []string) {
-	warnings := []string{}
-	// TODO determine why MSO is different, and if possible, combine with getParentAndSecondaryParentStrs.
+	parentInfo, secondaryParentInfo := selectMSOParents(parentInfos, atsMajorVer, msoAlgorithm)
+	return formatParentStrs(ds, parentInfo, secondaryParentInfo, atsMajorVer, tryAllPrimariesBeforeSecondary)
+}
+
+// selectMSOParents returns the primary and secondary parents of an MSO Delivery Service, from the origins in the server's parent CacheGroups.
+// Origins in neither the primary nor secondary parent CacheGroup are appended to the secondary parents.
+// If the ATS version doesn't support secondary parents, or the algorithm isn't consistent_hash, they're appended to the primary parents, and no secondary parents are returned.
+func selectMSOParents(
+	parentInfos []parentInfo,
+	atsMajorVer int,
+	msoAlgorithm string,
+) ([]parentInfo, []parentInfo) {
+	// TODO determine why MSO is different, and if possible, combine with selectParents.
 
 	rankedParents := parentInfoSortByRank(parentInfos)
 	sort.Sort(rankedParents)
 
-	parentInfoTxt := []string{}
-	secondaryParentInfo := []string{}
-	nullParentInfo := []string{}
+	primaryParents := []parentInfo{}
+	secondaryParents := []parentInfo{}
+	nullParents := []parentInfo{}
 	for _, parent := range ([]parentInfo)(rankedParents) {
 		if parent.PrimaryParent {
-			parentInfoTxt = append(parentInfoTxt, parent.Format())
+			primaryParents = append(primaryParents, parent)
 		} else if parent.SecondaryParent {
-			secondaryParentInfo = append(secondaryParentInfo, parent.Format())
+			secondaryParents = append(secondaryParents, parent)
 		} else {
-			nullParentInfo = append(nullParentInfo, parent.Format())
+			nullParents = append(nullParents, parent)
 		}
 	}
 
-	if len(parentInfoTxt) == 0 {
+	if len(primaryParents) == 0 {
 		// If no parents are found in the secondary parent either, then set the null parent list (parents in neither secondary or primary)
 		// as the secondary parent list and clear the null parent list.
-		if len(secondaryParentInfo) == 0 {
-			secondaryParentInfo = nullParentInfo
-			nullParentInfo = []string{}
+		if len(secondaryParents) == 0 {
+			secondaryParents = nullParents
+			nullParents = []parentInfo{}
 		}
-		parentInfoTxt = secondaryParentInfo
-		secondaryParentInfo = []string{} // TODO should thi be '= secondary'? Currently emulates Perl
+		primaryParents = secondaryParents
+		secondaryParents = []parentInfo{} // TODO should thi be '= secondary'? Currently emulates Perl
 	}
 
 	// TODO benchmark, verify this isn't slow. if it is, it could easily be made faster
 	seen := map[string]struct{}{} // TODO change to host+port? host isn't unique
-	parentInfoTxt, seen = util.RemoveStrDuplicates(parentInfoTxt, seen)
-	secondaryParentInfo, seen = util.RemoveStrDuplicates(secondaryParentInfo, seen)
-	nullParentInfo, seen = util.RemoveStrDuplicates(nullParentInfo, seen)
+	primaryParents = removeParentDuplicates(primaryParents, seen)
+	secondaryParents = removeParentDuplicates(secondaryParents, seen)
+	nullParents = removeParentDuplicates(nullParents, seen)
+
+	secondaryParents = append(secondaryParents, nullParents...)
+
+	// If the ats version supports it and the algorithm is consistent hash, put secondary and non-primary parents into secondary parent group.
+	// This will ensure that secondary and tertiary parents will be unused unless all hosts in the primary group are unavailable.
+	if atsMajorVer < 6 || msoAlgorithm != "consistent_hash" {
+		return append(primaryParents, secondaryParents...), []parentInfo{}
+	}
+	return primaryParents, secondaryParents
+}
 
-	secondaryParentStr := strings.Join(secondaryParentInfo, "") + strings.Join(nullParentInfo, "")
+// removeParentDuplicates returns the parents without any whose parent.config format is in seen, or duplicated in parents, and adds them to seen.
+func removeParentDuplicates(parents []parentInfo, seen map[string]struct{}) []parentInfo {
+	unique := []parentInfo{}
+	for _, parent := range parents {
+		str := parent.Format()
+		if _, ok := seen[str]; ok {
+			continue
+		}
+		seen[str] = struct{}{}
+		unique = append(unique, parent)
+	}
+	return unique
+}
+
+// formatParentStrs returns the parents= and secondary_parents= strings for ATS parent.config lines, and any warnings.
+func formatParentStrs(
+	ds *DeliveryService,
+	primaryParents []parentInfo,
+	secondaryParents []parentInfo,
+	atsMajorVer int,
+	tryAllPrimariesBeforeSecondary bool,
+) (string, string, []string) {
+	warnings := []string{}
 
 	dsName := tc.DeliveryServiceName("")
 	if ds != nil && ds.XMLID != nil {
 		dsName = tc.DeliveryServiceName(*ds.XMLID)
 	}
 
-	// If the ats version supports it and the algorithm is consistent hash, put secondary and non-primary parents into secondary parent group.
-	// This will ensure that secondary and tertiary parents will be unused unless all hosts in the primary group are unavailable.
+	parentStr := ""
+	for _, parent := range primaryParents {
+		parentStr += parent.Format()
+	}
+	parents := `parent="` + parentStr + `"`
+	if len(secondaryParents) == 0 {
+		return parents, "", warnings
+	}
 
-	parents := ""
-	secondaryParents := ""
+	secondaryParentStr := ""
+	for _, parent := range secondaryParents {
+		secondaryParentStr += parent.Format()
+	}
+	secondaryParentsTxt := ` secondary_parent="` + secondaryParentStr + `"`
+	secondaryModeStr, secondaryModeWarnings := getSecondaryModeStr(tryAllPrimariesBeforeSecondary, atsMajorVer, dsName)
+	warnings = append(warnings, secondaryModeWarnings...)
+	secondaryParentsTxt += secondaryModeStr
+	return parents, secondaryParentsTxt, warnings
+}
 
-	if atsMajorVer >= 6 && msoAlgorithm == "consistent_hash" && len(secondaryParentStr) > 0 {
-		parents = `parent="` + strings.Join(parentInfoTxt, "") + `"`
-		secondaryParents = ` secondary_parent="` + secondaryParentStr + `"`
-		secondaryModeStr, secondaryModeWarnings := getSecondaryModeStr(tryAllPrimariesBeforeSecondary, atsMajorVer, dsName)
-		warnings = append(warnings, secondaryModeWarnings...)
-		secondaryParents += secondaryModeStr
-	} else {
-		parents = `parent="` + strings.Join(parentInfoTxt, "") + secondaryParentStr + `"`
+// topologyParent returns the parent as a TopologyParent, the parent format used by strategies.yaml.
+func (p parentInfo) topologyParent() TopologyParent {
+	host := p.Host + "." + p.Domain
+	if p.UseIP {
+		host = p.IP
 	}
-	return parents, secondaryParents, warnings
+	return TopologyParent{Host: host, Port: strconv.Itoa(p.Port), Weight: p.Weight}
 }
 
 func makeParentInfo(
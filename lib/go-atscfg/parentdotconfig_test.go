@@ -2619,6 +2619,173 @@ func TestMakeParentDotConfigCommentTopology(t *testing.T) {
 	}
 }
 
+func TestMakeTopologyParents(t *testing.T) {
+	ds0 := makeParentDS()
+	ds0.XMLID = util.StrPtr("ds0")
+	ds0.OrgServerFQDN = util.StrPtr("http://ds0.example.net")
+	ds0.Topology = util.StrPtr("t0")
+	ds0.ProfileID = util.IntPtr(311)
+	ds0.ProfileName = util.StrPtr("ds0Profile")
+
+	ds1 := makeParentDS()
+	ds1.ID = util.IntPtr(43)
+	ds1.OrgServerFQDN = util.StrPtr("http://ds1.example.net")
+
+	dses := []DeliveryService{*ds0, *ds1}
+
+	parentConfigParams := []tc.Parameter{
+		tc.Parameter{
+			Name:       ParentConfigParamSecondaryMode,
+			ConfigFile: "parent.config",
+			Value:      "",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamParentRetry,
+			ConfigFile: "parent.config",
+			Value:      "simple",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamMaxSimpleRetries,
+			ConfigFile: "parent.config",
+			Value:      "3",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigCacheParamWeight,
+			ConfigFile: "parent.config",
+			Value:      "0.5",
+			Profiles:   []byte(`["serverprofile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigCacheParamNotAParent,
+			ConfigFile: "parent.config",
+			Value:      "true",
+			Profiles:   []byte(`["notAParentProfile"]`),
+		},
+	}
+
+	server := makeTestParentServer()
+	server.Cachegroup = util.StrPtr("edgeCG")
+	server.CachegroupID = util.IntPtr(400)
+
+	mid0 := makeTestParentServer()
+	mid0.Cachegroup = util.StrPtr("midCG")
+	mid0.CachegroupID = util.IntPtr(500)
+	mid0.HostName = util.StrPtr("mymid")
+	mid0.ID = util.IntPtr(45)
+	mid0.Type = tc.MidTypePrefix
+	setIP(mid0, "192.168.2.2")
+
+	mid1 := makeTestParentServer()
+	mid1.Cachegroup = util.StrPtr("midCG2")
+	mid1.CachegroupID = util.IntPtr(501)
+	mid1.HostName = util.StrPtr("mymid1")
+	mid1.ID = util.IntPtr(46)
+	mid1.Type = tc.MidTypePrefix
+	setIP(mid1, "192.168.2.3")
+
+	mid2 := makeTestParentServer()
+	mid2.Cachegroup = util.StrPtr("midCG2")
+	mid2.CachegroupID = util.IntPtr(501)
+	mid2.HostName = util.StrPtr("mymid2")
+	mid2.ID = util.IntPtr(47)
+	mid2.Type = tc.MidTypePrefix
+	mid2.Profile = util.StrPtr("notAParentProfile")
+	setIP(mid2, "192.168.2.4")
+
+	servers := []Server{*server, *mid0, *mid1, *mid2}
+
+	topologies := []tc.Topology{
+		tc.Topology{
+			Name: "t0",
+			Nodes: []tc.TopologyNode{
+				tc.TopologyNode{
+					Cachegroup: "edgeCG",
+					Parents:    []int{1, 2},
+				},
+				tc.TopologyNode{
+					Cachegroup: "midCG",
+				},
+				tc.TopologyNode{
+					Cachegroup: "midCG2",
+				},
+			},
+		},
+	}
+
+	serverCapabilities := map[int]map[ServerCapability]struct{}{}
+	dsRequiredCapabilities := map[int]map[ServerCapability]struct{}{}
+
+	eCG := &tc.CacheGroupNullable{}
+	eCG.Name = server.Cachegroup
+	eCG.ID = server.CachegroupID
+	eCGType := tc.CacheGroupEdgeTypeName
+	eCG.Type = &eCGType
+
+	mCG := &tc.CacheGroupNullable{}
+	mCG.Name = mid0.Cachegroup
+	mCG.ID = mid0.CachegroupID
+	mCGType := tc.CacheGroupMidTypeName
+	mCG.Type = &mCGType
+
+	mCG2 := &tc.CacheGroupNullable{}
+	mCG2.Name = mid1.Cachegroup
+	mCG2.ID = mid1.CachegroupID
+	mCGType2 := tc.CacheGroupMidTypeName
+	mCG2.Type = &mCGType2
+
+	cgs := []tc.CacheGroupNullable{*eCG, *mCG, *mCG2}
+
+	dss := []DeliveryServiceServer{}
+
+	edgeParents, _, err := MakeTopologyParents(dses, server, servers, topologies, parentConfigParams, serverCapabilities, dsRequiredCapabilities, cgs, dss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edgeParents) != 1 {
+		t.Fatalf("expected parents for only the topology DS, actual: %+v", edgeParents)
+	}
+	parents, ok := edgeParents["ds0"]
+	if !ok {
+		t.Fatalf("expected parents for topology DS 'ds0', actual: %+v", edgeParents)
+	}
+	if len(parents.Parents) != 1 || parents.Parents[0].Format() != "mymid.mydomain.example.net:80|0.5" {
+		t.Errorf("expected parent 'mymid.mydomain.example.net:80|0.5', actual: %+v", parents.Parents)
+	}
+	if len(parents.SecondaryParents) != 2 || parents.SecondaryParents[0].Format() != "mymid1.mydomain.example.net:80|0.5" || parents.SecondaryParents[1].Format() != "" {
+		t.Errorf("expected secondary parent 'mymid1.mydomain.example.net:80|0.5' and empty not_a_parent secondary parent, actual: %+v", parents.SecondaryParents)
+	}
+	if !parents.TryAllPrimariesBeforeSecondary {
+		t.Errorf("expected try all primaries before secondary from DS secondary mode param, actual: false")
+	}
+	if parents.IsLastCacheTier || parents.IsLastTier {
+		t.Errorf("expected edge with mid parents not to be the last tier, actual: %+v", parents)
+	}
+	if parents.ParentRetry != "" {
+		t.Errorf("expected no parent retry for non-last cache tier, actual: '%v'", parents.ParentRetry)
+	}
+
+	midParents, _, err := MakeTopologyParents(dses, mid0, servers, topologies, parentConfigParams, serverCapabilities, dsRequiredCapabilities, cgs, dss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents, ok = midParents["ds0"]
+	if !ok {
+		t.Fatalf("expected parents for topology DS 'ds0', actual: %+v", midParents)
+	}
+	if !parents.IsLastCacheTier || !parents.IsLastTier {
+		t.Errorf("expected mid with no parents to be the last tier, actual: %+v", parents)
+	}
+	if len(parents.Parents) != 1 || parents.Parents[0].Format() != "ds0.example.net:80" {
+		t.Errorf("expected origin parent 'ds0.example.net:80', actual: %+v", parents.Parents)
+	}
+	if parents.ParentRetry != "simple" || parents.MaxSimpleRetries != "3" {
+		t.Errorf("expected parent retry 'simple' max simple retries '3' from DS params, actual: '%v' '%v'", parents.ParentRetry, parents.MaxSimpleRetries)
+	}
+}
+
 func makeTestParentServer() *Server {
 	server := &Server{}
 	server.ProfileID = util.IntPtr(42)
@@ -87,13 +87,17 @@ func MakeRemapDotConfig(
 
 	nameTopologies := makeTopologyNameMap(topologies)
 
+	useStrategies, cacheIsTopLevel, strategyWarns := getRemapStrategyData(server, serverParams, cacheGroups)
+	warnings = append(warnings, strategyWarns...)
+	serverDSes := makeServerDSes(dss, *server.ID)
+
 	hdr := makeHdrComment(hdrComment)
 	txt := ""
 	typeWarns := []string{}
 	if tc.CacheTypeFromString(server.Type) == tc.CacheTypeMid {
-		txt, typeWarns, err = getServerConfigRemapDotConfigForMid(atsMajorVersion, dsProfilesCacheKeyConfigParams, dses, dsRegexes, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities)
+		txt, typeWarns, err = getServerConfigRemapDotConfigForMid(atsMajorVersion, dsProfilesCacheKeyConfigParams, dses, dsRegexes, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities, useStrategies, cacheIsTopLevel, serverDSes)
 	} else {
-		txt, typeWarns, err = getServerConfigRemapDotConfigForEdge(cacheURLConfigParams, dsProfilesCacheKeyConfigParams, serverPackageParamData, dses, dsRegexes, atsMajorVersion, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities, cdnDomain)
+		txt, typeWarns, err = getServerConfigRemapDotConfigForEdge(cacheURLConfigParams, dsProfilesCacheKeyConfigParams, serverPackageParamData, dses, dsRegexes, atsMajorVersion, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities, cdnDomain, useStrategies, cacheIsTopLevel, serverDSes)
 	}
 	warnings = append(warnings, typeWarns...)
 	if err != nil {
@@ -108,6 +112,24 @@ func MakeRemapDotConfig(
 	}, nil
 }
 
+// getRemapStrategyData returns whether the server's remap rules use strategies.yaml strategies, whether the server is a top-level cache, and any warnings.
+func getRemapStrategyData(server *Server, serverParams []tc.Parameter, cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable) (bool, bool, []string) {
+	warnings := []string{}
+	useStrategies := false
+	for _, param := range filterParams(serverParams, ParentConfigFileName, ParentConfigParamUseStrategies, "", "") {
+		useStrategies = strings.TrimSpace(param.Value) == "true"
+	}
+	if !useStrategies {
+		return false, false, warnings
+	}
+	serverParentCGData, err := getParentCacheGroupData(server, cacheGroups)
+	if err != nil {
+		warnings = append(warnings, "getting server parent cachegroup data, not using strategies! : "+err.Error())
+		return false, false, warnings
+	}
+	return true, isTopLevelCache(serverParentCGData), warnings
+}
+
 // getServerConfigRemapDotConfigForMid returns the remap lines, any warnings, and any error.
 func getServerConfigRemapDotConfigForMid(
 	atsMajorVersion int,
@@ -120,6 +142,9 @@ func getServerConfigRemapDotConfigForMid(
 	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
 	serverCapabilities map[int]map[ServerCapability]struct{},
 	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	useStrategies bool,
+	cacheIsTopLevel bool,
+	serverDSes map[int]struct{},
 ) (string, []string, error) {
 	warnings := []string{}
 	midRemaps := map[string]string{}
@@ -158,6 +183,10 @@ func getServerConfigRemapDotConfigForMid(
 
 		midRemap := ""
 
+		if useStrategies && dsUsesStrategy(&ds, cacheIsTopLevel, serverDSes) {
+			midRemap += ` @strategy=` + StrategyName(*ds.XMLID)
+		}
+
 		if *ds.Topology != "" {
 			topoTxt, err := makeDSTopologyHeaderRewriteTxt(ds, tc.CacheGroupName(*server.Cachegroup), topology, cacheGroups)
 			if err != nil {
@@ -228,6 +257,9 @@ func getServerConfigRemapDotConfigForEdge(
 	serverCapabilities map[int]map[ServerCapability]struct{},
 	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
 	cdnDomain string,
+	useStrategies bool,
+	cacheIsTopLevel bool,
+	serverDSes map[int]struct{},
 ) (string, []string, error) {
 	warnings := []string{}
 	textLines := []string{}
@@ -264,6 +296,8 @@ func getServerConfigRemapDotConfigForEdge(
 			continue
 		}
 
+		useStrategy := useStrategies && dsUsesStrategy(&ds, cacheIsTopLevel, serverDSes)
+
 		for _, requestFQDN := range requestFQDNs {
 			remapLines, err := makeEdgeDSDataRemapLines(ds, requestFQDN, server, cdnDomain)
 			if err != nil {
@@ -277,7 +311,7 @@ func getServerConfigRemapDotConfigForEdge(
 					profilecacheKeyConfigParams = profilesCacheKeyConfigParams[*ds.ProfileID]
 				}
 				remapWarns := []string{}
-				remapText, remapWarns, err = buildEdgeRemapLine(cacheURLConfigParams, atsMajorVersion, server, serverPackageParamData, remapText, ds, line.From, line.To, profilecacheKeyConfigParams, cacheGroups, nameTopologies)
+				remapText, remapWarns, err = buildEdgeRemapLine(cacheURLConfigParams, atsMajorVersion, server, serverPackageParamData, remapText, ds, line.From, line.To, profilecacheKeyConfigParams, cacheGroups, nameTopologies, useStrategy)
 				warnings = append(warnings, remapWarns...)
 				if err != nil {
 					return "", warnings, err
@@ -312,11 +346,16 @@ func buildEdgeRemapLine(
 	cacheKeyConfigParams map[string]string,
 	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
 	nameTopologies map[TopologyName]tc.Topology,
+	useStrategy bool,
 ) (string, []string, error) {
 	warnings := []string{}
 	// ds = 'remap' in perl
 	mapFrom = strings.Replace(mapFrom, `__http__`, *server.HostName, -1)
 
+	if useStrategy {
+		mapTo += ` @strategy=` + StrategyName(*ds.XMLID)
+	}
+
 	if _, hasDSCPRemap := pData["dscp_remap"]; hasDSCPRemap {
 		text += "map	" + mapFrom + "     " + mapTo + ` @plugin=dscp_remap.so @pparam=` + strconv.Itoa(*ds.DSCP)
 	} else {
@@ -8299,3 +8299,112 @@ func TestMakeRemapDotConfigMidNoNoCacheRemapLine(t *testing.T) {
 		t.Errorf("expected remap line for HTTP_NO_CACHE to not exist on Mid server, regardless of Mid Header Rewrite, actual '%v'", txt)
 	}
 }
+
+func TestMakeRemapDotConfigStrategies(t *testing.T) {
+	hdr := "myHeaderComment"
+
+	makeDS := func(id int, xmlID string, dsType tc.DSType) DeliveryService {
+		ds := DeliveryService{}
+		ds.ID = util.IntPtr(id)
+		ds.Type = &dsType
+		ds.OrgServerFQDN = util.StrPtr("http://" + xmlID + ".example.test")
+		ds.RangeRequestHandling = util.IntPtr(0)
+		ds.XMLID = util.StrPtr(xmlID)
+		ds.QStringIgnore = util.IntPtr(0)
+		ds.FQPacingRate = util.IntPtr(0)
+		ds.DSCP = util.IntPtr(0)
+		ds.RoutingName = util.StrPtr("myroutingname")
+		ds.MultiSiteOrigin = util.BoolPtr(false)
+		ds.Protocol = util.IntPtr(0)
+		ds.AnonymousBlockingEnabled = util.BoolPtr(false)
+		ds.Active = util.BoolPtr(true)
+		return ds
+	}
+	dses := []DeliveryService{
+		makeDS(48, "ds-parents", tc.DSTypeHTTP),
+		makeDS(49, "ds-live", tc.DSTypeHTTPLive),
+	}
+
+	dsRegexes := []tc.DeliveryServiceRegexes{}
+	dss := []DeliveryServiceServer{}
+	for _, ds := range dses {
+		dsRegexes = append(dsRegexes, tc.DeliveryServiceRegexes{
+			DSName:  *ds.XMLID,
+			Regexes: []tc.DeliveryServiceRegex{{Type: string(tc.DSMatchTypeHostRegex), Pattern: `.*\.` + *ds.XMLID + `\..*`}},
+		})
+		dss = append(dss, DeliveryServiceServer{Server: 44, DeliveryService: *ds.ID})
+	}
+
+	paramsWithStrategies := func(useStrategies string) []tc.Parameter {
+		return []tc.Parameter{
+			tc.Parameter{
+				Name:       "trafficserver",
+				ConfigFile: "package",
+				Value:      "9",
+				Profiles:   []byte(`["global"]`),
+			},
+			tc.Parameter{
+				Name:       ParentConfigParamUseStrategies,
+				ConfigFile: ParentConfigFileName,
+				Value:      useStrategies,
+				Profiles:   []byte(`["MyProfile"]`),
+			},
+		}
+	}
+
+	midCGType := tc.CacheGroupMidTypeName
+	midCG := tc.CacheGroupNullable{Name: util.StrPtr("midCG"), ID: util.IntPtr(401), Type: &midCGType}
+	edgeCGType := tc.CacheGroupEdgeTypeName
+	edgeCG := tc.CacheGroupNullable{Name: util.StrPtr("cg0"), ID: util.IntPtr(400), Type: &edgeCGType, ParentName: midCG.Name, ParentCachegroupID: midCG.ID}
+	cgs := []tc.CacheGroupNullable{edgeCG, midCG}
+
+	cdn := &tc.CDN{DomainName: "cdndomain.example", Name: "my-cdn-name"}
+
+	remapLines := func(server *Server, serverParams []tc.Parameter) []string {
+		cfg, err := MakeRemapDotConfig(server, dses, dss, dsRegexes, serverParams, cdn, nil, nil, cgs, nil, nil, hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txt := strings.TrimSpace(cfg.Text)
+		testComment(t, txt, hdr)
+		return strings.Split(txt, "\n")[1:]
+	}
+
+	edge := makeTestRemapServer()
+	edge.Type = "EDGE"
+	edgeLines := remapLines(edge, paramsWithStrategies("true"))
+	if len(edgeLines) != 2 {
+		t.Fatalf("expected a remap line for each DS, actual '%v'", edgeLines)
+	}
+	for _, line := range edgeLines {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			t.Fatalf("expected remap line with plugins, actual '%v'", line)
+		}
+		if strings.Contains(line, "ds-parents") {
+			if fields[3] != "@strategy="+StrategyName("ds-parents") {
+				t.Errorf("expected edge remap to use strategy '%v' after the map to URL, actual '%v'", StrategyName("ds-parents"), line)
+			}
+		} else if strings.Contains(line, "@strategy") {
+			t.Errorf("expected edge remap of live local DS to not use a strategy, actual '%v'", line)
+		}
+	}
+
+	for _, line := range remapLines(edge, paramsWithStrategies("false")) {
+		if strings.Contains(line, "@strategy") {
+			t.Errorf("expected no strategies without the %v Parameter, actual '%v'", ParentConfigParamUseStrategies, line)
+		}
+	}
+
+	mid := makeTestRemapServer()
+	mid.Cachegroup = midCG.Name
+	if lines := remapLines(mid, paramsWithStrategies("true")); len(lines) != 0 {
+		t.Errorf("expected top-level mid to have no remap line for a non-MSO DS without plugins, actual '%v'", lines)
+	}
+
+	dses[0].MultiSiteOrigin = util.BoolPtr(true)
+	lines := remapLines(mid, paramsWithStrategies("true"))
+	if len(lines) != 1 || lines[0] != "map http://ds-parents.example.test http://ds-parents.example.test @strategy="+StrategyName("ds-parents") {
+		t.Errorf("expected top-level mid remap of MSO DS to use a strategy, actual '%v'", lines)
+	}
+}
@@ -0,0 +1,468 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+const StrategiesYAMLFileName = "strategies.yaml"
+const ContentTypeStrategiesDotYAML = "application/yaml; charset=us-ascii" // Note YAML has no IANA standard mime type. This is one of several common usages, and is likely to be the standardized value. If you're reading this, please check IANA to see if YAML has been added, and change this to the IANA definition if so. Also note we include 'charset=us-ascii' because YAML is commonly UTF-8, but ATS is likely to be unable to handle UTF.
+const LineCommentStrategiesDotYAML = LineCommentHash
+
+// ParentConfigParamUseStrategies is the server Profile Parameter which makes remap.config use the strategies.yaml strategy of each Delivery Service, rather than parent.config.
+// Its config file is parent.config, and strategies are used if its value is "true".
+const ParentConfigParamUseStrategies = "use_strategies"
+
+const StrategyNamePrefix = "strategy-"
+
+const StrategyPolicyConsistentHash = "consistent_hash"
+const StrategyPolicyFirstLive = "first_live"
+const StrategyPolicyRoundRobinIP = "rr_ip"
+const StrategyPolicyRoundRobinStrict = "rr_strict"
+const StrategyPolicyLatched = "latched"
+
+const StrategyRingModeAlternate = "alternate_ring"
+const StrategyRingModeExhaust = "exhaust_ring"
+
+// StrategyDefaultSimpleRetryResponse is the response code retried by parent.config simple retries, which strategies.yaml requires to be explicit.
+const StrategyDefaultSimpleRetryResponse = 404
+
+// StrategyDefaultUnavailableServerRetryResponse is the response code retried by parent.config unavailable server retries, if the Delivery Service has no unavailable_server_retry_responses Parameter.
+const StrategyDefaultUnavailableServerRetryResponse = 503
+
+// StrategiesYAMLOpts contains settings to configure strategies.yaml generation options.
+type StrategiesYAMLOpts struct {
+	// AddComments is whether to add informative comments to the generated file, about what was generated and why.
+	// Note this does not include the header comment, which is configured separately with HdrComment.
+	// These comments are human-readable and not guarnateed to be consistent between versions. Automating anything based on them is strongly discouraged.
+	AddComments bool
+
+	// HdrComment is the header comment to include at the beginning of the file.
+	// This should be the text desired, without comment syntax (like # or //). The file's comment syntax will be added.
+	// To omit the header comment, pass the empty string.
+	HdrComment string
+}
+
+// StrategyName returns the name of the strategies.yaml strategy of the given Delivery Service, used by its remap.config rules.
+func StrategyName(dsName string) string {
+	return StrategyNamePrefix + dsName
+}
+
+// MakeStrategiesDotYAML creates the strategies.yaml ATS 9+ config file, with a strategy for each Delivery Service whose remap rule on the server has parents.
+// The strategies have the same parents, secondary parents, parent selection, query string handling, go-direct, and retries as the Delivery Services' parent.config lines.
+// Delivery Services whose parent.config line only goes directly to the origin have no strategy. The parent.config default destination has no equivalent, and isn't included.
+// Delivery Services whose parentage can't be created get a strategy which goes directly to the origin, because remap.config still references it.
+// Remap rules only use the strategies if the server Profile has the ParentConfigParamUseStrategies Parameter.
+func MakeStrategiesDotYAML(
+	dses []DeliveryService,
+	server *Server,
+	servers []Server,
+	topologies []tc.Topology,
+	tcServerParams []tc.Parameter,
+	tcParentConfigParams []tc.Parameter,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	cacheGroupArr []tc.CacheGroupNullable,
+	dss []DeliveryServiceServer,
+	cdn *tc.CDN,
+	opt StrategiesYAMLOpts,
+) (Cfg, error) {
+	warnings := []string{}
+
+	data, dataWarns, err := makeParentConfigData(dses, server, servers, topologies, tcServerParams, tcParentConfigParams, serverCapabilities, cacheGroupArr, dss, cdn)
+	warnings = append(warnings, dataWarns...)
+	if err != nil {
+		return Cfg{}, makeErr(warnings, err.Error())
+	}
+	if data.ATSMajorVer < 9 {
+		warnings = append(warnings, "strategies.yaml is only supported by ATS 9 and later, but this cache is "+strconv.Itoa(data.ATSMajorVer)+"! Generating anyway!")
+	}
+
+	sort.Sort(dsesSortByName(dses))
+
+	txt := ""
+	if opt.HdrComment != "" {
+		txt += makeHdrComment(opt.HdrComment)
+	}
+	txt += "strategies:\n"
+
+	originStrategies := map[string]strategy{} // map[originFQDN]strategy
+	for _, ds := range dses {
+		if ds.XMLID == nil || *ds.XMLID == "" {
+			warnings = append(warnings, "got ds with missing XMLID, skipping!")
+			continue
+		} else if ds.ID == nil {
+			warnings = append(warnings, "got ds with missing ID, skipping!")
+			continue
+		} else if ds.Type == nil {
+			warnings = append(warnings, "got ds with missing Type, skipping!")
+			continue
+		}
+		if !dsUsesStrategy(&ds, data.CacheIsTopLevel, data.ParentServerDSes[*server.ID]) {
+			continue
+		}
+
+		// Like parent.config, which has a single line per origin, DSes sharing an origin use the parentage of the first.
+		st, ok := originStrategies[*ds.OrgServerFQDN]
+		if ok {
+			warnings = append(warnings, "duplicate origin! DS '"+*ds.XMLID+"' and '"+string(st.DS)+"' share origin '"+*ds.OrgServerFQDN+"': using the parents of '"+string(st.DS)+"'!")
+		} else {
+			stOK := false
+			stWarns := []string{}
+			st, stOK, stWarns, err = makeDSStrategy(server, servers, &ds, data, serverCapabilities, dsRequiredCapabilities)
+			warnings = append(warnings, stWarns...)
+			if err != nil {
+				// we don't want to fail generation with an error if one ds is malformed, but remap.config references its strategy
+				warnings = append(warnings, err.Error()+" Its strategy will go directly to the origin!")
+				st = makeDirectStrategy(&ds)
+			} else if !stOK {
+				continue // will be false with no error if this server isn't in the Topology, or if it doesn't have the Required Capabilities, in which case remap.config has no rule
+			} else {
+				originStrategies[*ds.OrgServerFQDN] = st
+			}
+		}
+
+		topology := ""
+		if ds.Topology != nil {
+			topology = *ds.Topology
+		}
+		txt += makeParentComment(opt.AddComments, *ds.XMLID, topology)
+		txt += st.YAML(StrategyName(*ds.XMLID))
+	}
+
+	return Cfg{
+		Text:        txt,
+		ContentType: ContentTypeStrategiesDotYAML,
+		LineComment: LineCommentStrategiesDotYAML,
+		Warnings:    warnings,
+	}, nil
+}
+
+// dsUsesStrategy returns whether the Delivery Service's remap rule on the server uses a strategy, which is whether its parent.config line has parents.
+// Both remap.config and strategies.yaml use this, so every strategy remap.config references is in strategies.yaml.
+// Topology Delivery Services always have parents. Otherwise, caches which aren't top-level only have parents for Delivery Services assigned to them, in serverDSes, the IDs of the Delivery Services assigned to the server.
+// The last cache tier only has parents for MSO, and other tiers have parents unless the Delivery Service type goes directly to the origin.
+// Note this doesn't check whether the server is in the Delivery Service's Topology, or has its Required Capabilities; remap.config has no rule if it isn't, or doesn't.
+func dsUsesStrategy(ds *DeliveryService, cacheIsTopLevel bool, serverDSes map[int]struct{}) bool {
+	if ds.ID == nil || ds.Type == nil || (!ds.Type.IsHTTP() && !ds.Type.IsDNS()) {
+		return false // skip ANY_MAP, STEERING, etc
+	}
+	if ds.OrgServerFQDN == nil || *ds.OrgServerFQDN == "" {
+		return false
+	}
+	if ds.Topology != nil && *ds.Topology != "" {
+		return true
+	}
+	if cacheIsTopLevel {
+		return ds.MultiSiteOrigin != nil && *ds.MultiSiteOrigin
+	}
+	if _, ok := serverDSes[*ds.ID]; !ok {
+		return false // parent.config skips DSes not assigned to this server
+	}
+	return ds.Type.UsesMidCache()
+}
+
+// makeServerDSes returns the IDs of the Delivery Services assigned to the given server.
+func makeServerDSes(dss []DeliveryServiceServer, serverID int) map[int]struct{} {
+	serverDSes := map[int]struct{}{}
+	for _, ds := range dss {
+		if ds.Server == serverID {
+			serverDSes[ds.DeliveryService] = struct{}{}
+		}
+	}
+	return serverDSes
+}
+
+// makeDirectStrategy returns a strategy for the Delivery Service which goes directly to its origin.
+// This is used when the Delivery Service's parentage can't be created, because remap.config still references its strategy.
+// The ds must have a non-nil XMLID and OrgServerFQDN.
+func makeDirectStrategy(ds *DeliveryService) strategy {
+	st := strategy{DS: tc.DeliveryServiceName(*ds.XMLID), Scheme: "http", Policy: StrategyPolicyFirstLive, GoDirect: true, ParentIsProxy: false}
+	if orgURI, _, err := getOriginURI(*ds.OrgServerFQDN); err == nil {
+		st.Parents = []TopologyParent{{Host: orgURI.Hostname(), Port: orgURI.Port()}}
+		if orgURI.Scheme == "https" {
+			st.Scheme = orgURI.Scheme
+		}
+	}
+	return st
+}
+
+// strategy is the parentage of a Delivery Service, as a strategies.yaml strategy.
+type strategy struct {
+	// DS is the name of the Delivery Service the strategy was created from.
+	DS               tc.DeliveryServiceName
+	Parents          []TopologyParent
+	SecondaryParents []TopologyParent
+	// Scheme is the scheme of requests to the parents.
+	Scheme        string
+	Policy        string
+	HashKey       string
+	GoDirect      bool
+	ParentIsProxy bool
+	// RingMode is how the secondary parents are used, and is empty if there are none.
+	RingMode string
+	// MaxSimpleRetries and SimpleRetryResponses are the simple retries, and are empty if there are none.
+	MaxSimpleRetries     string
+	SimpleRetryResponses []int
+	// MaxUnavailableRetries and UnavailableRetryResponses are the unavailable server retries, and are empty if there are none.
+	MaxUnavailableRetries     string
+	UnavailableRetryResponses []int
+}
+
+// makeDSStrategy returns the strategy of the Delivery Service, whether the server has one, any warnings, and any error.
+// The ds must have a non-nil XMLID, ID, Type, and OrgServerFQDN.
+func makeDSStrategy(
+	server *Server,
+	servers []Server,
+	ds *DeliveryService,
+	data parentConfigData,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+) (strategy, bool, []string, error) {
+	warnings := []string{}
+
+	// Note these Parameters are only used for MSO for legacy DeliveryServiceServers DeliveryServices (except QueryStringHandling which is used by all DeliveryServices).
+	//      Topology DSes use them for all DSes, MSO and non-MSO.
+	dsParams, dsParamsWarnings := getParentDSParams(*ds, data.ProfileParentConfigParams)
+	warnings = append(warnings, dsParamsWarnings...)
+
+	orgURI, orgWarns, err := getOriginURI(*ds.OrgServerFQDN)
+	warnings = append(warnings, orgWarns...)
+	if err != nil {
+		return strategy{}, false, warnings, errors.New("DS '" + *ds.XMLID + "' has malformed origin URI: '" + *ds.OrgServerFQDN + "': skipping!" + err.Error())
+	}
+
+	st := strategy{DS: tc.DeliveryServiceName(*ds.XMLID), Scheme: "http", ParentIsProxy: true}
+
+	if ds.Topology != nil && *ds.Topology != "" {
+		parents, inTopology, topoWarnings, err := makeTopologyParents(server, servers, ds, data.ServerParams, data.ParentConfigParams, data.NameTopologies, serverCapabilities, dsRequiredCapabilities, data.CacheGroups, dsParams, data.DSOrigins[DeliveryServiceID(*ds.ID)])
+		warnings = append(warnings, topoWarnings...)
+		if err != nil || !inTopology {
+			return strategy{}, false, warnings, err
+		}
+		st.Parents = parents.Parents
+		st.SecondaryParents = parents.SecondaryParents
+		st.Policy, st.HashKey = strategyPolicyHashKey(parents.RoundRobin, parents.QueryString, &warnings)
+		st.GoDirect = parents.GoDirect
+		st.ParentIsProxy = !parents.IsLastCacheTier
+		if parents.IsLastCacheTier {
+			st.Scheme = orgURI.Scheme // the last cache tier's parents are origins
+		}
+		st.setRetries(parents.ParentRetry, parents.UnavailableServerRetryResponses, parents.MaxSimpleRetries, parents.MaxUnavailableServerRetries)
+		st.setRingMode(parents.TryAllPrimariesBeforeSecondary)
+	} else if data.CacheIsTopLevel {
+		if len(data.ParentInfos[OriginHost(orgURI.Hostname())]) == 0 {
+			// TODO error? emulates Perl
+			warnings = append(warnings, "DS "+*ds.XMLID+" has no parent servers")
+		}
+		parents, secondaryParents := selectMSOParents(data.ParentInfos[OriginHost(orgURI.Hostname())], data.ATSMajorVer, dsParams.Algorithm)
+		st.Parents = parentInfosToTopologyParents(parents)
+		st.SecondaryParents = parentInfosToTopologyParents(secondaryParents)
+
+		parentQStr := "ignore"
+		if dsParams.QueryStringHandling == "" && dsParams.Algorithm == tc.AlgorithmConsistentHash && ds.QStringIgnore != nil && tc.QStringIgnore(*ds.QStringIgnore) == tc.QStringIgnoreUseInCacheKeyAndPassUp {
+			parentQStr = "consider"
+		}
+		st.Policy, st.HashKey = strategyPolicyHashKey(dsParams.Algorithm, parentQStr, &warnings)
+		st.Scheme = orgURI.Scheme
+		st.ParentIsProxy = false
+		st.setRetries(dsParams.ParentRetry, dsParams.UnavailableServerRetryResponses, dsParams.MaxSimpleRetries, dsParams.MaxUnavailableServerRetries)
+		st.setRingMode(dsParams.TryAllPrimariesBeforeSecondary)
+	} else {
+		parents, secondaryParents := selectParents(ds, dsRequiredCapabilities, data.ParentInfos[deliveryServicesAllParentsKey], data.ATSMajorVer)
+		st.Parents = parentInfosToTopologyParents(parents)
+		st.SecondaryParents = parentInfosToTopologyParents(secondaryParents)
+
+		// TODO refactor this logic, hard to understand (transliterated from Perl)
+		dsQSH := data.ServerParams[ParentConfigParamQStringHandling]
+		if dsQSH == "" {
+			dsQSH = dsParams.QueryStringHandling
+		}
+		parentQStr := dsQSH
+		if parentQStr == "" {
+			parentQStr = "ignore"
+		}
+		if ds.QStringIgnore != nil && tc.QStringIgnore(*ds.QStringIgnore) == tc.QStringIgnoreUseInCacheKeyAndPassUp && dsQSH == "" {
+			parentQStr = "consider"
+		}
+		st.Policy, st.HashKey = strategyPolicyHashKey(tc.AlgorithmConsistentHash, parentQStr, &warnings)
+		st.setRingMode(dsParams.TryAllPrimariesBeforeSecondary)
+	}
+
+	if len(st.Parents) == 0 {
+		warnings = append(warnings, "DS '"+*ds.XMLID+"' has no parents! Its strategy will have an empty group!")
+	}
+	if st.Scheme != "http" && st.Scheme != "https" {
+		warnings = append(warnings, "DS '"+*ds.XMLID+"' origin '"+*ds.OrgServerFQDN+"' has unknown scheme '"+st.Scheme+"', using http!")
+		st.Scheme = "http"
+	}
+	return st, true, warnings, nil
+}
+
+// setRetries sets the strategy's retries from the parent.config retry directives. The parentRetry may be empty, for no retries.
+// If unavailableServerRetryResponses is not "", it must be valid. Use unavailableServerRetryResponsesValid to check.
+func (st *strategy) setRetries(parentRetry string, unavailableServerRetryResponses string, maxSimpleRetries string, maxUnavailableServerRetries string) {
+	if parentRetry == "simple" || parentRetry == "both" {
+		st.MaxSimpleRetries = maxSimpleRetries
+		if st.MaxSimpleRetries == "" {
+			st.MaxSimpleRetries = ParentConfigDSParamDefaultMaxSimpleRetries
+		}
+		st.SimpleRetryResponses = []int{StrategyDefaultSimpleRetryResponse}
+	}
+	if parentRetry == "unavailable_server_retry" || parentRetry == "both" {
+		st.MaxUnavailableRetries = maxUnavailableServerRetries
+		if st.MaxUnavailableRetries == "" {
+			st.MaxUnavailableRetries = ParentConfigDSParamDefaultMaxUnavailableServerRetries
+		}
+		st.UnavailableRetryResponses = parseRetryResponses(unavailableServerRetryResponses)
+		if len(st.UnavailableRetryResponses) == 0 {
+			st.UnavailableRetryResponses = []int{StrategyDefaultUnavailableServerRetryResponse}
+		}
+	}
+}
+
+// setRingMode sets the strategy's ring mode, if it has secondary parents.
+// Trying all primaries before the secondaries is the parent.config secondary_mode=2, and otherwise parent.config alternates between them.
+func (st *strategy) setRingMode(tryAllPrimariesBeforeSecondary bool) {
+	if len(st.SecondaryParents) == 0 {
+		return
+	}
+	st.RingMode = StrategyRingModeAlternate
+	if tryAllPrimariesBeforeSecondary {
+		st.RingMode = StrategyRingModeExhaust
+	}
+}
+
+// YAML returns the strategy as a strategies.yaml list item with the given name.
+func (st strategy) YAML(name string) string {
+	txt := "  - strategy: '" + name + "'\n"
+	txt += "    policy: " + st.Policy + "\n"
+	if st.HashKey != "" {
+		txt += "    hash_key: " + st.HashKey + "\n"
+	}
+	txt += "    go_direct: " + strconv.FormatBool(st.GoDirect) + "\n"
+	txt += "    parent_is_proxy: " + strconv.FormatBool(st.ParentIsProxy) + "\n"
+	txt += "    scheme: " + st.Scheme + "\n"
+	txt += "    groups:\n"
+	txt += strategyGroupYAML(st.Parents, st.Scheme)
+	if len(st.SecondaryParents) > 0 {
+		txt += strategyGroupYAML(st.SecondaryParents, st.Scheme)
+	}
+	txt += "    failover:\n"
+	if st.RingMode != "" {
+		txt += "      ring_mode: " + st.RingMode + "\n"
+	}
+	if st.MaxSimpleRetries != "" {
+		txt += "      max_simple_retries: " + st.MaxSimpleRetries + "\n"
+		txt += "      response_codes:\n" + strategyCodesYAML(st.SimpleRetryResponses)
+	}
+	if st.MaxUnavailableRetries != "" {
+		txt += "      max_unavailable_retries: " + st.MaxUnavailableRetries + "\n"
+		txt += "      markdown_codes:\n" + strategyCodesYAML(st.UnavailableRetryResponses)
+	}
+	txt += "      health_check:\n"
+	txt += "        - passive\n"
+	return txt
+}
+
+// strategyGroupYAML returns the parents as a strategies.yaml group of hosts.
+func strategyGroupYAML(parents []TopologyParent, scheme string) string {
+	if len(parents) == 0 {
+		return "      - []\n"
+	}
+	txt := ""
+	for i, parent := range parents {
+		if i == 0 {
+			txt += "      - - host: " + parent.Host + "\n"
+		} else {
+			txt += "        - host: " + parent.Host + "\n"
+		}
+		txt += "          protocol:\n"
+		txt += "            - scheme: " + scheme + "\n"
+		if parent.Port != "" {
+			txt += "              port: " + parent.Port + "\n"
+		}
+		if parent.Weight != "" {
+			txt += "          weight: " + parent.Weight + "\n"
+		}
+	}
+	return txt
+}
+
+func strategyCodesYAML(codes []int) string {
+	txt := ""
+	for _, code := range codes {
+		txt += "        - " + strconv.Itoa(code) + "\n"
+	}
+	return txt
+}
+
+// strategyPolicyHashKey returns the strategies.yaml policy and hash_key of the given parent.config round_robin and qstring.
+// The hash_key is empty unless the policy is consistent_hash. Unknown round_robin values add a warning, and use consistent_hash.
+func strategyPolicyHashKey(roundRobin string, qString string, warnings *[]string) (string, string) {
+	policy := ""
+	switch strings.TrimSpace(roundRobin) {
+	case tc.AlgorithmConsistentHash, "":
+		policy = StrategyPolicyConsistentHash
+	case "true":
+		policy = StrategyPolicyRoundRobinIP
+	case "strict":
+		policy = StrategyPolicyRoundRobinStrict
+	case "false":
+		policy = StrategyPolicyFirstLive
+	case "latched":
+		policy = StrategyPolicyLatched
+	default:
+		*warnings = append(*warnings, "unknown parent selection algorithm '"+roundRobin+"', using "+StrategyPolicyConsistentHash+"!")
+		policy = StrategyPolicyConsistentHash
+	}
+	if policy != StrategyPolicyConsistentHash {
+		return policy, ""
+	}
+	if qString == "consider" {
+		return policy, "path+query"
+	}
+	return policy, "path"
+}
+
+// parseRetryResponses parses an unavailable_server_retry_responses Parameter, such as "500,503", which must be valid. Use unavailableServerRetryResponsesValid to check.
+func parseRetryResponses(responses string) []int {
+	codes := []int{}
+	for _, codeStr := range strings.Split(strings.Trim(strings.TrimSpace(responses), `"`), ",") {
+		if code, err := strconv.Atoi(strings.TrimSpace(codeStr)); err == nil {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+func parentInfosToTopologyParents(parents []parentInfo) []TopologyParent {
+	topoParents := make([]TopologyParent, 0, len(parents))
+	for _, parent := range parents {
+		topoParents = append(topoParents, parent.topologyParent())
+	}
+	return topoParents
+}
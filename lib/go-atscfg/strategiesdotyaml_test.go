@@ -0,0 +1,443 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-testutil"
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	"gopkg.in/yaml.v2"
+)
+
+// testGolden tests that the generated config text is the golden file testdata/name, and that it's valid YAML.
+// If the -update flag is given, the golden file is written instead.
+func testGolden(t *testing.T, name string, txt string) {
+	t.Helper()
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(txt), &obj); err != nil {
+		t.Errorf("expected valid YAML, actual error '%v' parsing '%v'", err, txt)
+	}
+	testutil.Golden(t, name, txt)
+}
+
+func makeStrategiesParams(atsVersion string) []tc.Parameter {
+	return []tc.Parameter{
+		tc.Parameter{
+			Name:       "trafficserver",
+			ConfigFile: "package",
+			Value:      atsVersion,
+			Profiles:   []byte(`["global"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamUseStrategies,
+			ConfigFile: ParentConfigFileName,
+			Value:      "true",
+			Profiles:   []byte(`["serverprofile"]`),
+		},
+	}
+}
+
+func makeStrategiesCG(name string, id int, cgType string, parent *tc.CacheGroupNullable, secondaryParent *tc.CacheGroupNullable) tc.CacheGroupNullable {
+	cg := tc.CacheGroupNullable{}
+	cg.Name = util.StrPtr(name)
+	cg.ID = util.IntPtr(id)
+	cg.Type = util.StrPtr(cgType)
+	if parent != nil {
+		cg.ParentName = parent.Name
+		cg.ParentCachegroupID = parent.ID
+	}
+	if secondaryParent != nil {
+		cg.SecondaryParentName = secondaryParent.Name
+		cg.SecondaryParentCachegroupID = secondaryParent.ID
+	}
+	return cg
+}
+
+func makeStrategiesServer(hostName string, id int, cg tc.CacheGroupNullable, serverType string, ip string) Server {
+	sv := makeTestParentServer()
+	sv.HostName = util.StrPtr(hostName)
+	sv.ID = util.IntPtr(id)
+	sv.Cachegroup = cg.Name
+	sv.CachegroupID = cg.ID
+	sv.Type = serverType
+	setIP(sv, ip)
+	return *sv
+}
+
+func TestMakeStrategiesDotYAMLEdge(t *testing.T) {
+	opts := StrategiesYAMLOpts{AddComments: true, HdrComment: "myHeaderComment"}
+
+	// secondary parents, with the secondary mode Parameter
+	ds0 := makeParentDS()
+	ds0.ID = util.IntPtr(42)
+	ds0.XMLID = util.StrPtr("ds0")
+	ds0Type := tc.DSTypeHTTP
+	ds0.Type = &ds0Type
+	ds0.QStringIgnore = util.IntPtr(int(tc.QStringIgnoreUseInCacheKeyAndPassUp))
+	ds0.OrgServerFQDN = util.StrPtr("http://ds0.example.net")
+	ds0.ProfileName = util.StrPtr("ds0Profile")
+	ds0.ProfileID = util.IntPtr(994)
+
+	// topology
+	ds1 := makeParentDS()
+	ds1.ID = util.IntPtr(43)
+	ds1.XMLID = util.StrPtr("ds1")
+	ds1.OrgServerFQDN = util.StrPtr("http://ds1.example.net")
+	ds1.Topology = util.StrPtr("t0")
+
+	// live local, which goes directly to the origin
+	ds2 := makeParentDS()
+	ds2.ID = util.IntPtr(44)
+	ds2.XMLID = util.StrPtr("ds2")
+	ds2Type := tc.DSTypeHTTPLive
+	ds2.Type = &ds2Type
+	ds2.OrgServerFQDN = util.StrPtr("http://ds2.example.net")
+
+	dses := []DeliveryService{*ds2, *ds1, *ds0}
+
+	parentConfigParams := []tc.Parameter{
+		tc.Parameter{
+			Name:       ParentConfigParamSecondaryMode,
+			ConfigFile: "parent.config",
+			Value:      "",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+	}
+
+	mCG0 := makeStrategiesCG("midCG0", 500, tc.CacheGroupMidTypeName, nil, nil)
+	mCG1 := makeStrategiesCG("midCG1", 501, tc.CacheGroupMidTypeName, nil, nil)
+	eCG := makeStrategiesCG("edgeCG", 400, tc.CacheGroupEdgeTypeName, &mCG0, &mCG1)
+	cgs := []tc.CacheGroupNullable{eCG, mCG0, mCG1}
+
+	server := makeStrategiesServer("myedge", 44, eCG, "EDGE", "192.168.2.1")
+	servers := []Server{
+		server,
+		makeStrategiesServer("mymid0", 45, mCG0, "MID", "192.168.2.2"),
+		makeStrategiesServer("mymid1", 46, mCG0, "MID", "192.168.2.3"),
+		makeStrategiesServer("mymid2", 47, mCG1, "MID", "192.168.2.4"),
+	}
+
+	topologies := []tc.Topology{
+		tc.Topology{
+			Name: "t0",
+			Nodes: []tc.TopologyNode{
+				tc.TopologyNode{
+					Cachegroup: "edgeCG",
+					Parents:    []int{1, 2},
+				},
+				tc.TopologyNode{
+					Cachegroup: "midCG1",
+				},
+				tc.TopologyNode{
+					Cachegroup: "midCG0",
+				},
+			},
+		},
+	}
+
+	dss := []DeliveryServiceServer{
+		DeliveryServiceServer{Server: *server.ID, DeliveryService: *ds0.ID},
+		DeliveryServiceServer{Server: *server.ID, DeliveryService: *ds2.ID},
+	}
+	cdn := &tc.CDN{DomainName: "cdndomain.example", Name: "my-cdn-name"}
+
+	cfg, err := MakeStrategiesDotYAML(dses, &server, servers, topologies, makeStrategiesParams("9"), parentConfigParams, nil, nil, cgs, dss, cdn, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Warnings) != 0 {
+		t.Errorf("expected no warnings, actual: %+v", cfg.Warnings)
+	}
+	testComment(t, cfg.Text, opts.HdrComment)
+	testGolden(t, "strategies_edge.yaml", cfg.Text)
+}
+
+func TestMakeStrategiesDotYAMLMidMSO(t *testing.T) {
+	opts := StrategiesYAMLOpts{HdrComment: "myHeaderComment"}
+
+	// MSO, with retry Parameters
+	ds0 := makeParentDS()
+	ds0.ID = util.IntPtr(42)
+	ds0.XMLID = util.StrPtr("ds0")
+	ds0Type := tc.DSTypeHTTP
+	ds0.Type = &ds0Type
+	ds0.OrgServerFQDN = util.StrPtr("https://ds0.example.net")
+	ds0.MultiSiteOrigin = util.BoolPtr(true)
+	ds0.ProfileName = util.StrPtr("ds0Profile")
+	ds0.ProfileID = util.IntPtr(994)
+
+	// Origin Shield, which parent.config doesn't include, and goes directly to the origin from the top tier
+	ds1 := makeParentDS()
+	ds1.ID = util.IntPtr(43)
+	ds1.XMLID = util.StrPtr("ds1")
+	ds1.OrgServerFQDN = util.StrPtr("http://ds1.example.net")
+	ds1.OriginShield = util.StrPtr("shield0.example.net:8080|2;shield1.example.net")
+
+	// neither, which goes directly to the origin from the top tier
+	ds2 := makeParentDS()
+	ds2.ID = util.IntPtr(44)
+	ds2.XMLID = util.StrPtr("ds2")
+	ds2.OrgServerFQDN = util.StrPtr("http://ds2.example.net")
+
+	dses := []DeliveryService{*ds0, *ds1, *ds2}
+
+	parentConfigParams := []tc.Parameter{
+		tc.Parameter{
+			Name:       ParentConfigParamAlgorithm,
+			ConfigFile: "parent.config",
+			Value:      "true",
+			Profiles:   []byte(`["serverprofile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamMSOAlgorithm,
+			ConfigFile: "parent.config",
+			Value:      "consistent_hash",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamMSOParentRetry,
+			ConfigFile: "parent.config",
+			Value:      "both",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamMSOUnavailableServerRetryResponses,
+			ConfigFile: "parent.config",
+			Value:      `"500,502,503"`,
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamMSOMaxSimpleRetries,
+			ConfigFile: "parent.config",
+			Value:      "14",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamMSOMaxUnavailableServerRetries,
+			ConfigFile: "parent.config",
+			Value:      "9",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+	}
+
+	oCG0 := makeStrategiesCG("originCG0", 500, tc.CacheGroupOriginTypeName, nil, nil)
+	oCG1 := makeStrategiesCG("originCG1", 501, tc.CacheGroupOriginTypeName, nil, nil)
+	mCG := makeStrategiesCG("midCG", 400, tc.CacheGroupMidTypeName, &oCG0, &oCG1)
+	cgs := []tc.CacheGroupNullable{mCG, oCG0, oCG1}
+
+	server := makeStrategiesServer("mymid", 44, mCG, "MID", "192.168.2.1")
+	servers := []Server{
+		server,
+		makeStrategiesServer("myorigin0", 45, oCG0, tc.OriginTypeName, "192.168.2.2"),
+		makeStrategiesServer("myorigin1", 46, oCG1, tc.OriginTypeName, "192.168.2.3"),
+		makeStrategiesServer("myorigin2", 47, oCG1, tc.OriginTypeName, "192.168.2.4"),
+	}
+	for i := range servers[1:] {
+		servers[i+1].DomainName = util.StrPtr("example.net")
+	}
+
+	dss := []DeliveryServiceServer{
+		DeliveryServiceServer{Server: 45, DeliveryService: *ds0.ID},
+		DeliveryServiceServer{Server: 46, DeliveryService: *ds0.ID},
+	}
+	cdn := &tc.CDN{DomainName: "cdndomain.example", Name: "my-cdn-name"}
+
+	cfg, err := MakeStrategiesDotYAML(dses, &server, servers, nil, makeStrategiesParams("9"), parentConfigParams, nil, nil, cgs, dss, cdn, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testComment(t, cfg.Text, opts.HdrComment)
+	testGolden(t, "strategies_mid_mso.yaml", cfg.Text)
+}
+
+func TestMakeStrategiesDotYAMLTopologyLastTier(t *testing.T) {
+	opts := StrategiesYAMLOpts{HdrComment: "myHeaderComment"}
+
+	ds0 := makeParentDS()
+	ds0.ID = util.IntPtr(42)
+	ds0.XMLID = util.StrPtr("ds0")
+	ds0.OrgServerFQDN = util.StrPtr("http://ds0.example.net")
+	ds0.Topology = util.StrPtr("t0")
+	ds0.MultiSiteOrigin = util.BoolPtr(true)
+	ds0.ProfileName = util.StrPtr("ds0Profile")
+	ds0.ProfileID = util.IntPtr(994)
+
+	// not in the Topology
+	ds1 := makeParentDS()
+	ds1.ID = util.IntPtr(43)
+	ds1.XMLID = util.StrPtr("ds1")
+	ds1.OrgServerFQDN = util.StrPtr("http://ds1.example.net")
+	ds1.Topology = util.StrPtr("t1")
+
+	dses := []DeliveryService{*ds0, *ds1}
+
+	parentConfigParams := []tc.Parameter{
+		tc.Parameter{
+			Name:       ParentConfigParamMSOParentRetry,
+			ConfigFile: "parent.config",
+			Value:      "simple",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+	}
+
+	oCG := makeStrategiesCG("originCG", 500, tc.CacheGroupOriginTypeName, nil, nil)
+	eCG := makeStrategiesCG("edgeCG", 400, tc.CacheGroupEdgeTypeName, &oCG, nil)
+	otherCG := makeStrategiesCG("otherCG", 401, tc.CacheGroupEdgeTypeName, &oCG, nil)
+	cgs := []tc.CacheGroupNullable{eCG, oCG, otherCG}
+
+	server := makeStrategiesServer("myedge", 44, eCG, "EDGE", "192.168.2.1")
+	servers := []Server{
+		server,
+		makeStrategiesServer("myorigin0", 45, oCG, tc.OriginTypeName, "192.168.2.2"),
+		makeStrategiesServer("myorigin1", 46, oCG, tc.OriginTypeName, "192.168.2.3"),
+	}
+
+	topologies := []tc.Topology{
+		tc.Topology{
+			Name: "t0",
+			Nodes: []tc.TopologyNode{
+				tc.TopologyNode{Cachegroup: "edgeCG", Parents: []int{1}},
+				tc.TopologyNode{Cachegroup: "originCG"},
+			},
+		},
+		tc.Topology{
+			Name: "t1",
+			Nodes: []tc.TopologyNode{
+				tc.TopologyNode{Cachegroup: "otherCG"},
+			},
+		},
+	}
+
+	dss := []DeliveryServiceServer{
+		DeliveryServiceServer{Server: 45, DeliveryService: *ds0.ID},
+	}
+	cdn := &tc.CDN{DomainName: "cdndomain.example", Name: "my-cdn-name"}
+
+	cfg, err := MakeStrategiesDotYAML(dses, &server, servers, topologies, makeStrategiesParams("9"), parentConfigParams, nil, nil, cgs, dss, cdn, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testComment(t, cfg.Text, opts.HdrComment)
+	testGolden(t, "strategies_topology_last_tier.yaml", cfg.Text)
+}
+
+func TestMakeStrategiesDotYAMLOldATSWarns(t *testing.T) {
+	server := makeTestParentServer()
+	eCG := makeStrategiesCG(*server.Cachegroup, *server.CachegroupID, tc.CacheGroupEdgeTypeName, nil, nil)
+	cdn := &tc.CDN{DomainName: "cdndomain.example", Name: "my-cdn-name"}
+
+	cfg, err := MakeStrategiesDotYAML(nil, server, []Server{*server}, nil, makeStrategiesParams("8"), nil, nil, nil, []tc.CacheGroupNullable{eCG}, nil, cdn, StrategiesYAMLOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Text != "strategies:\n" {
+		t.Errorf("expected no strategies, actual: '%v'", cfg.Text)
+	}
+	if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], "ATS 9") {
+		t.Errorf("expected a warning that strategies.yaml requires ATS 9, actual: %+v", cfg.Warnings)
+	}
+}
+
+func TestMakeStrategiesDotYAMLMatchesRemap(t *testing.T) {
+	makeDS := func(id int, xmlID string) DeliveryService {
+		ds := makeParentDS()
+		ds.ID = util.IntPtr(id)
+		ds.XMLID = util.StrPtr(xmlID)
+		dsType := tc.DSTypeHTTP
+		ds.Type = &dsType
+		ds.OrgServerFQDN = util.StrPtr("http://" + xmlID + ".example.net")
+		ds.DSCP = util.IntPtr(0)
+		ds.Active = util.BoolPtr(true)
+		return *ds
+	}
+
+	// not assigned to the mid, so parent.config has no line for it, and remap.config mustn't reference its strategy
+	ds0 := makeDS(42, "ds0")
+	// topology which doesn't exist, so its parents can't be created, but remap.config references its strategy
+	ds1 := makeDS(43, "ds1")
+	ds1.Topology = util.StrPtr("nonexistent")
+	// assigned to the mid
+	ds2 := makeDS(44, "ds2")
+	dses := []DeliveryService{ds0, ds1, ds2}
+
+	mCG1 := makeStrategiesCG("midCG1", 501, tc.CacheGroupMidTypeName, nil, nil)
+	mCG0 := makeStrategiesCG("midCG0", 500, tc.CacheGroupMidTypeName, &mCG1, nil)
+	eCG := makeStrategiesCG("edgeCG", 400, tc.CacheGroupEdgeTypeName, &mCG0, nil)
+	cgs := []tc.CacheGroupNullable{eCG, mCG0, mCG1}
+
+	server := makeStrategiesServer("mymid0", 45, mCG0, "MID", "192.168.2.2")
+	servers := []Server{
+		makeStrategiesServer("myedge", 44, eCG, "EDGE", "192.168.2.1"),
+		server,
+		makeStrategiesServer("mymid1", 46, mCG1, "MID", "192.168.2.3"),
+	}
+	dss := []DeliveryServiceServer{
+		DeliveryServiceServer{Server: 44, DeliveryService: *ds0.ID},
+		DeliveryServiceServer{Server: *server.ID, DeliveryService: *ds2.ID},
+	}
+	cdn := &tc.CDN{DomainName: "cdndomain.example", Name: "my-cdn-name"}
+	params := makeStrategiesParams("9")
+
+	strategies, err := MakeStrategiesDotYAML(dses, &server, servers, nil, params, nil, nil, nil, cgs, dss, cdn, StrategiesYAMLOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remap, err := MakeRemapDotConfig(&server, dses, dss, nil, params, cdn, nil, nil, cgs, nil, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	referenced := map[string]struct{}{}
+	for _, field := range strings.Fields(remap.Text) {
+		if strings.HasPrefix(field, "@strategy=") {
+			referenced[strings.TrimPrefix(field, "@strategy=")] = struct{}{}
+		}
+	}
+	for _, ds := range dses {
+		name := StrategyName(*ds.XMLID)
+		_, isReferenced := referenced[name]
+		isGenerated := strings.Contains(strategies.Text, "- strategy: '"+name+"'\n")
+		if isReferenced != isGenerated {
+			t.Errorf("expected strategy '%v' to be in strategies.yaml if and only if remap.config references it, actual referenced %v generated %v", name, isReferenced, isGenerated)
+		}
+		if expected := *ds.XMLID != "ds0"; isReferenced != expected {
+			t.Errorf("expected remap.config referencing strategy '%v' %v, actual %v", name, expected, isReferenced)
+		}
+	}
+
+	obj := struct {
+		Strategies []struct {
+			Strategy string `yaml:"strategy"`
+			GoDirect bool   `yaml:"go_direct"`
+		} `yaml:"strategies"`
+	}{}
+	if err := yaml.Unmarshal([]byte(strategies.Text), &obj); err != nil {
+		t.Fatalf("expected valid YAML, actual error '%v' parsing '%v'", err, strategies.Text)
+	}
+	for _, st := range obj.Strategies {
+		if st.Strategy == StrategyName("ds1") && !st.GoDirect {
+			t.Errorf("expected strategy of DS whose parents can't be created to go directly to the origin, actual: %+v", st)
+		}
+	}
+}
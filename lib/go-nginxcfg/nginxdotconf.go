@@ -0,0 +1,338 @@
+// Package nginxcfg generates nginx config from Traffic Ops data.
+//
+// It serves the same Delivery Services, with the same parents, as the Apache Traffic Server config generated by
+// lib/go-atscfg, so nginx caches can be used on the same CDN. Delivery Service features nginx config doesn't support are
+// ignored with a warning; see SupportedFeatures.
+package nginxcfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// ConfFileName is the name of the generated config file. It contains http context directives, and is intended to
+// be included in the http block of nginx.conf, which most distributions do for files in conf.d.
+// The config requires nginx 1.19.4 or later.
+const ConfFileName = "trafficcontrol.conf"
+const ContentTypeConf = atscfg.ContentTypeTextASCII
+const LineCommentConf = atscfg.LineCommentHash
+
+// CacheZone is the name of the proxy_cache keys zone used by every Delivery Service.
+const CacheZone = "trafficcontrol"
+
+const DefaultCacheDir = "/var/cache/nginx/trafficcontrol"
+const DefaultSSLDir = "/etc/nginx/ssl/"
+
+// DefaultSliceSize is the slice size of Delivery Services which slice range requests, but have no RangeSliceBlockSize.
+const DefaultSliceSize = 1048576
+
+// SoftwareName is the name of the cache software, used in warnings.
+const SoftwareName = "nginx"
+
+// SupportedFeatures is the Delivery Service features nginx config supports.
+// Delivery Services using other features are still served, without them, and a warning is given.
+var SupportedFeatures = map[atscfg.CacheDSFeature]struct{}{
+	atscfg.CacheDSFeatureHTTPS:                {},
+	atscfg.CacheDSFeatureHTTPToHTTPS:          {},
+	atscfg.CacheDSFeatureParents:              {},
+	atscfg.CacheDSFeatureSecondaryParents:     {},
+	atscfg.CacheDSFeatureGoDirect:             {},
+	atscfg.CacheDSFeatureHTTPSOrigin:          {},
+	atscfg.CacheDSFeatureQStringIgnore:        {},
+	atscfg.CacheDSFeatureQStringDrop:          {},
+	atscfg.CacheDSFeatureMaxOriginConnections: {},
+	atscfg.CacheDSFeatureRangeSlice:           {},
+}
+
+// ConfOpts contains settings to configure nginx config generation options.
+type ConfOpts struct {
+	// HdrComment is the header comment to include at the beginning of the file.
+	// This should be the text desired, without comment syntax (like # or //). The file's comment syntax will be added.
+	// To omit the header comment, pass the empty string.
+	HdrComment string
+
+	// CacheDir is the directory of the proxy cache. If empty, DefaultCacheDir is used.
+	CacheDir string
+
+	// SSLDir is the directory of the Delivery Service certificate and key files. If empty, DefaultSSLDir is used.
+	// The files are named as ATS ssl_multicert.config names them.
+	SSLDir string
+}
+
+// MakeConf creates the nginx config file, with an upstream and server for each of the Delivery Services.
+// The cacheDSes should be created by atscfg.MakeCacheDSes for the server.
+// HTTPS is only served for Delivery Services with keys in sslKeys.
+func MakeConf(
+	server *atscfg.Server,
+	cacheDSes []atscfg.CacheDS,
+	sslKeys []tc.CDNSSLKeys,
+	opt ConfOpts,
+) (atscfg.Cfg, error) {
+	warnings := []string{}
+	if server.HostName == nil {
+		return atscfg.Cfg{}, errors.New("server HostName missing")
+	}
+	if opt.CacheDir == "" {
+		opt.CacheDir = DefaultCacheDir
+	}
+	if opt.SSLDir == "" {
+		opt.SSLDir = DefaultSSLDir
+	}
+	if !strings.HasSuffix(opt.SSLDir, "/") {
+		opt.SSLDir += "/"
+	}
+
+	httpPort := 80
+	if server.TCPPort != nil && *server.TCPPort > 0 {
+		httpPort = *server.TCPPort
+	}
+	httpsPort := 443
+	if server.HTTPSPort != nil && *server.HTTPSPort > 0 {
+		httpsPort = *server.HTTPSPort
+	}
+
+	dsHasKeys := map[string]struct{}{}
+	for _, keys := range sslKeys {
+		dsHasKeys[keys.DeliveryService] = struct{}{}
+	}
+
+	txt := ""
+	if opt.HdrComment != "" {
+		txt += LineCommentConf + " " + opt.HdrComment + "\n"
+	}
+	txt += "\nproxy_cache_path " + opt.CacheDir + " levels=1:2 keys_zone=" + CacheZone + ":64m use_temp_path=off;\n"
+	txt += "\n# requests for hosts without a Delivery Service are not found, like ATS remap_required\n"
+	txt += "# HTTPS handshakes for them are rejected, rather than served with another Delivery Service's certificate\n"
+	txt += "server {\n"
+	txt += "\tlisten " + strconv.Itoa(httpPort) + " default_server;\n"
+	txt += "\tlisten " + strconv.Itoa(httpsPort) + " ssl default_server;\n"
+	txt += "\tssl_reject_handshake on;\n"
+	txt += "\treturn 404;\n"
+	txt += "}\n"
+
+	usedFQDNs := map[string]string{} // map[fqdn]dsName
+	for _, cds := range cacheDSes {
+		dsName := *cds.DS.XMLID
+		warnings = append(warnings, cds.UnsupportedFeatureWarnings(SoftwareName, SupportedFeatures)...)
+		if *cds.DS.Type == tc.DSTypeAnyMap {
+			continue
+		}
+
+		fqdns := []string{}
+		for _, fqdn := range cds.RequestFQDNs {
+			if usedBy, ok := usedFQDNs[fqdn]; ok {
+				if usedBy != dsName {
+					warnings = append(warnings, "ds '"+dsName+"' request host '"+fqdn+"' is already served by ds '"+usedBy+"', skipping the host!")
+				}
+				continue
+			}
+			usedFQDNs[fqdn] = dsName
+			fqdns = append(fqdns, fqdn)
+		}
+		if len(fqdns) == 0 {
+			continue
+		}
+
+		certName, keyName, hasCert := "", "", false
+		if cds.HTTPS {
+			if _, ok := dsHasKeys[dsName]; !ok {
+				warnings = append(warnings, "ds '"+dsName+"' is HTTPS, but has no SSL keys, not serving HTTPS!")
+			} else if len(cds.DS.ExampleURLs) == 0 {
+				warnings = append(warnings, "ds '"+dsName+"' is HTTPS, but has no example URLs to name its certificate, not serving HTTPS!")
+			} else {
+				sslDSes, sslWarns := atscfg.DeliveryServicesToSSLMultiCertDSes([]atscfg.DeliveryService{cds.DS})
+				warnings = append(warnings, sslWarns...)
+				certName, keyName = atscfg.GetSSLMultiCertDotConfigCertAndKeyName(tc.DeliveryServiceName(dsName), sslDSes[tc.DeliveryServiceName(dsName)])
+				hasCert = true
+			}
+		}
+		if !cds.HTTP && !hasCert {
+			warnings = append(warnings, "ds '"+dsName+"' is only HTTPS, but can't serve HTTPS, skipping!")
+			continue
+		}
+
+		upstreamName := UpstreamName(dsName)
+		upstreamTxt, scheme, upstreamWarns := makeUpstream(upstreamName, cds)
+		warnings = append(warnings, upstreamWarns...)
+
+		txt += "\n" + LineCommentConf + " ds '" + dsName + "'"
+		if *cds.DS.Topology != "" {
+			txt += " topology '" + *cds.DS.Topology + "'"
+		}
+		txt += "\n"
+		txt += upstreamTxt
+		txt += "server {\n"
+		if cds.HTTP {
+			txt += "\tlisten " + strconv.Itoa(httpPort) + ";\n"
+		}
+		if hasCert {
+			txt += "\tlisten " + strconv.Itoa(httpsPort) + " ssl;\n"
+		}
+		txt += "\tserver_name " + strings.Join(fqdns, " ") + ";\n"
+		if hasCert {
+			txt += "\tssl_certificate " + opt.SSLDir + certName + ";\n"
+			txt += "\tssl_certificate_key " + opt.SSLDir + keyName + ";\n"
+			if cds.HTTP && *cds.DS.Protocol == tc.DSProtocolHTTPToHTTPS {
+				txt += "\tif ($scheme = http) {\n"
+				txt += "\t\treturn 301 https://$host$request_uri;\n"
+				txt += "\t}\n"
+			}
+		}
+		txt += makeLocation(cds, upstreamName, scheme)
+		txt += "}\n"
+	}
+
+	return atscfg.Cfg{
+		Text:        txt,
+		ContentType: ContentTypeConf,
+		LineComment: LineCommentConf,
+		Warnings:    warnings,
+	}, nil
+}
+
+// UpstreamName returns the name of the nginx upstream of the given Delivery Service.
+func UpstreamName(dsName string) string {
+	return "ds-" + dsName
+}
+
+// makeUpstream returns the upstream block of the Delivery Service's parents, or its origin if it has none, the scheme
+// of requests to the upstream, and any warnings.
+//
+// Consistent hash parents use the nginx consistent hash, which doesn't allow backup servers, so secondary parents and
+// going directly to the origin are ignored with a warning. Otherwise, secondary parents and the origin are backups.
+func makeUpstream(name string, cds atscfg.CacheDS) (string, string, []string) {
+	warnings := []string{}
+	dsName := *cds.DS.XMLID
+	originServer := makeServer(cds.Origin.Hostname(), cds.Origin.Port())
+	maxConns := ""
+	if cds.DS.MaxOriginConnections != nil && *cds.DS.MaxOriginConnections > 0 {
+		maxConns = " max_conns=" + strconv.Itoa(*cds.DS.MaxOriginConnections)
+	}
+
+	txt := "upstream " + name + " {\n"
+	parents := cds.Parents
+	if len(parents.Parents) == 0 {
+		txt += "\tserver " + originServer + maxConns + ";\n"
+		txt += "}\n"
+		return txt, cds.Origin.Scheme, warnings
+	}
+
+	parentMaxConns := ""
+	if !parents.ParentIsProxy {
+		parentMaxConns = maxConns // the parents are origins
+	}
+
+	isHash := parents.Policy == atscfg.StrategyPolicyConsistentHash
+	firstLive := parents.Policy == atscfg.StrategyPolicyFirstLive || parents.Policy == atscfg.StrategyPolicyLatched
+	if isHash {
+		if parents.HashKey == "path+query" {
+			txt += "\thash $request_uri consistent;\n"
+		} else {
+			txt += "\thash $uri consistent;\n"
+		}
+	}
+	for i, parent := range parents.Parents {
+		backup := ""
+		if firstLive && i > 0 {
+			backup = " backup" // first live only uses the other parents if the first fails
+		}
+		txt += "\tserver " + makeServer(parent.Host, parent.Port) + parentMaxConns + backup + ";\n"
+	}
+	if len(parents.SecondaryParents) > 0 {
+		if isHash {
+			warnings = append(warnings, "ds '"+dsName+"' has secondary parents, but nginx consistent hash upstreams can't have backup servers, ignoring the secondary parents!")
+		} else {
+			for _, parent := range parents.SecondaryParents {
+				txt += "\tserver " + makeServer(parent.Host, parent.Port) + parentMaxConns + " backup;\n"
+			}
+		}
+	}
+	if parents.GoDirect {
+		if isHash {
+			warnings = append(warnings, "ds '"+dsName+"' goes directly to the origin if its parents fail, but nginx consistent hash upstreams can't have backup servers, ignoring!")
+		} else if cds.Origin.Scheme != parents.Scheme {
+			warnings = append(warnings, "ds '"+dsName+"' goes directly to the origin if its parents fail, but the origin scheme '"+cds.Origin.Scheme+"' isn't the parent scheme '"+parents.Scheme+"', and nginx upstreams have a single scheme, ignoring!")
+		} else {
+			txt += "\tserver " + originServer + maxConns + " backup;\n"
+		}
+	}
+	txt += "}\n"
+	return txt, parents.Scheme, warnings
+}
+
+// makeServer returns the upstream server address of the given host and port, which may be empty.
+func makeServer(host string, port string) string {
+	if port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// makeLocation returns the location block which proxies and caches requests to the Delivery Service's upstream.
+func makeLocation(cds atscfg.CacheDS, upstreamName string, scheme string) string {
+	ds := cds.DS
+	uri := "$request_uri"
+	proxyPassURI := ""
+	if ds.QStringIgnore != nil {
+		switch *ds.QStringIgnore {
+		case tc.QueryStringIgnoreIgnoreInCacheKeyAndPassUp:
+			uri = "$uri"
+		case tc.QueryStringIgnoreDropAtEdge:
+			uri = "$uri"
+			proxyPassURI = "$uri"
+		}
+	}
+	cacheKey := "$proxy_host" + uri
+
+	originHost := cds.Origin.Hostname()
+	if port := cds.Origin.Port(); port != "" && !(cds.Origin.Scheme == "http" && port == "80") && !(cds.Origin.Scheme == "https" && port == "443") {
+		originHost += ":" + port
+	}
+
+	txt := "\tlocation / {\n"
+	if ds.RangeRequestHandling != nil && *ds.RangeRequestHandling == tc.RangeRequestHandlingSlice {
+		sliceSize := DefaultSliceSize
+		if ds.RangeSliceBlockSize != nil && *ds.RangeSliceBlockSize > 0 {
+			sliceSize = *ds.RangeSliceBlockSize
+		}
+		txt += "\t\tslice " + strconv.Itoa(sliceSize) + ";\n"
+		txt += "\t\tproxy_set_header Range $slice_range;\n"
+		cacheKey += "$slice_range"
+	}
+	txt += "\t\tproxy_pass " + scheme + "://" + upstreamName + proxyPassURI + ";\n"
+	txt += "\t\tproxy_http_version 1.1;\n"
+	txt += "\t\tproxy_set_header Connection \"\";\n"
+	txt += "\t\tproxy_set_header Host " + originHost + ";\n"
+	if scheme == "https" {
+		txt += "\t\tproxy_ssl_server_name on;\n"
+		txt += "\t\tproxy_ssl_name " + cds.Origin.Hostname() + ";\n"
+	}
+	txt += "\t\tproxy_cache " + CacheZone + ";\n"
+	txt += "\t\tproxy_cache_key " + cacheKey + ";\n"
+	txt += "\t}\n"
+	return txt
+}
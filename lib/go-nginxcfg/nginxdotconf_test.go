@@ -0,0 +1,134 @@
+package nginxcfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-testutil"
+	"github.com/apache/trafficcontrol/lib/go-testutil/atscfgtest"
+	"github.com/apache/trafficcontrol/lib/go-util"
+)
+
+func TestMakeConfEdge(t *testing.T) {
+	opts := ConfOpts{HdrComment: "myHeaderComment"}
+
+	// consistent hash parents with secondaries, HTTP to HTTPS, query string ignored in the cache key
+	ds0 := atscfgtest.MakeCacheDS("ds0", tc.DSTypeHTTP, tc.DSProtocolHTTPToHTTPS, "http://ds0.example.net")
+	ds0.DS.QStringIgnore = util.IntPtr(int(tc.QueryStringIgnoreIgnoreInCacheKeyAndPassUp))
+	ds0.Parents = atscfg.CacheDSParents{
+		Parents:          atscfgtest.MakeParents("mymid0.example.net", "mymid1.example.net"),
+		SecondaryParents: atscfgtest.MakeParents("mymid2.example.net"),
+		Scheme:           "http",
+		Policy:           atscfg.StrategyPolicyConsistentHash,
+		HashKey:          "path",
+		ParentIsProxy:    true,
+	}
+
+	// round robin topology parents, going directly to the origin, sliced range requests
+	ds1 := atscfgtest.MakeCacheDS("ds1", tc.DSTypeDNS, tc.DSProtocolHTTP, "http://ds1.example.net:8080")
+	ds1.DS.Topology = util.StrPtr("t0")
+	ds1.DS.MaxOriginConnections = util.IntPtr(100)
+	ds1.DS.RangeRequestHandling = util.IntPtr(tc.RangeRequestHandlingSlice)
+	ds1.DS.RangeSliceBlockSize = util.IntPtr(262144)
+	ds1.Parents = atscfg.CacheDSParents{
+		Parents:          atscfgtest.MakeParents("mymid0.example.net"),
+		SecondaryParents: atscfgtest.MakeParents("mymid1.example.net"),
+		Scheme:           "http",
+		Policy:           atscfg.StrategyPolicyRoundRobinStrict,
+		GoDirect:         true,
+		ParentIsProxy:    true,
+	}
+
+	// live local, directly to the origin, HTTPS without keys, query string dropped, header rewrite
+	ds2 := atscfgtest.MakeCacheDS("ds2", tc.DSTypeHTTPLive, tc.DSProtocolHTTPAndHTTPS, "http://ds2.example.net")
+	ds2.DS.QStringIgnore = util.IntPtr(int(tc.QueryStringIgnoreDropAtEdge))
+	ds2.DS.EdgeHeaderRewrite = util.StrPtr("set-header X-Foo foo")
+
+	// any map, which only ATS can serve
+	ds3 := atscfgtest.MakeCacheDS("ds3", tc.DSTypeAnyMap, tc.DSProtocolHTTP, "")
+	ds3 = atscfg.CacheDS{DS: ds3.DS}
+
+	sslKeys := []tc.CDNSSLKeys{{DeliveryService: "ds0"}}
+
+	cfg, err := MakeConf(atscfgtest.MakeServer("myedge", "EDGE"), []atscfg.CacheDS{ds0, ds1, ds2, ds3}, sslKeys, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedWarnings := []string{
+		"ds 'ds0' has secondary parents, but nginx consistent hash upstreams can't have backup servers, ignoring the secondary parents!",
+		"ds 'ds2' uses header rewrite, which nginx config doesn't support, ignoring!",
+		"ds 'ds2' is HTTPS, but has no SSL keys, not serving HTTPS!",
+		"ds 'ds3' uses ANY_MAP remap text, which nginx config doesn't support, ignoring!",
+	}
+	if !reflect.DeepEqual(expectedWarnings, cfg.Warnings) {
+		t.Errorf("expected warnings %+v, actual %+v", expectedWarnings, cfg.Warnings)
+	}
+	if !strings.HasPrefix(cfg.Text, "# myHeaderComment\n") {
+		t.Errorf("expected header comment, actual: '%v'", cfg.Text)
+	}
+	testutil.Golden(t, "trafficcontrol_edge.conf", cfg.Text)
+}
+
+func TestMakeConfMid(t *testing.T) {
+	opts := ConfOpts{HdrComment: "myHeaderComment", CacheDir: "/var/cache/tc"}
+
+	// first live parents, which are origins
+	ds0 := atscfgtest.MakeCacheDS("ds0", tc.DSTypeHTTP, tc.DSProtocolHTTP, "http://ds0.example.net")
+	ds0.RequestFQDNs = []string{"ds0.example.net"}
+	ds0.DS.MaxOriginConnections = util.IntPtr(50)
+	ds0.Parents = atscfg.CacheDSParents{
+		Parents: []atscfg.TopologyParent{{Host: "origin0.example.net", Port: "80"}, {Host: "origin1.example.net", Port: "80"}},
+		Scheme:  "http",
+		Policy:  atscfg.StrategyPolicyFirstLive,
+	}
+
+	// the same origin host as ds0
+	ds1 := atscfgtest.MakeCacheDS("ds1", tc.DSTypeHTTP, tc.DSProtocolHTTP, "http://ds0.example.net")
+	ds1.RequestFQDNs = []string{"ds0.example.net"}
+
+	// HTTPS origin, which can't be gone to directly from HTTP parents
+	ds2 := atscfgtest.MakeCacheDS("ds2", tc.DSTypeHTTP, tc.DSProtocolHTTP, "https://ds2.example.net:443")
+	ds2.RequestFQDNs = []string{"ds2.example.net"}
+	ds2.Parents = atscfg.CacheDSParents{
+		Parents:       atscfgtest.MakeParents("myorg0.example.net"),
+		Scheme:        "http",
+		Policy:        atscfg.StrategyPolicyRoundRobinIP,
+		GoDirect:      true,
+		ParentIsProxy: true,
+	}
+
+	cfg, err := MakeConf(atscfgtest.MakeServer("mymid", "MID"), []atscfg.CacheDS{ds0, ds1, ds2}, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedWarnings := []string{
+		"ds 'ds1' request host 'ds0.example.net' is already served by ds 'ds0', skipping the host!",
+		"ds 'ds2' goes directly to the origin if its parents fail, but the origin scheme 'https' isn't the parent scheme 'http', and nginx upstreams have a single scheme, ignoring!",
+	}
+	if !reflect.DeepEqual(expectedWarnings, cfg.Warnings) {
+		t.Errorf("expected warnings %+v, actual %+v", expectedWarnings, cfg.Warnings)
+	}
+	testutil.Golden(t, "trafficcontrol_mid.conf", cfg.Text)
+}
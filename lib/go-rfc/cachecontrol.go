@@ -32,6 +32,7 @@ const (
 	LastModified      = "Last-Modified"     // RFC7232§2.2
 	ETagHeader        = "ETag"
 	IfMatch           = "If-Match"
+	IfNoneMatch       = "If-None-Match" // RFC7232§3.2
 	IfUnmodifiedSince = "If-Unmodified-Since"
 	ETagVersion       = 1
 )
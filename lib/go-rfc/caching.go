@@ -390,6 +390,25 @@ func FreshFor(respHeaders http.Header, respCC CacheControlMap, reqTime, respTime
 	return freshnessLifetime - currentAge
 }
 
+// StaleWhileRevalidate returns the value of the stale-while-revalidate
+// Cache-Control directive, per RFC5861§3, and whether it exists and is valid.
+//
+// This is how long after a response becomes stale a cache may serve it, while
+// revalidating it in the background.
+func StaleWhileRevalidate(cc CacheControlMap) (time.Duration, bool) {
+	return getHTTPDeltaSecondsCacheControl(cc, "stale-while-revalidate")
+}
+
+// StaleIfError returns the value of the stale-if-error Cache-Control
+// directive, per RFC5861§4, and whether it exists and is valid. It may be in a
+// request or a response.
+//
+// This is how long after a response becomes stale a cache may serve it, when
+// revalidating it fails with an error or a 5xx response.
+func StaleIfError(cc CacheControlMap) (time.Duration, bool) {
+	return getHTTPDeltaSecondsCacheControl(cc, "stale-if-error")
+}
+
 // Reuse is an "enumerated" type describing the necessary behavior of a cache
 // with regard to its cached objects.
 type Reuse int
@@ -946,3 +946,25 @@ func BenchmarkCanReuseStored(b *testing.B) {
 		CanReuseStored(reqHdr, respHdr, reqCC, respCC, respReqHdrs, respReqTime, respRespTime, strictRFC)
 	}
 }
+
+func TestStaleDirectives(t *testing.T) {
+	hdrs := http.Header{}
+	hdrs.Set(CacheControl, "max-age=60, stale-while-revalidate=30, stale-if-error=86400")
+	cc := ParseCacheControl(hdrs)
+
+	if swr, ok := StaleWhileRevalidate(cc); !ok || swr != 30*time.Second {
+		t.Errorf("StaleWhileRevalidate expected 30s true, actual %v %v", swr, ok)
+	}
+	if sie, ok := StaleIfError(cc); !ok || sie != 24*time.Hour {
+		t.Errorf("StaleIfError expected 24h true, actual %v %v", sie, ok)
+	}
+
+	hdrs.Set(CacheControl, "max-age=60, stale-while-revalidate=foo")
+	cc = ParseCacheControl(hdrs)
+	if swr, ok := StaleWhileRevalidate(cc); ok {
+		t.Errorf("StaleWhileRevalidate invalid value expected false, actual %v %v", swr, ok)
+	}
+	if sie, ok := StaleIfError(cc); ok {
+		t.Errorf("StaleIfError missing expected false, actual %v %v", sie, ok)
+	}
+}
@@ -91,3 +91,43 @@ func CRStatesUnMarshall(body []byte) (CRStates, error) {
 	err := json.Unmarshal(body, &crStates)
 	return crStates, err
 }
+
+// CRStatesDelta is the changes to a CRStates since a previous version, as served by the Traffic Monitor CrStates endpoint given the `since` query parameter.
+// Its JSON is a superset of the CRStates JSON, so a full CRStates document decodes as a delta with a zero Version, which IsFull.
+type CRStatesDelta struct {
+	// Version is the version of the states after the delta is applied, which should be given as `since` in the next request.
+	Version uint64 `json:"version"`
+	// Full is whether the delta contains all caches and delivery services, rather than the changes, because the requested version is unknown.
+	Full                    bool                                            `json:"full"`
+	Caches                  map[CacheName]IsAvailable                       `json:"caches"`
+	DeliveryService         map[DeliveryServiceName]CRStatesDeliveryService `json:"deliveryServices"`
+	DeletedCaches           []CacheName                                     `json:"deletedCaches"`
+	DeletedDeliveryServices []DeliveryServiceName                           `json:"deletedDeliveryServices"`
+}
+
+// IsFull returns whether the delta contains all caches and delivery services, and replaces any previous states.
+func (d CRStatesDelta) IsFull() bool {
+	return d.Full || d.Version == 0
+}
+
+// Apply returns the given states with the delta applied. The given states are not modified. If the delta IsFull, the given states are ignored.
+func (d CRStatesDelta) Apply(states CRStates) CRStates {
+	if d.IsFull() {
+		states = NewCRStates()
+	} else {
+		states = states.Copy()
+	}
+	for name, available := range d.Caches {
+		states.Caches[name] = available
+	}
+	for name, ds := range d.DeliveryService {
+		states.DeliveryService[name] = ds
+	}
+	for _, name := range d.DeletedCaches {
+		delete(states.Caches, name)
+	}
+	for _, name := range d.DeletedDeliveryServices {
+		delete(states.DeliveryService, name)
+	}
+	return states
+}
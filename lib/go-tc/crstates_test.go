@@ -0,0 +1,69 @@
+package tc
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCRStatesDeltaApply(t *testing.T) {
+	states := NewCRStates()
+	states.Caches["edge1"] = IsAvailable{IsAvailable: true}
+	states.Caches["edge2"] = IsAvailable{IsAvailable: true}
+	states.DeliveryService["ds1"] = CRStatesDeliveryService{IsAvailable: true}
+
+	delta := CRStatesDelta{
+		Version:       2,
+		Caches:        map[CacheName]IsAvailable{"edge1": {IsAvailable: false}},
+		DeletedCaches: []CacheName{"edge2"},
+	}
+	applied := delta.Apply(states)
+	if len(applied.Caches) != 1 || applied.Caches["edge1"].IsAvailable {
+		t.Errorf("expected only unavailable edge1, actual %+v", applied.Caches)
+	}
+	if len(applied.DeliveryService) != 1 {
+		t.Errorf("expected unchanged delivery services, actual %+v", applied.DeliveryService)
+	}
+	if len(states.Caches) != 2 || !states.Caches["edge1"].IsAvailable {
+		t.Errorf("expected Apply to not modify the given states, actual %+v", states.Caches)
+	}
+
+	full := CRStatesDelta{Version: 3, Full: true, Caches: map[CacheName]IsAvailable{"edge3": {IsAvailable: true}}}
+	if applied := full.Apply(states); len(applied.Caches) != 1 || len(applied.DeliveryService) != 0 {
+		t.Errorf("expected a full delta to replace the states, actual %+v", applied)
+	}
+}
+
+func TestCRStatesDeltaLegacy(t *testing.T) {
+	bts := []byte(`{"caches":{"edge1":{"isAvailable":true}},"deliveryServices":{"ds1":{"disabledLocations":[],"isAvailable":true}}}`)
+	delta := CRStatesDelta{}
+	if err := json.Unmarshal(bts, &delta); err != nil {
+		t.Fatalf("decoding legacy states: %v", err)
+	}
+	if !delta.IsFull() {
+		t.Error("expected legacy full states to decode as a full delta")
+	}
+	previous := NewCRStates()
+	previous.Caches["edge2"] = IsAvailable{IsAvailable: true}
+	if applied := delta.Apply(previous); len(applied.Caches) != 1 || !applied.Caches["edge1"].IsAvailable || len(applied.DeliveryService) != 1 {
+		t.Errorf("expected legacy states to replace the previous states, actual %+v", applied)
+	}
+}
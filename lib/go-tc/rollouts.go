@@ -0,0 +1,164 @@
+package tc
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc/tovalidate"
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+// RolloutStatus is the status of a Rollout.
+type RolloutStatus string
+
+// These are the valid RolloutStatuses.
+const (
+	// RolloutStatusRunning is a Rollout which is queueing updates to waves
+	// of servers, or waiting for a wave to finish.
+	RolloutStatusRunning = RolloutStatus("running")
+	// RolloutStatusCompleted is a Rollout whose waves have all been updated
+	// without exceeding its failure threshold.
+	RolloutStatusCompleted = RolloutStatus("completed")
+	// RolloutStatusStopped is a Rollout which was stopped by a user before it
+	// completed.
+	RolloutStatusStopped = RolloutStatus("stopped")
+	// RolloutStatusFailed is a Rollout which was stopped automatically,
+	// because more servers failed than its failure threshold.
+	RolloutStatusFailed = RolloutStatus("failed")
+)
+
+// RolloutServerStatus is the status of a server in a Rollout.
+type RolloutServerStatus string
+
+// These are the valid RolloutServerStatuses.
+const (
+	// RolloutServerStatusPending is a server whose wave hasn't started, and
+	// which hasn't had updates queued.
+	RolloutServerStatusPending = RolloutServerStatus("pending")
+	// RolloutServerStatusQueued is a server which has had updates queued, and
+	// hasn't yet cleared its update pending flag.
+	RolloutServerStatusQueued = RolloutServerStatus("queued")
+	// RolloutServerStatusUpdated is a server which cleared its update pending
+	// flag, and wasn't unavailable in Traffic Monitor afterward.
+	RolloutServerStatusUpdated = RolloutServerStatus("updated")
+	// RolloutServerStatusFailed is a server which didn't clear its update
+	// pending flag before its wave timed out, or which was unavailable in
+	// Traffic Monitor after it updated.
+	RolloutServerStatusFailed = RolloutServerStatus("failed")
+)
+
+// DefaultRolloutWaveTimeoutSeconds is the WaveTimeoutSeconds of a
+// RolloutRequest which doesn't have one.
+const DefaultRolloutWaveTimeoutSeconds = 3600
+
+// RolloutsResponse is a list of Rollouts as a response.
+type RolloutsResponse struct {
+	Response []Rollout `json:"response"`
+	Alerts
+}
+
+// RolloutResponse is a single Rollout as a response.
+type RolloutResponse struct {
+	Response Rollout `json:"response"`
+	Alerts
+}
+
+// RolloutRequest encodes the request data for the POST rollouts endpoint.
+//
+// It queues updates to the cache servers of a CDN, optionally limited to a
+// single Cache Group or Topology, in waves. Each wave is WavePercent percent
+// or WaveCount servers of each Cache Group; exactly one must be given.
+type RolloutRequest struct {
+	CDNID        int     `json:"cdnId"`
+	CachegroupID *int    `json:"cachegroupId"`
+	Topology     *string `json:"topology"`
+	WavePercent  *int    `json:"wavePercent"`
+	WaveCount    *int    `json:"waveCount"`
+	// FailureThreshold is the number of servers which may fail before the
+	// Rollout is stopped automatically.
+	FailureThreshold int `json:"failureThreshold"`
+	// WaveTimeoutSeconds is how long servers in a wave have to clear their
+	// update pending flags before they're considered failed. If nil,
+	// DefaultRolloutWaveTimeoutSeconds is used.
+	WaveTimeoutSeconds *int `json:"waveTimeoutSeconds"`
+}
+
+// Rollout is a staged queueing of updates to cache servers, as stored in
+// Traffic Ops.
+type Rollout struct {
+	ID                 int           `json:"id" db:"id"`
+	CDNID              int           `json:"cdnId" db:"cdn_id"`
+	CDN                string        `json:"cdn" db:"cdn"`
+	CachegroupID       *int          `json:"cachegroupId" db:"cachegroup_id"`
+	Cachegroup         *string       `json:"cachegroup" db:"cachegroup"`
+	Topology           *string       `json:"topology" db:"topology"`
+	WavePercent        *int          `json:"wavePercent" db:"wave_percent"`
+	WaveCount          *int          `json:"waveCount" db:"wave_count"`
+	FailureThreshold   int           `json:"failureThreshold" db:"failure_threshold"`
+	WaveTimeoutSeconds int           `json:"waveTimeoutSeconds" db:"wave_timeout_seconds"`
+	Status             RolloutStatus `json:"status" db:"status"`
+	// CurrentWave is the wave being updated, starting at 0.
+	CurrentWave int `json:"currentWave" db:"current_wave"`
+	// Waves is the total number of waves.
+	Waves int `json:"waves" db:"waves"`
+	// WaveStarted is when updates were queued to the current wave.
+	WaveStarted *time.Time `json:"waveStarted" db:"wave_started"`
+	// Message is the reason the Rollout failed, or the last problem which
+	// kept it from progressing, such as Traffic Monitor being unreachable.
+	Message     string          `json:"message" db:"message"`
+	Username    string          `json:"username" db:"username"`
+	Servers     []RolloutServer `json:"servers" db:"servers"`
+	LastUpdated time.Time       `json:"lastUpdated" db:"last_updated"`
+}
+
+// RolloutServer is a cache server in a Rollout.
+type RolloutServer struct {
+	ServerID   int                 `json:"serverId"`
+	HostName   string              `json:"hostName"`
+	Cachegroup string              `json:"cachegroup"`
+	Wave       int                 `json:"wave"`
+	Status     RolloutServerStatus `json:"status"`
+	// Message is the reason the server failed, if it did.
+	Message string `json:"message"`
+}
+
+// Validate validates the RolloutRequest is valid for creation.
+func (r *RolloutRequest) Validate(tx *sql.Tx) error {
+	errs := validation.Errors{
+		"cdnId":              validation.Validate(r.CDNID, validation.Required),
+		"failureThreshold":   validation.Validate(r.FailureThreshold, validation.Min(0)),
+		"wavePercent":        validation.Validate(r.WavePercent, validation.NilOrNotEmpty, validation.Min(1), validation.Max(100)),
+		"waveCount":          validation.Validate(r.WaveCount, validation.NilOrNotEmpty, validation.Min(1)),
+		"waveTimeoutSeconds": validation.Validate(r.WaveTimeoutSeconds, validation.NilOrNotEmpty, validation.Min(1)),
+	}
+	allErrs := tovalidate.ToErrors(errs)
+	if (r.WavePercent == nil) == (r.WaveCount == nil) {
+		allErrs = append(allErrs, errors.New("exactly one of wavePercent or waveCount must be given"))
+	}
+	if r.CachegroupID != nil && r.Topology != nil {
+		allErrs = append(allErrs, errors.New("only one of cachegroupId or topology may be given"))
+	}
+	return util.JoinErrs(allErrs)
+}
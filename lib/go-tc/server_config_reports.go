@@ -0,0 +1,138 @@
+package tc
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc/tovalidate"
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+// ServerConfigReportPackageInstalled and ServerConfigReportPackageRemoved are
+// the valid Actions of a ServerConfigReportPackage.
+const (
+	ServerConfigReportPackageInstalled = "installed"
+	ServerConfigReportPackageRemoved   = "removed"
+)
+
+// ServerConfigReportsResponse is a list of server config reports as a response.
+type ServerConfigReportsResponse struct {
+	Response []ServerConfigReport `json:"response"`
+	Alerts
+}
+
+// ServerConfigReportResponse is a single server config report as a response.
+type ServerConfigReportResponse struct {
+	Response ServerConfigReport `json:"response"`
+	Alerts
+}
+
+// ServerConfigReportRequest encodes the request data for the POST
+// server_config_reports endpoint. It is the report of a single run of
+// t3c-apply on the cache server with the given HostName.
+type ServerConfigReportRequest struct {
+	HostName   string                      `json:"hostName"`
+	Mode       string                      `json:"mode"`
+	Success    bool                        `json:"success"`
+	StartTime  time.Time                   `json:"startTime"`
+	DurationMS int64                       `json:"durationMs"`
+	Reloaded   bool                        `json:"reloaded"`
+	Restarted  bool                        `json:"restarted"`
+	Files      []ServerConfigReportFile    `json:"files"`
+	Packages   []ServerConfigReportPackage `json:"packages"`
+	Warnings   []string                    `json:"warnings"`
+	Errors     []string                    `json:"errors"`
+}
+
+// ServerConfigReport is the report of a single run of t3c-apply on a cache
+// server, as stored in Traffic Ops.
+type ServerConfigReport struct {
+	ID          int                         `json:"id" db:"id"`
+	ServerID    int                         `json:"serverId" db:"server_id"`
+	HostName    string                      `json:"hostName" db:"host_name"`
+	Cachegroup  string                      `json:"cachegroup" db:"cachegroup"`
+	CDN         string                      `json:"cdn" db:"cdn"`
+	Mode        string                      `json:"mode" db:"mode"`
+	Success     bool                        `json:"success" db:"success"`
+	StartTime   time.Time                   `json:"startTime" db:"start_time"`
+	DurationMS  int64                       `json:"durationMs" db:"duration_ms"`
+	Reloaded    bool                        `json:"reloaded" db:"reloaded"`
+	Restarted   bool                        `json:"restarted" db:"restarted"`
+	Files       []ServerConfigReportFile    `json:"files" db:"files"`
+	Packages    []ServerConfigReportPackage `json:"packages" db:"packages"`
+	Warnings    []string                    `json:"warnings" db:"warnings"`
+	Errors      []string                    `json:"errors" db:"errors"`
+	LastUpdated time.Time                   `json:"lastUpdated" db:"last_updated"`
+}
+
+// ServerConfigReportFile is a config file which was changed, or would have
+// been changed in report mode, by a run of t3c-apply.
+type ServerConfigReportFile struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Applied is whether the change was written to disk. It is false in
+	// report mode, or if the change was skipped, in which case the file on
+	// disk still differs from Traffic Ops.
+	Applied bool `json:"applied"`
+	// Diff is the start of the difference between the old and new file. Long
+	// diffs are truncated by t3c-apply.
+	Diff string `json:"diff"`
+}
+
+// ServerConfigReportPackage is a package which was installed or removed by a
+// run of t3c-apply.
+type ServerConfigReportPackage struct {
+	// Name is the full package name, including the version, as given to or
+	// returned by the package manager.
+	Name string `json:"name"`
+	// Action is one of ServerConfigReportPackageInstalled or
+	// ServerConfigReportPackageRemoved.
+	Action string `json:"action"`
+}
+
+// Validate validates the ServerConfigReportRequest is valid for creation.
+func (r *ServerConfigReportRequest) Validate(tx *sql.Tx) error {
+	errs := validation.Errors{
+		"hostName":   validation.Validate(r.HostName, validation.Required),
+		"mode":       validation.Validate(r.Mode, validation.Required),
+		"startTime":  validation.Validate(r.StartTime, validation.Required),
+		"durationMs": validation.Validate(r.DurationMS, validation.Min(int64(0))),
+	}
+	allErrs := tovalidate.ToErrors(errs)
+	for _, file := range r.Files {
+		if file.Name == "" {
+			allErrs = append(allErrs, errors.New("files: name cannot be blank"))
+		}
+	}
+	for _, pkg := range r.Packages {
+		if pkg.Name == "" {
+			allErrs = append(allErrs, errors.New("packages: name cannot be blank"))
+		}
+		if pkg.Action != ServerConfigReportPackageInstalled && pkg.Action != ServerConfigReportPackageRemoved {
+			allErrs = append(allErrs, errors.New("packages: action must be '"+ServerConfigReportPackageInstalled+"' or '"+ServerConfigReportPackageRemoved+"'"))
+		}
+	}
+	return util.JoinErrs(allErrs)
+}
@@ -0,0 +1,72 @@
+// Package atscfgtest contains test data for tests of packages which generate config from go-atscfg objects.
+// It's separate from testutil, so the tests of go-atscfg itself may use testutil.
+package atscfgtest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/url"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+)
+
+// MakeServer returns a server with the given host name and type, and ports 80 and 443.
+func MakeServer(hostName string, serverType string) *atscfg.Server {
+	sv := &atscfg.Server{}
+	sv.HostName = util.StrPtr(hostName)
+	sv.Type = serverType
+	sv.TCPPort = util.IntPtr(80)
+	sv.HTTPSPort = util.IntPtr(443)
+	return sv
+}
+
+// MakeCacheDS returns a Delivery Service named name, of the given type and protocol, with the given origin URL,
+// requested as edge.name.cdndomain.example. It panics if the origin isn't a valid URL.
+func MakeCacheDS(name string, dsType tc.DSType, protocol int, origin string) atscfg.CacheDS {
+	ds := atscfg.DeliveryService{}
+	ds.XMLID = util.StrPtr(name)
+	ds.Type = &dsType
+	ds.Protocol = util.IntPtr(protocol)
+	ds.Topology = util.StrPtr("")
+	ds.QStringIgnore = util.IntPtr(int(tc.QueryStringIgnoreUseInCacheKeyAndPassUp))
+	ds.ExampleURLs = []string{"https://" + name + ".cdndomain.example"}
+	orgURI, err := url.Parse(origin)
+	if err != nil {
+		panic("malformed test origin: " + err.Error())
+	}
+	return atscfg.CacheDS{
+		DS:           ds,
+		RequestFQDNs: []string{"edge." + name + ".cdndomain.example"},
+		HTTP:         protocol != tc.DSProtocolHTTPS,
+		HTTPS:        protocol != tc.DSProtocolHTTP,
+		Origin:       orgURI,
+	}
+}
+
+// MakeParents returns parents of the given hosts, on port 80.
+func MakeParents(hosts ...string) []atscfg.TopologyParent {
+	parents := []atscfg.TopologyParent{}
+	for _, host := range hosts {
+		parents = append(parents, atscfg.TopologyParent{Host: host, Port: "80", Weight: "0.999"})
+	}
+	return parents
+}
@@ -0,0 +1,50 @@
+// Package testutil contains helpers for tests of the lib packages.
+package testutil
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata with the generated config files")
+
+// Golden tests that the generated config text is the golden file testdata/name.
+// If the -update flag is given, the golden file is written instead.
+func Golden(t *testing.T, name string, txt string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := ioutil.WriteFile(path, []byte(txt), 0644); err != nil {
+			t.Fatalf("writing golden file '%v': %v", path, err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file '%v' (run tests with -update to create it): %v", path, err)
+	}
+	if txt != string(expected) {
+		t.Errorf("expected golden file '%v':\n%v\nactual:\n%v", path, string(expected), txt)
+	}
+}
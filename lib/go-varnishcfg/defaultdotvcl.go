@@ -0,0 +1,376 @@
+// Package varnishcfg generates Varnish config from Traffic Ops data.
+//
+// It serves the same Delivery Services, with the same parents, as the Apache Traffic Server config generated by
+// lib/go-atscfg, so Varnish caches can be used on the same CDN. Delivery Service features Varnish config doesn't support
+// are ignored with a warning; see SupportedFeatures.
+package varnishcfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// VCLFileName is the name of the generated VCL file, which is loaded by varnishd by default.
+// The VCL requires Varnish 6.4 or later.
+const VCLFileName = "default.vcl"
+const ContentTypeVCL = atscfg.ContentTypeTextASCII
+const LineCommentVCL = atscfg.LineCommentHash
+
+// SoftwareName is the name of the cache software, used in warnings.
+const SoftwareName = "varnish"
+
+// IgnoreQStringHeader is the internal request header which makes vcl_hash omit the query string from the cache key.
+// It's removed before requests are sent to parents or origins.
+const IgnoreQStringHeader = "X-TC-Ignore-QString"
+
+// SupportedFeatures is the Delivery Service features Varnish config supports.
+// Delivery Services using other features are still served, without them, and a warning is given.
+//
+// Varnish doesn't support TLS, so HTTPS must be terminated in front of it, for example by hitch, and Delivery Services
+// whose parents or origin must be requested over HTTPS can't be served.
+var SupportedFeatures = map[atscfg.CacheDSFeature]struct{}{
+	atscfg.CacheDSFeatureParents:              {},
+	atscfg.CacheDSFeatureSecondaryParents:     {},
+	atscfg.CacheDSFeatureGoDirect:             {},
+	atscfg.CacheDSFeatureQStringIgnore:        {},
+	atscfg.CacheDSFeatureQStringDrop:          {},
+	atscfg.CacheDSFeatureMaxOriginConnections: {},
+}
+
+// VCLOpts contains settings to configure Varnish config generation options.
+type VCLOpts struct {
+	// HdrComment is the header comment to include at the beginning of the file.
+	// This should be the text desired, without comment syntax (like # or //). The file's comment syntax will be added.
+	// To omit the header comment, pass the empty string.
+	HdrComment string
+}
+
+// vclDS is a Delivery Service the VCL serves, with the names of its backends and directors.
+type vclDS struct {
+	CDS   atscfg.CacheDS
+	Hosts []string
+	// Backends is the VCL of the Delivery Service's backends.
+	Backends string
+	// Init is the vcl_init VCL creating the Delivery Service's directors.
+	Init string
+	// Recv is the vcl_recv VCL routing a request to the Delivery Service.
+	Recv string
+}
+
+// MakeDefaultDotVCL creates the Varnish VCL file, with backends and directors for each of the Delivery Services'
+// parents, and vcl_recv routing requests to them by host.
+// The cacheDSes should be created by atscfg.MakeCacheDSes for the server.
+//
+// Backends aren't health checked, so secondary parents and origins are only used if Varnish is told the primary
+// parents are sick, for example with varnishadm backend.set_health. Backend hosts must resolve to a single address.
+func MakeDefaultDotVCL(
+	server *atscfg.Server,
+	cacheDSes []atscfg.CacheDS,
+	opt VCLOpts,
+) (atscfg.Cfg, error) {
+	warnings := []string{}
+	if server.HostName == nil {
+		return atscfg.Cfg{}, errors.New("server HostName missing")
+	}
+
+	vclDSes := []vclDS{}
+	usedFQDNs := map[string]string{} // map[fqdn]dsName
+	usedNames := map[string]string{} // map[vclName]dsName
+	for _, cds := range cacheDSes {
+		dsName := *cds.DS.XMLID
+		warnings = append(warnings, cds.UnsupportedFeatureWarnings(SoftwareName, SupportedFeatures)...)
+		if *cds.DS.Type == tc.DSTypeAnyMap {
+			continue
+		}
+		if !cds.HTTP {
+			warnings = append(warnings, "ds '"+dsName+"' is only HTTPS, which varnish can't serve, skipping!")
+			continue
+		}
+
+		hosts := []string{}
+		for _, fqdn := range cds.RequestFQDNs {
+			fqdn = strings.ToLower(fqdn)
+			if usedBy, ok := usedFQDNs[fqdn]; ok {
+				if usedBy != dsName {
+					warnings = append(warnings, "ds '"+dsName+"' request host '"+fqdn+"' is already served by ds '"+usedBy+"', skipping the host!")
+				}
+				continue
+			}
+			usedFQDNs[fqdn] = dsName
+			hosts = append(hosts, fqdn)
+		}
+		if len(hosts) == 0 {
+			continue
+		}
+
+		vds, vdsWarns, err := makeVCLDS(cds, hosts, uniqueVCLName(dsName, usedNames))
+		warnings = append(warnings, vdsWarns...)
+		if err != nil {
+			warnings = append(warnings, "ds '"+dsName+"' "+err.Error()+", skipping!")
+			continue
+		}
+		vclDSes = append(vclDSes, vds)
+	}
+
+	txt := ""
+	if opt.HdrComment != "" {
+		txt += LineCommentVCL + " " + opt.HdrComment + "\n"
+	}
+	txt += "vcl 4.1;\n"
+	txt += "\n"
+	txt += "import directors;\n"
+	txt += "import std;\n"
+	txt += "\n"
+	txt += "backend default none;\n"
+	for _, vds := range vclDSes {
+		txt += "\n" + LineCommentVCL + " ds '" + *vds.CDS.DS.XMLID + "'"
+		if *vds.CDS.DS.Topology != "" {
+			txt += " topology '" + *vds.CDS.DS.Topology + "'"
+		}
+		txt += "\n"
+		txt += vds.Backends
+	}
+
+	txt += "\nsub vcl_init {\n"
+	for _, vds := range vclDSes {
+		txt += vds.Init
+	}
+	txt += "}\n"
+
+	txt += "\nsub vcl_recv {\n"
+	txt += "\tset req.http.host = std.tolower(regsub(req.http.host, \":[0-9]+$\", \"\"));\n"
+	txt += "\tunset req.http." + IgnoreQStringHeader + ";\n"
+	for i, vds := range vclDSes {
+		conds := []string{}
+		for _, host := range vds.Hosts {
+			conds = append(conds, `req.http.host == "`+host+`"`)
+		}
+		if i == 0 {
+			txt += "\tif ("
+		} else {
+			txt += " elsif ("
+		}
+		txt += strings.Join(conds, " || ") + ") {\n"
+		txt += vds.Recv
+		txt += "\t}"
+	}
+	if len(vclDSes) == 0 {
+		txt += "\treturn (synth(404));\n"
+	} else {
+		txt += " else {\n"
+		txt += "\t\t# requests for hosts without a Delivery Service are not found, like ATS remap_required\n"
+		txt += "\t\treturn (synth(404));\n"
+		txt += "\t}\n"
+	}
+	txt += "}\n"
+
+	txt += "\nsub vcl_hash {\n"
+	txt += "\tif (req.http." + IgnoreQStringHeader + ") {\n"
+	txt += "\t\thash_data(regsub(req.url, \"\\?.*$\", \"\"));\n"
+	txt += "\t\thash_data(req.http.host);\n"
+	txt += "\t\treturn (lookup);\n"
+	txt += "\t}\n"
+	txt += "}\n"
+
+	txt += "\nsub vcl_backend_fetch {\n"
+	txt += "\tunset bereq.http." + IgnoreQStringHeader + ";\n"
+	txt += "}\n"
+
+	return atscfg.Cfg{
+		Text:        txt,
+		ContentType: ContentTypeVCL,
+		LineComment: LineCommentVCL,
+		Warnings:    warnings,
+	}, nil
+}
+
+// makeVCLDS returns the VCL of the Delivery Service, any warnings, and any error which prevents it being served.
+//
+// The Delivery Service's primary parents, secondary parents, and origin each become a director, or a backend for the
+// origin, and requests go to the first of them which is healthy.
+func makeVCLDS(cds atscfg.CacheDS, hosts []string, name string) (vclDS, []string, error) {
+	warnings := []string{}
+	ds := cds.DS
+	dsName := *ds.XMLID
+	parents := cds.Parents
+
+	goDirect := len(parents.Parents) == 0 || parents.GoDirect
+	if len(parents.Parents) > 0 && parents.Scheme == "https" {
+		return vclDS{}, warnings, errors.New("requests its parents over HTTPS, which varnish can't")
+	}
+	if goDirect && cds.Origin.Scheme == "https" {
+		if len(parents.Parents) == 0 {
+			return vclDS{}, warnings, errors.New("requests its origin over HTTPS, which varnish can't")
+		}
+		warnings = append(warnings, "ds '"+dsName+"' goes directly to the origin if its parents fail, but the origin is HTTPS, which varnish can't request, ignoring!")
+		goDirect = false
+	}
+
+	maxConns := 0
+	if ds.MaxOriginConnections != nil && *ds.MaxOriginConnections > 0 {
+		maxConns = *ds.MaxOriginConnections
+	}
+	parentMaxConns := 0
+	if !parents.ParentIsProxy {
+		parentMaxConns = maxConns // the parents are origins
+	}
+
+	hashKey := ""
+	if parents.Policy == atscfg.StrategyPolicyConsistentHash {
+		hashKey = "req.url"
+		if parents.HashKey != "path+query" {
+			hashKey = `regsub(req.url, "\?.*$", "")`
+		}
+	}
+
+	backends := ""
+	init := ""
+	hints := []string{} // the backends to use, in order, if the previous is sick
+	if len(parents.Parents) > 0 {
+		directorName := name + "_parents"
+		backends += makeBackends(directorName, parents.Parents, parentMaxConns)
+		init += makeDirector(directorName, parents.Policy, parents.Parents)
+		hints = append(hints, directorName+".backend("+hashKey+")")
+	}
+	if len(parents.SecondaryParents) > 0 {
+		directorName := name + "_secondary_parents"
+		backends += makeBackends(directorName, parents.SecondaryParents, parentMaxConns)
+		init += makeDirector(directorName, parents.Policy, parents.SecondaryParents)
+		hints = append(hints, directorName+".backend("+hashKey+")")
+	}
+	if goDirect {
+		backendName := name + "_origin"
+		backends += makeBackend(backendName, cds.Origin.Hostname(), cds.Origin.Port(), maxConns)
+		hints = append(hints, backendName)
+	}
+
+	recv := ""
+	for i, hint := range hints {
+		if i == 0 {
+			recv += "\t\tset req.backend_hint = " + hint + ";\n"
+			continue
+		}
+		recv += "\t\tif (!std.healthy(req.backend_hint)) {\n"
+		recv += "\t\t\tset req.backend_hint = " + hint + ";\n"
+		recv += "\t\t}\n"
+	}
+
+	originHost := cds.Origin.Hostname()
+	if port := cds.Origin.Port(); port != "" && port != "80" {
+		originHost += ":" + port
+	}
+	recv += "\t\tset req.http.host = \"" + originHost + "\";\n"
+	if ds.QStringIgnore != nil {
+		switch *ds.QStringIgnore {
+		case tc.QueryStringIgnoreIgnoreInCacheKeyAndPassUp:
+			recv += "\t\tset req.http." + IgnoreQStringHeader + " = \"1\";\n"
+		case tc.QueryStringIgnoreDropAtEdge:
+			recv += "\t\tset req.url = regsub(req.url, \"\\?.*$\", \"\");\n"
+		}
+	}
+
+	return vclDS{
+		CDS:      cds,
+		Hosts:    hosts,
+		Backends: backends,
+		Init:     init,
+		Recv:     recv,
+	}, warnings, nil
+}
+
+// makeBackends returns the VCL backends of the parents, named by prefix and their index.
+func makeBackends(prefix string, parents []atscfg.TopologyParent, maxConns int) string {
+	txt := ""
+	for i, parent := range parents {
+		txt += makeBackend(prefix+"_"+strconv.Itoa(i), parent.Host, parent.Port, maxConns)
+	}
+	return txt
+}
+
+// makeBackend returns the VCL backend of the given host and port, which may be empty.
+// If maxConns is 0, the backend's connections aren't limited.
+func makeBackend(name string, host string, port string, maxConns int) string {
+	txt := "backend " + name + " {\n"
+	txt += "\t.host = \"" + host + "\";\n"
+	if port != "" {
+		txt += "\t.port = \"" + port + "\";\n"
+	}
+	if maxConns > 0 {
+		txt += "\t.max_connections = " + strconv.Itoa(maxConns) + ";\n"
+	}
+	txt += "}\n"
+	return txt
+}
+
+// makeDirector returns the vcl_init VCL creating the director of the parents, which must have backends created by
+// makeBackends with the director's name.
+func makeDirector(name string, policy string, parents []atscfg.TopologyParent) string {
+	txt := ""
+	switch policy {
+	case atscfg.StrategyPolicyConsistentHash:
+		txt += "\tnew " + name + " = directors.hash();\n"
+		for i, parent := range parents {
+			weight := parent.Weight
+			if _, err := strconv.ParseFloat(weight, 64); err != nil {
+				weight = "1.0"
+			}
+			txt += "\t" + name + ".add_backend(" + name + "_" + strconv.Itoa(i) + ", " + weight + ");\n"
+		}
+		return txt
+	case atscfg.StrategyPolicyFirstLive, atscfg.StrategyPolicyLatched:
+		txt += "\tnew " + name + " = directors.fallback();\n"
+	default:
+		txt += "\tnew " + name + " = directors.round_robin();\n"
+	}
+	for i := range parents {
+		txt += "\t" + name + ".add_backend(" + name + "_" + strconv.Itoa(i) + ");\n"
+	}
+	return txt
+}
+
+var vclNameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// VCLName returns the prefix of the VCL backend and director names of the given Delivery Service.
+// Different Delivery Service names may have the same VCLName, for example 'ds-1' and 'ds_1'.
+func VCLName(dsName string) string {
+	return "ds_" + vclNameInvalidChars.ReplaceAllString(dsName, "_")
+}
+
+// uniqueVCLName returns the VCLName of the Delivery Service, with a number appended if it's already used by another
+// Delivery Service, and adds it to usedNames.
+func uniqueVCLName(dsName string, usedNames map[string]string) string {
+	name := VCLName(dsName)
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := usedNames[unique]; !ok {
+			break
+		}
+		unique = name + "_" + strconv.Itoa(i)
+	}
+	usedNames[unique] = dsName
+	return unique
+}
@@ -0,0 +1,141 @@
+package varnishcfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-testutil"
+	"github.com/apache/trafficcontrol/lib/go-testutil/atscfgtest"
+	"github.com/apache/trafficcontrol/lib/go-util"
+)
+
+func TestMakeDefaultDotVCLEdge(t *testing.T) {
+	opts := VCLOpts{HdrComment: "myHeaderComment"}
+
+	// consistent hash parents with secondaries, HTTP to HTTPS, query string ignored in the cache key
+	ds0 := atscfgtest.MakeCacheDS("ds0", tc.DSTypeHTTP, tc.DSProtocolHTTPToHTTPS, "http://ds0.example.net")
+	ds0.DS.QStringIgnore = util.IntPtr(int(tc.QueryStringIgnoreIgnoreInCacheKeyAndPassUp))
+	ds0.RequestFQDNs = append(ds0.RequestFQDNs, "ds0.cdndomain.example")
+	ds0.Parents = atscfg.CacheDSParents{
+		Parents:          atscfgtest.MakeParents("mymid0.example.net", "mymid1.example.net"),
+		SecondaryParents: atscfgtest.MakeParents("mymid2.example.net"),
+		Scheme:           "http",
+		Policy:           atscfg.StrategyPolicyConsistentHash,
+		HashKey:          "path",
+		ParentIsProxy:    true,
+	}
+
+	// round robin topology parents, going directly to the origin, max origin connections
+	ds1 := atscfgtest.MakeCacheDS("ds-1", tc.DSTypeDNS, tc.DSProtocolHTTP, "http://ds1.example.net:8080")
+	ds1.DS.Topology = util.StrPtr("t0")
+	ds1.DS.MaxOriginConnections = util.IntPtr(100)
+	ds1.Parents = atscfg.CacheDSParents{
+		Parents:       atscfgtest.MakeParents("mymid0.example.net", "mymid1.example.net"),
+		Scheme:        "http",
+		Policy:        atscfg.StrategyPolicyRoundRobinStrict,
+		GoDirect:      true,
+		ParentIsProxy: true,
+	}
+
+	// live local, directly to the origin, query string dropped, header rewrite
+	ds2 := atscfgtest.MakeCacheDS("ds2", tc.DSTypeHTTPLive, tc.DSProtocolHTTP, "http://ds2.example.net")
+	ds2.DS.QStringIgnore = util.IntPtr(int(tc.QueryStringIgnoreDropAtEdge))
+	ds2.DS.EdgeHeaderRewrite = util.StrPtr("set-header X-Foo foo")
+
+	// HTTPS only, which varnish can't serve
+	ds3 := atscfgtest.MakeCacheDS("ds3", tc.DSTypeHTTP, tc.DSProtocolHTTPS, "http://ds3.example.net")
+
+	// HTTPS origin, which varnish can't request
+	ds4 := atscfgtest.MakeCacheDS("ds4", tc.DSTypeHTTP, tc.DSProtocolHTTP, "https://ds4.example.net:443")
+
+	// any map, which only ATS can serve
+	ds5 := atscfgtest.MakeCacheDS("ds5", tc.DSTypeAnyMap, tc.DSProtocolHTTP, "")
+	ds5 = atscfg.CacheDS{DS: ds5.DS}
+
+	cfg, err := MakeDefaultDotVCL(atscfgtest.MakeServer("myedge", "EDGE"), []atscfg.CacheDS{ds0, ds1, ds2, ds3, ds4, ds5}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedWarnings := []string{
+		"ds 'ds0' uses HTTPS, which varnish config doesn't support, ignoring!",
+		"ds 'ds0' uses HTTP to HTTPS redirect, which varnish config doesn't support, ignoring!",
+		"ds 'ds2' uses header rewrite, which varnish config doesn't support, ignoring!",
+		"ds 'ds3' uses HTTPS, which varnish config doesn't support, ignoring!",
+		"ds 'ds3' is only HTTPS, which varnish can't serve, skipping!",
+		"ds 'ds4' uses HTTPS origin, which varnish config doesn't support, ignoring!",
+		"ds 'ds4' requests its origin over HTTPS, which varnish can't, skipping!",
+		"ds 'ds5' uses ANY_MAP remap text, which varnish config doesn't support, ignoring!",
+	}
+	if !reflect.DeepEqual(expectedWarnings, cfg.Warnings) {
+		t.Errorf("expected warnings %+v, actual %+v", expectedWarnings, cfg.Warnings)
+	}
+	testutil.Golden(t, "default_edge.vcl", cfg.Text)
+}
+
+func TestMakeDefaultDotVCLMid(t *testing.T) {
+	opts := VCLOpts{HdrComment: "myHeaderComment"}
+
+	// first live parents, which are origins
+	ds0 := atscfgtest.MakeCacheDS("ds0", tc.DSTypeHTTP, tc.DSProtocolHTTP, "http://ds0.example.net")
+	ds0.RequestFQDNs = []string{"ds0.example.net"}
+	ds0.DS.MaxOriginConnections = util.IntPtr(50)
+	ds0.Parents = atscfg.CacheDSParents{
+		Parents: []atscfg.TopologyParent{{Host: "origin0.example.net", Port: "80"}, {Host: "origin1.example.net", Port: "80"}},
+		Scheme:  "http",
+		Policy:  atscfg.StrategyPolicyFirstLive,
+	}
+
+	// the same origin host as ds0
+	ds1 := atscfgtest.MakeCacheDS("ds1", tc.DSTypeHTTP, tc.DSProtocolHTTP, "http://ds0.example.net")
+	ds1.RequestFQDNs = []string{"ds0.example.net"}
+
+	cfg, err := MakeDefaultDotVCL(atscfgtest.MakeServer("mymid", "MID"), []atscfg.CacheDS{ds0, ds1}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedWarnings := []string{
+		"ds 'ds1' request host 'ds0.example.net' is already served by ds 'ds0', skipping the host!",
+	}
+	if !reflect.DeepEqual(expectedWarnings, cfg.Warnings) {
+		t.Errorf("expected warnings %+v, actual %+v", expectedWarnings, cfg.Warnings)
+	}
+	testutil.Golden(t, "default_mid.vcl", cfg.Text)
+}
+
+func TestMakeDefaultDotVCLNameCollision(t *testing.T) {
+	ds0 := atscfgtest.MakeCacheDS("ds-1", tc.DSTypeHTTP, tc.DSProtocolHTTP, "http://ds0.example.net")
+	ds1 := atscfgtest.MakeCacheDS("ds_1", tc.DSTypeHTTP, tc.DSProtocolHTTP, "http://ds1.example.net")
+	ds2 := atscfgtest.MakeCacheDS("ds.1", tc.DSTypeHTTP, tc.DSProtocolHTTP, "http://ds2.example.net")
+
+	cfg, err := MakeDefaultDotVCL(atscfgtest.MakeServer("myedge", "EDGE"), []atscfg.CacheDS{ds0, ds1, ds2}, VCLOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ds_ds_1_origin", "ds_ds_1_2_origin", "ds_ds_1_3_origin"} {
+		if count := strings.Count(cfg.Text, "backend "+name+" {"); count != 1 {
+			t.Errorf("expected 1 backend '%v', actual %v in:\n%v", name, count, cfg.Text)
+		}
+	}
+}
@@ -157,6 +157,7 @@ type Filter interface {
 	UseInterfaceStat(string) bool
 	UseStat(string) bool
 	WithinStatHistoryMax(uint64) bool
+	WithinTimeRange(time.Time) bool
 }
 
 const nsPerMs = 1000000
@@ -97,37 +97,44 @@ func (t *PollingProtocol) UnmarshalJSON(b []byte) error {
 
 // Config is the configuration for the application. It includes myriad data, such as polling intervals and log locations.
 type Config struct {
-	CacheHealthPollingInterval   time.Duration   `json:"-"`
-	CacheStatPollingInterval     time.Duration   `json:"-"`
-	MonitorConfigPollingInterval time.Duration   `json:"-"`
-	HTTPTimeout                  time.Duration   `json:"-"`
-	PeerPollingInterval          time.Duration   `json:"-"`
-	PeerOptimistic               bool            `json:"peer_optimistic"`
-	PeerOptimisticQuorumMin      int             `json:"peer_optimistic_quorum_min"`
-	MaxEvents                    uint64          `json:"max_events"`
-	MaxStatHistory               uint64          `json:"max_stat_history"`
-	MaxHealthHistory             uint64          `json:"max_health_history"`
-	HealthFlushInterval          time.Duration   `json:"-"`
-	StatFlushInterval            time.Duration   `json:"-"`
-	StatBufferInterval           time.Duration   `json:"-"`
-	LogLocationError             string          `json:"log_location_error"`
-	LogLocationWarning           string          `json:"log_location_warning"`
-	LogLocationInfo              string          `json:"log_location_info"`
-	LogLocationDebug             string          `json:"log_location_debug"`
-	LogLocationEvent             string          `json:"log_location_event"`
-	ServeReadTimeout             time.Duration   `json:"-"`
-	ServeWriteTimeout            time.Duration   `json:"-"`
-	HealthToStatRatio            uint64          `json:"health_to_stat_ratio"`
-	StaticFileDir                string          `json:"static_file_dir"`
-	CRConfigHistoryCount         uint64          `json:"crconfig_history_count"`
-	TrafficOpsMinRetryInterval   time.Duration   `json:"-"`
-	TrafficOpsMaxRetryInterval   time.Duration   `json:"-"`
-	CRConfigBackupFile           string          `json:"crconfig_backup_file"`
-	TMConfigBackupFile           string          `json:"tmconfig_backup_file"`
-	TrafficOpsDiskRetryMax       uint64          `json:"-"`
-	CachePollingProtocol         PollingProtocol `json:"cache_polling_protocol"`
-	PeerPollingProtocol          PollingProtocol `json:"peer_polling_protocol"`
-	HTTPPollingFormat            string          `json:"http_polling_format"`
+	CacheHealthPollingInterval   time.Duration      `json:"-"`
+	CacheStatPollingInterval     time.Duration      `json:"-"`
+	MonitorConfigPollingInterval time.Duration      `json:"-"`
+	HTTPTimeout                  time.Duration      `json:"-"`
+	PeerPollingInterval          time.Duration      `json:"-"`
+	PeerOptimistic               bool               `json:"peer_optimistic"`
+	PeerOptimisticQuorumMin      int                `json:"peer_optimistic_quorum_min"`
+	MaxEvents                    uint64             `json:"max_events"`
+	MaxStatHistory               uint64             `json:"max_stat_history"`
+	MaxHealthHistory             uint64             `json:"max_health_history"`
+	HealthFlushInterval          time.Duration      `json:"-"`
+	StatFlushInterval            time.Duration      `json:"-"`
+	StatBufferInterval           time.Duration      `json:"-"`
+	LogLocationError             string             `json:"log_location_error"`
+	LogLocationWarning           string             `json:"log_location_warning"`
+	LogLocationInfo              string             `json:"log_location_info"`
+	LogLocationDebug             string             `json:"log_location_debug"`
+	LogLocationEvent             string             `json:"log_location_event"`
+	ServeReadTimeout             time.Duration      `json:"-"`
+	ServeWriteTimeout            time.Duration      `json:"-"`
+	HealthToStatRatio            uint64             `json:"health_to_stat_ratio"`
+	StaticFileDir                string             `json:"static_file_dir"`
+	CRConfigHistoryCount         uint64             `json:"crconfig_history_count"`
+	TrafficOpsMinRetryInterval   time.Duration      `json:"-"`
+	TrafficOpsMaxRetryInterval   time.Duration      `json:"-"`
+	CRConfigBackupFile           string             `json:"crconfig_backup_file"`
+	TMConfigBackupFile           string             `json:"tmconfig_backup_file"`
+	TrafficOpsDiskRetryMax       uint64             `json:"-"`
+	CachePollingProtocol         PollingProtocol    `json:"cache_polling_protocol"`
+	PeerPollingProtocol          PollingProtocol    `json:"peer_polling_protocol"`
+	HTTPPollingFormat            string             `json:"http_polling_format"`
+	StatHistoryDir               string             `json:"stat_history_dir"`
+	StatHistoryMaxAge            time.Duration      `json:"-"`
+	StatHistoryMaxBytes          uint64             `json:"stat_history_max_bytes"`
+	Notifications                NotificationConfig `json:"notifications"`
+	HealthRecordFile             string             `json:"health_record_file"`
+	CRStatesMaxWait              time.Duration      `json:"-"`
+	SLAHistoryFile               string             `json:"sla_history_file"`
 }
 
 func (c Config) ErrorLog() log.LogLocation   { return log.LogLocation(c.LogLocationError) }
@@ -169,6 +176,12 @@ var DefaultConfig = Config{
 	CachePollingProtocol:         Both,
 	PeerPollingProtocol:          Both,
 	HTTPPollingFormat:            HTTPPollingFormat,
+	StatHistoryDir:               "",
+	StatHistoryMaxAge:            24 * time.Hour,
+	StatHistoryMaxBytes:          1024 * 1024 * 1024,
+	HealthRecordFile:             "",
+	CRStatesMaxWait:              5 * time.Second,
+	SLAHistoryFile:               "",
 }
 
 // MarshalJSON marshals custom millisecond durations. Aliasing inspired by http://choly.ca/post/go-json-marshalling/
@@ -188,6 +201,8 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 		StatBufferIntervalMs           uint64 `json:"stat_buffer_interval_ms"`
 		ServeReadTimeoutMs             uint64 `json:"serve_read_timeout_ms"`
 		ServeWriteTimeoutMs            uint64 `json:"serve_write_timeout_ms"`
+		StatHistoryMaxAgeMs            uint64 `json:"stat_history_max_age_ms"`
+		CRStatesMaxWaitMs              uint64 `json:"crstates_max_wait_ms"`
 		*Alias
 	}{
 		CacheHealthPollingIntervalMs:   uint64(c.CacheHealthPollingInterval / time.Millisecond),
@@ -200,6 +215,8 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 		HealthFlushIntervalMs:          uint64(c.HealthFlushInterval / time.Millisecond),
 		StatFlushIntervalMs:            uint64(c.StatFlushInterval / time.Millisecond),
 		StatBufferIntervalMs:           uint64(c.StatBufferInterval / time.Millisecond),
+		StatHistoryMaxAgeMs:            uint64(c.StatHistoryMaxAge / time.Millisecond),
+		CRStatesMaxWaitMs:              uint64(c.CRStatesMaxWait / time.Millisecond),
 		Alias:                          (*Alias)(c),
 	})
 }
@@ -226,6 +243,8 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		CRConfigBackupFile             *string `json:"crconfig_backup_file"`
 		TMConfigBackupFile             *string `json:"tmconfig_backup_file"`
 		HTTPPollingFormat              *string `json:"http_polling_format"`
+		StatHistoryMaxAgeMs            *uint64 `json:"stat_history_max_age_ms"`
+		CRStatesMaxWaitMs              *uint64 `json:"crstates_max_wait_ms"`
 		*Alias
 	}{
 		Alias: (*Alias)(c),
@@ -289,6 +308,12 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	if aux.HTTPPollingFormat != nil {
 		c.HTTPPollingFormat = *aux.HTTPPollingFormat
 	}
+	if aux.StatHistoryMaxAgeMs != nil {
+		c.StatHistoryMaxAge = time.Duration(*aux.StatHistoryMaxAgeMs) * time.Millisecond
+	}
+	if aux.CRStatesMaxWaitMs != nil {
+		c.CRStatesMaxWait = time.Duration(*aux.CRStatesMaxWaitMs) * time.Millisecond
+	}
 	return nil
 }
 
@@ -0,0 +1,125 @@
+package config
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"time"
+)
+
+const (
+	// NotifierTypeWebhook is a notifier which POSTs JSON to an arbitrary URL.
+	NotifierTypeWebhook = "webhook"
+	// NotifierTypeAlertmanager is a notifier which pushes alerts to the
+	// Prometheus Alertmanager v2 API.
+	NotifierTypeAlertmanager = "alertmanager"
+	// NotifierTypeSMTP is a notifier which sends email through an SMTP relay.
+	NotifierTypeSMTP = "smtp"
+)
+
+// DefaultNotificationGroupWait is the default time events are collected
+// before they're sent as a single notification.
+const DefaultNotificationGroupWait = 30 * time.Second
+
+// DefaultNotificationDedupWindow is the default time within which an alert
+// which is still firing is not notified again.
+const DefaultNotificationDedupWindow = time.Hour
+
+// DefaultNotifierTimeout is the default timeout of a single notifier request.
+const DefaultNotifierTimeout = 10 * time.Second
+
+// NotificationConfig is the configuration of the alert notifications sent for
+// health events. If there are no Routes, no notifications are sent.
+type NotificationConfig struct {
+	// GroupWaitMs is how long events are collected before they're sent as a
+	// single notification. Routes may override it.
+	GroupWaitMs *uint64 `json:"group_wait_ms"`
+	// DedupWindowMs is how long an alert which is still firing is not notified
+	// again. After the window, a reminder is sent. If 0, no reminders are sent.
+	// Routes may override it.
+	DedupWindowMs *uint64             `json:"dedup_window_ms"`
+	Notifiers     []NotifierConfig    `json:"notifiers"`
+	Routes        []NotificationRoute `json:"routes"`
+}
+
+// GroupWait returns the configured group wait, or the default.
+func (c NotificationConfig) GroupWait() time.Duration {
+	return msOr(c.GroupWaitMs, DefaultNotificationGroupWait)
+}
+
+// DedupWindow returns the configured dedup window, or the default.
+func (c NotificationConfig) DedupWindow() time.Duration {
+	return msOr(c.DedupWindowMs, DefaultNotificationDedupWindow)
+}
+
+// NotifierConfig is the configuration of a single notification target.
+type NotifierConfig struct {
+	// Name is the name routes refer to the notifier by.
+	Name string `json:"name"`
+	// Type is one of the NotifierType constants.
+	Type string `json:"type"`
+	// URL is the URL to POST to, for webhook and alertmanager notifiers. For
+	// alertmanager, this is the full alerts endpoint, e.g.
+	// http://alertmanager:9093/api/v2/alerts
+	URL string `json:"url"`
+	// Headers are additional HTTP headers, for webhook and alertmanager
+	// notifiers.
+	Headers   map[string]string `json:"headers"`
+	TimeoutMs *uint64           `json:"timeout_ms"`
+	// SMTPAddress is the host:port of the SMTP relay, for smtp notifiers.
+	SMTPAddress  string   `json:"smtp_address"`
+	SMTPUser     string   `json:"smtp_user"`
+	SMTPPassword string   `json:"smtp_password"`
+	From         string   `json:"from"`
+	To           []string `json:"to"`
+}
+
+// Timeout returns the configured notifier timeout, or the default.
+func (c NotifierConfig) Timeout() time.Duration {
+	return msOr(c.TimeoutMs, DefaultNotifierTimeout)
+}
+
+// NotificationRoute sends the events matching all of its non-empty filters to
+// its notifiers.
+type NotificationRoute struct {
+	// Notifiers are the names of the notifiers to send matching events to.
+	Notifiers []string `json:"notifiers"`
+	// CDNs matches events from a Traffic Monitor monitoring any of the CDNs.
+	CDNs []string `json:"cdns"`
+	// Cachegroups matches cache events for caches in any of the Cache Groups.
+	Cachegroups []string `json:"cachegroups"`
+	// DeliveryServices matches Delivery Service events for any of the Delivery
+	// Services, and cache events for caches assigned to any of them.
+	DeliveryServices []string `json:"delivery_services"`
+	// EventTypes matches events whose type is any of these, e.g. EDGE, MID,
+	// DELIVERYSERVICE, or PEER. Matching is case-insensitive.
+	EventTypes    []string `json:"event_types"`
+	GroupWaitMs   *uint64  `json:"group_wait_ms"`
+	DedupWindowMs *uint64  `json:"dedup_window_ms"`
+	// SendResolved is whether to notify when a firing alert becomes available
+	// again. The default is true.
+	SendResolved *bool `json:"send_resolved"`
+}
+
+func msOr(ms *uint64, def time.Duration) time.Duration {
+	if ms == nil {
+		return def
+	}
+	return time.Duration(*ms) * time.Millisecond
+}
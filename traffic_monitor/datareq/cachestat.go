@@ -23,21 +23,47 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/statstore"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 )
 
+// cacheStatHistories returns the stat and info histories to serve for the given
+// filter. If the filter has a time range and there is a stat store, the
+// histories are read from the store; otherwise, the in-memory histories are
+// returned. The store may be nil.
+func cacheStatHistories(filter cache.Filter, statResultHistory threadsafe.ResultStatHistory,
+	statInfoHistory threadsafe.ResultInfoHistory, store *statstore.Store) (threadsafe.ResultStatHistory, cache.ResultInfoHistory, error) {
+	if store == nil {
+		return statResultHistory, statInfoHistory.Get(), nil
+	}
+	statFilter, ok := filter.(*CacheStatFilter)
+	if !ok {
+		return statResultHistory, statInfoHistory.Get(), nil
+	}
+	start, end, hasRange := statFilter.TimeRange()
+	if !hasRange {
+		return statResultHistory, statInfoHistory.Get(), nil
+	}
+	return threadsafe.StoredHistory(store, start, end, filter)
+}
+
 func srvCacheStats(params url.Values, errorCount threadsafe.Uint, path string, toData todata.TODataThreadsafe,
 	statResultHistory threadsafe.ResultStatHistory, statInfoHistory threadsafe.ResultInfoHistory,
 	monitorConfig threadsafe.TrafficMonitorConfigMap, combinedStates peer.CRStatesThreadsafe,
-	statMaxKbpses threadsafe.CacheKbpses) ([]byte, int) {
+	statMaxKbpses threadsafe.CacheKbpses, store *statstore.Store) ([]byte, int) {
 	filter, err := NewCacheStatFilter(path, params, toData.Get().ServerTypes)
 	if err != nil {
 		HandleErr(errorCount, path, err)
 		return []byte(err.Error()), http.StatusBadRequest
 	}
-	bytes, err := threadsafe.StatsMarshall(statResultHistory, statInfoHistory.Get(), combinedStates.Get(),
+	statHistory, infoHistory, err := cacheStatHistories(filter, statResultHistory, statInfoHistory, store)
+	if err != nil {
+		return WrapErrCode(errorCount, path, nil, err)
+	}
+	bytes, err := threadsafe.StatsMarshall(statHistory, infoHistory, combinedStates.Get(),
 		monitorConfig.Get(), statMaxKbpses.Get(), filter, params)
 	return WrapErrCode(errorCount, path, bytes, err)
 }
@@ -45,13 +71,17 @@ func srvCacheStats(params url.Values, errorCount threadsafe.Uint, path string, t
 func srvLegacyCacheStats(params url.Values, errorCount threadsafe.Uint, path string, toData todata.TODataThreadsafe,
 	statResultHistory threadsafe.ResultStatHistory, statInfoHistory threadsafe.ResultInfoHistory,
 	monitorConfig threadsafe.TrafficMonitorConfigMap, combinedStates peer.CRStatesThreadsafe,
-	statMaxKbpses threadsafe.CacheKbpses) ([]byte, int) {
+	statMaxKbpses threadsafe.CacheKbpses, store *statstore.Store) ([]byte, int) {
 	filter, err := NewCacheStatFilter(path, params, toData.Get().ServerTypes)
 	if err != nil {
 		HandleErr(errorCount, path, err)
 		return []byte(err.Error()), http.StatusBadRequest
 	}
-	bytes, err := threadsafe.LegacyStatsMarshall(statResultHistory, statInfoHistory.Get(), combinedStates.Get(),
+	statHistory, infoHistory, err := cacheStatHistories(filter, statResultHistory, statInfoHistory, store)
+	if err != nil {
+		return WrapErrCode(errorCount, path, nil, err)
+	}
+	bytes, err := threadsafe.LegacyStatsMarshall(statHistory, infoHistory, combinedStates.Get(),
 		monitorConfig.Get(), statMaxKbpses.Get(), filter, params)
 	return WrapErrCode(errorCount, path, bytes, err)
 }
@@ -24,6 +24,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_monitor/cache"
@@ -38,6 +39,8 @@ type CacheStatFilter struct {
 	cacheType           tc.CacheType
 	hosts               map[tc.CacheName]struct{}
 	cacheTypes          map[tc.CacheName]tc.CacheType
+	start               time.Time
+	end                 time.Time
 }
 
 // UseCache returns whether the given cache is in the filter.
@@ -96,9 +99,45 @@ func (f *CacheStatFilter) WithinStatHistoryMax(n uint64) bool {
 	return false
 }
 
+// WithinTimeRange returns whether the given time is within the `start` and
+// `end` of this filter. A zero start or end is unbounded.
+func (f *CacheStatFilter) WithinTimeRange(t time.Time) bool {
+	if !f.start.IsZero() && t.Before(f.start) {
+		return false
+	}
+	if !f.end.IsZero() && t.After(f.end) {
+		return false
+	}
+	return true
+}
+
+// TimeRange returns the `start` and `end` of this filter, and whether either
+// was given. A zero start or end is unbounded.
+func (f *CacheStatFilter) TimeRange() (time.Time, time.Time, bool) {
+	return f.start, f.end, !f.start.IsZero() || !f.end.IsZero()
+}
+
+// parseTimeParam parses a time query parameter, which may be either an RFC3339
+// timestamp or a Unix epoch in seconds.
+func parseTimeParam(name string, params url.Values) (time.Time, error) {
+	vals, ok := params[name]
+	if !ok || len(vals) == 0 || vals[0] == "" {
+		return time.Time{}, nil
+	}
+	if unix, err := strconv.ParseInt(vals[0], 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, vals[0])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid query parameter %s '%v' - must be an RFC3339 time or a Unix epoch in seconds", name, vals[0])
+	}
+	return t, nil
+}
+
 // NewCacheStatFilter takes the HTTP query parameters and creates a CacheStatFilter which fulfills the `cache.Filter` interface, filtering according to the query parameters passed.
-// Query parameters used are `hc`, `stats`, `wildcard`, `type`, and `hosts`.
-// If `hc` is 0, all history is returned. If `hc` is empty, 1 history is returned.
+// Query parameters used are `hc`, `stats`, `wildcard`, `type`, `hosts`, `start`, and `end`.
+// If `hc` is 0, all history is returned. If `hc` is empty, 1 history is returned, unless `start` or `end` is given, in which case all history in the range is returned.
+// If `start` and `end` are empty, history is not filtered by time. Each may be an RFC3339 time or a Unix epoch in seconds.
 // If `stats` is empty, all stats are returned.
 // If `wildcard` is empty, `stats` is considered exact.
 // If `type` is empty, all cache types are returned.
@@ -111,6 +150,8 @@ func NewCacheStatFilter(path string, params url.Values, cacheTypes map[tc.CacheN
 		"type":           struct{}{},
 		"hosts":          struct{}{},
 		"cache":          struct{}{},
+		"start":          struct{}{},
+		"end":            struct{}{},
 	}
 	if len(params) > len(validParams) {
 		return nil, fmt.Errorf("invalid query parameters")
@@ -121,7 +162,22 @@ func NewCacheStatFilter(path string, params url.Values, cacheTypes map[tc.CacheN
 		}
 	}
 
+	start, err := parseTimeParam("start", params)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeParam("end", params)
+	if err != nil {
+		return nil, err
+	}
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		return nil, fmt.Errorf("invalid query parameters: end '%v' is before start '%v'", end, start)
+	}
+
 	var historyCount uint64 = 1
+	if !start.IsZero() || !end.IsZero() {
+		historyCount = 0
+	}
 	if paramHc, exists := params["hc"]; exists && len(paramHc) > 0 {
 		v, err := strconv.ParseUint(paramHc[0], 10, 64)
 		if err == nil {
@@ -192,5 +248,7 @@ func NewCacheStatFilter(path string, params url.Values, cacheTypes map[tc.CacheN
 		cacheType:    cacheType,
 		hosts:        hosts,
 		cacheTypes:   cacheTypes,
+		start:        start,
+		end:          end,
 	}, nil
 }
@@ -20,46 +20,180 @@
 package datareq
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 )
 
-func srvTRState(params url.Values, localStates peer.CRStatesThreadsafe, combinedStates peer.CRStatesThreadsafe, peerStates peer.CRStatesPeersThreadsafe) ([]byte, int, error) {
-	// local state requested (peer polling case)
-	if _, raw := params["raw"]; raw {
-		data, err := srvTRStateSelf(localStates)
-		return data, http.StatusOK, err
+// srvTRState serves the CRStates, for Traffic Routers, or the local states, for peers polling with the raw parameter.
+//
+// The response has an ETag of the states' version, and If-None-Match is honored with a 304. With the since parameter, a tc.CRStatesDelta of the changes since that version is served instead.
+// With the wait parameter, in seconds, and either If-None-Match or since with the current version, the request is held until the states change or the wait elapses, up to maxWait.
+func srvTRState(errorCount threadsafe.Uint, localStates peer.CRStatesThreadsafe, combinedStates peer.CRStatesThreadsafe, peerStates peer.CRStatesPeersThreadsafe, maxWait time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		path := r.URL.EscapedPath()
+
+		states := combinedStates
+		if _, raw := params["raw"]; raw {
+			// local state requested (peer polling case)
+			states = localStates
+		} else if err := checkOptimisticQuorum(peerStates); err != nil {
+			HandleErr(errorCount, path, err)
+			writeStatus(w, path, http.StatusServiceUnavailable)
+			return
+		}
+
+		since, hasSince, err := parseVersionParam(params, "since")
+		if err != nil {
+			writeBadRequest(w, path, err)
+			return
+		}
+		wait, err := parseWaitParam(params, maxWait)
+		if err != nil {
+			writeBadRequest(w, path, err)
+			return
+		}
+
+		clientVersion, hasClientVersion := since, hasSince
+		if !hasSince {
+			clientVersion, hasClientVersion = parseETagVersion(r.Header.Get(rfc.IfNoneMatch))
+		}
+		if wait > 0 && hasClientVersion {
+			if version, changed := states.Version(); version == clientVersion {
+				timer := time.NewTimer(wait)
+				select {
+				case <-changed:
+				case <-timer.C:
+				case <-r.Context().Done():
+					timer.Stop()
+					return
+				}
+				timer.Stop()
+			}
+		}
+
+		body := []byte(nil)
+		version := uint64(0)
+		if hasSince {
+			delta := states.GetDelta(since)
+			version = delta.Version
+			body, err = json.Marshal(delta)
+		} else {
+			crStates, currentVersion := states.GetVersioned()
+			version = currentVersion
+			if hasClientVersion && clientVersion == version {
+				w.Header().Set(rfc.ETagHeader, crStatesETag(version))
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			body, err = tc.CRStatesMarshall(crStates)
+		}
+		if err == nil {
+			body, err = gzipIfAccepts(r, w, body)
+		}
+		if err != nil {
+			HandleErr(errorCount, path, err)
+			writeStatus(w, path, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+		w.Header().Set(rfc.ETagHeader, crStatesETag(version))
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(body); err != nil {
+			log.Warnf("received error writing data request %v: %v\n", path, err)
+		}
 	}
+}
 
-	// This covers the case where we have lost connectivity to all peers, but multiple peers exist. In this case, it is
-	// more likely that the local machine has lost all connectivity than both peers losing connectivity or crashing. If
-	// the peers really did crash, the health protocol is essentially broken, and serving a 503 will cause Traffic Router
-	// to use the last good state fetched from a Traffic Monitor within the CDN. If the peers are simply unreachable from
-	// this Traffic Monitor, serving 503s until connectivity is restored will cause Traffic Router to ignore this instance
-	// until the health protocol can be relied upon once again.
-	if peerStates.OptimisticQuorumEnabled() {
-		optimisticQuorum, peersAvailable, peerCount, minimum := peerStates.HasOptimisticQuorum()
-		log.Debugf("optimisticQuorum=%v, peerCount=%v, peersAvailable=%v, minimum=%v", optimisticQuorum, peerCount, peersAvailable, minimum)
-
-		if !optimisticQuorum {
-			return nil, http.StatusServiceUnavailable, fmt.Errorf("number of peers available (%d/%d) is less than the minimum number of %d required for optimistic peer quorum", peersAvailable, peerCount, minimum)
+// checkOptimisticQuorum returns an error if optimistic quorum is enabled, and there aren't enough peers available.
+//
+// This covers the case where we have lost connectivity to all peers, but multiple peers exist. In this case, it is
+// more likely that the local machine has lost all connectivity than both peers losing connectivity or crashing. If
+// the peers really did crash, the health protocol is essentially broken, and serving a 503 will cause Traffic Router
+// to use the last good state fetched from a Traffic Monitor within the CDN. If the peers are simply unreachable from
+// this Traffic Monitor, serving 503s until connectivity is restored will cause Traffic Router to ignore this instance
+// until the health protocol can be relied upon once again.
+func checkOptimisticQuorum(peerStates peer.CRStatesPeersThreadsafe) error {
+	if !peerStates.OptimisticQuorumEnabled() {
+		return nil
+	}
+	optimisticQuorum, peersAvailable, peerCount, minimum := peerStates.HasOptimisticQuorum()
+	log.Debugf("optimisticQuorum=%v, peerCount=%v, peersAvailable=%v, minimum=%v", optimisticQuorum, peerCount, peersAvailable, minimum)
+	if !optimisticQuorum {
+		return fmt.Errorf("number of peers available (%d/%d) is less than the minimum number of %d required for optimistic peer quorum", peersAvailable, peerCount, minimum)
+	}
+	return nil
+}
+
+// crStatesETag returns the ETag of the given CRStates version.
+func crStatesETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// parseETagVersion returns the CRStates version of the first CRStates ETag in the given If-None-Match header, and whether there was one.
+func parseETagVersion(ifNoneMatch string) (uint64, bool) {
+	for _, etag := range strings.Split(ifNoneMatch, ",") {
+		etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+		if len(etag) < 2 || !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+			continue
+		}
+		if version, err := strconv.ParseUint(etag[1:len(etag)-1], 10, 64); err == nil {
+			return version, true
 		}
 	}
+	return 0, false
+}
 
-	data, err := srvTRStateDerived(combinedStates, peerStates)
+// parseVersionParam returns the CRStates version of the given query parameter, and whether it exists.
+func parseVersionParam(params url.Values, name string) (uint64, bool, error) {
+	if _, ok := params[name]; !ok {
+		return 0, false, nil
+	}
+	version, err := strconv.ParseUint(params.Get(name), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s must be a version number", name)
+	}
+	return version, true, nil
+}
 
-	return data, http.StatusOK, err
+// parseWaitParam returns the duration of the wait query parameter, in seconds, capped at maxWait. It returns 0 if the parameter doesn't exist.
+func parseWaitParam(params url.Values, maxWait time.Duration) (time.Duration, error) {
+	if _, ok := params["wait"]; !ok {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseUint(params.Get("wait"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("wait must be a number of seconds")
+	}
+	wait := time.Duration(seconds) * time.Second
+	if wait > maxWait {
+		wait = maxWait
+	}
+	return wait, nil
 }
 
-func srvTRStateDerived(combinedStates peer.CRStatesThreadsafe, peerStates peer.CRStatesPeersThreadsafe) ([]byte, error) {
-	return tc.CRStatesMarshall(combinedStates.Get())
+func writeStatus(w http.ResponseWriter, path string, code int) {
+	w.WriteHeader(code)
+	if _, err := w.Write([]byte(http.StatusText(code))); err != nil {
+		log.Warnf("received error writing data request %v: %v\n", path, err)
+	}
 }
 
-func srvTRStateSelf(localStates peer.CRStatesThreadsafe) ([]byte, error) {
-	return tc.CRStatesMarshall(localStates.Get())
+func writeBadRequest(w http.ResponseWriter, path string, err error) {
+	w.WriteHeader(http.StatusBadRequest)
+	if _, err := w.Write([]byte(err.Error())); err != nil {
+		log.Warnf("received error writing data request %v: %v\n", path, err)
+	}
 }
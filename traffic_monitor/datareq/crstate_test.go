@@ -0,0 +1,164 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+func newTestCRStatesHandler() (http.HandlerFunc, peer.CRStatesThreadsafe) {
+	localStates := peer.NewCRStatesThreadsafe()
+	localStates.AddCache("edge1", tc.IsAvailable{IsAvailable: true})
+	localStates.AddCache("edge2", tc.IsAvailable{IsAvailable: true})
+	handler := srvTRState(threadsafe.NewUint(), localStates, peer.NewCRStatesThreadsafe(), peer.NewCRStatesPeersThreadsafe(0), 2*time.Second)
+	return handler, localStates
+}
+
+func serveCRStates(handler http.HandlerFunc, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, vals := range header {
+		req.Header[name] = vals
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestSrvTRStateConditional(t *testing.T) {
+	handler, localStates := newTestCRStatesHandler()
+
+	w := serveCRStates(handler, "/publish/CrStates?raw", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, actual %d", http.StatusOK, w.Code)
+	}
+	etag := w.Header().Get(rfc.ETagHeader)
+	if etag == "" {
+		t.Fatal("expected an ETag, actual none")
+	}
+	states, err := tc.CRStatesUnMarshall(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("decoding states: %v", err)
+	}
+	if len(states.Caches) != 2 {
+		t.Errorf("expected 2 caches, actual %+v", states.Caches)
+	}
+
+	w = serveCRStates(handler, "/publish/CrStates?raw", http.Header{rfc.IfNoneMatch: {etag}})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected status %d with no body for a matching If-None-Match, actual %d with %d bytes", http.StatusNotModified, w.Code, w.Body.Len())
+	}
+
+	localStates.SetCache("edge1", tc.IsAvailable{IsAvailable: false})
+	w = serveCRStates(handler, "/publish/CrStates?raw", http.Header{rfc.IfNoneMatch: {etag}})
+	if w.Code != http.StatusOK || w.Header().Get(rfc.ETagHeader) == etag {
+		t.Errorf("expected status %d with a new ETag after a change, actual %d with '%s'", http.StatusOK, w.Code, w.Header().Get(rfc.ETagHeader))
+	}
+}
+
+func TestSrvTRStateDelta(t *testing.T) {
+	handler, localStates := newTestCRStatesHandler()
+	_, version := localStates.GetVersioned()
+
+	localStates.SetCache("edge1", tc.IsAvailable{IsAvailable: false})
+	localStates.DeleteCache("edge2")
+
+	w := serveCRStates(handler, "/publish/CrStates?raw&since="+crStatesSince(version), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, actual %d", http.StatusOK, w.Code)
+	}
+	delta := tc.CRStatesDelta{}
+	if err := json.Unmarshal(w.Body.Bytes(), &delta); err != nil {
+		t.Fatalf("decoding delta: %v", err)
+	}
+	if delta.Full || len(delta.Caches) != 1 || delta.Caches["edge1"].IsAvailable || len(delta.DeletedCaches) != 1 || delta.DeletedCaches[0] != "edge2" {
+		t.Errorf("expected edge1 changed and edge2 deleted, actual %+v", delta)
+	}
+	if current, _ := localStates.Version(); delta.Version != current {
+		t.Errorf("expected delta version %d, actual %d", current, delta.Version)
+	}
+
+	w = serveCRStates(handler, "/publish/CrStates?raw&since=0", nil)
+	delta = tc.CRStatesDelta{}
+	if err := json.Unmarshal(w.Body.Bytes(), &delta); err != nil {
+		t.Fatalf("decoding delta: %v", err)
+	}
+	if !delta.Full || len(delta.Caches) != 1 {
+		t.Errorf("expected a full delta since an unknown version, actual %+v", delta)
+	}
+}
+
+func TestSrvTRStateWait(t *testing.T) {
+	handler, localStates := newTestCRStatesHandler()
+	version, _ := localStates.Version()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		localStates.SetCache("edge1", tc.IsAvailable{IsAvailable: false})
+	}()
+	start := time.Now()
+	w := serveCRStates(handler, "/publish/CrStates?raw&wait=10&since="+crStatesSince(version), nil)
+	if elapsed := time.Since(start); elapsed >= 2*time.Second {
+		t.Errorf("expected the request to return when the states changed, actual %v", elapsed)
+	}
+	delta := tc.CRStatesDelta{}
+	if err := json.Unmarshal(w.Body.Bytes(), &delta); err != nil {
+		t.Fatalf("decoding delta: %v", err)
+	}
+	if len(delta.Caches) != 1 || delta.Caches["edge1"].IsAvailable {
+		t.Errorf("expected edge1 changed, actual %+v", delta)
+	}
+
+	version = delta.Version
+	start = time.Now()
+	w = serveCRStates(handler, "/publish/CrStates?raw&wait=1&since="+crStatesSince(version), nil)
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected the request to wait 1s without changes, actual %v", elapsed)
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d after waiting without changes, actual %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestSrvTRStateBadParams(t *testing.T) {
+	handler, _ := newTestCRStatesHandler()
+	for _, target := range []string{
+		"/publish/CrStates?raw&since=abc",
+		"/publish/CrStates?raw&wait=-1",
+		"/publish/CrStates?raw&wait=abc",
+	} {
+		if w := serveCRStates(handler, target, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, actual %d", target, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func crStatesSince(version uint64) string {
+	return strconv.FormatUint(version, 10)
+}
@@ -34,6 +34,8 @@ import (
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/sla"
+	"github.com/apache/trafficcontrol/traffic_monitor/statstore"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 	"github.com/apache/trafficcontrol/traffic_monitor/towrap"
@@ -63,6 +65,9 @@ func MakeDispatchMap(
 	lastStats threadsafe.LastStats,
 	unpolledCaches threadsafe.UnpolledCaches,
 	monitorConfig threadsafe.TrafficMonitorConfigMap,
+	statStore *statstore.Store,
+	crStatesMaxWait time.Duration,
+	slaTracker *sla.Tracker,
 ) map[string]http.HandlerFunc {
 
 	// wrap composes all universal wrapper functions. Right now, it's only the UnpolledCheck, but there may be others later. For example, security headers.
@@ -74,15 +79,12 @@ func MakeDispatchMap(
 		"/publish/CrConfig": wrap(WrapAgeErr(errorCount, func() ([]byte, time.Time, error) {
 			return srvTRConfig(opsConfig, toSession)
 		}, rfc.ApplicationJSON)),
-		"/publish/CrStates": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
-			bytes, statusCode, err := srvTRState(params, localStates, combinedStates, peerStates)
-			return WrapErrStatusCode(errorCount, path, bytes, statusCode, err)
-		}, rfc.ApplicationJSON)),
+		"/publish/CrStates": wrap(srvTRState(errorCount, localStates, combinedStates, peerStates, crStatesMaxWait)),
 		"/publish/CacheStatsNew": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
-			return srvCacheStats(params, errorCount, path, toData, statResultHistory, statInfoHistory, monitorConfig, combinedStates, statMaxKbpses)
+			return srvCacheStats(params, errorCount, path, toData, statResultHistory, statInfoHistory, monitorConfig, combinedStates, statMaxKbpses, statStore)
 		}, rfc.ApplicationJSON)),
 		"/publish/CacheStats": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
-			return srvLegacyCacheStats(params, errorCount, path, toData, statResultHistory, statInfoHistory, monitorConfig, combinedStates, statMaxKbpses)
+			return srvLegacyCacheStats(params, errorCount, path, toData, statResultHistory, statInfoHistory, monitorConfig, combinedStates, statMaxKbpses, statStore)
 		}, rfc.ApplicationJSON)),
 		"/publish/DsStats": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
 			return srvDSStats(params, errorCount, path, toData, dsStats)
@@ -132,6 +134,9 @@ func MakeDispatchMap(
 		"/api/crconfig-history": wrap(WrapErr(errorCount, func() ([]byte, error) {
 			return srvAPICRConfigHist(toSession)
 		}, rfc.ApplicationJSON)),
+		"/api/delivery-service-sla": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
+			return srvAPIDeliveryServiceSLA(params, errorCount, path, slaTracker)
+		}, rfc.ApplicationJSON)),
 	}
 	return addTrailingSlashEndpoints(dispatchMap)
 }
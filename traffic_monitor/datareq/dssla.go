@@ -0,0 +1,54 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package datareq
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/sla"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+// DeliveryServiceSLAResponse is the response of the delivery service SLA endpoint.
+type DeliveryServiceSLAResponse struct {
+	DeliveryServices map[tc.DeliveryServiceName]sla.Report `json:"deliveryServices"`
+}
+
+func srvAPIDeliveryServiceSLA(params url.Values, errorCount threadsafe.Uint, path string, tracker *sla.Tracker) ([]byte, int) {
+	now := time.Now()
+	resp := DeliveryServiceSLAResponse{}
+	if ds := params.Get("ds"); ds != "" {
+		report, ok := tracker.Report(now, tc.DeliveryServiceName(ds))
+		if !ok {
+			HandleErr(errorCount, path, errors.New("delivery service '"+ds+"' not found"))
+			return []byte(http.StatusText(http.StatusNotFound)), http.StatusNotFound
+		}
+		resp.DeliveryServices = map[tc.DeliveryServiceName]sla.Report{tc.DeliveryServiceName(ds): report}
+	} else {
+		resp.DeliveryServices = tracker.Reports(now)
+	}
+	bytes, err := json.Marshal(resp)
+	return WrapErrCode(errorCount, path, bytes, err)
+}
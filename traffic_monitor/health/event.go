@@ -63,6 +63,7 @@ type ThreadsafeEvents struct {
 	m         *sync.RWMutex
 	nextIndex *uint64
 	max       uint64
+	listeners []func(Event)
 }
 
 func copyEvents(a []Event) []Event {
@@ -71,10 +72,11 @@ func copyEvents(a []Event) []Event {
 	return b
 }
 
-// NewEvents creates a new single-writer-multiple-reader Threadsafe object
-func NewThreadsafeEvents(maxEvents uint64) ThreadsafeEvents {
+// NewEvents creates a new single-writer-multiple-reader Threadsafe object.
+// Each of the given listeners is called with every added event, after it has been added. Listeners MUST NOT block.
+func NewThreadsafeEvents(maxEvents uint64, listeners ...func(Event)) ThreadsafeEvents {
 	i := uint64(0)
-	return ThreadsafeEvents{m: &sync.RWMutex{}, events: &[]Event{}, nextIndex: &i, max: maxEvents}
+	return ThreadsafeEvents{m: &sync.RWMutex{}, events: &[]Event{}, nextIndex: &i, max: maxEvents, listeners: listeners}
 }
 
 // Get returns the internal slice of Events for reading. This MUST NOT be modified. If modification is necessary, copy the slice.
@@ -99,4 +101,7 @@ func (o *ThreadsafeEvents) Add(e Event) {
 	*o.events = events
 	*o.nextIndex++
 	o.m.Unlock()
+	for _, listener := range o.listeners {
+		listener(e)
+	}
 }
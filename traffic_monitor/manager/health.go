@@ -28,6 +28,7 @@ import (
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/statstore"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 )
@@ -48,6 +49,7 @@ func StartHealthResultManager(
 	cfg config.Config,
 	events health.ThreadsafeEvents,
 	localCacheStatus threadsafe.CacheAvailableStatus,
+	statStore *statstore.Store,
 ) (threadsafe.DurationMap, threadsafe.ResultHistory) {
 	lastHealthDurations := threadsafe.NewDurationMap()
 	healthHistory := threadsafe.NewResultHistory()
@@ -64,6 +66,7 @@ func StartHealthResultManager(
 		events,
 		localCacheStatus,
 		cfg,
+		statStore,
 	)
 	return lastHealthDurations, healthHistory
 }
@@ -81,6 +84,7 @@ func healthResultManagerListen(
 	events health.ThreadsafeEvents,
 	localCacheStatus threadsafe.CacheAvailableStatus,
 	cfg config.Config,
+	statStore *statstore.Store,
 ) {
 	lastHealthEndTimes := map[tc.CacheName]time.Time{}
 	// This reads at least 1 value from the cacheHealthChan. Then, we loop, and try to read from the channel some more. If there's nothing to read, we hit `default` and process. If there is stuff to read, we read it, then inner-loop trying to read more. If we're continuously reading and the channel is never empty, and we hit the tick time, process anyway even though the channel isn't empty, to prevent never processing (starvation).
@@ -102,6 +106,7 @@ func healthResultManagerListen(
 			healthHistory,
 			results,
 			cfg,
+			statStore,
 		)
 	}
 
@@ -148,6 +153,7 @@ func processHealthResult(
 	healthHistory threadsafe.ResultHistory,
 	results []cache.Result,
 	cfg config.Config,
+	statStore *statstore.Store,
 ) {
 	if len(results) == 0 {
 		return
@@ -189,6 +195,11 @@ func processHealthResult(
 	health.CalcAvailability(results, pollerName, statResultHistoryNil, monitorConfigCopy, toDataCopy, localCacheStatusThreadsafe, localStates, events, cfg.CachePollingProtocol)
 
 	healthHistory.Set(healthHistoryCopy)
+	if statStore != nil {
+		for _, healthResult := range results {
+			statStore.Add(healthResult, statstore.PollerHealth)
+		}
+	}
 	// TODO determine if we should combineCrStates() here
 
 	lastHealthDurations := threadsafe.CopyDurationMap(lastHealthDurationsThreadsafe.Get())
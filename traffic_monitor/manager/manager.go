@@ -33,16 +33,20 @@ import (
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
 	"github.com/apache/trafficcontrol/traffic_monitor/handler"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/notify"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
 	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+	"github.com/apache/trafficcontrol/traffic_monitor/replay"
+	"github.com/apache/trafficcontrol/traffic_monitor/sla"
+	"github.com/apache/trafficcontrol/traffic_monitor/statstore"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 	"github.com/apache/trafficcontrol/traffic_monitor/towrap"
 )
 
 //
-// Start starts the poller and handler goroutines
-//
+// Start starts the poller and handler goroutines, and returns once the process is told to terminate by SIGTERM or
+// SIGINT, after closing anything which must be closed to not lose data.
 func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData, trafficMonitorConfigFileName string) error {
 	toSession := towrap.NewTrafficOpsSessionThreadsafe(nil, nil, cfg.CRConfigHistoryCount, cfg)
 
@@ -53,20 +57,46 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 
 	toData := todata.NewThreadsafe()
 
+	var recorder *replay.Recorder
 	cacheHealthHandler := cache.NewHandler()
-	cacheHealthPoller := poller.NewCache(cfg.CacheHealthPollingInterval, true, cacheHealthHandler, cfg, appData, cfg.CachePollingProtocol)
 	cacheStatHandler := cache.NewPrecomputeHandler(toData)
-	cacheStatPoller := poller.NewCache(cfg.CacheStatPollingInterval, false, cacheStatHandler, cfg, appData, cfg.CachePollingProtocol)
-	monitorConfigPoller := poller.NewMonitorConfig(cfg.MonitorConfigPollingInterval)
 	peerHandler := peer.NewHandler()
-	peerPoller := poller.NewCache(cfg.PeerPollingInterval, false, peerHandler, cfg, appData, cfg.PeerPollingProtocol)
+	healthPollHandler := handler.Handler(cacheHealthHandler)
+	statPollHandler := handler.Handler(cacheStatHandler)
+	peerPollHandler := handler.Handler(peerHandler)
+	if cfg.HealthRecordFile != "" {
+		r, err := replay.NewRecorder(cfg.HealthRecordFile)
+		if err != nil {
+			return fmt.Errorf("creating health recorder: %v", err)
+		}
+		recorder = r
+		healthPollHandler = recorder.Handler(replay.PollerHealth, cacheHealthHandler)
+		statPollHandler = recorder.Handler(replay.PollerStat, cacheStatHandler)
+		peerPollHandler = recorder.Handler(replay.PollerPeer, peerHandler)
+	}
+	cacheHealthPoller := poller.NewCache(cfg.CacheHealthPollingInterval, true, healthPollHandler, cfg, appData, cfg.CachePollingProtocol)
+	cacheStatPoller := poller.NewCache(cfg.CacheStatPollingInterval, false, statPollHandler, cfg, appData, cfg.CachePollingProtocol)
+	monitorConfigPoller := poller.NewMonitorConfig(cfg.MonitorConfigPollingInterval)
+	peerPoller := poller.NewCache(cfg.PeerPollingInterval, false, peerPollHandler, cfg, appData, cfg.PeerPollingProtocol)
 
 	go monitorConfigPoller.Poll()
 	go cacheHealthPoller.Poll()
 	go cacheStatPoller.Poll()
 	go peerPoller.Poll()
 
-	events := health.NewThreadsafeEvents(cfg.MaxEvents)
+	opsConfigSubscribers := []chan<- handler.OpsConfig{monitorConfigPoller.OpsConfigChannel}
+	eventListeners := []func(health.Event){}
+	if len(cfg.Notifications.Routes) > 0 {
+		dispatcher, err := notify.New(cfg.Notifications, toData)
+		if err != nil {
+			return fmt.Errorf("creating notification dispatcher: %v", err)
+		}
+		opsConfigSubscribers = append(opsConfigSubscribers, dispatcher.OpsConfigChannel)
+		eventListeners = append(eventListeners, dispatcher.Listen)
+		go dispatcher.Run()
+	}
+
+	events := health.NewThreadsafeEvents(cfg.MaxEvents, eventListeners...)
 
 	cachesChanged := make(chan struct{})
 	peerStates := peer.NewCRStatesPeersThreadsafe(cfg.PeerOptimisticQuorumMin) // each peer's last state is saved in this map
@@ -84,10 +114,26 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		appData,
 		toSession,
 		toData,
+		recorder,
 	)
 
+	var statStore *statstore.Store
+	if cfg.StatHistoryDir != "" {
+		store, err := statstore.Open(statstore.Config{Dir: cfg.StatHistoryDir, MaxAge: cfg.StatHistoryMaxAge, MaxBytes: cfg.StatHistoryMaxBytes})
+		if err != nil {
+			return fmt.Errorf("opening stat history store: %v", err)
+		}
+		statStore = store
+	}
+
 	combinedStates, combineStateFunc := StartStateCombiner(events, peerStates, localStates, toData)
 
+	slaTracker, err := sla.NewTracker(cfg.SLAHistoryFile)
+	if err != nil {
+		return fmt.Errorf("creating delivery service SLA tracker: %v", err)
+	}
+	go slaTracker.Run(combinedStates, toData)
+
 	StartPeerManager(
 		peerHandler.ResultChannel,
 		peerStates,
@@ -106,6 +152,7 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		monitorConfig,
 		events,
 		combineStateFunc,
+		statStore,
 	)
 
 	lastHealthDurations, healthHistory := StartHealthResultManager(
@@ -119,13 +166,14 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		cfg,
 		events,
 		localCacheStatus,
+		statStore,
 	)
 
 	StartOpsConfigManager(
 		opsConfigFile,
 		toSession,
 		toData,
-		[]chan<- handler.OpsConfig{monitorConfigPoller.OpsConfigChannel},
+		opsConfigSubscribers,
 		[]chan<- towrap.TrafficOpsSessionThreadsafe{monitorConfigPoller.SessionChannel},
 		localStates,
 		peerStates,
@@ -147,16 +195,34 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		unpolledCaches,
 		monitorConfig,
 		cfg,
+		statStore,
+		slaTracker,
 	)
 
 	if err := startMonitorConfigFilePoller(trafficMonitorConfigFileName); err != nil {
 		return fmt.Errorf("starting monitor config file poller: %v", err)
 	}
 
-	healthTickListener(cacheHealthPoller.TickChan, healthIteration)
+	go healthTickListener(cacheHealthPoller.TickChan, healthIteration)
+
+	sig := waitForTermination()
+	log.Infof("received %v, shutting down\n", sig)
+	if statStore != nil {
+		// pollers may still be adding results; the store drops them once it's closed
+		if err := statStore.Close(); err != nil {
+			log.Errorf("closing stat history store: %v", err)
+		}
+	}
 	return nil
 }
 
+// waitForTermination blocks until the process is told to terminate, and returns the signal it was told with.
+func waitForTermination() os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, unix.SIGTERM, unix.SIGINT)
+	return <-c
+}
+
 // healthTickListener listens for health ticks, and writes to the health iteration variable. Does not return.
 func healthTickListener(cacheHealthTick <-chan uint64, healthIteration threadsafe.Uint) {
 	for i := range cacheHealthTick {
@@ -33,6 +33,7 @@ import (
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
 	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+	"github.com/apache/trafficcontrol/traffic_monitor/replay"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 	"github.com/apache/trafficcontrol/traffic_monitor/towrap"
@@ -131,6 +132,7 @@ func StartMonitorConfigManager(
 	staticAppData config.StaticAppData,
 	toSession towrap.TrafficOpsSessionThreadsafe,
 	toData todata.TODataThreadsafe,
+	recorder *replay.Recorder,
 ) threadsafe.TrafficMonitorConfigMap {
 	monitorConfig := threadsafe.NewTrafficMonitorConfigMap()
 	go monitorConfigListen(monitorConfig,
@@ -146,6 +148,7 @@ func StartMonitorConfigManager(
 		staticAppData,
 		toSession,
 		toData,
+		recorder,
 	)
 	return monitorConfig
 }
@@ -201,6 +204,7 @@ func monitorConfigListen(
 	staticAppData config.StaticAppData,
 	toSession towrap.TrafficOpsSessionThreadsafe,
 	toData todata.TODataThreadsafe,
+	recorder *replay.Recorder,
 ) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -220,6 +224,14 @@ func monitorConfigListen(
 		if err := toData.Update(toSession, cdn); err != nil {
 			log.Errorln("Updating Traffic Ops Data: " + err.Error())
 		}
+		if recorder != nil {
+			if crConfig, _, err := toSession.LastCRConfig(cdn); err != nil {
+				log.Errorln("Recording monitor config: getting last CRConfig: " + err.Error())
+			} else {
+				recorder.RecordConfig(cdn, staticAppData.Hostname, monitorConfig, crConfig)
+			}
+		}
+		setLocalStates(monitorConfig, localStates)
 
 		healthURLs := map[string]poller.PollConfig{}
 		statURLs := map[string]poller.PollConfig{}
@@ -236,19 +248,9 @@ func monitorConfigListen(
 		for _, srv := range monitorConfig.TrafficServer {
 			caches[srv.HostName] = srv.ServerStatus
 
-			cacheName := tc.CacheName(srv.HostName)
-
 			srvStatus := tc.CacheStatusFromString(srv.ServerStatus)
-			if srvStatus == tc.CacheStatusOnline {
-				localStates.AddCache(cacheName, tc.IsAvailable{IsAvailable: true, Ipv6Available: srv.IPv6() != "", Ipv4Available: srv.IPv4() != ""})
-				continue
-			}
-			if srvStatus == tc.CacheStatusOffline {
-				continue
-			}
-			// seed states with available = false until our polling cycle picks up a result
-			if _, exists := localStates.GetCache(cacheName); !exists {
-				localStates.AddCache(cacheName, tc.IsAvailable{IsAvailable: false})
+			if srvStatus == tc.CacheStatusOnline || srvStatus == tc.CacheStatusOffline {
+				continue // ONLINE caches are always available, and OFFLINE caches are never polled
 			}
 
 			pollURLStr := monitorConfig.Profile[srv.Profile].Parameters.HealthPollingURL
@@ -286,16 +288,13 @@ func monitorConfigListen(
 
 		peerSet := map[tc.TrafficMonitorName]struct{}{}
 		for _, srv := range monitorConfig.TrafficMonitor {
-			if srv.HostName == staticAppData.Hostname {
-				continue
-			}
-			if tc.CacheStatusFromString(srv.ServerStatus) != tc.CacheStatusOnline {
+			if !isPeer(srv, staticAppData.Hostname) {
 				continue
 			}
 			// TODO: the URL should be config driven. -jse
 			url4 := fmt.Sprintf("http://%s:%d/publish/CrStates?raw", srv.IP, srv.Port)
 			url6 := fmt.Sprintf("http://[%s]:%d/publish/CrStates?raw", ipv6CIDRStrToAddr(srv.IP6), srv.Port)
-			peerURLs[srv.HostName] = poller.PollConfig{URL: url4, URLv6: url6, Host: srv.FQDN} // TODO determine timeout.
+			peerURLs[srv.HostName] = poller.PollConfig{URL: url4, URLv6: url6, Host: srv.FQDN, PollType: poller.PollerTypeCRStates} // TODO determine timeout.
 			peerSet[tc.TrafficMonitorName(srv.HostName)] = struct{}{}
 		}
 
@@ -306,30 +305,67 @@ func monitorConfigListen(
 		peerStates.SetTimeout((intervals.Peer + cfg.HTTPTimeout) * 2)
 		peerStates.SetPeers(peerSet)
 
-		for cacheName := range localStates.GetCaches() {
-			if _, exists := monitorConfig.TrafficServer[string(cacheName)]; !exists {
-				log.Warnf("Removing %s from localStates", cacheName)
-				localStates.DeleteCache(cacheName)
-			}
-		}
-
 		if len(healthURLs) == 0 {
 			log.Errorf("No REPORTED caches exist in Traffic Ops, nothing to poll.")
 		}
 
 		cachesChangeSubscriber <- struct{}{}
+	}
+}
 
-		// TODO because there are multiple writers to localStates.DeliveryService, there is a race condition, where MonitorConfig (this func) and HealthResultManager could write at the same time, and the HealthResultManager could overwrite a delivery service addition or deletion here. Probably the simplest and most performant fix would be a lock-free algorithm using atomic compare-and-swaps.
-		for _, ds := range monitorConfig.DeliveryService {
-			// since caches default to unavailable, also default DS false
-			if _, exists := localStates.GetDeliveryService(tc.DeliveryServiceName(ds.XMLID)); !exists {
-				localStates.SetDeliveryService(tc.DeliveryServiceName(ds.XMLID), tc.CRStatesDeliveryService{IsAvailable: false, DisabledLocations: []tc.CacheGroupName{}}) // important to initialize DisabledLocations, so JSON is `[]` not `null`
-			}
+// isPeer returns whether the given Traffic Monitor is a peer of the Traffic Monitor with the given host name, which is polled for its CRStates.
+func isPeer(srv tc.TrafficMonitor, hostname string) bool {
+	return srv.HostName != hostname && tc.CacheStatusFromString(srv.ServerStatus) == tc.CacheStatusOnline
+}
+
+// getPeerSet returns the peers of the Traffic Monitor with the given host name in the given monitor config.
+func getPeerSet(monitorConfig tc.TrafficMonitorConfigMap, hostname string) map[tc.TrafficMonitorName]struct{} {
+	peerSet := map[tc.TrafficMonitorName]struct{}{}
+	for _, srv := range monitorConfig.TrafficMonitor {
+		if isPeer(srv, hostname) {
+			peerSet[tc.TrafficMonitorName(srv.HostName)] = struct{}{}
 		}
-		for ds := range localStates.GetDeliveryServices() {
-			if _, exists := monitorConfig.DeliveryService[string(ds)]; !exists {
-				localStates.DeleteDeliveryService(ds)
-			}
+	}
+	return peerSet
+}
+
+// setLocalStates adds the caches and delivery services in the given monitor config to the local states, and removes those which aren't.
+// ONLINE caches are set available, and other new caches and delivery services are seeded unavailable until polling picks up a result.
+func setLocalStates(monitorConfig tc.TrafficMonitorConfigMap, localStates peer.CRStatesThreadsafe) {
+	for _, srv := range monitorConfig.TrafficServer {
+		cacheName := tc.CacheName(srv.HostName)
+
+		srvStatus := tc.CacheStatusFromString(srv.ServerStatus)
+		if srvStatus == tc.CacheStatusOnline {
+			localStates.AddCache(cacheName, tc.IsAvailable{IsAvailable: true, Ipv6Available: srv.IPv6() != "", Ipv4Available: srv.IPv4() != ""})
+			continue
+		}
+		if srvStatus == tc.CacheStatusOffline {
+			continue
+		}
+		// seed states with available = false until our polling cycle picks up a result
+		if _, exists := localStates.GetCache(cacheName); !exists {
+			localStates.AddCache(cacheName, tc.IsAvailable{IsAvailable: false})
+		}
+	}
+
+	for cacheName := range localStates.GetCaches() {
+		if _, exists := monitorConfig.TrafficServer[string(cacheName)]; !exists {
+			log.Warnf("Removing %s from localStates", cacheName)
+			localStates.DeleteCache(cacheName)
+		}
+	}
+
+	// TODO because there are multiple writers to localStates.DeliveryService, there is a race condition, where MonitorConfig (this func) and HealthResultManager could write at the same time, and the HealthResultManager could overwrite a delivery service addition or deletion here. Probably the simplest and most performant fix would be a lock-free algorithm using atomic compare-and-swaps.
+	for _, ds := range monitorConfig.DeliveryService {
+		// since caches default to unavailable, also default DS false
+		if _, exists := localStates.GetDeliveryService(tc.DeliveryServiceName(ds.XMLID)); !exists {
+			localStates.SetDeliveryService(tc.DeliveryServiceName(ds.XMLID), tc.CRStatesDeliveryService{IsAvailable: false, DisabledLocations: []tc.CacheGroupName{}}) // important to initialize DisabledLocations, so JSON is `[]` not `null`
+		}
+	}
+	for ds := range localStates.GetDeliveryServices() {
+		if _, exists := monitorConfig.DeliveryService[string(ds)]; !exists {
+			localStates.DeleteDeliveryService(ds)
 		}
 	}
 }
@@ -34,7 +34,9 @@ import (
 	"github.com/apache/trafficcontrol/traffic_monitor/handler"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/sla"
 	"github.com/apache/trafficcontrol/traffic_monitor/srvhttp"
+	"github.com/apache/trafficcontrol/traffic_monitor/statstore"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 	"github.com/apache/trafficcontrol/traffic_monitor/towrap"
@@ -70,6 +72,8 @@ func StartOpsConfigManager(
 	unpolledCaches threadsafe.UnpolledCaches,
 	monitorConfig threadsafe.TrafficMonitorConfigMap,
 	cfg config.Config,
+	statStore *statstore.Store,
+	slaTracker *sla.Tracker,
 ) (threadsafe.OpsConfig, error) {
 
 	handleErr := func(err error) {
@@ -126,6 +130,9 @@ func StartOpsConfigManager(
 			lastStats,
 			unpolledCaches,
 			monitorConfig,
+			statStore,
+			cfg.CRStatesMaxWait,
+			slaTracker,
 		)
 
 		// If the HTTPS Listener is defined in the traffic_ops.cfg file then it creates the HTTPS endpoint and the corresponding HTTP endpoint as a redirect
@@ -0,0 +1,224 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/replay"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+// ReplayState is the combined CRStates after a replayed archive entry changed them.
+type ReplayState struct {
+	// Time is the time of the entry which changed the states.
+	Time   time.Time   `json:"time"`
+	States tc.CRStates `json:"states"`
+}
+
+// Replay feeds the entries of the given record archive through the pollers' handlers, the health and stat result processing, the peer state processing, and the state combiner, in order, without any network access.
+// The given func is called with the combined CRStates each time an entry changes them, which is the CRStates timeline Traffic Monitor served when the archive was recorded.
+//
+// Replay has no clock of its own, so peer results never time out, and Delivery Service bandwidth is calculated with the current time rather than the recorded time.
+func Replay(archive io.Reader, cfg config.Config, f func(ReplayState)) error {
+	rdr := replay.NewReader(archive)
+
+	toData := todata.NewThreadsafe()
+	monitorConfig := threadsafe.NewTrafficMonitorConfigMap()
+	localStates := peer.NewCRStatesThreadsafe()
+	combinedStates := peer.NewCRStatesThreadsafe()
+	peerStates := peer.NewCRStatesPeersThreadsafe(cfg.PeerOptimisticQuorumMin)
+	peerStates.SetTimeout(time.Duration(math.MaxInt64))
+	events := health.NewThreadsafeEvents(cfg.MaxEvents)
+	localCacheStatus := threadsafe.NewCacheAvailableStatus()
+	lastHealthDurations := threadsafe.NewDurationMap()
+	healthHistory := threadsafe.NewResultHistory()
+	lastHealthEndTimes := map[tc.CacheName]time.Time{}
+	overrideMap := map[tc.CacheName]bool{}
+	cacheHealthHandler := cache.NewHandler()
+	cacheStatHandler := cache.NewPrecomputeHandler(toData)
+	peerHandler := peer.NewHandler()
+	stats := newReplayStats()
+	peerSet := map[tc.TrafficMonitorName]struct{}{}
+
+	lastStates := []byte(nil)
+	for {
+		entry, err := rdr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch entry.Type {
+		case replay.EntryTypeConfig:
+			monitorConfig.Set(entry.Config.MonitorConfig)
+			if err := toData.SetCRConfig(entry.Config.CRConfig); err != nil {
+				return fmt.Errorf("replaying config at %v: %v", entry.Time, err)
+			}
+			setLocalStates(entry.Config.MonitorConfig, localStates)
+			peerSet = getPeerSet(entry.Config.MonitorConfig, entry.Config.Hostname)
+			peerStates.SetPeers(peerSet)
+		case replay.EntryTypePoll:
+			switch entry.Poll.Poller {
+			case replay.PollerHealth:
+				result := replayPoll(cacheHealthHandler, entry.Time, *entry.Poll)
+				processHealthResult(
+					nil,
+					toData,
+					localStates,
+					lastHealthDurations,
+					monitorConfig,
+					combinedStates,
+					threadsafe.NewUint(),
+					threadsafe.NewUint(),
+					events,
+					localCacheStatus,
+					lastHealthEndTimes,
+					healthHistory,
+					[]cache.Result{result},
+					cfg,
+					nil,
+				)
+			case replay.PollerStat:
+				result := replayPoll(cacheStatHandler, entry.Time, *entry.Poll)
+				stats.process(result, combinedStates, toData, monitorConfig, localStates, events, localCacheStatus, overrideMap, cfg)
+			case replay.PollerPeer:
+				result := replayPeerPoll(peerHandler, entry.Time, *entry.Poll)
+				comparePeerState(events, result, peerStates)
+				peerStates.Set(result)
+				// SetPeers only marks peers which have been polled, and Traffic Monitor calls it every monitor config poll, not only when the config changes.
+				peerStates.SetPeers(peerSet)
+			}
+		}
+
+		combineCrStates(events, true, peerStates, localStates.Get(), combinedStates, overrideMap, toData.Get())
+		states := combinedStates.Get()
+		statesBytes, err := json.Marshal(states)
+		if err != nil {
+			return fmt.Errorf("encoding states at %v: %v", entry.Time, err)
+		}
+		if bytes.Equal(statesBytes, lastStates) {
+			continue
+		}
+		lastStates = statesBytes
+		f(ReplayState{Time: entry.Time, States: states})
+	}
+}
+
+// replayStats is the stat processing state of a replay, which the stat history manager keeps when Traffic Monitor is running.
+type replayStats struct {
+	statInfoHistory   threadsafe.ResultInfoHistory
+	statResultHistory threadsafe.ResultStatHistory
+	statMaxKbpses     threadsafe.CacheKbpses
+	lastStats         threadsafe.LastStats
+	dsStats           threadsafe.DSStats
+	lastStatEndTimes  map[tc.CacheName]time.Time
+	lastStatDurations threadsafe.DurationMap
+	unpolledCaches    threadsafe.UnpolledCaches
+	precomputedData   map[tc.CacheName]cache.PrecomputedData
+	lastResults       map[tc.CacheName]cache.Result
+}
+
+func newReplayStats() *replayStats {
+	return &replayStats{
+		statInfoHistory:   threadsafe.NewResultInfoHistory(),
+		statResultHistory: threadsafe.NewResultStatHistory(),
+		statMaxKbpses:     threadsafe.NewCacheKbpses(),
+		lastStats:         threadsafe.NewLastStats(),
+		dsStats:           threadsafe.NewDSStats(),
+		lastStatEndTimes:  map[tc.CacheName]time.Time{},
+		lastStatDurations: threadsafe.NewDurationMap(),
+		unpolledCaches:    threadsafe.NewUnpolledCaches(),
+		precomputedData:   map[tc.CacheName]cache.PrecomputedData{},
+		lastResults:       map[tc.CacheName]cache.Result{},
+	}
+}
+
+// process processes the given stat result, as the stat history manager does, which calculates Delivery Service availability.
+func (s *replayStats) process(
+	result cache.Result,
+	combinedStates peer.CRStatesThreadsafe,
+	toData todata.TODataThreadsafe,
+	monitorConfig threadsafe.TrafficMonitorConfigMap,
+	localStates peer.CRStatesThreadsafe,
+	events health.ThreadsafeEvents,
+	localCacheStatus threadsafe.CacheAvailableStatus,
+	overrideMap map[tc.CacheName]bool,
+	cfg config.Config,
+) {
+	processStatResults(
+		[]cache.Result{result},
+		s.statInfoHistory,
+		s.statResultHistory,
+		s.statMaxKbpses,
+		combinedStates,
+		s.lastStats,
+		toData.Get(),
+		threadsafe.NewUint(),
+		s.dsStats,
+		s.lastStatEndTimes,
+		s.lastStatDurations,
+		s.unpolledCaches,
+		monitorConfig.Get(),
+		s.precomputedData,
+		s.lastResults,
+		localStates,
+		events,
+		localCacheStatus,
+		overrideMap,
+		func() {}, // the replay combines the states after every entry
+		cfg.CachePollingProtocol,
+		nil,
+	)
+}
+
+// replayPoll passes the given recorded poll to the given handler, as the poller would have, and returns the handler's result.
+func replayPoll(h cache.Handler, reqEnd time.Time, poll replay.Poll) cache.Result {
+	rdr := io.Reader(nil)
+	if poll.Body != nil {
+		rdr = bytes.NewReader(poll.Body)
+	}
+	pollFinished := make(chan uint64, 1) // processHealthResult signals this, and there's no poller to wait for it
+	go h.Handle(poll.Cache, rdr, poll.Format, poll.RequestTime, reqEnd, poll.Err(), poll.PollID, poll.UsingIPv4, poll.PollCtx(), pollFinished)
+	return <-h.ResultChan()
+}
+
+// replayPeerPoll passes the given recorded peer poll to the given peer handler, as the poller would have, and returns the handler's result.
+func replayPeerPoll(h peer.Handler, reqEnd time.Time, poll replay.Poll) peer.Result {
+	rdr := io.Reader(nil)
+	if poll.Body != nil {
+		rdr = bytes.NewReader(poll.Body)
+	}
+	go h.Handle(poll.Cache, rdr, poll.Format, poll.RequestTime, reqEnd, poll.Err(), poll.PollID, poll.UsingIPv4, poll.PollCtx(), nil)
+	return <-h.ResultChannel
+}
@@ -0,0 +1,211 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/replay"
+)
+
+func replayTestMonitorConfig() tc.TrafficMonitorConfigMap {
+	return tc.TrafficMonitorConfigMap{
+		TrafficServer: map[string]tc.TrafficServer{
+			"edge1": {
+				HostName:     "edge1",
+				CacheGroup:   "cg1",
+				Profile:      "EDGE_PROFILE",
+				ServerStatus: string(tc.CacheStatusReported),
+				Type:         "EDGE",
+				Interfaces: []tc.ServerInterfaceInfo{{
+					Name:        "eth0",
+					IPAddresses: []tc.ServerIPAddress{{Address: "192.0.2.1", ServiceAddress: true}},
+				}},
+			},
+		},
+		CacheGroup:      map[string]tc.TMCacheGroup{},
+		Config:          map[string]interface{}{},
+		TrafficMonitor:  map[string]tc.TrafficMonitor{},
+		DeliveryService: map[string]tc.TMDeliveryService{},
+		Profile: map[string]tc.TMProfile{
+			"EDGE_PROFILE": {Name: "EDGE_PROFILE", Type: "EDGE", Parameters: tc.TMParameters{HealthPollingFormat: "noop", HistoryCount: 5}},
+		},
+	}
+}
+
+const replayTestCRConfig = `{"contentServers":{"edge1":{"cacheGroup":"cg1","type":"EDGE"}},"deliveryServices":{}}`
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tm-replay-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	archivePath := filepath.Join(dir, "health.record")
+
+	recorder, err := replay.NewRecorder(archivePath)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	start := time.Now().Add(-time.Hour)
+	recorder.RecordConfig("cdn1", "tm1", replayTestMonitorConfig(), []byte(replayTestCRConfig))
+	polls := []error{nil, nil, nil, errors.New("connection refused"), nil, nil}
+	for i, pollErr := range polls {
+		poll := replay.Poll{Poller: replay.PollerHealth, Cache: "edge1", Format: "noop", Body: []byte("{}"), RequestTime: time.Millisecond, PollID: uint64(i + 1), UsingIPv4: true}
+		if pollErr != nil {
+			poll.Body = nil
+			poll.Error = pollErr.Error()
+		}
+		recorder.RecordPoll(start.Add(time.Duration(i)*time.Second), poll)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("closing recorder: %v", err)
+	}
+
+	cfg := config.DefaultConfig
+	cfg.CachePollingProtocol = config.IPv4Only
+
+	replayArchive := func() []ReplayState {
+		archive, err := os.Open(archivePath)
+		if err != nil {
+			t.Fatalf("opening archive: %v", err)
+		}
+		defer archive.Close()
+		timeline := []ReplayState{}
+		if err := Replay(archive, cfg, func(s ReplayState) { timeline = append(timeline, s) }); err != nil {
+			t.Fatalf("replaying: %v", err)
+		}
+		return timeline
+	}
+
+	timeline := replayArchive()
+	// The config seeds the cache unavailable, and a cache is only marked available by a poll after its first, so the
+	// second poll makes it available, the failed poll unavailable, and the poll after that available again.
+	expected := []struct {
+		time      time.Time
+		available bool
+	}{
+		{time.Time{}, false}, // the config, which is recorded with the current time
+		{start.Add(1 * time.Second), true},
+		{start.Add(3 * time.Second), false},
+		{start.Add(4 * time.Second), true},
+	}
+	if len(timeline) != len(expected) {
+		t.Fatalf("expected %d state changes, actual %d: %+v", len(expected), len(timeline), timeline)
+	}
+	for i, state := range timeline {
+		if !expected[i].time.IsZero() && !state.Time.Equal(expected[i].time) {
+			t.Errorf("state %d: expected time %v, actual %v", i, expected[i].time, state.Time)
+		}
+		if actual := state.States.Caches["edge1"].IsAvailable; actual != expected[i].available {
+			t.Errorf("state %d: expected edge1 available %t, actual %t", i, expected[i].available, actual)
+		}
+	}
+
+	// replaying again must produce the same timeline, for replay to be useful for regression testing
+	again := replayArchive()
+	if len(again) != len(timeline) {
+		t.Fatalf("expected replaying again to produce %d states, actual %d", len(timeline), len(again))
+	}
+	for i := range again {
+		if !again[i].Time.Equal(timeline[i].Time) || again[i].States.Caches["edge1"] != timeline[i].States.Caches["edge1"] {
+			t.Errorf("state %d: expected replaying again to produce %+v, actual %+v", i, timeline[i], again[i])
+		}
+	}
+}
+
+func TestReplayStatAndPeerPolls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tm-replay-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	archivePath := filepath.Join(dir, "health.record")
+
+	recorder, err := replay.NewRecorder(archivePath)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+
+	monitorConfig := replayTestMonitorConfig()
+	monitorConfig.DeliveryService["ds1"] = tc.TMDeliveryService{XMLID: "ds1", ServerStatus: string(tc.CacheStatusReported)}
+	monitorConfig.TrafficMonitor["tm1"] = tc.TrafficMonitor{HostName: "tm1", ServerStatus: string(tc.CacheStatusOnline)}
+	monitorConfig.TrafficMonitor["tm2"] = tc.TrafficMonitor{HostName: "tm2", ServerStatus: string(tc.CacheStatusOnline)}
+	crConfig := `{"contentServers":{"edge1":{"cacheGroup":"cg1","type":"EDGE","deliveryServices":{"ds1":["edge1.ds1.example"]}}},"deliveryServices":{"ds1":{"matchsets":[{"protocol":"HTTP","matchlist":[{"regex":".*\\\\.ds1\\\\..*"}]}]}}}`
+	recorder.RecordConfig("cdn1", "tm1", monitorConfig, []byte(crConfig))
+
+	start := time.Now().Add(-time.Hour)
+	healthPoll := func(i int, pollErr error) {
+		poll := replay.Poll{Poller: replay.PollerHealth, Cache: "edge1", Format: "noop", Body: []byte("{}"), RequestTime: time.Millisecond, PollID: uint64(i), UsingIPv4: true}
+		if pollErr != nil {
+			poll.Body = nil
+			poll.Error = pollErr.Error()
+		}
+		recorder.RecordPoll(start.Add(time.Duration(i)*time.Second), poll)
+	}
+	healthPoll(1, nil)
+	healthPoll(2, nil)
+	recorder.RecordPoll(start.Add(3*time.Second), replay.Poll{Poller: replay.PollerStat, Cache: "edge1", Format: "noop", Body: []byte("{}"), RequestTime: time.Millisecond, PollID: 3, UsingIPv4: true})
+	healthPoll(4, errors.New("connection refused"))
+	peerStates := `{"caches":{"edge1":{"isAvailable":true,"ipv4Available":true,"ipv6Available":false}},"deliveryServices":{}}`
+	recorder.RecordPoll(start.Add(5*time.Second), replay.Poll{Poller: replay.PollerPeer, Cache: "tm2", Body: []byte(peerStates), RequestTime: time.Millisecond, PollID: 5, UsingIPv4: true})
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("closing recorder: %v", err)
+	}
+
+	cfg := config.DefaultConfig
+	cfg.CachePollingProtocol = config.IPv4Only
+
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("opening archive: %v", err)
+	}
+	defer archive.Close()
+	states := map[int64]tc.CRStates{} // map[unixNano]states
+	if err := Replay(archive, cfg, func(s ReplayState) { states[s.Time.UnixNano()] = s.States }); err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+
+	statState, ok := states[start.Add(3*time.Second).UnixNano()]
+	if !ok {
+		t.Fatalf("expected the stat poll to change the states, actual timeline %+v", states)
+	}
+	if !statState.DeliveryService["ds1"].IsAvailable {
+		t.Errorf("expected the stat poll to make ds1 available, actual %+v", statState.DeliveryService["ds1"])
+	}
+
+	if failState := states[start.Add(4*time.Second).UnixNano()]; failState.Caches["edge1"].IsAvailable {
+		t.Errorf("expected the failed health poll to make edge1 unavailable, actual %+v", failState.Caches["edge1"])
+	}
+	peerState, ok := states[start.Add(5*time.Second).UnixNano()]
+	if !ok {
+		t.Fatalf("expected the peer poll to change the states, actual timeline %+v", states)
+	}
+	if !peerState.Caches["edge1"].IsAvailable {
+		t.Errorf("expected the peer poll to make edge1 optimistically available, actual %+v", peerState.Caches["edge1"])
+	}
+}
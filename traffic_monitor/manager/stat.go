@@ -31,6 +31,7 @@ import (
 	"github.com/apache/trafficcontrol/traffic_monitor/ds"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/statstore"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 )
@@ -69,6 +70,7 @@ func StartStatHistoryManager(
 	monitorConfig threadsafe.TrafficMonitorConfigMap,
 	events health.ThreadsafeEvents,
 	combineState func(),
+	statStore *statstore.Store,
 ) (threadsafe.ResultInfoHistory, threadsafe.ResultStatHistory, threadsafe.CacheKbpses, threadsafe.DurationMap, threadsafe.LastStats, threadsafe.DSStatsReader, threadsafe.UnpolledCaches, threadsafe.CacheAvailableStatus) {
 	statInfoHistory := threadsafe.NewResultInfoHistory()
 	statResultHistory := threadsafe.NewResultStatHistory()
@@ -98,7 +100,7 @@ func StartStatHistoryManager(
 		if haveCachesChanged() {
 			unpolledCaches.SetNewCaches(getNewCaches(localStates, monitorConfig))
 		}
-		processStatResults(results, statInfoHistory, statResultHistory, statMaxKbpses, combinedStates, lastStats, toData.Get(), errorCount, dsStats, lastStatEndTimes, lastStatDurations, unpolledCaches, monitorConfig.Get(), precomputedData, lastResults, localStates, events, localCacheStatus, overrideMap, combineState, cfg.CachePollingProtocol)
+		processStatResults(results, statInfoHistory, statResultHistory, statMaxKbpses, combinedStates, lastStats, toData.Get(), errorCount, dsStats, lastStatEndTimes, lastStatDurations, unpolledCaches, monitorConfig.Get(), precomputedData, lastResults, localStates, events, localCacheStatus, overrideMap, combineState, cfg.CachePollingProtocol, statStore)
 	}
 
 	go func() {
@@ -255,6 +257,7 @@ func processStatResults(
 	overrideMap map[tc.CacheName]bool,
 	combineState func(),
 	pollingProtocol config.PollingProtocol,
+	statStore *statstore.Store,
 ) {
 	if len(results) == 0 {
 		return
@@ -291,6 +294,9 @@ func processStatResults(
 		if err := statResultHistoryThreadsafe.Add(result, maxStats); err != nil {
 			log.Errorf("Adding result from %v: %v\n", result.ID, err)
 		}
+		if statStore != nil {
+			statStore.Add(result, statstore.PollerStat)
+		}
 		// Don't add errored maxes or precomputed DSStats
 		if result.Error == nil {
 			// max and precomputed always contain the latest result from each cache
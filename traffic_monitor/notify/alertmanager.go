@@ -0,0 +1,94 @@
+package notify
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+)
+
+// AlertnamePrefix is the prefix of the alertname label of alerts pushed to
+// Alertmanager. The event type is appended, e.g. TrafficMonitorEDGEUnavailable.
+const AlertnamePrefix = "TrafficMonitor"
+
+// Alertmanager is a Notifier which pushes alerts to the Alertmanager v2 API.
+//
+// Alertmanager resolves alerts which haven't been pushed within its
+// resolve_timeout, so the dedup window of routes to it should be less than that.
+type Alertmanager struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// AlertmanagerAlert is an alert, as posted to the Alertmanager v2 API.
+type AlertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+}
+
+// NewAlertmanager creates an Alertmanager notifier from the given config.
+func NewAlertmanager(cfg config.NotifierConfig) (*Alertmanager, error) {
+	if err := validateURL(cfg); err != nil {
+		return nil, err
+	}
+	return &Alertmanager{url: cfg.URL, headers: cfg.Headers, client: &http.Client{Timeout: cfg.Timeout()}}, nil
+}
+
+// Notify implements Notifier.
+func (a *Alertmanager) Notify(n Notification) error {
+	return postJSON(a.client, a.url, a.headers, AlertmanagerAlerts(n))
+}
+
+// AlertmanagerAlerts converts the given notification to Alertmanager alerts.
+// Resolved alerts have an EndsAt, which makes Alertmanager resolve them.
+func AlertmanagerAlerts(n Notification) []AlertmanagerAlert {
+	amAlerts := make([]AlertmanagerAlert, 0, len(n.Alerts))
+	for _, alert := range n.Alerts {
+		amAlert := AlertmanagerAlert{
+			Labels: map[string]string{
+				"alertname": AlertnamePrefix + strings.Replace(strings.ToUpper(alert.Type), " ", "", -1) + "Unavailable",
+				"cdn":       alert.CDN,
+				"name":      alert.Name,
+				"type":      alert.Type,
+			},
+			Annotations: map[string]string{
+				"description": alert.Description,
+			},
+			StartsAt: alert.StartsAt,
+		}
+		if alert.Cachegroup != "" {
+			amAlert.Labels["cachegroup"] = alert.Cachegroup
+		}
+		if len(alert.DeliveryServices) > 0 {
+			amAlert.Annotations["deliveryServices"] = strings.Join(alert.DeliveryServices, ",")
+		}
+		if alert.Status == StatusResolved {
+			amAlert.EndsAt = alert.EndsAt
+		}
+		amAlerts = append(amAlerts, amAlert)
+	}
+	return amAlerts
+}
@@ -0,0 +1,426 @@
+// Package notify sends alert notifications for Traffic Monitor health events,
+// such as a cache or Delivery Service becoming unavailable, to configured
+// webhook, Alertmanager, and SMTP targets.
+package notify
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/handler"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+const (
+	// StatusFiring is the status of an alert for something which became
+	// unavailable.
+	StatusFiring = "firing"
+	// StatusResolved is the status of an alert for something which was
+	// unavailable, and became available again.
+	StatusResolved = "resolved"
+)
+
+// eventBufferLen is the number of events which may be waiting to be routed
+// before new events are dropped.
+const eventBufferLen = 1024
+
+// tickInterval is how often pending groups are checked for being ready to send.
+const tickInterval = time.Second
+
+// retryInterval is how long after failing to send to a notifier the alerts are sent again.
+const retryInterval = 30 * time.Second
+
+// Alert is the notification of a single thing, such as a cache, becoming
+// unavailable or available again.
+type Alert struct {
+	Status string `json:"status"`
+	// Name is the name of the cache, Delivery Service, or peer.
+	Name string `json:"name"`
+	// Type is the health event type, e.g. EDGE, MID, DELIVERYSERVICE, or PEER.
+	Type             string    `json:"type"`
+	Description      string    `json:"description"`
+	CDN              string    `json:"cdn"`
+	Cachegroup       string    `json:"cachegroup,omitempty"`
+	DeliveryServices []string  `json:"deliveryServices,omitempty"`
+	StartsAt         time.Time `json:"startsAt"`
+	// EndsAt is when a resolved alert became available again. It's nil for
+	// firing alerts.
+	EndsAt *time.Time `json:"endsAt,omitempty"`
+}
+
+// key uniquely identifies the thing an alert is about.
+func (a Alert) key() string {
+	return strings.ToUpper(a.Type) + "/" + a.Name
+}
+
+// Notification is a group of alerts sent together to a notifier.
+type Notification struct {
+	CDN    string  `json:"cdn"`
+	Alerts []Alert `json:"alerts"`
+}
+
+// Firing returns the number of firing alerts in the notification.
+func (n Notification) Firing() int {
+	firing := 0
+	for _, alert := range n.Alerts {
+		if alert.Status == StatusFiring {
+			firing++
+		}
+	}
+	return firing
+}
+
+// Notifier sends notifications to a single target.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// NewNotifier creates the Notifier for the given config.
+func NewNotifier(cfg config.NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case config.NotifierTypeWebhook:
+		return NewWebhook(cfg)
+	case config.NotifierTypeAlertmanager:
+		return NewAlertmanager(cfg)
+	case config.NotifierTypeSMTP:
+		return NewSMTP(cfg)
+	default:
+		return nil, fmt.Errorf("notifier '%s' has unknown type '%s'", cfg.Name, cfg.Type)
+	}
+}
+
+// Dispatcher routes health events to notifiers. Events are received from
+// health.ThreadsafeEvents via Listen, and notifications are sent by Run.
+type Dispatcher struct {
+	// OpsConfigChannel receives the ops config, to learn the monitored CDN.
+	OpsConfigChannel chan handler.OpsConfig
+	events           chan health.Event
+	toData           todata.TODataThreadsafe
+	routes           []*route
+	cdn              string
+}
+
+// route is a single configured route to a single notifier, and its pending and
+// sent alerts. Each notifier of a configured route is its own route, so alerts
+// which fail to send to one notifier are retried without resending them to the
+// others.
+type route struct {
+	cfg          config.NotificationRoute
+	name         string
+	notifier     Notifier
+	groupWait    time.Duration
+	dedupWindow  time.Duration
+	sendResolved bool
+	eventTypes   map[string]struct{}
+
+	// pending is the latest alert for each key since the last send.
+	pending      map[string]Alert
+	pendingSince time.Time
+	// firing is the last firing alert sent for each key, which hasn't been
+	// resolved, with the time it was sent.
+	firing map[string]sentAlert
+	// retryAt is when to send again, after sending failed.
+	retryAt time.Time
+}
+
+type sentAlert struct {
+	alert Alert
+	at    time.Time
+}
+
+// New creates a Dispatcher for the given config. It returns an error if the
+// config is invalid, such as a route with an unknown notifier.
+func New(cfg config.NotificationConfig, toData todata.TODataThreadsafe) (*Dispatcher, error) {
+	notifiers := map[string]Notifier{}
+	for _, notifierCfg := range cfg.Notifiers {
+		if notifierCfg.Name == "" {
+			return nil, errors.New("notifier missing name")
+		}
+		if _, ok := notifiers[notifierCfg.Name]; ok {
+			return nil, fmt.Errorf("duplicate notifier name '%s'", notifierCfg.Name)
+		}
+		notifier, err := NewNotifier(notifierCfg)
+		if err != nil {
+			return nil, err
+		}
+		notifiers[notifierCfg.Name] = notifier
+	}
+
+	d := &Dispatcher{
+		OpsConfigChannel: make(chan handler.OpsConfig),
+		events:           make(chan health.Event, eventBufferLen),
+		toData:           toData,
+	}
+	for i, routeCfg := range cfg.Routes {
+		if len(routeCfg.Notifiers) == 0 {
+			return nil, fmt.Errorf("route %d has no notifiers", i)
+		}
+		groupWait := cfg.GroupWait()
+		if routeCfg.GroupWaitMs != nil {
+			groupWait = time.Duration(*routeCfg.GroupWaitMs) * time.Millisecond
+		}
+		dedupWindow := cfg.DedupWindow()
+		if routeCfg.DedupWindowMs != nil {
+			dedupWindow = time.Duration(*routeCfg.DedupWindowMs) * time.Millisecond
+		}
+		eventTypes := map[string]struct{}{}
+		for _, eventType := range routeCfg.EventTypes {
+			eventTypes[strings.ToUpper(eventType)] = struct{}{}
+		}
+		for _, name := range routeCfg.Notifiers {
+			notifier, ok := notifiers[name]
+			if !ok {
+				return nil, fmt.Errorf("route %d has unknown notifier '%s'", i, name)
+			}
+			d.routes = append(d.routes, &route{
+				cfg:          routeCfg,
+				name:         name,
+				notifier:     notifier,
+				groupWait:    groupWait,
+				dedupWindow:  dedupWindow,
+				sendResolved: routeCfg.SendResolved == nil || *routeCfg.SendResolved,
+				eventTypes:   eventTypes,
+				pending:      map[string]Alert{},
+				firing:       map[string]sentAlert{},
+			})
+		}
+	}
+	return d, nil
+}
+
+// Listen queues the given event to be routed. It never blocks, and is meant to
+// be given to health.NewThreadsafeEvents as a listener.
+func (d *Dispatcher) Listen(e health.Event) {
+	select {
+	case d.events <- e:
+	default:
+		log.Warnf("notify: event queue full, dropping event for '%s': %s\n", e.Name, e.Description)
+	}
+}
+
+// Run routes events and sends notifications. It never returns.
+func (d *Dispatcher) Run() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case opsConfig := <-d.OpsConfigChannel:
+			d.cdn = opsConfig.CdnName
+		case e := <-d.events:
+			d.route(d.alertFromEvent(e), time.Now())
+		case now := <-ticker.C:
+			d.flush(now)
+		}
+	}
+}
+
+// deliveryServiceEventType is the alert type of all Delivery Service events.
+const deliveryServiceEventType = "DELIVERYSERVICE"
+
+// isDeliveryServiceEvent returns whether the given event type is that of a
+// Delivery Service event. For historical reasons, there are two, which are
+// both given the alert type deliveryServiceEventType, so they're deduplicated.
+func isDeliveryServiceEvent(eventType string) bool {
+	return eventType == deliveryServiceEventType || eventType == "Delivery Service"
+}
+
+// alertFromEvent creates an alert for the given event, with the Cache Group
+// and Delivery Services of the cache it's about, if any.
+func (d *Dispatcher) alertFromEvent(e health.Event) Alert {
+	alert := Alert{
+		Status:      StatusFiring,
+		Name:        e.Name,
+		Type:        e.Type,
+		Description: e.Description,
+		CDN:         d.cdn,
+		StartsAt:    time.Time(e.Time),
+	}
+	if e.Available {
+		endsAt := time.Time(e.Time)
+		alert.Status = StatusResolved
+		alert.EndsAt = &endsAt
+	}
+	if isDeliveryServiceEvent(e.Type) {
+		alert.Type = deliveryServiceEventType
+		alert.DeliveryServices = []string{e.Name}
+		return alert
+	}
+	toData := d.toData.Get()
+	alert.Cachegroup = string(toData.ServerCachegroups[tc.CacheName(e.Name)])
+	for _, ds := range toData.ServerDeliveryServices[tc.CacheName(e.Name)] {
+		alert.DeliveryServices = append(alert.DeliveryServices, string(ds))
+	}
+	sort.Strings(alert.DeliveryServices)
+	return alert
+}
+
+// route adds the given alert to the pending alerts of every route it matches.
+func (d *Dispatcher) route(alert Alert, now time.Time) {
+	for _, r := range d.routes {
+		if !r.matches(alert) {
+			continue
+		}
+		if len(r.pending) == 0 {
+			r.pendingSince = now
+		}
+		r.pending[alert.key()] = alert
+	}
+}
+
+// flush sends the pending alerts of every route whose group wait has elapsed,
+// and reminders for alerts still firing after the dedup window. If sending
+// fails, nothing is recorded as sent, so the same alerts are sent again after
+// the retry interval.
+func (d *Dispatcher) flush(now time.Time) {
+	for _, r := range d.routes {
+		if now.Before(r.retryAt) {
+			continue
+		}
+		alerts := r.ready(now)
+		if len(alerts) > 0 {
+			if err := r.notifier.Notify(Notification{CDN: d.cdn, Alerts: alerts}); err != nil {
+				log.Errorf("notify: sending %d alerts to notifier '%s', retrying in %v: %v\n", len(alerts), r.name, retryInterval, err)
+				r.retryAt = now.Add(retryInterval)
+				continue
+			}
+		}
+		r.sent(now)
+	}
+}
+
+// matches returns whether the given alert matches all of the route's filters.
+func (r *route) matches(alert Alert) bool {
+	if len(r.eventTypes) > 0 {
+		if _, ok := r.eventTypes[strings.ToUpper(alert.Type)]; !ok {
+			return false
+		}
+	}
+	if len(r.cfg.CDNs) > 0 && !contains(r.cfg.CDNs, alert.CDN) {
+		return false
+	}
+	if len(r.cfg.Cachegroups) > 0 && !contains(r.cfg.Cachegroups, alert.Cachegroup) {
+		return false
+	}
+	if len(r.cfg.DeliveryServices) > 0 {
+		found := false
+		for _, ds := range alert.DeliveryServices {
+			if contains(r.cfg.DeliveryServices, ds) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// groupReady returns whether the pending alerts' group wait has elapsed.
+func (r *route) groupReady(now time.Time) bool {
+	return len(r.pending) > 0 && now.Sub(r.pendingSince) >= r.groupWait
+}
+
+// remind returns whether the given sent firing alert should be sent again.
+func (r *route) remind(sent sentAlert, now time.Time) bool {
+	return r.dedupWindow > 0 && now.Sub(sent.at) >= r.dedupWindow
+}
+
+// ready returns the alerts to send now. Pending alerts are deduplicated against
+// what was already sent: a firing alert is only sent if it wasn't already
+// firing within the dedup window, and a resolved alert is only sent if its
+// firing alert was sent. Nothing is recorded as sent until sent is called.
+func (r *route) ready(now time.Time) []Alert {
+	alerts := []Alert{}
+	resolved := map[string]struct{}{}
+	if r.groupReady(now) {
+		for key, alert := range r.pending {
+			sent, wasFiring := r.firing[key]
+			switch alert.Status {
+			case StatusFiring:
+				if wasFiring {
+					continue // still firing, reminders are sent below
+				}
+				alerts = append(alerts, alert)
+			case StatusResolved:
+				if !wasFiring {
+					continue // we never notified it was unavailable
+				}
+				resolved[key] = struct{}{}
+				if r.sendResolved {
+					alert.StartsAt = sent.alert.StartsAt
+					alerts = append(alerts, alert)
+				}
+			}
+		}
+	}
+
+	for key, sent := range r.firing {
+		if _, ok := resolved[key]; ok || !r.remind(sent, now) {
+			continue
+		}
+		alerts = append(alerts, sent.alert)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].key() < alerts[j].key() })
+	return alerts
+}
+
+// sent records the alerts which were ready at the given time as sent.
+func (r *route) sent(now time.Time) {
+	for key, sent := range r.firing {
+		if r.remind(sent, now) {
+			r.firing[key] = sentAlert{alert: sent.alert, at: now}
+		}
+	}
+	if !r.groupReady(now) {
+		return
+	}
+	for key, alert := range r.pending {
+		_, wasFiring := r.firing[key]
+		switch alert.Status {
+		case StatusFiring:
+			if !wasFiring {
+				r.firing[key] = sentAlert{alert: alert, at: now}
+			}
+		case StatusResolved:
+			delete(r.firing, key)
+		}
+	}
+	r.pending = map[string]Alert{}
+}
+
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
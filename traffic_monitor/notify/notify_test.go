@@ -0,0 +1,352 @@
+package notify
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+type fakeNotifier struct {
+	sent []Notification
+	// err, if not nil, is returned by Notify instead of sending.
+	err error
+}
+
+func (f *fakeNotifier) Notify(n Notification) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, n)
+	return nil
+}
+
+func uint64Ptr(u uint64) *uint64 { return &u }
+
+// newTestDispatcher creates a Dispatcher with a single route to a fake
+// notifier, with a 10s group wait and 1m dedup window.
+func newTestDispatcher(t *testing.T, routeCfg config.NotificationRoute) (*Dispatcher, *fakeNotifier) {
+	routeCfg.Notifiers = []string{"hook"}
+	cfg := config.NotificationConfig{
+		GroupWaitMs:   uint64Ptr(10000),
+		DedupWindowMs: uint64Ptr(60000),
+		Notifiers:     []config.NotifierConfig{{Name: "hook", Type: config.NotifierTypeWebhook, URL: "http://localhost/"}},
+		Routes:        []config.NotificationRoute{routeCfg},
+	}
+	d, err := New(cfg, todata.NewThreadsafe())
+	if err != nil {
+		t.Fatalf("creating dispatcher: %v", err)
+	}
+	fake := &fakeNotifier{}
+	d.routes[0].notifier = fake
+	d.cdn = "cdn1"
+	return d, fake
+}
+
+func cacheEvent(name string, available bool, at time.Time) health.Event {
+	return health.Event{Time: health.Time(at), Name: name, Type: "EDGE", Available: available, Description: "test"}
+}
+
+func TestDispatcherGroupsAndDedups(t *testing.T) {
+	d, fake := newTestDispatcher(t, config.NotificationRoute{})
+	start := time.Now()
+
+	d.route(d.alertFromEvent(cacheEvent("edge1", false, start)), start)
+	d.route(d.alertFromEvent(cacheEvent("edge2", false, start)), start.Add(time.Second))
+	d.flush(start.Add(5 * time.Second))
+	if len(fake.sent) != 0 {
+		t.Fatalf("expected nothing sent before group wait, actual %d notifications", len(fake.sent))
+	}
+
+	d.flush(start.Add(10 * time.Second))
+	if len(fake.sent) != 1 {
+		t.Fatalf("expected 1 notification after group wait, actual %d", len(fake.sent))
+	}
+	if n := fake.sent[0]; n.CDN != "cdn1" || len(n.Alerts) != 2 || n.Firing() != 2 || n.Alerts[0].Name != "edge1" || n.Alerts[1].Name != "edge2" {
+		t.Fatalf("expected 2 firing alerts for edge1 and edge2 on cdn1, actual %+v", n)
+	}
+
+	// still unavailable, within the dedup window
+	d.route(d.alertFromEvent(cacheEvent("edge1", false, start.Add(20*time.Second))), start.Add(20*time.Second))
+	d.flush(start.Add(30 * time.Second))
+	if len(fake.sent) != 1 {
+		t.Fatalf("expected repeated firing alert to be deduplicated, actual %d notifications", len(fake.sent))
+	}
+
+	d.route(d.alertFromEvent(cacheEvent("edge1", true, start.Add(40*time.Second))), start.Add(40*time.Second))
+	d.flush(start.Add(50 * time.Second))
+	if len(fake.sent) != 2 {
+		t.Fatalf("expected resolved notification, actual %d notifications", len(fake.sent))
+	}
+	resolved := fake.sent[1].Alerts
+	if len(resolved) != 1 || resolved[0].Status != StatusResolved || resolved[0].Name != "edge1" || !resolved[0].StartsAt.Equal(start) || resolved[0].EndsAt == nil {
+		t.Fatalf("expected resolved edge1 alert starting at the original firing time, actual %+v", resolved)
+	}
+
+	// edge2 has been firing for longer than the dedup window
+	d.flush(start.Add(71 * time.Second))
+	if len(fake.sent) != 3 {
+		t.Fatalf("expected reminder notification, actual %d notifications", len(fake.sent))
+	}
+	if reminder := fake.sent[2].Alerts; len(reminder) != 1 || reminder[0].Name != "edge2" || reminder[0].Status != StatusFiring {
+		t.Fatalf("expected firing reminder for edge2, actual %+v", reminder)
+	}
+}
+
+func TestDispatcherSuppressesFlaps(t *testing.T) {
+	d, fake := newTestDispatcher(t, config.NotificationRoute{})
+	start := time.Now()
+
+	d.route(d.alertFromEvent(cacheEvent("edge1", false, start)), start)
+	d.route(d.alertFromEvent(cacheEvent("edge1", true, start.Add(time.Second))), start.Add(time.Second))
+	d.flush(start.Add(time.Minute))
+	if len(fake.sent) != 0 {
+		t.Fatalf("expected no notification for an alert resolved within the group wait, actual %+v", fake.sent)
+	}
+}
+
+func TestDispatcherSendResolvedFalse(t *testing.T) {
+	sendResolved := false
+	d, fake := newTestDispatcher(t, config.NotificationRoute{SendResolved: &sendResolved})
+	start := time.Now()
+
+	d.route(d.alertFromEvent(cacheEvent("edge1", false, start)), start)
+	d.flush(start.Add(10 * time.Second))
+	d.route(d.alertFromEvent(cacheEvent("edge1", true, start.Add(20*time.Second))), start.Add(20*time.Second))
+	d.flush(start.Add(30 * time.Second))
+	d.flush(start.Add(2 * time.Minute))
+	if len(fake.sent) != 1 {
+		t.Fatalf("expected only the firing notification, actual %+v", fake.sent)
+	}
+}
+
+func TestDispatcherRetriesFailedSends(t *testing.T) {
+	d, fake := newTestDispatcher(t, config.NotificationRoute{})
+	start := time.Now()
+
+	fake.err = errors.New("unreachable")
+	d.route(d.alertFromEvent(cacheEvent("edge1", false, start)), start)
+	d.flush(start.Add(10 * time.Second))
+	fake.err = nil
+	d.flush(start.Add(20 * time.Second))
+	if len(fake.sent) != 0 {
+		t.Fatalf("expected nothing sent before the retry interval, actual %+v", fake.sent)
+	}
+	d.flush(start.Add(10*time.Second + retryInterval))
+	if len(fake.sent) != 1 || len(fake.sent[0].Alerts) != 1 || fake.sent[0].Alerts[0].Status != StatusFiring {
+		t.Fatalf("expected the failed firing alert to be retried, actual %+v", fake.sent)
+	}
+
+	fake.err = errors.New("unreachable")
+	resolvedAt := start.Add(time.Minute)
+	d.route(d.alertFromEvent(cacheEvent("edge1", true, resolvedAt)), resolvedAt)
+	d.flush(resolvedAt.Add(10 * time.Second))
+	fake.err = nil
+	d.flush(resolvedAt.Add(10*time.Second + retryInterval))
+	if len(fake.sent) != 2 || len(fake.sent[1].Alerts) != 1 || fake.sent[1].Alerts[0].Status != StatusResolved {
+		t.Fatalf("expected the failed resolved alert to be retried, actual %+v", fake.sent)
+	}
+}
+
+func TestDispatcherRetriesOnlyFailedNotifier(t *testing.T) {
+	cfg := config.NotificationConfig{
+		GroupWaitMs: uint64Ptr(10000),
+		Notifiers: []config.NotifierConfig{
+			{Name: "hook0", Type: config.NotifierTypeWebhook, URL: "http://localhost/"},
+			{Name: "hook1", Type: config.NotifierTypeWebhook, URL: "http://localhost/"},
+		},
+		Routes: []config.NotificationRoute{{Notifiers: []string{"hook0", "hook1"}}},
+	}
+	d, err := New(cfg, todata.NewThreadsafe())
+	if err != nil {
+		t.Fatalf("creating dispatcher: %v", err)
+	}
+	if len(d.routes) != 2 {
+		t.Fatalf("expected a route per notifier, actual %d routes", len(d.routes))
+	}
+	ok, failing := &fakeNotifier{}, &fakeNotifier{err: errors.New("unreachable")}
+	d.routes[0].notifier, d.routes[1].notifier = ok, failing
+	start := time.Now()
+
+	d.route(d.alertFromEvent(cacheEvent("edge1", false, start)), start)
+	d.flush(start.Add(10 * time.Second))
+	failing.err = nil
+	d.flush(start.Add(10*time.Second + retryInterval))
+	if len(ok.sent) != 1 {
+		t.Errorf("expected the notifier which didn't fail to be sent 1 notification, actual %d", len(ok.sent))
+	}
+	if len(failing.sent) != 1 {
+		t.Errorf("expected the notifier which failed to be retried, actual %d notifications", len(failing.sent))
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	alert := Alert{Name: "edge1", Type: "EDGE", CDN: "cdn1", Cachegroup: "cg1", DeliveryServices: []string{"ds1", "ds2"}}
+	tests := []struct {
+		name    string
+		cfg     config.NotificationRoute
+		matches bool
+	}{
+		{"no filters", config.NotificationRoute{}, true},
+		{"event type", config.NotificationRoute{EventTypes: []string{"edge"}}, true},
+		{"other event type", config.NotificationRoute{EventTypes: []string{"MID"}}, false},
+		{"cdn", config.NotificationRoute{CDNs: []string{"cdn0", "cdn1"}}, true},
+		{"other cdn", config.NotificationRoute{CDNs: []string{"cdn2"}}, false},
+		{"cachegroup", config.NotificationRoute{Cachegroups: []string{"cg1"}}, true},
+		{"other cachegroup", config.NotificationRoute{Cachegroups: []string{"cg2"}}, false},
+		{"delivery service", config.NotificationRoute{DeliveryServices: []string{"ds2", "ds3"}}, true},
+		{"other delivery service", config.NotificationRoute{DeliveryServices: []string{"ds3"}}, false},
+		{"all filters", config.NotificationRoute{CDNs: []string{"cdn1"}, Cachegroups: []string{"cg1"}, EventTypes: []string{"EDGE"}}, true},
+		{"one filter mismatch", config.NotificationRoute{CDNs: []string{"cdn1"}, Cachegroups: []string{"cg2"}}, false},
+	}
+	for _, test := range tests {
+		d, _ := newTestDispatcher(t, test.cfg)
+		if actual := d.routes[0].matches(alert); actual != test.matches {
+			t.Errorf("route '%s': expected matches %t, actual %t", test.name, test.matches, actual)
+		}
+	}
+}
+
+func TestAlertFromDeliveryServiceEvent(t *testing.T) {
+	d, _ := newTestDispatcher(t, config.NotificationRoute{})
+	legacy := d.alertFromEvent(health.Event{Name: "ds1", Type: "Delivery Service", Description: "test"})
+	current := d.alertFromEvent(health.Event{Name: "ds1", Type: "DELIVERYSERVICE", Description: "test"})
+	if legacy.key() != current.key() {
+		t.Errorf("expected both Delivery Service event types to have the same key, actual '%s' and '%s'", legacy.key(), current.key())
+	}
+	if len(current.DeliveryServices) != 1 || current.DeliveryServices[0] != "ds1" {
+		t.Errorf("expected Delivery Service alert to have its Delivery Service, actual %+v", current.DeliveryServices)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	hook := config.NotifierConfig{Name: "hook", Type: config.NotifierTypeWebhook, URL: "http://localhost/"}
+	tests := []struct {
+		name string
+		cfg  config.NotificationConfig
+	}{
+		{"unknown notifier", config.NotificationConfig{Notifiers: []config.NotifierConfig{hook}, Routes: []config.NotificationRoute{{Notifiers: []string{"other"}}}}},
+		{"duplicate notifier", config.NotificationConfig{Notifiers: []config.NotifierConfig{hook, hook}}},
+		{"unknown type", config.NotificationConfig{Notifiers: []config.NotifierConfig{{Name: "x", Type: "pager"}}}},
+		{"invalid url", config.NotificationConfig{Notifiers: []config.NotifierConfig{{Name: "x", Type: config.NotifierTypeWebhook, URL: "ftp://localhost/"}}}},
+		{"route without notifiers", config.NotificationConfig{Notifiers: []config.NotifierConfig{hook}, Routes: []config.NotificationRoute{{}}}},
+		{"smtp missing to", config.NotificationConfig{Notifiers: []config.NotifierConfig{{Name: "x", Type: config.NotifierTypeSMTP, SMTPAddress: "localhost:25", From: "tm@example.com"}}}},
+	}
+	for _, test := range tests {
+		if _, err := New(test.cfg, todata.NewThreadsafe()); err == nil {
+			t.Errorf("config '%s': expected error, actual nil", test.name)
+		}
+	}
+}
+
+func TestWebhookNotify(t *testing.T) {
+	received := Notification{}
+	auth := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	hook, err := NewWebhook(config.NotifierConfig{Name: "hook", URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer abc"}})
+	if err != nil {
+		t.Fatalf("creating webhook: %v", err)
+	}
+	n := Notification{CDN: "cdn1", Alerts: []Alert{{Status: StatusFiring, Name: "edge1", Type: "EDGE", CDN: "cdn1"}}}
+	if err := hook.Notify(n); err != nil {
+		t.Fatalf("notifying: %v", err)
+	}
+	if auth != "Bearer abc" {
+		t.Errorf("expected configured header, actual '%s'", auth)
+	}
+	if received.CDN != "cdn1" || len(received.Alerts) != 1 || received.Alerts[0].Name != "edge1" {
+		t.Errorf("expected posted notification, actual %+v", received)
+	}
+}
+
+func TestWebhookNotifyErrorResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	hook, err := NewWebhook(config.NotifierConfig{Name: "hook", URL: srv.URL})
+	if err != nil {
+		t.Fatalf("creating webhook: %v", err)
+	}
+	if err := hook.Notify(Notification{}); err == nil {
+		t.Error("expected error for 503 response, actual nil")
+	}
+}
+
+func TestAlertmanagerAlerts(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+	end := time.Now()
+	n := Notification{CDN: "cdn1", Alerts: []Alert{
+		{Status: StatusFiring, Name: "edge1", Type: "EDGE", CDN: "cdn1", Cachegroup: "cg1", DeliveryServices: []string{"ds1", "ds2"}, StartsAt: start},
+		{Status: StatusResolved, Name: "ds1", Type: "DELIVERYSERVICE", CDN: "cdn1", StartsAt: start, EndsAt: &end},
+	}}
+	amAlerts := AlertmanagerAlerts(n)
+	if len(amAlerts) != 2 {
+		t.Fatalf("expected 2 alerts, actual %d", len(amAlerts))
+	}
+	if name := amAlerts[0].Labels["alertname"]; name != "TrafficMonitorEDGEUnavailable" {
+		t.Errorf("expected alertname TrafficMonitorEDGEUnavailable, actual '%s'", name)
+	}
+	if amAlerts[0].Labels["cachegroup"] != "cg1" || amAlerts[0].Annotations["deliveryServices"] != "ds1,ds2" {
+		t.Errorf("expected cachegroup label and deliveryServices annotation, actual %+v", amAlerts[0])
+	}
+	if amAlerts[0].EndsAt != nil {
+		t.Errorf("expected firing alert to have no endsAt, actual %v", amAlerts[0].EndsAt)
+	}
+	if amAlerts[1].EndsAt == nil || !amAlerts[1].EndsAt.Equal(end) {
+		t.Errorf("expected resolved alert endsAt %v, actual %v", end, amAlerts[1].EndsAt)
+	}
+}
+
+func TestEmailMessage(t *testing.T) {
+	n := Notification{CDN: "cdn1", Alerts: []Alert{
+		{Status: StatusFiring, Name: "edge1", Type: "EDGE", Description: "too slow", Cachegroup: "cg1"},
+		{Status: StatusFiring, Name: "edge2", Type: "EDGE", Description: "too slow"},
+	}}
+	msg := string(EmailMessage("tm@example.com", []string{"a@example.com", "b@example.com"}, n, time.Now()))
+	for _, expected := range []string{
+		"From: tm@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: [FIRING:2] Traffic Monitor cdn1\r\n",
+		"FIRING EDGE edge1: too slow\r\n",
+		"  Cache Group: cg1\r\n",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("expected message to contain '%s', actual '%s'", expected, msg)
+		}
+	}
+}
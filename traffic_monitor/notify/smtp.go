@@ -0,0 +1,137 @@
+package notify
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+)
+
+// SMTP is a Notifier which sends each Notification as an email through an SMTP
+// relay, which is expected to be local. If a user is configured, PLAIN auth is
+// used, which net/smtp only allows over TLS or to localhost.
+type SMTP struct {
+	address string
+	host    string
+	auth    smtp.Auth
+	from    string
+	to      []string
+	timeout time.Duration
+}
+
+// NewSMTP creates an SMTP notifier from the given config.
+func NewSMTP(cfg config.NotifierConfig) (*SMTP, error) {
+	if cfg.SMTPAddress == "" {
+		return nil, fmt.Errorf("notifier '%s' missing smtp_address", cfg.Name)
+	}
+	host, _, err := net.SplitHostPort(cfg.SMTPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("notifier '%s' smtp_address must be host:port: %v", cfg.Name, err)
+	}
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("notifier '%s' missing from or to", cfg.Name)
+	}
+	s := &SMTP{address: cfg.SMTPAddress, host: host, from: cfg.From, to: cfg.To, timeout: cfg.Timeout()}
+	if cfg.SMTPUser != "" {
+		s.auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPassword, host)
+	}
+	return s, nil
+}
+
+// Notify implements Notifier.
+func (s *SMTP) Notify(n Notification) error {
+	conn, err := net.DialTimeout("tcp", s.address, s.timeout)
+	if err != nil {
+		return errors.New("connecting: " + err.Error())
+	}
+	if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		conn.Close()
+		return errors.New("setting deadline: " + err.Error())
+	}
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return errors.New("starting session: " + err.Error())
+	}
+	defer client.Close()
+
+	if s.auth != nil {
+		if err := client.Auth(s.auth); err != nil {
+			return errors.New("authenticating: " + err.Error())
+		}
+	}
+	if err := client.Mail(s.from); err != nil {
+		return errors.New("sending from: " + err.Error())
+	}
+	for _, to := range s.to {
+		if err := client.Rcpt(to); err != nil {
+			return errors.New("sending to '" + to + "': " + err.Error())
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return errors.New("starting data: " + err.Error())
+	}
+	if _, err := w.Write(EmailMessage(s.from, s.to, n, time.Now())); err != nil {
+		return errors.New("writing message: " + err.Error())
+	}
+	if err := w.Close(); err != nil {
+		return errors.New("finishing message: " + err.Error())
+	}
+	return client.Quit()
+}
+
+// EmailMessage returns the RFC 5322 message for the given notification.
+func EmailMessage(from string, to []string, n Notification, now time.Time) []byte {
+	firing := n.Firing()
+	subject := fmt.Sprintf("[FIRING:%d] Traffic Monitor %s", firing, n.CDN)
+	if firing == 0 {
+		subject = fmt.Sprintf("[RESOLVED:%d] Traffic Monitor %s", len(n.Alerts), n.CDN)
+	}
+
+	msg := &bytes.Buffer{}
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + subject + "\r\n")
+	msg.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	for _, alert := range n.Alerts {
+		fmt.Fprintf(msg, "%s %s %s: %s\r\n", strings.ToUpper(alert.Status), alert.Type, alert.Name, alert.Description)
+		if alert.Cachegroup != "" {
+			fmt.Fprintf(msg, "  Cache Group: %s\r\n", alert.Cachegroup)
+		}
+		if len(alert.DeliveryServices) > 0 {
+			fmt.Fprintf(msg, "  Delivery Services: %s\r\n", strings.Join(alert.DeliveryServices, ", "))
+		}
+		fmt.Fprintf(msg, "  Since: %s\r\n", alert.StartsAt.Format(time.RFC3339))
+		if alert.EndsAt != nil {
+			fmt.Fprintf(msg, "  Resolved: %s\r\n", alert.EndsAt.Format(time.RFC3339))
+		}
+	}
+	return msg.Bytes()
+}
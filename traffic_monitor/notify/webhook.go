@@ -0,0 +1,97 @@
+package notify
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+)
+
+// Webhook is a Notifier which POSTs each Notification as JSON to a URL.
+type Webhook struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhook creates a Webhook notifier from the given config.
+func NewWebhook(cfg config.NotifierConfig) (*Webhook, error) {
+	if err := validateURL(cfg); err != nil {
+		return nil, err
+	}
+	return &Webhook{url: cfg.URL, headers: cfg.Headers, client: &http.Client{Timeout: cfg.Timeout()}}, nil
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(n Notification) error {
+	return postJSON(w.client, w.url, w.headers, n)
+}
+
+// validateURL returns an error if the given notifier config doesn't have a
+// valid HTTP URL.
+func validateURL(cfg config.NotifierConfig) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("notifier '%s' missing url", cfg.Name)
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("notifier '%s' has invalid url: %v", cfg.Name, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("notifier '%s' url must be http or https", cfg.Name)
+	}
+	return nil
+}
+
+// postJSON POSTs the given object as JSON to the given URL, with the given
+// additional headers, and returns an error if the response isn't a 2xx.
+func postJSON(client *http.Client, url string, headers map[string]string, obj interface{}) error {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return errors.New("encoding: " + err.Error())
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("creating request: " + err.Error())
+	}
+	req.Header.Set(rfc.ContentType, rfc.ApplicationJSON)
+	for name, val := range headers {
+		req.Header.Set(name, val)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.New("posting: " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("response code %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
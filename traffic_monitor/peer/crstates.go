@@ -31,13 +31,142 @@ import (
 // TODO add separate locks for Caches and DeliveryService maps?
 type CRStatesThreadsafe struct {
 	crStates *tc.CRStates
+	versions *crStatesVersions
 	m        *sync.RWMutex
 }
 
+// maxDeletedVersions is the number of deleted caches and delivery services whose deletion versions are kept, to serve deltas. When more are deleted, the oldest are forgotten, and deltas since before them are served in full.
+const maxDeletedVersions = 1000
+
+// crStatesVersions tracks the version at which each cache and delivery service last changed, so changes since any version can be served as a delta.
+type crStatesVersions struct {
+	// version is incremented on every change. It starts at the creation time in nanoseconds, so versions from a previous process are almost certainly older than any version of this one, and aren't mistaken for current.
+	version uint64
+	// oldest is the oldest version a delta can be served since.
+	oldest        uint64
+	caches        map[tc.CacheName]uint64
+	dses          map[tc.DeliveryServiceName]uint64
+	deletedCaches map[tc.CacheName]uint64
+	deletedDSes   map[tc.DeliveryServiceName]uint64
+	// changed is closed and replaced on every change, to wake anyone waiting for one.
+	changed chan struct{}
+}
+
 // NewCRStatesThreadsafe creates a new CRStatesThreadsafe object safe for multiple goroutine readers and a single writer.
 func NewCRStatesThreadsafe() CRStatesThreadsafe {
 	crs := tc.NewCRStates()
-	return CRStatesThreadsafe{m: &sync.RWMutex{}, crStates: &crs}
+	start := uint64(time.Now().UnixNano())
+	versions := &crStatesVersions{
+		version:       start,
+		oldest:        start,
+		caches:        map[tc.CacheName]uint64{},
+		dses:          map[tc.DeliveryServiceName]uint64{},
+		deletedCaches: map[tc.CacheName]uint64{},
+		deletedDSes:   map[tc.DeliveryServiceName]uint64{},
+		changed:       make(chan struct{}),
+	}
+	return CRStatesThreadsafe{m: &sync.RWMutex{}, crStates: &crs, versions: versions}
+}
+
+// bump increments the version, and wakes anyone waiting for a change. Callers must hold the write lock.
+func (v *crStatesVersions) bump() uint64 {
+	v.version++
+	close(v.changed)
+	v.changed = make(chan struct{})
+	return v.version
+}
+
+// pruneDeleted forgets the oldest deletions, if there are too many. Callers must hold the write lock.
+func (v *crStatesVersions) pruneDeleted() {
+	for len(v.deletedCaches)+len(v.deletedDSes) > maxDeletedVersions {
+		oldest := v.version
+		for _, version := range v.deletedCaches {
+			if version < oldest {
+				oldest = version
+			}
+		}
+		for _, version := range v.deletedDSes {
+			if version < oldest {
+				oldest = version
+			}
+		}
+		for name, version := range v.deletedCaches {
+			if version == oldest {
+				delete(v.deletedCaches, name)
+			}
+		}
+		for name, version := range v.deletedDSes {
+			if version == oldest {
+				delete(v.deletedDSes, name)
+			}
+		}
+		v.oldest = oldest
+	}
+}
+
+// Version returns the current version of the states, and a channel which is closed when they next change.
+func (t *CRStatesThreadsafe) Version() (uint64, <-chan struct{}) {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return t.versions.version, t.versions.changed
+}
+
+// GetVersioned returns the states, and their version.
+func (t *CRStatesThreadsafe) GetVersioned() (tc.CRStates, uint64) {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return t.crStates.Copy(), t.versions.version
+}
+
+// GetDelta returns the changes to the states since the given version. If the given version is too old or unknown, the delta is full.
+func (t *CRStatesThreadsafe) GetDelta(since uint64) tc.CRStatesDelta {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	v := t.versions
+	delta := tc.CRStatesDelta{
+		Version:                 v.version,
+		Caches:                  map[tc.CacheName]tc.IsAvailable{},
+		DeliveryService:         map[tc.DeliveryServiceName]tc.CRStatesDeliveryService{},
+		DeletedCaches:           []tc.CacheName{},
+		DeletedDeliveryServices: []tc.DeliveryServiceName{},
+	}
+	if since < v.oldest || since > v.version {
+		delta.Full = true
+		delta.Caches = t.crStates.CopyCaches()
+		delta.DeliveryService = t.crStates.CopyDeliveryServices()
+		return delta
+	}
+	for name, version := range v.caches {
+		if version > since {
+			delta.Caches[name] = t.crStates.Caches[name]
+		}
+	}
+	for name, version := range v.dses {
+		if version > since {
+			delta.DeliveryService[name] = t.crStates.DeliveryService[name]
+		}
+	}
+	for name, version := range v.deletedCaches {
+		if version > since {
+			delta.DeletedCaches = append(delta.DeletedCaches, name)
+		}
+	}
+	for name, version := range v.deletedDSes {
+		if version > since {
+			delta.DeletedDeliveryServices = append(delta.DeletedDeliveryServices, name)
+		}
+	}
+	return delta
+}
+
+// setCache sets the given cache, and updates the version if it changed. Callers must hold the write lock.
+func (t *CRStatesThreadsafe) setCache(cacheName tc.CacheName, available tc.IsAvailable) {
+	if old, ok := t.crStates.Caches[cacheName]; ok && old == available {
+		return
+	}
+	t.crStates.Caches[cacheName] = available
+	t.versions.caches[cacheName] = t.versions.bump()
+	delete(t.versions.deletedCaches, cacheName)
 }
 
 // Get returns the internal Crstates object for reading.
@@ -81,7 +210,7 @@ func (t *CRStatesThreadsafe) GetDeliveryService(name tc.DeliveryServiceName) (ds
 func (t *CRStatesThreadsafe) SetCache(cacheName tc.CacheName, available tc.IsAvailable) {
 	t.m.Lock()
 	if _, ok := t.crStates.Caches[cacheName]; ok {
-		t.crStates.Caches[cacheName] = available
+		t.setCache(cacheName, available)
 	}
 	t.m.Unlock()
 }
@@ -89,31 +218,64 @@ func (t *CRStatesThreadsafe) SetCache(cacheName tc.CacheName, available tc.IsAva
 // AddCache adds the internal availability data for a particular cache.
 func (t *CRStatesThreadsafe) AddCache(cacheName tc.CacheName, available tc.IsAvailable) {
 	t.m.Lock()
-	t.crStates.Caches[cacheName] = available
+	t.setCache(cacheName, available)
 	t.m.Unlock()
 }
 
 // DeleteCache deletes the given cache from the internal data.
 func (t *CRStatesThreadsafe) DeleteCache(name tc.CacheName) {
 	t.m.Lock()
-	delete(t.crStates.Caches, name)
+	if _, ok := t.crStates.Caches[name]; ok {
+		delete(t.crStates.Caches, name)
+		delete(t.versions.caches, name)
+		t.versions.deletedCaches[name] = t.versions.bump()
+		t.versions.pruneDeleted()
+	}
 	t.m.Unlock()
 }
 
 // SetDeliveryService sets the availability data for the given delivery service.
 func (t *CRStatesThreadsafe) SetDeliveryService(name tc.DeliveryServiceName, ds tc.CRStatesDeliveryService) {
 	t.m.Lock()
-	t.crStates.DeliveryService[name] = ds
+	if old, ok := t.crStates.DeliveryService[name]; !ok || !deliveryServiceStatesEqual(old, ds) {
+		t.crStates.DeliveryService[name] = ds
+		t.versions.dses[name] = t.versions.bump()
+		delete(t.versions.deletedDSes, name)
+	}
 	t.m.Unlock()
 }
 
 // DeleteDeliveryService deletes the given delivery service from the internal data. This MUST NOT be called by multiple goroutines.
 func (t *CRStatesThreadsafe) DeleteDeliveryService(name tc.DeliveryServiceName) {
 	t.m.Lock()
-	delete(t.crStates.DeliveryService, name)
+	if _, ok := t.crStates.DeliveryService[name]; ok {
+		delete(t.crStates.DeliveryService, name)
+		delete(t.versions.dses, name)
+		t.versions.deletedDSes[name] = t.versions.bump()
+		t.versions.pruneDeleted()
+	}
 	t.m.Unlock()
 }
 
+// deliveryServiceStatesEqual returns whether the given delivery service states are the same.
+// Disabled locations are compared as sets, because they're built from map iteration, so their order is arbitrary.
+func deliveryServiceStatesEqual(a tc.CRStatesDeliveryService, b tc.CRStatesDeliveryService) bool {
+	if a.IsAvailable != b.IsAvailable || len(a.DisabledLocations) != len(b.DisabledLocations) {
+		return false
+	}
+	locations := make(map[tc.CacheGroupName]int, len(a.DisabledLocations))
+	for _, location := range a.DisabledLocations {
+		locations[location]++
+	}
+	for _, location := range b.DisabledLocations {
+		if locations[location] == 0 {
+			return false
+		}
+		locations[location]--
+	}
+	return true
+}
+
 // CRStatesPeersThreadsafe provides safe access for multiple goroutines to read a map of Traffic Monitor peers to their returned Crstates, with a single goroutine writer.
 // This could be made lock-free, if the performance was necessary
 type CRStatesPeersThreadsafe struct {
@@ -0,0 +1,123 @@
+package peer
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+func TestCRStatesDelta(t *testing.T) {
+	states := NewCRStatesThreadsafe()
+	states.AddCache("edge1", tc.IsAvailable{IsAvailable: true})
+	states.AddCache("edge2", tc.IsAvailable{IsAvailable: true})
+	states.SetDeliveryService("ds1", tc.CRStatesDeliveryService{IsAvailable: true})
+
+	base, baseVersion := states.GetVersioned()
+	version, changed := states.Version()
+	if version != baseVersion {
+		t.Fatalf("expected Version %d to equal GetVersioned version %d", version, baseVersion)
+	}
+
+	states.SetCache("edge1", tc.IsAvailable{IsAvailable: true}) // unchanged
+	if version, _ := states.Version(); version != baseVersion {
+		t.Errorf("expected setting an unchanged cache to keep version %d, actual %d", baseVersion, version)
+	}
+	select {
+	case <-changed:
+		t.Error("expected changed channel to stay open when nothing changed")
+	default:
+	}
+
+	states.SetCache("edge1", tc.IsAvailable{IsAvailable: false})
+	states.DeleteCache("edge2")
+	states.AddCache("edge3", tc.IsAvailable{IsAvailable: true})
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("expected changed channel to be closed after a change")
+	}
+
+	delta := states.GetDelta(baseVersion)
+	if delta.Full {
+		t.Fatalf("expected a delta since the current version to not be full")
+	}
+	if len(delta.Caches) != 2 || delta.Caches["edge1"].IsAvailable || !delta.Caches["edge3"].IsAvailable {
+		t.Errorf("expected changed caches edge1 and edge3, actual %+v", delta.Caches)
+	}
+	if len(delta.DeliveryService) != 0 {
+		t.Errorf("expected no changed delivery services, actual %+v", delta.DeliveryService)
+	}
+	if len(delta.DeletedCaches) != 1 || delta.DeletedCaches[0] != "edge2" {
+		t.Errorf("expected deleted cache edge2, actual %+v", delta.DeletedCaches)
+	}
+
+	applied := delta.Apply(base)
+	current := states.Get()
+	if len(applied.Caches) != len(current.Caches) || len(applied.DeliveryService) != len(current.DeliveryService) {
+		t.Fatalf("expected applying the delta to produce %+v, actual %+v", current, applied)
+	}
+	for name, available := range current.Caches {
+		if applied.Caches[name] != available {
+			t.Errorf("expected applied cache %s %+v, actual %+v", name, available, applied.Caches[name])
+		}
+	}
+
+	if delta := states.GetDelta(delta.Version); delta.Full || len(delta.Caches) != 0 || len(delta.DeletedCaches) != 0 {
+		t.Errorf("expected an empty delta since the current version, actual %+v", delta)
+	}
+	for _, since := range []uint64{0, delta.Version + 1} {
+		if delta := states.GetDelta(since); !delta.Full || len(delta.Caches) != 2 || len(delta.DeliveryService) != 1 {
+			t.Errorf("expected a full delta since unknown version %d, actual %+v", since, delta)
+		}
+	}
+}
+
+func TestCRStatesDeltaPrunedDeletions(t *testing.T) {
+	states := NewCRStatesThreadsafe()
+	_, start := states.GetVersioned()
+	for i := 0; i < maxDeletedVersions+1; i++ {
+		name := tc.CacheName("edge" + strconv.Itoa(i))
+		states.AddCache(name, tc.IsAvailable{IsAvailable: true})
+		states.DeleteCache(name)
+	}
+	if delta := states.GetDelta(start); !delta.Full {
+		t.Errorf("expected a full delta since a version older than the kept deletions, actual %d deleted caches", len(delta.DeletedCaches))
+	}
+}
+
+func TestCRStatesDisabledLocationsOrder(t *testing.T) {
+	states := NewCRStatesThreadsafe()
+	states.SetDeliveryService("ds1", tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{"cg1", "cg2"}})
+	version, _ := states.Version()
+
+	states.SetDeliveryService("ds1", tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{"cg2", "cg1"}})
+	if actual, _ := states.Version(); actual != version {
+		t.Errorf("expected reordered disabled locations to keep version %d, actual %d", version, actual)
+	}
+
+	states.SetDeliveryService("ds1", tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{"cg2", "cg2"}})
+	if actual, _ := states.Version(); actual == version {
+		t.Errorf("expected changed disabled locations to change version %d", version)
+	}
+}
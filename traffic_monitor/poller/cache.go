@@ -119,6 +119,7 @@ func (p CachePoller) Poll() {
 				URLv6:       info.URLv6,
 				Host:        info.Host,
 				Timeout:     info.Timeout,
+				Interval:    info.Interval,
 				NoKeepAlive: info.NoKeepAlive,
 				PollerID:    info.ID,
 			}
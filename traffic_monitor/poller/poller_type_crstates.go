@@ -0,0 +1,100 @@
+package poller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// PollerTypeCRStates polls a peer Traffic Monitor's CrStates endpoint for the changes since its previous poll, rather than the full states.
+// It returns the full states after applying the changes, so the peer handler is the same as for the HTTP poller.
+// Peers which don't support deltas return the full states, which are used as-is.
+// Once it has a version, it long-polls with the wait parameter for up to the polling interval, so changes are received as soon as the peer makes them.
+const PollerTypeCRStates = "crstates"
+
+func init() {
+	AddPollerType(PollerTypeCRStates, httpGlobalInit, crStatesInit, crStatesPoll)
+}
+
+func crStatesInit(cfg PollerConfig, globalCtxI interface{}) interface{} {
+	ctx := &CRStatesPollCtx{HTTPPollCtx: httpInit(cfg, globalCtxI).(*HTTPPollCtx), Wait: cfg.Interval.Truncate(time.Second)}
+	if ctx.Wait > 0 && ctx.Client.Timeout != 0 {
+		// the peer may hold the request for the whole wait, so it mustn't count against the timeout.
+		client := *ctx.Client
+		client.Timeout += ctx.Wait
+		ctx.Client = &client
+	}
+	return ctx
+}
+
+// CRStatesPollCtx is the context of a CRStates poller, which holds the last states and version received from the peer.
+type CRStatesPollCtx struct {
+	*HTTPPollCtx
+	Version uint64
+	States  tc.CRStates
+	// Wait is the longest the peer is asked to hold a request until its states change. It's whole seconds, because the wait parameter is.
+	Wait time.Duration
+}
+
+func crStatesPoll(ctxI interface{}, url string, host string, pollID uint64) ([]byte, time.Time, time.Duration, error) {
+	ctx := (ctxI).(*CRStatesPollCtx)
+
+	pollURL := url
+	if ctx.Version != 0 {
+		sep := "?"
+		if strings.Contains(url, "?") {
+			sep = "&"
+		}
+		pollURL = url + sep + "since=" + strconv.FormatUint(ctx.Version, 10)
+		if ctx.Wait > 0 {
+			pollURL += "&wait=" + strconv.FormatInt(int64(ctx.Wait/time.Second), 10)
+		}
+	}
+
+	bts, reqEnd, reqTime, err := httpPoll(ctx.HTTPPollCtx, pollURL, host, pollID)
+	if err != nil {
+		ctx.Version = 0 // the peer may have missed changes, or restarted; request the full states next time.
+		return nil, reqEnd, reqTime, err
+	}
+
+	delta := tc.CRStatesDelta{}
+	if err := json.Unmarshal(bts, &delta); err != nil {
+		ctx.Version = 0
+		return nil, reqEnd, reqTime, fmt.Errorf("id %v url %v decoding states: %v", ctx.PollerID, pollURL, err)
+	}
+	if !delta.IsFull() && ctx.Version == 0 {
+		return nil, reqEnd, reqTime, errors.New("id " + ctx.PollerID + " url " + pollURL + " received changes without requesting them")
+	}
+	ctx.States = delta.Apply(ctx.States)
+	ctx.Version = delta.Version
+
+	bts, err = tc.CRStatesMarshall(ctx.States)
+	if err != nil {
+		return nil, reqEnd, reqTime, fmt.Errorf("id %v url %v encoding states: %v", ctx.PollerID, pollURL, err)
+	}
+	return bts, reqEnd, reqTime, nil
+}
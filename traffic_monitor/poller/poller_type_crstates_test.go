@@ -0,0 +1,89 @@
+package poller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+)
+
+func TestCRStatesPoll(t *testing.T) {
+	responses := []string{
+		`{"version":5,"full":true,"caches":{"edge1":{"isAvailable":true},"edge2":{"isAvailable":true}},"deliveryServices":{}}`,
+		`{"version":7,"full":false,"caches":{"edge1":{"isAvailable":false}},"deliveryServices":{},"deletedCaches":["edge2"]}`,
+		`{"caches":{"edge3":{"isAvailable":true}},"deliveryServices":{}}`,
+	}
+	sinces := []string{}
+	waits := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sinces = append(sinces, r.URL.Query().Get("since"))
+		waits = append(waits, r.URL.Query().Get("wait"))
+		w.Write([]byte(responses[len(sinces)-1]))
+	}))
+	defer srv.Close()
+
+	url := srv.URL + "/publish/CrStates?raw"
+	globalCtx := httpGlobalInit(config.Config{HTTPTimeout: time.Second}, config.StaticAppData{})
+	ctx := crStatesInit(PollerConfig{URL: url, Interval: 2500 * time.Millisecond, PollerID: "peer1"}, globalCtx)
+
+	expected := []map[tc.CacheName]bool{
+		{"edge1": true, "edge2": true},
+		{"edge1": false},
+		{"edge3": true}, // a peer without delta support returns its full states
+	}
+	for i, expectedCaches := range expected {
+		bts, _, _, err := crStatesPoll(ctx, url, "", uint64(i))
+		if err != nil {
+			t.Fatalf("poll %d: %v", i, err)
+		}
+		states, err := tc.CRStatesUnMarshall(bts)
+		if err != nil {
+			t.Fatalf("poll %d: decoding states: %v", i, err)
+		}
+		if len(states.Caches) != len(expectedCaches) {
+			t.Errorf("poll %d: expected caches %+v, actual %+v", i, expectedCaches, states.Caches)
+		}
+		for name, available := range expectedCaches {
+			if states.Caches[name].IsAvailable != available {
+				t.Errorf("poll %d: expected %s available %t, actual %+v", i, name, available, states.Caches)
+			}
+		}
+	}
+
+	expectedSinces := []string{"", "5", "7"}
+	expectedWaits := []string{"", "2", "2"} // only requests with a version can wait, and the wait is whole seconds.
+	for i, since := range expectedSinces {
+		if sinces[i] != since {
+			t.Errorf("poll %d: expected since '%s', actual '%s'", i, since, sinces[i])
+		}
+		if waits[i] != expectedWaits[i] {
+			t.Errorf("poll %d: expected wait '%s', actual '%s'", i, expectedWaits[i], waits[i])
+		}
+	}
+
+	if timeout := ctx.(*CRStatesPollCtx).Client.Timeout; timeout != 3*time.Second {
+		t.Errorf("expected client timeout to be extended by the wait to 3s, actual %v", timeout)
+	}
+}
@@ -40,6 +40,7 @@ type PollerConfig struct {
 	URLv6       string
 	Host        string
 	Timeout     time.Duration
+	Interval    time.Duration
 	NoKeepAlive bool
 	PollerID    string
 }
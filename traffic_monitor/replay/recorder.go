@@ -0,0 +1,140 @@
+package replay
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/handler"
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+)
+
+// Recorder writes entries to an archive file. It is safe for multiple
+// goroutines.
+type Recorder struct {
+	m    sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+// NewRecorder creates a Recorder appending to the archive at the given path,
+// creating it if it doesn't exist.
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.New("opening archive: " + err.Error())
+	}
+	return &Recorder{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// RecordConfig records the monitoring config and raw CRConfig received for the
+// given CDN by the Traffic Monitor with the given host name.
+func (r *Recorder) RecordConfig(cdn string, hostname string, monitorConfig tc.TrafficMonitorConfigMap, crConfig []byte) {
+	r.record(Entry{
+		Type:   EntryTypeConfig,
+		Time:   time.Now(),
+		Config: &Config{CDN: cdn, Hostname: hostname, MonitorConfig: monitorConfig, CRConfig: crConfig},
+	})
+}
+
+// RecordPoll records the given raw poll result.
+func (r *Recorder) RecordPoll(reqEnd time.Time, poll Poll) {
+	r.record(Entry{Type: EntryTypePoll, Time: reqEnd, Poll: &poll})
+}
+
+// record writes the given entry. Errors are logged rather than returned,
+// because recording must never interfere with monitoring.
+func (r *Recorder) record(entry Entry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("replay: encoding %s entry: %v\n", entry.Type, err)
+		return
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		log.Errorf("replay: writing %s entry: %v\n", entry.Type, err)
+		return
+	}
+	if err := r.w.Flush(); err != nil {
+		log.Errorf("replay: writing %s entry: %v\n", entry.Type, err)
+	}
+}
+
+// Close flushes and closes the archive.
+func (r *Recorder) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if err := r.w.Flush(); err != nil {
+		r.file.Close()
+		return errors.New("flushing archive: " + err.Error())
+	}
+	return r.file.Close()
+}
+
+// Handler returns a handler which records every poll result of the given
+// poller, one of the Poller constants, and then passes it to the given handler.
+func (r *Recorder) Handler(poller string, h handler.Handler) handler.Handler {
+	return recordingHandler{recorder: r, poller: poller, handler: h}
+}
+
+type recordingHandler struct {
+	recorder *Recorder
+	poller   string
+	handler  handler.Handler
+}
+
+// Handle implements handler.Handler.
+func (h recordingHandler) Handle(id string, rdr io.Reader, format string, reqTime time.Duration, reqEnd time.Time, reqErr error, pollID uint64, usingIPv4 bool, pollCtx interface{}, pollFinished chan<- uint64) {
+	poll := Poll{
+		Poller:      h.poller,
+		Cache:       id,
+		Format:      format,
+		RequestTime: reqTime,
+		PollID:      pollID,
+		UsingIPv4:   usingIPv4,
+	}
+	if reqErr != nil {
+		poll.Error = reqErr.Error()
+	}
+	if rdr != nil {
+		body, err := ioutil.ReadAll(rdr)
+		if err != nil {
+			log.Errorf("replay: reading poll %d body for '%s': %v\n", pollID, id, err)
+		}
+		poll.Body = body
+		rdr = bytes.NewReader(body)
+	}
+	if ctx, ok := pollCtx.(*poller.HTTPPollCtx); ok && ctx.HTTPHeader != nil {
+		poll.Header = ctx.HTTPHeader.Clone()
+	}
+	h.recorder.RecordPoll(reqEnd, poll)
+	h.handler.Handle(id, rdr, format, reqTime, reqEnd, reqErr, pollID, usingIPv4, pollCtx, pollFinished)
+}
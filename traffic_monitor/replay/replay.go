@@ -0,0 +1,254 @@
+// Package replay records the raw inputs of Traffic Monitor health decisions -
+// every health poll result, and the monitoring config and CRConfig they were
+// judged against - to an archive, and reads them back, so the decisions can be
+// replayed offline by manager.Replay.
+//
+// An archive is a file of JSON Entry objects, one per line, in the order they
+// were recorded.
+package replay
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+)
+
+const (
+	// EntryTypeConfig is an entry with a new monitoring config and CRConfig.
+	EntryTypeConfig = "config"
+	// EntryTypePoll is an entry with a raw poll result.
+	EntryTypePoll = "poll"
+)
+
+const (
+	// PollerHealth is the poller of cache health polls.
+	PollerHealth = "health"
+	// PollerStat is the poller of cache stat polls, from which Delivery Service
+	// availability is calculated.
+	PollerStat = "stat"
+	// PollerPeer is the poller of peer Traffic Monitor CRStates polls.
+	PollerPeer = "peer"
+)
+
+// maxEntryBytes is the largest archive line which can be read. Entries are as
+// large as the CRConfig, so this is far larger than any real one.
+const maxEntryBytes = 1 << 30
+
+// Entry is a single recorded input.
+type Entry struct {
+	Type string `json:"type"`
+	// Time is when the config was received, or when the poll request finished.
+	Time   time.Time `json:"time"`
+	Config *Config   `json:"config,omitempty"`
+	Poll   *Poll     `json:"poll,omitempty"`
+}
+
+// Config is a monitoring config and CRConfig, as received from Traffic Ops.
+type Config struct {
+	CDN string
+	// Hostname is the host name of the recording Traffic Monitor, which isn't
+	// its own peer.
+	Hostname      string
+	MonitorConfig tc.TrafficMonitorConfigMap
+	CRConfig      json.RawMessage
+}
+
+// Poll is the raw result of a single poll of a cache or peer, as given to the
+// poller's handler.
+type Poll struct {
+	// Poller is the poller which made the poll, one of the Poller constants.
+	Poller string `json:"poller"`
+	// Cache is the polled cache, or the polled peer Traffic Monitor.
+	Cache  string `json:"cache"`
+	Format string `json:"format"`
+	// Body is the raw response body, which is nil if the request failed.
+	Body []byte `json:"body"`
+	// Header is the response header, which the stat decoders use to determine
+	// the content type.
+	Header      http.Header   `json:"header,omitempty"`
+	RequestTime time.Duration `json:"requestTime"`
+	Error       string        `json:"error,omitempty"`
+	PollID      uint64        `json:"pollId"`
+	UsingIPv4   bool          `json:"usingIPv4"`
+}
+
+// Err returns the error of the poll request, or nil if it succeeded.
+func (p Poll) Err() error {
+	if p.Error == "" {
+		return nil
+	}
+	return errors.New(p.Error)
+}
+
+// PollCtx returns the poller context to give the cache handler, which is what
+// the stat decoders expect from the HTTP poller.
+func (p Poll) PollCtx() interface{} {
+	return &poller.HTTPPollCtx{HTTPHeader: p.Header}
+}
+
+// configJSON is the archived form of a Config. The monitoring config profile
+// parameters are archived in the Traffic Ops form, because that's the form
+// tc.TMParameters unmarshals.
+type configJSON struct {
+	CDN           string            `json:"cdn"`
+	Hostname      string            `json:"hostname,omitempty"`
+	MonitorConfig monitorConfigJSON `json:"monitorConfig"`
+	CRConfig      json.RawMessage   `json:"crConfig"`
+}
+
+type monitorConfigJSON struct {
+	TrafficServer   map[string]tc.TrafficServer     `json:"trafficServers"`
+	CacheGroup      map[string]tc.TMCacheGroup      `json:"cacheGroups"`
+	Config          map[string]interface{}          `json:"config"`
+	TrafficMonitor  map[string]tc.TrafficMonitor    `json:"trafficMonitors"`
+	DeliveryService map[string]tc.TMDeliveryService `json:"deliveryServices"`
+	Profile         map[string]profileJSON          `json:"profiles"`
+}
+
+type profileJSON struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+// MarshalJSON implements encoding/json.Marshaler.
+func (c Config) MarshalJSON() ([]byte, error) {
+	mc := c.MonitorConfig
+	profiles := make(map[string]profileJSON, len(mc.Profile))
+	for name, profile := range mc.Profile {
+		params := map[string]interface{}{
+			"health.connection.timeout": profile.Parameters.HealthConnectionTimeout,
+			"health.polling.url":        profile.Parameters.HealthPollingURL,
+			"health.polling.format":     profile.Parameters.HealthPollingFormat,
+			"health.polling.type":       profile.Parameters.HealthPollingType,
+			"history.count":             profile.Parameters.HistoryCount,
+		}
+		for stat, threshold := range profile.Parameters.Thresholds {
+			params[tc.ThresholdPrefix+stat] = threshold.String()
+		}
+		profiles[name] = profileJSON{Name: profile.Name, Type: profile.Type, Parameters: params}
+	}
+	return json.Marshal(configJSON{
+		CDN:      c.CDN,
+		Hostname: c.Hostname,
+		MonitorConfig: monitorConfigJSON{
+			TrafficServer:   mc.TrafficServer,
+			CacheGroup:      mc.CacheGroup,
+			Config:          mc.Config,
+			TrafficMonitor:  mc.TrafficMonitor,
+			DeliveryService: mc.DeliveryService,
+			Profile:         profiles,
+		},
+		CRConfig: c.CRConfig,
+	})
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	cj := configJSON{}
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return err
+	}
+	mc := tc.TrafficMonitorConfigMap{
+		TrafficServer:   cj.MonitorConfig.TrafficServer,
+		CacheGroup:      cj.MonitorConfig.CacheGroup,
+		Config:          cj.MonitorConfig.Config,
+		TrafficMonitor:  cj.MonitorConfig.TrafficMonitor,
+		DeliveryService: cj.MonitorConfig.DeliveryService,
+		Profile:         make(map[string]tc.TMProfile, len(cj.MonitorConfig.Profile)),
+	}
+	for name, pj := range cj.MonitorConfig.Profile {
+		paramBytes, err := json.Marshal(pj.Parameters)
+		if err != nil {
+			return fmt.Errorf("encoding profile '%s' parameters: %v", name, err)
+		}
+		profile := tc.TMProfile{Name: pj.Name, Type: pj.Type}
+		if err := json.Unmarshal(paramBytes, &profile.Parameters); err != nil {
+			return fmt.Errorf("decoding profile '%s' parameters: %v", name, err)
+		}
+		profile.Parameters.MinFreeKbps = int64(profile.Parameters.Thresholds["availableBandwidthInKbps"].Val)
+		mc.Profile[name] = profile
+	}
+	*c = Config{CDN: cj.CDN, Hostname: cj.Hostname, MonitorConfig: mc, CRConfig: cj.CRConfig}
+	return nil
+}
+
+// Reader reads the entries of an archive, in order.
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewReader creates a Reader of the archive read from r.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxEntryBytes)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next entry of the archive. It returns io.EOF after the last
+// entry.
+func (r *Reader) Next() (Entry, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := r.scanner.Bytes()
+		if strings.TrimSpace(string(line)) == "" {
+			continue
+		}
+		entry := Entry{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return Entry{}, fmt.Errorf("decoding archive line %d: %v", r.line, err)
+		}
+		switch entry.Type {
+		case EntryTypeConfig:
+			if entry.Config == nil {
+				return Entry{}, fmt.Errorf("archive line %d: config entry missing config", r.line)
+			}
+		case EntryTypePoll:
+			if entry.Poll == nil {
+				return Entry{}, fmt.Errorf("archive line %d: poll entry missing poll", r.line)
+			}
+			switch entry.Poll.Poller {
+			case PollerHealth, PollerStat, PollerPeer:
+			case "":
+				return Entry{}, fmt.Errorf("archive line %d: poll entry missing poller", r.line)
+			default:
+				return Entry{}, fmt.Errorf("archive line %d: unknown poller '%s'", r.line, entry.Poll.Poller)
+			}
+		default:
+			return Entry{}, fmt.Errorf("archive line %d: unknown entry type '%s'", r.line, entry.Type)
+		}
+		return entry, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Entry{}, fmt.Errorf("reading archive line %d: %v", r.line+1, err)
+	}
+	return Entry{}, io.EOF
+}
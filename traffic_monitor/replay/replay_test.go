@@ -0,0 +1,172 @@
+package replay
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	cfg := Config{
+		CDN: "cdn1",
+		MonitorConfig: tc.TrafficMonitorConfigMap{
+			TrafficServer: map[string]tc.TrafficServer{"edge1": {HostName: "edge1", CacheGroup: "cg1", Profile: "EDGE", ServerStatus: "REPORTED"}},
+			Profile: map[string]tc.TMProfile{
+				"EDGE": {Name: "EDGE", Type: "EDGE", Parameters: tc.TMParameters{
+					HealthConnectionTimeout: 2000,
+					HealthPollingURL:        "http://${hostname}/_astats",
+					HealthPollingFormat:     "astats",
+					HistoryCount:            30,
+					MinFreeKbps:             20000,
+					Thresholds: map[string]tc.HealthThreshold{
+						"availableBandwidthInKbps": {Val: 20000, Comparator: ">"},
+						"loadavg":                  {Val: 25, Comparator: "<"},
+					},
+				}},
+			},
+		},
+		CRConfig: json.RawMessage(`{"contentServers":{}}`),
+	}
+
+	bts, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("marshalling: %v", err)
+	}
+	actual := Config{}
+	if err := json.Unmarshal(bts, &actual); err != nil {
+		t.Fatalf("unmarshalling: %v", err)
+	}
+	if actual.CDN != cfg.CDN || string(actual.CRConfig) != string(cfg.CRConfig) {
+		t.Errorf("expected cdn '%s' and CRConfig '%s', actual '%s' and '%s'", cfg.CDN, cfg.CRConfig, actual.CDN, actual.CRConfig)
+	}
+	if !reflect.DeepEqual(actual.MonitorConfig.Profile, cfg.MonitorConfig.Profile) {
+		t.Errorf("expected profiles %+v, actual %+v", cfg.MonitorConfig.Profile, actual.MonitorConfig.Profile)
+	}
+	if actual.MonitorConfig.TrafficServer["edge1"].CacheGroup != "cg1" {
+		t.Errorf("expected server edge1 cachegroup cg1, actual %+v", actual.MonitorConfig.TrafficServer)
+	}
+}
+
+type fakeHandler struct {
+	body   []byte
+	reqErr error
+}
+
+func (h *fakeHandler) Handle(id string, rdr io.Reader, format string, reqTime time.Duration, reqEnd time.Time, reqErr error, pollID uint64, usingIPv4 bool, pollCtx interface{}, pollFinished chan<- uint64) {
+	if rdr != nil {
+		h.body, _ = ioutil.ReadAll(rdr)
+	}
+	h.reqErr = reqErr
+}
+
+func TestRecordingHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tm-replay-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "health.record")
+
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	inner := &fakeHandler{}
+	h := recorder.Handler(PollerStat, inner)
+	reqEnd := time.Now().Round(0)
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	h.Handle("edge1", bytes.NewReader([]byte(`{"ats":{}}`)), "astats", time.Millisecond, reqEnd, nil, 42, true, &poller.HTTPPollCtx{HTTPHeader: header}, nil)
+	if string(inner.body) != `{"ats":{}}` {
+		t.Errorf("expected wrapped handler to get the body, actual '%s'", inner.body)
+	}
+	h.Handle("edge1", nil, "astats", time.Second, reqEnd.Add(time.Second), errors.New("timeout"), 43, false, nil, nil)
+	if inner.reqErr == nil {
+		t.Error("expected wrapped handler to get the request error, actual nil")
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("closing recorder: %v", err)
+	}
+
+	archive, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening archive: %v", err)
+	}
+	defer archive.Close()
+	rdr := NewReader(archive)
+
+	entry, err := rdr.Next()
+	if err != nil {
+		t.Fatalf("reading first entry: %v", err)
+	}
+	if entry.Type != EntryTypePoll || !entry.Time.Equal(reqEnd) {
+		t.Errorf("expected poll entry at %v, actual %s at %v", reqEnd, entry.Type, entry.Time)
+	}
+	if p := entry.Poll; p.Poller != PollerStat || p.Cache != "edge1" || string(p.Body) != `{"ats":{}}` || p.PollID != 42 || !p.UsingIPv4 || p.RequestTime != time.Millisecond || p.Err() != nil {
+		t.Errorf("expected recorded poll, actual %+v", p)
+	}
+	if ctx := entry.Poll.PollCtx().(*poller.HTTPPollCtx); ctx.HTTPHeader.Get("Content-Type") != "application/json" {
+		t.Errorf("expected recorded content type, actual %+v", ctx.HTTPHeader)
+	}
+
+	entry, err = rdr.Next()
+	if err != nil {
+		t.Fatalf("reading second entry: %v", err)
+	}
+	if p := entry.Poll; p.Body != nil || p.Err() == nil || p.Err().Error() != "timeout" || p.UsingIPv4 {
+		t.Errorf("expected recorded failed poll, actual %+v", p)
+	}
+
+	if _, err := rdr.Next(); err != io.EOF {
+		t.Errorf("expected EOF after last entry, actual %v", err)
+	}
+}
+
+func TestReaderInvalidEntry(t *testing.T) {
+	rdr := NewReader(strings.NewReader(`{"type":"poll","time":"2021-01-01T00:00:00Z"}` + "\n"))
+	if _, err := rdr.Next(); err == nil {
+		t.Error("expected error for poll entry without poll, actual nil")
+	}
+	rdr = NewReader(strings.NewReader(`{"type":"peer"}` + "\n"))
+	if _, err := rdr.Next(); err == nil {
+		t.Error("expected error for unknown entry type, actual nil")
+	}
+	rdr = NewReader(strings.NewReader(`{"type":"poll","poll":{"poller":"foo","cache":"edge1"}}` + "\n"))
+	if _, err := rdr.Next(); err == nil {
+		t.Error("expected error for unknown poller, actual nil")
+	}
+	rdr = NewReader(strings.NewReader(`{"type":"poll","poll":{"cache":"edge1"}}` + "\n"))
+	if _, err := rdr.Next(); err == nil {
+		t.Error("expected error for poll entry without poller, actual nil")
+	}
+}
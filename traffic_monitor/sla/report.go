@@ -0,0 +1,158 @@
+package sla
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// Window is a period reports are calculated over, ending at the time of the report.
+type Window struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Windows are the periods every report is calculated over.
+var Windows = []Window{
+	{Name: "1h", Duration: time.Hour},
+	{Name: "24h", Duration: 24 * time.Hour},
+	{Name: "30d", Duration: Retention},
+}
+
+// Report is the availability of a Delivery Service over each of the Windows, by window name.
+type Report map[string]WindowReport
+
+// WindowReport is the availability of a Delivery Service over a window.
+type WindowReport struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// ObservedSeconds is how long the Delivery Service was tracked during the window. Time Traffic Monitor wasn't
+	// running, or the Delivery Service didn't exist, is neither available nor unavailable.
+	ObservedSeconds  float64 `json:"observedSeconds"`
+	AvailableSeconds float64 `json:"availableSeconds"`
+	// UptimePercent is the percent of the observed time the Delivery Service was available. It is nil if the
+	// Delivery Service wasn't observed during the window.
+	UptimePercent *float64 `json:"uptimePercent"`
+	// DegradedSeconds is how long the Delivery Service was available, but with disabled locations.
+	DegradedSeconds float64 `json:"degradedSeconds"`
+	// DisabledLocationSeconds is how long each cachegroup was a disabled location of the Delivery Service.
+	DisabledLocationSeconds map[tc.CacheGroupName]float64 `json:"disabledLocationSeconds"`
+	// MinAvailableCachesPercent is the lowest percent of the Delivery Service's caches which were available at any
+	// time during the window. It is nil if the Delivery Service wasn't observed during the window.
+	MinAvailableCachesPercent *float64 `json:"minAvailableCachesPercent"`
+	// Outages are the periods during the window the Delivery Service was unavailable, oldest first.
+	Outages []Outage `json:"outages"`
+}
+
+// Outage is a period a Delivery Service was unavailable. The Start and End are limited to the window being reported.
+type Outage struct {
+	Start time.Time `json:"start"`
+	// End is nil if the outage is ongoing.
+	End *time.Time `json:"end"`
+}
+
+// Reports returns the report of every tracked Delivery Service, as of the given time.
+func (t *Tracker) Reports(now time.Time) map[tc.DeliveryServiceName]Report {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	reports := make(map[tc.DeliveryServiceName]Report, len(t.intervals))
+	for name, intervals := range t.intervals {
+		reports[name] = newReport(now, intervals)
+	}
+	return reports
+}
+
+// Report returns the report of the given Delivery Service as of the given time, and whether it is tracked.
+func (t *Tracker) Report(now time.Time, name tc.DeliveryServiceName) (Report, bool) {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	intervals, ok := t.intervals[name]
+	if !ok {
+		return nil, false
+	}
+	return newReport(now, intervals), true
+}
+
+func newReport(now time.Time, intervals []Interval) Report {
+	report := make(Report, len(Windows))
+	for _, window := range Windows {
+		report[window.Name] = newWindowReport(now.Add(-window.Duration), now, intervals)
+	}
+	return report
+}
+
+// newWindowReport calculates the report of the given intervals, oldest first, between the given start and end.
+func newWindowReport(start time.Time, end time.Time, intervals []Interval) WindowReport {
+	report := WindowReport{
+		Start:                   start,
+		End:                     end,
+		DisabledLocationSeconds: map[tc.CacheGroupName]float64{},
+		Outages:                 []Outage{},
+	}
+	minAvailableCachesPercent := 0.0
+	for _, interval := range intervals {
+		ongoing := interval.End.IsZero()
+		intervalStart, intervalEnd := interval.Start, interval.End
+		if ongoing || intervalEnd.After(end) {
+			intervalEnd = end
+		}
+		if intervalStart.Before(start) {
+			intervalStart = start
+		}
+		if !intervalEnd.After(intervalStart) {
+			continue
+		}
+		seconds := intervalEnd.Sub(intervalStart).Seconds()
+
+		if report.ObservedSeconds == 0 || interval.AvailableCachesPercent < minAvailableCachesPercent {
+			minAvailableCachesPercent = interval.AvailableCachesPercent
+		}
+		report.ObservedSeconds += seconds
+		for _, cg := range interval.DisabledLocations {
+			report.DisabledLocationSeconds[cg] += seconds
+		}
+		if interval.Available {
+			report.AvailableSeconds += seconds
+			if len(interval.DisabledLocations) > 0 {
+				report.DegradedSeconds += seconds
+			}
+			continue
+		}
+
+		outageEnd := &intervalEnd
+		if ongoing {
+			outageEnd = nil
+		}
+		// intervals are split by any state change, so merge adjacent unavailable intervals into a single outage
+		if last := len(report.Outages) - 1; last >= 0 && report.Outages[last].End != nil && report.Outages[last].End.Equal(intervalStart) {
+			report.Outages[last].End = outageEnd
+			continue
+		}
+		report.Outages = append(report.Outages, Outage{Start: intervalStart, End: outageEnd})
+	}
+	if report.ObservedSeconds > 0 {
+		uptimePercent := report.AvailableSeconds / report.ObservedSeconds * 100
+		report.UptimePercent = &uptimePercent
+		report.MinAvailableCachesPercent = &minAvailableCachesPercent
+	}
+	return report
+}
@@ -0,0 +1,374 @@
+// Package sla tracks the availability of each Delivery Service over time, as
+// served to Traffic Router in the combined CRStates, and reports uptime and
+// outage windows over fixed periods, for Delivery Service SLA reporting.
+//
+// The history may be persisted to a file, so it survives restarts. The file is
+// a log of JSON records, one per line: an "open" record when a Delivery
+// Service's state changes, a "close" record when a Delivery Service is removed
+// or tracking stops, and a "checkpoint" record periodically, so the time
+// Traffic Monitor stopped is known to within the checkpoint interval.
+package sla
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+// Retention is how long intervals are kept, which is the longest report window.
+const Retention = 30 * 24 * time.Hour
+
+// checkpointInterval is how often a checkpoint is written to the history file.
+const checkpointInterval = time.Minute
+
+// compactInterval is how often the history file is rewritten, to drop intervals older than the Retention.
+const compactInterval = 24 * time.Hour
+
+const (
+	recordTypeOpen       = "open"
+	recordTypeClose      = "close"
+	recordTypeCheckpoint = "checkpoint"
+)
+
+// State is the state of a Delivery Service during an interval.
+type State struct {
+	Available bool `json:"available"`
+	// DisabledLocations are the cachegroups with no available caches assigned to the Delivery Service, sorted.
+	DisabledLocations []tc.CacheGroupName `json:"disabledLocations"`
+	// AvailableCachesPercent is the percent of the caches assigned to the Delivery Service which are available.
+	AvailableCachesPercent float64 `json:"availableCachesPercent"`
+}
+
+func (s State) equal(o State) bool {
+	if s.Available != o.Available || s.AvailableCachesPercent != o.AvailableCachesPercent || len(s.DisabledLocations) != len(o.DisabledLocations) {
+		return false
+	}
+	for i, cg := range s.DisabledLocations {
+		if o.DisabledLocations[i] != cg {
+			return false
+		}
+	}
+	return true
+}
+
+// Interval is a period during which a Delivery Service's state didn't change.
+type Interval struct {
+	Start time.Time
+	// End is the time the interval ended. It is zero if the interval is ongoing.
+	End time.Time
+	State
+}
+
+// record is a line of the history file.
+type record struct {
+	Type            string                 `json:"type"`
+	Time            time.Time              `json:"time"`
+	DeliveryService tc.DeliveryServiceName `json:"deliveryService,omitempty"`
+	State           *State                 `json:"state,omitempty"`
+}
+
+// Tracker records the intervals of each Delivery Service's state. It is safe for multiple goroutines.
+type Tracker struct {
+	m sync.RWMutex
+	// intervals are the intervals of each Delivery Service, oldest first. Only the last may be ongoing.
+	intervals   map[tc.DeliveryServiceName][]Interval
+	path        string
+	file        *os.File
+	w           *bufio.Writer
+	lastCompact time.Time
+}
+
+// NewTracker creates a new Tracker. If path isn't empty, the history is loaded from the file at that path, if it
+// exists, and new intervals are written to it.
+func NewTracker(path string) (*Tracker, error) {
+	return newTracker(path, time.Now())
+}
+
+func newTracker(path string, now time.Time) (*Tracker, error) {
+	t := &Tracker{intervals: map[tc.DeliveryServiceName][]Interval{}, path: path}
+	if path == "" {
+		return t, nil
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	t.prune(now)
+	if err := t.compact(now); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Run updates the intervals every time the given states change, until the process exits. It does not return.
+func (t *Tracker) Run(states peer.CRStatesThreadsafe, toData todata.TODataThreadsafe) {
+	checkpoint := time.NewTicker(checkpointInterval)
+	defer checkpoint.Stop()
+	for {
+		_, changed := states.Version()
+		t.update(time.Now(), states.Get(), toData.Get())
+		select {
+		case <-changed:
+		case now := <-checkpoint.C:
+			t.checkpoint(now)
+		}
+	}
+}
+
+// update records the state of every Delivery Service in the given states at the given time.
+func (t *Tracker) update(now time.Time, states tc.CRStates, toData todata.TOData) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	for name, ds := range states.DeliveryService {
+		state := newState(ds, toData.DeliveryServiceServers[name], states.Caches)
+		intervals := t.intervals[name]
+		if last := len(intervals) - 1; last >= 0 && intervals[last].End.IsZero() {
+			if intervals[last].State.equal(state) {
+				continue
+			}
+			intervals[last].End = now
+		}
+		t.intervals[name] = append(intervals, Interval{Start: now, State: state})
+		t.write(record{Type: recordTypeOpen, Time: now, DeliveryService: name, State: &state})
+	}
+	for name, intervals := range t.intervals {
+		if _, ok := states.DeliveryService[name]; ok {
+			continue
+		}
+		if last := len(intervals) - 1; last >= 0 && intervals[last].End.IsZero() {
+			intervals[last].End = now
+			t.write(record{Type: recordTypeClose, Time: now, DeliveryService: name})
+		}
+	}
+}
+
+func newState(ds tc.CRStatesDeliveryService, servers []tc.CacheName, caches map[tc.CacheName]tc.IsAvailable) State {
+	state := State{Available: ds.IsAvailable, DisabledLocations: make([]tc.CacheGroupName, len(ds.DisabledLocations))}
+	copy(state.DisabledLocations, ds.DisabledLocations)
+	sort.Slice(state.DisabledLocations, func(i, j int) bool { return state.DisabledLocations[i] < state.DisabledLocations[j] })
+	if len(servers) > 0 {
+		available := 0
+		for _, server := range servers {
+			if caches[server].IsAvailable {
+				available++
+			}
+		}
+		state.AvailableCachesPercent = float64(available) / float64(len(servers)) * 100
+	}
+	return state
+}
+
+// checkpoint records that the tracker was running at the given time, prunes intervals older than the Retention, and
+// compacts the history file if it's due.
+func (t *Tracker) checkpoint(now time.Time) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.prune(now)
+	if t.file != nil && now.Sub(t.lastCompact) >= compactInterval {
+		if err := t.compact(now); err != nil {
+			log.Errorf("sla: compacting history file: %v\n", err)
+		}
+		return
+	}
+	t.write(record{Type: recordTypeCheckpoint, Time: now})
+}
+
+// prune removes intervals which ended before the Retention. Callers must hold the write lock.
+func (t *Tracker) prune(now time.Time) {
+	oldest := now.Add(-Retention)
+	for name, intervals := range t.intervals {
+		i := 0
+		for i < len(intervals) && !intervals[i].End.IsZero() && intervals[i].End.Before(oldest) {
+			i++
+		}
+		if i == len(intervals) {
+			delete(t.intervals, name)
+			continue
+		}
+		t.intervals[name] = intervals[i:]
+	}
+}
+
+// write writes the given record to the history file, if there is one. Errors are logged rather than returned,
+// because the history must never interfere with monitoring. Callers must hold the write lock.
+func (t *Tracker) write(rec record) {
+	if t.w == nil {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Errorf("sla: encoding %s record: %v\n", rec.Type, err)
+		return
+	}
+	if _, err := t.w.Write(append(line, '\n')); err != nil {
+		log.Errorf("sla: writing %s record: %v\n", rec.Type, err)
+		return
+	}
+	if err := t.w.Flush(); err != nil {
+		log.Errorf("sla: writing %s record: %v\n", rec.Type, err)
+	}
+}
+
+// load reads the intervals from the history file, if it exists. Intervals which were ongoing when the file was last
+// written are ended at the last record, which is when Traffic Monitor was last known to be running.
+func (t *Tracker) load() error {
+	file, err := os.Open(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.New("opening history file: " + err.Error())
+	}
+	defer file.Close()
+
+	lastAlive := time.Time{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		rec := record{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// the last line may be partial, if Traffic Monitor was killed while writing it
+			log.Warnf("sla: skipping invalid history file '%s' line %d: %v\n", t.path, lineNum, err)
+			continue
+		}
+		if rec.Time.After(lastAlive) {
+			lastAlive = rec.Time
+		}
+		intervals := t.intervals[rec.DeliveryService]
+		last := len(intervals) - 1
+		switch rec.Type {
+		case recordTypeOpen:
+			if rec.State == nil {
+				log.Warnf("sla: skipping history file '%s' line %d: open record with no state\n", t.path, lineNum)
+				continue
+			}
+			if last >= 0 && intervals[last].End.IsZero() {
+				intervals[last].End = rec.Time
+			}
+			t.intervals[rec.DeliveryService] = append(intervals, Interval{Start: rec.Time, State: *rec.State})
+		case recordTypeClose:
+			if last >= 0 && intervals[last].End.IsZero() {
+				intervals[last].End = rec.Time
+			}
+		case recordTypeCheckpoint:
+		default:
+			log.Warnf("sla: skipping history file '%s' line %d: unknown record type '%s'\n", t.path, lineNum, rec.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.New("reading history file: " + err.Error())
+	}
+
+	for _, intervals := range t.intervals {
+		if last := len(intervals) - 1; last >= 0 && intervals[last].End.IsZero() {
+			intervals[last].End = lastAlive
+		}
+	}
+	return nil
+}
+
+// compact rewrites the history file with only the current intervals, and opens it for appending. Callers must hold
+// the write lock, or be the only reference to the tracker.
+func (t *Tracker) compact(now time.Time) error {
+	tmpPath := t.path + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.New("creating history file: " + err.Error())
+	}
+	w := bufio.NewWriter(tmpFile)
+	enc := json.NewEncoder(w)
+	for name, intervals := range t.intervals {
+		for i, interval := range intervals {
+			state := interval.State
+			if err := enc.Encode(record{Type: recordTypeOpen, Time: interval.Start, DeliveryService: name, State: &state}); err != nil {
+				tmpFile.Close()
+				return errors.New("writing history file: " + err.Error())
+			}
+			if interval.End.IsZero() || (i+1 < len(intervals) && intervals[i+1].Start.Equal(interval.End)) {
+				continue // the next open record ends this interval
+			}
+			if err := enc.Encode(record{Type: recordTypeClose, Time: interval.End, DeliveryService: name}); err != nil {
+				tmpFile.Close()
+				return errors.New("writing history file: " + err.Error())
+			}
+		}
+	}
+	if err := enc.Encode(record{Type: recordTypeCheckpoint, Time: now}); err != nil {
+		tmpFile.Close()
+		return errors.New("writing history file: " + err.Error())
+	}
+	if err := w.Flush(); err != nil {
+		tmpFile.Close()
+		return errors.New("writing history file: " + err.Error())
+	}
+	if err := tmpFile.Close(); err != nil {
+		return errors.New("closing history file: " + err.Error())
+	}
+
+	if t.file != nil {
+		if err := t.file.Close(); err != nil {
+			log.Warnf("sla: closing old history file: %v\n", err)
+		}
+		t.file, t.w = nil, nil
+	}
+	if err := os.Rename(tmpPath, t.path); err != nil {
+		return errors.New("replacing history file: " + err.Error())
+	}
+	file, err := os.OpenFile(t.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.New("opening history file: " + err.Error())
+	}
+	t.file, t.w = file, bufio.NewWriter(file)
+	t.lastCompact = now
+	return nil
+}
+
+// Close ends all ongoing intervals, and closes the history file, if there is one.
+func (t *Tracker) Close() error {
+	t.m.Lock()
+	defer t.m.Unlock()
+	now := time.Now()
+	for name, intervals := range t.intervals {
+		if last := len(intervals) - 1; last >= 0 && intervals[last].End.IsZero() {
+			intervals[last].End = now
+			t.write(record{Type: recordTypeClose, Time: now, DeliveryService: name})
+		}
+	}
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file, t.w = nil, nil
+	if err != nil {
+		return fmt.Errorf("closing history file: %v", err)
+	}
+	return nil
+}
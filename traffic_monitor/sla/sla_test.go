@@ -0,0 +1,192 @@
+package sla
+
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+func testStates(dsAvailable bool, disabledLocations []tc.CacheGroupName, cachesAvailable ...bool) tc.CRStates {
+	states := tc.NewCRStates()
+	states.DeliveryService["ds1"] = tc.CRStatesDeliveryService{IsAvailable: dsAvailable, DisabledLocations: disabledLocations}
+	for i, available := range cachesAvailable {
+		states.Caches[tc.CacheName("edge"+string(rune('1'+i)))] = tc.IsAvailable{IsAvailable: available}
+	}
+	return states
+}
+
+func testTOData() todata.TOData {
+	toData := todata.New()
+	toData.DeliveryServiceServers["ds1"] = []tc.CacheName{"edge1", "edge2", "edge3", "edge4"}
+	return *toData
+}
+
+func TestReport(t *testing.T) {
+	tracker, err := NewTracker("")
+	if err != nil {
+		t.Fatalf("creating tracker: %v", err)
+	}
+	toData := testTOData()
+	start := time.Now().Add(-2 * time.Hour)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	tracker.update(at(0), testStates(true, nil, true, true, true, true), toData)
+	tracker.update(at(10), testStates(true, nil, true, true, true, true), toData) // unchanged
+	tracker.update(at(70), testStates(true, []tc.CacheGroupName{"cg2"}, true, true, false, false), toData)
+	tracker.update(at(80), testStates(false, []tc.CacheGroupName{"cg1", "cg2"}, false, true, false, false), toData)
+	tracker.update(at(85), testStates(false, []tc.CacheGroupName{"cg1", "cg2"}, false, false, false, false), toData)
+	tracker.update(at(90), testStates(true, nil, true, true, true, true), toData)
+	tracker.update(at(100), testStates(false, []tc.CacheGroupName{"cg1"}, false, false, true, true), toData)
+
+	report, ok := tracker.Report(at(120), "ds1")
+	if !ok {
+		t.Fatal("expected a report for ds1")
+	}
+	hour := report["1h"]
+	if hour.ObservedSeconds != 3600 {
+		t.Errorf("expected 1h observed seconds 3600, actual %v", hour.ObservedSeconds)
+	}
+	// 60-70, 90-100 available; 70-80 available with cg2 disabled; 80-90 and 100-120 unavailable
+	if hour.AvailableSeconds != 30*60 || *hour.UptimePercent != 50 {
+		t.Errorf("expected 1h available seconds 1800 and uptime 50%%, actual %v and %v", hour.AvailableSeconds, *hour.UptimePercent)
+	}
+	if hour.DegradedSeconds != 10*60 {
+		t.Errorf("expected 1h degraded seconds 600, actual %v", hour.DegradedSeconds)
+	}
+	if hour.DisabledLocationSeconds["cg1"] != 30*60 || hour.DisabledLocationSeconds["cg2"] != 20*60 {
+		t.Errorf("expected cg1 disabled 1800s and cg2 1200s, actual %+v", hour.DisabledLocationSeconds)
+	}
+	if *hour.MinAvailableCachesPercent != 0 {
+		t.Errorf("expected min available caches 0%%, actual %v", *hour.MinAvailableCachesPercent)
+	}
+	if len(hour.Outages) != 2 {
+		t.Fatalf("expected 2 outages, actual %+v", hour.Outages)
+	}
+	if !hour.Outages[0].Start.Equal(at(80)) || hour.Outages[0].End == nil || !hour.Outages[0].End.Equal(at(90)) {
+		t.Errorf("expected the outages from 80 to 85 and 85 to 90 minutes to merge, actual %+v", hour.Outages[0])
+	}
+	if !hour.Outages[1].Start.Equal(at(100)) || hour.Outages[1].End != nil {
+		t.Errorf("expected an ongoing outage from 100 minutes, actual %+v", hour.Outages[1])
+	}
+
+	day := report["24h"]
+	if day.ObservedSeconds != 120*60 || day.AvailableSeconds != 90*60 {
+		t.Errorf("expected 24h observed 7200s and available 5400s, actual %v and %v", day.ObservedSeconds, day.AvailableSeconds)
+	}
+	if _, ok := report["30d"]; !ok {
+		t.Error("expected a 30d report")
+	}
+
+	if report, _ := tracker.Report(at(-60), "ds1"); report["1h"].UptimePercent != nil {
+		t.Errorf("expected no uptime before the delivery service was observed, actual %v", *report["1h"].UptimePercent)
+	}
+	if _, ok := tracker.Report(at(120), "ds2"); ok {
+		t.Error("expected no report for an untracked delivery service")
+	}
+}
+
+func TestNewState(t *testing.T) {
+	ds := tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{"cg2", "cg1"}}
+	state := newState(ds, []tc.CacheName{"edge1", "edge2", "edge3", "edge4"}, testStates(true, nil, true, false, true, true).Caches)
+	if state.AvailableCachesPercent != 75 {
+		t.Errorf("expected 75%% of caches available, actual %v", state.AvailableCachesPercent)
+	}
+	if len(state.DisabledLocations) != 2 || state.DisabledLocations[0] != "cg1" {
+		t.Errorf("expected sorted disabled locations, actual %v", state.DisabledLocations)
+	}
+	if ds.DisabledLocations[0] != "cg2" {
+		t.Error("expected newState to not modify the delivery service's disabled locations")
+	}
+}
+
+func TestTrackerHistoryFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tm-sla-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sla.history")
+
+	start := time.Now().Add(-time.Hour)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	tracker, err := newTracker(path, at(0))
+	if err != nil {
+		t.Fatalf("creating tracker: %v", err)
+	}
+	toData := testTOData()
+
+	tracker.update(at(0), testStates(true, nil, true, true, true, true), toData)
+	tracker.update(at(10), testStates(false, []tc.CacheGroupName{"cg1"}, false, false, true, true), toData)
+	tracker.checkpoint(at(20))
+	// simulate Traffic Monitor being killed, without closing the tracker
+	tracker.m.Lock()
+	tracker.file.Close()
+	tracker.m.Unlock()
+
+	reopened, err := newTracker(path, at(30))
+	if err != nil {
+		t.Fatalf("reopening tracker: %v", err)
+	}
+	defer reopened.Close()
+	intervals := reopened.intervals["ds1"]
+	if len(intervals) != 2 {
+		t.Fatalf("expected 2 intervals after reopening, actual %+v", intervals)
+	}
+	if !intervals[0].Start.Equal(at(0)) || !intervals[0].End.Equal(at(10)) || !intervals[0].Available {
+		t.Errorf("expected an available interval from 0 to 10 minutes, actual %+v", intervals[0])
+	}
+	if !intervals[1].End.Equal(at(20)) || intervals[1].Available || len(intervals[1].DisabledLocations) != 1 {
+		t.Errorf("expected the ongoing interval to end at the last checkpoint, actual %+v", intervals[1])
+	}
+
+	reopened.update(at(40), testStates(true, nil, true, true, true, true), toData)
+	report, _ := reopened.Report(at(60), "ds1")
+	if hour := report["1h"]; hour.ObservedSeconds != 40*60 || hour.AvailableSeconds != 30*60 {
+		t.Errorf("expected the time Traffic Monitor was stopped to not be observed, actual observed %vs available %vs", hour.ObservedSeconds, hour.AvailableSeconds)
+	}
+}
+
+func TestTrackerPrune(t *testing.T) {
+	tracker, err := NewTracker("")
+	if err != nil {
+		t.Fatalf("creating tracker: %v", err)
+	}
+	toData := testTOData()
+	now := time.Now()
+	tracker.update(now.Add(-Retention-2*time.Hour), testStates(false, nil, false), toData)
+	tracker.update(now.Add(-Retention-time.Hour), testStates(true, nil, true), toData)
+	tracker.checkpoint(now)
+	if intervals := tracker.intervals["ds1"]; len(intervals) != 1 || !intervals[0].Available {
+		t.Errorf("expected intervals older than the retention to be pruned, and the ongoing one kept, actual %+v", intervals)
+	}
+
+	tracker.update(now, tc.NewCRStates(), toData)
+	if intervals := tracker.intervals["ds1"]; intervals[len(intervals)-1].End.IsZero() {
+		t.Error("expected a removed delivery service's interval to end")
+	}
+}
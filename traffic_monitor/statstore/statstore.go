@@ -0,0 +1,458 @@
+// Package statstore provides an optional on-disk ring buffer of polled cache
+// results, so stat and health history survives Traffic Monitor restarts and
+// may be queried by time range.
+package statstore
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+)
+
+const (
+	// PollerStat is the Record.Poller of results from the stat poller.
+	PollerStat = "stat"
+	// PollerHealth is the Record.Poller of results from the health poller.
+	PollerHealth = "health"
+)
+
+// segmentExt is the file extension of segment files. Segment file names are the
+// zero-padded Unix nanosecond time the segment was created, plus this extension.
+const segmentExt = ".jsonl"
+
+// segmentsPerStore is the number of segments the MaxBytes of a store is divided
+// into. Retention is enforced by deleting whole segments, so this is also the
+// granularity of size-based retention.
+const segmentsPerStore = 16
+
+// minSegmentBytes is the smallest a segment is allowed to be before it's rotated,
+// regardless of the configured MaxBytes.
+const minSegmentBytes = 1024 * 1024
+
+// segmentSlack is how far outside a segment's nominal time range records may be.
+// Results are timestamped when polled, not when written, so a record may be
+// slightly older than the segment it was written into.
+const segmentSlack = time.Minute
+
+// flushInterval is how often records are flushed to the current segment, so
+// readers of the segment file see recent records, and at most this long of
+// records are lost if the process is killed.
+const flushInterval = time.Second
+
+// addBufferLen is the number of records which may be waiting to be written
+// before Add starts dropping records.
+const addBufferLen = 4096
+
+// Config is the configuration of a Store.
+type Config struct {
+	// Dir is the directory segment files are written to. It is created if it
+	// doesn't exist.
+	Dir string
+	// MaxAge is the age after which records are deleted. If zero, records are
+	// never deleted for their age.
+	MaxAge time.Duration
+	// MaxBytes is the total size of all segments after which the oldest
+	// segments are deleted. If zero, records are never deleted for size.
+	MaxBytes uint64
+}
+
+// Record is a single polled result, as stored on disk.
+type Record struct {
+	Time        time.Time              `json:"time"`
+	Cache       string                 `json:"cache"`
+	Poller      string                 `json:"poller"`
+	PollID      uint64                 `json:"pollId"`
+	Available   bool                   `json:"available"`
+	Error       string                 `json:"error,omitempty"`
+	RequestTime time.Duration          `json:"requestTime"`
+	UsingIPv4   bool                   `json:"usingIPv4"`
+	Statistics  cache.Statistics       `json:"statistics"`
+	Vitals      cache.Vitals           `json:"vitals"`
+	Stats       map[string]interface{} `json:"stats,omitempty"`
+}
+
+// NewRecord creates a Record from the given result of the given poller.
+func NewRecord(r cache.Result, poller string) Record {
+	rec := Record{
+		Time:        r.Time,
+		Cache:       r.ID,
+		Poller:      poller,
+		PollID:      r.PollID,
+		Available:   r.Available,
+		RequestTime: r.RequestTime,
+		UsingIPv4:   r.UsingIPv4,
+		Statistics:  r.Statistics,
+		Vitals:      r.Vitals,
+		Stats:       r.Miscellaneous,
+	}
+	if r.Error != nil {
+		rec.Error = r.Error.Error()
+	}
+	return rec
+}
+
+// Result returns the cache.Result the Record was created from. Fields which
+// aren't stored, such as PrecomputedData and PollFinished, are left empty.
+func (rec Record) Result() cache.Result {
+	r := cache.Result{
+		Time:          rec.Time,
+		ID:            rec.Cache,
+		PollID:        rec.PollID,
+		Available:     rec.Available,
+		RequestTime:   rec.RequestTime,
+		UsingIPv4:     rec.UsingIPv4,
+		Statistics:    rec.Statistics,
+		Vitals:        rec.Vitals,
+		Miscellaneous: rec.Stats,
+	}
+	if rec.Error != "" {
+		r.Error = errors.New(rec.Error)
+	}
+	return r
+}
+
+// Store is an on-disk ring buffer of Records. Records are appended to the newest
+// segment file, and the oldest segments are deleted when the configured age or
+// size limits are exceeded.
+//
+// Store is safe for multiple goroutines. Add never blocks on disk IO; if the
+// writer can't keep up, records are dropped and counted.
+type Store struct {
+	cfg          Config
+	segmentBytes uint64
+	records      chan Record
+	done         chan struct{}
+	dropped      *uint64
+
+	// recordsClosed is guarded by closeM, so records aren't sent on the channel after it's closed.
+	recordsClosed bool
+	closeM        *sync.RWMutex
+
+	m        *sync.Mutex // guards everything below
+	segments []segment   // oldest first; the last is the one being written
+	file     *os.File
+	w        *bufio.Writer
+	closed   bool
+}
+
+// segment is a single segment file.
+type segment struct {
+	start time.Time
+	path  string
+	size  uint64
+}
+
+// Open opens the store in the given config's directory, creating it if
+// necessary. Existing segments are kept, subject to the configured retention,
+// and new records are written to a new segment.
+func Open(cfg Config) (*Store, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("no directory")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating directory '%s': %v", cfg.Dir, err)
+	}
+	segments, err := loadSegments(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("loading segments from '%s': %v", cfg.Dir, err)
+	}
+
+	segmentBytes := cfg.MaxBytes / segmentsPerStore
+	if segmentBytes < minSegmentBytes {
+		segmentBytes = minSegmentBytes
+	}
+
+	dropped := uint64(0)
+	s := &Store{
+		cfg:          cfg,
+		segmentBytes: segmentBytes,
+		records:      make(chan Record, addBufferLen),
+		done:         make(chan struct{}),
+		dropped:      &dropped,
+		closeM:       &sync.RWMutex{},
+		m:            &sync.Mutex{},
+		segments:     segments,
+	}
+	if err := s.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	go s.write()
+	return s, nil
+}
+
+// loadSegments returns the segments in the given directory, oldest first.
+func loadSegments(dir string) ([]segment, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	segments := []segment{}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		ns, err := strconv.ParseInt(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			log.Warnf("stat store: ignoring unknown file '%s' in '%s'\n", name, dir)
+			continue
+		}
+		segments = append(segments, segment{start: time.Unix(0, ns), path: filepath.Join(dir, name), size: uint64(info.Size())})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].start.Before(segments[j].start) })
+	return segments, nil
+}
+
+// Add queues the given result from the given poller to be written. It never
+// blocks; if too many records are waiting to be written, the record is dropped.
+// Records added after the store is closed are dropped.
+func (s *Store) Add(r cache.Result, poller string) {
+	s.closeM.RLock()
+	defer s.closeM.RUnlock()
+	if s.recordsClosed {
+		return
+	}
+	select {
+	case s.records <- NewRecord(r, poller):
+	default:
+		if n := atomic.AddUint64(s.dropped, 1); n == 1 || n%1000 == 0 {
+			log.Warnf("stat store: writer can't keep up, %d records dropped\n", n)
+		}
+	}
+}
+
+// Dropped returns the number of records which have been dropped because the
+// writer couldn't keep up.
+func (s *Store) Dropped() uint64 {
+	return atomic.LoadUint64(s.dropped)
+}
+
+// write writes records as they're added, flushing them every flushInterval,
+// until the store is closed.
+func (s *Store) write() {
+	defer close(s.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case rec, ok := <-s.records:
+			if !ok {
+				return
+			}
+			bts, err := json.Marshal(rec)
+			if err != nil {
+				log.Errorf("stat store: encoding record for '%s': %v\n", rec.Cache, err)
+				continue
+			}
+			bts = append(bts, '\n')
+			if err := s.append(bts); err != nil {
+				log.Errorf("stat store: writing record for '%s': %v\n", rec.Cache, err)
+			}
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				log.Errorf("stat store: flushing segment: %v\n", err)
+			}
+		}
+	}
+}
+
+// flush writes any buffered records to the current segment.
+func (s *Store) flush() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return nil
+	}
+	return s.w.Flush()
+}
+
+// append writes the given encoded record to the current segment, rotating and
+// pruning first if the segment is full.
+func (s *Store) append(bts []byte) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return errors.New("store closed")
+	}
+	if cur := &s.segments[len(s.segments)-1]; cur.size > 0 && cur.size+uint64(len(bts)) > s.segmentBytes {
+		if err := s.rotate(time.Now()); err != nil {
+			return err
+		}
+	}
+	if _, err := s.w.Write(bts); err != nil {
+		return err
+	}
+	s.segments[len(s.segments)-1].size += uint64(len(bts))
+	return nil
+}
+
+// rotate closes the current segment, if any, starts a new one created at the
+// given time, and prunes old segments. The mutex MUST be held by the caller.
+func (s *Store) rotate(now time.Time) error {
+	if s.file != nil {
+		if err := s.closeFile(); err != nil {
+			log.Errorf("stat store: closing segment: %v\n", err)
+		}
+	}
+	path := filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", now.UnixNano(), segmentExt))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("creating segment '%s': %v", path, err)
+	}
+	s.file = file
+	s.w = bufio.NewWriter(file)
+	s.segments = append(s.segments, segment{start: now, path: path})
+	s.prune(now)
+	return nil
+}
+
+// prune deletes segments older than MaxAge, and the oldest segments while the
+// total size exceeds MaxBytes. The current segment is never deleted. The mutex
+// MUST be held by the caller.
+func (s *Store) prune(now time.Time) {
+	total := uint64(0)
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	for len(s.segments) > 1 {
+		oldest := s.segments[0]
+		// a segment's records are all older than the start of the next segment
+		tooOld := s.cfg.MaxAge > 0 && now.Sub(s.segments[1].start) > s.cfg.MaxAge
+		tooBig := s.cfg.MaxBytes > 0 && total > s.cfg.MaxBytes
+		if !tooOld && !tooBig {
+			break
+		}
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			log.Errorf("stat store: removing segment '%s': %v\n", oldest.path, err)
+			break
+		}
+		total -= oldest.size
+		s.segments = s.segments[1:]
+	}
+}
+
+func (s *Store) closeFile() error {
+	if err := s.w.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// Range calls f with every stored record whose time is in [start, end], in the
+// order they were written, until f returns false. A zero start or end is
+// unbounded. Records still waiting to be written are not included.
+func (s *Store) Range(start time.Time, end time.Time, f func(rec Record) bool) error {
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return errors.New("store closed")
+	}
+	if err := s.w.Flush(); err != nil {
+		s.m.Unlock()
+		return fmt.Errorf("flushing current segment: %v", err)
+	}
+	segments := make([]segment, len(s.segments))
+	copy(segments, s.segments)
+	s.m.Unlock()
+
+	for i, seg := range segments {
+		if !end.IsZero() && seg.start.After(end.Add(segmentSlack)) {
+			break
+		}
+		if !start.IsZero() && i+1 < len(segments) && segments[i+1].start.Add(segmentSlack).Before(start) {
+			continue
+		}
+		// segments are only ever appended to, so reading while the writer appends
+		// is safe; a partially written final line simply fails to decode.
+		keepGoing, err := rangeSegment(seg.path, func(line []byte) bool {
+			rec := Record{}
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return true
+			}
+			if (!start.IsZero() && rec.Time.Before(start)) || (!end.IsZero() && rec.Time.After(end)) {
+				return true
+			}
+			return f(rec)
+		})
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // pruned since we copied the segment list
+			}
+			return fmt.Errorf("reading segment '%s': %v", seg.path, err)
+		}
+		if !keepGoing {
+			break
+		}
+	}
+	return nil
+}
+
+// rangeSegment calls f with each line of the given file, until f returns false.
+// Returns whether f always returned true.
+func rangeSegment(path string, f func(line []byte) bool) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if !f(scanner.Bytes()) {
+			return false, nil
+		}
+	}
+	return true, scanner.Err()
+}
+
+// Close stops accepting records, writes any records waiting to be written, and
+// closes the current segment. Records added after Close are dropped. Closing an
+// already closed store returns an error.
+func (s *Store) Close() error {
+	s.closeM.Lock()
+	if s.recordsClosed {
+		s.closeM.Unlock()
+		return errors.New("store already closed")
+	}
+	s.recordsClosed = true
+	close(s.records)
+	s.closeM.Unlock()
+	<-s.done
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.closed = true
+	return s.closeFile()
+}
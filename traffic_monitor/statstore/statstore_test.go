@@ -0,0 +1,214 @@
+package statstore
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+)
+
+func testResult(id string, t time.Time, loadavg float64) cache.Result {
+	return cache.Result{
+		ID:   id,
+		Time: t,
+		Statistics: cache.Statistics{
+			Loadavg:    cache.Loadavg{One: loadavg},
+			Interfaces: map[string]cache.Interface{"eth0": {Speed: 10000, BytesOut: 42}},
+		},
+		Miscellaneous: map[string]interface{}{"proxy.process.http.current_client_connections": float64(7)},
+	}
+}
+
+// flush waits until all added records have been written.
+func flush(s *Store) {
+	for i := 0; i < 100 && len(s.records) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestStoreRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statstore")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+
+	// results are timestamped when they're polled, shortly before they're added
+	start := time.Now().Add(-time.Minute)
+	for i := 0; i < 60; i++ {
+		s.Add(testResult("cache0", start.Add(time.Duration(i)*time.Second), float64(i)), PollerStat)
+	}
+	errResult := testResult("cache1", start.Add(30*time.Second), 0)
+	errResult.Error = errors.New("connection refused")
+	s.Add(errResult, PollerHealth)
+	flush(s)
+
+	recs := []Record{}
+	if err := s.Range(start.Add(20*time.Second), start.Add(30*time.Second), func(rec Record) bool {
+		recs = append(recs, rec)
+		return true
+	}); err != nil {
+		t.Fatalf("ranging store: %v", err)
+	}
+	if len(recs) != 12 {
+		t.Fatalf("expected 12 records in range, actual %d", len(recs))
+	}
+	if recs[0].Statistics.Loadavg.One != 20 {
+		t.Errorf("expected first record loadavg 20, actual %v", recs[0].Statistics.Loadavg.One)
+	}
+	last := recs[len(recs)-1]
+	if last.Cache != "cache1" || last.Poller != PollerHealth || last.Result().Error == nil {
+		t.Errorf("expected last record to be the cache1 health error, actual %+v", last)
+	}
+	if inf := recs[0].Result().Statistics.Interfaces["eth0"]; inf.BytesOut != 42 {
+		t.Errorf("expected interface bytes out 42, actual %v", inf.BytesOut)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("closing store: %v", err)
+	}
+
+	// history must survive reopening
+	s, err = Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("reopening store: %v", err)
+	}
+	defer s.Close()
+	count := 0
+	if err := s.Range(time.Time{}, time.Time{}, func(rec Record) bool {
+		count++
+		return count < 10
+	}); err != nil {
+		t.Fatalf("ranging reopened store: %v", err)
+	}
+	if count != 10 {
+		t.Errorf("expected range to stop after 10 records, actual %d", count)
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statstore")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	s := &Store{cfg: Config{Dir: dir, MaxAge: time.Hour, MaxBytes: 300}}
+	for i, age := range []time.Duration{5 * time.Hour, 3 * time.Hour, 30 * time.Minute, 20 * time.Minute, 10 * time.Minute} {
+		path := dir + "/" + time.Duration(i).String() + segmentExt
+		if err := ioutil.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatalf("writing segment: %v", err)
+		}
+		s.segments = append(s.segments, segment{start: now.Add(-age), path: path, size: 100})
+	}
+
+	s.prune(now)
+
+	// the 5h segment's records all predate the 3h segment, so it's too old; the
+	// 3h segment is within the age, but is then removed for size.
+	if len(s.segments) != 3 {
+		t.Fatalf("expected 3 segments after pruning, actual %d", len(s.segments))
+	}
+	if !s.segments[0].start.Equal(now.Add(-30 * time.Minute)) {
+		t.Errorf("expected oldest remaining segment to start 30m ago, actual %v", now.Sub(s.segments[0].start))
+	}
+	if _, err := os.Stat(dir + "/0s" + segmentExt); !os.IsNotExist(err) {
+		t.Errorf("expected pruned segment file to be removed, stat error: %v", err)
+	}
+}
+
+func TestStoreFlushesPeriodically(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statstore")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	defer s.Close()
+
+	s.Add(testResult("cache0", time.Now(), 1), PollerStat)
+	time.Sleep(flushInterval + 200*time.Millisecond)
+
+	// read the segment file directly, not with Range, which flushes
+	s.m.Lock()
+	path := s.segments[len(s.segments)-1].path
+	s.m.Unlock()
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading segment: %v", err)
+	}
+	if lines := strings.Count(string(bts), "\n"); lines != 1 {
+		t.Errorf("expected 1 flushed record in the segment file, actual %d", lines)
+	}
+}
+
+func TestStoreAddDuringClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statstore")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+
+	// pollers keep adding results while the process shuts down; Add must not send on the closed channel
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.Add(testResult(fmt.Sprintf("cache%d", i), time.Now(), float64(j)), PollerStat)
+			}
+		}(i)
+	}
+	time.Sleep(time.Millisecond)
+	if err := s.Close(); err != nil {
+		t.Errorf("closing store: %v", err)
+	}
+	wg.Wait()
+
+	s.Add(testResult("cache0", time.Now(), 1), PollerStat)
+	if err := s.Close(); err == nil {
+		t.Error("expected an error closing an already closed store, actual nil")
+	}
+}
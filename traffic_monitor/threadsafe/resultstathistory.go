@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -32,6 +33,7 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_monitor/cache"
 	"github.com/apache/trafficcontrol/traffic_monitor/srvhttp"
+	"github.com/apache/trafficcontrol/traffic_monitor/statstore"
 
 	jsoniter "github.com/json-iterator/go"
 )
@@ -391,6 +393,9 @@ func generateStats(
 				if !filter.WithinStatHistoryMax(historyCount) {
 					break
 				}
+				if !filter.WithinTimeRange(val.Time) {
+					continue
+				}
 				if _, ok := stats.Caches[cacheId].Stats[stat]; !ok {
 					stats.Caches[cacheId].Stats[stat] = []tc.ResultStatVal{val}
 				} else {
@@ -413,6 +418,9 @@ func generateStats(
 					if !filter.WithinStatHistoryMax(historyCount) {
 						break
 					}
+					if !filter.WithinTimeRange(val.Time) {
+						continue
+					}
 					if _, ok := stats.Caches[cacheId].Interfaces[interfaceName]; !ok {
 						stats.Caches[cacheId].Interfaces[interfaceName] = map[string][]tc.ResultStatVal{}
 					}
@@ -433,8 +441,13 @@ func generateStats(
 			log.Warnf("cache.StatsMarshall server %s missing profile in monitorConfig\n", id)
 		}
 
-		for i, resultInfo := range statInfo[id] {
-			if !filter.WithinStatHistoryMax(uint64(i) + 1) {
+		var infoCount uint64 = 0
+		for _, resultInfo := range statInfo[id] {
+			if !filter.WithinTimeRange(resultInfo.Time) {
+				continue
+			}
+			infoCount++
+			if !filter.WithinStatHistoryMax(infoCount) {
 				break
 			}
 
@@ -510,3 +523,97 @@ func pruneStats(history []tc.ResultStatVal, limit uint64) []tc.ResultStatVal {
 	}
 	return history
 }
+
+// StoredHistory builds a ResultStatHistory and ResultInfoHistory from the
+// records in the given store between start and end, for the caches used by the
+// given filter. The histories have no limit, so they contain every stored value
+// in the range. Stat poller records populate both histories, while health
+// poller records only populate the info history, from which computed stats are
+// built.
+func StoredHistory(store *statstore.Store, start time.Time, end time.Time, filter cache.Filter) (ResultStatHistory, cache.ResultInfoHistory, error) {
+	records := map[string][]statstore.Record{}
+	err := store.Range(start, end, func(rec statstore.Record) bool {
+		if filter.UseCache(tc.CacheName(rec.Cache)) {
+			records[rec.Cache] = append(records[rec.Cache], rec)
+		}
+		return true
+	})
+	if err != nil {
+		return ResultStatHistory{}, nil, err
+	}
+
+	statHistory := NewResultStatHistory()
+	infoHistory := cache.ResultInfoHistory{}
+	for cacheName, recs := range records {
+		sort.SliceStable(recs, func(i, j int) bool { return recs[i].Time.Before(recs[j].Time) })
+
+		// histories are built oldest-first, so each value is an append, and
+		// reversed at the end to the newest-first order of the live histories.
+		stats := map[string][]tc.ResultStatVal{}
+		interfaceStats := map[string]map[string][]tc.ResultStatVal{}
+		infos := make([]cache.ResultInfo, 0, len(recs))
+		for _, rec := range recs {
+			infos = append(infos, cache.ToInfo(rec.Result()))
+			if rec.Poller != statstore.PollerStat {
+				continue
+			}
+			for statName, val := range rec.Stats {
+				stats[statName] = appendStoredStat(stats[statName], val, rec.Time)
+			}
+			for interfaceName, inf := range rec.Statistics.Interfaces {
+				infStats, ok := interfaceStats[interfaceName]
+				if !ok {
+					infStats = map[string][]tc.ResultStatVal{}
+					interfaceStats[interfaceName] = infStats
+				}
+				infStats[InterfaceStatNameSpeed] = appendStoredStat(infStats[InterfaceStatNameSpeed], inf.Speed, rec.Time)
+				infStats[InterfaceStatNameBytesOut] = appendStoredStat(infStats[InterfaceStatNameBytesOut], inf.BytesOut, rec.Time)
+				infStats[InterfaceStatNameBytesIn] = appendStoredStat(infStats[InterfaceStatNameBytesIn], inf.BytesIn, rec.Time)
+			}
+		}
+
+		for i, j := 0, len(infos)-1; i < j; i, j = i+1, j-1 {
+			infos[i], infos[j] = infos[j], infos[i]
+		}
+		infoHistory[tc.CacheName(cacheName)] = infos
+
+		cacheHistory := statHistory.LoadOrStore(cacheName)
+		for statName, vals := range stats {
+			cacheHistory.Stats.Store(statName, reverseStatVals(vals))
+		}
+		for interfaceName, infStats := range interfaceStats {
+			infHistory := NewResultStatValHistory()
+			for statName, vals := range infStats {
+				infHistory.Store(statName, reverseStatVals(vals))
+			}
+			cacheHistory.Interfaces[interfaceName] = infHistory
+		}
+	}
+	return statHistory, infoHistory, nil
+}
+
+// appendStoredStat appends the given stat value to the given oldest-first
+// history, extending the span of the newest value instead if it's equal.
+// Values which can't be compared to the newest value are dropped, as they are
+// by ResultStatHistory.Add.
+func appendStoredStat(history []tc.ResultStatVal, val interface{}, t time.Time) []tc.ResultStatVal {
+	if n := len(history); n > 0 {
+		equal, err := newStatEqual(history[n-1:], val)
+		if err != nil {
+			return history
+		}
+		if equal {
+			history[n-1].Time = t
+			history[n-1].Span++
+			return history
+		}
+	}
+	return append(history, tc.ResultStatVal{Val: val, Time: t, Span: 1})
+}
+
+func reverseStatVals(vals []tc.ResultStatVal) []tc.ResultStatVal {
+	for i, j := 0, len(vals)-1; i < j; i, j = i+1, j-1 {
+		vals[i], vals[j] = vals[j], vals[i]
+	}
+	return vals
+}
@@ -134,6 +134,11 @@ func (DummyFilterNever) UseCache(tc.CacheName) bool {
 func (DummyFilterNever) WithinStatHistoryMax(uint64) bool {
 	return false
 }
+
+func (DummyFilterNever) WithinTimeRange(time.Time) bool {
+	return false
+}
+
 func TestLegacyStatsMarshall(t *testing.T) {
 	statHist := randResultStatHistory()
 	infHist := randResultInfoHistory()
@@ -155,12 +155,16 @@ func (d TODataThreadsafe) Update(to towrap.TrafficOpsSessionThreadsafe, cdn stri
 	if err != nil {
 		return fmt.Errorf("Error getting last CRConfig: %v", err)
 	}
+	return d.SetCRConfig(crConfigBytes)
+}
 
+// SetCRConfig creates the TOData maps from the given raw CRConfig, and atomically sets the TOData.
+func (d TODataThreadsafe) SetCRConfig(crConfigBytes []byte) error {
 	newTOData := TOData{}
 
 	var crConfig CRConfig
 	json := jsoniter.ConfigFastest
-	err = json.Unmarshal(crConfigBytes, &crConfig)
+	err := json.Unmarshal(crConfigBytes, &crConfig)
 	if err != nil {
 		return fmt.Errorf("Error unmarshalling CRconfig: %v", err)
 	}
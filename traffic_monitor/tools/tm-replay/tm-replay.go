@@ -0,0 +1,76 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// tm-replay replays a Traffic Monitor record archive, and prints the
+// CRStates timeline it produces, as one JSON object per line.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/manager"
+)
+
+func main() {
+	archivePath := flag.String("archive", "", "The record archive, as written by Traffic Monitor's health_record_file")
+	configPath := flag.String("config", "", "The Traffic Monitor config file the archive was recorded with (optional)")
+	help := flag.Bool("help", false, "Usage info")
+	helpBrief := flag.Bool("h", false, "Usage info")
+	flag.Parse()
+	if *help || *helpBrief || *archivePath == "" {
+		fmt.Printf("Usage: ./tm-replay -archive /var/log/traffic_monitor/health.record -config /opt/traffic_monitor/conf/traffic_monitor.cfg\n")
+		return
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	archive, err := os.Open(*archivePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening archive: %v\n", err)
+		os.Exit(1)
+	}
+	defer archive.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	enc := json.NewEncoder(out)
+	encErr := error(nil)
+	err = manager.Replay(archive, cfg, func(state manager.ReplayState) {
+		if encErr == nil {
+			encErr = enc.Encode(state)
+		}
+	})
+	if err == nil {
+		err = encErr
+	}
+	if err != nil {
+		out.Flush()
+		fmt.Fprintf(os.Stderr, "Error replaying archive: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,39 @@
+/*
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.server_config_report (
+    id BIGSERIAL PRIMARY KEY,
+    server bigint NOT NULL,
+    mode text NOT NULL,
+    success boolean NOT NULL,
+    start_time timestamp with time zone NOT NULL,
+    duration_ms bigint NOT NULL DEFAULT 0,
+    reloaded boolean NOT NULL DEFAULT FALSE,
+    restarted boolean NOT NULL DEFAULT FALSE,
+    files jsonb NOT NULL DEFAULT '[]',
+    packages jsonb NOT NULL DEFAULT '[]',
+    warnings text[] NOT NULL DEFAULT '{}',
+    errors text[] NOT NULL DEFAULT '{}',
+    last_updated timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT fk_server_config_report_server FOREIGN KEY (server) REFERENCES server(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS server_config_report_server_start_time_idx ON public.server_config_report (server, start_time DESC);
+
+DROP TRIGGER IF EXISTS on_update_current_timestamp ON public.server_config_report;
+CREATE TRIGGER on_update_current_timestamp BEFORE UPDATE ON public.server_config_report FOR EACH ROW EXECUTE PROCEDURE on_update_current_timestamp_last_updated();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS on_update_current_timestamp ON public.server_config_report;
+DROP INDEX IF EXISTS server_config_report_server_start_time_idx;
+DROP TABLE IF EXISTS public.server_config_report;
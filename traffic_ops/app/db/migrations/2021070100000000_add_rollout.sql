@@ -0,0 +1,67 @@
+/*
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.rollout (
+    id BIGSERIAL PRIMARY KEY,
+    cdn bigint NOT NULL,
+    cachegroup bigint,
+    topology text,
+    wave_percent integer,
+    wave_count integer,
+    failure_threshold integer NOT NULL DEFAULT 0,
+    wave_timeout_seconds integer NOT NULL DEFAULT 3600,
+    status text NOT NULL DEFAULT 'running',
+    current_wave integer NOT NULL DEFAULT 0,
+    waves integer NOT NULL DEFAULT 0,
+    wave_started timestamp with time zone,
+    message text NOT NULL DEFAULT '',
+    username text NOT NULL,
+    last_updated timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT fk_rollout_cdn FOREIGN KEY (cdn) REFERENCES cdn(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT fk_rollout_cachegroup FOREIGN KEY (cachegroup) REFERENCES cachegroup(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT fk_rollout_topology FOREIGN KEY (topology) REFERENCES topology(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT rollout_status_check CHECK (status IN ('running', 'completed', 'stopped', 'failed')),
+    CONSTRAINT rollout_wave_size_check CHECK ((wave_percent IS NULL) <> (wave_count IS NULL)),
+    CONSTRAINT rollout_wave_percent_check CHECK (wave_percent IS NULL OR (wave_percent >= 1 AND wave_percent <= 100)),
+    CONSTRAINT rollout_wave_count_check CHECK (wave_count IS NULL OR wave_count >= 1),
+    CONSTRAINT rollout_scope_check CHECK (cachegroup IS NULL OR topology IS NULL)
+);
+
+-- Only one rollout may be running on a CDN at a time, because waves of different rollouts would queue updates to each other's servers.
+CREATE UNIQUE INDEX IF NOT EXISTS rollout_cdn_running_idx ON public.rollout (cdn) WHERE status = 'running';
+
+CREATE TABLE IF NOT EXISTS public.rollout_server (
+    rollout bigint NOT NULL,
+    server bigint NOT NULL,
+    wave integer NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    message text NOT NULL DEFAULT '',
+    last_updated timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (rollout, server),
+    CONSTRAINT fk_rollout_server_rollout FOREIGN KEY (rollout) REFERENCES rollout(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT fk_rollout_server_server FOREIGN KEY (server) REFERENCES server(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT rollout_server_status_check CHECK (status IN ('pending', 'queued', 'updated', 'failed'))
+);
+
+DROP TRIGGER IF EXISTS on_update_current_timestamp ON public.rollout;
+CREATE TRIGGER on_update_current_timestamp BEFORE UPDATE ON public.rollout FOR EACH ROW EXECUTE PROCEDURE on_update_current_timestamp_last_updated();
+DROP TRIGGER IF EXISTS on_update_current_timestamp ON public.rollout_server;
+CREATE TRIGGER on_update_current_timestamp BEFORE UPDATE ON public.rollout_server FOR EACH ROW EXECUTE PROCEDURE on_update_current_timestamp_last_updated();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS on_update_current_timestamp ON public.rollout_server;
+DROP TRIGGER IF EXISTS on_update_current_timestamp ON public.rollout;
+DROP TABLE IF EXISTS public.rollout_server;
+DROP INDEX IF EXISTS rollout_cdn_running_idx;
+DROP TABLE IF EXISTS public.rollout;
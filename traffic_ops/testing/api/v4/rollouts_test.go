@@ -0,0 +1,175 @@
+package v4
+
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	client "github.com/apache/trafficcontrol/traffic_ops/v4-client"
+)
+
+func TestRollouts(t *testing.T) {
+	WithObjs(t, []TCObj{CDNs, Types, Tenants, Parameters, Profiles, Statuses, Divisions, Regions, PhysLocations, CacheGroups, Servers}, func() {
+		id := CreateTestRollouts(t)
+		CreateTestInvalidRollouts(t)
+		GetTestRollouts(t, id)
+		StopTestRollouts(t, id)
+	})
+}
+
+// getRolloutCDNID returns the ID of a CDN with cache servers in the testing data.
+func getRolloutCDNID(t *testing.T) int {
+	for _, server := range testData.Servers {
+		if server.CDNName == nil || !(strings.HasPrefix(server.Type, tc.EdgeTypePrefix) || strings.HasPrefix(server.Type, tc.MidTypePrefix)) {
+			continue
+		}
+		opts := client.NewRequestOptions()
+		opts.QueryParameters.Set("name", *server.CDNName)
+		resp, _, err := TOSession.GetCDNs(opts)
+		if err != nil {
+			t.Fatalf("cannot get CDN '%s': %v - alerts: %+v", *server.CDNName, err, resp.Alerts)
+		}
+		if len(resp.Response) != 1 {
+			t.Fatalf("expected exactly one CDN named '%s', actual %d", *server.CDNName, len(resp.Response))
+		}
+		return resp.Response[0].ID
+	}
+	t.Fatal("found no cache servers with a CDN in the testing data")
+	return 0
+}
+
+func CreateTestRollouts(t *testing.T) int {
+	percent := 50
+	req := tc.RolloutRequest{
+		CDNID:       getRolloutCDNID(t),
+		WavePercent: &percent,
+	}
+	resp, _, err := TOSession.CreateRollout(req, client.RequestOptions{})
+	if err != nil {
+		t.Fatalf("cannot create rollout: %v - alerts: %+v", err, resp.Alerts)
+	}
+	rollout := resp.Response
+	if rollout.Status != tc.RolloutStatusRunning {
+		t.Errorf("expected created rollout status '%s', actual '%s'", tc.RolloutStatusRunning, rollout.Status)
+	}
+	if rollout.CurrentWave != 0 {
+		t.Errorf("expected created rollout current wave 0, actual %d", rollout.CurrentWave)
+	}
+	if rollout.WaveTimeoutSeconds != tc.DefaultRolloutWaveTimeoutSeconds {
+		t.Errorf("expected created rollout default wave timeout %d, actual %d", tc.DefaultRolloutWaveTimeoutSeconds, rollout.WaveTimeoutSeconds)
+	}
+	if len(rollout.Servers) == 0 {
+		t.Fatal("expected created rollout to have servers, actual none")
+	}
+	for _, server := range rollout.Servers {
+		if server.Wave >= rollout.Waves {
+			t.Errorf("expected rollout server '%s' wave less than %d, actual %d", server.HostName, rollout.Waves, server.Wave)
+		}
+		expected := tc.RolloutServerStatusPending
+		if server.Wave == 0 {
+			expected = tc.RolloutServerStatusQueued
+		}
+		if server.Status != expected {
+			t.Errorf("expected rollout server '%s' in wave %d to be '%s', actual '%s'", server.HostName, server.Wave, expected, server.Status)
+		}
+	}
+	return rollout.ID
+}
+
+func CreateTestInvalidRollouts(t *testing.T) {
+	cdnID := getRolloutCDNID(t)
+	percent := 50
+	count := 1
+	nonexistentID := 999999
+
+	_, reqInf, err := TOSession.CreateRollout(tc.RolloutRequest{CDNID: cdnID, WavePercent: &percent}, client.RequestOptions{})
+	if err == nil {
+		t.Error("expected an error creating a second running rollout on the same CDN, actual nil")
+	} else if reqInf.StatusCode != http.StatusConflict {
+		t.Errorf("expected status code %d creating a second running rollout on the same CDN, actual %d", http.StatusConflict, reqInf.StatusCode)
+	}
+
+	invalid := map[string]tc.RolloutRequest{
+		"no wave size":           {CDNID: cdnID},
+		"both wave sizes":        {CDNID: cdnID, WavePercent: &percent, WaveCount: &count},
+		"nonexistent CDN":        {CDNID: nonexistentID, WaveCount: &count},
+		"nonexistent cachegroup": {CDNID: cdnID, CachegroupID: &nonexistentID, WaveCount: &count},
+		"negative threshold":     {CDNID: cdnID, WaveCount: &count, FailureThreshold: -1},
+	}
+	for name, req := range invalid {
+		_, reqInf, err := TOSession.CreateRollout(req, client.RequestOptions{})
+		if err == nil {
+			t.Errorf("expected an error creating a rollout with %s, actual nil", name)
+		} else if reqInf.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status code %d creating a rollout with %s, actual %d", http.StatusBadRequest, name, reqInf.StatusCode)
+		}
+	}
+}
+
+func GetTestRollouts(t *testing.T, id int) {
+	opts := client.NewRequestOptions()
+	opts.QueryParameters.Set("id", strconv.Itoa(id))
+	resp, _, err := TOSession.GetRollouts(opts)
+	if err != nil {
+		t.Fatalf("cannot get rollout %d: %v - alerts: %+v", id, err, resp.Alerts)
+	}
+	if len(resp.Response) != 1 {
+		t.Fatalf("expected exactly one rollout with id %d, actual %d", id, len(resp.Response))
+	}
+	if len(resp.Response[0].Servers) == 0 {
+		t.Errorf("expected rollout %d to have servers, actual none", id)
+	}
+
+	opts = client.NewRequestOptions()
+	opts.QueryParameters.Set("status", string(tc.RolloutStatusRunning))
+	resp, _, err = TOSession.GetRollouts(opts)
+	if err != nil {
+		t.Fatalf("cannot get running rollouts: %v - alerts: %+v", err, resp.Alerts)
+	}
+	for _, rollout := range resp.Response {
+		if rollout.Status != tc.RolloutStatusRunning {
+			t.Errorf("expected rollouts by status '%s' to only have that status, actual '%s'", tc.RolloutStatusRunning, rollout.Status)
+		}
+	}
+}
+
+func StopTestRollouts(t *testing.T, id int) {
+	resp, _, err := TOSession.StopRollout(id, client.RequestOptions{})
+	if err != nil {
+		t.Fatalf("cannot stop rollout %d: %v - alerts: %+v", id, err, resp.Alerts)
+	}
+	if resp.Response.Status != tc.RolloutStatusStopped {
+		t.Errorf("expected stopped rollout status '%s', actual '%s'", tc.RolloutStatusStopped, resp.Response.Status)
+	}
+
+	_, reqInf, err := TOSession.StopRollout(id, client.RequestOptions{})
+	if err == nil {
+		t.Error("expected an error stopping a rollout which isn't running, actual nil")
+	} else if reqInf.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status code %d stopping a rollout which isn't running, actual %d", http.StatusBadRequest, reqInf.StatusCode)
+	}
+
+	_, reqInf, err = TOSession.StopRollout(999999, client.RequestOptions{})
+	if err == nil {
+		t.Error("expected an error stopping a nonexistent rollout, actual nil")
+	} else if reqInf.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status code %d stopping a nonexistent rollout, actual %d", http.StatusNotFound, reqInf.StatusCode)
+	}
+}
@@ -0,0 +1,138 @@
+package v4
+
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	client "github.com/apache/trafficcontrol/traffic_ops/v4-client"
+)
+
+func TestServerConfigReports(t *testing.T) {
+	WithObjs(t, []TCObj{CDNs, Types, Tenants, Parameters, Profiles, Statuses, Divisions, Regions, PhysLocations, CacheGroups, Servers}, func() {
+		CreateTestServerConfigReports(t)
+		CreateTestInvalidServerConfigReports(t)
+		GetTestServerConfigReports(t)
+	})
+}
+
+func CreateTestServerConfigReports(t *testing.T) {
+	for _, server := range testData.Servers {
+		if server.HostName == nil {
+			t.Error("found a server in the testing data with null or undefined Host Name")
+			continue
+		}
+		report := tc.ServerConfigReportRequest{
+			HostName:   *server.HostName,
+			Mode:       "syncds",
+			Success:    true,
+			StartTime:  time.Now().Add(-time.Minute),
+			DurationMS: 1234,
+			Reloaded:   true,
+			Files: []tc.ServerConfigReportFile{
+				{Name: "remap.config", Path: "/opt/trafficserver/etc/trafficserver/remap.config", Applied: true, Diff: "+map http://foo/ http://bar/"},
+			},
+			Packages: []tc.ServerConfigReportPackage{
+				{Name: "trafficserver-9.0.0", Action: tc.ServerConfigReportPackageInstalled},
+			},
+			Warnings: []string{"test warning"},
+		}
+		resp, _, err := TOSession.CreateServerConfigReport(report, client.RequestOptions{})
+		if err != nil {
+			t.Errorf("cannot create server config report for server '%s': %v - alerts: %+v", *server.HostName, err, resp.Alerts)
+			continue
+		}
+		if resp.Response.HostName != *server.HostName {
+			t.Errorf("expected created server config report host name '%s', actual '%s'", *server.HostName, resp.Response.HostName)
+		}
+		if len(resp.Response.Files) != 1 || resp.Response.Files[0].Diff != report.Files[0].Diff {
+			t.Errorf("expected created server config report files %+v, actual %+v", report.Files, resp.Response.Files)
+		}
+		if len(resp.Response.Errors) != 0 {
+			t.Errorf("expected created server config report with no errors, actual %+v", resp.Response.Errors)
+		}
+	}
+}
+
+func CreateTestInvalidServerConfigReports(t *testing.T) {
+	report := tc.ServerConfigReportRequest{
+		HostName:  "server-which-does-not-exist",
+		Mode:      "syncds",
+		StartTime: time.Now(),
+	}
+	_, reqInf, err := TOSession.CreateServerConfigReport(report, client.RequestOptions{})
+	if err == nil {
+		t.Error("expected an error creating a server config report for a nonexistent server, actual nil")
+	} else if reqInf.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status code %d creating a server config report for a nonexistent server, actual %d", http.StatusNotFound, reqInf.StatusCode)
+	}
+
+	report = tc.ServerConfigReportRequest{}
+	_, reqInf, err = TOSession.CreateServerConfigReport(report, client.RequestOptions{})
+	if err == nil {
+		t.Error("expected an error creating a server config report with no host name, mode, or start time, actual nil")
+	} else if reqInf.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status code %d creating an invalid server config report, actual %d", http.StatusBadRequest, reqInf.StatusCode)
+	}
+}
+
+func GetTestServerConfigReports(t *testing.T) {
+	resp, _, err := TOSession.GetServerConfigReports(client.RequestOptions{})
+	if err != nil {
+		t.Fatalf("cannot get server config reports: %v - alerts: %+v", err, resp.Alerts)
+	}
+	if len(resp.Response) != len(testData.Servers) {
+		t.Errorf("expected %d server config reports, actual %d", len(testData.Servers), len(resp.Response))
+	}
+
+	for _, server := range testData.Servers {
+		if server.HostName == nil || server.Cachegroup == nil || server.CDNName == nil {
+			t.Error("found a server in the testing data with null or undefined Host Name, Cache Group, or CDN Name")
+			continue
+		}
+		params := map[string]string{
+			"hostName":   *server.HostName,
+			"cachegroup": *server.Cachegroup,
+			"cdn":        *server.CDNName,
+		}
+		for param, val := range params {
+			opts := client.NewRequestOptions()
+			opts.QueryParameters.Set(param, val)
+			resp, _, err := TOSession.GetServerConfigReports(opts)
+			if err != nil {
+				t.Errorf("cannot get server config reports by %s '%s': %v - alerts: %+v", param, val, err, resp.Alerts)
+				continue
+			}
+			found := false
+			for _, report := range resp.Response {
+				if report.HostName == *server.HostName {
+					found = true
+				}
+				if param == "cachegroup" && report.Cachegroup != val {
+					t.Errorf("expected server config reports by cachegroup '%s' to only have that cachegroup, actual '%s'", val, report.Cachegroup)
+				} else if param == "cdn" && report.CDN != val {
+					t.Errorf("expected server config reports by cdn '%s' to only have that cdn, actual '%s'", val, report.CDN)
+				}
+			}
+			if !found {
+				t.Errorf("expected server config reports by %s '%s' to include server '%s', actual %+v", param, val, *server.HostName, resp.Response)
+			}
+		}
+	}
+}
@@ -115,6 +115,9 @@ type ConfigTrafficOpsGolang struct {
 	// CRConfigEmulateOldPath is whether to emulate the legacy CRConfig request path when generating a new CRConfig. This primarily exists in the event a tool relies on the legacy path '/tools/write_crconfig'.
 	// Deprecated: will be removed in the next major version.
 	CRConfigEmulateOldPath bool `json:"crconfig_emulate_old_path"`
+
+	// RolloutPollIntervalSeconds is how often running rollouts are progressed. If negative, this instance doesn't progress rollouts.
+	RolloutPollIntervalSeconds int `json:"rollout_poll_interval_seconds"`
 }
 
 // RoutingBlacklist contains a list of route IDs that are disabled,
@@ -215,6 +218,7 @@ func NewFakeConfig() Config {
 
 const DefaultLDAPTimeoutSecs = 60
 const DefaultDBQueryTimeoutSecs = 20
+const DefaultRolloutPollIntervalSecs = 30
 
 // ErrorLog - critical messages
 func (c Config) ErrorLog() log.LogLocation {
@@ -392,6 +396,9 @@ func ParseConfig(cfg Config) (Config, error) {
 	if cfg.DBQueryTimeoutSeconds == 0 {
 		cfg.DBQueryTimeoutSeconds = DefaultDBQueryTimeoutSecs
 	}
+	if cfg.RolloutPollIntervalSeconds == 0 {
+		cfg.RolloutPollIntervalSeconds = DefaultRolloutPollIntervalSecs
+	}
 
 	invalidTOURLStr := ""
 	var err error
@@ -0,0 +1,427 @@
+package rollout
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
+
+	"github.com/lib/pq"
+)
+
+const readQuery = `
+SELECT r.id,
+	r.cdn,
+	cdn.name,
+	r.cachegroup,
+	cg.name,
+	r.topology,
+	r.wave_percent,
+	r.wave_count,
+	r.failure_threshold,
+	r.wave_timeout_seconds,
+	r.status,
+	r.current_wave,
+	r.waves,
+	r.wave_started,
+	r.message,
+	r.username,
+	r.last_updated
+FROM rollout AS r
+INNER JOIN cdn ON cdn.id = r.cdn
+LEFT JOIN cachegroup AS cg ON cg.id = r.cachegroup
+`
+
+const serversQuery = `
+SELECT rs.rollout,
+	rs.server,
+	s.host_name,
+	cg.name,
+	rs.wave,
+	rs.status,
+	rs.message
+FROM rollout_server AS rs
+INNER JOIN server AS s ON s.id = rs.server
+INNER JOIN cachegroup AS cg ON cg.id = s.cachegroup
+WHERE rs.rollout = ANY($1)
+ORDER BY rs.wave, cg.name, s.host_name
+`
+
+// scopeQuery selects the cache servers of a CDN, optionally limited to a cachegroup or the cachegroups of a topology.
+const scopeQuery = `
+SELECT s.id, s.host_name, cg.name
+FROM server AS s
+INNER JOIN type AS t ON t.id = s.type
+INNER JOIN cachegroup AS cg ON cg.id = s.cachegroup
+WHERE s.cdn_id = $1
+AND (t.name LIKE '` + tc.EdgeTypePrefix + `%' OR t.name LIKE '` + tc.MidTypePrefix + `%')
+AND ($2::bigint IS NULL OR s.cachegroup = $2)
+AND ($3::text IS NULL OR cg.name IN (SELECT tcg.cachegroup FROM topology_cachegroup AS tcg WHERE tcg.topology = $3))
+ORDER BY cg.name, s.host_name
+`
+
+const insertQuery = `
+INSERT INTO rollout (cdn, cachegroup, topology, wave_percent, wave_count, failure_threshold, wave_timeout_seconds, waves, username)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id
+`
+
+const insertServerQuery = `
+INSERT INTO rollout_server (rollout, server, wave)
+VALUES ($1, $2, $3)
+`
+
+// Read is the handler for GET requests to /rollouts.
+func Read(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	tx := inf.Tx.Tx
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	queryParamsToQueryCols := map[string]dbhelpers.WhereColumnInfo{
+		"id":     dbhelpers.WhereColumnInfo{Column: "r.id", Checker: api.IsInt},
+		"cdn":    dbhelpers.WhereColumnInfo{Column: "cdn.name"},
+		"cdnId":  dbhelpers.WhereColumnInfo{Column: "r.cdn", Checker: api.IsInt},
+		"status": dbhelpers.WhereColumnInfo{Column: "r.status"},
+	}
+
+	where, orderBy, pagination, queryValues, errs := dbhelpers.BuildWhereAndOrderByAndPagination(inf.Params, queryParamsToQueryCols)
+	if len(errs) > 0 {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, util.JoinErrs(errs), nil)
+		return
+	}
+	if orderBy == "" {
+		orderBy = "\nORDER BY r.id DESC"
+	}
+
+	rows, err := inf.Tx.NamedQuery(readQuery+where+orderBy+pagination, queryValues)
+	if err != nil {
+		userErr, sysErr, errCode = api.ParseDBError(err)
+		if sysErr != nil {
+			sysErr = fmt.Errorf("rollout read query: %v", sysErr)
+		}
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	defer rows.Close()
+
+	rollouts := []tc.Rollout{}
+	for rows.Next() {
+		rollout, err := scanRollout(rows)
+		if err != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("scanning rollouts: "+err.Error()))
+			return
+		}
+		rollouts = append(rollouts, rollout)
+	}
+	if err := addServers(tx, rollouts); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("getting rollout servers: "+err.Error()))
+		return
+	}
+
+	api.WriteResp(w, r, rollouts)
+}
+
+// Create is the handler for POST requests to /rollouts.
+// It assigns the servers in the request's scope to waves, and queues updates to the first wave.
+func Create(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	tx := inf.Tx.Tx
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	var req tc.RolloutRequest
+	if userErr = api.Parse(r.Body, tx, &req); userErr != nil {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, userErr, nil)
+		return
+	}
+
+	cdnName, ok, err := dbhelpers.GetCDNNameFromID(tx, int64(req.CDNID))
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("getting CDN name from ID '"+strconv.Itoa(req.CDNID)+"': "+err.Error()))
+		return
+	} else if !ok {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("cdn "+strconv.Itoa(req.CDNID)+" does not exist"), nil)
+		return
+	}
+	if req.CachegroupID != nil {
+		if _, ok, err := dbhelpers.GetCacheGroupNameFromID(tx, *req.CachegroupID); err != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("getting cachegroup name from ID '"+strconv.Itoa(*req.CachegroupID)+"': "+err.Error()))
+			return
+		} else if !ok {
+			api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("cachegroup "+strconv.Itoa(*req.CachegroupID)+" does not exist"), nil)
+			return
+		}
+	}
+	if req.Topology != nil {
+		if ok, err := dbhelpers.TopologyExists(tx, *req.Topology); err != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("checking whether topology '"+*req.Topology+"' exists: "+err.Error()))
+			return
+		} else if !ok {
+			api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("no topology exists by the name of "+*req.Topology), nil)
+			return
+		}
+	}
+	userErr, sysErr, statusCode := dbhelpers.CheckIfCurrentUserHasCdnLock(tx, string(cdnName), inf.User.UserName)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, statusCode, userErr, sysErr)
+		return
+	}
+
+	if running, err := runningRolloutID(tx, req.CDNID); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("checking for running rollouts: "+err.Error()))
+		return
+	} else if running != 0 {
+		api.HandleErr(w, r, tx, http.StatusConflict, fmt.Errorf("rollout %d is already running on cdn %s, it must complete or be stopped first", running, cdnName), nil)
+		return
+	}
+
+	servers, err := getScopeServers(tx, req)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("getting rollout servers: "+err.Error()))
+		return
+	}
+	if len(servers) == 0 {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("no cache servers to roll out to"), nil)
+		return
+	}
+	waves, numWaves := assignWaves(servers, req.WavePercent, req.WaveCount)
+
+	waveTimeoutSeconds := tc.DefaultRolloutWaveTimeoutSeconds
+	if req.WaveTimeoutSeconds != nil {
+		waveTimeoutSeconds = *req.WaveTimeoutSeconds
+	}
+
+	id := 0
+	if err := tx.QueryRow(insertQuery, req.CDNID, req.CachegroupID, req.Topology, req.WavePercent, req.WaveCount, req.FailureThreshold, waveTimeoutSeconds, numWaves, inf.User.UserName).Scan(&id); err != nil {
+		userErr, sysErr, errCode = api.ParseDBError(err)
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	for _, sv := range servers {
+		if _, err := tx.Exec(insertServerQuery, id, sv.ID, waves[sv.ID]); err != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("inserting rollout %d server %d: %v", id, sv.ID, err))
+			return
+		}
+	}
+	if err := startWave(tx, id, 0); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("starting rollout %d: %v", id, err))
+		return
+	}
+
+	resp, err := getRollout(tx, id)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("querying created rollout %d: %v", id, err))
+		return
+	}
+
+	api.CreateChangeLogRawTx(api.ApiChange, fmt.Sprintf("ROLLOUT: %d, CDN: %s, ACTION: Started rollout of server updates to %d servers in %d waves", id, cdnName, len(servers), numWaves), inf.User, tx)
+	alertMsg := fmt.Sprintf("Rollout %d created, queued updates to wave 1 of %d", id, numWaves)
+	api.WriteAlertsObj(w, r, http.StatusCreated, tc.CreateAlerts(tc.SuccessLevel, alertMsg), resp)
+}
+
+// Stop is the handler for POST requests to /rollouts/{id}/stop.
+// Servers whose updates are already queued stay queued, but no more waves are started.
+func Stop(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"id"}, []string{"id"})
+	tx := inf.Tx.Tx
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	id := inf.IntParams["id"]
+	rollout, err := getRollout(tx, id)
+	if err == sql.ErrNoRows {
+		api.HandleErr(w, r, tx, http.StatusNotFound, fmt.Errorf("no rollout with id %d", id), nil)
+		return
+	} else if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting rollout %d: %v", id, err))
+		return
+	}
+	userErr, sysErr, statusCode := dbhelpers.CheckIfCurrentUserHasCdnLock(tx, rollout.CDN, inf.User.UserName)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, statusCode, userErr, sysErr)
+		return
+	}
+
+	// Lock the rollout so the worker can't progress it while it's stopped, and check its status after locking,
+	// because the worker may have completed or failed it since it was read.
+	status := tc.RolloutStatus("")
+	if err := tx.QueryRow(`SELECT status FROM rollout WHERE id = $1 FOR UPDATE`, id).Scan(&status); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("locking rollout %d: %v", id, err))
+		return
+	}
+	if status != tc.RolloutStatusRunning {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, fmt.Errorf("rollout %d isn't running, it's %s", id, status), nil)
+		return
+	}
+
+	if err := setStatus(tx, id, tc.RolloutStatusStopped, "stopped by "+inf.User.UserName); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("stopping rollout %d: %v", id, err))
+		return
+	}
+	resp, err := getRollout(tx, id)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("querying stopped rollout %d: %v", id, err))
+		return
+	}
+
+	api.CreateChangeLogRawTx(api.ApiChange, fmt.Sprintf("ROLLOUT: %d, CDN: %s, ACTION: Stopped rollout of server updates", id, rollout.CDN), inf.User, tx)
+	api.WriteAlertsObj(w, r, http.StatusOK, tc.CreateAlerts(tc.SuccessLevel, fmt.Sprintf("Rollout %d stopped", id)), resp)
+}
+
+// runningRolloutID returns the ID of the running rollout on the given CDN, or 0 if there is none.
+func runningRolloutID(tx *sql.Tx, cdnID int) (int, error) {
+	id := 0
+	if err := tx.QueryRow(`SELECT id FROM rollout WHERE cdn = $1 AND status = $2`, cdnID, tc.RolloutStatusRunning).Scan(&id); err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	return id, nil
+}
+
+// getScopeServers returns the cache servers in the scope of the rollout request, ordered by cachegroup and host name.
+func getScopeServers(tx *sql.Tx, req tc.RolloutRequest) ([]scopeServer, error) {
+	rows, err := tx.Query(scopeQuery, req.CDNID, req.CachegroupID, req.Topology)
+	if err != nil {
+		return nil, errors.New("querying: " + err.Error())
+	}
+	defer rows.Close()
+	servers := []scopeServer{}
+	for rows.Next() {
+		sv := scopeServer{}
+		if err := rows.Scan(&sv.ID, &sv.HostName, &sv.Cachegroup); err != nil {
+			return nil, errors.New("scanning: " + err.Error())
+		}
+		servers = append(servers, sv)
+	}
+	return servers, nil
+}
+
+// startWave queues updates to the pending servers in the given wave of the rollout, and makes it the current wave.
+func startWave(tx *sql.Tx, id int, wave int) error {
+	if _, err := tx.Exec(`
+UPDATE server SET upd_pending = TRUE
+WHERE id IN (SELECT server FROM rollout_server WHERE rollout = $1 AND wave = $2 AND status = $3)
+`, id, wave, tc.RolloutServerStatusPending); err != nil {
+		return errors.New("queueing server updates: " + err.Error())
+	}
+	if _, err := tx.Exec(`UPDATE rollout_server SET status = $1 WHERE rollout = $2 AND wave = $3 AND status = $4`, tc.RolloutServerStatusQueued, id, wave, tc.RolloutServerStatusPending); err != nil {
+		return errors.New("setting rollout server statuses: " + err.Error())
+	}
+	if _, err := tx.Exec(`UPDATE rollout SET current_wave = $1, wave_started = now(), message = '' WHERE id = $2`, wave, id); err != nil {
+		return errors.New("setting rollout current wave: " + err.Error())
+	}
+	return nil
+}
+
+// setStatus sets the status and message of the rollout.
+func setStatus(tx *sql.Tx, id int, status tc.RolloutStatus, msg string) error {
+	_, err := tx.Exec(`UPDATE rollout SET status = $1, message = $2 WHERE id = $3`, status, msg, id)
+	return err
+}
+
+// getRollout returns the rollout with the given ID, with its servers. Returns sql.ErrNoRows if it doesn't exist.
+func getRollout(tx *sql.Tx, id int) (tc.Rollout, error) {
+	rollout, err := scanRollout(tx.QueryRow(readQuery+"WHERE r.id = $1", id))
+	if err != nil {
+		return tc.Rollout{}, err
+	}
+	rollouts := []tc.Rollout{rollout}
+	if err := addServers(tx, rollouts); err != nil {
+		return tc.Rollout{}, errors.New("getting servers: " + err.Error())
+	}
+	return rollouts[0], nil
+}
+
+// addServers sets the Servers of each of the rollouts.
+func addServers(tx *sql.Tx, rollouts []tc.Rollout) error {
+	if len(rollouts) == 0 {
+		return nil
+	}
+	ids := []int64{}
+	idxs := map[int]int{}
+	for i, rollout := range rollouts {
+		ids = append(ids, int64(rollout.ID))
+		idxs[rollout.ID] = i
+		rollouts[i].Servers = []tc.RolloutServer{}
+	}
+	rows, err := tx.Query(serversQuery, pq.Array(ids))
+	if err != nil {
+		return errors.New("querying: " + err.Error())
+	}
+	defer rows.Close()
+	for rows.Next() {
+		id := 0
+		sv := tc.RolloutServer{}
+		if err := rows.Scan(&id, &sv.ServerID, &sv.HostName, &sv.Cachegroup, &sv.Wave, &sv.Status, &sv.Message); err != nil {
+			return errors.New("scanning: " + err.Error())
+		}
+		if i, ok := idxs[id]; ok {
+			rollouts[i].Servers = append(rollouts[i].Servers, sv)
+		}
+	}
+	return nil
+}
+
+// scanner is a row which can be scanned, such as *sql.Row, *sql.Rows, or *sqlx.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRollout scans a row of readQuery into a Rollout, without its Servers.
+func scanRollout(row scanner) (tc.Rollout, error) {
+	rollout := tc.Rollout{}
+	err := row.Scan(
+		&rollout.ID,
+		&rollout.CDNID,
+		&rollout.CDN,
+		&rollout.CachegroupID,
+		&rollout.Cachegroup,
+		&rollout.Topology,
+		&rollout.WavePercent,
+		&rollout.WaveCount,
+		&rollout.FailureThreshold,
+		&rollout.WaveTimeoutSeconds,
+		&rollout.Status,
+		&rollout.CurrentWave,
+		&rollout.Waves,
+		&rollout.WaveStarted,
+		&rollout.Message,
+		&rollout.Username,
+		&rollout.LastUpdated,
+	)
+	return rollout, err
+}
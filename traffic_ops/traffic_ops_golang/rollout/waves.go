@@ -0,0 +1,131 @@
+package rollout
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// scopeServer is a cache server in the scope of a rollout, before it's assigned a wave.
+type scopeServer struct {
+	ID         int
+	HostName   string
+	Cachegroup string
+}
+
+// assignWaves assigns each server a wave, and returns the waves by server ID, and the number of waves.
+//
+// Each wave has wavePercent percent, rounded up, or waveCount of the servers of each cachegroup, so every cachegroup
+// keeps most of its servers on the old config until the rollout has been through a few waves.
+// Servers in each cachegroup are assigned in the order given. Exactly one of wavePercent or waveCount must be non-nil.
+func assignWaves(servers []scopeServer, wavePercent *int, waveCount *int) (map[int]int, int) {
+	cgServers := map[string][]scopeServer{}
+	for _, sv := range servers {
+		cgServers[sv.Cachegroup] = append(cgServers[sv.Cachegroup], sv)
+	}
+
+	waves := map[int]int{}
+	numWaves := 0
+	for _, cgSvs := range cgServers {
+		size := 1
+		if waveCount != nil {
+			size = *waveCount
+		} else if wavePercent != nil {
+			size = (len(cgSvs)**wavePercent + 99) / 100
+		}
+		if size < 1 {
+			size = 1
+		}
+		for i, sv := range cgSvs {
+			wave := i / size
+			waves[sv.ID] = wave
+			if wave+1 > numWaves {
+				numWaves = wave + 1
+			}
+		}
+	}
+	return waves, numWaves
+}
+
+// waveServer is a server in the current wave of a rollout.
+type waveServer struct {
+	ID       int
+	HostName string
+	Status   tc.RolloutServerStatus
+	// UpdPending is the server's upd_pending flag.
+	UpdPending bool
+	// ServerStatus is the status of the server itself, e.g. REPORTED.
+	ServerStatus string
+}
+
+// serverUpdate is a change to the status of a server in a rollout.
+type serverUpdate struct {
+	ID      int
+	Status  tc.RolloutServerStatus
+	Message string
+}
+
+// updateStatusUpdates returns the changes to the statuses of the queued servers in a wave, and whether any servers
+// are still queued after the changes.
+//
+// Queued servers which have cleared their update pending flag are updated. Queued servers which haven't by the time
+// the wave times out are failed.
+func updateStatusUpdates(servers []waveServer, waveStarted time.Time, timeout time.Duration, now time.Time) ([]serverUpdate, bool) {
+	updates := []serverUpdate{}
+	anyQueued := false
+	timedOut := now.Sub(waveStarted) > timeout
+	for _, sv := range servers {
+		if sv.Status != tc.RolloutServerStatusQueued {
+			continue
+		}
+		if !sv.UpdPending {
+			updates = append(updates, serverUpdate{ID: sv.ID, Status: tc.RolloutServerStatusUpdated})
+			continue
+		}
+		if timedOut {
+			updates = append(updates, serverUpdate{ID: sv.ID, Status: tc.RolloutServerStatusFailed, Message: "didn't clear its update pending flag within " + timeout.String()})
+			continue
+		}
+		anyQueued = true
+	}
+	return updates, anyQueued
+}
+
+// availabilityUpdates returns the changes to the statuses of the updated servers in a wave, failing those which
+// Traffic Monitor reports are unavailable.
+//
+// Only REPORTED servers are checked, because Traffic Monitor always reports ONLINE servers available, and servers
+// with other statuses unavailable. Servers Traffic Monitor doesn't know about aren't failed.
+func availabilityUpdates(servers []waveServer, crStates tc.CRStates) []serverUpdate {
+	updates := []serverUpdate{}
+	for _, sv := range servers {
+		if sv.Status != tc.RolloutServerStatusUpdated || sv.ServerStatus != string(tc.CacheStatusReported) {
+			continue
+		}
+		avail, ok := crStates.Caches[tc.CacheName(sv.HostName)]
+		if !ok || avail.IsAvailable {
+			continue
+		}
+		updates = append(updates, serverUpdate{ID: sv.ID, Status: tc.RolloutServerStatusFailed, Message: "unavailable in Traffic Monitor after updating"})
+	}
+	return updates
+}
@@ -0,0 +1,164 @@
+package rollout
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+func TestAssignWaves(t *testing.T) {
+	servers := []scopeServer{
+		{ID: 1, HostName: "a1", Cachegroup: "a"},
+		{ID: 2, HostName: "a2", Cachegroup: "a"},
+		{ID: 3, HostName: "a3", Cachegroup: "a"},
+		{ID: 4, HostName: "a4", Cachegroup: "a"},
+		{ID: 5, HostName: "a5", Cachegroup: "a"},
+		{ID: 6, HostName: "b1", Cachegroup: "b"},
+		{ID: 7, HostName: "b2", Cachegroup: "b"},
+	}
+	intPtr := func(i int) *int { return &i }
+
+	type testCase struct {
+		name        string
+		percent     *int
+		count       *int
+		expected    map[int]int
+		expectedNum int
+	}
+	testCases := []testCase{
+		{
+			name:        "percent rounds up",
+			percent:     intPtr(25),
+			expected:    map[int]int{1: 0, 2: 0, 3: 1, 4: 1, 5: 2, 6: 0, 7: 1},
+			expectedNum: 3,
+		},
+		{
+			name:        "percent of at least one server",
+			percent:     intPtr(1),
+			expected:    map[int]int{1: 0, 2: 1, 3: 2, 4: 3, 5: 4, 6: 0, 7: 1},
+			expectedNum: 5,
+		},
+		{
+			name:        "all at once",
+			percent:     intPtr(100),
+			expected:    map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0, 6: 0, 7: 0},
+			expectedNum: 1,
+		},
+		{
+			name:        "count",
+			count:       intPtr(2),
+			expected:    map[int]int{1: 0, 2: 0, 3: 1, 4: 1, 5: 2, 6: 0, 7: 0},
+			expectedNum: 3,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			waves, num := assignWaves(servers, tc.percent, tc.count)
+			if num != tc.expectedNum {
+				t.Errorf("expected %d waves, actual %d", tc.expectedNum, num)
+			}
+			if len(waves) != len(tc.expected) {
+				t.Fatalf("expected %d servers assigned, actual %d", len(tc.expected), len(waves))
+			}
+			for id, wave := range tc.expected {
+				if waves[id] != wave {
+					t.Errorf("expected server %d in wave %d, actual %d", id, wave, waves[id])
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateStatusUpdates(t *testing.T) {
+	started := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	timeout := time.Hour
+	servers := []waveServer{
+		{ID: 1, Status: tc.RolloutServerStatusQueued, UpdPending: false},
+		{ID: 2, Status: tc.RolloutServerStatusQueued, UpdPending: true},
+		{ID: 3, Status: tc.RolloutServerStatusUpdated, UpdPending: false},
+		{ID: 4, Status: tc.RolloutServerStatusFailed, UpdPending: true},
+	}
+
+	updates, anyQueued := updateStatusUpdates(servers, started, timeout, started.Add(time.Minute))
+	if !anyQueued {
+		t.Error("expected servers still queued before the timeout")
+	}
+	if len(updates) != 1 || updates[0].ID != 1 || updates[0].Status != tc.RolloutServerStatusUpdated {
+		t.Errorf("expected only server 1 updated before the timeout, actual %+v", updates)
+	}
+
+	updates, anyQueued = updateStatusUpdates(servers, started, timeout, started.Add(2*time.Hour))
+	if anyQueued {
+		t.Error("expected no servers queued after the timeout")
+	}
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 updates after the timeout, actual %+v", updates)
+	}
+	if updates[0].ID != 1 || updates[0].Status != tc.RolloutServerStatusUpdated {
+		t.Errorf("expected server 1 updated after the timeout, actual %+v", updates[0])
+	}
+	if updates[1].ID != 2 || updates[1].Status != tc.RolloutServerStatusFailed || updates[1].Message == "" {
+		t.Errorf("expected server 2 failed with a message after the timeout, actual %+v", updates[1])
+	}
+}
+
+func TestAvailabilityUpdates(t *testing.T) {
+	servers := []waveServer{
+		{ID: 1, HostName: "available", Status: tc.RolloutServerStatusUpdated, ServerStatus: string(tc.CacheStatusReported)},
+		{ID: 2, HostName: "unavailable", Status: tc.RolloutServerStatusUpdated, ServerStatus: string(tc.CacheStatusReported)},
+		{ID: 3, HostName: "online", Status: tc.RolloutServerStatusUpdated, ServerStatus: string(tc.CacheStatusOnline)},
+		{ID: 4, HostName: "unknown", Status: tc.RolloutServerStatusUpdated, ServerStatus: string(tc.CacheStatusReported)},
+		{ID: 5, HostName: "failed", Status: tc.RolloutServerStatusFailed, ServerStatus: string(tc.CacheStatusReported)},
+	}
+	crStates := tc.CRStates{Caches: map[tc.CacheName]tc.IsAvailable{
+		"available":   {IsAvailable: true},
+		"unavailable": {IsAvailable: false},
+		"online":      {IsAvailable: false},
+		"failed":      {IsAvailable: false},
+	}}
+
+	updates := availabilityUpdates(servers, crStates)
+	if len(updates) != 1 {
+		t.Fatalf("expected 1 update, actual %+v", updates)
+	}
+	if updates[0].ID != 2 || updates[0].Status != tc.RolloutServerStatusFailed {
+		t.Errorf("expected server 2 failed, actual %+v", updates[0])
+	}
+}
+
+func TestApplyUpdates(t *testing.T) {
+	servers := []waveServer{
+		{ID: 1, Status: tc.RolloutServerStatusQueued},
+		{ID: 2, Status: tc.RolloutServerStatusQueued},
+	}
+	applied := applyUpdates(servers, []serverUpdate{{ID: 2, Status: tc.RolloutServerStatusUpdated}})
+	if applied[0].Status != tc.RolloutServerStatusQueued {
+		t.Errorf("expected server 1 still queued, actual %s", applied[0].Status)
+	}
+	if applied[1].Status != tc.RolloutServerStatusUpdated {
+		t.Errorf("expected server 2 updated, actual %s", applied[1].Status)
+	}
+	if servers[1].Status != tc.RolloutServerStatusQueued {
+		t.Error("expected applyUpdates not to modify its argument")
+	}
+}
@@ -0,0 +1,307 @@
+package rollout
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/util/monitorhlp"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StartWorker starts progressing running rollouts every interval, in a goroutine which runs until the app exits.
+// If interval isn't positive, rollouts aren't progressed by this app.
+//
+// Each rollout is locked while it's progressed, so multiple Traffic Ops instances may run workers.
+func StartWorker(db *sqlx.DB, interval time.Duration, dbTimeout time.Duration) {
+	if interval <= 0 {
+		log.Infoln("rollout poll interval is not positive, not progressing rollouts")
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			progressAll(db, dbTimeout)
+		}
+	}()
+}
+
+// progressAll progresses all running rollouts, logging any errors.
+func progressAll(db *sqlx.DB, dbTimeout time.Duration) {
+	rollouts, err := getRunning(db, dbTimeout)
+	if err != nil {
+		log.Errorln("rollouts: getting running rollouts: " + err.Error())
+		return
+	}
+	for _, rollout := range rollouts {
+		// CRStates are requested before the rollout is locked, so a slow Traffic Monitor doesn't hold the lock.
+		crStates, crStatesErr := getCRStates(db, dbTimeout, rollout.CDN)
+		if err := progress(db, dbTimeout, rollout.ID, crStates, crStatesErr); err != nil {
+			log.Errorf("rollouts: progressing rollout %d: %v\n", rollout.ID, err)
+		}
+	}
+}
+
+// runningRollout is the ID and CDN of a running rollout.
+type runningRollout struct {
+	ID  int
+	CDN tc.CDNName
+}
+
+func getRunning(db *sqlx.DB, dbTimeout time.Duration) ([]runningRollout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, `
+SELECT r.id, cdn.name
+FROM rollout AS r
+INNER JOIN cdn ON cdn.id = r.cdn
+WHERE r.status = $1
+ORDER BY r.id
+`, tc.RolloutStatusRunning)
+	if err != nil {
+		return nil, errors.New("querying: " + err.Error())
+	}
+	defer rows.Close()
+	rollouts := []runningRollout{}
+	for rows.Next() {
+		rollout := runningRollout{}
+		if err := rows.Scan(&rollout.ID, &rollout.CDN); err != nil {
+			return nil, errors.New("scanning: " + err.Error())
+		}
+		rollouts = append(rollouts, rollout)
+	}
+	return rollouts, nil
+}
+
+// progressRollout is the state of a running rollout needed to progress it.
+type progressRollout struct {
+	ID                 int
+	CDN                tc.CDNName
+	FailureThreshold   int
+	WaveTimeoutSeconds int
+	CurrentWave        int
+	Waves              int
+	WaveStarted        *time.Time
+}
+
+// progress progresses the running rollout with the given ID, in its own transaction, with the CRStates of its CDN,
+// or the error getting them.
+// If the rollout isn't running, or is locked by another Traffic Ops, nothing is done.
+func progress(db *sqlx.DB, dbTimeout time.Duration, id int, crStates tc.CRStates, crStatesErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.New("beginning transaction: " + err.Error())
+	}
+	commit := false
+	defer func() {
+		if !commit {
+			tx.Rollback()
+		}
+	}()
+
+	rollout := progressRollout{}
+	if err := tx.QueryRow(`
+SELECT r.id, cdn.name, r.failure_threshold, r.wave_timeout_seconds, r.current_wave, r.waves, r.wave_started
+FROM rollout AS r
+INNER JOIN cdn ON cdn.id = r.cdn
+WHERE r.id = $1 AND r.status = $2
+FOR UPDATE OF r SKIP LOCKED
+`, id, tc.RolloutStatusRunning).Scan(&rollout.ID, &rollout.CDN, &rollout.FailureThreshold, &rollout.WaveTimeoutSeconds, &rollout.CurrentWave, &rollout.Waves, &rollout.WaveStarted); err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return errors.New("querying rollout: " + err.Error())
+	}
+
+	if err := progressTx(tx, rollout, crStates, crStatesErr, time.Now()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("committing: " + err.Error())
+	}
+	commit = true
+	return nil
+}
+
+// progressTx progresses the locked rollout, with the CRStates of its CDN, or the error getting them.
+//
+// Servers in the current wave are updated or failed as they clear their update pending flags or time out. Once
+// none are queued, updated servers are checked against Traffic Monitor. Then, if too many servers have failed the
+// rollout fails, otherwise the next wave is started, or the rollout completes if this was the last wave.
+func progressTx(tx *sql.Tx, rollout progressRollout, crStates tc.CRStates, crStatesErr error, now time.Time) error {
+	servers, err := getWaveServers(tx, rollout.ID, rollout.CurrentWave)
+	if err != nil {
+		return errors.New("getting wave servers: " + err.Error())
+	}
+
+	waveStarted := now
+	if rollout.WaveStarted != nil {
+		waveStarted = *rollout.WaveStarted
+	}
+	updates, anyQueued := updateStatusUpdates(servers, waveStarted, time.Duration(rollout.WaveTimeoutSeconds)*time.Second, now)
+	if err := updateServers(tx, rollout.ID, updates); err != nil {
+		return err
+	}
+	if anyQueued {
+		return nil
+	}
+	for _, update := range updates {
+		if update.Status == tc.RolloutServerStatusUpdated {
+			// Give Traffic Monitor a poll interval to see the newly updated servers, before checking them.
+			return nil
+		}
+	}
+	servers = applyUpdates(servers, updates)
+
+	if crStatesErr != nil {
+		// Traffic Monitor may be briefly unavailable; note it on the rollout and try again next time.
+		if _, err := tx.Exec(`UPDATE rollout SET message = $1 WHERE id = $2`, "waiting for Traffic Monitor: "+crStatesErr.Error(), rollout.ID); err != nil {
+			return errors.New("setting message: " + err.Error())
+		}
+		return nil
+	}
+	if err := updateServers(tx, rollout.ID, availabilityUpdates(servers, crStates)); err != nil {
+		return err
+	}
+
+	failed := 0
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM rollout_server WHERE rollout = $1 AND status = $2`, rollout.ID, tc.RolloutServerStatusFailed).Scan(&failed); err != nil {
+		return errors.New("counting failed servers: " + err.Error())
+	}
+	if failed > rollout.FailureThreshold {
+		msg := fmt.Sprintf("%d servers failed, more than the failure threshold of %d", failed, rollout.FailureThreshold)
+		log.Infof("rollouts: rollout %d failed: %s\n", rollout.ID, msg)
+		if err := setStatus(tx, rollout.ID, tc.RolloutStatusFailed, msg); err != nil {
+			return errors.New("setting failed: " + err.Error())
+		}
+		return nil
+	}
+
+	if next := rollout.CurrentWave + 1; next < rollout.Waves {
+		log.Infof("rollouts: rollout %d starting wave %d of %d\n", rollout.ID, next+1, rollout.Waves)
+		if err := startWave(tx, rollout.ID, next); err != nil {
+			return fmt.Errorf("starting wave %d: %v", next, err)
+		}
+		return nil
+	}
+
+	log.Infof("rollouts: rollout %d completed\n", rollout.ID)
+	if err := setStatus(tx, rollout.ID, tc.RolloutStatusCompleted, ""); err != nil {
+		return errors.New("setting completed: " + err.Error())
+	}
+	return nil
+}
+
+// getWaveServers returns the servers in the given wave of the rollout.
+func getWaveServers(tx *sql.Tx, id int, wave int) ([]waveServer, error) {
+	rows, err := tx.Query(`
+SELECT s.id, s.host_name, rs.status, s.upd_pending, st.name
+FROM rollout_server AS rs
+INNER JOIN server AS s ON s.id = rs.server
+INNER JOIN status AS st ON st.id = s.status
+WHERE rs.rollout = $1 AND rs.wave = $2
+`, id, wave)
+	if err != nil {
+		return nil, errors.New("querying: " + err.Error())
+	}
+	defer rows.Close()
+	servers := []waveServer{}
+	for rows.Next() {
+		sv := waveServer{}
+		if err := rows.Scan(&sv.ID, &sv.HostName, &sv.Status, &sv.UpdPending, &sv.ServerStatus); err != nil {
+			return nil, errors.New("scanning: " + err.Error())
+		}
+		servers = append(servers, sv)
+	}
+	return servers, nil
+}
+
+// updateServers sets the statuses and messages of the rollout's servers.
+func updateServers(tx *sql.Tx, id int, updates []serverUpdate) error {
+	for _, update := range updates {
+		if _, err := tx.Exec(`UPDATE rollout_server SET status = $1, message = $2 WHERE rollout = $3 AND server = $4`, update.Status, update.Message, id, update.ID); err != nil {
+			return fmt.Errorf("updating server %d: %v", update.ID, err)
+		}
+	}
+	return nil
+}
+
+// applyUpdates returns the servers with the given status updates applied.
+func applyUpdates(servers []waveServer, updates []serverUpdate) []waveServer {
+	statuses := map[int]tc.RolloutServerStatus{}
+	for _, update := range updates {
+		statuses[update.ID] = update.Status
+	}
+	applied := make([]waveServer, 0, len(servers))
+	for _, sv := range servers {
+		if status, ok := statuses[sv.ID]; ok {
+			sv.Status = status
+		}
+		applied = append(applied, sv)
+	}
+	return applied
+}
+
+// getCRStates returns the CRStates of a Traffic Monitor of the given CDN.
+// The Traffic Monitor is requested after the database transaction finding it is done.
+func getCRStates(db *sqlx.DB, dbTimeout time.Duration, cdn tc.CDNName) (tc.CRStates, error) {
+	monitorFQDN, client, err := getMonitor(db, dbTimeout, cdn)
+	if err != nil {
+		return tc.CRStates{}, err
+	}
+	crStates, err := monitorhlp.GetCRStates(monitorFQDN, client)
+	if err != nil {
+		return tc.CRStates{}, errors.New("getting CRStates from " + monitorFQDN + ": " + err.Error())
+	}
+	return crStates, nil
+}
+
+// getMonitor returns the FQDN of an online Traffic Monitor of the given CDN, and the client to request it with.
+func getMonitor(db *sqlx.DB, dbTimeout time.Duration, cdn tc.CDNName) (string, *http.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return "", nil, errors.New("beginning transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	monitors, err := monitorhlp.GetURLs(tx)
+	if err != nil {
+		return "", nil, errors.New("getting monitors: " + err.Error())
+	}
+	monitorFQDN, ok := monitors[cdn]
+	if !ok {
+		return "", nil, errors.New("no online Traffic Monitor found for cdn " + string(cdn))
+	}
+	client, err := monitorhlp.GetClient(tx)
+	if err != nil {
+		return "", nil, errors.New("getting monitor client: " + err.Error())
+	}
+	return monitorFQDN, client, nil
+}
@@ -0,0 +1,194 @@
+package rollout
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestProgressTx(t *testing.T) {
+	now := time.Now()
+	justStarted := now.Add(-time.Second)
+	longAgo := now.Add(-time.Hour)
+	waveServerCols := []string{"id", "host_name", "status", "upd_pending", "name"}
+	reported := string(tc.CacheStatusReported)
+	available := tc.CRStates{Caches: map[tc.CacheName]tc.IsAvailable{"edge1": {IsAvailable: true}, "edge2": {IsAvailable: true}}}
+	unavailable := tc.CRStates{Caches: map[tc.CacheName]tc.IsAvailable{"edge1": {IsAvailable: false}}}
+
+	expectServerUpdate := func(mock sqlmock.Sqlmock, id int, status tc.RolloutServerStatus) {
+		mock.ExpectExec(`UPDATE rollout_server SET status = \$1, message = \$2`).WithArgs(string(status), sqlmock.AnyArg(), 1, id).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	expectFailedCount := func(mock sqlmock.Sqlmock, failed int) {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM rollout_server`).WithArgs(1, string(tc.RolloutServerStatusFailed)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(failed))
+	}
+	expectStatus := func(mock sqlmock.Sqlmock, status tc.RolloutStatus) {
+		mock.ExpectExec(`UPDATE rollout SET status = \$1, message = \$2`).WithArgs(string(status), sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	expectStartWave := func(mock sqlmock.Sqlmock, wave int) {
+		mock.ExpectExec(`UPDATE server SET upd_pending = TRUE`).WithArgs(1, wave, string(tc.RolloutServerStatusPending)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE rollout_server SET status = \$1 WHERE rollout = \$2 AND wave = \$3`).WithArgs(string(tc.RolloutServerStatusQueued), 1, wave, string(tc.RolloutServerStatusPending)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE rollout SET current_wave = \$1`).WithArgs(wave, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	type testCase struct {
+		name        string
+		waveStarted time.Time
+		currentWave int
+		threshold   int
+		servers     *sqlmock.Rows
+		crStates    tc.CRStates
+		crStatesErr error
+		expect      func(mock sqlmock.Sqlmock)
+	}
+	testCases := []testCase{
+		{
+			name:        "wave still queued",
+			waveStarted: justStarted,
+			servers: sqlmock.NewRows(waveServerCols).
+				AddRow(1, "edge1", string(tc.RolloutServerStatusQueued), true, reported).
+				AddRow(2, "edge2", string(tc.RolloutServerStatusQueued), false, reported),
+			crStates: available,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectServerUpdate(mock, 2, tc.RolloutServerStatusUpdated)
+			},
+		},
+		{
+			name:        "newly updated servers wait for Traffic Monitor",
+			waveStarted: justStarted,
+			servers: sqlmock.NewRows(waveServerCols).
+				AddRow(1, "edge1", string(tc.RolloutServerStatusQueued), false, reported),
+			crStates: available,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectServerUpdate(mock, 1, tc.RolloutServerStatusUpdated)
+			},
+		},
+		{
+			name:        "wave done starts next wave",
+			waveStarted: justStarted,
+			servers: sqlmock.NewRows(waveServerCols).
+				AddRow(1, "edge1", string(tc.RolloutServerStatusUpdated), false, reported).
+				AddRow(2, "edge2", string(tc.RolloutServerStatusUpdated), false, reported),
+			crStates: available,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectFailedCount(mock, 0)
+				expectStartWave(mock, 1)
+			},
+		},
+		{
+			name:        "last wave done completes",
+			waveStarted: justStarted,
+			currentWave: 2,
+			servers: sqlmock.NewRows(waveServerCols).
+				AddRow(1, "edge1", string(tc.RolloutServerStatusUpdated), false, reported),
+			crStates: available,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectFailedCount(mock, 0)
+				expectStatus(mock, tc.RolloutStatusCompleted)
+			},
+		},
+		{
+			name:        "timeout fails queued servers and the rollout",
+			waveStarted: longAgo,
+			servers: sqlmock.NewRows(waveServerCols).
+				AddRow(1, "edge1", string(tc.RolloutServerStatusQueued), true, reported),
+			crStates: available,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectServerUpdate(mock, 1, tc.RolloutServerStatusFailed)
+				expectFailedCount(mock, 1)
+				expectStatus(mock, tc.RolloutStatusFailed)
+			},
+		},
+		{
+			name:        "unavailable server within threshold starts next wave",
+			waveStarted: justStarted,
+			threshold:   1,
+			servers: sqlmock.NewRows(waveServerCols).
+				AddRow(1, "edge1", string(tc.RolloutServerStatusUpdated), false, reported),
+			crStates: unavailable,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectServerUpdate(mock, 1, tc.RolloutServerStatusFailed)
+				expectFailedCount(mock, 1)
+				expectStartWave(mock, 1)
+			},
+		},
+		{
+			name:        "unavailable server over threshold fails",
+			waveStarted: justStarted,
+			servers: sqlmock.NewRows(waveServerCols).
+				AddRow(1, "edge1", string(tc.RolloutServerStatusUpdated), false, reported),
+			crStates: unavailable,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectServerUpdate(mock, 1, tc.RolloutServerStatusFailed)
+				expectFailedCount(mock, 1)
+				expectStatus(mock, tc.RolloutStatusFailed)
+			},
+		},
+		{
+			name:        "Traffic Monitor unavailable waits",
+			waveStarted: justStarted,
+			servers: sqlmock.NewRows(waveServerCols).
+				AddRow(1, "edge1", string(tc.RolloutServerStatusUpdated), false, reported),
+			crStatesErr: errors.New("connection refused"),
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE rollout SET message = \$1`).WithArgs("waiting for Traffic Monitor: connection refused", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`FROM rollout_server AS rs`).WithArgs(1, test.currentWave).WillReturnRows(test.servers)
+			test.expect(mock)
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatalf("beginning transaction: %v", err)
+			}
+			rollout := progressRollout{
+				ID:                 1,
+				CDN:                "cdn0",
+				FailureThreshold:   test.threshold,
+				WaveTimeoutSeconds: 60,
+				CurrentWave:        test.currentWave,
+				Waves:              3,
+				WaveStarted:        &test.waveStarted,
+			}
+			if err := progressTx(tx, rollout, test.crStates, test.crStatesErr, now); err != nil {
+				t.Fatalf("expected no error, actual: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("expected database calls not made: %v", err)
+			}
+		})
+	}
+}
@@ -74,11 +74,13 @@ import (
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/profileparameter"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/region"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/role"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/rollout"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/routing/middleware"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/server"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/servercapability"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/servercheck"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/servercheck/extensions"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/serverconfigreport"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/servicecategory"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/staticdnsentry"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/status"
@@ -365,6 +367,15 @@ func Routes(d ServerData) ([]Route, []RawRoute, http.Handler, error) {
 		{api.Version{Major: 4, Minor: 0}, http.MethodPost, `cdn_notifications/?$`, cdnnotification.Create, auth.PrivLevelOperations, Authenticated, nil, 2765223513},
 		{api.Version{Major: 4, Minor: 0}, http.MethodDelete, `cdn_notifications/?$`, cdnnotification.Delete, auth.PrivLevelOperations, Authenticated, nil, 2722411851},
 
+		//Server config reports
+		{api.Version{Major: 4, Minor: 0}, http.MethodGet, `server_config_reports/?$`, serverconfigreport.Read, auth.PrivLevelReadOnly, Authenticated, nil, 4430129281},
+		{api.Version{Major: 4, Minor: 0}, http.MethodPost, `server_config_reports/?$`, serverconfigreport.Create, auth.PrivLevelOperations, Authenticated, nil, 4430129282},
+
+		//Rollouts
+		{api.Version{Major: 4, Minor: 0}, http.MethodGet, `rollouts/?$`, rollout.Read, auth.PrivLevelReadOnly, Authenticated, nil, 4476710791},
+		{api.Version{Major: 4, Minor: 0}, http.MethodPost, `rollouts/?$`, rollout.Create, auth.PrivLevelOperations, Authenticated, nil, 4476710792},
+		{api.Version{Major: 4, Minor: 0}, http.MethodPost, `rollouts/{id}/stop/?$`, rollout.Stop, auth.PrivLevelOperations, Authenticated, nil, 4476710793},
+
 		//CDN generic handlers:
 		{api.Version{Major: 4, Minor: 0}, http.MethodGet, `cdns/?$`, api.ReadHandler(&cdn.TOCDN{}), auth.PrivLevelReadOnly, Authenticated, nil, 42303186213},
 		{api.Version{Major: 4, Minor: 0}, http.MethodPut, `cdns/{id}$`, api.UpdateHandler(&cdn.TOCDN{}), auth.PrivLevelOperations, Authenticated, nil, 43111789343},
@@ -29,8 +29,29 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/util/ims"
 )
 
+// selectUpdateStatusMaxLastUpdatedQuery returns the latest time anything the
+// update status of the server named :hostName depends on was changed: the
+// servers in its CDN (including its parents), the cachegroups and topologies
+// which determine its parents, and the use_reval_pending Parameter.
+func selectUpdateStatusMaxLastUpdatedQuery() string {
+	return `SELECT max(t) from (
+	SELECT max(s.last_updated) as t FROM server s
+	WHERE s.cdn_id = (SELECT cdn_id FROM server WHERE host_name = :hostName)
+UNION ALL
+	SELECT max(last_updated) as t FROM cachegroup
+UNION ALL
+	SELECT max(last_updated) as t FROM topology_cachegroup_parents
+UNION ALL
+	SELECT max(p.last_updated) as t FROM parameter p
+	WHERE p.name = :paramName AND p.config_file = :configFile
+UNION ALL
+	SELECT max(last_updated) as t FROM last_deleted l
+	WHERE l.table_name IN ('server', 'cachegroup', 'topology_cachegroup_parents', 'parameter')) as res`
+}
+
 func GetServerUpdateStatusHandler(w http.ResponseWriter, r *http.Request) {
 	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"host_name"}, nil)
 	if userErr != nil || sysErr != nil {
@@ -39,6 +60,28 @@ func GetServerUpdateStatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer inf.Close()
 
+	useIMS := inf.Config != nil && inf.Config.UseIMS
+	if useIMS {
+		queryValues := map[string]interface{}{
+			"hostName":   inf.Params["host_name"],
+			"paramName":  tc.UseRevalPendingParameterName,
+			"configFile": tc.GlobalConfigFileName,
+		}
+		runSecond, maxTime := ims.TryIfModifiedSinceQuery(inf.Tx, r.Header, queryValues, selectUpdateStatusMaxLastUpdatedQuery())
+		if !runSecond {
+			log.Debugln("IMS HIT")
+			api.AddLastModifiedHdr(w, maxTime)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		log.Debugln("IMS MISS")
+		if api.SetLastModifiedHeader(r, useIMS) && !maxTime.IsZero() {
+			api.AddLastModifiedHdr(w, maxTime)
+		}
+	} else {
+		log.Debugln("Non IMS request")
+	}
+
 	serverUpdateStatus, err := getServerUpdateStatus(inf.Tx.Tx, inf.Config, inf.Params["host_name"])
 	if err != nil {
 		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, err)
@@ -0,0 +1,253 @@
+package serverconfigreport
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
+
+	"github.com/lib/pq"
+)
+
+// MaxReportsPerServer is the number of reports kept for each server. When a
+// new report is created, older reports of the same server beyond this number
+// are deleted, so caches running t3c-apply frequently don't grow the table
+// without bound.
+const MaxReportsPerServer = 100
+
+const readQuery = `
+SELECT r.id,
+	r.server,
+	s.host_name,
+	cg.name,
+	cdn.name,
+	r.mode,
+	r.success,
+	r.start_time,
+	r.duration_ms,
+	r.reloaded,
+	r.restarted,
+	r.files,
+	r.packages,
+	r.warnings,
+	r.errors,
+	r.last_updated
+FROM server_config_report AS r
+INNER JOIN server AS s ON s.id = r.server
+INNER JOIN cachegroup AS cg ON cg.id = s.cachegroup
+INNER JOIN cdn ON cdn.id = s.cdn_id
+`
+
+const insertQuery = `
+INSERT INTO server_config_report (server, mode, success, start_time, duration_ms, reloaded, restarted, files, packages, warnings, errors)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING id
+`
+
+const pruneQuery = `
+DELETE FROM server_config_report
+WHERE server = $1
+AND id NOT IN (
+	SELECT id FROM server_config_report
+	WHERE server = $1
+	ORDER BY start_time DESC, id DESC
+	LIMIT $2
+)
+`
+
+// Read is the handler for GET requests to /server_config_reports.
+func Read(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	tx := inf.Tx.Tx
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	queryParamsToQueryCols := map[string]dbhelpers.WhereColumnInfo{
+		"id":           dbhelpers.WhereColumnInfo{Column: "r.id", Checker: api.IsInt},
+		"serverId":     dbhelpers.WhereColumnInfo{Column: "r.server", Checker: api.IsInt},
+		"hostName":     dbhelpers.WhereColumnInfo{Column: "s.host_name"},
+		"cachegroup":   dbhelpers.WhereColumnInfo{Column: "cg.name"},
+		"cachegroupId": dbhelpers.WhereColumnInfo{Column: "cg.id", Checker: api.IsInt},
+		"cdn":          dbhelpers.WhereColumnInfo{Column: "cdn.name"},
+		"cdnId":        dbhelpers.WhereColumnInfo{Column: "cdn.id", Checker: api.IsInt},
+		"mode":         dbhelpers.WhereColumnInfo{Column: "r.mode"},
+		"success":      dbhelpers.WhereColumnInfo{Column: "r.success", Checker: api.IsBool},
+		"startTime":    dbhelpers.WhereColumnInfo{Column: "r.start_time"},
+	}
+
+	where, orderBy, pagination, queryValues, errs := dbhelpers.BuildWhereAndOrderByAndPagination(inf.Params, queryParamsToQueryCols)
+	if len(errs) > 0 {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, util.JoinErrs(errs), nil)
+		return
+	}
+	if orderBy == "" {
+		// newest first, so the default is the most useful view of a server's recent runs
+		orderBy = "\nORDER BY r.start_time DESC, r.id DESC"
+	}
+
+	rows, err := inf.Tx.NamedQuery(readQuery+where+orderBy+pagination, queryValues)
+	if err != nil {
+		userErr, sysErr, errCode = api.ParseDBError(err)
+		if sysErr != nil {
+			sysErr = fmt.Errorf("server config report read query: %v", sysErr)
+		}
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	defer rows.Close()
+
+	reports := []tc.ServerConfigReport{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("scanning server config reports: "+err.Error()))
+			return
+		}
+		reports = append(reports, report)
+	}
+
+	api.WriteResp(w, r, reports)
+}
+
+// Create is the handler for POST requests to /server_config_reports.
+func Create(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	tx := inf.Tx.Tx
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	var req tc.ServerConfigReportRequest
+	if userErr = api.Parse(r.Body, tx, &req); userErr != nil {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, userErr, nil)
+		return
+	}
+
+	serverID, ok, err := dbhelpers.GetServerIDFromName(req.HostName, tx)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("getting server ID for server config report: "+err.Error()))
+		return
+	} else if !ok {
+		api.HandleErr(w, r, tx, http.StatusNotFound, errors.New("no server with host name "+req.HostName), nil)
+		return
+	}
+
+	files := req.Files
+	if files == nil {
+		files = []tc.ServerConfigReportFile{}
+	}
+	filesJSON, err := json.Marshal(files)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("marshalling server config report files: "+err.Error()))
+		return
+	}
+	pkgs := req.Packages
+	if pkgs == nil {
+		pkgs = []tc.ServerConfigReportPackage{}
+	}
+	pkgsJSON, err := json.Marshal(pkgs)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("marshalling server config report packages: "+err.Error()))
+		return
+	}
+	warnings := req.Warnings
+	if warnings == nil {
+		warnings = []string{}
+	}
+	errs := req.Errors
+	if errs == nil {
+		errs = []string{}
+	}
+
+	id := 0
+	if err := tx.QueryRow(insertQuery, serverID, req.Mode, req.Success, req.StartTime, req.DurationMS, req.Reloaded, req.Restarted, filesJSON, pkgsJSON, pq.Array(warnings), pq.Array(errs)).Scan(&id); err != nil {
+		userErr, sysErr, errCode = api.ParseDBError(err)
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+
+	if _, err := tx.Exec(pruneQuery, serverID, MaxReportsPerServer); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, errors.New("pruning old server config reports: "+err.Error()))
+		return
+	}
+
+	resp, err := scanReport(tx.QueryRow(readQuery+"WHERE r.id = $1", id))
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("querying created server config report %d: %v", id, err))
+		return
+	}
+
+	// No change log entry is created, because every t3c-apply run creates a report, which would flood the change log.
+
+	alertMsg := fmt.Sprintf("Server config report created for server %s", resp.HostName)
+	alerts := tc.CreateAlerts(tc.SuccessLevel, alertMsg)
+	api.WriteAlertsObj(w, r, http.StatusCreated, alerts, resp)
+}
+
+// scanner is a row which can be scanned, such as *sql.Row, *sql.Rows, or *sqlx.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanReport scans a row of readQuery into a ServerConfigReport.
+func scanReport(row scanner) (tc.ServerConfigReport, error) {
+	report := tc.ServerConfigReport{}
+	filesJSON := []byte{}
+	pkgsJSON := []byte{}
+	if err := row.Scan(
+		&report.ID,
+		&report.ServerID,
+		&report.HostName,
+		&report.Cachegroup,
+		&report.CDN,
+		&report.Mode,
+		&report.Success,
+		&report.StartTime,
+		&report.DurationMS,
+		&report.Reloaded,
+		&report.Restarted,
+		&filesJSON,
+		&pkgsJSON,
+		pq.Array(&report.Warnings),
+		pq.Array(&report.Errors),
+		&report.LastUpdated,
+	); err != nil {
+		return tc.ServerConfigReport{}, err
+	}
+	if err := json.Unmarshal(filesJSON, &report.Files); err != nil {
+		return tc.ServerConfigReport{}, errors.New("unmarshalling files: " + err.Error())
+	}
+	if err := json.Unmarshal(pkgsJSON, &report.Packages); err != nil {
+		return tc.ServerConfigReport{}, errors.New("unmarshalling packages: " + err.Error())
+	}
+	return report, nil
+}
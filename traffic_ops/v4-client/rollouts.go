@@ -0,0 +1,53 @@
+package client
+
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"fmt"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
+)
+
+// apiRollouts is the API version-relative path to the /rollouts API endpoint.
+const apiRollouts = "/rollouts"
+
+// apiRolloutsIDStop is the API version-relative path to the
+// /rollouts/{{ID}}/stop API endpoint.
+const apiRolloutsIDStop = apiRollouts + "/%d/stop"
+
+// GetRollouts returns a list of staged rollouts of queued server updates.
+func (to *Session) GetRollouts(opts RequestOptions) (tc.RolloutsResponse, toclientlib.ReqInf, error) {
+	var data tc.RolloutsResponse
+	reqInf, err := to.get(apiRollouts, opts, &data)
+	return data, reqInf, err
+}
+
+// CreateRollout starts a staged rollout of server updates, queueing updates
+// to its first wave of servers.
+func (to *Session) CreateRollout(rollout tc.RolloutRequest, opts RequestOptions) (tc.RolloutResponse, toclientlib.ReqInf, error) {
+	var data tc.RolloutResponse
+	reqInf, err := to.post(apiRollouts, opts, rollout, &data)
+	return data, reqInf, err
+}
+
+// StopRollout stops the running rollout with the given ID, so no more waves
+// of servers have their updates queued.
+func (to *Session) StopRollout(id int, opts RequestOptions) (tc.RolloutResponse, toclientlib.ReqInf, error) {
+	var data tc.RolloutResponse
+	reqInf, err := to.post(fmt.Sprintf(apiRolloutsIDStop, id), opts, nil, &data)
+	return data, reqInf, err
+}
@@ -0,0 +1,40 @@
+package client
+
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
+)
+
+// apiServerConfigReports is the API version-relative path to the
+// /server_config_reports API endpoint.
+const apiServerConfigReports = "/server_config_reports"
+
+// GetServerConfigReports returns a list of the config apply reports of cache
+// servers.
+func (to *Session) GetServerConfigReports(opts RequestOptions) (tc.ServerConfigReportsResponse, toclientlib.ReqInf, error) {
+	var data tc.ServerConfigReportsResponse
+	reqInf, err := to.get(apiServerConfigReports, opts, &data)
+	return data, reqInf, err
+}
+
+// CreateServerConfigReport creates a config apply report for a cache server.
+func (to *Session) CreateServerConfigReport(report tc.ServerConfigReportRequest, opts RequestOptions) (tc.ServerConfigReportResponse, toclientlib.ReqInf, error) {
+	var data tc.ServerConfigReportResponse
+	reqInf, err := to.post(apiServerConfigReports, opts, report, &data)
+	return data, reqInf, err
+}